@@ -1,40 +1,91 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"cicli/internal/analyzer"
+	"cicli/internal/anchors"
+	"cicli/internal/audit"
+	"cicli/internal/baseimages"
+	"cicli/internal/cache"
+	"cicli/internal/catalog"
 	"cicli/internal/config"
 	"cicli/internal/converter"
 	"cicli/internal/deploy"
+	"cicli/internal/diff"
 	"cicli/internal/docker"
+	"cicli/internal/freeze"
 	"cicli/internal/generator"
+	"cicli/internal/github"
+	"cicli/internal/httpclient"
+	"cicli/internal/i18n"
+	"cicli/internal/infra"
 	"cicli/internal/linter"
+	"cicli/internal/marker"
+	"cicli/internal/metrics"
+	"cicli/internal/migrate"
 	"cicli/internal/notify"
 	"cicli/internal/optimizer"
+	"cicli/internal/pipetest"
+	"cicli/internal/progress"
+	"cicli/internal/release"
+	"cicli/internal/score"
+	"cicli/internal/secrets"
+	"cicli/internal/selfupdate"
 	"cicli/internal/store"
+	"cicli/internal/tasks"
+	"cicli/internal/term"
 	"cicli/internal/validator"
+	"cicli/internal/yamlfmt"
+
+	"github.com/charmbracelet/huh"
+	"gopkg.in/yaml.v3"
 )
 
 const version = "2.0.0"
 
+var startTime = time.Now()
+
+// quiet suppresses the banner, progress notes and tips
+var quiet bool
+
+// outputFormat is the global --output=json|yaml|table, which overrides the
+// --format of every command that prints a report
+var outputFormat string
+
+// outputFormats maps --output values to the format names commands use;
+// other values are left to commands that take --output=<file>
+var outputFormats = map[string]string{"json": "json", "yaml": "yaml", "table": "text"}
+
 func main() {
-	printBanner()
+	parseGlobalFlags()
+	configureFromFile()
 
 	if len(os.Args) < 2 {
+		printBanner()
 		printHelp()
-		os.Exit(1)
+		exit(1)
 	}
 
 	command := os.Args[1]
 	switch command {
 	case "version", "-v", "--version":
-		fmt.Printf("cicli version %s\n", version)
+		printBanner()
+		term.Printf("cicli version %s\n", version)
 
 	case "help", "-h", "--help":
+		printBanner()
 		printHelp()
 
 	case "init":
@@ -43,18 +94,39 @@ func main() {
 	case "analyze":
 		handleAnalyze()
 
+	case "score":
+		handleScore()
+
 	case "generate":
 		handleGenerate()
 
 	case "convert":
 		handleConvert()
 
+	case "migrate":
+		handleMigrate()
+
 	case "lint":
 		handleLint()
 
+	case "fmt":
+		handleFmt()
+
 	case "optimize":
 		handleOptimize()
 
+	case "audit":
+		handleAudit()
+
+	case "test-pipeline":
+		handleTestPipeline()
+
+	case "triggers":
+		handleTriggers()
+
+	case "extract":
+		handleExtract()
+
 	case "docker":
 		handleDocker()
 
@@ -64,758 +136,4995 @@ func main() {
 	case "rollback":
 		handleRollback()
 
+	case "promote":
+		handlePromote()
+
+	case "ship":
+		handleShip()
+
 	case "history":
 		handleHistory()
 
+	case "logs":
+		handleLogs()
+
+	case "status":
+		handleStatus()
+
+	case "port-forward":
+		handlePortForward()
+
 	case "notify":
 		handleNotify()
 
+	case "env":
+		handleEnv()
+
+	case "envs":
+		handleEnvs()
+
+	case "self":
+		handleSelf()
+
+	case "cache":
+		handleCache()
+
+	case "images":
+		handleImages()
+
+	case "export":
+		handleExport()
+
+	case "stats":
+		handleStats()
+
 	default:
-		fmt.Printf("Unknown command: %s\n", command)
+		term.Printf("Unknown command: %s\n", command)
 		printHelp()
-		os.Exit(1)
+		exit(1)
+	}
+
+	exit(0)
+}
+
+// parseGlobalFlags applies flags accepted by every command and removes them
+// from os.Args so command handlers only see their own arguments
+func parseGlobalFlags() {
+	i18n.SetLanguage(i18n.Detect())
+	mode := term.DetectMode()
+
+	args := []string{os.Args[0]}
+	for _, arg := range os.Args[1:] {
+		switch {
+		case strings.HasPrefix(arg, "--lang="):
+			i18n.SetLanguage(strings.TrimPrefix(arg, "--lang="))
+		case strings.HasPrefix(arg, "--profile="):
+			config.Profile = strings.TrimPrefix(arg, "--profile=")
+		case arg == "--no-emoji":
+			mode.NoEmoji = true
+		case arg == "--plain":
+			mode = term.Mode{NoEmoji: true, NoBox: true, NoColor: true}
+		case arg == "--quiet" || arg == "-q":
+			quiet = true
+			progress.Disabled = true
+		case strings.HasPrefix(arg, "--output=") && outputFormats[strings.TrimPrefix(arg, "--output=")] != "":
+			outputFormat = outputFormats[strings.TrimPrefix(arg, "--output=")]
+		default:
+			args = append(args, arg)
+		}
+	}
+	os.Args = args
+
+	if mode.Plain() {
+		progress.Plain = true
+	}
+	term.SetMode(mode)
+}
+
+// commandFormat returns a command's --format, unless the global --output
+// overrides it
+func commandFormat(format string) string {
+	if outputFormat != "" {
+		return outputFormat
+	}
+	return format
+}
+
+// printEncoded prints v as encodeReport formats it
+func printEncoded(v interface{}, format string) {
+	data, err := encodeReport(v, format)
+	if err != nil {
+		term.Printf("Error encoding results: %v\n", err)
+		exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+// encodeReport encodes v as indented JSON, or as YAML with the same field
+// names and order: the JSON encoding is re-read as a YAML node tree and
+// written back in block style.
+func encodeReport(v interface{}, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err == nil && format == "yaml" {
+		var node yaml.Node
+		if err = yaml.Unmarshal(data, &node); err == nil {
+			blockStyle(&node)
+			data, err = yaml.Marshal(&node)
+			data = bytes.TrimSuffix(data, []byte("\n"))
+		}
+	}
+	return data, err
+}
+
+// blockStyle clears the flow and quoting styles JSON input leaves on a node
+// tree; the encoder still quotes strings that would read as another type
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// configureFromFile applies the settings of cicli.yaml, when there is one,
+// that hold for every command: the http: settings of every HTTP client cicli
+// creates, the custom rules of lint.rules, the lint.public rule set and the
+// lint.profile rule profile
+func configureFromFile() {
+	var settings httpclient.Settings
+	var rules []linter.CustomRule
+	if cfg, err := config.LoadConfig("cicli.yaml"); err == nil {
+		settings = cfg.HTTP
+		rules = cfg.Lint.Rules
+		linter.PublicRepository = cfg.Lint.Public
+		if cfg.Lint.Profile != "" {
+			if err := linter.SetProfile(cfg.Lint.Profile); err != nil {
+				term.Printf("Error in cicli.yaml: lint.profile: %v\n", err)
+				exit(1)
+			}
+		}
+	}
+	if err := httpclient.Configure(settings); err != nil {
+		term.Printf("Error configuring HTTP: %v\n", err)
+		exit(1)
+	}
+	for _, rule := range rules {
+		if err := rule.Register(); err != nil {
+			term.Printf("Error in cicli.yaml: %v\n", err)
+			exit(1)
+		}
+	}
+}
+
+// exit records the invocation in the opt-in local metrics file, then terminates
+func exit(code int) {
+	if len(os.Args) > 1 {
+		if r, err := metrics.NewRecorder(); err == nil {
+			cwd, _ := os.Getwd()
+			_ = r.Record(metrics.Entry{
+				Timestamp:  startTime,
+				Command:    metricsCommand(),
+				Repo:       filepath.Base(cwd),
+				DurationMs: time.Since(startTime).Milliseconds(),
+				ExitCode:   code,
+			})
+		}
+	}
+	os.Exit(code)
+}
+
+// metricsCommand names the invocation, including the subcommand for command groups
+func metricsCommand() string {
+	command := os.Args[1]
+	switch command {
+	case "docker", "generate", "self", "stats", "cache", "env", "envs", "triggers":
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "-") {
+			command += " " + os.Args[2]
+		}
+	case "audit":
+		if len(os.Args) > 2 && os.Args[2] == "secrets" {
+			command += " secrets"
+		}
 	}
+	return command
 }
 
+// printBanner shows the logo for interactive help/version output only
 func printBanner() {
-	fmt.Println(`
+	if quiet || !term.IsTerminal(os.Stdout) {
+		return
+	}
+	term.Println(`
    ______  _   ______  __     ____
   / ____/ (_) / ____/ / /    /  _/
  / /     / / / /     / /     / /  
 / /___  / / / /___  / /___ _/ /   
 \____/ /_/  \____/ /_____//___/   
                                   `)
-	fmt.Println("CiCLI - Universal CI/CD Toolkit v" + version)
-	fmt.Println()
+	term.Println("CiCLI - Universal CI/CD Toolkit v" + version)
+	term.Println()
 }
 
 func printHelp() {
-	fmt.Println(`Usage: cicli <command> [options]
+	term.Println(`Usage: cicli <command> [options]
 
 Core Commands:
   init                    Initialize project configuration
   analyze                 Analyze project and detect technologies
+  score                   CI/CD maturity scorecard with trend tracking
   generate                Generate CI/CD pipelines and configs
 
 Pipeline Tools:
   convert                 Convert between CI/CD platforms
+  migrate                 Guided migration: convert, map secrets, open a PR
   lint                    Lint and validate CI/CD configurations
+  fmt                     Format CI YAML canonically (--check for CI)
   optimize                Analyze and optimize pipelines
+  audit                   Lint + optimize, failing only on regressions
+  audit secrets           Where each secret is exposed, and to whom
+  test-pipeline           Check which jobs run for simulated events
+  triggers simulate       Show which workflows and jobs an event would run
+  extract                 Write CI commands into a Makefile or Taskfile
+  cache advise            Recommend (and inject) dependency cache config
+  cache status            GitHub Actions cache usage, hit ratio and stale keys
+  images                  Base images past end of life or behind on patches
+  export backstage        Write a Backstage catalog-info.yaml for the repository
 
 Deployment:
   docker publish          Build & push Docker images
-  deploy                  Deploy to Kubernetes/AWS
+  deploy                  Deploy to Kubernetes (EKS/GKE/AKS)
   rollback                Rollback to previous version
+  promote                 Deploy the image running in one env to another
+  ship                    Build, scan, push, deploy, verify and notify in one run
   history                 View deployment history
+  logs                    Stream logs from a deployed app
+  status                  Show replicas, image and events of a deployed app
+  port-forward            Forward a local port to a deployed app
+  env create|list|destroy Ephemeral per-PR environments with a TTL
+  envs diff               Compare what is deployed across environments
   notify                  Send deployment notifications
 
+Maintenance:
+  self update             Update cicli to the latest release
+  self install-action     Print a snippet that installs cicli in CI
+  stats self              Summarize your local cicli usage (opt-in)
+
 Examples:
   cicli analyze                              Analyze current project
+  cicli score --format=json                  Maturity scorecard as JSON
   cicli generate --platform github           Generate GitHub Actions workflow
+  cicli generate pipeline --with-deploy      Add a cicli-based deploy job
+  cicli generate --name=Build --output=.github/workflows/build.yml
+  cicli generate --test-shards=4             Split tests across 4 parallel shards
+  cicli generate --e2e-shards=3              Split the Playwright/Cypress suite across 3 jobs
+  cicli generate --with-coverage=codecov     Collect coverage and upload it to Codecov
+  cicli generate --split-triggers            Separate PR, main and nightly workflows
+  cicli generate pipeline --with-lint        Add golangci-lint, ruff or eslint (changed files on PRs)
+  cicli generate --bazel-remote-cache=grpcs://cache.example.com
+                                             Share Bazel results through a remote cache
+  cicli generate infra --cloud=aws           Terraform for the ECR repos, OIDC role and EKS access the pipelines use
   cicli convert --from gitlab --to github    Convert GitLab CI to GitHub Actions
+  cicli convert --from=gitlab --to=github --dry-run
+                                             Preview the conversion as a diff
+  cicli migrate --to=github --disable=rename --pr
+                                             Migrate the repo's CI and open a PR
   cicli lint .github/workflows/ci.yml        Lint a workflow file
+  cicli lint --format=json                   Lint all CI files, JSON output
+  cicli analyze --output=yaml                Project analysis as YAML
+  cicli analyze --out=project.json           Write the analysis for other tools (--schema prints its JSON Schema)
+  cicli lint --format=sarif > lint.sarif     SARIF for GitHub Code Scanning
+  cicli lint --fix                           Apply auto-fixable issues and show the diff
+  cicli lint --public                        Add fork-safety checks for public repositories
+  cicli lint --rule-profile=security-strict  Add fork-safety and self-hosted runner checks
+  cicli lint --external                      Merge in actionlint and yamllint findings
+  cicli images --apply --pr                  Update Dockerfile and CI images and open a PR
+  cicli export backstage --owner=group:team-a
+                                             Service catalog entry from the analysis and cicli.yaml
+  cicli fmt --check                          Fail when CI YAML is not canonically formatted
   cicli optimize .github/workflows/ci.yml    Get optimization suggestions
+  cicli optimize --benchmark --runs=3        Measure the optimizations with act
+  cicli audit --baseline=last                Nightly audit against the previous report
+  cicli audit secrets --fail-on=medium       Flag secrets reachable by forks or third-party actions
+  cicli test-pipeline                        Run the assertions in .cicli/pipeline-tests.yml
+  cicli triggers simulate --event=pull_request --branch=feature/x --paths=docs/README.md
+  cicli extract --to=make --rewrite          Move CI commands into a Makefile CI calls
+  cicli ship --env=staging --from=deploy     Resume a failed ship run at its deploy stage
 
 Options:
   -h, --help      Show this help message
-  -v, --version   Show version information`)
+  -v, --version   Show version information
+  --lang=<code>   Output language: en, es, ja (default: from LANG)
+  --profile=<p>   Settings of profile p in cicli.yaml, or of cicli.<p>.yaml
+  --no-emoji      Replace emojis with plain-text markers
+  --plain         Strip emojis, box-drawing and colors (automatic when piped or in CI)
+  -q, --quiet     Suppress the banner, progress notes and tips
+  --output=<fmt>  Report format for every command: json, yaml or table`)
 }
 
 // handleInit initializes project configuration
 func handleInit() {
 	if err := config.InitConfig(); err != nil {
-		fmt.Printf("Error initializing config: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error initializing config: %v\n", err)
+		exit(1)
 	}
 }
 
-// handleAnalyze analyzes the project
+// handleAnalyze analyzes the project. JSON and YAML reports are wrapped in
+// analyzer.Report so they carry the schema version.
 func handleAnalyze() {
 	path := "."
-	if len(os.Args) > 2 {
-		path = os.Args[2]
+	format := "text"
+	out := ""
+	for _, arg := range os.Args[2:] {
+		switch {
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case strings.HasPrefix(arg, "--out="):
+			out = strings.TrimPrefix(arg, "--out=")
+		case arg == "--schema":
+			fmt.Print(string(analyzer.Schema))
+			return
+		case !strings.HasPrefix(arg, "-"):
+			path = arg
+		}
+	}
+	format = commandFormat(format)
+	if format == "table" {
+		format = "text"
+	}
+	if format == "text" && out != "" {
+		// A report file is for tools, so it defaults to JSON
+		format = "json"
+		if ext := filepath.Ext(out); ext == ".yaml" || ext == ".yml" {
+			format = "yaml"
+		}
+	}
+	if format != "text" && format != "json" && format != "yaml" {
+		term.Printf("Unknown format: %s (supported: text, json, yaml)\n", format)
+		exit(1)
 	}
 
-	fmt.Println("🔍 Analyzing project...")
+	if !quiet && format == "text" {
+		term.Println("🔍 Analyzing project...")
+	}
 
 	a := analyzer.NewAnalyzer(path)
-	info, err := a.Analyze()
+	var info *analyzer.ProjectInfo
+	err := progress.Run("Scanning project files", func() (err error) {
+		info, err = a.Analyze()
+		return err
+	})
 	if err != nil {
-		fmt.Printf("Error analyzing project: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error analyzing project: %v\n", err)
+		exit(1)
 	}
 
-	info.PrintReport()
+	if format == "text" {
+		info.PrintReport()
+		return
+	}
+	if out == "" {
+		printEncoded(analyzer.NewReport(info), format)
+		return
+	}
+	data, err := encodeReport(analyzer.NewReport(info), format)
+	if err == nil {
+		err = os.WriteFile(out, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		term.Printf("Error writing %s: %v\n", out, err)
+		exit(1)
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "📄 Analysis: %s (schema v%d)\n", out, analyzer.SchemaVersion)
+	}
 }
 
-// handleGenerate generates CI/CD configurations
-func handleGenerate() {
-	if len(os.Args) < 3 {
-		// Smart generate based on analysis
-		fmt.Println("🔍 Analyzing project for smart generation...")
-
-		a := analyzer.NewAnalyzer(".")
-		info, err := a.Analyze()
-		if err != nil {
-			fmt.Printf("Error analyzing project: %v\n", err)
-			os.Exit(1)
+// handleScore combines analysis, lint and optimization findings into a
+// maturity scorecard and records it for trend tracking
+func handleScore() {
+	path := "."
+	format := "text"
+	save := true
+	for _, arg := range os.Args[2:] {
+		switch {
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case arg == "--no-save":
+			save = false
+		case !strings.HasPrefix(arg, "-"):
+			path = arg
 		}
-
-		// Generate based on detected stack
-		generateSmartPipeline(info)
-		return
+	}
+	format = commandFormat(format)
+	if format != "text" && format != "json" && format != "yaml" {
+		term.Printf("Unknown format: %s (supported: text, json, yaml)\n", format)
+		exit(1)
 	}
 
-	subCmd := os.Args[2]
-	switch subCmd {
-	case "pipeline", "workflow":
-		platform := "github"
-		for _, arg := range os.Args[3:] {
-			if strings.HasPrefix(arg, "--platform=") {
-				platform = strings.TrimPrefix(arg, "--platform=")
+	in := score.Inputs{Root: path}
+	err := progress.Run("Scoring project", func() (err error) {
+		if in.Project, err = analyzer.NewAnalyzer(path).Analyze(); err != nil {
+			return err
+		}
+		if in.Lint, err = linter.NewLinter().LintDirectory(path); err != nil {
+			return err
+		}
+		o := optimizer.NewOptimizer()
+		for _, r := range in.Lint {
+			if opt, err := o.Analyze(r.File); err == nil {
+				in.Optimizations = append(in.Optimizations, opt)
 			}
 		}
-		generatePipeline(platform)
-
-	case "dockerfile":
-		generateDockerfile()
-
-	case "k8s", "kubernetes":
-		generateKubernetes()
+		return nil
+	})
+	if err != nil {
+		term.Printf("Error scoring project: %v\n", err)
+		exit(1)
+	}
 
-	default:
-		// Try loading cicli.yaml for traditional generate
-		cfg, err := config.LoadConfig("cicli.yaml")
-		if err != nil {
-			fmt.Printf("Error loading config: %v\n", err)
-			os.Exit(1)
+	card := score.Compute(in)
+	history := score.NewHistory(path)
+	if past, err := history.Load(); err == nil && len(past) > 0 {
+		card.Previous = &past[len(past)-1]
+	}
+	if save {
+		if err := history.Add(card); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not record score history: %v\n", err)
 		}
+	}
 
-		gen := generator.NewGenerator()
-		if err := gen.Generate(cfg); err != nil {
-			fmt.Printf("Error generating pipeline: %v\n", err)
-			os.Exit(1)
-		}
+	if format != "text" {
+		printEncoded(card, format)
+		return
 	}
+	card.PrintReport()
 }
 
-// generateSmartPipeline creates a pipeline based on project analysis
-func generateSmartPipeline(info *analyzer.ProjectInfo) {
-	fmt.Printf("\n📦 Detected: %s", info.Language)
-	if info.Framework != "" {
-		fmt.Printf(" (%s)", info.Framework)
+// handleTestPipeline evaluates pipeline assertions against the workflows,
+// failing when any of them does not hold
+func handleTestPipeline() {
+	file := pipetest.DefaultFile
+	format := "text"
+	for _, arg := range os.Args[2:] {
+		if strings.HasPrefix(arg, "--format=") {
+			format = strings.TrimPrefix(arg, "--format=")
+		} else if !strings.HasPrefix(arg, "-") {
+			file = arg
+		}
+	}
+	format = commandFormat(format)
+	if format != "text" && format != "json" && format != "yaml" {
+		term.Printf("Unknown format: %s (supported: text, json, yaml)\n", format)
+		exit(1)
 	}
-	fmt.Println()
 
-	// Create .github/workflows directory
-	workflowDir := filepath.Join(".github", "workflows")
-	if err := os.MkdirAll(workflowDir, 0755); err != nil {
-		fmt.Printf("Error creating directory: %v\n", err)
-		os.Exit(1)
+	suite, err := pipetest.Load(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			term.Printf("No pipeline tests at %s (see 'cicli help' and the README for the format)\n", file)
+		} else {
+			term.Printf("Error: %v\n", err)
+		}
+		exit(1)
+	}
+	results, err := pipetest.Run(suite, ".")
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
 	}
 
-	// Generate workflow based on detected stack
-	workflow := generateWorkflowForStack(info)
-	
-	outputPath := filepath.Join(workflowDir, "ci.yml")
-	if err := os.WriteFile(outputPath, []byte(workflow), 0644); err != nil {
-		fmt.Printf("Error writing workflow: %v\n", err)
-		os.Exit(1)
+	if format != "text" {
+		printEncoded(results, format)
+	} else {
+		pipetest.PrintReport(file, results)
 	}
 
-	fmt.Printf("✅ Generated: %s\n", outputPath)
-	fmt.Println("\n💡 Tip: Run 'cicli lint' to validate your new workflow")
+	for _, r := range results {
+		if !r.Passed() {
+			exit(1)
+		}
+	}
 }
 
-func generateWorkflowForStack(info *analyzer.ProjectInfo) string {
-	var sb strings.Builder
+// handleFmt formats CI YAML files in place, or with --check lists those
+// that are not formatted and shows the diff
+func handleFmt() {
+	check := false
+	var paths []string
+	for _, arg := range os.Args[2:] {
+		if arg == "--check" {
+			check = true
+		} else if !strings.HasPrefix(arg, "-") {
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
 
-	sb.WriteString(fmt.Sprintf(`name: CI
+	var files []string
+	for _, path := range paths {
+		if isDir(path) {
+			files = append(files, yamlfmt.Discover(path)...)
+		} else {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		term.Println("No CI/CD configuration files found")
+		return
+	}
 
-on:
-  push:
-    branches: [main]
-  pull_request:
-    branches: [main]
+	unformatted := 0
+	for _, file := range files {
+		before, after, err := yamlfmt.FormatFile(file)
+		if err != nil {
+			term.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		// Formatting a pristine generated file keeps it marked as pristine
+		if m := marker.Find(string(before)); m != nil && !m.Modified(string(before)) {
+			after = []byte(marker.Stamp(string(after), *m, "#"))
+		}
+		if string(before) == string(after) {
+			continue
+		}
+		unformatted++
+		if check {
+			fmt.Print(diff.Unified("a/"+filepath.ToSlash(file), "b/"+filepath.ToSlash(file), string(before), string(after)))
+			continue
+		}
+		if err := os.WriteFile(file, after, 0644); err != nil {
+			term.Printf("Error writing %s: %v\n", file, err)
+			exit(1)
+		}
+		term.Printf("✅ Formatted: %s\n", file)
+	}
 
-jobs:
-  build:
-    runs-on: ubuntu-latest
-    steps:
-      - uses: actions/checkout@v4
+	if check && unformatted > 0 {
+		term.Printf("\n%d of %d file(s) are not formatted; run 'cicli fmt' to fix them\n", unformatted, len(files))
+		exit(1)
+	}
+	if !check && unformatted == 0 && !quiet {
+		term.Printf("All %d file(s) already formatted\n", len(files))
+	}
+}
 
-`))
+// handleTriggers dispatches cicli triggers subcommands
+func handleTriggers() {
+	if len(os.Args) < 3 || os.Args[2] != "simulate" {
+		term.Println("Usage: cicli triggers simulate --event=<event> [--branch=<branch>] [--paths=a,b]")
+		exit(1)
+	}
 
-	switch info.Language {
-	case "node":
-		pm := info.PackageManager
-		if pm == "" {
-			pm = "npm"
+	// For pull requests --branch is the head branch and --base the target
+	ev := pipetest.Event{Name: "push"}
+	branch, base, workflow, format := "", "main", "", "text"
+	extra := make(map[string]string)
+	for _, arg := range os.Args[3:] {
+		switch {
+		case strings.HasPrefix(arg, "--event="):
+			ev.Name = strings.TrimPrefix(arg, "--event=")
+		case strings.HasPrefix(arg, "--branch="):
+			branch = strings.TrimPrefix(arg, "--branch=")
+		case strings.HasPrefix(arg, "--base="):
+			base = strings.TrimPrefix(arg, "--base=")
+		case strings.HasPrefix(arg, "--tag="):
+			ev.Tag = strings.TrimPrefix(arg, "--tag=")
+		case strings.HasPrefix(arg, "--action="):
+			ev.Action = strings.TrimPrefix(arg, "--action=")
+		case strings.HasPrefix(arg, "--paths="):
+			ev.Paths = strings.Split(strings.TrimPrefix(arg, "--paths="), ",")
+		case strings.HasPrefix(arg, "--set="):
+			key, value, ok := strings.Cut(strings.TrimPrefix(arg, "--set="), "=")
+			if !ok {
+				term.Println("--set takes context=value, e.g. --set=vars.DEPLOY=true")
+				exit(1)
+			}
+			extra[key] = value
+		case strings.HasPrefix(arg, "--workflow="):
+			workflow = strings.TrimPrefix(arg, "--workflow=")
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
 		}
-		sb.WriteString(fmt.Sprintf(`      - uses: actions/setup-node@v4
-        with:
-          node-version: '20'
-          cache: '%s'
-
-      - name: Install dependencies
-        run: %s install
-
-`, pm, pm))
-		if info.BuildCommand != "" {
-			sb.WriteString(fmt.Sprintf(`      - name: Build
-        run: %s
+	}
+	format = commandFormat(format)
+	if format != "text" && format != "json" && format != "yaml" {
+		term.Printf("Unknown format: %s (supported: text, json, yaml)\n", format)
+		exit(1)
+	}
 
-`, info.BuildCommand))
+	if strings.HasPrefix(ev.Name, "pull_request") {
+		ev.Branch, ev.Head = base, branch
+		if ev.Head == "" {
+			ev.Head = "feature"
 		}
-		if info.TestCommand != "" {
-			sb.WriteString(fmt.Sprintf(`      - name: Test
-        run: %s
-`, info.TestCommand))
+	} else {
+		ev.Branch = branch
+		if ev.Branch == "" && ev.Tag == "" {
+			ev.Branch = "main"
 		}
+	}
 
-	case "go":
-		sb.WriteString(`      - uses: actions/setup-go@v5
-        with:
-          go-version: '1.22'
+	results, err := pipetest.Simulate(".", workflow, ev, extra)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
 
-      - name: Build
-        run: go build -v ./...
+	if format != "text" {
+		printEncoded(results, format)
+	} else {
+		pipetest.PrintSimulation(ev, results)
+	}
+	for _, result := range results {
+		if result.Failed() {
+			exit(1)
+		}
+	}
+}
 
-      - name: Test
-        run: go test -v ./...
-`)
+// handleExtract writes the commands of CI jobs into a Makefile or Taskfile
+// and, with --rewrite, makes GitHub Actions steps call those targets
+func handleExtract() {
+	setWriteMode(os.Args[2:])
+	var from, to, output string
+	rewrite := false
+	for _, arg := range os.Args[2:] {
+		switch {
+		case strings.HasPrefix(arg, "--from="):
+			from = strings.TrimPrefix(arg, "--from=")
+		case strings.HasPrefix(arg, "--to="):
+			to = strings.TrimPrefix(arg, "--to=")
+		case strings.HasPrefix(arg, "--output="):
+			output = strings.TrimPrefix(arg, "--output=")
+		case arg == "--rewrite":
+			rewrite = true
+		}
+	}
+	switch to {
+	case "make":
+		if output == "" {
+			output = "Makefile"
+		}
+	case "task":
+		if output == "" {
+			output = "Taskfile.yml"
+		}
+	default:
+		term.Println("Usage: cicli extract --to=make|task [--from=<platform>] [--output=<file>] [--rewrite] [--dry-run|--stdout|--force]")
+		exit(1)
+	}
 
-	case "python":
-		sb.WriteString(`      - uses: actions/setup-python@v5
-        with:
-          python-version: '3.12'
-          cache: 'pip'
+	found := migrate.Detect(".")
+	var platforms []converter.Platform
+	if from != "" {
+		platforms = []converter.Platform{converter.Platform(from)}
+	} else {
+		for _, p := range migrate.Sources {
+			if len(found[p]) > 0 {
+				platforms = append(platforms, p)
+			}
+		}
+	}
 
-      - name: Install dependencies
-        run: |
-          python -m pip install --upgrade pip
-          pip install -r requirements.txt
+	c := converter.NewConverter()
+	var sets [][]tasks.Target
+	var notes []string
+	var workflows []string
+	for _, p := range platforms {
+		for _, file := range found[p] {
+			config, err := c.Parse(p, file)
+			if err != nil {
+				term.Printf("Error parsing %s: %v\n", file, err)
+				exit(1)
+			}
+			targets, n := tasks.Extract(file, config)
+			sets = append(sets, targets)
+			notes = append(notes, n...)
+			if p == converter.GitHub {
+				workflows = append(workflows, file)
+			}
+		}
+	}
+	targets := tasks.Merge(sets...)
+	if len(targets) == 0 {
+		term.Println("No CI jobs with commands that can run locally were found")
+		exit(1)
+	}
 
-      - name: Lint
-        run: |
-          pip install flake8
-          flake8 . --count --select=E9,F63,F7,F82 --show-source --statistics
+	content := tasks.Makefile(targets)
+	if to == "task" {
+		content = tasks.Taskfile(targets)
+	}
+	if err := writeGenerated(output, content); err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
 
-      - name: Test
-        run: pytest
-`)
+	if rewrite {
+		if len(workflows) == 0 {
+			notes = append(notes, "--rewrite only updates GitHub Actions workflows; none were found")
+		}
+		for _, file := range workflows {
+			original, err := os.ReadFile(file)
+			if err != nil {
+				term.Printf("Error: %v\n", err)
+				exit(1)
+			}
+			updated, n := tasks.RewriteGitHub(file, original, targets, to)
+			notes = append(notes, n...)
+			if string(updated) == string(original) {
+				continue
+			}
+			if err := writeGenerated(file, string(updated)); err != nil {
+				term.Printf("Error: %v\n", err)
+				exit(1)
+			}
+		}
+	}
 
-	case "java":
-		if info.PackageManager == "maven" {
-			sb.WriteString(`      - uses: actions/setup-java@v4
-        with:
-          java-version: '17'
-          distribution: 'temurin'
-          cache: 'maven'
+	if len(notes) > 0 && writeMode != modeStdout {
+		term.Println()
+		for _, note := range notes {
+			term.Printf("   ⚠️  %s\n", note)
+		}
+	}
+}
 
-      - name: Build
-        run: mvn -B package --file pom.xml
+// handleAudit runs lint and optimize, compares the findings against a
+// baseline report and fails (or notifies) only on regressions
+func handleAudit() {
+	if len(os.Args) > 2 && os.Args[2] == "secrets" {
+		handleAuditSecrets()
+		return
+	}
 
-      - name: Test
-        run: mvn test
-`)
-		} else {
-			sb.WriteString(`      - uses: actions/setup-java@v4
-        with:
-          java-version: '17'
-          distribution: 'temurin'
-          cache: 'gradle'
+	path := "."
+	baseline := ""
+	output := audit.DefaultBaseline
+	failOn := "warning"
+	format := "text"
+	notifyRegressions, accept := false, false
+	for _, arg := range os.Args[2:] {
+		switch {
+		case arg == "--accept":
+			accept = true
+		case strings.HasPrefix(arg, "--baseline="):
+			baseline = strings.TrimPrefix(arg, "--baseline=")
+		case strings.HasPrefix(arg, "--output="):
+			output = strings.TrimPrefix(arg, "--output=")
+		case strings.HasPrefix(arg, "--fail-on="):
+			failOn = strings.TrimPrefix(arg, "--fail-on=")
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case arg == "--notify":
+			notifyRegressions = true
+		case !strings.HasPrefix(arg, "-"):
+			path = arg
+		}
+	}
+	if failOn != "error" && failOn != "warning" && failOn != "info" && failOn != "none" {
+		term.Printf("Unknown --fail-on value: %s (supported: error, warning, info, none)\n", failOn)
+		exit(1)
+	}
+	format = commandFormat(format)
+	if format != "text" && format != "json" && format != "yaml" {
+		term.Printf("Unknown format: %s (supported: text, json, yaml)\n", format)
+		exit(1)
+	}
+	if baseline == "last" {
+		baseline = audit.DefaultBaseline
+	}
 
-      - name: Build
-        run: ./gradlew build
+	var current *audit.Report
+	err := progress.Run("Auditing CI configuration", func() (err error) {
+		current, err = audit.Run(path)
+		return err
+	})
+	if err != nil {
+		term.Printf("Error running audit: %v\n", err)
+		exit(1)
+	}
 
-      - name: Test
-        run: ./gradlew test
-`)
+	// Without a baseline every finding counts as new
+	previous := &audit.Report{}
+	if baseline != "" {
+		if previous, err = audit.Load(baseline); err != nil {
+			if !os.IsNotExist(err) {
+				term.Printf("Error loading baseline: %v\n", err)
+				exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "No baseline at %s yet; recording this run as the baseline\n", baseline)
+			previous = current
 		}
+	}
+	diff := audit.Compare(previous, current)
+	regressed := failOn != "none" && len(diff.Regressions(failOn)) > 0
+
+	// Keep the old baseline on regressions so the next run still reports them
+	saved := !regressed || accept || output != baseline
+	if saved {
+		if err := current.Save(output); err != nil {
+			term.Printf("Error saving report: %v\n", err)
+			exit(1)
+		}
+	}
 
-	default:
-		sb.WriteString(`      - name: Build
-        run: echo "Add your build command here"
-
-      - name: Test
-        run: echo "Add your test command here"
-`)
+	if format != "text" {
+		printEncoded(diff, format)
+	} else {
+		diff.PrintReport(failOn)
+		if !quiet && saved {
+			term.Printf("📄 Report saved to %s\n", output)
+		} else if !quiet {
+			term.Printf("📄 Baseline %s kept; rerun with --accept to accept these findings\n", baseline)
+		}
 	}
 
-	return sb.String()
-}
-
-func generatePipeline(platform string) {
-	fmt.Printf("Generating %s pipeline...\n", platform)
-	
-	// First analyze the project
-	a := analyzer.NewAnalyzer(".")
-	info, _ := a.Analyze()
-	
-	generateSmartPipeline(info)
+	if !regressed {
+		return
+	}
+	if notifyRegressions {
+		cfg, err := config.LoadConfig("cicli.yaml")
+		if err == nil && cfg.Notifications.WebhookURL != "" {
+			if err := notify.NewNotifier().SendMessage(cfg.Notifications.WebhookURL, cfg.ProjectName, "regression", diff.Summary(failOn)); err != nil {
+				fmt.Fprintf(os.Stderr, "Error sending notification: %v\n", err)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "--notify needs notifications.webhook_url in cicli.yaml")
+		}
+	}
+	exit(1)
 }
 
-func generateDockerfile() {
-	a := analyzer.NewAnalyzer(".")
-	info, _ := a.Analyze()
+// handleAuditSecrets lists the secrets each workflow references and flags
+// those exposed to forks, third-party actions or more steps than need them
+func handleAuditSecrets() {
+	path := "."
+	format := "text"
+	failOn := "high"
+	for _, arg := range os.Args[3:] {
+		switch {
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case strings.HasPrefix(arg, "--fail-on="):
+			failOn = strings.TrimPrefix(arg, "--fail-on=")
+		case !strings.HasPrefix(arg, "-"):
+			path = arg
+		}
+	}
+	if failOn != "high" && failOn != "medium" && failOn != "low" && failOn != "none" {
+		term.Printf("Unknown --fail-on value: %s (supported: high, medium, low, none)\n", failOn)
+		exit(1)
+	}
+	format = commandFormat(format)
+	if format != "text" && format != "json" && format != "yaml" {
+		term.Printf("Unknown format: %s (supported: text, json, yaml)\n", format)
+		exit(1)
+	}
 
-	dockerfile := generateDockerfileForStack(info)
-	
-	if err := os.WriteFile("Dockerfile", []byte(dockerfile), 0644); err != nil {
-		fmt.Printf("Error writing Dockerfile: %v\n", err)
-		os.Exit(1)
+	report, err := secrets.Audit(path)
+	if err != nil {
+		term.Printf("Error auditing secrets: %v\n", err)
+		exit(1)
 	}
 
-	fmt.Println("✅ Generated: Dockerfile")
+	if format != "text" {
+		printEncoded(report, format)
+	} else {
+		report.PrintReport()
+	}
+	if failOn != "none" && report.HasFindings(failOn) {
+		exit(1)
+	}
 }
 
-func generateDockerfileForStack(info *analyzer.ProjectInfo) string {
-	switch info.Language {
-	case "node":
-		return `# Build stage
-FROM node:20-alpine AS builder
-WORKDIR /app
-COPY package*.json ./
-RUN npm ci --only=production
+// handleGenerate generates CI/CD configurations
+func handleGenerate() {
+	setWriteMode(os.Args[2:])
 
-# Production stage
-FROM node:20-alpine
-WORKDIR /app
-COPY --from=builder /app/node_modules ./node_modules
-COPY . .
-EXPOSE 3000
-CMD ["node", "index.js"]
-`
+	if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "-") {
+		// Smart generate based on analysis
+		if !quiet {
+			term.Println("🔍 Analyzing project for smart generation...")
+		}
 
-	case "go":
-		return `# Build stage
-FROM golang:1.22-alpine AS builder
-WORKDIR /app
-COPY go.* ./
-RUN go mod download
-COPY . .
-RUN CGO_ENABLED=0 GOOS=linux go build -o /app/main .
+		a := analyzer.NewAnalyzer(".")
+		info, err := a.Analyze()
+		if err != nil {
+			term.Printf("Error analyzing project: %v\n", err)
+			exit(1)
+		}
 
-# Production stage
-FROM alpine:latest
-RUN apk --no-cache add ca-certificates
-WORKDIR /root/
-COPY --from=builder /app/main .
-EXPOSE 8080
-CMD ["./main"]
-`
+		// Generate based on detected stack
+		generateStackPipelines(info, parsePipelineOptions(os.Args[2:]))
+		return
+	}
 
-	case "python":
-		return `FROM python:3.12-slim
-WORKDIR /app
-COPY requirements.txt .
-RUN pip install --no-cache-dir -r requirements.txt
-COPY . .
-EXPOSE 8000
-CMD ["python", "app.py"]
-`
+	subCmd := os.Args[2]
+	switch subCmd {
+	case "pipeline", "workflow":
+		platform := "github"
+		for _, arg := range os.Args[3:] {
+			if strings.HasPrefix(arg, "--platform=") {
+				platform = strings.TrimPrefix(arg, "--platform=")
+			}
+		}
+		generatePipeline(platform, parsePipelineOptions(os.Args[3:]))
+
+	case "dockerfile":
+		generateDockerfile()
+
+	case "k8s", "kubernetes":
+		generateKubernetes()
+
+	case "infra":
+		generateInfra(os.Args[3:])
 
 	default:
-		return `FROM alpine:latest
-WORKDIR /app
-COPY . .
-# Add your build and run commands
-CMD ["echo", "Configure your Dockerfile"]
-`
+		// Try loading cicli.yaml for traditional generate
+		cfg, err := config.LoadConfig("cicli.yaml")
+		if err != nil {
+			term.Printf("Error loading config: %v\n", err)
+			exit(1)
+		}
+
+		gen := generator.NewGenerator()
+		content, err := gen.Render(cfg)
+		if err == nil {
+			err = writeGenerated(gen.OutputPath(), stamp(content, "cicli-yaml/"+cfg.Language, cfg))
+		}
+		if err != nil {
+			term.Printf("Error generating pipeline: %v\n", err)
+			exit(1)
+		}
 	}
 }
 
-func generateKubernetes() {
-	a := analyzer.NewAnalyzer(".")
-	info, _ := a.Analyze()
+// pipelineOptions controls optional parts of generated pipelines
+type pipelineOptions struct {
+	WithDeploy bool
+	DeployEnv  string
+	CreateEnv  bool   // create the deploy environment in GitHub
+	Name       string // workflow name, defaults to "CI"
+	Output     string // output path, defaults to a unique file under .github/workflows
+	Dir        string // subproject directory for multi-stack repos
+	TestShards int    // split the test step across a matrix of shards
+	E2EShards  int    // split the browser suite across a matrix of shards
+	NoE2E      bool   // leave out the E2E job even when a suite is detected
+	WithLint   bool   // add the language's linter, limited to changed files on PRs
+
+	WithCoverage      bool
+	CoverageProvider  string  // codecov, coveralls or artifact
+	CoverageThreshold float64 // fail the build below this line coverage
+
+	BazelRemoteCache string // remote cache URL for Bazel workspaces
+
+	Triggers    []string // write one workflow per trigger: pr, main, nightly
+	Trigger     string   // the trigger of the workflow being generated
+	SharedSetup string   // composite action with the shared setup steps
+}
 
-	// Create k8s directory
-	if err := os.MkdirAll("k8s", 0755); err != nil {
-		fmt.Printf("Error creating directory: %v\n", err)
-		os.Exit(1)
+func parsePipelineOptions(args []string) pipelineOptions {
+	opts := pipelineOptions{DeployEnv: "prod", CoverageProvider: "artifact"}
+	if cfg, err := config.LoadConfig("cicli.yaml"); err == nil {
+		if cfg.Coverage.Provider != "" {
+			opts.CoverageProvider = cfg.Coverage.Provider
+		}
+		opts.CoverageThreshold = cfg.Coverage.Threshold
+		opts.BazelRemoteCache = cfg.Bazel.RemoteCache
 	}
 
-	deployment := fmt.Sprintf(`apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: %s
-  labels:
-    app: %s
-spec:
-  replicas: 2
-  selector:
-    matchLabels:
-      app: %s
-  template:
-    metadata:
-      labels:
-        app: %s
-    spec:
-      containers:
-        - name: %s
-          image: %s:latest
-          ports:
-            - containerPort: 3000
-          resources:
-            requests:
-              memory: "128Mi"
-              cpu: "100m"
-            limits:
-              memory: "256Mi"
-              cpu: "500m"
----
-apiVersion: v1
-kind: Service
-metadata:
-  name: %s
-spec:
-  selector:
-    app: %s
-  ports:
-    - protocol: TCP
-      port: 80
-      targetPort: 3000
-  type: LoadBalancer
-`, info.Name, info.Name, info.Name, info.Name, info.Name, info.Name, info.Name, info.Name)
+	for _, arg := range args {
+		if arg == "--with-coverage" {
+			opts.WithCoverage = true
+		} else if strings.HasPrefix(arg, "--with-coverage=") {
+			opts.WithCoverage = true
+			opts.CoverageProvider = strings.TrimPrefix(arg, "--with-coverage=")
+		} else if arg == "--with-lint" {
+			opts.WithLint = true
+		} else if strings.HasPrefix(arg, "--bazel-remote-cache=") {
+			opts.BazelRemoteCache = strings.TrimPrefix(arg, "--bazel-remote-cache=")
+		} else if arg == "--with-deploy" {
+			opts.WithDeploy = true
+		} else if strings.HasPrefix(arg, "--deploy-env=") {
+			opts.DeployEnv = strings.TrimPrefix(arg, "--deploy-env=")
+		} else if arg == "--create-environment" {
+			opts.CreateEnv = true
+		} else if strings.HasPrefix(arg, "--name=") {
+			opts.Name = strings.TrimPrefix(arg, "--name=")
+		} else if strings.HasPrefix(arg, "--output=") {
+			opts.Output = strings.TrimPrefix(arg, "--output=")
+		} else if arg == "--split-triggers" {
+			opts.Triggers = []string{"pr", "main", "nightly"}
+		} else if strings.HasPrefix(arg, "--triggers=") {
+			opts.Triggers = nil
+			for _, t := range strings.Split(strings.TrimPrefix(arg, "--triggers="), ",") {
+				if t != "pr" && t != "main" && t != "nightly" {
+					term.Printf("Unknown trigger: %s (supported: pr, main, nightly)\n", t)
+					exit(1)
+				}
+				opts.Triggers = append(opts.Triggers, t)
+			}
+		} else if strings.HasPrefix(arg, "--test-shards=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--test-shards="))
+			if err != nil || n < 1 {
+				term.Println("--test-shards must be a positive number")
+				exit(1)
+			}
+			opts.TestShards = n
+		} else if strings.HasPrefix(arg, "--e2e-shards=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--e2e-shards="))
+			if err != nil || n < 1 {
+				term.Println("--e2e-shards must be a positive number")
+				exit(1)
+			}
+			opts.E2EShards = n
+		} else if arg == "--no-e2e" {
+			opts.NoE2E = true
+		}
+	}
+	return opts
+}
+
+// generateStackPipelines writes one workflow per stack. Multi-stack repos
+// (e.g. frontend/ and backend/ with their own manifests) get ci-<dir>.yml
+// files scoped to their directory; an explicit --output keeps a single file.
+func generateStackPipelines(info *analyzer.ProjectInfo, opts pipelineOptions) {
+	subprojects := analyzer.NewAnalyzer(".").Subprojects()
+	if opts.Output != "" || len(subprojects) == 0 {
+		generateSmartPipeline(info, opts)
+		return
+	}
 
-	if err := os.WriteFile("k8s/deployment.yaml", []byte(deployment), 0644); err != nil {
-		fmt.Printf("Error writing deployment: %v\n", err)
-		os.Exit(1)
+	if info.Language != "unknown" {
+		rootOpts := opts
+		rootOpts.Output = filepath.Join(".github", "workflows", "ci-"+info.Language+".yml")
+		generateSmartPipeline(info, rootOpts)
+		opts.WithDeploy = false
 	}
 
-	fmt.Println("✅ Generated: k8s/deployment.yaml")
+	for _, dir := range subprojects {
+		subInfo, err := analyzer.NewAnalyzer(dir).Analyze()
+		if err != nil {
+			term.Printf("Error analyzing %s: %v\n", dir, err)
+			exit(1)
+		}
+
+		subOpts := opts
+		subOpts.Dir = dir
+		subOpts.Output = filepath.Join(".github", "workflows", "ci-"+dir+".yml")
+		if subOpts.Name == "" {
+			subOpts.Name = "CI (" + dir + ")"
+		} else {
+			subOpts.Name = opts.Name + " (" + dir + ")"
+		}
+		generateSmartPipeline(subInfo, subOpts)
+
+		// Only one workflow should publish and deploy
+		opts.WithDeploy = false
+	}
 }
 
-// handleConvert converts between CI/CD platforms
-func handleConvert() {
-	var from, to, input, output string
+// workflowOutputPath picks where a generated workflow goes: the explicit
+// --output, ci.yml, or ci-<language>.yml when ci.yml already exists
+func workflowOutputPath(info *analyzer.ProjectInfo, opts pipelineOptions) string {
+	if opts.Output != "" {
+		return opts.Output
+	}
 
-	for i := 2; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		if strings.HasPrefix(arg, "--from=") {
-			from = strings.TrimPrefix(arg, "--from=")
-		} else if strings.HasPrefix(arg, "--to=") {
-			to = strings.TrimPrefix(arg, "--to=")
-		} else if strings.HasPrefix(arg, "--input=") {
-			input = strings.TrimPrefix(arg, "--input=")
-		} else if strings.HasPrefix(arg, "--output=") {
-			output = strings.TrimPrefix(arg, "--output=")
+	path := filepath.Join(".github", "workflows", "ci.yml")
+	if _, err := os.Stat(path); err == nil && info.Language != "unknown" {
+		return filepath.Join(".github", "workflows", "ci-"+info.Language+".yml")
+	}
+	return path
+}
+
+// generateSmartPipeline creates a pipeline based on project analysis
+func generateSmartPipeline(info *analyzer.ProjectInfo, opts pipelineOptions) {
+	if !quiet && opts.Trigger == "" {
+		term.Printf("\n📦 Detected: %s", info.Language)
+		if info.Framework != "" {
+			term.Printf(" (%s)", info.Framework)
+		}
+		if info.Bazel != nil {
+			term.Print(", built with Bazel")
+		}
+		term.Println()
+	}
+	if opts.WithLint && opts.Trigger == "" {
+		warnLintSupport(info)
+	}
+	if len(opts.Triggers) > 0 && opts.Trigger == "" {
+		generateTriggerPipelines(info, opts)
+		return
+	}
+
+	// Generate workflow based on detected stack
+	workflow := generateWorkflowForStack(info, opts)
+	if opts.WithDeploy {
+		needs := []string{"build"}
+		if strings.Contains(workflow, "\n  test:\n") {
+			needs = append(needs, "test")
 		}
+		workflow += generateDeployJob(opts.DeployEnv, needs)
 	}
 
-	if from == "" || to == "" {
-		fmt.Println("Usage: cicli convert --from=<platform> --to=<platform> [--input=<file>] [--output=<file>]")
-		fmt.Println("\nSupported platforms: github, gitlab, circleci, azure, jenkins, bitbucket")
-		fmt.Println("\nExamples:")
-		fmt.Println("  cicli convert --from=gitlab --to=github")
-		fmt.Println("  cicli convert --from=jenkins --to=github --input=Jenkinsfile")
-		os.Exit(1)
+	template := stackTemplate("github-actions", info)
+	if opts.Trigger != "" {
+		template += "/" + opts.Trigger
+	}
+	outputPath := workflowOutputPath(info, opts)
+	if err := writeGenerated(outputPath, stamp(workflow, template, info)); err != nil {
+		term.Printf("Error writing workflow: %v\n", err)
+		exit(1)
 	}
 
-	// Auto-detect input file if not specified
-	if input == "" {
-		input = detectCIFile(converter.Platform(from))
-		if input == "" {
-			fmt.Printf("Could not find %s CI configuration file\n", from)
-			os.Exit(1)
+	if opts.WithDeploy && opts.CreateEnv && writeMode == modeWrite {
+		createGitHubEnvironment(opts.DeployEnv)
+	}
+
+	if !quiet && writeMode == modeWrite && opts.Trigger == "" {
+		term.Println("\n💡 Tip: Run 'cicli lint' to validate your new workflow")
+	}
+}
+
+// createGitHubEnvironment creates the deploy environment with the protection
+// rules from cicli.yaml, so the deploy job's review gates exist before it runs
+func createGitHubEnvironment(env string) {
+	repo := githubRepoFromRemote()
+	if repo == "" {
+		term.Println("⚠️  Cannot create the environment: origin is not a GitHub repository")
+		return
+	}
+
+	protection := github.Protection{}
+	if cfg, err := config.LoadConfig("cicli.yaml"); err == nil {
+		if e, ok := cfg.Environments[env]; ok && e.Protection != nil {
+			protection = *e.Protection
 		}
 	}
 
-	// Generate output path if not specified
-	if output == "" {
-		output = getDefaultOutputPath(converter.Platform(to))
+	if err := github.NewClient(repo).EnsureEnvironment(env, protection); err != nil {
+		term.Printf("⚠️  %v\n", err)
+		return
 	}
+	term.Printf("✅ GitHub environment %s is ready", env)
+	if len(protection.Reviewers) > 0 {
+		term.Printf(" (reviewers: %s)", strings.Join(protection.Reviewers, ", "))
+	}
+	term.Println()
+}
 
-	fmt.Printf("🔄 Converting %s → %s\n", from, to)
-	fmt.Printf("   Input:  %s\n", input)
-	fmt.Printf("   Output: %s\n", output)
+// workflowStep is one step of a generated GitHub Actions workflow or
+// composite action
+type workflowStep struct {
+	Name string
+	If   string
+	Uses string
+	With [][2]string // multi-line values are written as block scalars
+	Env  [][2]string
+	Run  string
+}
 
-	c := converter.NewConverter()
-	if err := c.Convert(converter.Platform(from), converter.Platform(to), input, output); err != nil {
-		fmt.Printf("Error converting: %v\n", err)
-		os.Exit(1)
+// render formats the step as a list item at indent. Composite action steps
+// need an explicit shell and do not inherit defaults.run.working-directory.
+func (s workflowStep) render(indent string, composite bool, dir string) string {
+	var sb strings.Builder
+	condition := ""
+	if s.If != "" {
+		condition = fmt.Sprintf("%s  if: %s\n", indent, s.If)
+	}
+	if s.Uses != "" {
+		if s.Name != "" {
+			sb.WriteString(fmt.Sprintf("%s- name: %s\n%s%s  uses: %s\n", indent, s.Name, condition, indent, s.Uses))
+		} else {
+			sb.WriteString(fmt.Sprintf("%s- uses: %s\n%s", indent, s.Uses, condition))
+		}
+		if len(s.With) > 0 {
+			sb.WriteString(indent + "  with:\n")
+			for _, kv := range s.With {
+				if !strings.Contains(kv[1], "\n") {
+					sb.WriteString(fmt.Sprintf("%s    %s: %s\n", indent, kv[0], kv[1]))
+					continue
+				}
+				sb.WriteString(fmt.Sprintf("%s    %s: |\n", indent, kv[0]))
+				for _, line := range strings.Split(kv[1], "\n") {
+					sb.WriteString(fmt.Sprintf("%s      %s\n", indent, line))
+				}
+			}
+		}
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("%s- name: %s\n%s", indent, s.Name, condition))
+	if strings.Contains(s.Run, "\n") {
+		sb.WriteString(indent + "  run: |\n")
+		for _, line := range strings.Split(s.Run, "\n") {
+			sb.WriteString(fmt.Sprintf("%s    %s\n", indent, line))
+		}
+	} else {
+		sb.WriteString(fmt.Sprintf("%s  run: %s\n", indent, s.Run))
+	}
+	if len(s.Env) > 0 {
+		sb.WriteString(indent + "  env:\n")
+		for _, kv := range s.Env {
+			sb.WriteString(fmt.Sprintf("%s    %s: %s\n", indent, kv[0], kv[1]))
+		}
 	}
+	if composite {
+		sb.WriteString(indent + "  shell: bash\n")
+		if dir != "" {
+			sb.WriteString(fmt.Sprintf("%s  working-directory: %s\n", indent, dir))
+		}
+	}
+	return sb.String()
+}
 
-	fmt.Println("\n💡 Tip: Run 'cicli lint' to validate the converted workflow")
+// renderSteps joins steps with blank lines, the layout of generated workflows
+func renderSteps(steps []workflowStep, indent string, composite bool, dir string) string {
+	rendered := make([]string, len(steps))
+	for i, s := range steps {
+		rendered[i] = s.render(indent, composite, dir)
+	}
+	return strings.Join(rendered, "\n")
 }
 
-func detectCIFile(platform converter.Platform) string {
-	paths := map[converter.Platform][]string{
-		converter.GitHub:   {".github/workflows/ci.yml", ".github/workflows/main.yml"},
-		converter.GitLab:   {".gitlab-ci.yml"},
-		converter.CircleCI: {".circleci/config.yml"},
-		converter.Jenkins:  {"Jenkinsfile"},
-		converter.Azure:    {"azure-pipelines.yml"},
+// stackSteps returns the setup steps (toolchain and dependencies) and the
+// check steps (lint, build, test) for the detected stack
+func stackSteps(info *analyzer.ProjectInfo, opts pipelineOptions) (setup, checks []workflowStep) {
+	if info.Bazel != nil {
+		return bazelSteps(info, opts)
+	}
+	switch info.Language {
+	case "node":
+		pm := info.PackageManager
+		if pm == "" {
+			pm = "npm"
+		}
+		with := [][2]string{{"node-version", "'20'"}, {"cache", pm}}
+		if opts.Dir != "" {
+			lockfiles := map[string]string{"npm": "package-lock.json", "yarn": "yarn.lock", "pnpm": "pnpm-lock.yaml"}
+			if lock, ok := lockfiles[pm]; ok {
+				with = append(with, [2]string{"cache-dependency-path", opts.Dir + "/" + lock})
+			}
+		}
+		setup = []workflowStep{
+			{Uses: "actions/setup-node@v4", With: with},
+			{Name: "Install dependencies", Run: pm + " install"},
+		}
+		if info.Monorepo != nil {
+			checks = monorepoSteps(info, opts, pm)
+			break
+		}
+		if info.BuildCommand != "" {
+			checks = append(checks, workflowStep{Name: "Build", Run: info.BuildCommand})
+		}
+		if info.TestCommand != "" {
+			checks = append(checks, workflowStep{Name: "Test", Run: info.TestCommand})
+		}
+
+	case "go":
+		setup = []workflowStep{{Uses: "actions/setup-go@v5", With: [][2]string{{"go-version", "'1.22'"}}}}
+		checks = []workflowStep{
+			{Name: "Build", Run: "go build -v ./..."},
+			{Name: "Test", Run: "go test -v ./..."},
+		}
+
+	case "python":
+		setup = []workflowStep{
+			{Uses: "actions/setup-python@v5", With: [][2]string{{"python-version", "'3.12'"}, {"cache", "pip"}}},
+			{Name: "Install dependencies", Run: "python -m pip install --upgrade pip\npip install -r requirements.txt"},
+		}
+		checks = []workflowStep{{Name: "Test", Run: "pytest"}}
+		if !info.HasQualityTool("ruff") && !opts.WithLint {
+			// Without a configured linter, catch syntax errors and undefined names
+			checks = append([]workflowStep{{Name: "Lint", Run: "pip install flake8\nflake8 . --count --select=E9,F63,F7,F82 --show-source --statistics"}}, checks...)
+		}
+
+	case "java":
+		if info.PackageManager == "maven" {
+			setup = []workflowStep{{Uses: "actions/setup-java@v4", With: [][2]string{{"java-version", "'17'"}, {"distribution", "temurin"}, {"cache", "maven"}}}}
+			checks = []workflowStep{
+				{Name: "Build", Run: "mvn -B package --file pom.xml"},
+				{Name: "Test", Run: "mvn test"},
+			}
+		} else {
+			setup = []workflowStep{{Uses: "actions/setup-java@v4", With: [][2]string{{"java-version", "'17'"}, {"distribution", "temurin"}, {"cache", "gradle"}}}}
+			checks = []workflowStep{
+				{Name: "Build", Run: "./gradlew build"},
+				{Name: "Test", Run: "./gradlew test"},
+			}
+		}
+
+	default:
+		checks = []workflowStep{
+			{Name: "Build", Run: `echo "Add your build command here"`},
+			{Name: "Test", Run: `echo "Add your test command here"`},
+		}
+	}
+	if info.Monorepo == nil || !info.Monorepo.HasTask("lint") {
+		checks = append(qualitySteps(info, opts), checks...)
+	}
+	return setup, append(codegenSteps(info), checks...)
+}
+
+// monorepoSteps runs the workspace's tasks only for the projects a change
+// affects, and their dependents. Nightly runs cover every project. The local
+// task cache persists between runs; the remote cache is used when its
+// secrets are set and skipped otherwise.
+func monorepoSteps(info *analyzer.ProjectInfo, opts pipelineOptions, pm string) []workflowStep {
+	exec := map[string]string{"npm": "npx", "yarn": "yarn", "pnpm": "pnpm exec"}[pm]
+	if exec == "" {
+		exec = "npx"
+	}
+	cacheDir := ".nx/cache"
+	if info.Monorepo.Tool == "turborepo" {
+		cacheDir = ".turbo"
+	}
+	if opts.Dir != "" {
+		// Actions do not honour defaults.run.working-directory
+		cacheDir = opts.Dir + "/" + cacheDir
+	}
+	tasks := strings.Join(info.Monorepo.Tasks, " ")
+	steps := []workflowStep{{Name: "Cache " + info.Monorepo.Tool + " results", Uses: "actions/cache@v4", With: [][2]string{
+		{"path", cacheDir},
+		{"key", info.Monorepo.Tool + "-${{ runner.os }}-${{ github.sha }}"},
+		{"restore-keys", info.Monorepo.Tool + "-${{ runner.os }}-"},
+	}}}
+
+	if info.Monorepo.Tool == "nx" {
+		env := [][2]string{{"NX_CLOUD_ACCESS_TOKEN", "${{ secrets.NX_CLOUD_ACCESS_TOKEN }}"}}
+		if opts.Trigger == "nightly" {
+			return append(steps, workflowStep{Name: "Run all projects", Run: fmt.Sprintf("%s nx run-many -t %s", exec, tasks), Env: env})
+		}
+		// nx-set-shas compares pushes with the last successful run on the branch
+		return append(steps,
+			workflowStep{Uses: "nrwl/nx-set-shas@v4"},
+			workflowStep{Name: "Run affected projects", Run: fmt.Sprintf("%s nx affected -t %s", exec, tasks), Env: env})
+	}
+
+	env := [][2]string{{"TURBO_TOKEN", "${{ secrets.TURBO_TOKEN }}"}, {"TURBO_TEAM", "${{ vars.TURBO_TEAM }}"}}
+	run := fmt.Sprintf("%s turbo run %s --cache-dir=.turbo", exec, tasks)
+	if opts.Trigger == "nightly" {
+		return append(steps, workflowStep{Name: "Run all packages", Run: run, Env: env})
+	}
+	return append(steps, workflowStep{Name: "Run affected packages", Run: fmt.Sprintf(`if [ "$GITHUB_EVENT_NAME" = pull_request ]; then
+  base="origin/$GITHUB_BASE_REF"
+else
+  base="HEAD^1"
+fi
+%s --filter="...[$base]"`, run), Env: env})
+}
+
+// checkoutStep checks out the repository, with the full history when the
+// pipeline compares against the base branch to find affected projects
+func checkoutStep(info *analyzer.ProjectInfo, opts pipelineOptions) string {
+	if info.Monorepo != nil && info.Language == "node" && opts.Trigger != "nightly" {
+		return "    steps:\n      - uses: actions/checkout@v4\n        with:\n          fetch-depth: 0\n\n"
+	}
+	return "    steps:\n      - uses: actions/checkout@v4\n\n"
+}
+
+// bazelSteps builds and tests a Bazel workspace with bazelisk, which runs
+// the version in .bazelversion. The disk and repository caches persist
+// between runs; a remote cache, when configured, is shared more widely.
+func bazelSteps(info *analyzer.ProjectInfo, opts pipelineOptions) (setup, checks []workflowStep) {
+	setup = []workflowStep{{Uses: "bazel-contrib/setup-bazel@0.9.1", With: [][2]string{
+		{"bazelisk-cache", "true"},
+		{"disk-cache", "${{ github.workflow }}"},
+		{"repository-cache", "true"},
+	}}}
+	if opts.BazelRemoteCache != "" {
+		// Pull requests read from the cache but only trusted builds write to it
+		setup = append(setup, workflowStep{Name: "Configure Bazel remote cache", Run: `echo "build --remote_cache=$BAZEL_REMOTE_CACHE" >> ~/.bazelrc
+if [ -n "$BAZEL_REMOTE_HEADER" ]; then echo "build --remote_header=$BAZEL_REMOTE_HEADER" >> ~/.bazelrc; fi
+if [ "$GITHUB_EVENT_NAME" = pull_request ]; then echo "build --remote_upload_local_results=false" >> ~/.bazelrc; fi`, Env: [][2]string{
+			{"BAZEL_REMOTE_CACHE", opts.BazelRemoteCache},
+			{"BAZEL_REMOTE_HEADER", "${{ secrets.BAZEL_REMOTE_HEADER }}"},
+		}})
+	}
+
+	checks = []workflowStep{
+		{Name: "Build", Run: "bazel build //..." + bazelConfigFlag(info)},
+		{Name: "Test", Run: "bazel test //... --test_output=errors" + bazelConfigFlag(info)},
+	}
+	return setup, checks
+}
+
+// bazelConfigFlag selects the workspace's own ci config from .bazelrc
+func bazelConfigFlag(info *analyzer.ProjectInfo) string {
+	if info.Bazel.CIConfig {
+		return " --config=ci"
+	}
+	return ""
+}
+
+// codegenSetup installs the generators that are not run through a package
+// manager the stack already has
+var codegenSetup = map[string]workflowStep{
+	"buf":  {Uses: "bufbuild/buf-action@v1", With: [][2]string{{"setup_only", "true"}}},
+	"sqlc": {Uses: "sqlc-dev/setup-sqlc@v4", With: [][2]string{{"sqlc-version", "'1.27.0'"}}},
+}
+
+// codegenSteps reruns the project's code generators and fails when the
+// committed output differs. Changes made by earlier steps, such as a lockfile
+// touched by install, are staged first so only generated changes count.
+func codegenSteps(info *analyzer.ProjectInfo) []workflowStep {
+	if len(info.CodeGenerators) == 0 {
+		return nil
+	}
+	var steps []workflowStep
+	var commands []string
+	for _, g := range info.CodeGenerators {
+		if setup, ok := codegenSetup[g.Name]; ok {
+			setup.Name = "Set up " + g.Name
+			steps = append(steps, setup)
+		}
+		commands = append(commands, g.Command)
+	}
+	steps = append(steps,
+		workflowStep{Name: "Generate code", Run: "git add --all\n" + strings.Join(commands, "\n")},
+		workflowStep{Name: "Check generated code is up to date", Run: fmt.Sprintf(`git add --intent-to-add .
+git diff --exit-code || { echo "::error::Generated code is out of date. Run '%s' and commit the result."; exit 1; }`, strings.Join(commands, " && "))},
+	)
+	return steps
+}
+
+// changedFilesLint runs a linter on the files a pull request changes, and on
+// everything for other events. Paths are relative to the working directory.
+func changedFilesLint(name, command string, patterns []string) workflowStep {
+	quoted := make([]string, len(patterns))
+	for i, p := range patterns {
+		quoted[i] = "'" + p + "'"
+	}
+	run := fmt.Sprintf(`if [ "$GITHUB_EVENT_NAME" = pull_request ]; then
+  git fetch --no-tags --depth=1 origin "$BASE_SHA"
+  git diff -z --name-only --diff-filter=ACMR --relative "$BASE_SHA" HEAD -- %s | xargs -0 -r %s
+else
+  %s .
+fi`, strings.Join(quoted, " "), command, command)
+	return workflowStep{Name: name, Run: run, Env: [][2]string{{"BASE_SHA", "${{ github.event.pull_request.base.sha }}"}}}
+}
+
+// qualitySteps runs the lint and format tools the project is configured
+// for, caching their results between runs. With --with-lint the language's
+// linter is added even without a config, and only checks changed files on PRs.
+func qualitySteps(info *analyzer.ProjectInfo, opts pipelineOptions) []workflowStep {
+	// Actions do not honour defaults.run.working-directory
+	path := func(p string) string {
+		if opts.Dir != "" && !strings.HasPrefix(p, "~") {
+			return opts.Dir + "/" + p
+		}
+		return p
+	}
+	cache := func(tool, dir string) workflowStep {
+		return workflowStep{Name: "Cache " + tool + " results", Uses: "actions/cache@v4", With: [][2]string{
+			{"path", path(dir)},
+			{"key", tool + "-${{ runner.os }}-${{ github.sha }}"},
+			{"restore-keys", tool + "-${{ runner.os }}-"},
+		}}
+	}
+
+	var steps []workflowStep
+	switch info.Language {
+	case "node":
+		eslint, prettier := info.HasQualityTool("eslint") || opts.WithLint, info.HasQualityTool("prettier")
+		if eslint || prettier {
+			steps = append(steps, cache("lint", "node_modules/.cache"))
+		}
+		if opts.WithLint {
+			steps = append(steps, changedFilesLint("Lint", "npx eslint --cache --cache-location node_modules/.cache/eslint/", []string{"*.js", "*.jsx", "*.mjs", "*.cjs", "*.ts", "*.tsx"}))
+		} else if eslint {
+			steps = append(steps, workflowStep{Name: "Lint", Run: "npx eslint . --cache --cache-location node_modules/.cache/eslint/"})
+		}
+		if prettier {
+			steps = append(steps, workflowStep{Name: "Check formatting", Run: "npx prettier --check . --cache"})
+		}
+
+	case "python":
+		if opts.WithLint {
+			steps = append(steps, cache("ruff", ".ruff_cache"),
+				workflowStep{Name: "Install ruff", Run: "pip install ruff"},
+				changedFilesLint("Lint", "ruff check --output-format=github", []string{"*.py"}))
+		} else if info.HasQualityTool("ruff") {
+			steps = append(steps, cache("ruff", ".ruff_cache"),
+				workflowStep{Name: "Lint", Run: "pip install ruff\nruff check --output-format=github ."})
+		}
+		if info.HasQualityTool("black") {
+			steps = append(steps, cache("black", "~/.cache/black"),
+				workflowStep{Name: "Check formatting", Run: "pip install black\nblack --check --diff ."})
+		}
+
+	case "go":
+		if info.HasQualityTool("golangci-lint") || opts.WithLint {
+			// The action caches its binary and analysis results itself
+			with := [][2]string{{"version", "latest"}}
+			if opts.WithLint {
+				with = append(with, [2]string{"only-new-issues", "${{ github.event_name == 'pull_request' }}"})
+			}
+			if opts.Dir != "" {
+				with = append(with, [2]string{"working-directory", opts.Dir})
+			}
+			steps = append(steps, workflowStep{Name: "Lint", Uses: "golangci/golangci-lint-action@v6", With: with})
+		}
+
+	case "java":
+		// Plugins are cached with the rest of the build by setup-java
+		if info.HasQualityTool("checkstyle") {
+			run := "./gradlew checkstyleMain checkstyleTest"
+			if info.PackageManager == "maven" {
+				run = "mvn -B checkstyle:check"
+			}
+			steps = append(steps, workflowStep{Name: "Checkstyle", Run: run})
+		}
+	}
+	return steps
+}
+
+// warnLintSupport points out where --with-lint cannot add a working linter
+func warnLintSupport(info *analyzer.ProjectInfo) {
+	if info.Bazel != nil {
+		term.Println("⚠️  --with-lint is not supported for Bazel workspaces yet; run linters as Bazel aspects (rules_lint)")
+		return
+	}
+	switch info.Language {
+	case "node":
+		if !info.HasQualityTool("eslint") {
+			term.Println("⚠️  No ESLint config found; the Lint step needs one (npm init @eslint/config)")
+		}
+	case "python", "go":
+	case "java":
+		if !info.HasQualityTool("checkstyle") {
+			term.Println("⚠️  --with-lint needs a Checkstyle config for Java projects; no Lint step added")
+		}
+	default:
+		term.Printf("⚠️  --with-lint is not supported for %s projects yet\n", info.Language)
+	}
+}
+
+// dependencyAuditCommand returns the vulnerability scan for the stack's dependencies
+func dependencyAuditCommand(info *analyzer.ProjectInfo) string {
+	if info.Bazel != nil {
+		// Dependencies are pinned by Bazel, not the language's package manager
+		return ""
+	}
+	switch info.Language {
+	case "node":
+		switch info.PackageManager {
+		case "yarn":
+			return "yarn npm audit --severity high"
+		case "pnpm":
+			return "pnpm audit --audit-level high"
+		}
+		return "npm audit --audit-level=high"
+	case "python":
+		return "pip install pip-audit\npip-audit -r requirements.txt"
+	case "go":
+		return "go install golang.org/x/vuln/cmd/govulncheck@latest\ngovulncheck ./..."
+	case "java":
+		if info.PackageManager == "maven" {
+			return "mvn -B org.owasp:dependency-check-maven:check -DfailBuildOnCVSS=7"
+		}
+	}
+	return ""
+}
+
+func generateWorkflowForStack(info *analyzer.ProjectInfo, opts pipelineOptions) string {
+	var sb strings.Builder
+
+	name := opts.Name
+	if name == "" {
+		name = "CI"
+	}
+	sb.WriteString(fmt.Sprintf("name: %s\n\non:\n", name))
+	switch opts.Trigger {
+	case "nightly":
+		sb.WriteString("  schedule:\n    - cron: '0 3 * * *'\n  workflow_dispatch:\n")
+	default:
+		events := []string{"push", "pull_request"}
+		if opts.Trigger == "pr" {
+			events = []string{"pull_request"}
+		} else if opts.Trigger == "main" {
+			events = []string{"push"}
+		}
+		for _, event := range events {
+			sb.WriteString(fmt.Sprintf("  %s:\n    branches: [main]\n", event))
+			if opts.Dir != "" {
+				sb.WriteString(fmt.Sprintf("    paths: ['%s/**']\n", opts.Dir))
+			}
+		}
+	}
+	if opts.Trigger == "pr" {
+		// Superseded pushes to a PR do not need to finish
+		sb.WriteString("\nconcurrency:\n  group: ${{ github.workflow }}-${{ github.ref }}\n  cancel-in-progress: true\n")
+	}
+	sb.WriteString("\njobs:\n  build:\n    runs-on: ubuntu-latest\n")
+	shardCmd := ""
+	if opts.TestShards > 1 && info.Monorepo != nil && info.Language == "node" {
+		term.Printf("⚠️  Test sharding is not supported for %s workspaces; affected tasks run in a single job\n", info.Monorepo.Tool)
+	} else if opts.TestShards > 1 && (info.TestFramework == "playwright" || info.TestFramework == "cypress") {
+		// The e2e job runs browser suites; --e2e-shards splits those
+		term.Printf("⚠️  %s is an end-to-end runner; use --e2e-shards to split it. Generating a single test step\n", info.TestFramework)
+	} else if opts.TestShards > 1 {
+		shardCmd = optimizer.ShardCommand(info.TestFramework, opts.TestShards)
+		if shardCmd == "" {
+			term.Printf("⚠️  Test sharding is not supported for %s tests; generating a single test job\n", info.Language)
+		}
+	}
+	defaults := ""
+	if opts.Dir != "" {
+		defaults = fmt.Sprintf("    defaults:\n      run:\n        working-directory: %s\n", opts.Dir)
+	}
+	sb.WriteString(defaults)
+
+	setup, checks := stackSteps(info, opts)
+	if opts.SharedSetup != "" && len(setup) > 0 {
+		setup = []workflowStep{{Name: "Set up " + info.Language, Uses: "./" + filepath.ToSlash(filepath.Dir(opts.SharedSetup))}}
+	}
+	if shardCmd != "" {
+		// Only the tests are sharded; lint and build run once in the build job
+		var unsharded []workflowStep
+		for _, step := range checks {
+			if step.Name != "Test" {
+				unsharded = append(unsharded, step)
+			}
+		}
+		checks = unsharded
+	}
+	sb.WriteString(checkoutStep(info, opts))
+	sb.WriteString(renderSteps(append(setup, checks...), "      ", false, ""))
+
+	workflow := sb.String()
+	testStep := regexp.MustCompile(`(?m)^      - name: Test\n        run: .*\n`)
+	if shardCmd != "" {
+		workflow += testShardJob(info, opts, setup, defaults, shardCmd)
+		if opts.WithCoverage {
+			term.Println("⚠️  Coverage is not merged across test shards; skipping --with-coverage")
+		}
+	} else if opts.WithCoverage || (info.CoverageTool() != "" && opts.Trigger != "pr") {
+		// A configured coverage tool turns coverage on, except on fast PR checks
+		if steps := coverageSteps(info, opts); steps != "" {
+			workflow = testStep.ReplaceAllLiteralString(workflow, steps)
+		} else if opts.WithCoverage {
+			term.Printf("⚠️  Coverage collection is not supported for %s projects yet\n", info.Language)
+		}
+	}
+
+	if info.E2E != nil && !opts.NoE2E && info.Bazel == nil {
+		workflow += e2eJob(info, opts, setup, defaults)
+	}
+
+	if opts.Trigger == "nightly" {
+		if audit := dependencyAuditCommand(info); audit != "" {
+			workflow += "\n  dependency-audit:\n    runs-on: ubuntu-latest\n" + defaults
+			workflow += "    steps:\n      - uses: actions/checkout@v4\n\n"
+			workflow += renderSteps(append(setup, workflowStep{Name: "Audit dependencies", Run: audit}), "      ", false, "")
+		}
+	}
+	return workflow
+}
+
+// generateTriggerPipelines writes one workflow per trigger (fast PR checks,
+// main branch build, nightly full suite with a dependency audit) that share
+// their setup through a local composite action
+func generateTriggerPipelines(info *analyzer.ProjectInfo, opts pipelineOptions) {
+	setup, _ := stackSteps(info, opts)
+	if len(setup) > 0 {
+		actionDir := filepath.Join(".github", "actions", "setup")
+		if opts.Dir != "" {
+			actionDir += "-" + opts.Dir
+		}
+		opts.SharedSetup = filepath.Join(actionDir, "action.yml")
+
+		var action strings.Builder
+		action.WriteString(fmt.Sprintf("name: Set up %s\ndescription: Toolchain and dependencies shared by the CI workflows\n\nruns:\n  using: composite\n  steps:\n", info.Language))
+		action.WriteString(renderSteps(setup, "    ", true, opts.Dir))
+		if err := writeGenerated(opts.SharedSetup, stamp(action.String(), stackTemplate("setup-action", info), info)); err != nil {
+			term.Printf("Error writing %s: %v\n", opts.SharedSetup, err)
+			exit(1)
+		}
+	}
+
+	base := strings.TrimSuffix(workflowOutputPath(info, opts), ".yml")
+	name := opts.Name
+	if name == "" {
+		name = "CI"
+	}
+	titles := map[string]string{"pr": "PR", "main": "Main", "nightly": "Nightly"}
+	for _, trigger := range opts.Triggers {
+		triggerOpts := opts
+		triggerOpts.Trigger = trigger
+		triggerOpts.Name = name + " / " + titles[trigger]
+		triggerOpts.Output = base + "-" + trigger + ".yml"
+		switch trigger {
+		case "pr":
+			// Keep PR feedback fast: no coverage upload, no deploy
+			triggerOpts.WithCoverage = false
+			triggerOpts.WithDeploy = false
+		case "nightly":
+			// The full suite runs unsharded with coverage
+			triggerOpts.TestShards = 0
+			triggerOpts.WithCoverage = true
+			triggerOpts.WithDeploy = false
+		}
+		generateSmartPipeline(info, triggerOpts)
+	}
+
+	if !quiet && writeMode == modeWrite {
+		term.Println("\n💡 Tip: Run 'cicli lint' to validate your new workflows")
+	}
+}
+
+// coverageSteps returns a test step that collects coverage, followed by an
+// optional threshold gate and the upload step, or "" for unsupported stacks
+func coverageSteps(info *analyzer.ProjectInfo, opts pipelineOptions) string {
+	var testCmd, report, gate string
+	threshold := opts.CoverageThreshold
+
+	language := info.Language
+	if info.Bazel != nil {
+		language = "bazel"
+	}
+	switch language {
+	case "bazel":
+		// Bazel merges every test's coverage into one LCOV report
+		testCmd = "bazel coverage //... --combined_report=lcov --test_output=errors" + bazelConfigFlag(info)
+		report = "bazel-out/_coverage/_coverage_report.dat"
+		gate = fmt.Sprintf(`TOTAL=$(awk -F: '/^LF:/ {f += $2} /^LH:/ {h += $2} END {printf "%%.1f", f ? 100 * h / f : 100}' bazel-out/_coverage/_coverage_report.dat)
+          echo "Coverage: ${TOTAL}%%"
+          awk -v total="$TOTAL" 'BEGIN { exit (total + 0 < %g) }' || { echo "Coverage ${TOTAL}%% is below %g%%"; exit 1; }`, threshold, threshold)
+
+	case "node":
+		switch {
+		case info.TestFramework == "jest":
+			testCmd = "npx jest --coverage --coverageReporters=lcov --coverageReporters=json-summary"
+		case info.TestFramework == "vitest":
+			testCmd = "npx vitest run --coverage --coverage.reporter=lcov --coverage.reporter=json-summary"
+		default:
+			cmd := info.TestCommand
+			if cmd == "" {
+				cmd = "npm test"
+			}
+			tool := "c8"
+			if info.CoverageTool() == "nyc" {
+				tool = "nyc"
+			}
+			testCmd = "npx " + tool + " --reporter=lcov --reporter=json-summary " + cmd
+		}
+		report = "coverage/lcov.info"
+		gate = fmt.Sprintf(`node -e "const p = require('./coverage/coverage-summary.json').total.lines.pct; console.log('Coverage: ' + p + '%%'); if (p < %g) { console.error('Coverage ' + p + '%% is below %g%%'); process.exit(1) }"`, threshold, threshold)
+
+	case "python":
+		testCmd = "pip install pytest-cov && pytest --cov=. --cov-report=xml --cov-report=term"
+		if threshold > 0 {
+			// pytest-cov enforces the threshold itself
+			testCmd += fmt.Sprintf(" --cov-fail-under=%g", threshold)
+		}
+		report = "coverage.xml"
+
+	case "go":
+		testCmd = "go test -v -coverprofile=coverage.out ./..."
+		report = "coverage.out"
+		gate = fmt.Sprintf(`TOTAL=$(go tool cover -func=coverage.out | awk '/^total:/ {sub("%%", "", $3); print $3}')
+          echo "Coverage: ${TOTAL}%%"
+          awk -v total="$TOTAL" 'BEGIN { exit (total + 0 < %g) }' || { echo "Coverage ${TOTAL}%% is below %g%%"; exit 1; }`, threshold, threshold)
+
+	case "java":
+		// JaCoCo has to be set up in the build; the threshold is its own rule
+		if info.CoverageTool() != "jacoco" {
+			return ""
+		}
+		if info.PackageManager == "maven" {
+			testCmd = "mvn -B test jacoco:report"
+			report = "target/site/jacoco/jacoco.xml"
+		} else {
+			testCmd = "./gradlew test jacocoTestReport"
+			report = "build/reports/jacoco/test/jacocoTestReport.xml"
+		}
+
+	default:
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("      - name: Test with coverage\n        run: %s\n", testCmd))
+	if threshold > 0 && gate != "" {
+		sb.WriteString(fmt.Sprintf("\n      - name: Check coverage threshold (%g%%)\n        run: |\n          %s\n", threshold, gate))
+	}
+
+	// Actions do not honour defaults.run.working-directory
+	if opts.Dir != "" {
+		report = opts.Dir + "/" + report
+	}
+
+	switch opts.CoverageProvider {
+	case "codecov":
+		sb.WriteString(fmt.Sprintf(`
+      - name: Upload coverage to Codecov
+        uses: codecov/codecov-action@v4
+        with:
+          files: %s
+          token: ${{ secrets.CODECOV_TOKEN }}
+`, report))
+	case "coveralls":
+		sb.WriteString(fmt.Sprintf(`
+      - name: Upload coverage to Coveralls
+        uses: coverallsapp/github-action@v2
+        with:
+          file: %s
+`, report))
+	default:
+		sb.WriteString(fmt.Sprintf(`
+      - name: Upload coverage report
+        uses: actions/upload-artifact@v4
+        with:
+          name: coverage
+          path: %s
+`, report))
+	}
+
+	return sb.String()
+}
+
+// e2eBrowserCaches are where each framework keeps its browsers or binary
+var e2eBrowserCaches = map[string]string{
+	"playwright": "~/.cache/ms-playwright",
+	"cypress":    "~/.cache/Cypress",
+}
+
+// testShardJob runs the test suite split across a matrix of shards, next
+// to the build job
+func testShardJob(info *analyzer.ProjectInfo, opts pipelineOptions, setup []workflowStep, defaults, shardCmd string) string {
+	shards := make([]string, opts.TestShards)
+	for i := range shards {
+		shards[i] = strconv.Itoa(i + 1)
+	}
+	var sb strings.Builder
+	sb.WriteString("\n  test:\n    runs-on: ubuntu-latest\n")
+	sb.WriteString(fmt.Sprintf("    strategy:\n      fail-fast: false\n      matrix:\n        shard: [%s]\n", strings.Join(shards, ", ")))
+	sb.WriteString(defaults)
+	sb.WriteString(checkoutStep(info, opts))
+	if len(setup) > 0 {
+		sb.WriteString(renderSteps(setup, "      ", false, "") + "\n")
+	}
+	sb.WriteString(fmt.Sprintf("      - name: Test (shard ${{ matrix.shard }}/%d)\n        run: |\n          %s\n", opts.TestShards, shardCmd))
+	return sb.String()
+}
+
+// e2eShardCommand runs one shard of the browser suite, or "" when the
+// framework cannot be split without a paid service
+func e2eShardCommand(info *analyzer.ProjectInfo, shards int) string {
+	e2e := info.E2E
+	switch {
+	case e2e.Framework == "playwright" && info.Language == "node":
+		return optimizer.ShardCommand("playwright", shards)
+	case e2e.Framework == "cypress":
+		// Distribute spec files round-robin; Cypress Cloud is not needed
+		return fmt.Sprintf(`SPECS=$(find cypress/e2e -name '*.cy.*' | sort | awk 'NR %% %d == ${{ matrix.shard }} - 1' | paste -sd, -)
+if [ -n "$SPECS" ]; then npx cypress run --spec "$SPECS"; fi`, shards)
+	case info.Language == "python":
+		return optimizer.ShardCommand("pytest", shards)
+	}
+	return ""
+}
+
+// e2eJob builds a job that installs (and caches) the browsers, boots the app
+// with its start command or compose file, runs the browser suite and uploads
+// traces and screenshots when it fails
+func e2eJob(info *analyzer.ProjectInfo, opts pipelineOptions, setup []workflowStep, defaults string) string {
+	e2e := info.E2E
+	// Actions do not honour defaults.run.working-directory
+	path := func(p string) string {
+		if opts.Dir != "" && !strings.HasPrefix(p, "~") {
+			return opts.Dir + "/" + p
+		}
+		return p
+	}
+	lockfiles := "'**/package-lock.json', '**/yarn.lock', '**/pnpm-lock.yaml'"
+	if info.Language == "python" {
+		lockfiles = "'**/requirements*.txt', '**/pyproject.toml'"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n  e2e:\n    runs-on: ubuntu-latest\n")
+	command := e2e.Command
+	shards := ""
+	if opts.E2EShards > 1 {
+		if shardCmd := e2eShardCommand(info, opts.E2EShards); shardCmd != "" {
+			n := make([]string, opts.E2EShards)
+			for i := range n {
+				n[i] = strconv.Itoa(i + 1)
+			}
+			sb.WriteString(fmt.Sprintf("    strategy:\n      fail-fast: false\n      matrix:\n        shard: [%s]\n", strings.Join(n, ", ")))
+			command, shards = shardCmd, "-${{ matrix.shard }}"
+		} else {
+			term.Printf("⚠️  Sharding is not supported for %s suites; generating a single E2E job\n", e2e.Framework)
+		}
+	}
+	sb.WriteString(defaults)
+	sb.WriteString("    steps:\n      - uses: actions/checkout@v4\n\n")
+
+	var steps []workflowStep
+	if cache, ok := e2eBrowserCaches[e2e.Framework]; ok {
+		// Restored before install, since installing dependencies downloads the Cypress binary
+		steps = append(steps, workflowStep{Name: "Cache " + e2e.Framework + " browsers", Uses: "actions/cache@v4", With: [][2]string{
+			{"path", cache},
+			{"key", e2e.Framework + "-${{ runner.os }}-${{ hashFiles(" + lockfiles + ") }}"},
+		}})
+	}
+	steps = append(steps, setup...)
+	switch {
+	case e2e.Framework == "playwright" && info.Language == "python":
+		steps = append(steps, workflowStep{Name: "Install Playwright browsers", Run: "python -m playwright install --with-deps"})
+	case e2e.Framework == "playwright":
+		steps = append(steps, workflowStep{Name: "Install Playwright browsers", Run: "npx playwright install --with-deps"})
+	case e2e.Framework == "cypress":
+		steps = append(steps, workflowStep{Name: "Install Cypress", Run: "npx cypress install"})
+	}
+
+	// The runner image ships Chrome, so Selenium needs no browser install
+	boot := ""
+	switch {
+	case e2e.ComposeFile != "":
+		boot = fmt.Sprintf("docker compose -f %s up -d --wait", e2e.ComposeFile)
+	case e2e.Start != "":
+		boot = fmt.Sprintf("nohup %s > app.log 2>&1 &", e2e.Start)
+	}
+	if e2e.Start != "" && info.BuildCommand != "" && info.Language == "node" {
+		steps = append(steps, workflowStep{Name: "Build", Run: info.BuildCommand})
+	}
+	if boot != "" {
+		if e2e.URL != "" {
+			boot += fmt.Sprintf("\ntimeout 120 bash -c 'until curl -sf %s > /dev/null; do sleep 2; done'", e2e.URL)
+		}
+		steps = append(steps, workflowStep{Name: "Start app", Run: boot})
+	}
+	steps = append(steps, workflowStep{Name: "Run E2E tests", Run: command})
+
+	artifacts := make([]string, len(e2e.Artifacts))
+	for i, a := range e2e.Artifacts {
+		artifacts[i] = path(a)
+	}
+	if e2e.Start != "" {
+		artifacts = append(artifacts, path("app.log"))
+	}
+	steps = append(steps, workflowStep{Name: "Upload traces and screenshots", If: "failure()", Uses: "actions/upload-artifact@v4", With: [][2]string{
+		{"name", "e2e-artifacts" + shards},
+		{"path", strings.Join(artifacts, "\n")},
+		{"retention-days", "7"},
+	}})
+	if e2e.ComposeFile != "" {
+		steps = append(steps, workflowStep{Name: "Show app logs", If: "failure()", Run: fmt.Sprintf("docker compose -f %s logs", e2e.ComposeFile)})
+	}
+	sb.WriteString(renderSteps(steps, "      ", false, ""))
+	return sb.String()
+}
+
+func generatePipeline(platform string, opts pipelineOptions) {
+	if !quiet {
+		term.Printf("Generating %s pipeline...\n", platform)
+	}
+
+	// First analyze the project
+	a := analyzer.NewAnalyzer(".")
+	info, _ := a.Analyze()
+
+	generateStackPipelines(info, opts)
+}
+
+// generateDeployJob builds a GitHub Actions job that publishes and deploys with cicli,
+// authenticating to the cluster according to deploy.provider in cicli.yaml. It
+// runs after the jobs in needs.
+func generateDeployJob(env string, needs []string) string {
+	provider := "kubernetes"
+	environment := " " + env
+	cfg, err := config.LoadConfig("cicli.yaml")
+	if err == nil && cfg.Deploy.Provider != "" {
+		provider = cfg.Deploy.Provider
+	}
+	if err == nil && cfg.Environments[env].URL != "" {
+		// The URL links the deployment from pull requests and the Environments page
+		environment = fmt.Sprintf("\n      name: %s\n      url: %s", env, cfg.Environments[env].URL)
+	}
+	if err != nil {
+		term.Println("⚠️  cicli.yaml not found; the deploy job assumes a plain kubeconfig secret. Run 'cicli init' first.")
+	}
+
+	var sb strings.Builder
+	after := needs[0]
+	if len(needs) > 1 {
+		after = "[" + strings.Join(needs, ", ") + "]"
+	}
+	sb.WriteString(fmt.Sprintf(`
+  deploy:
+    needs: %s
+    if: github.ref == 'refs/heads/main' && github.event_name == 'push'
+    runs-on: ubuntu-latest
+    environment:%s
+    permissions:
+      contents: read
+      id-token: write
+      packages: write
+    steps:
+      - uses: actions/checkout@v4
+
+      - name: Install cicli
+        run: |
+`, after, environment))
+	for _, line := range strings.Split(selfupdate.CIInstallScript, "\n") {
+		sb.WriteString("          " + line + "\n")
+	}
+	sb.WriteString("\n")
+
+	// ECR takes the role's credentials rather than a registry token, and the
+	// registry it returns replaces the one in image_name
+	registry := ""
+	switch provider {
+	case "aws", "eks":
+		sb.WriteString(`      - uses: aws-actions/configure-aws-credentials@v4
+        with:
+          role-to-assume: ${{ secrets.AWS_ROLE_ARN }}
+          aws-region: ${{ vars.AWS_REGION }}
+
+      - uses: aws-actions/amazon-ecr-login@v2
+        id: ecr
+
+`)
+		registry = " --registry=${{ steps.ecr.outputs.registry }}"
+	case "gcp", "gke":
+		sb.WriteString(`      - uses: google-github-actions/auth@v2
+        with:
+          workload_identity_provider: ${{ secrets.GCP_WORKLOAD_IDENTITY_PROVIDER }}
+          service_account: ${{ secrets.GCP_SERVICE_ACCOUNT }}
+
+      - uses: google-github-actions/setup-gcloud@v2
+        with:
+          install_components: gke-gcloud-auth-plugin
+
+`)
+	case "azure", "aks":
+		sb.WriteString(`      - uses: azure/login@v2
+        with:
+          client-id: ${{ secrets.AZURE_CLIENT_ID }}
+          tenant-id: ${{ secrets.AZURE_TENANT_ID }}
+          subscription-id: ${{ secrets.AZURE_SUBSCRIPTION_ID }}
+
+`)
+	default:
+		sb.WriteString(`      - uses: azure/k8s-set-context@v4
+        with:
+          method: kubeconfig
+          kubeconfig: ${{ secrets.KUBECONFIG }}
+
+`)
+	}
+
+	if registry == "" {
+		sb.WriteString(`      - uses: docker/login-action@v3
+        with:
+          registry: ${{ vars.REGISTRY || 'ghcr.io' }}
+          username: ${{ github.actor }}
+          password: ${{ secrets.REGISTRY_TOKEN || secrets.GITHUB_TOKEN }}
+
+`)
+	}
+	sb.WriteString(fmt.Sprintf(`      - name: Publish image
+        run: cicli docker publish --use-git-sha%s
+
+      - name: Deploy
+        run: cicli deploy --env=%s --tag=$(git rev-parse --short HEAD)%s
+`, registry, env, registry))
+
+	return sb.String()
+}
+
+func generateDockerfile() {
+	a := analyzer.NewAnalyzer(".")
+	info, _ := a.Analyze()
+
+	dockerfile := generateDockerfileForStack(info)
+
+	if err := writeGenerated("Dockerfile", stamp(dockerfile, stackTemplate("dockerfile", info), info)); err != nil {
+		term.Printf("Error writing Dockerfile: %v\n", err)
+		exit(1)
+	}
+}
+
+func generateDockerfileForStack(info *analyzer.ProjectInfo) string {
+	if info.Bazel != nil {
+		return generateBazelDockerfile(info)
+	}
+	switch info.Language {
+	case "node":
+		return `# Build stage
+FROM node:20-alpine AS builder
+WORKDIR /app
+COPY package*.json ./
+RUN npm ci --only=production
+
+# Production stage
+FROM node:20-alpine
+WORKDIR /app
+COPY --from=builder /app/node_modules ./node_modules
+COPY . .
+EXPOSE 3000
+CMD ["node", "index.js"]
+`
+
+	case "go":
+		return `# Build stage
+FROM golang:1.22-alpine AS builder
+WORKDIR /app
+COPY go.* ./
+RUN go mod download
+COPY . .
+RUN CGO_ENABLED=0 GOOS=linux go build -o /app/main .
+
+# Production stage
+FROM alpine:latest
+RUN apk --no-cache add ca-certificates
+WORKDIR /root/
+COPY --from=builder /app/main .
+EXPOSE 8080
+CMD ["./main"]
+`
+
+	case "python":
+		return `FROM python:3.12-slim
+WORKDIR /app
+COPY requirements.txt .
+RUN pip install --no-cache-dir -r requirements.txt
+COPY . .
+EXPOSE 8000
+CMD ["python", "app.py"]
+`
+
+	default:
+		return `FROM alpine:latest
+WORKDIR /app
+COPY . .
+# Add your build and run commands
+CMD ["echo", "Configure your Dockerfile"]
+`
+	}
+}
+
+// bazelRuntimeImages are the distroless bases for the binaries Bazel
+// builds, as in the rules_oci examples
+var bazelRuntimeImages = map[string]string{
+	"go_binary":     "gcr.io/distroless/base-debian12:nonroot",
+	"cc_binary":     "gcr.io/distroless/cc-debian12:nonroot",
+	"rust_binary":   "gcr.io/distroless/cc-debian12:nonroot",
+	"java_binary":   "gcr.io/distroless/java17-debian12:nonroot",
+	"kt_jvm_binary": "gcr.io/distroless/java17-debian12:nonroot",
+}
+
+// generateBazelDockerfile follows the rules_oci approach in a Dockerfile:
+// Bazel builds the binary, which is copied onto a distroless base and runs
+// as a non-root user. JVM binaries are packaged as their deploy jar.
+// Binaries that need runfiles (Python, JavaScript) are better served by
+// rules_oci itself, which the Dockerfile points out.
+func generateBazelDockerfile(info *analyzer.ProjectInfo) string {
+	bazel := info.Bazel
+	version := bazel.Version
+	if version == "" {
+		version = "latest"
+	}
+	port := 8080
+	if len(info.Ports) > 0 {
+		port = info.Ports[0]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# syntax=docker/dockerfile:1\n")
+	if push := bazel.ImageTarget("oci_push"); push != "" {
+		sb.WriteString(fmt.Sprintf("# This workspace builds images with rules_oci; 'bazel run %s' publishes\n# one without Docker.\n", push))
+	} else if !bazel.RulesOCI {
+		sb.WriteString("# rules_oci can build this image in Bazel without Docker: add oci_image and\n# oci_push targets (https://github.com/bazel-contrib/rules_oci).\n")
+	}
+
+	var target analyzer.BazelTarget
+	for _, t := range bazel.Binaries {
+		if _, ok := bazelRuntimeImages[t.Kind]; ok {
+			target = t
+			break
+		}
+	}
+	if target.Label == "" {
+		sb.WriteString(fmt.Sprintf(`# No Go, C++, Rust or JVM binary target found; binaries that need their
+# runfiles should be packaged with rules_oci instead.
+FROM gcr.io/bazel-public/bazel:%s
+USER root
+WORKDIR /src
+COPY . .
+# Replace with your binary target
+CMD ["bazel", "run", "//:app"]
+`, version))
+		return sb.String()
+	}
+
+	label, artifact, entrypoint := target.Label, "/app", `["/app"]`
+	if strings.HasPrefix(bazelRuntimeImages[target.Kind], "gcr.io/distroless/java") {
+		// The deploy jar bundles the binary's runtime classpath
+		label, artifact, entrypoint = target.Label+"_deploy.jar", "/app.jar", `["java", "-jar", "/app.jar"]`
+	}
+	sb.WriteString(fmt.Sprintf(`
+# Build stage: Bazel at the workspace's pinned version
+FROM gcr.io/bazel-public/bazel:%s AS builder
+USER root
+WORKDIR /src
+COPY . .
+RUN --mount=type=cache,target=/root/.cache/bazel \
+    bazel build %s && \
+    cp -L "$(bazel cquery --output=files %s)" %s
+
+# Production stage
+FROM %s
+COPY --from=builder %s %s
+EXPOSE %d
+ENTRYPOINT %s
+`, version, label, label, artifact, bazelRuntimeImages[target.Kind], artifact, artifact, port, entrypoint))
+	return sb.String()
+}
+
+func generateKubernetes() {
+	a := analyzer.NewAnalyzer(".")
+	info, _ := a.Analyze()
+
+	deployment := fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %s
+  labels:
+    app: %s
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: %s
+  template:
+    metadata:
+      labels:
+        app: %s
+    spec:
+      containers:
+        - name: %s
+          image: %s:latest
+          ports:
+            - containerPort: 3000
+          resources:
+            requests:
+              memory: "128Mi"
+              cpu: "100m"
+            limits:
+              memory: "256Mi"
+              cpu: "500m"
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: %s
+spec:
+  selector:
+    app: %s
+  ports:
+    - protocol: TCP
+      port: 80
+      targetPort: 3000
+  type: LoadBalancer
+`, info.Name, info.Name, info.Name, info.Name, info.Name, info.Name, info.Name, info.Name)
+
+	if err := writeGenerated(filepath.Join("k8s", "deployment.yaml"), stamp(deployment, "kubernetes/deployment", info)); err != nil {
+		term.Printf("Error writing deployment: %v\n", err)
+		exit(1)
+	}
+}
+
+// generateInfra writes Terraform for the cloud resources the generated
+// pipelines assume: registries, the role the deploy job assumes and its
+// access to clusters
+func generateInfra(args []string) {
+	cloud := "aws"
+	dir := ""
+	repo := ""
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--cloud="):
+			cloud = strings.TrimPrefix(arg, "--cloud=")
+		case strings.HasPrefix(arg, "--dir="):
+			dir = strings.TrimPrefix(arg, "--dir=")
+		case strings.HasPrefix(arg, "--repo="):
+			repo = strings.TrimPrefix(arg, "--repo=")
+		}
+	}
+	if cloud != "aws" {
+		term.Printf("Unsupported cloud %q (supported: %s)\n", cloud, strings.Join(infra.Clouds, ", "))
+		exit(1)
+	}
+	if dir == "" {
+		dir = filepath.Join("infra", cloud)
+	}
+
+	info, err := analyzer.NewAnalyzer(".").Analyze()
+	if err != nil {
+		term.Printf("Error analyzing project: %v\n", err)
+		exit(1)
+	}
+	var cfg *config.Config
+	if loaded, err := config.LoadConfig("cicli.yaml"); err == nil {
+		cfg = loaded
+	}
+	in := infra.NewAWSInput(info.Name, cfg)
+	in.Repository = repo
+	if in.Repository == "" {
+		in.Repository = githubRepoFromRemote()
+	}
+	if in.Repository == "" {
+		in.Repository = "OWNER/REPO"
+		fmt.Fprintln(os.Stderr, "⚠️  No GitHub remote found: set github_repository in variables.tf, or rerun with --repo=owner/name")
+	}
+
+	files, err := infra.AWS(in)
+	if err != nil {
+		term.Printf("Error generating Terraform: %v\n", err)
+		exit(1)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := writeGenerated(path, stamp(files[name], "infra/"+cloud+"/"+name, in)); err != nil {
+			term.Printf("Error writing %s: %v\n", path, err)
+			exit(1)
+		}
+	}
+	if writeMode == modeWrite && !quiet {
+		fmt.Fprintf(os.Stderr, "💡 After terraform apply in %s, store the role_arn output as the AWS_ROLE_ARN secret and region as the AWS_REGION variable; the deploy job logs in to the ECR registry itself\n", dir)
+	}
+}
+
+// outputTarget controls whether generate and convert write files, print them or diff them
+type outputTarget int
+
+const (
+	modeWrite outputTarget = iota
+	modeStdout
+	modeDryRun
+)
+
+var (
+	writeMode = modeWrite
+	force     bool
+)
+
+// setWriteMode picks up --stdout / --dry-run / --force; printing to stdout
+// implies quiet so the output can be piped as-is
+func setWriteMode(args []string) {
+	for _, arg := range args {
+		switch arg {
+		case "--force":
+			force = true
+		case "--stdout":
+			writeMode = modeStdout
+			quiet = true
+			progress.Disabled = true
+		case "--dry-run":
+			writeMode = modeDryRun
+		}
+	}
+}
+
+// writeGenerated writes content to path, or prints/diffs it depending on writeMode
+func writeGenerated(path, content string) error {
+	switch writeMode {
+	case modeStdout:
+		fmt.Print(content)
+		return nil
+	case modeDryRun:
+		existing, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		d := diff.Unified("a/"+filepath.ToSlash(path), "b/"+filepath.ToSlash(path), string(existing), content)
+		if d == "" {
+			term.Printf("No changes: %s\n", path)
+			return nil
+		}
+		fmt.Fprint(term.Output, d)
+		return nil
+	}
+
+	existing, err := os.ReadFile(path)
+	if err == nil {
+		if string(existing) == content {
+			term.Printf("Unchanged: %s\n", path)
+			return nil
+		}
+		fmt.Fprint(term.Output, diff.Unified("a/"+filepath.ToSlash(path), "b/"+filepath.ToSlash(path), string(existing), content))
+		// Only warn when replacing a file cicli would otherwise not notice was hand-written
+		if m := marker.Find(string(existing)); marker.Find(content) != nil && m == nil {
+			term.Printf("⚠️  %s was not generated by cicli; overwriting replaces hand-written content\n", path)
+		} else if m != nil && m.Modified(string(existing)) {
+			term.Printf("⚠️  %s was edited since cicli generated it (%s); overwriting drops those edits\n", path, m.Template)
+		}
+		if !force {
+			if !term.IsTerminal(os.Stdin) {
+				return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+			}
+			if !confirm(fmt.Sprintf("Overwrite %s?", path)) {
+				term.Printf("Skipped: %s\n", path)
+				return nil
+			}
+		}
+		if err := backupFile(path, existing); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return err
+	}
+	term.Printf("✅ Generated: %s\n", path)
+	return nil
+}
+
+// stamp adds the marker block that identifies content as generated by cicli
+// from template, with a hash of the analysis or config it came from
+func stamp(content, template string, source interface{}) string {
+	if info, ok := source.(*analyzer.ProjectInfo); ok {
+		// Writing the file changes what is detected, so that is left out
+		stable := *info
+		stable.HasDocker, stable.HasCI, stable.CIPlatform, stable.Suggestions = false, false, "", nil
+		source = stable
+	}
+	return marker.Stamp(content, marker.Marker{Generator: "cicli " + version, Template: template, Analysis: marker.Hash(source)}, "#")
+}
+
+// stackTemplate names the template used for the detected stack
+func stackTemplate(kind string, info *analyzer.ProjectInfo) string {
+	if info.Bazel != nil {
+		return kind + "/bazel"
+	}
+	return kind + "/" + info.Language
+}
+
+// backupFile keeps the previous contents of path next to it as path.bak
+func backupFile(path string, content []byte) error {
+	if err := os.WriteFile(path+".bak", content, 0644); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	term.Printf("💾 Backup: %s.bak\n", path)
+	return nil
+}
+
+// confirm asks a yes/no question, defaulting to no
+func confirm(question string) bool {
+	ok := false
+	if err := huh.NewConfirm().Title(question).Value(&ok).Run(); err != nil {
+		return false
+	}
+	return ok
+}
+
+// handleConvert converts between CI/CD platforms
+func handleConvert() {
+	var from, to, input, output, reportPath string
+	all := false
+	setWriteMode(os.Args[2:])
+
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		if strings.HasPrefix(arg, "--from=") {
+			from = strings.TrimPrefix(arg, "--from=")
+		} else if strings.HasPrefix(arg, "--to=") {
+			to = strings.TrimPrefix(arg, "--to=")
+		} else if strings.HasPrefix(arg, "--input=") {
+			input = strings.TrimPrefix(arg, "--input=")
+		} else if strings.HasPrefix(arg, "--output=") {
+			output = strings.TrimPrefix(arg, "--output=")
+		} else if arg == "--all" {
+			all = true
+		} else if arg == "--report" {
+			reportPath = filepath.Join(".cicli", "convert-report.md")
+		} else if strings.HasPrefix(arg, "--report=") {
+			reportPath = strings.TrimPrefix(arg, "--report=")
+		} else if !strings.HasPrefix(arg, "-") && input == "" {
+			input = arg
+		}
+	}
+
+	if from == "" || to == "" {
+		term.Println("Usage: cicli convert --from=<platform> --to=<platform> [--input=<file|dir>] [--output=<file>] [--all] [--report[=<file>]] [--stdout|--dry-run] [--force]")
+		term.Println("\nSupported platforms: github, gitlab, circleci, azure, jenkins, bitbucket, drone, woodpecker, buildkite; teamcity, bamboo and travis as sources only; harness, codefresh and tekton as targets only")
+		if drivers := converter.Drivers(); len(drivers) > 0 {
+			var names []string
+			for _, d := range drivers {
+				names = append(names, string(d.Platform()))
+			}
+			term.Println("Registered platforms: " + strings.Join(names, ", "))
+		}
+		term.Println("\nExamples:")
+		term.Println("  cicli convert --from=gitlab --to=github")
+		term.Println("  cicli convert --from=jenkins --to=github --input=Jenkinsfile")
+		term.Println("  cicli convert --from=gitlab --to=github --all")
+		term.Println("  cicli convert --from=github --to=gitlab .github/workflows")
+		term.Println("  cicli convert --from=circleci --to=github --report=convert-report.json")
+		exit(1)
+	}
+
+	if all || isDir(input) {
+		root := "."
+		if input != "" {
+			root = input
+		}
+		if output != "" {
+			term.Println("--output= applies to single files; batch outputs are named after their inputs")
+			exit(1)
+		}
+		convertAll(converter.Platform(from), converter.Platform(to), root, reportPath)
+		return
+	}
+
+	// Auto-detect input file if not specified
+	if input == "" {
+		input = detectCIFile(converter.Platform(from))
+		if input == "" {
+			term.Printf("Could not find %s CI configuration file\n", from)
+			exit(1)
+		}
+	}
+
+	// Generate output path if not specified
+	if output == "" {
+		output = getDefaultOutputPath(converter.Platform(to))
+	}
+
+	if !quiet {
+		term.Printf("🔄 Converting %s → %s\n", from, to)
+		term.Printf("   Input:  %s\n", input)
+		term.Printf("   Output: %s\n", output)
+	}
+
+	reportAnchors(input)
+
+	c := converter.NewConverter()
+	c.Generator = "cicli " + version
+	content, findings, err := c.RenderWithFindings(converter.Platform(from), converter.Platform(to), input)
+	if err == nil {
+		reportConversionNotes(input, findings)
+		err = writeGenerated(output, content)
+	}
+	if err != nil {
+		term.Printf("Error converting: %v\n", err)
+		exit(1)
+	}
+	if reportPath != "" {
+		writeConversionReport(reportPath, &converter.Report{
+			From:  converter.Platform(from),
+			To:    converter.Platform(to),
+			Files: []converter.FileReport{{Input: input, Output: output, Findings: findings}},
+		})
+	}
+	if writeMode != modeWrite {
+		return
+	}
+
+	if !quiet {
+		term.Println("\n💡 Tip: Run 'cicli lint' to validate the converted workflow")
+	}
+}
+
+// convertAll converts every CI file of the source platform under root and
+// writes a manifest of inputs→outputs, plus the report when reportPath is set
+func convertAll(from, to converter.Platform, root, reportPath string) {
+	inputs, err := converter.DiscoverDir(root, from)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+	if len(inputs) == 0 {
+		term.Printf("Could not find any %s CI configuration files in %s\n", from, root)
+		exit(1)
+	}
+
+	c := converter.NewConverter()
+	c.Generator = "cicli " + version
+	outputs := converter.OutputPaths(to, inputs)
+
+	report := &converter.Report{From: from, To: to}
+	if writeMode != modeWrite {
+		for _, input := range inputs {
+			content, findings, err := c.RenderWithFindings(from, to, input)
+			if err == nil {
+				reportConversionNotes(input, findings)
+				report.Files = append(report.Files, converter.FileReport{Input: input, Output: outputs[input], Findings: findings})
+				if writeMode == modeStdout {
+					term.Printf("# %s -> %s\n", input, outputs[input])
+				}
+				err = writeGenerated(outputs[input], content)
+			}
+			if err != nil {
+				term.Printf("Error converting %s: %v\n", input, err)
+				exit(1)
+			}
+		}
+		if reportPath != "" {
+			writeConversionReport(reportPath, report)
+		}
+		return
+	}
+
+	// Outputs are written concurrently, so confirm overwrites and back up up front
+	prepareOverwrites(inputs, outputs)
+
+	term.Printf("🔄 Converting %d %s file(s) → %s\n", len(inputs), from, to)
+	mappings := c.ConvertAll(from, to, inputs, outputs)
+	failed := printMappings(mappings)
+
+	manifestPath := filepath.Join(".cicli", "convert-manifest.json")
+	manifest := &converter.Manifest{From: from, To: to, Mappings: mappings}
+	if err := converter.WriteManifest(manifestPath, manifest); err != nil {
+		term.Printf("Error writing manifest: %v\n", err)
+		exit(1)
+	}
+	term.Printf("\n📄 Manifest: %s\n", manifestPath)
+	if reportPath != "" {
+		for _, m := range mappings {
+			if m.Status != "failed" {
+				report.Files = append(report.Files, converter.FileReport{Input: m.Input, Output: m.Output, Findings: m.Findings})
+			}
+		}
+		writeConversionReport(reportPath, report)
+	}
+
+	if failed > 0 {
+		term.Printf("%d of %d conversions failed\n", failed, len(mappings))
+		exit(1)
+	}
+	if !quiet {
+		term.Println("\n💡 Tip: Run 'cicli lint' to validate the converted workflows")
+	}
+}
+
+// isDir reports whether path names an existing directory
+func isDir(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// prepareOverwrites confirms overwriting existing outputs (unless --force)
+// and backs them up
+func prepareOverwrites(inputs []string, outputs map[string]string) {
+	var existing []string
+	for _, input := range inputs {
+		if _, err := os.Stat(outputs[input]); err == nil {
+			existing = append(existing, outputs[input])
+		}
+	}
+	if len(existing) > 0 {
+		term.Printf("⚠️  %d output file(s) already exist: %s\n", len(existing), strings.Join(existing, ", "))
+		term.Println("   Run with --dry-run to see what would change")
+		if !force {
+			if !term.IsTerminal(os.Stdin) || !confirm(fmt.Sprintf("Overwrite %d file(s)?", len(existing))) {
+				term.Println("Aborted (use --force to overwrite)")
+				exit(1)
+			}
+		}
+		for _, path := range existing {
+			content, err := os.ReadFile(path)
+			if err == nil {
+				err = backupFile(path, content)
+			}
+			if err != nil {
+				term.Printf("Error: %v\n", err)
+				exit(1)
+			}
+		}
+	}
+}
+
+// printMappings lists batch conversion results and returns the number of failures
+func printMappings(mappings []converter.Mapping) int {
+	failed := 0
+	for _, m := range mappings {
+		if m.Status == "failed" {
+			failed++
+			term.Printf("   ❌ %s: %s\n", m.Input, m.Error)
+			continue
+		}
+		term.Printf("   ✅ %s → %s\n", m.Input, m.Output)
+		for _, f := range m.Findings {
+			term.Printf("      ⚠️  %s\n", f)
+		}
+	}
+	return failed
+}
+
+// handleMigrate walks through a full platform migration: detect the current
+// CI, convert every file, map secrets, write a fidelity report, optionally
+// disable the old config and open a pull request
+func handleMigrate() {
+	var from, to, disable string
+	openPR, noPR := false, false
+	for _, arg := range os.Args[2:] {
+		switch {
+		case strings.HasPrefix(arg, "--from="):
+			from = strings.TrimPrefix(arg, "--from=")
+		case strings.HasPrefix(arg, "--to="):
+			to = strings.TrimPrefix(arg, "--to=")
+		case strings.HasPrefix(arg, "--disable="):
+			disable = strings.TrimPrefix(arg, "--disable=")
+		case arg == "--pr":
+			openPR = true
+		case arg == "--no-pr":
+			noPR = true
+		case arg == "--force":
+			force = true
+		}
+	}
+	interactive := term.IsTerminal(os.Stdin) && term.IsTerminal(os.Stdout)
+
+	// 1. Detect the current platform
+	found := migrate.Detect(".")
+	if from == "" {
+		var detected []string
+		for _, p := range migrate.Sources {
+			if len(found[p]) > 0 {
+				detected = append(detected, string(p))
+			}
+		}
+		switch {
+		case len(detected) == 0:
+			term.Println("Could not find a CI configuration to migrate (supported: github, gitlab, circleci, jenkins)")
+			exit(1)
+		case len(detected) == 1 || !interactive:
+			from = detected[0]
+		default:
+			from = choose("Which CI configuration do you want to migrate?", detected)
+		}
+	}
+	inputs := found[converter.Platform(from)]
+	if len(inputs) == 0 {
+		term.Printf("Could not find any %s CI configuration files\n", from)
+		exit(1)
+	}
+	term.Printf("🔍 Detected %s: %s\n", from, strings.Join(inputs, ", "))
+
+	// 2. Pick the target
+	if to == "" {
+		var targets []string
+		for _, p := range migrate.Targets {
+			if string(p) != from {
+				targets = append(targets, string(p))
+			}
+		}
+		if !interactive {
+			term.Println("Usage: cicli migrate --to=<platform> [--from=<platform>] [--disable=keep|rename|if-false] [--pr|--no-pr] [--force]")
+			exit(1)
+		}
+		to = choose("Migrate to which platform?", targets)
+	}
+	if to == from {
+		term.Println("Source and target platform are the same")
+		exit(1)
+	}
+
+	// 3. Convert everything
+	c := converter.NewConverter()
+	c.Generator = "cicli " + version
+	outputs := converter.OutputPaths(converter.Platform(to), inputs)
+	prepareOverwrites(inputs, outputs)
+
+	term.Printf("\n🔄 Converting %d file(s) → %s\n", len(inputs), to)
+	mappings := c.ConvertAll(converter.Platform(from), converter.Platform(to), inputs, outputs)
+	if failed := printMappings(mappings); failed > 0 {
+		term.Printf("%d of %d conversions failed; fix them before migrating\n", failed, len(mappings))
+		exit(1)
+	}
+
+	// 4. Map secrets
+	report := &migrate.Report{
+		From:     converter.Platform(from),
+		To:       converter.Platform(to),
+		Mappings: mappings,
+		Secrets:  migrate.FindSecrets(converter.Platform(from), inputs),
+	}
+	if len(report.Secrets) > 0 {
+		term.Printf("\n🔐 %d secret(s) to recreate on %s:\n", len(report.Secrets), to)
+		for _, sec := range report.Secrets {
+			term.Printf("   %s → %s\n", sec.Source, migrate.TargetReference(report.To, sec.Target))
+			term.Printf("      %s\n", migrate.SetupCommand(report.To, sec.Target))
+		}
+	}
+
+	// 5. Disable the old config
+	if disable == "" {
+		disable = migrate.DisableKeep
+		if interactive {
+			options := []string{migrate.DisableKeep, migrate.DisableRename}
+			if from == string(converter.GitHub) {
+				options = append(options, migrate.DisableIfFalse)
+			}
+			disable = choose("Disable the old CI configuration?", options)
+		}
+	}
+	disabled, err := migrate.Disable(converter.Platform(from), inputs, disable)
+	if err != nil {
+		term.Printf("Error disabling old configuration: %v\n", err)
+		exit(1)
+	}
+	report.Disabled = disabled
+	if disable != migrate.DisableKeep {
+		term.Printf("\n🚫 Disabled old configuration (%s)\n", disable)
+	}
+
+	// 6. Fidelity report and manifest
+	reportPath := filepath.Join(".cicli", "migration-report.md")
+	manifestPath := filepath.Join(".cicli", "convert-manifest.json")
+	err = migrate.WriteReport(reportPath, report)
+	if err == nil {
+		err = converter.WriteManifest(manifestPath, &converter.Manifest{From: report.From, To: report.To, Mappings: mappings})
+	}
+	if err != nil {
+		term.Printf("Error writing report: %v\n", err)
+		exit(1)
+	}
+	term.Printf("\n📄 Report: %s\n", reportPath)
+
+	// 7. Open a pull request
+	if !openPR && !noPR && interactive {
+		openPR = confirm("Open a migration pull request?")
+	}
+	if !openPR {
+		if !quiet {
+			term.Println("\n💡 Tip: Review the report, then commit the changes or rerun with --pr")
+		}
+		return
+	}
+
+	paths := append([]string{reportPath, manifestPath}, disabled...)
+	for _, m := range mappings {
+		paths = append(paths, m.Output)
+	}
+	branch := fmt.Sprintf("cicli/migrate-%s-to-%s", from, to)
+	url, err := migrate.OpenPR(branch, fmt.Sprintf("Migrate CI from %s to %s", from, to), report.Markdown(), paths)
+	if err != nil {
+		term.Printf("Error opening pull request: %v\n", err)
+		exit(1)
+	}
+	term.Printf("\n🚀 Pull request: %s\n", url)
+}
+
+// choose asks the user to pick one of options
+func choose(question string, options []string) string {
+	choice := options[0]
+	opts := make([]huh.Option[string], 0, len(options))
+	for _, o := range options {
+		opts = append(opts, huh.NewOption(o, o))
+	}
+	if err := huh.NewSelect[string]().Title(question).Options(opts...).Value(&choice).Run(); err != nil {
+		term.Println("Aborted")
+		exit(1)
+	}
+	return choice
+}
+
+// handleCacheStatus reports GitHub Actions cache usage, hit ratio and stale keys
+func handleCacheStatus() {
+	repo := ""
+	runs := 10
+	format := "text"
+	for _, arg := range os.Args[3:] {
+		switch {
+		case strings.HasPrefix(arg, "--repo="):
+			repo = strings.TrimPrefix(arg, "--repo=")
+		case strings.HasPrefix(arg, "--runs="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--runs="))
+			if err != nil || n < 0 {
+				term.Println("--runs must be a non-negative number")
+				exit(1)
+			}
+			runs = n
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		}
+	}
+	format = commandFormat(format)
+	if repo == "" {
+		repo = githubRepoFromRemote()
+	}
+	if repo == "" || !strings.Contains(repo, "/") {
+		term.Println("Usage: cicli cache status --repo=owner/name [--runs=N] [--format=json|yaml]")
+		exit(1)
+	}
+
+	var status *cache.Status
+	err := progress.Run("Querying Actions cache for "+repo, func() (err error) {
+		status, err = cache.NewInspector(repo).Status(runs)
+		return err
+	})
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+
+	if format == "json" || format == "yaml" {
+		printEncoded(status, format)
+		return
+	}
+	cache.PrintStatus(status)
+}
+
+// handleExport writes the repository's entry for a service catalog
+func handleExport() {
+	if len(os.Args) < 3 || os.Args[2] != "backstage" {
+		term.Println("Usage: cicli export backstage [path] [--owner=group:name] [--out=catalog-info.yaml] [--stdout|--dry-run]")
+		exit(1)
+	}
+
+	root := "."
+	owner := ""
+	out := ""
+	for _, arg := range os.Args[3:] {
+		switch {
+		case strings.HasPrefix(arg, "--owner="):
+			owner = strings.TrimPrefix(arg, "--owner=")
+		case strings.HasPrefix(arg, "--out="):
+			out = strings.TrimPrefix(arg, "--out=")
+		case !strings.HasPrefix(arg, "-"):
+			root = arg
+		}
+	}
+	setWriteMode(os.Args[3:])
+	if out == "" {
+		out = filepath.Join(root, "catalog-info.yaml")
+	}
+
+	info, err := analyzer.NewAnalyzer(root).Analyze()
+	if err != nil {
+		term.Printf("Error analyzing project: %v\n", err)
+		exit(1)
+	}
+	in := catalog.Input{Info: info, Owner: owner}
+	if cfg, err := config.LoadConfig(filepath.Join(root, "cicli.yaml")); err == nil {
+		in.Config = cfg
+	}
+	remote := exec.Command("git", "remote", "get-url", "origin")
+	remote.Dir = root
+	if url, err := remote.Output(); err == nil {
+		in.Remote = string(url)
+	}
+
+	content, err := catalog.Marshal(catalog.Backstage(in))
+	if err != nil {
+		term.Printf("Error encoding catalog entry: %v\n", err)
+		exit(1)
+	}
+	if err := writeGenerated(out, string(content)); err != nil {
+		term.Printf("Error writing %s: %v\n", out, err)
+		exit(1)
+	}
+	if writeMode == modeWrite && !quiet && owner == "" {
+		fmt.Fprintf(os.Stderr, "💡 Set spec.owner in %s, or rerun with --owner=group:<team>\n", out)
+	}
+}
+
+// githubRepoFromRemote derives owner/name from the origin remote
+func githubRepoFromRemote() string {
+	out, err := exec.Command("git", "remote", "get-url", "origin").Output()
+	if err != nil {
+		return ""
+	}
+	url := strings.TrimSuffix(strings.TrimSpace(string(out)), ".git")
+	for _, prefix := range []string{"https://github.com/", "git@github.com:", "ssh://git@github.com/"} {
+		if strings.HasPrefix(url, prefix) {
+			return strings.TrimPrefix(url, prefix)
+		}
+	}
+	return ""
+}
+
+// reportAnchors warns when a conversion input relies on YAML anchors, since
+// the converted output is written fully expanded
+func reportAnchors(input string) {
+	content, err := os.ReadFile(input)
+	if err != nil {
+		return
+	}
+	report, err := anchors.Scan(content)
+	if err != nil || !report.Uses() {
+		return
+	}
+
+	// Use stderr so --stdout output stays clean
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "ℹ️  %s uses %s; the output is written with them expanded\n", input, report.Summary())
+	}
+	for _, w := range report.Warnings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s:%d: %s\n", input, w.Line, w.Message)
+	}
+}
+
+// reportConversionNotes lists what the conversion dropped or could only
+// approximate, such as manual approval gates
+func reportConversionNotes(input string, findings []converter.Finding) {
+	for _, f := range findings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s: %s\n", input, f)
+	}
+}
+
+// writeConversionReport writes the --report file, as JSON when the path
+// ends in .json and as Markdown otherwise. Without write mode the report
+// goes to stderr, so --stdout output stays clean.
+func writeConversionReport(path string, report *converter.Report) {
+	if writeMode != modeWrite {
+		content, err := report.Render(path)
+		if err != nil {
+			term.Printf("Error rendering report: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprint(os.Stderr, content)
+		return
+	}
+	if err := converter.WriteReport(path, report); err != nil {
+		term.Printf("Error writing report: %v\n", err)
+		exit(1)
+	}
+	counts := report.Counts()
+	term.Printf("📄 Report: %s (%d dropped, %d approximated, %d to review)\n", path, counts[converter.Dropped], counts[converter.Approximated], counts[converter.NeedsReview])
+}
+
+func detectCIFile(platform converter.Platform) string {
+	paths := map[converter.Platform][]string{
+		converter.GitHub:     {".github/workflows/ci.yml", ".github/workflows/main.yml"},
+		converter.GitLab:     {".gitlab-ci.yml"},
+		converter.CircleCI:   {".circleci/config.yml"},
+		converter.Jenkins:    {"Jenkinsfile"},
+		converter.Azure:      {"azure-pipelines.yml"},
+		converter.Bitbucket:  {"bitbucket-pipelines.yml"},
+		converter.Drone:      {".drone.yml", ".drone.yaml"},
+		converter.Woodpecker: {".woodpecker.yml", ".woodpecker.yaml"},
+		converter.Buildkite:  {".buildkite/pipeline.yml", ".buildkite/pipeline.yaml", "buildkite.yml"},
+		converter.TeamCity:   {".teamcity/settings.kts", ".teamcity/project-config.xml"},
+		converter.Bamboo:     {"bamboo-specs/bamboo.yml", "bamboo-specs/bamboo.yaml"},
+		converter.Travis:     {".travis.yml", ".travis.yaml"},
+	}
+
+	if candidates, ok := paths[platform]; ok {
+		for _, path := range candidates {
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+		return ""
+	}
+	// Platforms added by a driver say where their files are
+	if files, err := converter.Discover(".", platform); err == nil && len(files) > 0 {
+		return files[0]
+	}
+	return ""
+}
+
+func getDefaultOutputPath(platform converter.Platform) string {
+	switch platform {
+	case converter.GitHub:
+		return ".github/workflows/ci.yml"
+	case converter.GitLab:
+		return ".gitlab-ci.yml"
+	case converter.CircleCI:
+		return ".circleci/config.yml"
+	case converter.Jenkins:
+		return "Jenkinsfile"
+	case converter.Azure:
+		return "azure-pipelines.yml"
+	case converter.Bitbucket:
+		return "bitbucket-pipelines.yml"
+	case converter.Drone:
+		return ".drone.yml"
+	case converter.Woodpecker:
+		return ".woodpecker.yml"
+	case converter.Buildkite:
+		return ".buildkite/pipeline.yml"
+	case converter.Harness:
+		return ".harness/ci.yaml"
+	case converter.Codefresh:
+		return "codefresh.yml"
+	case converter.Tekton:
+		return ".tekton/ci.yaml"
+	default:
+		if d := converter.LookupDriver(platform); d != nil && d.Capabilities().Output != "" {
+			return d.Capabilities().Output
+		}
+		return "pipeline.yml"
+	}
+}
+
+// handleCache handles dependency cache commands
+func handleCache() {
+	if len(os.Args) > 2 && os.Args[2] == "status" {
+		handleCacheStatus()
+		return
+	}
+	if len(os.Args) < 3 || os.Args[2] != "advise" {
+		term.Println("Usage: cicli cache advise [--platform=github|gitlab|circleci|azure] [--inject[=<workflow>]]")
+		term.Println("       cicli cache status [--repo=owner/name] [--runs=N] [--format=json|yaml]")
+		exit(1)
+	}
+
+	platform := "github"
+	inject := ""
+	for _, arg := range os.Args[3:] {
+		if strings.HasPrefix(arg, "--platform=") {
+			platform = strings.TrimPrefix(arg, "--platform=")
+		} else if arg == "--inject" {
+			inject = "*"
+		} else if strings.HasPrefix(arg, "--inject=") {
+			inject = strings.TrimPrefix(arg, "--inject=")
+		}
+	}
+	setWriteMode(os.Args[3:])
+
+	advice, err := cache.NewAdvisor(".").Advise(platform)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+
+	if inject == "" {
+		cache.PrintReport(advice)
+		if !quiet && len(advice) > 0 && platform == "github" {
+			term.Println("💡 Tip: Run 'cicli cache advise --inject' to add these steps to your workflows")
+		}
+		return
+	}
+
+	if platform != "github" {
+		term.Println("--inject supports GitHub Actions workflows; copy the snippet from 'cicli cache advise' for other platforms")
+		exit(1)
+	}
+
+	files := []string{inject}
+	if inject == "*" {
+		files, _ = converter.Discover(".", converter.GitHub)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			term.Printf("Error: %v\n", err)
+			exit(1)
+		}
+
+		workflow := string(content)
+		total := 0
+		for _, adv := range advice {
+			var n int
+			workflow, n = cache.Inject(workflow, adv)
+			total += n
+		}
+		if total == 0 {
+			term.Printf("Unchanged: %s (caching already configured or no checkout step)\n", file)
+			continue
+		}
+		if err := writeGenerated(file, workflow); err != nil {
+			term.Printf("Error writing %s: %v\n", file, err)
+			exit(1)
+		}
+	}
+}
+
+// handleImages checks the base images of Dockerfiles and CI files for
+// end-of-life versions and newer patch releases, and optionally updates
+// them and opens a pull request
+func handleImages() {
+	root := "."
+	format := "text"
+	offline, apply, openPR := false, false, false
+	for _, arg := range os.Args[2:] {
+		switch {
+		case arg == "--offline":
+			offline = true
+		case arg == "--apply":
+			apply = true
+		case arg == "--pr":
+			apply, openPR = true, true
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case !strings.HasPrefix(arg, "-"):
+			root = arg
+		}
+	}
+	setWriteMode(os.Args[2:])
+	format = commandFormat(format)
+
+	refs, err := baseimages.Find(root)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+	var findings []baseimages.Finding
+	var lookupErrs []error
+	err = progress.Run(fmt.Sprintf("Checking %d images", len(refs)), func() error {
+		findings, lookupErrs = baseimages.NewChecker().Check(refs, offline)
+		return nil
+	})
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+	for _, e := range lookupErrs {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not list tags of %v\n", e)
+	}
+
+	if format == "json" || format == "yaml" {
+		if findings == nil {
+			findings = []baseimages.Finding{}
+		}
+		printEncoded(findings, format)
+	} else {
+		baseimages.PrintReport(findings)
+	}
+	if len(findings) == 0 {
+		return
+	}
+	if !apply {
+		if !quiet && format == "text" {
+			term.Println("💡 Tip: Run 'cicli images --apply' to update them, or --pr to open a pull request")
+		}
+		exit(1)
+	}
+
+	updated, err := baseimages.Apply(findings)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+	paths := make([]string, 0, len(updated))
+	for path := range updated {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	force = true
+	for _, path := range paths {
+		if err := writeGenerated(path, updated[path]); err != nil {
+			term.Printf("Error writing %s: %v\n", path, err)
+			exit(1)
+		}
+	}
+	if !openPR || writeMode != modeWrite {
+		return
+	}
+
+	url, err := migrate.OpenPR("cicli/base-images", "Update base images", baseimages.Markdown(findings), paths)
+	if err != nil {
+		term.Printf("Error opening pull request: %v\n", err)
+		exit(1)
+	}
+	term.Printf("\n🚀 Pull request: %s\n", url)
+}
+
+// fixInlineScripts extracts oversized run: blocks flagged by BP004 into
+// script files and returns the workflow content without them
+func fixInlineScripts(result *linter.LintResult, content []byte) ([]byte, bool) {
+	if !lintFixable(result, "BP004") {
+		return content, false
+	}
+
+	updated, scripts, err := linter.FixInlineScripts(result.File, content)
+	if err != nil {
+		term.Printf("Error fixing %s: %v\n", result.File, err)
+		exit(1)
+	}
+
+	for _, script := range scripts {
+		if existing, err := os.ReadFile(script.Path); err == nil && string(existing) != script.Content {
+			term.Printf("Skipping %s: %s already exists with different content\n", result.File, script.Path)
+			return content, false
+		}
+	}
+	for _, script := range scripts {
+		if err := os.MkdirAll(filepath.Dir(script.Path), 0755); err != nil {
+			term.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		if err := os.WriteFile(script.Path, []byte(script.Content), 0755); err != nil {
+			term.Printf("Error writing %s: %v\n", script.Path, err)
+			exit(1)
+		}
+		term.Printf("✅ Extracted: %s\n", script.Path)
+	}
+	return updated, true
+}
+
+// applyLintFix rewrites workflow content with fix when lint flagged rule
+// as auto-fixable, and reports whether it changed
+func applyLintFix(result *linter.LintResult, rule string, content []byte, fix func(file string, content []byte) ([]byte, bool)) ([]byte, bool) {
+	if !lintFixable(result, rule) {
+		return content, false
+	}
+	return fix(result.File, content)
+}
+
+// lintFixable reports whether lint flagged rule as auto-fixable in result
+func lintFixable(result *linter.LintResult, rule string) bool {
+	for _, issue := range result.Issues {
+		if issue.Rule == rule && issue.AutoFixable {
+			return true
+		}
+	}
+	return false
+}
+
+// fixLintResult applies every auto-fix to a linted file in memory and
+// writes the result once, so its .bak keeps the original. It reports
+// whether the file changed.
+func fixLintResult(result *linter.LintResult) bool {
+	original, err := os.ReadFile(result.File)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+	content, _ := fixInlineScripts(result, original)
+	fixes := []struct {
+		rule string
+		fix  func(file string, content []byte) ([]byte, bool)
+	}{
+		{"BP002", func(_ string, content []byte) ([]byte, bool) { return linter.FixConcurrency(content) }},
+		{"BP001", linter.FixTimeouts},
+		{"BP003", func(_ string, content []byte) ([]byte, bool) { return linter.FixOutdatedActions(content) }},
+		{"BP005", func(_ string, content []byte) ([]byte, bool) { return linter.FixDockerBuilds(content) }},
+	}
+	for _, f := range fixes {
+		if updated, changed := applyLintFix(result, f.rule, content, f.fix); changed {
+			content = updated
+		}
+	}
+	if string(content) == string(original) {
+		return false
+	}
+
+	// The user asked for the fix, so overwrite without prompting (a .bak is kept)
+	force = true
+	if err := writeGenerated(result.File, string(content)); err != nil {
+		term.Printf("Error writing %s: %v\n", result.File, err)
+		exit(1)
+	}
+	return true
+}
+
+// handleLint lints CI/CD configurations
+func handleLint() {
+	path := "."
+	format := "text"
+	fix := false
+	external := false
+	for _, arg := range os.Args[2:] {
+		if strings.HasPrefix(arg, "--format=") {
+			format = strings.TrimPrefix(arg, "--format=")
+		} else if arg == "--fix" {
+			fix = true
+		} else if arg == "--external" {
+			external = true
+		} else if arg == "--public" {
+			linter.PublicRepository = true
+		} else if strings.HasPrefix(arg, "--rule-profile=") {
+			if err := linter.SetProfile(strings.TrimPrefix(arg, "--rule-profile=")); err != nil {
+				term.Println(err)
+				exit(1)
+			}
+		} else if strings.HasPrefix(arg, "--max-script-lines=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-script-lines="))
+			if err != nil || n < 1 {
+				term.Println("--max-script-lines must be a positive number")
+				exit(1)
+			}
+			linter.MaxInlineScriptLines = n
+		} else if !strings.HasPrefix(arg, "-") {
+			path = arg
+		}
+	}
+
+	format = commandFormat(format)
+	if format != "text" && format != "json" && format != "yaml" && format != "sarif" {
+		term.Printf("Unknown format: %s (supported: text, json, yaml, sarif)\n", format)
+		exit(1)
+	}
+
+	l := linter.NewLinter()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+
+	var results []*linter.LintResult
+	if info.IsDir() {
+		results, err = l.LintDirectory(path)
+		if err != nil {
+			term.Printf("Error linting directory: %v\n", err)
+			exit(1)
+		}
+
+		if len(results) == 0 && format == "text" {
+			term.Println("No CI/CD configuration files found")
+			exit(0)
+		}
+	} else {
+		result, err := l.Lint(path)
+		if err != nil {
+			term.Printf("Error linting file: %v\n", err)
+			exit(1)
+		}
+		results = append(results, result)
+	}
+
+	if fix {
+		// Diffs and status lines would corrupt machine-readable output
+		if format != "text" {
+			term.Output = os.Stderr
+		}
+		for i, result := range results {
+			if fixLintResult(result) {
+				if fixed, err := l.Lint(result.File); err == nil {
+					results[i] = fixed
+				}
+			}
+		}
+		term.Output = os.Stdout
+	}
+
+	if external {
+		ran, err := l.External(results)
+		if err != nil {
+			term.Printf("Error running external linters: %v\n", err)
+			exit(1)
+		}
+		if len(ran) == 0 {
+			fmt.Fprintf(os.Stderr, "--external: none of %s is on PATH\n", strings.Join(linter.ExternalTools, ", "))
+		}
+	}
+
+	totalIssues := 0
+	for _, result := range results {
+		totalIssues += len(result.Issues)
+	}
+
+	if format == "json" || format == "yaml" {
+		if results == nil {
+			results = []*linter.LintResult{}
+		}
+		printEncoded(results, format)
+	} else if format == "sarif" {
+		data, err := l.SARIF(results, version)
+		if err != nil {
+			term.Printf("Error encoding results: %v\n", err)
+			exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, result := range results {
+			result.PrintReport()
+		}
+	}
+
+	if totalIssues > 0 {
+		exit(1)
+	}
+}
+
+// handleOptimize analyzes and suggests optimizations
+func handleOptimize() {
+	path := "."
+	opts := optimizeOptions{Runs: 1, Format: commandFormat("text")}
+	runnerName := "local"
+	event := "push"
+
+	for _, arg := range os.Args[2:] {
+		if arg == "--apply" {
+			opts.Apply = true
+		} else if arg == "--benchmark" {
+			opts.Benchmark = true
+		} else if strings.HasPrefix(arg, "--runner=") {
+			runnerName = strings.TrimPrefix(arg, "--runner=")
+		} else if strings.HasPrefix(arg, "--runs=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--runs="))
+			if err != nil || n < 1 {
+				term.Println("--runs must be a positive number")
+				exit(1)
+			}
+			opts.Runs = n
+		} else if strings.HasPrefix(arg, "--event=") {
+			event = strings.TrimPrefix(arg, "--event=")
+		} else if !strings.HasPrefix(arg, "-") {
+			path = arg
+		}
+	}
+
+	if opts.Benchmark {
+		switch runnerName {
+		case "local":
+			dir := "."
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				dir = path
+			}
+			opts.Runner = optimizer.LocalRunner{Event: event, Dir: dir}
+		case "github":
+			repo := githubRepoFromRemote()
+			if repo == "" {
+				term.Println("--runner=github needs an origin remote on github.com")
+				exit(1)
+			}
+			opts.Runner = github.WorkflowRunner{Client: github.NewClient(repo), Remote: "origin"}
+		default:
+			term.Printf("Unknown runner: %s (supported: local, github)\n", runnerName)
+			exit(1)
+		}
+	}
+
+	o := optimizer.NewOptimizer()
+
+	// Check if path is a file or directory
+	info, err := os.Stat(path)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+
+	if info.IsDir() {
+		// Find CI files in directory
+		patterns := []string{
+			".github/workflows/*.yml",
+			".github/workflows/*.yaml",
+			".gitlab-ci.yml",
+			".circleci/config.yml",
+		}
+
+		results := []*optimizer.OptimizationResult{}
+		for _, pattern := range patterns {
+			matches, _ := filepath.Glob(filepath.Join(path, pattern))
+			for _, match := range matches {
+				if result := analyzeAndOptimize(o, match, opts); result != nil {
+					results = append(results, result)
+				}
+			}
+		}
+
+		if opts.Format != "text" {
+			printEncoded(results, opts.Format)
+		} else if len(results) == 0 {
+			term.Println("No CI/CD configuration files found")
+		}
+	} else if result := analyzeAndOptimize(o, path, opts); result != nil && opts.Format != "text" {
+		printEncoded(result, opts.Format)
+	}
+}
+
+// optimizeOptions are the flags of cicli optimize
+type optimizeOptions struct {
+	Apply     bool
+	Benchmark bool
+	Runner    optimizer.Runner
+	Runs      int
+	Format    string // text, json or yaml
+}
+
+// analyzeAndOptimize reports the optimizations for one file, benchmarking
+// and applying them when asked. With a json or yaml format nothing is
+// printed to stdout; the caller encodes the returned result.
+func analyzeAndOptimize(o *optimizer.Optimizer, path string, opts optimizeOptions) *optimizer.OptimizationResult {
+	text := opts.Format == "text"
+	result, err := o.Analyze(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error analyzing %s: %v\n", path, err)
+		return nil
+	}
+
+	if text {
+		result.PrintReport()
+	}
+
+	// Benchmark before applying, while the file still holds the original
+	if opts.Benchmark {
+		bench, err := o.Benchmark(path, result, opts.Runner, opts.Runs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Benchmark skipped: %v\n", err)
+		} else if text {
+			bench.PrintReport()
+		}
+		result.Benchmark = bench
+	}
+
+	if opts.Apply && len(result.Optimizations) > 0 {
+		if text {
+			term.Println("\n🔧 Applying auto-fixable optimizations...")
+		}
+		applied, err := o.Apply(path, result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error applying optimizations: %v\n", err)
+		}
+		if text {
+			for _, title := range applied {
+				term.Printf("   ✅ Applied: %s\n", title)
+			}
+		}
+	}
+	return result
+}
+
+// handleDocker handles docker commands
+func handleDocker() {
+	if len(os.Args) < 3 {
+		term.Println("Usage: cicli docker publish [flags]")
+		exit(1)
+	}
+
+	subCmd := os.Args[2]
+	if subCmd != "publish" {
+		term.Printf("Unknown docker command: %s\n", subCmd)
+		exit(1)
+	}
+
+	cfg, err := config.LoadConfig("cicli.yaml")
+	if err != nil {
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
+	}
+
+	tag := "latest"
+	useGitSha := false
+	serviceName := ""
+	for _, arg := range os.Args[3:] {
+		if arg == "--use-git-sha" {
+			useGitSha = true
+		} else if strings.HasPrefix(arg, "--tag=") {
+			tag = strings.TrimPrefix(arg, "--tag=")
+		} else if strings.HasPrefix(arg, "--service=") {
+			serviceName = strings.TrimPrefix(arg, "--service=")
+		} else if strings.HasPrefix(arg, "--registry=") {
+			cfg.UseRegistry(strings.TrimPrefix(arg, "--registry="))
+		}
+	}
+
+	imageName, buildContext, dockerfile := cfg.Docker.ImageName, cfg.Docker.Context, cfg.Docker.Dockerfile
+	if serviceName != "" {
+		svc, err := cfg.ServiceNamed(serviceName)
+		if err != nil {
+			term.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		imageName, buildContext, dockerfile = svc.Image, svc.Path, svc.Dockerfile
+	}
+
+	if err := validator.CheckDocker(); err != nil {
+		term.Printf("Pre-flight check failed: %v\n", err)
+		exit(1)
+	}
+
+	d := docker.NewClient()
+
+	if useGitSha {
+		sha, err := d.GetGitSHA()
+		if err != nil {
+			term.Printf("Error getting git SHA: %v\n", err)
+			exit(1)
+		}
+		tag = sha
+	}
+
+	fullImageName := fmt.Sprintf("%s:%s", imageName, tag)
+
+	if err := d.Build(fullImageName, buildContext, dockerfile); err != nil {
+		term.Printf("Error building image: %v\n", err)
+		exit(1)
+	}
+
+	if err := d.Push(fullImageName); err != nil {
+		term.Printf("Error pushing image: %v\n", err)
+		exit(1)
+	}
+}
+
+// handleDeploy handles deployment
+func handleDeploy() {
+	if err := validator.CheckKubectl(); err != nil {
+		term.Printf("Pre-flight check failed: %v\n", err)
+		exit(1)
+	}
+
+	cfg, err := config.LoadConfig("cicli.yaml")
+	if err != nil {
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
+	}
+
+	env := "dev"
+	tag := "latest"
+	clusterName := ""
+	parallel := false
+	forceUnlock := false
+	override := ""
+	serviceName := ""
+	all := false
+	for _, arg := range os.Args[2:] {
+		if strings.HasPrefix(arg, "--env=") {
+			env = strings.TrimPrefix(arg, "--env=")
+		} else if strings.HasPrefix(arg, "--tag=") {
+			tag = strings.TrimPrefix(arg, "--tag=")
+		} else if strings.HasPrefix(arg, "--service=") {
+			serviceName = strings.TrimPrefix(arg, "--service=")
+		} else if strings.HasPrefix(arg, "--registry=") {
+			cfg.UseRegistry(strings.TrimPrefix(arg, "--registry="))
+		} else if arg == "--all" {
+			all = true
+		} else if strings.HasPrefix(arg, "--cluster=") {
+			clusterName = strings.TrimPrefix(arg, "--cluster=")
+		} else if arg == "--parallel" {
+			parallel = true
+		} else if arg == "--force-unlock" {
+			forceUnlock = true
+		} else if strings.HasPrefix(arg, "--override=") {
+			override = strings.TrimPrefix(arg, "--override=")
+		} else if arg == "--override" {
+			term.Println("--override requires a reason, e.g. --override=\"hotfix for INC-123\"")
+			exit(1)
+		}
+	}
+
+	// The checkout being deployed is what the image was built from
+	commit, _ := docker.NewClient().GetGitSHA()
+	opts := deployOptions{
+		Cluster:     clusterName,
+		Parallel:    parallel,
+		ForceUnlock: forceUnlock,
+		Override:    override,
+		Commit:      commit,
+	}
+
+	if all {
+		if serviceName != "" {
+			term.Println("--all and --service= cannot be combined")
+			exit(1)
+		}
+		deployAll(cfg, env, tag, opts)
+		return
+	}
+
+	imageName := cfg.Docker.ImageName
+	if serviceName != "" {
+		opts.Service, err = cfg.ServiceNamed(serviceName)
+		if err != nil {
+			term.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		imageName = opts.Service.Image
+	}
+
+	deployImage(cfg, env, fmt.Sprintf("%s:%s", imageName, tag), opts)
+}
+
+// deployAll deploys every configured service to env after the services it
+// depends on. A failed service skips its dependents but not unrelated services,
+// and the outcome is sent as a single notification.
+func deployAll(cfg *config.Config, env, tag string, opts deployOptions) {
+	if len(cfg.Services) == 0 {
+		term.Println("deploy --all needs a services: list in cicli.yaml")
+		exit(1)
+	}
+	order, err := cfg.ServiceOrder()
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+
+	term.Printf("📦 Deploying %d services to %s: %s\n", len(order), env, strings.Join(order, " → "))
+
+	errs := make(map[string]error, len(order))
+	blockedBy := make(map[string][]string)
+	for _, name := range order {
+		svc, err := cfg.ServiceNamed(name)
+		if err != nil {
+			term.Printf("Error: %v\n", err)
+			errs[name] = err
+			continue
+		}
+
+		for _, dep := range svc.DependsOn {
+			if errs[dep] != nil || len(blockedBy[dep]) > 0 {
+				blockedBy[name] = append(blockedBy[name], dep)
+			}
+		}
+		if len(blockedBy[name]) > 0 {
+			continue
+		}
+
+		term.Printf("\n🚀 Deploying service %s\n", name)
+		svcOpts := opts
+		svcOpts.Service = svc
+		errs[name] = rollOut(cfg, env, fmt.Sprintf("%s:%s", svc.Image, tag), svcOpts)
+	}
+
+	term.Printf("\nService summary (Env: %s, Tag: %s):\n", env, tag)
+	var lines []string
+	failed, skipped := 0, 0
+	for _, name := range order {
+		switch {
+		case errs[name] != nil:
+			failed++
+			term.Printf("   ❌ %-20s %v\n", name, errs[name])
+			lines = append(lines, fmt.Sprintf("%s failed: %v", name, errs[name]))
+		case len(blockedBy[name]) > 0:
+			skipped++
+			reason := fmt.Sprintf("skipped, %s did not deploy", strings.Join(blockedBy[name], ", "))
+			term.Printf("   ⏭️ %-20s %s\n", name, reason)
+			lines = append(lines, fmt.Sprintf("%s %s", name, reason))
+		default:
+			term.Printf("   ✅ %-20s deployed\n", name)
+			lines = append(lines, name+" deployed")
+		}
+	}
+
+	status := "success"
+	if failed+skipped == len(order) {
+		status = "failed"
+	} else if failed+skipped > 0 {
+		status = "partial"
+	}
+	if cfg.Notifications.WebhookURL != "" {
+		message := fmt.Sprintf("Deploy of %s to %s (%s): %s", cfg.ProjectName, env, tag, strings.Join(lines, "; "))
+		if err := notify.NewNotifier().SendMessage(cfg.Notifications.WebhookURL, cfg.ProjectName, status, message); err != nil {
+			term.Printf("Warning: %v\n", err)
+		}
+	}
+
+	if failed+skipped > 0 {
+		term.Printf("\n%d failed, %d skipped of %d services\n", failed, skipped, len(order))
+		exit(1)
+	}
+}
+
+// deployOptions are the flags shared by deploy and promote
+type deployOptions struct {
+	Cluster      string
+	Parallel     bool
+	ForceUnlock  bool
+	Override     string
+	PromotedFrom string
+	Commit       string
+	Service      *config.Service // nil deploys the top-level docker/deploy settings
+	SkipHistory  bool            // the caller records the deploy in history itself
+}
+
+// deployImage rolls fullImageName out to every selected cluster of env,
+// honouring deploy freezes, and exits on failure
+func deployImage(cfg *config.Config, env, fullImageName string, opts deployOptions) {
+	if err := rollOut(cfg, env, fullImageName, opts); err != nil {
+		exit(1)
+	}
+}
+
+// rollOut does the work of deployImage, printing failures as they happen and
+// returning them so that multi-service deploys can carry on with other services
+func rollOut(cfg *config.Config, env, fullImageName string, opts deployOptions) error {
+	override := opts.Override
+	checker := freeze.NewChecker()
+	frozen, err := checker.Check(cfg.Freeze, env, time.Now())
+	if err != nil {
+		term.Printf("Error checking deploy freeze: %v\n", err)
+		return err
+	}
+	if frozen.Frozen {
+		if override == "" {
+			term.Printf("🧊 Deploys to %s are frozen: %s\n", env, frozen.Reason)
+			term.Println("Use --override=<reason> to deploy anyway; the reason is recorded in history.")
+			return fmt.Errorf("deploys to %s are frozen: %s", env, frozen.Reason)
+		}
+		term.Printf("⚠️  Overriding deploy freeze (%s): %s\n", frozen.Reason, override)
+	} else {
+		override = ""
+	}
+
+	clusters, err := selectClusters(cfg, env, opts.Cluster)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		return err
+	}
+
+	appName := cfg.ProjectName
+	manifestPath := cfg.Deploy.ManifestPath
+	lockName := appName
+	serviceName := ""
+	if opts.Service != nil {
+		manifestPath = opts.Service.Manifest
+		lockName = opts.Service.Name
+		serviceName = opts.Service.Name
+	}
+
+	if len(clusters) == 1 {
+		dep := deploy.NewDeployer()
+		dep.LockMode = cfg.Deploy.Lock
+		dep.OverrideReason = override
+		dep.PromotedFrom = opts.PromotedFrom
+		dep.Commit = opts.Commit
+		dep.Service = serviceName
+		dep.SkipHistory = opts.SkipHistory
+
+		if err := configureCluster(dep, clusters[0]); err != nil {
+			term.Printf("Error configuring cluster: %v\n", err)
+			return err
+		}
+
+		if opts.ForceUnlock {
+			if err := dep.ForceUnlock(lockName, env); err != nil {
+				term.Printf("Error unlocking: %v\n", err)
+				return err
+			}
+		}
+
+		if err := dep.DeployToK8s(manifestPath, fullImageName, appName, env); err != nil {
+			term.Printf("Error deploying: %v\n", err)
+			return err
+		}
+		return nil
+	}
+
+	// Credentials are fetched one at a time since each provider CLI rewrites the kubeconfig
+	deployers := make([]*deploy.Deployer, len(clusters))
+	errs := make([]error, len(clusters))
+	for i, cluster := range clusters {
+		deployers[i] = deploy.NewDeployer()
+		deployers[i].LockMode = cfg.Deploy.Lock
+		deployers[i].OverrideReason = override
+		deployers[i].PromotedFrom = opts.PromotedFrom
+		deployers[i].Commit = opts.Commit
+		deployers[i].Service = serviceName
+		deployers[i].SkipHistory = opts.SkipHistory
+		errs[i] = configureCluster(deployers[i], cluster)
+		if errs[i] == nil && opts.ForceUnlock {
+			errs[i] = deployers[i].ForceUnlock(lockName, env)
+		}
+	}
+
+	run := func(i int) {
+		if errs[i] != nil {
+			return
+		}
+		term.Printf("\n🚀 Deploying to cluster %s\n", clusters[i].Name)
+		errs[i] = deployers[i].DeployToK8s(manifestPath, fullImageName, appName, env)
+	}
+
+	if opts.Parallel {
+		var wg sync.WaitGroup
+		for i := range clusters {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range clusters {
+			run(i)
+		}
+	}
+
+	term.Printf("\nDeployment summary (Env: %s, Image: %s):\n", env, fullImageName)
+	failed := 0
+	for i, cluster := range clusters {
+		if errs[i] != nil {
+			failed++
+			term.Printf("   ❌ %-20s %v\n", cluster.Name, errs[i])
+		} else {
+			term.Printf("   ✅ %-20s deployed\n", cluster.Name)
+		}
+	}
+
+	if failed > 0 {
+		term.Printf("\n%d of %d clusters failed\n", failed, len(clusters))
+		return fmt.Errorf("%d of %d clusters failed", failed, len(clusters))
+	}
+	return nil
+}
+
+// handlePromote deploys the image running in one environment to another
+// without rebuilding it, pinned to its digest
+func handlePromote() {
+	if err := validator.CheckKubectl(); err != nil {
+		term.Printf("Pre-flight check failed: %v\n", err)
+		exit(1)
+	}
+
+	cfg, err := config.LoadConfig("cicli.yaml")
+	if err != nil {
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
+	}
+
+	from, to := "", ""
+	releaseNotes := true
+	opts := deployOptions{}
+	for _, arg := range os.Args[2:] {
+		if strings.HasPrefix(arg, "--from=") {
+			from = strings.TrimPrefix(arg, "--from=")
+		} else if strings.HasPrefix(arg, "--to=") {
+			to = strings.TrimPrefix(arg, "--to=")
+		} else if strings.HasPrefix(arg, "--cluster=") {
+			opts.Cluster = strings.TrimPrefix(arg, "--cluster=")
+		} else if arg == "--parallel" {
+			opts.Parallel = true
+		} else if arg == "--force-unlock" {
+			opts.ForceUnlock = true
+		} else if strings.HasPrefix(arg, "--override=") {
+			opts.Override = strings.TrimPrefix(arg, "--override=")
+		} else if arg == "--no-release-notes" {
+			releaseNotes = false
+		}
+	}
+	if from == "" || to == "" || from == to {
+		term.Println("Usage: cicli promote --from=<env> --to=<env> [--cluster=<name>] [--parallel]")
+		exit(1)
+	}
+
+	image, commit := promotedImage(cfg, from)
+	term.Printf("📦 Promoting %s → %s\n", from, to)
+	term.Printf("   Image: %s\n", image)
+	if commit != "" {
+		term.Printf("   Commit: %s\n", commit)
+	}
+	term.Println()
+	if term.IsTerminal(os.Stdin) && !confirm(fmt.Sprintf("Deploy this image to %s?", to)) {
+		term.Println("Promotion cancelled.")
+		return
+	}
+
+	// Look up the previous release before deploying records the new one
+	var previous string
+	if last, err := deploy.LastSuccessful(cfg.ProjectName, to, ""); err == nil && last != nil {
+		previous = last.Commit
+	}
+
+	opts.PromotedFrom = from
+	opts.Commit = commit
+	deployImage(cfg, to, image, opts)
+
+	if releaseNotes && releaseEnv(cfg, to) {
+		publishReleaseNotes(cfg, to, image, previous, commit)
+	}
+}
+
+// shipStages are the stages of cicli ship, in the order they run
+var shipStages = []string{"build", "scan", "push", "deploy", "verify", "notify"}
+
+// handleShip builds, scans and pushes an image, then deploys it to an
+// environment, checks it is running and sends a notification. The image is
+// deployed by digest, so every stage acts on the exact image that was
+// scanned. The run is one entry in history, updated after each stage, so a
+// failed run can be resumed with --from=<stage>.
+func handleShip() {
+	env, tag, from := "dev", "", ""
+	opts := deployOptions{SkipHistory: true}
+	for _, arg := range os.Args[2:] {
+		if strings.HasPrefix(arg, "--env=") {
+			env = strings.TrimPrefix(arg, "--env=")
+		} else if strings.HasPrefix(arg, "--tag=") {
+			tag = strings.TrimPrefix(arg, "--tag=")
+		} else if strings.HasPrefix(arg, "--from=") {
+			from = strings.TrimPrefix(arg, "--from=")
+		} else if strings.HasPrefix(arg, "--cluster=") {
+			opts.Cluster = strings.TrimPrefix(arg, "--cluster=")
+		} else if arg == "--parallel" {
+			opts.Parallel = true
+		} else if arg == "--force-unlock" {
+			opts.ForceUnlock = true
+		} else if strings.HasPrefix(arg, "--override=") {
+			opts.Override = strings.TrimPrefix(arg, "--override=")
+		}
+	}
+	start := 0
+	if from != "" {
+		start = shipStage(from)
+		if start < 0 {
+			term.Printf("Unknown stage: %s (stages: %s)\n", from, strings.Join(shipStages, ", "))
+			exit(1)
+		}
+	}
+
+	cfg, err := config.LoadConfig("cicli.yaml")
+	if err != nil {
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
+	}
+	if start < shipStage("deploy") {
+		if err := validator.CheckDocker(); err != nil {
+			term.Printf("Pre-flight check failed: %v\n", err)
+			exit(1)
+		}
+	}
+	if start <= shipStage("verify") {
+		if err := validator.CheckKubectl(); err != nil {
+			term.Printf("Pre-flight check failed: %v\n", err)
+			exit(1)
+		}
+	}
+	s, err := store.NewStore()
+	if err != nil {
+		term.Printf("Error opening store: %v\n", err)
+		exit(1)
+	}
+
+	d := docker.NewClient()
+	commit, _ := d.GetGitSHA()
+	run := store.Deployment{
+		ID:        fmt.Sprintf("%d", time.Now().Unix()),
+		Timestamp: time.Now(),
+		Project:   cfg.ProjectName,
+		Env:       env,
+		Commit:    commit,
+		Override:  opts.Override,
+	}
+	if start > 0 {
+		// Carry on with the image of the run that stopped
+		previous, err := lastShipRun(s, cfg.ProjectName, env)
+		if err != nil {
+			term.Printf("Error reading history: %v\n", err)
+			exit(1)
+		}
+		if previous == nil {
+			term.Printf("No earlier ship run to %s to resume; run cicli ship --env=%s first\n", env, env)
+			exit(1)
+		}
+		for _, stage := range previous.Stages[:min(start, len(previous.Stages))] {
+			if stage.Status == "failed" {
+				term.Printf("The last ship run to %s failed at %s; resume with --from=%s\n", env, stage.Name, stage.Name)
+				exit(1)
+			}
+		}
+		if len(previous.Stages) < start {
+			term.Printf("The last ship run to %s stopped before %s; resume with --from=%s\n", env, from, shipStages[len(previous.Stages)])
+			exit(1)
+		}
+		run = *previous
+		run.Stages = run.Stages[:start]
+		if opts.Override != "" {
+			run.Override = opts.Override
+		}
+		term.Printf("🔁 Resuming ship run %s at %s\n", run.ID, from)
+	} else {
+		if tag == "" {
+			tag = commit
+		}
+		if tag == "" {
+			term.Println("Cannot tag the image from git; pass --tag=<tag>")
+			exit(1)
+		}
+		run.Tag = tag
+		run.Image = fmt.Sprintf("%s:%s", cfg.Docker.ImageName, tag)
+	}
+	tagged := fmt.Sprintf("%s:%s", cfg.Docker.ImageName, run.Tag)
+
+	term.Printf("🚢 Shipping %s to %s: %s\n", cfg.ProjectName, env, strings.Join(shipStages[start:], " → "))
+	stages := map[string]func() (string, error){
+		"build": func() (string, error) {
+			return "success", d.Build(tagged, cfg.Docker.Context, cfg.Docker.Dockerfile)
+		},
+		"scan": func() (string, error) {
+			scanned, err := d.Scan(tagged)
+			if !scanned {
+				term.Println("⚠️  Neither trivy nor grype is installed; skipping the vulnerability scan")
+				return "skipped", nil
+			}
+			return "success", err
+		},
+		"push": func() (string, error) {
+			if err := d.Push(tagged); err != nil {
+				return "", err
+			}
+			digest, err := d.Digest(tagged)
+			if err != nil {
+				return "", err
+			}
+			run.Image = digest
+			term.Printf("   Image: %s\n", digest)
+			return "success", nil
+		},
+		"deploy": func() (string, error) {
+			opts.Commit = run.Commit
+			return "success", rollOut(cfg, env, run.Image, opts)
+		},
+		"verify": func() (string, error) {
+			return "success", verifyShipped(cfg, env, run.Image, opts.Cluster)
+		},
+		"notify": func() (string, error) {
+			if cfg.Notifications.WebhookURL == "" {
+				return "skipped", nil
+			}
+			return "success", notify.NewNotifier().Send(cfg.Notifications.WebhookURL, cfg.ProjectName, "success", env, run.Image)
+		},
+	}
+
+	for _, name := range shipStages[start:] {
+		term.Printf("\n▶ %s\n", name)
+		status, err := stages[name]()
+		stage := store.Stage{Name: name, Status: status}
+		run.Status = "running"
+		if err != nil {
+			stage.Status, stage.Error = "failed", err.Error()
+			run.Status = "failed"
+		}
+		run.Stages = append(run.Stages, stage)
+		if name == shipStages[len(shipStages)-1] && err == nil {
+			run.Status = "success"
+		}
+		if err := s.Put(run); err != nil {
+			term.Printf("Warning: could not record the run in history: %v\n", err)
+		}
+
+		if err != nil {
+			term.Printf("\n❌ %s failed: %v\n", name, err)
+			if name != "notify" && cfg.Notifications.WebhookURL != "" {
+				message := fmt.Sprintf("Ship of %s to %s (%s) failed at %s: %v", cfg.ProjectName, env, run.Tag, name, err)
+				if err := notify.NewNotifier().SendMessage(cfg.Notifications.WebhookURL, cfg.ProjectName, "failed", message); err != nil {
+					term.Printf("Warning: %v\n", err)
+				}
+			}
+			term.Printf("Fix the problem and resume with: cicli ship --env=%s --from=%s\n", env, name)
+			exit(1)
+		}
+	}
+	term.Printf("\n✅ Shipped %s to %s\n", run.Image, env)
+}
+
+// shipStage returns the position of the named stage in shipStages, or -1
+func shipStage(name string) int {
+	for i, stage := range shipStages {
+		if stage == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastShipRun returns the latest cicli ship run of the project to env
+// recorded in history, or nil when there is none
+func lastShipRun(s *store.Store, project, env string) (*store.Deployment, error) {
+	deployments, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(deployments) - 1; i >= 0; i-- {
+		d := deployments[i]
+		if d.Project == project && d.Env == env && len(d.Stages) > 0 {
+			return &d, nil
+		}
+	}
+	return nil, nil
+}
+
+// verifyShipped checks that every cluster of env runs image, and that the
+// environment's URL answers when one is configured
+func verifyShipped(cfg *config.Config, env, image, clusterName string) error {
+	clusters, err := selectClusters(cfg, env, clusterName)
+	if err != nil {
+		return err
+	}
+	for _, cluster := range clusters {
+		dep := deploy.NewDeployer()
+		if err := configureCluster(dep, cluster); err != nil {
+			return err
+		}
+		running, err := dep.RunningImage(cfg.ProjectName)
+		if err != nil {
+			return err
+		}
+		if running != image {
+			return fmt.Errorf("%s runs %s, not %s", clusterLabel(cluster, env), running, image)
+		}
+		term.Printf("   ✅ %s runs the shipped image\n", clusterLabel(cluster, env))
+	}
+
+	url := cfg.Environments[env].URL
+	if url == "" {
+		return nil
+	}
+	resp, err := httpclient.New(30 * time.Second).Get(url)
+	if err != nil {
+		return fmt.Errorf("%s did not answer: %w", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	term.Printf("   ✅ %s answered %s\n", url, resp.Status)
+	return nil
+}
+
+// clusterLabel names a cluster in messages, falling back to the env for
+// the unnamed default cluster
+func clusterLabel(cluster config.Cluster, env string) string {
+	if cluster.Name != "" {
+		return "cluster " + cluster.Name
+	}
+	return env
+}
+
+// failedStage returns the stage a ship run failed at, or ""
+func failedStage(stages []store.Stage) string {
+	for _, stage := range stages {
+		if stage.Status == "failed" {
+			return stage.Name
+		}
+	}
+	return ""
+}
+
+// releaseEnv reports whether promotions to env publish release notes
+func releaseEnv(cfg *config.Config, env string) bool {
+	envs := cfg.Release.Envs
+	if len(envs) == 0 {
+		envs = []string{"prod"}
+	}
+	for _, e := range envs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// publishReleaseNotes compiles the commits since the previous release and
+// posts them as a GitHub Release and/or a notification. The deploy has
+// already succeeded, so failures here are only reported.
+func publishReleaseNotes(cfg *config.Config, env, image, from, to string) {
+	notes, err := release.Compile(cfg.ProjectName, env, image, from, to)
+	if err != nil {
+		term.Printf("⚠️  Skipping release notes: %v\n", err)
+		return
+	}
+	term.Printf("\n📝 Release notes: %d commit(s) since the previous %s release\n", len(notes.Commits), env)
+
+	targets := cfg.Release.Publish
+	if len(targets) == 0 {
+		targets = []string{"github", "notify"}
+	}
+	for _, target := range targets {
+		switch target {
+		case "github":
+			repo := githubRepoFromRemote()
+			if repo == "" {
+				term.Println("⚠️  Skipping GitHub Release: origin is not a GitHub repository")
+				continue
+			}
+			url, err := release.PublishGitHub(repo, notes)
+			if err != nil {
+				term.Printf("⚠️  GitHub Release failed: %v\n", err)
+				continue
+			}
+			term.Printf("   ✅ GitHub Release: %s\n", url)
+		case "notify":
+			if cfg.Notifications.WebhookURL == "" {
+				continue
+			}
+			if err := notify.NewNotifier().SendMessage(cfg.Notifications.WebhookURL, cfg.ProjectName, "released", notes.Summary()); err != nil {
+				term.Printf("⚠️  Release notification failed: %v\n", err)
+			}
+		default:
+			term.Printf("⚠️  Unknown release.publish target %q (use github or notify)\n", target)
+		}
+	}
+}
+
+// promotedImage finds the exact image deployed to env: the digest running
+// in its first cluster, falling back to the last successful deploy in
+// history. The commit comes from history when it recorded one.
+func promotedImage(cfg *config.Config, env string) (image, commit string) {
+	cluster := cfg.ClustersFor(env)[0]
+	last, err := deploy.LastSuccessful(cfg.ProjectName, env, cluster.Name)
+	if err != nil {
+		term.Printf("Error reading history: %v\n", err)
+		exit(1)
+	}
+	if last != nil {
+		commit = last.Commit
+	}
+
+	dep := deploy.NewDeployer()
+	err = configureCluster(dep, cluster)
+	if err == nil {
+		if image, err = dep.RunningImage(cfg.ProjectName); err == nil {
+			return image, commit
+		}
+	}
+	fmt.Fprintf(os.Stderr, "⚠️  Could not read the running image from %s: %v\n", env, err)
+
+	if last == nil {
+		term.Printf("Nothing to promote: no successful deployment to %s in history\n", env)
+		exit(1)
+	}
+	if !deploy.HasDigest(last.Image) {
+		fmt.Fprintf(os.Stderr, "⚠️  %s is not pinned to a digest; the tag may have been pushed again since it was deployed to %s\n", last.Image, env)
+	}
+	return last.Image, commit
+}
+
+// selectClusters returns the clusters for env, narrowed to one when a name is given
+func selectClusters(cfg *config.Config, env, name string) ([]config.Cluster, error) {
+	clusters := cfg.ClustersFor(env)
+	if name == "" {
+		return clusters, nil
 	}
 
-	if candidates, ok := paths[platform]; ok {
-		for _, path := range candidates {
-			if _, err := os.Stat(path); err == nil {
-				return path
-			}
+	for _, c := range clusters {
+		if c.Name == name {
+			return []config.Cluster{c}, nil
 		}
 	}
-	return ""
+	return nil, fmt.Errorf("cluster %q is not configured for env %s", name, env)
 }
 
-func getDefaultOutputPath(platform converter.Platform) string {
-	switch platform {
-	case converter.GitHub:
-		return ".github/workflows/ci.yml"
-	case converter.GitLab:
-		return ".gitlab-ci.yml"
-	case converter.CircleCI:
-		return ".circleci/config.yml"
-	case converter.Jenkins:
-		return "Jenkinsfile"
-	case converter.Azure:
-		return "azure-pipelines.yml"
-	default:
-		return "pipeline.yml"
+// selectCluster is selectClusters for commands that attach to a single
+// cluster; an env with several clusters needs --cluster
+func selectCluster(cfg *config.Config, env, name string) (config.Cluster, error) {
+	clusters, err := selectClusters(cfg, env, name)
+	if err != nil {
+		return config.Cluster{}, err
+	}
+	if len(clusters) > 1 {
+		names := make([]string, len(clusters))
+		for i, c := range clusters {
+			names[i] = c.Name
+		}
+		return config.Cluster{}, fmt.Errorf("env %s has several clusters (%s); pick one with --cluster=<name>", env, strings.Join(names, ", "))
 	}
+	return clusters[0], nil
 }
 
-// handleLint lints CI/CD configurations
-func handleLint() {
-	path := "."
-	if len(os.Args) > 2 {
-		path = os.Args[2]
+// configureCluster fetches cluster credentials for managed Kubernetes providers
+func configureCluster(dep *deploy.Deployer, cluster config.Cluster) error {
+	dep.Cluster = cluster.Name
+	if cluster.Context != "" {
+		dep.KubeContext = cluster.Context
+		return nil
 	}
 
-	l := linter.NewLinter()
+	switch cluster.Provider {
+	case "aws", "eks":
+		return dep.ConfigureEKS(cluster.Region, cluster.ClusterName)
+	case "gcp", "gke":
+		return dep.ConfigureGKE(cluster.GCPProject, cluster.Region, cluster.ClusterName)
+	case "azure", "aks":
+		return dep.ConfigureAKS(cluster.ResourceGroup, cluster.ClusterName)
+	}
+	return nil
+}
 
-	info, err := os.Stat(path)
+// handleRollback handles rollback
+func handleRollback() {
+	if err := validator.CheckKubectl(); err != nil {
+		term.Printf("Pre-flight check failed: %v\n", err)
+		exit(1)
+	}
+
+	cfg, err := config.LoadConfig("cicli.yaml")
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
 	}
 
-	if info.IsDir() {
-		results, err := l.LintDirectory(path)
-		if err != nil {
-			fmt.Printf("Error linting directory: %v\n", err)
-			os.Exit(1)
+	env := "dev"
+	clusterName := ""
+	serviceName := ""
+	forceUnlock := false
+	for _, arg := range os.Args[2:] {
+		if strings.HasPrefix(arg, "--env=") {
+			env = strings.TrimPrefix(arg, "--env=")
+		} else if strings.HasPrefix(arg, "--cluster=") {
+			clusterName = strings.TrimPrefix(arg, "--cluster=")
+		} else if strings.HasPrefix(arg, "--service=") {
+			serviceName = strings.TrimPrefix(arg, "--service=")
+		} else if arg == "--force-unlock" {
+			forceUnlock = true
 		}
+	}
 
-		if len(results) == 0 {
-			fmt.Println("No CI/CD configuration files found")
-			os.Exit(0)
-		}
+	clusters, err := selectClusters(cfg, env, clusterName)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
 
-		totalIssues := 0
-		for _, result := range results {
-			result.PrintReport()
-			totalIssues += len(result.Issues)
+	// Each cluster rolls back to its own previous deployment
+	appName := cfg.ProjectName
+	failed := 0
+	for _, cluster := range clusters {
+		if len(clusters) > 1 {
+			term.Printf("\n⏪ Rolling back cluster %s\n", cluster.Name)
 		}
 
-		if totalIssues > 0 {
-			os.Exit(1)
-		}
-	} else {
-		result, err := l.Lint(path)
+		dep := deploy.NewDeployer()
+		dep.LockMode = cfg.Deploy.Lock
+		manifestPath, err := selectService(cfg, dep, serviceName)
 		if err != nil {
-			fmt.Printf("Error linting file: %v\n", err)
-			os.Exit(1)
+			term.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		if err := configureCluster(dep, cluster); err != nil {
+			term.Printf("Error configuring cluster: %v\n", err)
+			failed++
+			continue
 		}
 
-		result.PrintReport()
+		if forceUnlock {
+			if err := dep.ForceUnlock(appName, env); err != nil {
+				term.Printf("Error unlocking: %v\n", err)
+				failed++
+				continue
+			}
+		}
 
-		if len(result.Issues) > 0 {
-			os.Exit(1)
+		if err := dep.Rollback(appName, env, manifestPath); err != nil {
+			term.Printf("Error rolling back: %v\n", err)
+			failed++
 		}
 	}
+	if failed > 0 {
+		exit(1)
+	}
 }
 
-// handleOptimize analyzes and suggests optimizations
-func handleOptimize() {
-	path := "."
-	apply := false
+// selectService points dep at the service named by --service= and returns
+// the manifest to apply for it, or the project manifest when name is empty
+func selectService(cfg *config.Config, dep *deploy.Deployer, name string) (string, error) {
+	if name == "" {
+		return cfg.Deploy.ManifestPath, nil
+	}
+	svc, err := cfg.ServiceNamed(name)
+	if err != nil {
+		return "", err
+	}
+	dep.Service = svc.Name
+	return svc.Manifest, nil
+}
 
+// handleLogs streams logs from the deployed app
+func handleLogs() {
+	if err := validator.CheckKubectl(); err != nil {
+		term.Printf("Pre-flight check failed: %v\n", err)
+		exit(1)
+	}
+
+	cfg, err := config.LoadConfig("cicli.yaml")
+	if err != nil {
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
+	}
+
+	env := "dev"
+	clusterName := ""
+	serviceName := ""
+	since := ""
+	follow := false
 	for _, arg := range os.Args[2:] {
-		if arg == "--apply" {
-			apply = true
-		} else if !strings.HasPrefix(arg, "-") {
-			path = arg
+		if strings.HasPrefix(arg, "--env=") {
+			env = strings.TrimPrefix(arg, "--env=")
+		} else if strings.HasPrefix(arg, "--cluster=") {
+			clusterName = strings.TrimPrefix(arg, "--cluster=")
+		} else if strings.HasPrefix(arg, "--service=") {
+			serviceName = strings.TrimPrefix(arg, "--service=")
+		} else if strings.HasPrefix(arg, "--since=") {
+			since = strings.TrimPrefix(arg, "--since=")
+		} else if arg == "--follow" || arg == "-f" {
+			follow = true
 		}
 	}
 
-	o := optimizer.NewOptimizer()
-
-	// Check if path is a file or directory
-	info, err := os.Stat(path)
+	cluster, err := selectCluster(cfg, env, clusterName)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error: %v\n", err)
+		exit(1)
 	}
 
-	if info.IsDir() {
-		// Find CI files in directory
-		patterns := []string{
-			".github/workflows/*.yml",
-			".github/workflows/*.yaml",
-			".gitlab-ci.yml",
-		}
+	dep := deploy.NewDeployer()
+	if _, err := selectService(cfg, dep, serviceName); err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+	if err := configureCluster(dep, cluster); err != nil {
+		term.Printf("Error configuring cluster: %v\n", err)
+		exit(1)
+	}
 
-		found := false
-		for _, pattern := range patterns {
-			matches, _ := filepath.Glob(filepath.Join(path, pattern))
-			for _, match := range matches {
-				found = true
-				analyzeAndOptimize(o, match, apply)
-			}
-		}
+	if err := dep.Logs(cfg.ProjectName, env, since, follow); err != nil {
+		term.Printf("Error fetching logs: %v\n", err)
+		exit(1)
+	}
+}
+
+// handleStatus shows the live status of the deployed app
+func handleStatus() {
+	if err := validator.CheckKubectl(); err != nil {
+		term.Printf("Pre-flight check failed: %v\n", err)
+		exit(1)
+	}
+
+	cfg, err := config.LoadConfig("cicli.yaml")
+	if err != nil {
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
+	}
 
-		if !found {
-			fmt.Println("No CI/CD configuration files found")
+	env := "dev"
+	clusterName := ""
+	serviceName := ""
+	for _, arg := range os.Args[2:] {
+		if strings.HasPrefix(arg, "--env=") {
+			env = strings.TrimPrefix(arg, "--env=")
+		} else if strings.HasPrefix(arg, "--cluster=") {
+			clusterName = strings.TrimPrefix(arg, "--cluster=")
+		} else if strings.HasPrefix(arg, "--service=") {
+			serviceName = strings.TrimPrefix(arg, "--service=")
 		}
-	} else {
-		analyzeAndOptimize(o, path, apply)
 	}
-}
 
-func analyzeAndOptimize(o *optimizer.Optimizer, path string, apply bool) {
-	result, err := o.Analyze(path)
+	clusters, err := selectClusters(cfg, env, clusterName)
 	if err != nil {
-		fmt.Printf("Error analyzing %s: %v\n", path, err)
-		return
+		term.Printf("Error: %v\n", err)
+		exit(1)
 	}
 
-	result.PrintReport()
+	failed := 0
+	for _, cluster := range clusters {
+		if len(clusters) > 1 {
+			term.Printf("\nCluster %s\n", cluster.Name)
+		}
+
+		dep := deploy.NewDeployer()
+		if _, err := selectService(cfg, dep, serviceName); err != nil {
+			term.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		if err := configureCluster(dep, cluster); err != nil {
+			term.Printf("Error configuring cluster: %v\n", err)
+			failed++
+			continue
+		}
 
-	if apply && len(result.Optimizations) > 0 {
-		fmt.Println("\n🔧 Applying auto-fixable optimizations...")
-		if err := o.Apply(path, result); err != nil {
-			fmt.Printf("Error applying optimizations: %v\n", err)
+		status, err := dep.Status(cfg.ProjectName, env)
+		if err != nil {
+			term.Printf("Error getting status: %v\n", err)
+			failed++
+			continue
 		}
+
+		status.PrintReport()
+	}
+	if failed > 0 {
+		exit(1)
 	}
 }
 
-// handleDocker handles docker commands
-func handleDocker() {
+// handleEnv manages ephemeral environments: namespaced deployments of the
+// project manifests with generated hostnames and a TTL
+func handleEnv() {
 	if len(os.Args) < 3 {
-		fmt.Println("Usage: cicli docker publish [flags]")
-		os.Exit(1)
-	}
-
-	subCmd := os.Args[2]
-	if subCmd != "publish" {
-		fmt.Printf("Unknown docker command: %s\n", subCmd)
-		os.Exit(1)
+		term.Println("Usage: cicli env <create|list|destroy> [options]")
+		term.Println("  cicli env create --name=pr-42 [--tag=<tag>] [--ttl=72h]")
+		term.Println("  cicli env list")
+		term.Println("  cicli env destroy --name=pr-42 | --expired")
+		exit(1)
 	}
 
 	cfg, err := config.LoadConfig("cicli.yaml")
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
+	}
+	envs, err := store.NewEnvironmentStore()
+	if err != nil {
+		term.Printf("Error opening environment store: %v\n", err)
+		exit(1)
 	}
 
-	tag := "latest"
-	useGitSha := false
+	name, tag, ttlFlag := "", "latest", cfg.Preview.TTL
+	expired := false
 	for _, arg := range os.Args[3:] {
-		if arg == "--use-git-sha" {
-			useGitSha = true
-		} else if strings.HasPrefix(arg, "--tag=") {
+		switch {
+		case strings.HasPrefix(arg, "--name="):
+			name = strings.TrimPrefix(arg, "--name=")
+		case strings.HasPrefix(arg, "--tag="):
 			tag = strings.TrimPrefix(arg, "--tag=")
+		case strings.HasPrefix(arg, "--ttl="):
+			ttlFlag = strings.TrimPrefix(arg, "--ttl=")
+		case arg == "--expired":
+			expired = true
 		}
 	}
 
-	if err := validator.CheckDocker(); err != nil {
-		fmt.Printf("Pre-flight check failed: %v\n", err)
-		os.Exit(1)
-	}
+	switch os.Args[2] {
+	case "create":
+		if name == "" {
+			term.Println("Usage: cicli env create --name=<name> [--tag=<tag>] [--ttl=72h]")
+			exit(1)
+		}
+		ttl := 72 * time.Hour
+		if ttlFlag != "" {
+			if ttl, err = time.ParseDuration(ttlFlag); err != nil || ttl <= 0 {
+				term.Printf("Invalid TTL %q (use e.g. 24h)\n", ttlFlag)
+				exit(1)
+			}
+		}
 
-	d := docker.NewClient()
+		dep := previewDeployer(cfg, "")
+		env := store.Environment{
+			Name:      name,
+			Project:   cfg.ProjectName,
+			Namespace: deploy.EphemeralNamespace(cfg.ProjectName, name),
+			Image:     fmt.Sprintf("%s:%s", cfg.Docker.ImageName, tag),
+			Context:   dep.KubeContext,
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(ttl),
+		}
+		if cfg.Preview.Domain != "" {
+			env.Host = fmt.Sprintf("%s.%s.%s", deploy.EphemeralNamespace("", name), deploy.EphemeralNamespace("", cfg.ProjectName), cfg.Preview.Domain)
+		}
 
-	if useGitSha {
-		sha, err := d.GetGitSHA()
+		// Track the environment first so a failed rollout can still be destroyed
+		if err := envs.Put(env); err != nil {
+			term.Printf("Error recording environment: %v\n", err)
+			exit(1)
+		}
+		if err := dep.CreateEphemeral(cfg.Deploy.ManifestPath, cfg.ProjectName, cfg.Preview.IngressClass, &env); err != nil {
+			term.Printf("Error creating environment: %v\n", err)
+			exit(1)
+		}
+
+		term.Printf("\n✅ Environment %s is up (expires %s)\n", name, env.ExpiresAt.Format("2006-01-02 15:04"))
+		if env.Host != "" {
+			term.Printf("   URL: https://%s\n", env.Host)
+		} else if !quiet {
+			term.Println("💡 Tip: Set preview.domain in cicli.yaml to get a hostname per environment")
+		}
+
+	case "list":
+		list, err := envs.Load()
 		if err != nil {
-			fmt.Printf("Error getting git SHA: %v\n", err)
-			os.Exit(1)
+			term.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		if len(list) == 0 {
+			term.Println("No ephemeral environments.")
+			return
+		}
+		now := time.Now()
+		term.Printf("%-20s %-30s %-40s %s\n", "NAME", "NAMESPACE", "HOST", "EXPIRES")
+		for _, e := range list {
+			if e.Project != cfg.ProjectName {
+				continue
+			}
+			expires := e.ExpiresAt.Format("2006-01-02 15:04")
+			if e.Expired(now) {
+				expires += " (expired)"
+			}
+			host := e.Host
+			if host == "" {
+				host = "-"
+			}
+			term.Printf("%-20s %-30s %-40s %s\n", e.Name, e.Namespace, host, expires)
 		}
-		tag = sha
-	}
 
-	fullImageName := fmt.Sprintf("%s:%s", cfg.Docker.ImageName, tag)
+	case "destroy":
+		list, err := envs.Load()
+		if err != nil {
+			term.Printf("Error: %v\n", err)
+			exit(1)
+		}
 
-	if err := d.Build(fullImageName, cfg.Docker.Context, cfg.Docker.Dockerfile); err != nil {
-		fmt.Printf("Error building image: %v\n", err)
-		os.Exit(1)
-	}
+		var targets []store.Environment
+		for _, e := range list {
+			if e.Project == cfg.ProjectName && ((expired && e.Expired(time.Now())) || (name != "" && e.Name == name)) {
+				targets = append(targets, e)
+			}
+		}
+		if name == "" && !expired {
+			term.Println("Usage: cicli env destroy --name=<name> | --expired")
+			exit(1)
+		}
+		if len(targets) == 0 {
+			if name != "" {
+				term.Printf("No environment named %s\n", name)
+				exit(1)
+			}
+			term.Println("No expired environments.")
+			return
+		}
 
-	if err := d.Push(fullImageName); err != nil {
-		fmt.Printf("Error pushing image: %v\n", err)
-		os.Exit(1)
+		failed := 0
+		for _, e := range targets {
+			dep := previewDeployer(cfg, e.Context)
+			if err := dep.DestroyEphemeral(e.Namespace); err != nil {
+				term.Printf("   ❌ %s: %v\n", e.Name, err)
+				failed++
+				continue
+			}
+			if err := envs.Remove(e.Project, e.Name); err != nil {
+				term.Printf("Error updating environment store: %v\n", err)
+				exit(1)
+			}
+			term.Printf("   ✅ Destroyed %s\n", e.Name)
+		}
+		if failed > 0 {
+			exit(1)
+		}
+
+	default:
+		term.Printf("Unknown env command: %s\n", os.Args[2])
+		exit(1)
 	}
 }
 
-// handleDeploy handles deployment
-func handleDeploy() {
+// handleEnvs compares what is deployed across environments
+func handleEnvs() {
+	if len(os.Args) < 3 || os.Args[2] != "diff" {
+		term.Println("Usage: cicli envs diff [dev staging prod]")
+		exit(1)
+	}
 	if err := validator.CheckKubectl(); err != nil {
-		fmt.Printf("Pre-flight check failed: %v\n", err)
-		os.Exit(1)
+		term.Printf("Pre-flight check failed: %v\n", err)
+		exit(1)
 	}
 
 	cfg, err := config.LoadConfig("cicli.yaml")
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
 	}
 
-	env := "dev"
-	tag := "latest"
-	for _, arg := range os.Args[2:] {
-		if strings.HasPrefix(arg, "--env=") {
-			env = strings.TrimPrefix(arg, "--env=")
-		} else if strings.HasPrefix(arg, "--tag=") {
-			tag = strings.TrimPrefix(arg, "--tag=")
+	var envs []string
+	for _, arg := range os.Args[3:] {
+		if strings.HasPrefix(arg, "--envs=") {
+			envs = append(envs, strings.Split(strings.TrimPrefix(arg, "--envs="), ",")...)
+		} else if !strings.HasPrefix(arg, "-") {
+			envs = append(envs, arg)
 		}
 	}
+	if len(envs) == 0 {
+		for name := range cfg.Environments {
+			envs = append(envs, name)
+		}
+		sort.Strings(envs)
+	}
+	if len(envs) == 0 {
+		envs = []string{"dev", "staging", "prod"}
+	}
 
-	dep := deploy.NewDeployer()
-
-	if cfg.Deploy.Provider == "aws" {
-		if err := dep.ConfigureEKS(cfg.Deploy.Region, cfg.Deploy.ClusterName); err != nil {
-			fmt.Printf("Error configuring EKS: %v\n", err)
-			os.Exit(1)
+	// Every cluster of an environment gets its own column so drift between
+	// regions shows up too
+	var states []*deploy.EnvState
+	for _, env := range envs {
+		for _, cluster := range cfg.ClustersFor(env) {
+			dep := deploy.NewDeployer()
+			if err := configureCluster(dep, cluster); err != nil {
+				state := &deploy.EnvState{Env: env, Cluster: cluster.Name, Err: err}
+				if last, _ := deploy.LastSuccessful(cfg.ProjectName, env, cluster.Name); last != nil {
+					state.Image, state.Commit, state.Deployed = last.Image, last.Commit, last.Timestamp
+				}
+				states = append(states, state)
+				continue
+			}
+			states = append(states, dep.EnvState(cfg.ProjectName, env))
 		}
 	}
 
-	fullImageName := fmt.Sprintf("%s:%s", cfg.Docker.ImageName, tag)
-	appName := cfg.ProjectName
+	deploy.PrintEnvDiff(cfg.ProjectName, states)
+}
+
+// previewDeployer connects to the cluster hosting ephemeral environments,
+// reusing a recorded kubectl context when there is one
+func previewDeployer(cfg *config.Config, kubeContext string) *deploy.Deployer {
+	if err := validator.CheckKubectl(); err != nil {
+		term.Printf("Pre-flight check failed: %v\n", err)
+		exit(1)
+	}
+
+	dep := deploy.NewDeployer()
+	if kubeContext != "" {
+		dep.KubeContext = kubeContext
+		return dep
+	}
 
-	if err := dep.DeployToK8s(cfg.Deploy.ManifestPath, fullImageName, appName, env); err != nil {
-		fmt.Printf("Error deploying: %v\n", err)
-		os.Exit(1)
+	env := cfg.Preview.Env
+	if env == "" {
+		env = "dev"
+	}
+	if err := configureCluster(dep, cfg.ClustersFor(env)[0]); err != nil {
+		term.Printf("Error configuring cluster: %v\n", err)
+		exit(1)
 	}
+	return dep
 }
 
-// handleRollback handles rollback
-func handleRollback() {
+// handlePortForward forwards a local port to the deployed app
+func handlePortForward() {
 	if err := validator.CheckKubectl(); err != nil {
-		fmt.Printf("Pre-flight check failed: %v\n", err)
-		os.Exit(1)
+		term.Printf("Pre-flight check failed: %v\n", err)
+		exit(1)
 	}
 
 	cfg, err := config.LoadConfig("cicli.yaml")
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
 	}
 
 	env := "dev"
+	clusterName := ""
+	serviceName := ""
+	localPort := 0
+	remotePort := 0
 	for _, arg := range os.Args[2:] {
 		if strings.HasPrefix(arg, "--env=") {
 			env = strings.TrimPrefix(arg, "--env=")
+		} else if strings.HasPrefix(arg, "--cluster=") {
+			clusterName = strings.TrimPrefix(arg, "--cluster=")
+		} else if strings.HasPrefix(arg, "--service=") {
+			serviceName = strings.TrimPrefix(arg, "--service=")
+		} else if strings.HasPrefix(arg, "--port=") {
+			fmt.Sscanf(strings.TrimPrefix(arg, "--port="), "%d", &localPort)
+		} else if strings.HasPrefix(arg, "--remote-port=") {
+			fmt.Sscanf(strings.TrimPrefix(arg, "--remote-port="), "%d", &remotePort)
 		}
 	}
 
+	cluster, err := selectCluster(cfg, env, clusterName)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+
 	dep := deploy.NewDeployer()
-	appName := cfg.ProjectName
+	manifestPath, err := selectService(cfg, dep, serviceName)
+	if err != nil {
+		term.Printf("Error: %v\n", err)
+		exit(1)
+	}
+	if err := configureCluster(dep, cluster); err != nil {
+		term.Printf("Error configuring cluster: %v\n", err)
+		exit(1)
+	}
+
+	workload := cfg.ProjectName
+	if dep.Service != "" {
+		workload = dep.Service
+	}
+	if remotePort == 0 {
+		remotePort, err = dep.ContainerPort(manifestPath, workload)
+		if err != nil {
+			term.Printf("Error detecting container port: %v\n", err)
+			term.Println("Use --remote-port=<port> to set it explicitly")
+			exit(1)
+		}
+	}
+	if localPort == 0 {
+		localPort = remotePort
+	}
 
-	if err := dep.Rollback(appName, env); err != nil {
-		fmt.Printf("Error rolling back: %v\n", err)
-		os.Exit(1)
+	if err := dep.PortForward(cfg.ProjectName, env, localPort, remotePort); err != nil {
+		term.Printf("Error port-forwarding: %v\n", err)
+		exit(1)
 	}
 }
 
@@ -823,25 +5132,43 @@ func handleRollback() {
 func handleHistory() {
 	s, err := store.NewStore()
 	if err != nil {
-		fmt.Printf("Error opening store: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error opening store: %v\n", err)
+		exit(1)
 	}
 
 	deployments, err := s.Load()
 	if err != nil {
-		fmt.Printf("Error loading history: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error loading history: %v\n", err)
+		exit(1)
 	}
 
-	fmt.Println("Deployment History:")
-	fmt.Printf("%-20s %-15s %-10s %-20s %s\n", "TIMESTAMP", "PROJECT", "ENV", "STATUS", "IMAGE")
+	term.Println("Deployment History:")
+	term.Printf("%-20s %-15s %-10s %-15s %-20s %s\n", "TIMESTAMP", "PROJECT", "ENV", "CLUSTER", "STATUS", "IMAGE")
 	for _, d := range deployments {
-		fmt.Printf("%-20s %-15s %-10s %-20s %s\n",
+		cluster := d.Cluster
+		if cluster == "" {
+			cluster = "-"
+		}
+		project := d.Project
+		if d.Service != "" {
+			project += "/" + d.Service
+		}
+		image := d.Image
+		if d.PromotedFrom != "" {
+			image += fmt.Sprintf(" (promoted from %s)", d.PromotedFrom)
+		}
+		if stage := failedStage(d.Stages); stage != "" {
+			image += fmt.Sprintf(" (ship stopped at %s)", stage)
+		} else if len(d.Stages) > 0 {
+			image += " (shipped)"
+		}
+		term.Printf("%-20s %-15s %-10s %-15s %-20s %s\n",
 			d.Timestamp.Format("2006-01-02 15:04"),
-			d.Project,
+			project,
 			d.Env,
+			cluster,
 			d.Status,
-			d.Image)
+			image)
 	}
 }
 
@@ -849,8 +5176,8 @@ func handleHistory() {
 func handleNotify() {
 	cfg, err := config.LoadConfig("cicli.yaml")
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error loading config: %v\n", err)
+		exit(1)
 	}
 
 	status := "success"
@@ -869,7 +5196,109 @@ func handleNotify() {
 
 	n := notify.NewNotifier()
 	if err := n.Send(cfg.Notifications.WebhookURL, cfg.ProjectName, status, env, version); err != nil {
-		fmt.Printf("Error sending notification: %v\n", err)
-		os.Exit(1)
+		term.Printf("Error sending notification: %v\n", err)
+		exit(1)
+	}
+}
+
+// handleSelf manages the cicli installation itself
+func handleSelf() {
+	if len(os.Args) < 3 {
+		term.Println("Usage: cicli self <update|install-action>")
+		exit(1)
+	}
+
+	switch os.Args[2] {
+	case "update":
+		check := false
+		for _, arg := range os.Args[3:] {
+			if arg == "--check" {
+				check = true
+			}
+		}
+
+		u := selfupdate.NewUpdater(version)
+		release, err := u.Latest()
+		if err != nil {
+			term.Printf("Error checking for updates: %v\n", err)
+			exit(1)
+		}
+
+		if !u.IsNewer(release) {
+			term.Printf("✅ cicli %s is up to date\n", version)
+			return
+		}
+
+		term.Printf("New version available: %s (current: %s)\n", release.TagName, version)
+		if check {
+			term.Printf("Release notes: %s\n", release.HTMLURL)
+			return
+		}
+
+		if err := u.Update(release); err != nil {
+			term.Printf("Error updating: %v\n", err)
+			exit(1)
+		}
+		term.Printf("✅ Updated to %s\n", release.TagName)
+
+	case "install-action":
+		term.Println("# GitHub Actions step")
+		term.Println("- name: Install cicli")
+		term.Println("  run: |")
+		for _, line := range strings.Split(selfupdate.CIInstallScript, "\n") {
+			term.Println("    " + line)
+		}
+		term.Println()
+		term.Println("# Other CI systems (Linux, amd64)")
+		term.Printf("curl -sSfL https://github.com/%s/releases/latest/download/cicli_linux_amd64.tar.gz | tar -xz -C /usr/local/bin cicli\n", selfupdate.Repo)
+
+	default:
+		term.Printf("Unknown self command: %s\n", os.Args[2])
+		exit(1)
+	}
+}
+
+// handleStats shows local usage statistics
+func handleStats() {
+	if len(os.Args) < 3 {
+		term.Println("Usage: cicli stats <self|enable|disable>")
+		exit(1)
+	}
+
+	r, err := metrics.NewRecorder()
+	if err != nil {
+		term.Printf("Error opening metrics: %v\n", err)
+		exit(1)
+	}
+
+	switch os.Args[2] {
+	case "enable":
+		if err := r.Enable(); err != nil {
+			term.Printf("Error enabling metrics: %v\n", err)
+			exit(1)
+		}
+		term.Printf("✅ Local usage metrics enabled (%s). Nothing is sent anywhere.\n", r.FilePath)
+
+	case "disable":
+		if err := r.Disable(); err != nil {
+			term.Printf("Error disabling metrics: %v\n", err)
+			exit(1)
+		}
+		term.Println("Local usage metrics disabled.")
+
+	case "self":
+		entries, err := r.Load()
+		if err != nil {
+			term.Printf("Error loading metrics: %v\n", err)
+			exit(1)
+		}
+		if !r.Enabled() {
+			term.Println("ℹ️  Metrics are disabled. Run 'cicli stats enable' to start recording.")
+		}
+		metrics.PrintReport(entries)
+
+	default:
+		term.Printf("Unknown stats command: %s\n", os.Args[2])
+		exit(1)
 	}
 }
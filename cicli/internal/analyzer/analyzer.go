@@ -6,27 +6,36 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+
+	"cicli/internal/i18n"
+	"cicli/internal/term"
 )
 
 // ProjectInfo contains analyzed project information
 type ProjectInfo struct {
-	Name         string            `json:"name"`
-	Language     string            `json:"language"`
-	Framework    string            `json:"framework"`
-	PackageManager string          `json:"package_manager"`
-	BuildCommand string            `json:"build_command"`
-	TestCommand  string            `json:"test_command"`
-	TestFramework string           `json:"test_framework"`
-	HasDocker    bool              `json:"has_docker"`
-	HasCI        bool              `json:"has_ci"`
-	CIPlatform   string            `json:"ci_platform"`
-	Dependencies []string          `json:"dependencies"`
-	DevDependencies []string       `json:"dev_dependencies"`
-	Ports        []int             `json:"ports"`
-	EnvVars      []string          `json:"env_vars"`
-	EntryPoint   string            `json:"entry_point"`
-	Suggestions  []Suggestion      `json:"suggestions"`
+	Name            string          `json:"name"`
+	Language        string          `json:"language"`
+	Framework       string          `json:"framework"`
+	PackageManager  string          `json:"package_manager"`
+	BuildCommand    string          `json:"build_command"`
+	TestCommand     string          `json:"test_command"`
+	TestFramework   string          `json:"test_framework"`
+	HasDocker       bool            `json:"has_docker"`
+	HasCI           bool            `json:"has_ci"`
+	CIPlatform      string          `json:"ci_platform"`
+	Dependencies    []string        `json:"dependencies"`
+	DevDependencies []string        `json:"dev_dependencies"`
+	Ports           []int           `json:"ports"`
+	EnvVars         []string        `json:"env_vars"`
+	EntryPoint      string          `json:"entry_point"`
+	QualityTools    []QualityTool   `json:"quality_tools"`
+	CodeGenerators  []CodeGenerator `json:"code_generators"`
+	Bazel           *BazelInfo      `json:"bazel,omitempty"`
+	E2E             *E2EInfo        `json:"e2e,omitempty"`
+	Monorepo        *MonorepoInfo   `json:"monorepo,omitempty"`
+	Suggestions     []Suggestion    `json:"suggestions"`
 }
 
 // Suggestion represents an improvement suggestion
@@ -53,8 +62,15 @@ func NewAnalyzer(rootPath string) *Analyzer {
 
 // Analyze performs full project analysis
 func (a *Analyzer) Analyze() (*ProjectInfo, error) {
+	// Empty rather than nil slices, so JSON and YAML reports show [] not null
 	info := &ProjectInfo{
-		Suggestions: []Suggestion{},
+		Dependencies:    []string{},
+		DevDependencies: []string{},
+		Ports:           []int{},
+		EnvVars:         []string{},
+		QualityTools:    []QualityTool{},
+		CodeGenerators:  []CodeGenerator{},
+		Suggestions:     []Suggestion{},
 	}
 
 	// Detect project name from directory
@@ -67,48 +83,77 @@ func (a *Analyzer) Analyze() (*ProjectInfo, error) {
 	a.detectPackageManager(info)
 	a.detectBuildCommands(info)
 	a.detectTestFramework(info)
+	a.detectBazel(info)
+	a.detectMonorepo(info)
+	a.detectQualityTools(info)
+	a.detectCodeGenerators(info)
 	a.detectDocker(info)
 	a.detectCI(info)
 	a.detectPorts(info)
 	a.detectEnvVars(info)
+	a.detectE2E(info)
 	a.generateSuggestions(info)
 
 	return info, nil
 }
 
 // detectLanguage identifies the primary programming language
+// languageManifests maps manifest files to the language they indicate, in priority order
+var languageManifests = []struct {
+	file     string
+	language string
+}{
+	{"package.json", "node"},
+	{"go.mod", "go"},
+	{"requirements.txt", "python"},
+	{"pyproject.toml", "python"},
+	{"Pipfile", "python"},
+	{"Cargo.toml", "rust"},
+	{"pom.xml", "java"},
+	{"build.gradle", "java"},
+	{"Gemfile", "ruby"},
+	{"composer.json", "php"},
+	{"*.csproj", "dotnet"},
+}
+
 func (a *Analyzer) detectLanguage(info *ProjectInfo) {
-	checks := []struct {
-		file     string
-		language string
-	}{
-		{"package.json", "node"},
-		{"go.mod", "go"},
-		{"requirements.txt", "python"},
-		{"pyproject.toml", "python"},
-		{"Pipfile", "python"},
-		{"Cargo.toml", "rust"},
-		{"pom.xml", "java"},
-		{"build.gradle", "java"},
-		{"Gemfile", "ruby"},
-		{"composer.json", "php"},
-		{"*.csproj", "dotnet"},
-	}
-
-	for _, check := range checks {
+	info.Language = languageIn(a.rootPath)
+}
+
+// languageIn returns the language of the manifest found in dir, or "unknown"
+func languageIn(dir string) string {
+	for _, check := range languageManifests {
 		if check.file == "*.csproj" {
-			matches, _ := filepath.Glob(filepath.Join(a.rootPath, check.file))
+			matches, _ := filepath.Glob(filepath.Join(dir, check.file))
 			if len(matches) > 0 {
-				info.Language = check.language
-				return
+				return check.language
 			}
-		} else if a.fileExists(check.file) {
-			info.Language = check.language
-			return
+		} else if _, err := os.Stat(filepath.Join(dir, check.file)); err == nil {
+			return check.language
 		}
 	}
+	return "unknown"
+}
+
+// Subprojects returns top-level directories that carry their own language
+// manifest, e.g. frontend/ and backend/ in a multi-stack repo
+func (a *Analyzer) Subprojects() []string {
+	entries, err := os.ReadDir(a.rootPath)
+	if err != nil {
+		return nil
+	}
 
-	info.Language = "unknown"
+	var dirs []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" {
+			continue
+		}
+		if languageIn(filepath.Join(a.rootPath, name)) != "unknown" {
+			dirs = append(dirs, name)
+		}
+	}
+	return dirs
 }
 
 // detectFramework identifies the framework being used
@@ -125,6 +170,81 @@ func (a *Analyzer) detectFramework(info *ProjectInfo) {
 	}
 }
 
+// frameworkDep is a dependency and the framework it indicates. Tables of
+// them are in priority order, so a project using several frameworks always
+// gets the same one.
+type frameworkDep struct {
+	dep       string
+	framework string
+}
+
+// nodeFrameworks lists meta-frameworks before the libraries they build on
+var nodeFrameworks = []frameworkDep{
+	{"next", "nextjs"},
+	{"nuxt", "nuxt"},
+	{"@nestjs/core", "nestjs"},
+	{"nestjs", "nestjs"},
+	{"@angular/core", "angular"},
+	{"svelte", "svelte"},
+	{"react", "react"},
+	{"vue", "vue"},
+	{"fastify", "fastify"},
+	{"koa", "koa"},
+	{"hapi", "hapi"},
+	{"express", "express"},
+}
+
+var pythonFrameworks = []frameworkDep{
+	{"django", "django"},
+	{"fastapi", "fastapi"},
+	{"flask", "flask"},
+	{"starlette", "starlette"},
+	{"tornado", "tornado"},
+	{"pyramid", "pyramid"},
+	{"sanic", "sanic"},
+}
+
+var goFrameworks = []frameworkDep{
+	{"github.com/gin-gonic/gin", "gin"},
+	{"github.com/labstack/echo", "echo"},
+	{"github.com/gofiber/fiber", "fiber"},
+	{"github.com/gorilla/mux", "gorilla"},
+	{"github.com/go-chi/chi", "chi"},
+	{"github.com/beego/beego", "beego"},
+}
+
+// nodeTestFrameworks lists unit test runners before end-to-end ones, which
+// are only the test framework of projects without a unit runner
+var nodeTestFrameworks = []frameworkDep{
+	{"vitest", "vitest"},
+	{"jest", "jest"},
+	{"mocha", "mocha"},
+	{"ava", "ava"},
+	{"tap", "tap"},
+	{"@playwright/test", "playwright"},
+	{"cypress", "cypress"},
+}
+
+// ciConfigs are the files and directories of each CI platform, in the
+// order they are looked for
+var ciConfigs = []struct {
+	path     string
+	platform string
+}{
+	{".github/workflows", "github-actions"},
+	{".gitlab-ci.yml", "gitlab-ci"},
+	{"Jenkinsfile", "jenkins"},
+	{".circleci/config.yml", "circleci"},
+	{"azure-pipelines.yml", "azure-pipelines"},
+	{".travis.yml", "travis-ci"},
+	{"bitbucket-pipelines.yml", "bitbucket"},
+	{".drone.yml", "drone"},
+	{".woodpecker.yml", "woodpecker"},
+	{".buildkite/pipeline.yml", "buildkite"},
+	{".teamcity", "teamcity"},
+	{"bamboo-specs", "bamboo"},
+}
+
 func (a *Analyzer) detectNodeFramework(info *ProjectInfo) {
 	content, err := os.ReadFile(filepath.Join(a.rootPath, "package.json"))
 	if err != nil {
@@ -141,33 +261,20 @@ func (a *Analyzer) detectNodeFramework(info *ProjectInfo) {
 		for dep := range deps {
 			info.Dependencies = append(info.Dependencies, dep)
 		}
+		sort.Strings(info.Dependencies)
 	}
 	if devDeps, ok := pkg["devDependencies"].(map[string]interface{}); ok {
 		for dep := range devDeps {
 			info.DevDependencies = append(info.DevDependencies, dep)
 		}
+		sort.Strings(info.DevDependencies)
 	}
 
-	// Detect framework
-	frameworks := map[string]string{
-		"next":      "nextjs",
-		"react":     "react",
-		"vue":       "vue",
-		"@angular/core": "angular",
-		"express":   "express",
-		"fastify":   "fastify",
-		"nestjs":    "nestjs",
-		"@nestjs/core": "nestjs",
-		"koa":       "koa",
-		"hapi":      "hapi",
-		"svelte":    "svelte",
-		"nuxt":      "nuxt",
-	}
-
-	for dep, framework := range frameworks {
+	// Detect framework; meta-frameworks come before the libraries they use
+	for _, f := range nodeFrameworks {
 		for _, d := range info.Dependencies {
-			if d == dep {
-				info.Framework = framework
+			if d == f.dep {
+				info.Framework = f.framework
 				return
 			}
 		}
@@ -176,7 +283,7 @@ func (a *Analyzer) detectNodeFramework(info *ProjectInfo) {
 
 func (a *Analyzer) detectPythonFramework(info *ProjectInfo) {
 	files := []string{"requirements.txt", "pyproject.toml", "Pipfile"}
-	
+
 	for _, file := range files {
 		content, err := os.ReadFile(filepath.Join(a.rootPath, file))
 		if err != nil {
@@ -184,19 +291,9 @@ func (a *Analyzer) detectPythonFramework(info *ProjectInfo) {
 		}
 
 		contentStr := strings.ToLower(string(content))
-		frameworks := map[string]string{
-			"django":     "django",
-			"flask":      "flask",
-			"fastapi":    "fastapi",
-			"tornado":    "tornado",
-			"pyramid":    "pyramid",
-			"starlette":  "starlette",
-			"sanic":      "sanic",
-		}
-
-		for dep, framework := range frameworks {
-			if strings.Contains(contentStr, dep) {
-				info.Framework = framework
+		for _, f := range pythonFrameworks {
+			if strings.Contains(contentStr, f.dep) {
+				info.Framework = f.framework
 				return
 			}
 		}
@@ -210,18 +307,9 @@ func (a *Analyzer) detectGoFramework(info *ProjectInfo) {
 	}
 
 	contentStr := string(content)
-	frameworks := map[string]string{
-		"github.com/gin-gonic/gin":   "gin",
-		"github.com/labstack/echo":   "echo",
-		"github.com/gofiber/fiber":   "fiber",
-		"github.com/gorilla/mux":     "gorilla",
-		"github.com/go-chi/chi":      "chi",
-		"github.com/beego/beego":     "beego",
-	}
-
-	for dep, framework := range frameworks {
-		if strings.Contains(contentStr, dep) {
-			info.Framework = framework
+	for _, f := range goFrameworks {
+		if strings.Contains(contentStr, f.dep) {
+			info.Framework = f.framework
 			return
 		}
 	}
@@ -229,7 +317,7 @@ func (a *Analyzer) detectGoFramework(info *ProjectInfo) {
 
 func (a *Analyzer) detectJavaFramework(info *ProjectInfo) {
 	files := []string{"pom.xml", "build.gradle"}
-	
+
 	for _, file := range files {
 		content, err := os.ReadFile(filepath.Join(a.rootPath, file))
 		if err != nil {
@@ -351,19 +439,10 @@ func (a *Analyzer) detectBuildCommands(info *ProjectInfo) {
 func (a *Analyzer) detectTestFramework(info *ProjectInfo) {
 	switch info.Language {
 	case "node":
-		testFrameworks := map[string]string{
-			"jest":       "jest",
-			"mocha":      "mocha",
-			"vitest":     "vitest",
-			"ava":        "ava",
-			"tap":        "tap",
-			"@playwright/test": "playwright",
-			"cypress":    "cypress",
-		}
-		for dep, framework := range testFrameworks {
+		for _, f := range nodeTestFrameworks {
 			for _, d := range info.DevDependencies {
-				if d == dep {
-					info.TestFramework = framework
+				if d == f.dep {
+					info.TestFramework = f.framework
 					return
 				}
 			}
@@ -405,30 +484,19 @@ func (a *Analyzer) detectDocker(info *ProjectInfo) {
 
 // detectCI checks for existing CI configuration
 func (a *Analyzer) detectCI(info *ProjectInfo) {
-	ciConfigs := map[string]string{
-		".github/workflows":      "github-actions",
-		".gitlab-ci.yml":         "gitlab-ci",
-		"Jenkinsfile":            "jenkins",
-		".circleci/config.yml":   "circleci",
-		"azure-pipelines.yml":    "azure-pipelines",
-		".travis.yml":            "travis-ci",
-		"bitbucket-pipelines.yml": "bitbucket",
-		".drone.yml":             "drone",
-	}
-
-	for path, platform := range ciConfigs {
-		fullPath := filepath.Join(a.rootPath, path)
+	for _, c := range ciConfigs {
+		fullPath := filepath.Join(a.rootPath, c.path)
 		if fileInfo, err := os.Stat(fullPath); err == nil {
 			if fileInfo.IsDir() {
 				// Check if directory has files
 				entries, _ := os.ReadDir(fullPath)
 				if len(entries) > 0 {
 					info.HasCI = true
-					info.CIPlatform = platform
+					info.CIPlatform = c.platform
 				}
 			} else {
 				info.HasCI = true
-				info.CIPlatform = platform
+				info.CIPlatform = c.platform
 			}
 			return
 		}
@@ -481,7 +549,7 @@ func (a *Analyzer) detectPorts(info *ProjectInfo) {
 func (a *Analyzer) detectEnvVars(info *ProjectInfo) {
 	// Check .env.example or .env.sample
 	envFiles := []string{".env.example", ".env.sample", ".env.template"}
-	
+
 	for _, envFile := range envFiles {
 		content, err := os.ReadFile(filepath.Join(a.rootPath, envFile))
 		if err != nil {
@@ -537,6 +605,17 @@ func (a *Analyzer) generateSuggestions(info *ProjectInfo) {
 		})
 	}
 
+	// Check for a shared Bazel cache
+	if info.Bazel != nil && !info.Bazel.RemoteCache {
+		info.Suggestions = append(info.Suggestions, Suggestion{
+			Category:    "optimization",
+			Severity:    "info",
+			Title:       "No Bazel Remote Cache",
+			Description: "CI runs rebuild everything the runner's disk cache misses. A remote cache shares results between runs and developers.",
+			Fix:         "Run 'cicli generate pipeline --bazel-remote-cache=grpcs://<cache>' or set bazel.remote_cache in cicli.yaml",
+		})
+	}
+
 	// Check for .env in .gitignore
 	if a.fileExists(".env") && !a.isInGitignore(".env") {
 		info.Suggestions = append(info.Suggestions, Suggestion{
@@ -577,40 +656,63 @@ func (a *Analyzer) fileExists(name string) bool {
 
 // PrintReport outputs a formatted analysis report
 func (info *ProjectInfo) PrintReport() {
-	fmt.Println("\n📊 Project Analysis Report")
-	fmt.Println(strings.Repeat("═", 50))
-	
-	fmt.Printf("\n📦 Project: %s\n", info.Name)
-	fmt.Printf("🔧 Language: %s\n", info.Language)
+	term.Println("\n📊 " + i18n.T("Project Analysis Report"))
+	term.Println(strings.Repeat("═", 50))
+
+	term.Printf("\n📦 %s\n", i18n.T("Project: %s", info.Name))
+	term.Printf("🔧 %s\n", i18n.T("Language: %s", info.Language))
 	if info.Framework != "" {
-		fmt.Printf("🏗️  Framework: %s\n", info.Framework)
+		term.Printf("🏗️  %s\n", i18n.T("Framework: %s", info.Framework))
 	}
 	if info.PackageManager != "" {
-		fmt.Printf("📦 Package Manager: %s\n", info.PackageManager)
+		term.Printf("📦 %s\n", i18n.T("Package Manager: %s", info.PackageManager))
 	}
-	
-	fmt.Println("\n📋 Commands:")
+
+	term.Println("\n📋 " + i18n.T("Commands:"))
 	if info.BuildCommand != "" {
-		fmt.Printf("   Build: %s\n", info.BuildCommand)
+		term.Printf("   %s\n", i18n.T("Build: %s", info.BuildCommand))
 	}
 	if info.TestCommand != "" {
-		fmt.Printf("   Test:  %s\n", info.TestCommand)
+		term.Printf("   %s\n", i18n.T("Test:  %s", info.TestCommand))
 	}
-	
-	fmt.Println("\n🔍 Detection:")
-	fmt.Printf("   Docker: %v\n", boolToEmoji(info.HasDocker))
-	fmt.Printf("   CI/CD:  %v", boolToEmoji(info.HasCI))
+
+	term.Println("\n🔍 " + i18n.T("Detection:"))
+	term.Printf("   Docker: %v\n", boolToEmoji(info.HasDocker))
+	term.Printf("   CI/CD:  %v", boolToEmoji(info.HasCI))
 	if info.CIPlatform != "" {
-		fmt.Printf(" (%s)", info.CIPlatform)
+		term.Printf(" (%s)", info.CIPlatform)
 	}
-	fmt.Println()
+	term.Println()
 
 	if len(info.Ports) > 0 {
-		fmt.Printf("   Ports:  %v\n", info.Ports)
+		term.Printf("   %s\n", i18n.T("Ports:  %v", info.Ports))
+	}
+	if len(info.QualityTools) > 0 {
+		var tools []string
+		for _, t := range info.QualityTools {
+			tools = append(tools, fmt.Sprintf("%s (%s)", t.Name, t.Kind))
+		}
+		term.Printf("   %s\n", i18n.T("Quality: %s", strings.Join(tools, ", ")))
+	}
+	if info.Bazel != nil {
+		term.Printf("   %s\n", i18n.T("Bazel: %s", info.Bazel.summary()))
+	}
+	if len(info.CodeGenerators) > 0 {
+		var generators []string
+		for _, g := range info.CodeGenerators {
+			generators = append(generators, g.Name)
+		}
+		term.Printf("   %s\n", i18n.T("Codegen: %s", strings.Join(generators, ", ")))
+	}
+	if info.E2E != nil {
+		term.Printf("   %s\n", i18n.T("E2E: %s (%s)", info.E2E.Framework, info.E2E.Command))
+	}
+	if info.Monorepo != nil {
+		term.Printf("   %s\n", i18n.T("Monorepo: %s (%s)", info.Monorepo.Tool, strings.Join(info.Monorepo.Tasks, ", ")))
 	}
 
 	if len(info.Suggestions) > 0 {
-		fmt.Println("\n💡 Suggestions:")
+		term.Println("\n💡 " + i18n.T("Suggestions:"))
 		for _, s := range info.Suggestions {
 			icon := "ℹ️"
 			if s.Severity == "warning" {
@@ -618,15 +720,15 @@ func (info *ProjectInfo) PrintReport() {
 			} else if s.Severity == "critical" {
 				icon = "🚨"
 			}
-			fmt.Printf("   %s %s\n", icon, s.Title)
-			fmt.Printf("      %s\n", s.Description)
+			term.Printf("   %s %s\n", icon, s.Title)
+			term.Printf("      %s\n", s.Description)
 			if s.Fix != "" {
-				fmt.Printf("      → %s\n", s.Fix)
+				term.Printf("      → %s\n", s.Fix)
 			}
 		}
 	}
-	
-	fmt.Println()
+
+	term.Println()
 }
 
 func boolToEmoji(b bool) string {
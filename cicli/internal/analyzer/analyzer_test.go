@@ -0,0 +1,43 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cicli/internal/marker"
+)
+
+// TestAnalyzeStableHash analyzes the same project repeatedly: generated
+// files record a hash of the analysis, so it must not change between runs
+func TestAnalyzeStableHash(t *testing.T) {
+	dir := t.TempDir()
+	pkg := `{
+  "name": "app",
+  "dependencies": {"next": "14", "react": "18", "react-dom": "18", "express": "4", "zod": "3"},
+  "devDependencies": {"jest": "29", "@playwright/test": "1", "cypress": "13", "vitest": "1", "eslint": "8", "prettier": "3"},
+  "scripts": {"test": "jest", "build": "next build"}
+}`
+	if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte(pkg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var first string
+	for i := 0; i < 20; i++ {
+		info, err := NewAnalyzer(dir).Analyze()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := marker.Hash(info)
+		if i == 0 {
+			first = hash
+			if info.Framework != "nextjs" || info.TestFramework != "vitest" {
+				t.Errorf("framework %q, test framework %q; want nextjs and vitest", info.Framework, info.TestFramework)
+			}
+			continue
+		}
+		if hash != first {
+			t.Fatalf("run %d hashed the analysis as %s, run 1 as %s", i+1, hash, first)
+		}
+	}
+}
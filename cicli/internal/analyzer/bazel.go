@@ -0,0 +1,141 @@
+package analyzer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// BazelInfo describes a Bazel workspace. Bazel builds and tests the whole
+// repository, whatever languages it contains.
+type BazelInfo struct {
+	Bzlmod      bool          `json:"bzlmod"`            // MODULE.bazel rather than WORKSPACE
+	Version     string        `json:"version,omitempty"` // pinned in .bazelversion
+	CIConfig    bool          `json:"ci_config"`         // .bazelrc defines a ci config (--config=ci)
+	RemoteCache bool          `json:"remote_cache"`      // .bazelrc already sets --remote_cache
+	RulesOCI    bool          `json:"rules_oci"`
+	Binaries    []BazelTarget `json:"binaries,omitempty"`
+	Images      []BazelTarget `json:"images,omitempty"` // oci_image and oci_push targets
+}
+
+// BazelTarget is a rule declared in a BUILD file
+type BazelTarget struct {
+	Kind  string `json:"kind"`  // e.g. go_binary
+	Label string `json:"label"` // e.g. //cmd/server:server
+}
+
+// bazelWorkspaceFiles mark the root of a Bazel workspace
+var bazelWorkspaceFiles = []string{"MODULE.bazel", "WORKSPACE.bazel", "WORKSPACE"}
+
+var (
+	// bazelRulePattern matches a rule call, allowing one level of nested
+	// calls such as glob() in its attributes
+	bazelRulePattern   = regexp.MustCompile(`\b(\w+_binary|oci_image|oci_push)\(((?:[^()]|\([^()]*\))*)\)`)
+	bazelNamePattern   = regexp.MustCompile(`\bname\s*=\s*"([^"]+)"`)
+	bazelCIConfig      = regexp.MustCompile(`(?m)^\s*\w+:ci\s`)
+	bazelRemoteCacheRe = regexp.MustCompile(`--remote_cache[= ]`)
+)
+
+// detectBazel recognises a Bazel workspace, whose build and test commands
+// take over from the language's own
+func (a *Analyzer) detectBazel(info *ProjectInfo) {
+	workspace := ""
+	for _, file := range bazelWorkspaceFiles {
+		if a.fileExists(file) {
+			workspace = file
+			break
+		}
+	}
+	if workspace == "" {
+		return
+	}
+
+	rc := a.readFile(".bazelrc")
+	bazel := &BazelInfo{
+		Bzlmod:      workspace == "MODULE.bazel",
+		Version:     strings.TrimSpace(a.readFile(".bazelversion")),
+		CIConfig:    bazelCIConfig.MatchString(rc),
+		RemoteCache: bazelRemoteCacheRe.MatchString(rc),
+	}
+	for _, file := range bazelWorkspaceFiles {
+		if strings.Contains(a.readFile(file), "rules_oci") {
+			bazel.RulesOCI = true
+		}
+	}
+	a.findBazelTargets(bazel)
+
+	info.Bazel = bazel
+	info.PackageManager = "bazel"
+	info.BuildCommand = "bazel build //..."
+	info.TestCommand = "bazel test //..."
+	info.TestFramework = "bazel"
+}
+
+// findBazelTargets collects the binaries and rules_oci images declared in
+// the workspace's BUILD files
+func (a *Analyzer) findBazelTargets(bazel *BazelInfo) {
+	_ = filepath.WalkDir(a.rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if name := d.Name(); path != a.rootPath && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "bazel-") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "BUILD" && d.Name() != "BUILD.bazel" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		pkg, _ := filepath.Rel(a.rootPath, filepath.Dir(path))
+		pkg = strings.TrimPrefix(filepath.ToSlash(pkg), ".")
+
+		for _, m := range bazelRulePattern.FindAllStringSubmatch(string(data), -1) {
+			name := bazelNamePattern.FindStringSubmatch(m[2])
+			if name == nil {
+				continue
+			}
+			target := BazelTarget{Kind: m[1], Label: "//" + pkg + ":" + name[1]}
+			if strings.HasPrefix(m[1], "oci_") {
+				bazel.Images = append(bazel.Images, target)
+			} else {
+				bazel.Binaries = append(bazel.Binaries, target)
+			}
+		}
+		return nil
+	})
+}
+
+// ImageTarget returns the first rules_oci target of the given kind, or ""
+func (b *BazelInfo) ImageTarget(kind string) string {
+	for _, t := range b.Images {
+		if t.Kind == kind {
+			return t.Label
+		}
+	}
+	return ""
+}
+
+// summary lists the workspace's notable settings for the report
+func (b *BazelInfo) summary() string {
+	parts := []string{"WORKSPACE"}
+	if b.Bzlmod {
+		parts[0] = "bzlmod"
+	}
+	if b.Version != "" {
+		parts = append(parts, b.Version)
+	}
+	if b.RemoteCache {
+		parts = append(parts, "remote cache")
+	}
+	if b.RulesOCI {
+		parts = append(parts, "rules_oci")
+	}
+	return strings.Join(parts, ", ")
+}
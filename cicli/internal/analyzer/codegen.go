@@ -0,0 +1,83 @@
+package analyzer
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CodeGenerator is a code generation tool whose output is committed, so CI
+// can check that the output is up to date
+type CodeGenerator struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`  // config file it was detected from
+	Command string `json:"command"` // regenerates the code from the project root
+}
+
+// codeGenerators maps config files to the generator they belong to, in the
+// order generators should run
+var codeGenerators = []struct {
+	name    string
+	files   []string
+	command string
+}{
+	{"buf", []string{"buf.gen.yaml", "buf.gen.yml"}, "buf generate"},
+	{"openapi-generator", []string{"openapitools.json"}, "npx --yes @openapitools/openapi-generator-cli generate"},
+	{"sqlc", []string{"sqlc.yaml", "sqlc.yml", "sqlc.json"}, "sqlc generate"},
+	{"gqlgen", []string{"gqlgen.yml", "gqlgen.yaml", ".gqlgen.yml"}, "go run github.com/99designs/gqlgen generate"},
+}
+
+// detectCodeGenerators finds generators configured in the project, plus
+// //go:generate directives, which often wrap protoc, mockgen or stringer
+func (a *Analyzer) detectCodeGenerators(info *ProjectInfo) {
+	for _, g := range codeGenerators {
+		for _, file := range g.files {
+			if a.fileExists(file) {
+				info.CodeGenerators = append(info.CodeGenerators, CodeGenerator{Name: g.name, Source: file, Command: g.command})
+				break
+			}
+		}
+	}
+
+	if info.Language == "go" {
+		if file := a.findGoGenerate(); file != "" {
+			info.CodeGenerators = append(info.CodeGenerators, CodeGenerator{Name: "go generate", Source: file, Command: "go generate ./..."})
+		}
+	}
+}
+
+// findGoGenerate returns the first Go file with a //go:generate directive
+func (a *Analyzer) findGoGenerate() string {
+	found := ""
+	_ = filepath.WalkDir(a.rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if name := d.Name(); path != a.rootPath && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "//go:generate ") {
+				rel, _ := filepath.Rel(a.rootPath, path)
+				found = filepath.ToSlash(rel)
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	return found
+}
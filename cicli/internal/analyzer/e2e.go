@@ -0,0 +1,170 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// E2EInfo describes the browser test suite of a project and how CI boots
+// the app it tests
+type E2EInfo struct {
+	Framework   string   `json:"framework"`              // playwright, cypress or selenium
+	Source      string   `json:"source"`                 // config file or dependency it was detected from
+	Command     string   `json:"command"`                // runs the suite
+	Start       string   `json:"start,omitempty"`        // boots the app in the background; empty when the framework does it
+	ComposeFile string   `json:"compose_file,omitempty"` // boots the app with docker compose instead
+	URL         string   `json:"url,omitempty"`          // waited on before the tests start
+	Artifacts   []string `json:"artifacts"`              // traces, screenshots and videos kept on failure
+}
+
+// e2eFrameworks lists the browser test frameworks in detection order, with
+// the files, node and Python dependencies that identify them
+var e2eFrameworks = []struct {
+	name      string
+	files     []string
+	nodeDep   string
+	pythonDep string
+	artifacts []string
+}{
+	{"playwright", []string{"playwright.config.ts", "playwright.config.js", "playwright.config.mjs"}, "@playwright/test", "pytest-playwright", []string{"test-results/", "playwright-report/"}},
+	{"cypress", []string{"cypress.config.ts", "cypress.config.js", "cypress.config.mjs", "cypress.json"}, "cypress", "", []string{"cypress/screenshots/", "cypress/videos/"}},
+	{"selenium", nil, "selenium-webdriver", "selenium", []string{"screenshots/"}},
+}
+
+// e2eScripts are package.json scripts that run the browser suite, preferred
+// over the framework's own command since they carry the project's flags
+var e2eScripts = []string{"test:e2e", "e2e", "e2e:ci", "test:browser"}
+
+// startScripts are package.json scripts that serve the app, in preference order
+var startScripts = []string{"start:ci", "start", "preview", "serve", "dev"}
+
+var (
+	webServerPattern = regexp.MustCompile(`\bwebServer\s*:`)
+	baseURLPattern   = regexp.MustCompile(`\bbaseU[rR][lL]\s*[:=]\s*['"]([^'"]+)['"]`)
+	// publishedPort matches the host side of a compose "8080:80" port mapping
+	publishedPort = regexp.MustCompile(`(?m)^\s*-\s*["']?(?:[\d.]+:)?(\d{2,5}):\d{2,5}|ports:\s*\[\s*["']?(\d{2,5}):\d{2,5}`)
+)
+
+// detectE2E finds a Playwright, Cypress or Selenium suite and works out how
+// to start the app it runs against
+func (a *Analyzer) detectE2E(info *ProjectInfo) {
+	deps := make(map[string]bool)
+	for _, d := range append(append([]string{}, info.Dependencies...), info.DevDependencies...) {
+		deps[d] = true
+	}
+	python := ""
+	for _, file := range pythonManifests {
+		python += a.readFile(file) + "\n"
+	}
+
+	for _, f := range e2eFrameworks {
+		source := ""
+		for _, file := range f.files {
+			if a.fileExists(file) {
+				source = file
+				break
+			}
+		}
+		if source == "" && f.nodeDep != "" && deps[f.nodeDep] {
+			source = "package.json"
+		}
+		if source == "" && f.pythonDep != "" && info.Language == "python" &&
+			regexp.MustCompile(`(?mi)(^|["'\s])`+regexp.QuoteMeta(f.pythonDep)+`\s*([<>=~!;\[,"']|$)`).MatchString(python) {
+			source = "requirements"
+		}
+		if source == "" {
+			continue
+		}
+
+		e2e := &E2EInfo{Framework: f.name, Source: source, Artifacts: f.artifacts}
+		a.e2eCommands(info, e2e)
+		info.E2E = e2e
+		return
+	}
+}
+
+// e2eCommands fills in the commands that run the suite and boot the app
+func (a *Analyzer) e2eCommands(info *ProjectInfo, e2e *E2EInfo) {
+	config := ""
+	if e2e.Source != "package.json" && e2e.Source != "requirements" {
+		config = a.readFile(e2e.Source)
+	}
+	if m := baseURLPattern.FindStringSubmatch(config); m != nil && !strings.Contains(m[1], "${") {
+		e2e.URL = m[1]
+	}
+
+	var scripts map[string]interface{}
+	if info.Language == "node" {
+		var pkg map[string]interface{}
+		if err := json.Unmarshal([]byte(a.readFile("package.json")), &pkg); err == nil {
+			scripts, _ = pkg["scripts"].(map[string]interface{})
+		}
+	}
+	pm := info.PackageManager
+	if pm == "" {
+		pm = "npm"
+	}
+
+	switch {
+	case info.Language == "python":
+		e2e.Command = "pytest"
+		if e2e.Framework == "playwright" {
+			e2e.Command = "pytest --tracing=retain-on-failure --screenshot=only-on-failure"
+		}
+	case e2e.Framework == "playwright":
+		e2e.Command = "npx playwright test"
+	case e2e.Framework == "cypress":
+		e2e.Command = "npx cypress run"
+	default:
+		e2e.Command = info.TestCommand
+	}
+	for _, name := range e2eScripts {
+		if _, ok := scripts[name]; ok {
+			e2e.Command = fmt.Sprintf("%s run %s", pm, name)
+			break
+		}
+	}
+
+	// Playwright boots the app itself when its config has a webServer
+	if e2e.Framework == "playwright" && webServerPattern.MatchString(config) {
+		return
+	}
+	for _, file := range []string{"docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"} {
+		if a.fileExists(file) {
+			e2e.ComposeFile = file
+			break
+		}
+	}
+	if e2e.ComposeFile == "" {
+		for _, name := range startScripts {
+			if _, ok := scripts[name]; ok {
+				e2e.Start = fmt.Sprintf("%s run %s", pm, name)
+				break
+			}
+		}
+		if e2e.Start == "" && info.Language == "python" {
+			switch {
+			case a.fileExists("manage.py"):
+				e2e.Start = "python manage.py runserver 0.0.0.0:8000"
+			case info.EntryPoint != "":
+				e2e.Start = "python " + filepath.ToSlash(info.EntryPoint)
+			}
+		}
+	}
+	if e2e.URL == "" && (e2e.Start != "" || e2e.ComposeFile != "") {
+		port := 3000
+		if info.Language == "python" {
+			port = 8000
+		}
+		if len(info.Ports) > 0 {
+			port = info.Ports[0]
+		}
+		if m := publishedPort.FindStringSubmatch(a.readFile(e2e.ComposeFile)); e2e.ComposeFile != "" && m != nil {
+			fmt.Sscanf(m[1]+m[2], "%d", &port)
+		}
+		e2e.URL = fmt.Sprintf("http://localhost:%d", port)
+	}
+}
@@ -0,0 +1,69 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// MonorepoInfo describes an Nx or Turborepo workspace, whose tasks CI should
+// only run for the packages a change affects
+type MonorepoInfo struct {
+	Tool   string   `json:"tool"`   // nx or turborepo
+	Source string   `json:"source"` // nx.json or turbo.json
+	Tasks  []string `json:"tasks"`  // lint, test and build tasks the workspace defines, in that order
+}
+
+// monorepoTasks are the tasks CI runs, in order, when the workspace defines them
+var monorepoTasks = []string{"lint", "test", "build"}
+
+// detectMonorepo recognises nx.json and turbo.json workspaces
+func (a *Analyzer) detectMonorepo(info *ProjectInfo) {
+	var config map[string]json.RawMessage
+	repo := &MonorepoInfo{}
+	switch {
+	case a.fileExists("nx.json"):
+		repo.Tool, repo.Source = "nx", "nx.json"
+	case a.fileExists("turbo.json"):
+		repo.Tool, repo.Source = "turborepo", "turbo.json"
+	default:
+		return
+	}
+	_ = json.Unmarshal([]byte(a.readFile(repo.Source)), &config)
+
+	// Nx keeps task settings in targetDefaults; Turborepo in tasks (v2) or pipeline (v1)
+	var defined map[string]json.RawMessage
+	for _, key := range []string{"targetDefaults", "tasks", "pipeline"} {
+		if raw, ok := config[key]; ok {
+			_ = json.Unmarshal(raw, &defined)
+			break
+		}
+	}
+	for _, task := range monorepoTasks {
+		if _, ok := defined[task]; ok {
+			repo.Tasks = append(repo.Tasks, task)
+		}
+	}
+	switch {
+	case len(repo.Tasks) > 0:
+	case repo.Tool == "nx":
+		// Nx infers targets from package.json scripts, so assume the usual ones
+		repo.Tasks = append(repo.Tasks, monorepoTasks...)
+	default:
+		// Turborepo only runs tasks turbo.json declares
+		for task := range defined {
+			repo.Tasks = append(repo.Tasks, task)
+		}
+		sort.Strings(repo.Tasks)
+	}
+	info.Monorepo = repo
+}
+
+// HasTask reports whether CI runs the named workspace task
+func (m *MonorepoInfo) HasTask(task string) bool {
+	for _, t := range m.Tasks {
+		if t == task {
+			return true
+		}
+	}
+	return false
+}
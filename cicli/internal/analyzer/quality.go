@@ -0,0 +1,131 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// QualityTool is a lint, format or coverage tool the project is set up for
+type QualityTool struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`   // lint, format or coverage
+	Source string `json:"source"` // config file or dependency it was detected from
+}
+
+// qualitySignal describes how to recognise one tool: any of its config
+// files, a package.json key, a node dependency, a Python requirement, or a
+// snippet of a Maven/Gradle build
+type qualitySignal struct {
+	name, kind string
+	files      []string // globs relative to the project root
+	pkgKey     string
+	nodeDep    string
+	pythonDep  string
+	pyproject  string // [tool.x] table in pyproject.toml
+	buildText  string // text in pom.xml or build.gradle(.kts)
+}
+
+var qualitySignals = []qualitySignal{
+	{name: "eslint", kind: "lint", files: []string{".eslintrc", ".eslintrc.*", "eslint.config.*"}, pkgKey: "eslintConfig", nodeDep: "eslint"},
+	{name: "prettier", kind: "format", files: []string{".prettierrc", ".prettierrc.*", "prettier.config.*"}, pkgKey: "prettier", nodeDep: "prettier"},
+	{name: "ruff", kind: "lint", files: []string{"ruff.toml", ".ruff.toml"}, pythonDep: "ruff", pyproject: "tool.ruff"},
+	{name: "black", kind: "format", pythonDep: "black", pyproject: "tool.black"},
+	{name: "golangci-lint", kind: "lint", files: []string{".golangci.yml", ".golangci.yaml", ".golangci.toml", ".golangci.json"}},
+	{name: "checkstyle", kind: "lint", files: []string{"checkstyle.xml", "config/checkstyle/checkstyle.xml"}, buildText: "checkstyle"},
+	{name: "nyc", kind: "coverage", files: []string{".nycrc", ".nycrc.*", "nyc.config.js"}, pkgKey: "nyc", nodeDep: "nyc"},
+	{name: "c8", kind: "coverage", files: []string{".c8rc", ".c8rc.*"}, pkgKey: "c8", nodeDep: "c8"},
+	{name: "coverage.py", kind: "coverage", files: []string{".coveragerc"}, pythonDep: "pytest-cov", pyproject: "tool.coverage"},
+	{name: "jacoco", kind: "coverage", buildText: "jacoco"},
+}
+
+// pythonManifests are read for Python requirements, in this order
+var pythonManifests = []string{"requirements.txt", "requirements-dev.txt", "dev-requirements.txt", "pyproject.toml", "Pipfile", "setup.cfg"}
+
+// detectQualityTools finds the lint, format and coverage tools configured
+// in the project, so generated pipelines can run them
+func (a *Analyzer) detectQualityTools(info *ProjectInfo) {
+	var pkg map[string]json.RawMessage
+	if data, err := os.ReadFile(filepath.Join(a.rootPath, "package.json")); err == nil {
+		_ = json.Unmarshal(data, &pkg)
+	}
+	nodeDeps := make(map[string]bool)
+	for _, d := range append(append([]string{}, info.Dependencies...), info.DevDependencies...) {
+		nodeDeps[d] = true
+	}
+	pyproject := a.readFile("pyproject.toml")
+	build := a.readFile("pom.xml") + a.readFile("build.gradle") + a.readFile("build.gradle.kts")
+
+	for _, s := range qualitySignals {
+		if source := a.qualitySource(s, pkg, nodeDeps, pyproject, build); source != "" {
+			info.QualityTools = append(info.QualityTools, QualityTool{Name: s.name, Kind: s.kind, Source: source})
+		}
+	}
+}
+
+func (a *Analyzer) qualitySource(s qualitySignal, pkg map[string]json.RawMessage, nodeDeps map[string]bool, pyproject, build string) string {
+	for _, pattern := range s.files {
+		matches, _ := filepath.Glob(filepath.Join(a.rootPath, pattern))
+		if len(matches) > 0 {
+			rel, _ := filepath.Rel(a.rootPath, matches[0])
+			return filepath.ToSlash(rel)
+		}
+	}
+	if s.pkgKey != "" && pkg[s.pkgKey] != nil {
+		return "package.json"
+	}
+	if s.nodeDep != "" && nodeDeps[s.nodeDep] {
+		return "package.json"
+	}
+	if s.pyproject != "" && regexp.MustCompile(`(?m)^\[`+regexp.QuoteMeta(s.pyproject)+`[\].]`).MatchString(pyproject) {
+		return "pyproject.toml"
+	}
+	if s.pythonDep != "" {
+		dep := regexp.MustCompile(`(?mi)(^|["'\s])` + regexp.QuoteMeta(s.pythonDep) + `\s*([<>=~!;\[,"']|$)`)
+		for _, file := range pythonManifests {
+			if dep.MatchString(a.readFile(file)) {
+				return file
+			}
+		}
+	}
+	if s.buildText != "" && strings.Contains(build, s.buildText) {
+		if strings.Contains(a.readFile("pom.xml"), s.buildText) {
+			return "pom.xml"
+		}
+		if strings.Contains(a.readFile("build.gradle"), s.buildText) {
+			return "build.gradle"
+		}
+		return "build.gradle.kts"
+	}
+	return ""
+}
+
+func (a *Analyzer) readFile(name string) string {
+	data, err := os.ReadFile(filepath.Join(a.rootPath, name))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// HasQualityTool reports whether the named tool was detected
+func (info *ProjectInfo) HasQualityTool(name string) bool {
+	for _, t := range info.QualityTools {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CoverageTool returns the detected coverage tool, or ""
+func (info *ProjectInfo) CoverageTool() string {
+	for _, t := range info.QualityTools {
+		if t.Kind == "coverage" {
+			return t.Name
+		}
+	}
+	return ""
+}
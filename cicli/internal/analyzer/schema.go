@@ -0,0 +1,29 @@
+package analyzer
+
+import _ "embed"
+
+// SchemaVersion is the major version of the analysis report schema. Fields
+// are added without changing it; removing, renaming or retyping one
+// increments it and publishes the schema under a new file name.
+const SchemaVersion = 1
+
+// SchemaURL is where the schema is published, and the $schema of reports
+const SchemaURL = "https://raw.githubusercontent.com/Arnab-Afk/CiCLI/main/cicli/internal/analyzer/project-info.v1.schema.json"
+
+// Schema is the JSON Schema of Report
+//
+//go:embed project-info.v1.schema.json
+var Schema []byte
+
+// Report is the document analyze writes as JSON or YAML: the project info
+// with the schema it follows
+type Report struct {
+	Schema        string `json:"$schema"`
+	SchemaVersion int    `json:"schema_version"`
+	*ProjectInfo
+}
+
+// NewReport wraps info for encoding
+func NewReport(info *ProjectInfo) Report {
+	return Report{Schema: SchemaURL, SchemaVersion: SchemaVersion, ProjectInfo: info}
+}
@@ -0,0 +1,184 @@
+package anchors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Anchor is a node defined with &name
+type Anchor struct {
+	Name string
+	Line int
+	Used int
+}
+
+// Warning describes a place where expanding anchors, aliases or merge keys
+// does not mean what the file appears to say
+type Warning struct {
+	Line    int
+	Message string
+}
+
+// Report summarizes anchor usage in a YAML document
+type Report struct {
+	Anchors  []*Anchor
+	Aliases  int
+	Merges   int
+	Warnings []Warning
+}
+
+// Uses reports whether the document relies on anchors at all
+func (r *Report) Uses() bool {
+	return len(r.Anchors) > 0 || r.Aliases > 0 || r.Merges > 0
+}
+
+// Scan walks the YAML node tree (before expansion) and records anchors,
+// aliases and merge keys, flagging constructs whose expanded form differs
+// from what readers usually expect
+func Scan(content []byte) (*Report, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, err
+	}
+
+	s := &scanner{report: &Report{}, anchors: make(map[string]*Anchor)}
+	s.walk(&root)
+
+	for _, a := range s.report.Anchors {
+		if a.Used == 0 {
+			s.warn(a.Line, fmt.Sprintf("anchor '&%s' is never used", a.Name))
+		}
+	}
+	sort.SliceStable(s.report.Warnings, func(i, j int) bool {
+		return s.report.Warnings[i].Line < s.report.Warnings[j].Line
+	})
+	return s.report, nil
+}
+
+type scanner struct {
+	report  *Report
+	anchors map[string]*Anchor
+}
+
+func (s *scanner) warn(line int, msg string) {
+	s.report.Warnings = append(s.report.Warnings, Warning{Line: line, Message: msg})
+}
+
+func (s *scanner) walk(n *yaml.Node) {
+	if n == nil {
+		return
+	}
+
+	if n.Anchor != "" {
+		a := &Anchor{Name: n.Anchor, Line: n.Line}
+		s.anchors[n.Anchor] = a
+		s.report.Anchors = append(s.report.Anchors, a)
+	}
+	if n.Tag == "!reference" {
+		s.warn(n.Line, "GitLab !reference tags are not expanded; tools that read the expanded YAML see the raw reference")
+	}
+
+	switch n.Kind {
+	case yaml.AliasNode:
+		s.report.Aliases++
+		if a, ok := s.anchors[n.Value]; ok {
+			a.Used++
+		}
+		return
+
+	case yaml.MappingNode:
+		s.checkMerges(n)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			s.walk(n.Content[i])
+			s.walk(n.Content[i+1])
+		}
+		return
+
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			if item.Kind == yaml.AliasNode && item.Alias != nil && item.Alias.Kind == yaml.SequenceNode {
+				s.warn(item.Line, fmt.Sprintf("alias '*%s' inserts a nested list; GitLab flattens script arrays but the expanded YAML keeps the nesting", item.Value))
+			}
+		}
+	}
+
+	for _, child := range n.Content {
+		s.walk(child)
+	}
+}
+
+// checkMerges inspects << keys in a mapping
+func (s *scanner) checkMerges(n *yaml.Node) {
+	local := make(map[string]*yaml.Node)
+	var merged []*yaml.Node
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		if key.Kind != yaml.ScalarNode || key.Tag != "!!merge" {
+			local[key.Value] = value
+			continue
+		}
+
+		s.report.Merges++
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+		for _, src := range sources {
+			target := src
+			if src.Kind == yaml.AliasNode {
+				target = src.Alias
+			}
+			if target == nil || target.Kind != yaml.MappingNode {
+				s.warn(key.Line, "merge key '<<' must reference a mapping")
+				continue
+			}
+			merged = append(merged, src)
+		}
+	}
+
+	// Merge keys are shallow: a local mapping replaces the merged one entirely
+	for _, src := range merged {
+		target := src
+		if src.Kind == yaml.AliasNode {
+			target = src.Alias
+		}
+		for i := 0; i+1 < len(target.Content); i += 2 {
+			name := target.Content[i].Value
+			override, ok := local[name]
+			if !ok {
+				continue
+			}
+			if target.Content[i+1].Kind == yaml.MappingNode && override.Kind == yaml.MappingNode {
+				s.warn(override.Line, fmt.Sprintf("'%s' replaces the whole mapping from %s (merge keys are shallow, keys are not combined)", name, describe(src)))
+			} else if target.Content[i+1].Kind == yaml.SequenceNode && override.Kind == yaml.SequenceNode {
+				s.warn(override.Line, fmt.Sprintf("'%s' replaces the list from %s instead of extending it", name, describe(src)))
+			}
+		}
+	}
+}
+
+func describe(n *yaml.Node) string {
+	if n.Kind == yaml.AliasNode {
+		return "anchor '" + n.Value + "'"
+	}
+	return "the merged mapping"
+}
+
+// Summary returns a one-line description for reports
+func (r *Report) Summary() string {
+	var parts []string
+	if len(r.Anchors) > 0 {
+		parts = append(parts, fmt.Sprintf("%d anchor(s)", len(r.Anchors)))
+	}
+	if r.Aliases > 0 {
+		parts = append(parts, fmt.Sprintf("%d alias(es)", r.Aliases))
+	}
+	if r.Merges > 0 {
+		parts = append(parts, fmt.Sprintf("%d merge key(s)", r.Merges))
+	}
+	return strings.Join(parts, ", ")
+}
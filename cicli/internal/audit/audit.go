@@ -0,0 +1,204 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cicli/internal/linter"
+	"cicli/internal/optimizer"
+	"cicli/internal/term"
+)
+
+// DefaultBaseline is where the previous report is kept between runs
+var DefaultBaseline = filepath.Join(".cicli", "audit", "last.json")
+
+// Finding is one lint or optimization result
+type Finding struct {
+	Source   string `json:"source"` // lint, optimize
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"` // error, warning, info
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Key identifies a finding across runs. Line numbers are left out so
+// unrelated edits that move a finding do not count as a regression.
+func (f Finding) Key() string {
+	return strings.Join([]string{f.Source, f.Rule, f.File, f.Message}, "|")
+}
+
+// Report is the result of one audit run
+type Report struct {
+	Timestamp time.Time `json:"timestamp"`
+	Findings  []Finding `json:"findings"`
+}
+
+// Diff compares a report against its baseline
+type Diff struct {
+	New   []Finding `json:"new"`
+	Fixed []Finding `json:"fixed"`
+}
+
+// Run lints and optimizes every CI file below root
+func Run(root string) (*Report, error) {
+	report := &Report{Timestamp: time.Now()}
+
+	results, err := linter.NewLinter().LintDirectory(root)
+	if err != nil {
+		return nil, err
+	}
+	o := optimizer.NewOptimizer()
+	for _, r := range results {
+		for _, issue := range r.Issues {
+			report.Findings = append(report.Findings, Finding{
+				Source:   "lint",
+				Rule:     issue.Rule,
+				Severity: string(issue.Severity),
+				File:     r.File,
+				Line:     issue.Line,
+				Message:  issue.Message,
+			})
+		}
+
+		opt, err := o.Analyze(r.File)
+		if err != nil {
+			continue
+		}
+		for _, op := range opt.Optimizations {
+			report.Findings = append(report.Findings, Finding{
+				Source:   "optimize",
+				Rule:     op.Category,
+				Severity: impactSeverity(op.Impact),
+				File:     r.File,
+				Message:  op.Title,
+			})
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Key() < report.Findings[j].Key()
+	})
+	return report, nil
+}
+
+// impactSeverity ranks optimizations next to lint findings
+func impactSeverity(impact string) string {
+	switch impact {
+	case "high":
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// Load reads a report saved by Save
+func Load(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid audit report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// Save writes the report as JSON, e.g. for upload as a CI artifact
+func (r *Report) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Compare returns the findings added and fixed since baseline
+func Compare(baseline, current *Report) *Diff {
+	d := &Diff{New: []Finding{}, Fixed: []Finding{}}
+	before := make(map[string]int)
+	for _, f := range baseline.Findings {
+		before[f.Key()]++
+	}
+	for _, f := range current.Findings {
+		if before[f.Key()] > 0 {
+			before[f.Key()]--
+			continue
+		}
+		d.New = append(d.New, f)
+	}
+
+	after := make(map[string]int)
+	for _, f := range current.Findings {
+		after[f.Key()]++
+	}
+	for _, f := range baseline.Findings {
+		if after[f.Key()] > 0 {
+			after[f.Key()]--
+			continue
+		}
+		d.Fixed = append(d.Fixed, f)
+	}
+	return d
+}
+
+var severityRank = map[string]int{"info": 0, "warning": 1, "error": 2}
+
+// Regressions returns new findings at or above minSeverity
+func (d *Diff) Regressions(minSeverity string) []Finding {
+	var out []Finding
+	for _, f := range d.New {
+		if severityRank[f.Severity] >= severityRank[minSeverity] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// PrintReport prints new and fixed findings
+func (d *Diff) PrintReport(minSeverity string) {
+	regressions := d.Regressions(minSeverity)
+	term.Printf("🛡️  Audit: %d new, %d fixed, %d regression(s) at %s or above\n", len(d.New), len(d.Fixed), len(regressions), minSeverity)
+	term.Println(strings.Repeat("─", 50))
+
+	if len(d.New) > 0 {
+		term.Println("\n   New:")
+		for _, f := range d.New {
+			printFinding(f)
+		}
+	}
+	if len(d.Fixed) > 0 {
+		term.Println("\n   ✅ Fixed:")
+		for _, f := range d.Fixed {
+			printFinding(f)
+		}
+	}
+	term.Println()
+}
+
+func printFinding(f Finding) {
+	location := f.File
+	if f.Line > 0 {
+		location = fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+	term.Printf("      [%s %s] %s (%s, %s)\n", f.Source, f.Rule, f.Message, f.Severity, location)
+}
+
+// Summary is a one-line description used for notifications
+func (d *Diff) Summary(minSeverity string) string {
+	regressions := d.Regressions(minSeverity)
+	var rules []string
+	for _, f := range regressions {
+		rules = append(rules, f.Rule)
+	}
+	return fmt.Sprintf("%d CI audit regression(s): %s", len(regressions), strings.Join(rules, ", "))
+}
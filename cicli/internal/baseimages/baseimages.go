@@ -0,0 +1,385 @@
+package baseimages
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"cicli/internal/term"
+)
+
+// Supported maps official images to the oldest version still receiving
+// security fixes
+var Supported = map[string]string{
+	"node":     "22",
+	"python":   "3.10",
+	"ruby":     "3.3",
+	"golang":   "1.25",
+	"php":      "8.2",
+	"postgres": "14",
+	"mysql":    "8.4",
+	"mongo":    "7.0",
+	"alpine":   "3.21",
+	"ubuntu":   "22.04",
+	"debian":   "12",
+}
+
+// ciFiles are the CI files whose job, service and step images are checked
+var ciFiles = []string{
+	".github/workflows/*.yml",
+	".github/workflows/*.yaml",
+	".gitlab-ci.yml",
+	".circleci/config.yml",
+	"azure-pipelines.yml",
+	"bitbucket-pipelines.yml",
+	".drone.yml",
+	".woodpecker.yml",
+	".buildkite/pipeline.yml",
+}
+
+// skipDirs are not searched for Dockerfiles
+var skipDirs = map[string]bool{".git": true, "node_modules": true, "vendor": true, ".cicli": true}
+
+// fromPattern matches a Dockerfile FROM instruction and its stage name
+var fromPattern = regexp.MustCompile(`(?i)^\s*FROM\s+(?:--platform=\S+\s+)?(\S+)(?:\s+AS\s+(\S+))?`)
+
+// tagPattern splits a tag into its dotted version and the variant after it,
+// e.g. 20.11.1-alpine3.19 into 20.11.1 and -alpine3.19
+var tagPattern = regexp.MustCompile(`^(\d+(?:\.\d+)*)(.*)$`)
+
+// Reference is an image named in a Dockerfile or CI file
+type Reference struct {
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+	Image string `json:"image"`
+}
+
+// Finding is an image with a tag to move to
+type Finding struct {
+	Reference
+	Kind      string `json:"kind"` // eol or patch
+	Suggested string `json:"suggested"`
+	Reason    string `json:"reason"`
+}
+
+// Find returns the base images of the Dockerfiles under root and the job,
+// service and step images of its CI files. Images from variables, digests
+// and Dockerfile stages are skipped.
+func Find(root string) ([]Reference, error) {
+	var refs []Reference
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && skipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isDockerfile(d.Name()) {
+			found, err := dockerfileImages(path)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, found...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range ciFiles {
+		matches, _ := filepath.Glob(filepath.Join(root, pattern))
+		for _, path := range matches {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			var doc yaml.Node
+			if yaml.Unmarshal(content, &doc) != nil {
+				continue
+			}
+			collectImages(&doc, func(node *yaml.Node) {
+				ref := strings.TrimPrefix(node.Value, "docker://")
+				if checkable(ref) {
+					refs = append(refs, Reference{File: path, Line: node.Line, Image: ref})
+				}
+			})
+		}
+	}
+	return refs, nil
+}
+
+// isDockerfile matches Dockerfile, Containerfile, Dockerfile.<name> and
+// <name>.Dockerfile, but not the .bak backups written by --apply or
+// per-Dockerfile ignore files
+func isDockerfile(name string) bool {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".bak") || strings.HasSuffix(lower, ".dockerignore") {
+		return false
+	}
+	return lower == "dockerfile" || lower == "containerfile" ||
+		strings.HasPrefix(lower, "dockerfile.") || strings.HasSuffix(lower, ".dockerfile")
+}
+
+// dockerfileImages returns the images of a Dockerfile's FROM instructions
+func dockerfileImages(path string) ([]Reference, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var refs []Reference
+	stages := make(map[string]bool)
+	for i, line := range strings.Split(string(content), "\n") {
+		m := fromPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if m[2] != "" {
+			stages[strings.ToLower(m[2])] = true
+		}
+		if !stages[strings.ToLower(m[1])] && m[1] != "scratch" && checkable(m[1]) {
+			refs = append(refs, Reference{File: path, Line: i + 1, Image: m[1]})
+		}
+	}
+	return refs, nil
+}
+
+// collectImages calls add with every image scalar of a CI file: image:
+// values (or their name:), container: values, services: lists and
+// docker:// step actions
+func collectImages(node *yaml.Node, add func(*yaml.Node)) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			switch {
+			case (key == "image" || key == "container") && value.Kind == yaml.ScalarNode:
+				add(value)
+				continue
+			case key == "image" && value.Kind == yaml.MappingNode:
+				if name := mappingValue(value, "name"); name != nil {
+					add(name)
+				}
+				continue
+			case key == "services" && value.Kind == yaml.SequenceNode:
+				for _, service := range value.Content {
+					if service.Kind == yaml.ScalarNode {
+						add(service)
+					} else if name := mappingValue(service, "name"); name != nil {
+						add(name)
+					}
+				}
+				continue
+			case key == "uses" && strings.HasPrefix(value.Value, "docker://"):
+				add(value)
+				continue
+			}
+			collectImages(value, add)
+		}
+		return
+	}
+	for _, child := range node.Content {
+		collectImages(child, add)
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key && node.Content[i+1].Kind == yaml.ScalarNode {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// checkable reports whether a reference names a fixed image by tag
+func checkable(ref string) bool {
+	return ref != "" && !strings.ContainsAny(ref, "$ ") && !strings.Contains(ref, "@")
+}
+
+// Split splits an image reference into its repository and tag; the
+// repository is shortened to the official image name for Docker Hub images
+func Split(ref string) (string, string) {
+	name, tag := ref, ""
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		name, tag = ref[:i], ref[i+1:]
+	}
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "docker.io/"), "library/")
+	return name, tag
+}
+
+// EndOfLife reports whether a tag of an official image is a version that no
+// longer receives security fixes, with the version and the oldest supported
+// one. Tags that are not versions (latest, lts, bookworm) are never EOL.
+func EndOfLife(name, tag string) (version, minimum string, eol bool) {
+	minimum, known := Supported[name]
+	m := tagPattern.FindStringSubmatch(tag)
+	if !known || m == nil {
+		return "", "", false
+	}
+	return m[1], minimum, versionBefore(m[1], minimum)
+}
+
+// versionBefore reports whether a dotted version is older than minimum
+func versionBefore(version, minimum string) bool {
+	have, want := strings.Split(version, "."), strings.Split(minimum, ".")
+	for i, w := range want {
+		if i >= len(have) {
+			return false
+		}
+		h, _ := strconv.Atoi(have[i])
+		n, _ := strconv.Atoi(w)
+		if h != n {
+			return h < n
+		}
+	}
+	return false
+}
+
+// withTag replaces the tag of an image reference, keeping its registry
+func withTag(ref, tag string) string {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref + ":" + tag
+}
+
+// Check looks for end-of-life versions and, unless offline, newer patch
+// releases of the same version and variant in the image's registry. Lookup
+// failures are returned with the findings so one unreachable registry does
+// not hide the rest.
+func (c *Checker) Check(refs []Reference, offline bool) ([]Finding, []error) {
+	var findings []Finding
+	var errs []error
+	failed := make(map[string]bool)
+	for _, ref := range refs {
+		name, tag := Split(ref.Image)
+		if version, minimum, eol := EndOfLife(name, tag); eol {
+			findings = append(findings, Finding{
+				Reference: ref,
+				Kind:      "eol",
+				Suggested: withTag(ref.Image, strings.Replace(tag, version, minimum, 1)),
+				Reason:    fmt.Sprintf("%s %s no longer receives security fixes; %s is the oldest supported version", name, version, minimum),
+			})
+			continue
+		}
+
+		m := tagPattern.FindStringSubmatch(tag)
+		if offline || m == nil || strings.Count(m[1], ".") != 2 || failed[name] {
+			continue
+		}
+		minor := m[1][:strings.LastIndex(m[1], ".")]
+		tags, err := c.Tags(name, minor+".")
+		if err != nil {
+			failed[name] = true
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if latest := latestPatch(tags, m[1], m[2]); latest != "" {
+			findings = append(findings, Finding{
+				Reference: ref,
+				Kind:      "patch",
+				Suggested: withTag(ref.Image, latest+m[2]),
+				Reason:    fmt.Sprintf("%s is the latest patch release of %s %s", latest, name, minor),
+			})
+		}
+	}
+	return findings, errs
+}
+
+// latestPatch returns the newest version among tags that shares version's
+// major and minor and has the same variant, when it is newer than version
+func latestPatch(tags []string, version, variant string) string {
+	minor := version[:strings.LastIndex(version, ".")+1]
+	latest := version
+	for _, t := range tags {
+		m := tagPattern.FindStringSubmatch(t)
+		if m == nil || m[2] != variant || !strings.HasPrefix(m[1], minor) || strings.Count(m[1], ".") != 2 {
+			continue
+		}
+		if versionBefore(latest, m[1]) {
+			latest = m[1]
+		}
+	}
+	if latest == version {
+		return ""
+	}
+	return latest
+}
+
+// Apply rewrites each finding's line to use the suggested image and returns
+// the updated contents by file
+func Apply(findings []Finding) (map[string]string, error) {
+	lines := make(map[string][]string)
+	for _, f := range findings {
+		if _, ok := lines[f.File]; !ok {
+			content, err := os.ReadFile(f.File)
+			if err != nil {
+				return nil, err
+			}
+			lines[f.File] = strings.Split(string(content), "\n")
+		}
+		if f.Line >= 1 && f.Line <= len(lines[f.File]) {
+			lines[f.File][f.Line-1] = strings.Replace(lines[f.File][f.Line-1], f.Image, f.Suggested, 1)
+		}
+	}
+	updated := make(map[string]string, len(lines))
+	for file, l := range lines {
+		updated[file] = strings.Join(l, "\n")
+	}
+	return updated, nil
+}
+
+// Markdown lists the findings for a pull request description
+func Markdown(findings []Finding) string {
+	var b strings.Builder
+	b.WriteString("Updates base images that are past end of life or behind their latest patch release.\n\n")
+	b.WriteString("| File | Image | Update | Why |\n|---|---|---|---|\n")
+	for _, f := range findings {
+		fmt.Fprintf(&b, "| `%s:%d` | `%s` | `%s` | %s |\n", filepath.ToSlash(f.File), f.Line, f.Image, f.Suggested, f.Reason)
+	}
+	return b.String()
+}
+
+// PrintReport prints the findings grouped by file
+func PrintReport(findings []Finding) {
+	if len(findings) == 0 {
+		term.Println("✅ No base image updates found")
+		return
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	term.Println("\n🐳 Base Image Updates")
+	term.Println(strings.Repeat("─", 50))
+	file := ""
+	for _, f := range findings {
+		if f.File != file {
+			file = f.File
+			term.Printf("\n   %s\n", file)
+		}
+		icon := "•"
+		if f.Kind == "eol" {
+			icon = "🚨"
+		}
+		term.Printf("      %s (line %d) %s → %s\n", icon, f.Line, f.Image, f.Suggested)
+		term.Printf("         %s\n", f.Reason)
+	}
+	term.Println()
+}
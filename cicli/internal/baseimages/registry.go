@@ -0,0 +1,181 @@
+package baseimages
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"cicli/internal/httpclient"
+)
+
+// hubPages caps how many pages of Docker Hub tags are read per image
+const hubPages = 5
+
+// challengeParam matches a key="value" pair of a WWW-Authenticate header
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Checker looks up image tags in their registries
+type Checker struct {
+	client *http.Client
+	tags   map[string][]string
+}
+
+// NewChecker creates a checker that uses the configured HTTP settings
+func NewChecker() *Checker {
+	return &Checker{client: httpclient.New(30 * time.Second), tags: make(map[string][]string)}
+}
+
+// Tags returns the tags of an image that start with prefix. Docker Hub is
+// queried through its API, which filters by name; other registries through
+// the registry API with an anonymous pull token.
+func (c *Checker) Tags(name, prefix string) ([]string, error) {
+	key := name + ":" + prefix
+	if tags, ok := c.tags[key]; ok {
+		return tags, nil
+	}
+
+	host, repo := registryOf(name)
+	var tags []string
+	var err error
+	if host == "" {
+		tags, err = c.hubTags(repo, prefix)
+	} else {
+		tags, err = c.registryTags(host, repo, prefix)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.tags[key] = tags
+	return tags, nil
+}
+
+// registryOf splits an image name into its registry host, empty for Docker
+// Hub, and its repository path
+func registryOf(name string) (string, string) {
+	first, rest, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first, rest
+	}
+	if !found {
+		return "", "library/" + name
+	}
+	return "", name
+}
+
+func (c *Checker) hubTags(repo, prefix string) ([]string, error) {
+	var tags []string
+	next := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/tags?page_size=100&name=%s", repo, url.QueryEscape(prefix))
+	for page := 0; next != "" && page < hubPages; page++ {
+		var body struct {
+			Next    string `json:"next"`
+			Results []struct {
+				Name string `json:"name"`
+			} `json:"results"`
+		}
+		if err := c.getJSON(next, "", &body); err != nil {
+			return nil, err
+		}
+		for _, r := range body.Results {
+			if strings.HasPrefix(r.Name, prefix) {
+				tags = append(tags, r.Name)
+			}
+		}
+		next = body.Next
+	}
+	return tags, nil
+}
+
+func (c *Checker) registryTags(host, repo, prefix string) ([]string, error) {
+	endpoint := fmt.Sprintf("https://%s/v2/%s/tags/list?n=1000", host, repo)
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	err := c.getJSON(endpoint, "", &body)
+	if challenge, ok := err.(*authChallenge); ok {
+		token, terr := c.token(challenge.header)
+		if terr != nil {
+			return nil, terr
+		}
+		err = c.getJSON(endpoint, token, &body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, t := range body.Tags {
+		if strings.HasPrefix(t, prefix) {
+			tags = append(tags, t)
+		}
+	}
+	return tags, nil
+}
+
+// authChallenge is a 401 response asking for a bearer token
+type authChallenge struct {
+	header string
+}
+
+func (a *authChallenge) Error() string {
+	return "registry requires authentication"
+}
+
+// token fetches an anonymous pull token from the realm of a bearer challenge
+func (c *Checker) token(header string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(header), "bearer ") {
+		return "", fmt.Errorf("registry requires %s authentication", strings.Fields(header + " basic")[0])
+	}
+	params := make(map[string]string)
+	for _, m := range challengeParam.FindAllStringSubmatch(header, -1) {
+		params[m[1]] = m[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("registry sent no token realm")
+	}
+	query := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := c.getJSON(params["realm"]+"?"+query.Encode(), "", &body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// getJSON decodes the JSON response of a GET request. A 401 with a bearer
+// challenge is returned as *authChallenge.
+func (c *Checker) getJSON(endpoint, token string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized && token == "" && resp.Header.Get("WWW-Authenticate") != "" {
+		return &authChallenge{header: resp.Header.Get("WWW-Authenticate")}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
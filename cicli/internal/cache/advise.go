@@ -0,0 +1,332 @@
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cicli/internal/term"
+)
+
+// Manager describes how a package manager's dependencies should be cached
+type Manager struct {
+	Name      string
+	Lockfiles []string // files whose hash makes up the cache key
+	Paths     []string // cache paths on hosted runners
+	// LocalPaths are project-relative paths for platforms that can only cache
+	// inside the workspace (GitLab), with the env needed to point the tool there
+	LocalPaths []string
+	LocalEnv   map[string]string
+}
+
+var managers = []Manager{
+	{
+		Name:       "npm",
+		Lockfiles:  []string{"package-lock.json"},
+		Paths:      []string{"~/.npm"},
+		LocalPaths: []string{".npm/"},
+		LocalEnv:   map[string]string{"npm_config_cache": "$CI_PROJECT_DIR/.npm"},
+	},
+	{
+		Name:       "yarn",
+		Lockfiles:  []string{"yarn.lock"},
+		Paths:      []string{"~/.cache/yarn"},
+		LocalPaths: []string{".yarn-cache/"},
+		LocalEnv:   map[string]string{"YARN_CACHE_FOLDER": "$CI_PROJECT_DIR/.yarn-cache"},
+	},
+	{
+		Name:       "pnpm",
+		Lockfiles:  []string{"pnpm-lock.yaml"},
+		Paths:      []string{"~/.local/share/pnpm/store"},
+		LocalPaths: []string{".pnpm-store/"},
+		LocalEnv:   map[string]string{"npm_config_store_dir": "$CI_PROJECT_DIR/.pnpm-store"},
+	},
+	{
+		Name:       "pip",
+		Lockfiles:  []string{"requirements.txt", "Pipfile.lock"},
+		Paths:      []string{"~/.cache/pip"},
+		LocalPaths: []string{".cache/pip/"},
+		LocalEnv:   map[string]string{"PIP_CACHE_DIR": "$CI_PROJECT_DIR/.cache/pip"},
+	},
+	{
+		Name:       "poetry",
+		Lockfiles:  []string{"poetry.lock"},
+		Paths:      []string{"~/.cache/pypoetry"},
+		LocalPaths: []string{".cache/pypoetry/"},
+		LocalEnv:   map[string]string{"POETRY_CACHE_DIR": "$CI_PROJECT_DIR/.cache/pypoetry"},
+	},
+	{
+		Name:       "go",
+		Lockfiles:  []string{"go.sum"},
+		Paths:      []string{"~/go/pkg/mod", "~/.cache/go-build"},
+		LocalPaths: []string{".go/pkg/mod/", ".cache/go-build/"},
+		LocalEnv:   map[string]string{"GOMODCACHE": "$CI_PROJECT_DIR/.go/pkg/mod", "GOCACHE": "$CI_PROJECT_DIR/.cache/go-build"},
+	},
+	{
+		Name:       "cargo",
+		Lockfiles:  []string{"Cargo.lock"},
+		Paths:      []string{"~/.cargo/registry", "~/.cargo/git", "target"},
+		LocalPaths: []string{".cargo/registry/", ".cargo/git/", "target/"},
+		LocalEnv:   map[string]string{"CARGO_HOME": "$CI_PROJECT_DIR/.cargo"},
+	},
+	{
+		Name:       "bundler",
+		Lockfiles:  []string{"Gemfile.lock"},
+		Paths:      []string{"vendor/bundle"},
+		LocalPaths: []string{"vendor/bundle/"},
+		LocalEnv:   map[string]string{"BUNDLE_PATH": "vendor/bundle"},
+	},
+	{
+		Name:       "composer",
+		Lockfiles:  []string{"composer.lock"},
+		Paths:      []string{"~/.cache/composer"},
+		LocalPaths: []string{".composer-cache/"},
+		LocalEnv:   map[string]string{"COMPOSER_CACHE_DIR": "$CI_PROJECT_DIR/.composer-cache"},
+	},
+	{
+		Name:       "maven",
+		Lockfiles:  []string{"pom.xml"},
+		Paths:      []string{"~/.m2/repository"},
+		LocalPaths: []string{".m2/repository/"},
+		LocalEnv:   map[string]string{"MAVEN_OPTS": "-Dmaven.repo.local=$CI_PROJECT_DIR/.m2/repository"},
+	},
+	{
+		Name:       "gradle",
+		Lockfiles:  []string{"gradle/wrapper/gradle-wrapper.properties", "build.gradle", "build.gradle.kts"},
+		Paths:      []string{"~/.gradle/caches", "~/.gradle/wrapper"},
+		LocalPaths: []string{".gradle/caches/", ".gradle/wrapper/"},
+		LocalEnv:   map[string]string{"GRADLE_USER_HOME": "$CI_PROJECT_DIR/.gradle"},
+	},
+}
+
+// Advice is a recommended cache configuration for one package manager
+type Advice struct {
+	Manager   Manager
+	Lockfiles []string // lockfiles actually present in the repo
+	Platform  string
+	Snippet   string
+}
+
+// Advisor inspects lockfiles and recommends cache configuration
+type Advisor struct {
+	rootPath string
+}
+
+// NewAdvisor creates an advisor for the repo at rootPath
+func NewAdvisor(rootPath string) *Advisor {
+	if rootPath == "" {
+		rootPath = "."
+	}
+	return &Advisor{rootPath: rootPath}
+}
+
+// Advise returns one recommendation per package manager detected in the repo
+func (a *Advisor) Advise(platform string) ([]Advice, error) {
+	var advice []Advice
+	for _, m := range managers {
+		found := a.findLockfiles(m)
+		if len(found) == 0 {
+			continue
+		}
+
+		adv := Advice{Manager: m, Lockfiles: found, Platform: platform}
+		snippet, err := Snippet(m, found, platform)
+		if err != nil {
+			return nil, err
+		}
+		adv.Snippet = snippet
+		advice = append(advice, adv)
+	}
+	return advice, nil
+}
+
+// findLockfiles looks for the manager's lockfiles at the root and one level down
+func (a *Advisor) findLockfiles(m Manager) []string {
+	var found []string
+	for _, lock := range m.Lockfiles {
+		for _, pattern := range []string{lock, filepath.Join("*", lock)} {
+			matches, _ := filepath.Glob(filepath.Join(a.rootPath, pattern))
+			for _, match := range matches {
+				rel, err := filepath.Rel(a.rootPath, match)
+				if err != nil || strings.Contains(rel, "node_modules") {
+					continue
+				}
+				found = append(found, filepath.ToSlash(rel))
+			}
+		}
+	}
+	return found
+}
+
+// Snippet renders the cache configuration for a platform
+func Snippet(m Manager, lockfiles []string, platform string) (string, error) {
+	var sb strings.Builder
+
+	switch platform {
+	case "github":
+		var hashes []string
+		for _, lock := range lockfiles {
+			hashes = append(hashes, fmt.Sprintf("'%s'", lock))
+		}
+		sb.WriteString(fmt.Sprintf("- name: Cache %s dependencies\n", m.Name))
+		sb.WriteString("  uses: actions/cache@v4\n")
+		sb.WriteString("  with:\n")
+		sb.WriteString("    path: |\n")
+		for _, p := range m.Paths {
+			sb.WriteString(fmt.Sprintf("      %s\n", p))
+		}
+		sb.WriteString(fmt.Sprintf("    key: ${{ runner.os }}-%s-${{ hashFiles(%s) }}\n", m.Name, strings.Join(hashes, ", ")))
+		sb.WriteString("    restore-keys: |\n")
+		sb.WriteString(fmt.Sprintf("      ${{ runner.os }}-%s-\n", m.Name))
+
+	case "gitlab":
+		sb.WriteString("variables:\n")
+		for _, k := range sortedKeys(m.LocalEnv) {
+			sb.WriteString(fmt.Sprintf("  %s: \"%s\"\n", k, m.LocalEnv[k]))
+		}
+		sb.WriteString("\ncache:\n")
+		sb.WriteString("  key:\n")
+		sb.WriteString(fmt.Sprintf("    prefix: %s\n", m.Name))
+		sb.WriteString("    files:\n")
+		for i, lock := range lockfiles {
+			// GitLab accepts at most two files in cache:key:files
+			if i == 2 {
+				break
+			}
+			sb.WriteString(fmt.Sprintf("      - %s\n", lock))
+		}
+		sb.WriteString("  paths:\n")
+		for _, p := range m.LocalPaths {
+			sb.WriteString(fmt.Sprintf("    - %s\n", p))
+		}
+		sb.WriteString("  fallback_keys:\n")
+		sb.WriteString(fmt.Sprintf("    - %s-$CI_DEFAULT_BRANCH\n", m.Name))
+
+	case "circleci":
+		var checksums []string
+		for _, lock := range lockfiles {
+			checksums = append(checksums, fmt.Sprintf("{{ checksum \"%s\" }}", lock))
+		}
+		key := fmt.Sprintf("%s-v1-%s", m.Name, strings.Join(checksums, "-"))
+		sb.WriteString("- restore_cache:\n")
+		sb.WriteString("    keys:\n")
+		sb.WriteString(fmt.Sprintf("      - %s\n", key))
+		sb.WriteString(fmt.Sprintf("      - %s-v1-\n", m.Name))
+		sb.WriteString("# ... install dependencies ...\n")
+		sb.WriteString("- save_cache:\n")
+		sb.WriteString(fmt.Sprintf("    key: %s\n", key))
+		sb.WriteString("    paths:\n")
+		for _, p := range m.Paths {
+			sb.WriteString(fmt.Sprintf("      - %s\n", p))
+		}
+
+	case "azure":
+		for _, p := range m.Paths {
+			sb.WriteString("- task: Cache@2\n")
+			sb.WriteString(fmt.Sprintf("  displayName: Cache %s (%s)\n", m.Name, p))
+			sb.WriteString("  inputs:\n")
+			sb.WriteString(fmt.Sprintf("    key: '%s | \"$(Agent.OS)\" | %s'\n", m.Name, strings.Join(lockfiles, " | ")))
+			sb.WriteString("    restoreKeys: |\n")
+			sb.WriteString(fmt.Sprintf("      %s | \"$(Agent.OS)\"\n", m.Name))
+			sb.WriteString(fmt.Sprintf("    path: %s\n", strings.Replace(p, "~", "$(HOME)", 1)))
+		}
+
+	default:
+		return "", fmt.Errorf("unsupported platform: %s (supported: github, gitlab, circleci, azure)", platform)
+	}
+
+	return sb.String(), nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Inject adds an actions/cache step after the checkout step of every job in a
+// GitHub Actions workflow that does not cache the manager yet. It returns the
+// updated workflow and the number of jobs changed.
+func Inject(workflow string, adv Advice) (string, int) {
+	if alreadyCached(workflow, adv.Manager.Name) {
+		return workflow, 0
+	}
+
+	lines := strings.Split(workflow, "\n")
+	var out []string
+	injected := 0
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		out = append(out, line)
+
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "- uses: actions/checkout@") {
+			continue
+		}
+
+		// Copy the rest of the checkout step (e.g. its with: block)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		for i+1 < len(lines) {
+			next := lines[i+1]
+			nextIndent := len(next) - len(strings.TrimLeft(next, " "))
+			if strings.TrimSpace(next) == "" || nextIndent <= indent {
+				break
+			}
+			out = append(out, next)
+			i++
+		}
+
+		prefix := strings.Repeat(" ", indent)
+		for _, s := range strings.Split(strings.TrimSuffix(adv.Snippet, "\n"), "\n") {
+			out = append(out, prefix+s)
+		}
+		injected++
+	}
+
+	return strings.Join(out, "\n"), injected
+}
+
+// alreadyCached detects an existing cache step or a setup action's built-in cache
+func alreadyCached(workflow, manager string) bool {
+	if strings.Contains(workflow, fmt.Sprintf("-%s-${{ hashFiles", manager)) {
+		return true
+	}
+	for _, quoted := range []string{"'%s'", "\"%s\"", "%s\n"} {
+		if strings.Contains(workflow, "cache: "+fmt.Sprintf(quoted, manager)) {
+			return true
+		}
+	}
+	// setup-go caches modules and the build cache by default since v4
+	if manager == "go" && (strings.Contains(workflow, "actions/setup-go@v4") || strings.Contains(workflow, "actions/setup-go@v5")) {
+		return !strings.Contains(workflow, "cache: false")
+	}
+	return false
+}
+
+// PrintReport prints the recommendations
+func PrintReport(advice []Advice) {
+	if len(advice) == 0 {
+		term.Println("No lockfiles found; nothing to cache.")
+		return
+	}
+
+	term.Printf("\n📦 Cache Advice (%s)\n", advice[0].Platform)
+	term.Println(strings.Repeat("─", 50))
+	for _, adv := range advice {
+		term.Printf("\n   %s — keyed on %s\n", adv.Manager.Name, strings.Join(adv.Lockfiles, ", "))
+		term.Println()
+		for _, line := range strings.Split(strings.TrimSuffix(adv.Snippet, "\n"), "\n") {
+			if line == "" {
+				term.Println()
+				continue
+			}
+			term.Printf("      %s\n", line)
+		}
+	}
+	term.Println()
+}
@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"cicli/internal/github"
+	"cicli/internal/term"
+)
+
+// RepoLimit is the Actions cache size per repository; beyond it GitHub
+// evicts the least recently used entries
+const RepoLimit = 10 << 30
+
+// StaleAfter is how long GitHub keeps a cache entry that is not accessed
+const StaleAfter = 7 * 24 * time.Hour
+
+// Entry is one Actions cache entry
+type Entry struct {
+	ID             int64     `json:"id"`
+	Ref            string    `json:"ref"`
+	Key            string    `json:"key"`
+	Version        string    `json:"version"`
+	SizeInBytes    int64     `json:"size_in_bytes"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastAccessedAt time.Time `json:"last_accessed_at"`
+}
+
+// Status summarizes the cache of a repository
+type Status struct {
+	Repo       string  `json:"repo"`
+	Entries    []Entry `json:"entries"`
+	TotalSize  int64   `json:"total_size"`
+	Stale      []Entry `json:"stale,omitempty"`      // not accessed within StaleAfter
+	Superseded []Entry `json:"superseded,omitempty"` // older entries of a key prefix that has a newer one
+	Hits       int     `json:"hits"`
+	Misses     int     `json:"misses"`
+	LogsRead   int     `json:"logs_read"`
+}
+
+// HitRatio returns the share of cache restores that found an entry, or -1
+// when no restores were seen in the logs
+func (s *Status) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return -1
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Inspector queries the GitHub Actions cache API
+type Inspector struct {
+	repo string
+	api  *github.Client
+}
+
+// NewInspector creates an inspector for owner/name, authenticated with
+// GITHUB_TOKEN or GH_TOKEN
+func NewInspector(repo string) *Inspector {
+	return &Inspector{repo: repo, api: github.NewClient(repo)}
+}
+
+// Status lists cache entries and, for the last runs workflow runs, reads
+// job logs for cache hits and misses
+func (in *Inspector) Status(runs int) (*Status, error) {
+	status := &Status{Repo: in.repo}
+	path := fmt.Sprintf("/repos/%s/actions/caches?per_page=100&sort=last_accessed_at&direction=desc", in.repo)
+	err := in.api.GetPages(path, func(data []byte) (bool, error) {
+		var page struct {
+			Caches []Entry `json:"actions_caches"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			return false, err
+		}
+		status.Entries = append(status.Entries, page.Caches...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, in.explain(err)
+	}
+
+	newest := make(map[string]time.Time)
+	for _, e := range status.Entries {
+		status.TotalSize += e.SizeInBytes
+		prefix := keyPrefix(e.Key) + "@" + e.Ref
+		if e.CreatedAt.After(newest[prefix]) {
+			newest[prefix] = e.CreatedAt
+		}
+	}
+	for _, e := range status.Entries {
+		if time.Since(e.LastAccessedAt) > StaleAfter {
+			status.Stale = append(status.Stale, e)
+		} else if e.CreatedAt.Before(newest[keyPrefix(e.Key)+"@"+e.Ref]) {
+			status.Superseded = append(status.Superseded, e)
+		}
+	}
+
+	if runs > 0 {
+		if err := in.countHits(status, runs); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// countHits scans job logs of recent runs for actions/cache restore results
+func (in *Inspector) countHits(status *Status, runs int) error {
+	var runList struct {
+		Runs []struct {
+			ID int64 `json:"id"`
+		} `json:"workflow_runs"`
+	}
+	if err := in.api.Get(fmt.Sprintf("/repos/%s/actions/runs?per_page=%d&status=completed", in.repo, runs), &runList); err != nil {
+		return in.explain(err)
+	}
+
+	for _, run := range runList.Runs {
+		var jobIDs []int64
+		err := in.api.GetPages(fmt.Sprintf("/repos/%s/actions/runs/%d/jobs?per_page=100", in.repo, run.ID), func(data []byte) (bool, error) {
+			var page struct {
+				Jobs []struct {
+					ID int64 `json:"id"`
+				} `json:"jobs"`
+			}
+			if err := json.Unmarshal(data, &page); err != nil {
+				return false, err
+			}
+			for _, job := range page.Jobs {
+				jobIDs = append(jobIDs, job.ID)
+			}
+			return true, nil
+		})
+		if err != nil {
+			return in.explain(err)
+		}
+		for _, id := range jobIDs {
+			resp, err := in.api.Open(fmt.Sprintf("/repos/%s/actions/jobs/%d/logs", in.repo, id))
+			if err != nil {
+				// Logs expire; a missing log should not fail the whole report
+				continue
+			}
+			scanner := bufio.NewScanner(resp.Body)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				line := scanner.Text()
+				switch {
+				case strings.Contains(line, "Cache restored from key:"):
+					status.Hits++
+				case strings.Contains(line, "Cache not found for input keys:"):
+					status.Misses++
+				}
+			}
+			resp.Body.Close()
+			status.LogsRead++
+		}
+	}
+	return nil
+}
+
+// keyPrefix strips the trailing hash so entries of the same cache group together
+func keyPrefix(key string) string {
+	if i := strings.LastIndex(key, "-"); i > 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// explain adds the token the API wants to permission errors
+func (in *Inspector) explain(err error) error {
+	var apiErr *github.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			return fmt.Errorf("%w (set GITHUB_TOKEN with actions:read access)", err)
+		}
+	}
+	return err
+}
+
+// PrintStatus prints the cache report
+func PrintStatus(s *Status) {
+	term.Printf("\n🗄️  Actions cache: %s\n", s.Repo)
+	term.Printf("   %d entries, %s of %s (%.0f%%)\n", len(s.Entries), formatBytes(s.TotalSize), formatBytes(RepoLimit), 100*float64(s.TotalSize)/float64(RepoLimit))
+	if ratio := s.HitRatio(); ratio >= 0 {
+		term.Printf("   Hit ratio: %.0f%% (%d hits, %d misses in %d job logs)\n", ratio*100, s.Hits, s.Misses, s.LogsRead)
+	}
+	term.Println(strings.Repeat("─", 50))
+
+	switch {
+	case s.TotalSize >= RepoLimit:
+		term.Println("   🚨 Over the 10 GB limit: GitHub is evicting caches, so restores will miss")
+	case s.TotalSize >= RepoLimit*9/10:
+		term.Println("   ⚠️  Close to the 10 GB limit: new caches will start evicting older ones")
+	}
+
+	entries := append([]Entry(nil), s.Entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].SizeInBytes > entries[j].SizeInBytes })
+	if len(entries) > 10 {
+		entries = entries[:10]
+	}
+	if len(entries) > 0 {
+		term.Println("\n   Largest entries:")
+		for _, e := range entries {
+			term.Printf("      %9s  %s (%s, last used %s)\n", formatBytes(e.SizeInBytes), e.Key, e.Ref, e.LastAccessedAt.Format("2006-01-02"))
+		}
+	}
+
+	if len(s.Stale) > 0 || len(s.Superseded) > 0 {
+		term.Println("\n   ⚠️  Stale keys:")
+		for _, e := range s.Stale {
+			term.Printf("      %s (%s): not used for %d days\n", e.Key, formatBytes(e.SizeInBytes), int(time.Since(e.LastAccessedAt).Hours()/24))
+		}
+		for _, e := range s.Superseded {
+			term.Printf("      %s (%s): superseded by a newer key on %s\n", e.Key, formatBytes(e.SizeInBytes), e.Ref)
+		}
+		term.Println("      → Delete with: gh cache delete <key>")
+	}
+	term.Println()
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,276 @@
+package catalog
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cicli/internal/analyzer"
+	"cicli/internal/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OwnerPlaceholder is written as spec.owner when no owner is given
+const OwnerPlaceholder = "group:default/CHANGE-ME"
+
+// tagInvalid matches the characters Backstage does not allow in a tag
+var tagInvalid = regexp.MustCompile(`[^a-z0-9+#]+`)
+
+// nameInvalid matches the characters Backstage does not allow in an entity name
+var nameInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// frontendFrameworks are served as websites rather than services
+var frontendFrameworks = map[string]bool{"react": true, "vue": true, "angular": true, "svelte": true}
+
+// Input is what a catalog entry is built from
+type Input struct {
+	Info   *analyzer.ProjectInfo
+	Config *config.Config // cicli.yaml, or nil without one
+	Remote string         // URL of the origin remote, or "" when unknown
+	Owner  string         // spec.owner; OwnerPlaceholder when empty
+}
+
+// Entity is a Backstage catalog entity
+type Entity struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   Metadata `yaml:"metadata"`
+	Spec       Spec     `yaml:"spec"`
+}
+
+// Metadata is the metadata block of an entity
+type Metadata struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description,omitempty"`
+	Tags        []string          `yaml:"tags,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// Spec is the spec block of a Component or System; a System only has an owner
+type Spec struct {
+	Type      string   `yaml:"type,omitempty"`
+	Lifecycle string   `yaml:"lifecycle,omitempty"`
+	Owner     string   `yaml:"owner"`
+	System    string   `yaml:"system,omitempty"`
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+}
+
+// Backstage returns the catalog entities of a repository: a Component for
+// the project or, when cicli.yaml lists services, a System named after the
+// project with a Component per service
+func Backstage(in Input) []Entity {
+	project := in.Info.Name
+	if in.Config != nil && in.Config.ProjectName != "" {
+		project = in.Config.ProjectName
+	}
+	owner := in.Owner
+	if owner == "" {
+		owner = OwnerPlaceholder
+	}
+	annotations := annotationsFor(in)
+
+	if in.Config == nil || len(in.Config.Services) == 0 {
+		return []Entity{{
+			APIVersion: "backstage.io/v1alpha1",
+			Kind:       "Component",
+			Metadata: Metadata{
+				Name:        entityName(project),
+				Description: description(in.Info),
+				Tags:        tags(in.Info),
+				Annotations: annotations,
+			},
+			Spec: Spec{Type: componentType(in), Lifecycle: "production", Owner: owner},
+		}}
+	}
+
+	entities := []Entity{{
+		APIVersion: "backstage.io/v1alpha1",
+		Kind:       "System",
+		Metadata: Metadata{
+			Name:        entityName(project),
+			Description: description(in.Info),
+			Annotations: annotations,
+		},
+		Spec: Spec{Owner: owner},
+	}}
+	for _, svc := range in.Config.Services {
+		var deps []string
+		for _, dep := range svc.DependsOn {
+			deps = append(deps, "component:"+entityName(dep))
+		}
+		entities = append(entities, Entity{
+			APIVersion: "backstage.io/v1alpha1",
+			Kind:       "Component",
+			Metadata: Metadata{
+				Name:        entityName(svc.Name),
+				Description: fmt.Sprintf("%s service of %s", svc.Name, project),
+				Tags:        tags(in.Info),
+				Annotations: annotations,
+			},
+			Spec: Spec{Type: "service", Lifecycle: "production", Owner: owner, System: entityName(project), DependsOn: deps},
+		})
+	}
+	return entities
+}
+
+// componentType is service for projects that run as a container or listen
+// on a port, website for frontend apps and library for the rest
+func componentType(in Input) string {
+	switch {
+	case frontendFrameworks[in.Info.Framework] && len(in.Info.Ports) == 0:
+		return "website"
+	case in.Info.HasDocker || len(in.Info.Ports) > 0 || (in.Config != nil && in.Config.Deploy.Provider != ""):
+		return "service"
+	}
+	return "library"
+}
+
+// description summarizes the stack of a project
+func description(info *analyzer.ProjectInfo) string {
+	if info.Language == "" || info.Language == "unknown" {
+		return ""
+	}
+	if info.Framework != "" {
+		return fmt.Sprintf("%s project built with %s", info.Language, info.Framework)
+	}
+	return info.Language + " project"
+}
+
+// tags are the language, framework, test framework and monorepo tool, in
+// the lowercase form Backstage requires
+func tags(info *analyzer.ProjectInfo) []string {
+	var out []string
+	seen := make(map[string]bool)
+	add := func(value string) {
+		tag := strings.Trim(tagInvalid.ReplaceAllString(strings.ToLower(value), "-"), "-")
+		if tag != "" && tag != "unknown" && !seen[tag] && len(tag) <= 63 {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	add(info.Language)
+	add(info.Framework)
+	add(info.TestFramework)
+	if info.Monorepo != nil {
+		add(info.Monorepo.Tool)
+	}
+	if info.HasDocker {
+		add("docker")
+	}
+	return out
+}
+
+// annotationsFor returns the source location and the annotations the CI
+// plugins use to find the repository's pipelines
+func annotationsFor(in Input) map[string]string {
+	annotations := make(map[string]string)
+	host, slug := parseRemote(in.Remote)
+	if host != "" {
+		annotations["backstage.io/source-location"] = "url:https://" + host + "/" + slug + "/"
+	}
+	switch {
+	case host == "github.com" || (host != "" && in.Info.CIPlatform == "github-actions"):
+		annotations["github.com/project-slug"] = slug
+	case strings.Contains(host, "gitlab"):
+		annotations["gitlab.com/project-slug"] = slug
+	}
+	if slug != "" {
+		switch in.Info.CIPlatform {
+		case "circleci":
+			if host == "github.com" {
+				annotations["circleci.com/project-slug"] = "github/" + slug
+			} else if host == "bitbucket.org" {
+				annotations["circleci.com/project-slug"] = "bitbucket/" + slug
+			}
+		case "jenkins":
+			annotations["jenkins.io/job-full-name"] = slug
+		case "azure-pipelines":
+			annotations["dev.azure.com/project-repo"] = slug
+		}
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// parseRemote returns the host and owner/name path of a git remote URL
+func parseRemote(remote string) (string, string) {
+	remote = strings.TrimSuffix(strings.TrimSpace(remote), ".git")
+	for _, scheme := range []string{"https://", "http://", "ssh://"} {
+		if strings.HasPrefix(remote, scheme) {
+			rest := strings.TrimPrefix(remote, scheme)
+			if _, after, found := strings.Cut(rest, "@"); found {
+				rest = after
+			}
+			host, path, _ := strings.Cut(rest, "/")
+			host, _, _ = strings.Cut(host, ":")
+			return host, path
+		}
+	}
+	// scp-like syntax: git@host:owner/name
+	if at := strings.Index(remote, "@"); at >= 0 {
+		if host, path, found := strings.Cut(remote[at+1:], ":"); found {
+			return host, path
+		}
+	}
+	return "", ""
+}
+
+// entityName turns a project or service name into a valid entity name
+func entityName(name string) string {
+	n := strings.Trim(nameInvalid.ReplaceAllString(name, "-"), "-_.")
+	if len(n) > 63 {
+		n = strings.Trim(n[:63], "-_.")
+	}
+	if n == "" {
+		return "component"
+	}
+	return n
+}
+
+// Marshal writes entities as a multi-document catalog-info.yaml. A
+// placeholder owner is marked with a comment so it is not committed as is.
+func Marshal(entities []Entity) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, e := range entities {
+		var node yaml.Node
+		if err := node.Encode(e); err != nil {
+			return nil, err
+		}
+		if e.Spec.Owner == OwnerPlaceholder {
+			if owner := find(&node, "spec", "owner"); owner != nil {
+				owner.LineComment = "TODO: set the owning group"
+			}
+		}
+		if err := enc.Encode(&node); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// find returns the value at a path of mapping keys
+func find(node *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
@@ -3,6 +3,15 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cicli/internal/freeze"
+	"cicli/internal/github"
+	"cicli/internal/httpclient"
+	"cicli/internal/linter"
+	"cicli/internal/term"
 
 	"github.com/charmbracelet/huh"
 	"gopkg.in/yaml.v3"
@@ -19,25 +28,257 @@ type Config struct {
 		Dockerfile string `yaml:"dockerfile"`
 	} `yaml:"docker"`
 	Deploy struct {
-		Provider     string `yaml:"provider"`
-		ManifestPath string `yaml:"manifest_path"`
+		Provider      string `yaml:"provider"`
+		ManifestPath  string `yaml:"manifest_path"`
+		Region        string `yaml:"region,omitempty"`
+		ClusterName   string `yaml:"cluster_name,omitempty"`
+		GCPProject    string `yaml:"gcp_project,omitempty"`
+		ResourceGroup string `yaml:"resource_group,omitempty"`
+		Lock          string `yaml:"lock,omitempty"` // cluster (default), local or none
 	} `yaml:"deploy"`
 	Notifications struct {
 		WebhookURL string `yaml:"webhook_url"`
 	} `yaml:"notifications"`
+	Coverage struct {
+		Provider  string  `yaml:"provider,omitempty"`  // codecov, coveralls or artifact (default)
+		Threshold float64 `yaml:"threshold,omitempty"` // minimum line coverage in percent
+	} `yaml:"coverage,omitempty"`
+	Bazel struct {
+		RemoteCache string `yaml:"remote_cache,omitempty"` // e.g. grpcs://cache.example.com; auth header from the BAZEL_REMOTE_HEADER secret
+	} `yaml:"bazel,omitempty"`
+	Preview struct {
+		Env          string `yaml:"env,omitempty"`           // environment whose cluster hosts previews (default dev)
+		Domain       string `yaml:"domain,omitempty"`        // hostnames are <name>.<project>.<domain>
+		IngressClass string `yaml:"ingress_class,omitempty"` // ingressClassName of the generated Ingress
+		TTL          string `yaml:"ttl,omitempty"`           // default lifetime, e.g. 72h
+	} `yaml:"preview,omitempty"`
+	Release struct {
+		Envs    []string `yaml:"envs,omitempty"`    // promotions to these publish release notes (default prod)
+		Publish []string `yaml:"publish,omitempty"` // github and/or notify (default both)
+	} `yaml:"release,omitempty"`
+	Environments map[string]Environment `yaml:"environments,omitempty"`
+	Freeze       *freeze.Policy         `yaml:"freeze,omitempty"`
+	Services     []Service              `yaml:"services,omitempty"`
+	HTTP         httpclient.Settings    `yaml:"http,omitempty"` // CA bundle for TLS-intercepting proxies
+	Lint         struct {
+		Rules   []linter.CustomRule `yaml:"rules,omitempty"`   // organization policies checked by cicli lint
+		Public  bool                `yaml:"public,omitempty"`  // run the fork-safety rules for public repositories
+		Profile string              `yaml:"profile,omitempty"` // rule profile: default or security-strict
+	} `yaml:"lint,omitempty"`
+	// Profiles override any of the settings above, selected with --profile=
+	Profiles map[string]yaml.Node `yaml:"profiles,omitempty"`
+}
+
+// Profile is the profile selected with --profile=; LoadConfig applies it
+var Profile string
+
+// Service describes one deployable in a repository that contains several
+type Service struct {
+	Name       string   `yaml:"name"`
+	Path       string   `yaml:"path,omitempty"`       // directory used as the docker build context
+	Dockerfile string   `yaml:"dockerfile,omitempty"` // relative to path (default Dockerfile)
+	Manifest   string   `yaml:"manifest,omitempty"`   // relative to path (default k8s/deployment.yaml)
+	Image      string   `yaml:"image,omitempty"`      // defaults to <docker.image_name>-<name>
+	DependsOn  []string `yaml:"depends_on,omitempty"` // services deployed before this one by deploy --all
+}
+
+// Environment holds per-environment deployment settings
+type Environment struct {
+	Clusters   []Cluster          `yaml:"clusters,omitempty"`
+	URL        string             `yaml:"url,omitempty"`        // shown on deployments in GitHub
+	Protection *github.Protection `yaml:"protection,omitempty"` // applied with cicli generate --create-environment
+}
+
+// Cluster describes a Kubernetes cluster to deploy to
+type Cluster struct {
+	Name          string `yaml:"name"`
+	Provider      string `yaml:"provider,omitempty"`
+	Region        string `yaml:"region,omitempty"`
+	ClusterName   string `yaml:"cluster_name,omitempty"`
+	GCPProject    string `yaml:"gcp_project,omitempty"`
+	ResourceGroup string `yaml:"resource_group,omitempty"`
+	Context       string `yaml:"context,omitempty"`
+}
+
+// ClustersFor returns the clusters configured for env, falling back to the
+// top-level deploy settings when the environment lists none
+func (c *Config) ClustersFor(env string) []Cluster {
+	if e, ok := c.Environments[env]; ok && len(e.Clusters) > 0 {
+		clusters := make([]Cluster, len(e.Clusters))
+		for i, cl := range e.Clusters {
+			if cl.Provider == "" {
+				cl.Provider = c.Deploy.Provider
+			}
+			if cl.ClusterName == "" {
+				cl.ClusterName = cl.Name
+			}
+			clusters[i] = cl
+		}
+		return clusters
+	}
+
+	return []Cluster{{
+		Name:          c.Deploy.ClusterName,
+		Provider:      c.Deploy.Provider,
+		Region:        c.Deploy.Region,
+		ClusterName:   c.Deploy.ClusterName,
+		GCPProject:    c.Deploy.GCPProject,
+		ResourceGroup: c.Deploy.ResourceGroup,
+	}}
+}
+
+// UseRegistry moves the top-level and service images to registry, keeping
+// their repository paths, for registries only known when the pipeline runs
+// such as the one amazon-ecr-login returns
+func (c *Config) UseRegistry(registry string) {
+	if c.Docker.ImageName != "" {
+		c.Docker.ImageName = inRegistry(c.Docker.ImageName, registry)
+	}
+	for i, svc := range c.Services {
+		if svc.Image != "" {
+			c.Services[i].Image = inRegistry(svc.Image, registry)
+		}
+	}
+}
+
+// inRegistry replaces the registry host of image, if it has one, with registry
+func inRegistry(image, registry string) string {
+	if host, rest, found := strings.Cut(image, "/"); found && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		image = rest
+	}
+	return strings.TrimSuffix(registry, "/") + "/" + image
+}
+
+// ServiceNamed returns the service called name with its build context,
+// Dockerfile, manifest and image resolved against the top-level settings
+func (c *Config) ServiceNamed(name string) (*Service, error) {
+	for _, svc := range c.Services {
+		if svc.Name != name {
+			continue
+		}
+		if svc.Path == "" {
+			svc.Path = "."
+		}
+		if svc.Dockerfile == "" {
+			svc.Dockerfile = "Dockerfile"
+		}
+		svc.Dockerfile = filepath.Join(svc.Path, svc.Dockerfile)
+		if svc.Manifest == "" {
+			svc.Manifest = filepath.Join("k8s", "deployment.yaml")
+		}
+		svc.Manifest = filepath.Join(svc.Path, svc.Manifest)
+		if svc.Image == "" {
+			if c.Docker.ImageName == "" {
+				return nil, fmt.Errorf("service %s has no image and docker.image_name is not set", name)
+			}
+			svc.Image = c.Docker.ImageName + "-" + name
+		}
+		return &svc, nil
+	}
+
+	names := make([]string, len(c.Services))
+	for i, svc := range c.Services {
+		names[i] = svc.Name
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("service %q not found: cicli.yaml has no services", name)
+	}
+	return nil, fmt.Errorf("service %q not found (available: %s)", name, strings.Join(names, ", "))
+}
+
+// ServiceOrder returns the service names ordered so that every service comes
+// after the ones it depends on, keeping declaration order otherwise
+func (c *Config) ServiceOrder() ([]string, error) {
+	deps := make(map[string][]string, len(c.Services))
+	for _, svc := range c.Services {
+		deps[svc.Name] = svc.DependsOn
+	}
+	for _, svc := range c.Services {
+		for _, dep := range svc.DependsOn {
+			if _, ok := deps[dep]; !ok {
+				return nil, fmt.Errorf("service %s depends on unknown service %q", svc.Name, dep)
+			}
+		}
+	}
+
+	var order []string
+	state := make(map[string]int) // 1 while visiting, 2 once ordered
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("services depend on each other in a cycle: %s", strings.Join(append(path, name), " → "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dep := range deps[name] {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+	for _, svc := range c.Services {
+		if err := visit(svc.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
 }
 
+// LoadConfig reads the config file at path, with the selected profile
+// applied on top. A profile comes from cicli.<profile>.yaml next to path, or
+// else from the file's profiles: section. Settings the profile gives replace
+// those of the file; the rest are kept.
 func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	ext := filepath.Ext(path)
+	profileFile := strings.TrimSuffix(path, ext) + "." + Profile + ext
+	profilePath := ""
+	if _, err := os.Stat(profileFile); Profile != "" && err == nil {
+		profilePath = profileFile
 	}
 
 	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil && (profilePath == "" || !os.IsNotExist(err)) {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if Profile == "" {
+		return &config, nil
+	}
 
+	profiles := config.Profiles
+	config.Profiles = nil
+	if profilePath != "" {
+		data, err := os.ReadFile(profilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", profilePath, err)
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", profilePath, err)
+		}
+	} else if node, ok := profiles[Profile]; ok {
+		if err := node.Decode(&config); err != nil {
+			return nil, fmt.Errorf("failed to parse profile %s: %w", Profile, err)
+		}
+	} else {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			names = []string{"none"}
+		}
+		return nil, fmt.Errorf("profile %q not found: there is no %s, and %s has profiles: %s", Profile, profileFile, path, strings.Join(names, ", "))
+	}
+	config.Profiles = nil
 	return &config, nil
 }
 
@@ -76,6 +317,8 @@ func InitConfig() error {
 				Options(
 					huh.NewOption("Kubernetes", "kubernetes"),
 					huh.NewOption("AWS EKS", "aws"),
+					huh.NewOption("Google GKE", "gke"),
+					huh.NewOption("Azure AKS", "aks"),
 				).
 				Value(&provider),
 		),
@@ -116,6 +359,6 @@ func InitConfig() error {
 		return fmt.Errorf("failed to write %s: %w", filename, err)
 	}
 
-	fmt.Printf("Initialized %s\n", filename)
+	term.Printf("Initialized %s\n", filename)
 	return nil
 }
@@ -0,0 +1,323 @@
+package converter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Artifacts a job uploads are job.Artifacts or actions/upload-artifact
+// steps; a job downloads them with actions/download-artifact steps that name
+// the artifact and where its files go.
+
+const (
+	uploadArtifact   = "actions/upload-artifact@v4"
+	downloadArtifact = "actions/download-artifact@v4"
+)
+
+func isUpload(step Step) bool   { return strings.Contains(step.Uses, "upload-artifact") }
+func isDownload(step Step) bool { return strings.Contains(step.Uses, "download-artifact") }
+
+// artifactName is the name upload-artifact gives an artifact
+func artifactName(name string) string {
+	if name == "" {
+		return "artifact"
+	}
+	return name
+}
+
+// jobArtifacts lists what a job uploads, from job.Artifacts and its
+// upload-artifact steps
+func jobArtifacts(job Job) []Artifact {
+	artifacts := append([]Artifact{}, job.Artifacts...)
+	for _, step := range job.Steps {
+		if isUpload(step) {
+			artifacts = append(artifacts, Artifact{Name: artifactName(step.With["name"]), Paths: splitInput(step.With["path"])})
+		}
+	}
+	return artifacts
+}
+
+// artifactPaths collects the job's artifacts and the paths of its
+// upload-artifact steps
+func artifactPaths(job Job) []string {
+	var paths []string
+	for _, a := range jobArtifacts(job) {
+		paths = append(paths, a.Paths...)
+	}
+	return paths
+}
+
+// artifactRoot is the directory upload-artifact stores paths relative to:
+// the deepest directory holding all of them
+func artifactRoot(paths []string) string {
+	root := ""
+	for _, p := range paths {
+		p = strings.TrimSuffix(p, "/")
+		if i := strings.IndexAny(p, "*?["); i >= 0 {
+			p = path.Dir(p[:i] + "x")
+		} else if strings.Contains(path.Base(p), ".") {
+			// Most likely a file
+			p = path.Dir(p)
+		}
+		if root == "" {
+			root = p
+			continue
+		}
+		for root != "." && root != "/" && p != root && !strings.HasPrefix(p, root+"/") {
+			root = path.Dir(root)
+		}
+	}
+	if root == "" {
+		return "."
+	}
+	return root
+}
+
+// downloadStep downloads an artifact to where its paths were uploaded from
+func downloadStep(a Artifact) Step {
+	return Step{Uses: downloadArtifact, With: map[string]string{"name": a.Name, "path": artifactRoot(a.Paths)}}
+}
+
+// downloadPath is where a download step puts an artifact's files. A
+// download without a name fetches every artifact into a directory of its own.
+func downloadPath(step Step, a Artifact) string {
+	p := step.With["path"]
+	if p == "" {
+		p = "."
+	}
+	if step.With["name"] == "" {
+		p = path.Join(p, a.Name)
+	}
+	return path.Clean(p)
+}
+
+// stepArtifacts resolves a download step to the artifacts it fetches, with
+// the jobs uploading them. A download without a name fetches every
+// artifact of the jobs it needs.
+func stepArtifacts(config *PipelineConfig, job Job, step Step) (artifacts []Artifact, producers []string) {
+	name := step.With["name"]
+	for _, other := range config.Jobs {
+		if other.Name == job.Name || (name == "" && !containsString(job.DependsOn, other.Name)) {
+			continue
+		}
+		for _, a := range jobArtifacts(other) {
+			if name != "" && a.Name != name {
+				continue
+			}
+			artifacts = append(artifacts, a)
+			if !containsString(producers, other.Name) {
+				producers = append(producers, other.Name)
+			}
+		}
+	}
+	return artifacts, producers
+}
+
+// artifactDownloads resolves all of a job's download steps
+func artifactDownloads(config *PipelineConfig, job Job) (artifacts []Artifact, producers []string) {
+	for _, step := range job.Steps {
+		if !isDownload(step) {
+			continue
+		}
+		a, p := stepArtifacts(config, job, step)
+		artifacts = append(artifacts, a...)
+		for _, name := range p {
+			if !containsString(producers, name) {
+				producers = append(producers, name)
+			}
+		}
+	}
+	return artifacts, producers
+}
+
+// workspaceDownloads reports whether a job downloads artifacts on a target
+// that hands files over in a shared workspace, where they come back at the
+// paths they were uploaded from
+func workspaceDownloads(config *PipelineConfig, job Job, target string) bool {
+	found := false
+	for _, step := range job.Steps {
+		if !isDownload(step) {
+			continue
+		}
+		artifacts, _ := stepArtifacts(config, job, step)
+		for _, a := range artifacts {
+			found = true
+			if p := downloadPath(step, a); p != artifactRoot(a.Paths) {
+				config.approximated("download-artifact", "job '%s': artifact '%s' is downloaded to %s; on %s its files keep the paths they were uploaded from", job.Name, a.Name, p, target)
+			}
+		}
+	}
+	return found
+}
+
+// downloadedJobs are the jobs whose artifacts later jobs download, which
+// targets without shared artifact storage have to hand over explicitly
+func downloadedJobs(config *PipelineConfig) map[string]bool {
+	downloaded := make(map[string]bool)
+	for _, job := range config.Jobs {
+		_, producers := artifactDownloads(config, job)
+		for _, p := range producers {
+			downloaded[p] = true
+		}
+	}
+	return downloaded
+}
+
+// parseGitLabArtifacts reads a job's artifacts:. Reports other than the
+// job outputs' dotenv file are left out.
+func parseGitLabArtifacts(config *PipelineConfig, where, name string, v interface{}) []Artifact {
+	am, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	config.dropKeys("artifacts in "+where, am, keySet("paths", "name", "when", "expire_in", "reports"))
+	if when := getString(am, "when"); when != "" && when != "on_success" {
+		config.approximated("artifacts:when", "%s: artifacts are uploaded 'when: %s' only if the job succeeds", where, when)
+	}
+	if reports, ok := am["reports"].(map[string]interface{}); ok {
+		for _, k := range sortedKeys(stringMap(reports)) {
+			if k != "dotenv" {
+				config.dropped("artifacts:reports", "%s: '%s' report is not converted", where, k)
+			}
+		}
+	}
+	var paths []string
+	for _, p := range flattenScript(listOf(am["paths"])) {
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	if n := getString(am, "name"); n != "" && !strings.Contains(n, "$") {
+		name = n
+	}
+	return []Artifact{{Name: name, Paths: paths}}
+}
+
+// gitlabArtifactDownloads adds download steps for the artifacts GitLab
+// hands to a job: those of its dependencies:, or else of the jobs it needs
+// without artifacts: false
+func gitlabArtifactDownloads(config *PipelineConfig, from map[string][]string) {
+	byName := make(map[string]Job)
+	for _, job := range config.Jobs {
+		byName[job.Name] = job
+	}
+	for i, job := range config.Jobs {
+		var downloads []Step
+		for _, dep := range from[job.Name] {
+			for _, a := range jobArtifacts(byName[dep]) {
+				downloads = append(downloads, downloadStep(a))
+			}
+		}
+		config.Jobs[i].Steps = append(downloads, job.Steps...)
+	}
+}
+
+// circleCIWorkspaceStep converts persist_to_workspace, attach_workspace
+// and the cache steps of a CircleCI job; it reports whether s was one
+func circleCIWorkspaceStep(config *PipelineConfig, job *Job, s interface{}) bool {
+	sm, ok := s.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	where := fmt.Sprintf("job '%s'", job.Name)
+	for key, v := range sm {
+		opts, _ := v.(map[string]interface{})
+		switch key {
+		case "persist_to_workspace":
+			root := getString(opts, "root")
+			var paths []string
+			for _, p := range flattenScript(listOf(opts["paths"])) {
+				paths = append(paths, path.Join(root, p))
+			}
+			job.Artifacts = append(job.Artifacts, Artifact{Name: job.Name, Paths: paths})
+		case "attach_workspace":
+			// Resolved to the upstream jobs' artifacts once workflows are read
+			job.Steps = append(job.Steps, Step{Uses: downloadArtifact, With: map[string]string{"path": getString(opts, "at")}})
+		case "save_cache":
+			cache, ok := parseCircleCICache(getString(opts, "key"))
+			if !ok {
+				config.dropped("save_cache", "%s: cache key '%s' is not converted", where, getString(opts, "key"))
+				return true
+			}
+			cache.Paths = flattenScript(listOf(opts["paths"]))
+			job.Cache = append(job.Cache, cache)
+		case "restore_cache":
+			// Converted caches are restored where they are saved
+		default:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// circleCIWorkspaces turns attach_workspace downloads into one download
+// per artifact the job's upstream jobs persisted: a CircleCI workspace
+// holds everything persisted earlier in the workflow
+func circleCIWorkspaces(config *PipelineConfig) {
+	byName := make(map[string]Job)
+	for _, job := range config.Jobs {
+		byName[job.Name] = job
+	}
+	var upstream func(name string, seen map[string]bool) []string
+	upstream = func(name string, seen map[string]bool) []string {
+		var names []string
+		for _, dep := range byName[name].DependsOn {
+			if !seen[dep] {
+				seen[dep] = true
+				names = append(append(names, upstream(dep, seen)...), dep)
+			}
+		}
+		return names
+	}
+	for i, job := range config.Jobs {
+		var steps []Step
+		for _, step := range job.Steps {
+			if !isDownload(step) || step.With["name"] != "" {
+				steps = append(steps, step)
+				continue
+			}
+			at := step.With["path"]
+			for _, dep := range upstream(job.Name, make(map[string]bool)) {
+				for _, a := range byName[dep].Artifacts {
+					d := downloadStep(a)
+					d.With["path"] = path.Join(at, d.With["path"])
+					steps = append(steps, d)
+				}
+			}
+		}
+		config.Jobs[i].Steps = steps
+	}
+}
+
+// azurePublish is a PublishPipelineArtifact task. The task publishes one
+// file or directory, so several paths publish the directory holding them.
+func azurePublish(config *PipelineConfig, job string, a Artifact) azureStep {
+	target := artifactRoot(a.Paths)
+	if len(a.Paths) == 1 && !strings.ContainsAny(a.Paths[0], "*?[") {
+		target = strings.TrimSuffix(a.Paths[0], "/")
+	} else {
+		config.approximated("upload-artifact", "job '%s': artifact '%s' publishes all of %s, which holds %s", job, a.Name, target, strings.Join(a.Paths, ", "))
+	}
+	inputs := yamlMap{
+		{Key: "targetPath", Value: "$(Build.SourcesDirectory)/" + strings.TrimPrefix(target, "./")},
+		{Key: "artifact", Value: a.Name},
+	}
+	return azureStep{Task: "PublishPipelineArtifact@1", Inputs: inputs}
+}
+
+// jenkinsIncludes turns artifact paths into Ant patterns; directories
+// include everything below them
+func jenkinsIncludes(paths []string) string {
+	var patterns []string
+	for _, p := range paths {
+		p = strings.TrimSuffix(p, "/")
+		if !strings.ContainsAny(p, "*?[") && !strings.Contains(path.Base(p), ".") {
+			p += "/**"
+		}
+		patterns = append(patterns, p)
+	}
+	return strings.Join(patterns, ",")
+}
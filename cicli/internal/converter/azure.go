@@ -0,0 +1,641 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TaskTranslation turns the inputs of an Azure Pipelines task into a
+// normalized step. Steps set Uses to the GitHub Actions equivalent and Run
+// to a shell equivalent where one exists, so every generator can pick the
+// form its platform supports.
+type TaskTranslation func(inputs map[string]string) Step
+
+// AzureTasks maps Azure task names to translations. Keys are either a name
+// with version (Docker@2) or without (Docker) to match every version; the
+// versioned entry wins. Register additional tasks with RegisterAzureTask.
+var AzureTasks = map[string]TaskTranslation{
+	"NodeTool": func(in map[string]string) Step {
+		return setupStep("actions/setup-node@v4", "node-version", firstInput(in, "versionSpec", "version"), nvmCommand)
+	},
+	"UseNode": func(in map[string]string) Step {
+		return setupStep("actions/setup-node@v4", "node-version", firstInput(in, "version", "versionSpec"), nvmCommand)
+	},
+	"UsePythonVersion": func(in map[string]string) Step {
+		return setupStep("actions/setup-python@v5", "python-version", in["versionSpec"], "pyenv install -s %[1]s && pyenv global %[1]s")
+	},
+	"GoTool": func(in map[string]string) Step {
+		return setupStep("actions/setup-go@v5", "go-version", in["version"], "")
+	},
+	"UseDotNet": func(in map[string]string) Step {
+		return setupStep("actions/setup-dotnet@v4", "dotnet-version", in["version"], "")
+	},
+	"DotNetCoreCLI": func(in map[string]string) Step {
+		command := in["command"]
+		if command == "" {
+			command = "build"
+		}
+		if command == "custom" {
+			command = in["custom"]
+		}
+		args := []string{"dotnet", command}
+		if projects := in["projects"]; projects != "" && command != "push" {
+			args = append(args, projects)
+		}
+		if in["arguments"] != "" {
+			args = append(args, in["arguments"])
+		}
+		return Step{Run: strings.Join(args, " ")}
+	},
+	"Docker": func(in map[string]string) Step {
+		repository := in["repository"]
+		if repository == "" {
+			repository = "$IMAGE_NAME"
+		}
+		var tags []string
+		for _, t := range splitInput(in["tags"]) {
+			tags = append(tags, repository+":"+t)
+		}
+		if len(tags) == 0 {
+			tags = []string{repository + ":latest"}
+		}
+		dockerfile := in["Dockerfile"]
+		if dockerfile == "" {
+			dockerfile = "Dockerfile"
+		}
+		context := in["buildContext"]
+		if context == "" {
+			context = "."
+		}
+
+		build := fmt.Sprintf("docker build -f %s -t %s %s", dockerfile, strings.Join(tags, " -t "), context)
+		if in["arguments"] != "" {
+			build = fmt.Sprintf("docker build %s -f %s -t %s %s", in["arguments"], dockerfile, strings.Join(tags, " -t "), context)
+		}
+		var pushes []string
+		for _, t := range tags {
+			pushes = append(pushes, "docker push "+t)
+		}
+
+		switch in["command"] {
+		case "build":
+			return Step{Run: build}
+		case "push":
+			return Step{Run: strings.Join(pushes, " && ")}
+		case "login":
+			return Step{Run: "echo \"$REGISTRY_PASSWORD\" | docker login -u \"$REGISTRY_USERNAME\" --password-stdin $REGISTRY"}
+		}
+		return Step{Run: build + " && " + strings.Join(pushes, " && ")}
+	},
+	"PublishBuildArtifacts": func(in map[string]string) Step {
+		return artifactStep(firstInput(in, "PathtoPublish", "pathToPublish"), in["ArtifactName"])
+	},
+	"PublishPipelineArtifact": func(in map[string]string) Step {
+		return artifactStep(firstInput(in, "targetPath", "path"), firstInput(in, "artifact", "artifactName"))
+	},
+	"DownloadPipelineArtifact": func(in map[string]string) Step {
+		return downloadStepFor(firstInput(in, "targetPath", "path", "downloadPath"), firstInput(in, "artifact", "artifactName"))
+	},
+	"Cache": func(in map[string]string) Step {
+		cache := azureCacheKey(in["key"])
+		return Step{Uses: "actions/cache@v4", With: map[string]string{"key": githubCacheKey(cache), "path": azureVariables(in["path"])}}
+	},
+	"CmdLine": func(in map[string]string) Step {
+		return Step{Run: in["script"]}
+	},
+	"Bash": func(in map[string]string) Step {
+		if in["targetType"] == "filePath" || (in["filePath"] != "" && in["script"] == "") {
+			return Step{Run: strings.TrimSpace("bash " + in["filePath"] + " " + in["arguments"])}
+		}
+		return Step{Run: in["script"]}
+	},
+}
+
+// RegisterAzureTask adds or replaces the translation for an Azure task
+func RegisterAzureTask(name string, t TaskTranslation) {
+	AzureTasks[name] = t
+}
+
+// translateAzureTask looks up a task such as Docker@2 in AzureTasks
+func translateAzureTask(task string, inputs map[string]string) (Step, bool) {
+	if t, ok := AzureTasks[task]; ok {
+		return t(inputs), true
+	}
+	name := task
+	if i := strings.Index(task, "@"); i >= 0 {
+		name = task[:i]
+	}
+	if t, ok := AzureTasks[name]; ok {
+		return t(inputs), true
+	}
+	return Step{}, false
+}
+
+// nvmCommand installs a Node version; nvm does not understand 20.x ranges
+const nvmCommand = "nvm install %[1]s && nvm use %[1]s"
+
+// setupStep installs a toolchain version; run is a format with the
+// version as its first argument, or empty when the image provides the tool
+func setupStep(action, input, version, run string) Step {
+	step := Step{Uses: action}
+	if version != "" {
+		step.With = map[string]string{input: version}
+		if run != "" {
+			step.Run = fmt.Sprintf(run, strings.TrimSuffix(version, ".x"))
+		}
+	}
+	return step
+}
+
+// artifactStep uploads a path; generators turn it into native artifacts
+func artifactStep(path, name string) Step {
+	if path == "" {
+		path = "$(Build.ArtifactStagingDirectory)"
+	}
+	if name == "" {
+		name = "drop"
+	}
+	return Step{Uses: "actions/upload-artifact@v4", With: map[string]string{"name": name, "path": azureVariables(path)}}
+}
+
+// downloadStepFor downloads an artifact, or all of them without a name, to
+// path; Azure downloads to the pipeline workspace by default
+func downloadStepFor(path, name string) Step {
+	if path == "" {
+		path = "$(Pipeline.Workspace)"
+	}
+	with := map[string]string{"path": azureVariables(path)}
+	if name != "" {
+		with["name"] = name
+	}
+	return Step{Uses: downloadArtifact, With: with}
+}
+
+func firstInput(in map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if in[k] != "" {
+			return in[k]
+		}
+	}
+	return ""
+}
+
+// splitInput splits a multi-line or comma-separated task input
+func splitInput(v string) []string {
+	var out []string
+	for _, part := range strings.FieldsFunc(v, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// azureVariables rewrites predefined Azure path variables to plain relative paths
+func azureVariables(s string) string {
+	for _, v := range []string{"$(Build.ArtifactStagingDirectory)", "$(Build.SourcesDirectory)", "$(System.DefaultWorkingDirectory)", "$(Pipeline.Workspace)"} {
+		s = strings.ReplaceAll(s, v+"/", "")
+		s = strings.ReplaceAll(s, v, ".")
+	}
+	return s
+}
+
+// parseAzure parses Azure Pipelines config: a bare steps: list, jobs:, or
+// stages: with jobs. Stages without dependsOn run after the previous one.
+// Local templates are expanded relative to dir, the input's directory.
+func (c *Converter) parseAzure(content []byte, dir string) (*PipelineConfig, error) {
+	var az map[string]interface{}
+	if err := yaml.Unmarshal(content, &az); err != nil {
+		return nil, err
+	}
+
+	config := &PipelineConfig{Jobs: []Job{}, Comment: parseComments(content).header()}
+	if az == nil {
+		az = map[string]interface{}{}
+	}
+	az = expandAzureTemplates(config, az, dir)
+	config.dropKeys("pipeline", az, keySet("name", "trigger", "pr", "variables", "pool", "parameters", "resources", "stages", "jobs", "steps"))
+	resources := azureContainerResources(config, az["resources"])
+	config.Name = getString(az, "name")
+	config.Triggers = azureTriggers(az)
+	config.Environment = azureVariablesMap(az["variables"])
+	azureVariableGroups(config, az["variables"])
+	if config.Name == "" || strings.Contains(config.Name, "$(") {
+		// name: is the run number format, e.g. $(Date:yyyyMMdd)$(Rev:.r)
+		config.Name = "Pipeline"
+	}
+	runsOn := azurePool(az["pool"])
+
+	type stage struct {
+		name      string
+		dependsOn []string
+		explicit  bool
+		variables map[string]string
+		jobs      []interface{}
+	}
+	var stages []stage
+	switch {
+	case az["stages"] != nil:
+		list, _ := az["stages"].([]interface{})
+		for _, s := range list {
+			sd, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if getString(sd, "template") != "" {
+				// Left in place when it could not be expanded, which was noted
+				continue
+			}
+			st := stage{name: getString(sd, "stage"), variables: azureVariablesMap(sd["variables"])}
+			config.dropKeys(fmt.Sprintf("stage '%s'", st.name), sd, keySet("stage", "displayName", "dependsOn", "variables", "jobs"))
+			azureVariableGroups(config, sd["variables"])
+			st.dependsOn, st.explicit = azureDependsOn(sd)
+			st.jobs, _ = sd["jobs"].([]interface{})
+			stages = append(stages, st)
+		}
+	case az["jobs"] != nil:
+		jobs, _ := az["jobs"].([]interface{})
+		stages = []stage{{jobs: jobs, explicit: true}}
+	case az["steps"] != nil:
+		stages = []stage{{jobs: []interface{}{map[string]interface{}{"job": "build", "steps": az["steps"]}}, explicit: true}}
+	}
+
+	// Job names are only unique within a stage
+	count := make(map[string]int)
+	for _, st := range stages {
+		for _, j := range st.jobs {
+			if jd, ok := j.(map[string]interface{}); ok {
+				count[azureJobName(jd)]++
+			}
+		}
+	}
+	jobName := func(stageName string, jd map[string]interface{}) string {
+		name := azureJobName(jd)
+		if count[name] > 1 && stageName != "" {
+			return stageName + "_" + name
+		}
+		return name
+	}
+
+	stageJobs := make(map[string][]string)
+	for i, st := range stages {
+		deps := st.dependsOn
+		if !st.explicit && i > 0 {
+			deps = []string{stages[i-1].name}
+		}
+		var stageDeps []string
+		for _, d := range deps {
+			stageDeps = append(stageDeps, stageJobs[d]...)
+		}
+
+		for _, j := range st.jobs {
+			jd, ok := j.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if getString(jd, "template") != "" {
+				continue
+			}
+			azureVariableGroups(config, jd["variables"])
+
+			job := Job{
+				Name:        jobName(st.name, jd),
+				RunsOn:      runsOn,
+				Container:   parseContainer(jd["container"]),
+				Services:    azureJobServices(config, jobName(st.name, jd), jd["services"], resources),
+				Environment: azureVariablesMap(jd["variables"]),
+				Condition:   getString(jd, "condition"),
+				Steps:       []Step{},
+			}
+			if name, ok := jd["container"].(string); ok {
+				// A container resource, or an image given directly
+				if res, ok := resources[name]; ok {
+					job.Container = &Container{Image: res.Image, Env: res.Env}
+				}
+			}
+			if jd["pool"] != nil {
+				job.RunsOn = azurePool(jd["pool"])
+			}
+			handled := keySet("job", "deployment", "displayName", "pool", "container", "services", "variables", "condition", "dependsOn", "steps", "environment")
+			if jd["environment"] != nil {
+				// Deployment jobs keep their steps under strategy
+				handled["strategy"] = true
+			}
+			config.dropKeys(fmt.Sprintf("job '%s'", job.Name), jd, handled)
+			if len(st.variables) > 0 {
+				// Stage variables apply to every job; job variables win
+				env := make(map[string]string)
+				for k, v := range st.variables {
+					env[k] = v
+				}
+				for k, v := range job.Environment {
+					env[k] = v
+				}
+				job.Environment = env
+			}
+			job.DependsOn = append(job.DependsOn, stageDeps...)
+			if jobDeps, _ := azureDependsOn(jd); len(jobDeps) > 0 {
+				for _, d := range jobDeps {
+					job.DependsOn = append(job.DependsOn, jobName(st.name, map[string]interface{}{"job": d}))
+				}
+			}
+
+			steps, _ := jd["steps"].([]interface{})
+			if env := environmentName(jd["environment"]); env != "" {
+				// Deployment jobs: approvals are configured on the environment
+				job.Gate = &Gate{Environment: env}
+				if strategy, ok := jd["strategy"].(map[string]interface{}); ok {
+					if once, ok := strategy["runOnce"].(map[string]interface{}); ok {
+						if deploy, ok := once["deploy"].(map[string]interface{}); ok {
+							steps, _ = deploy["steps"].([]interface{})
+						}
+					}
+				}
+			}
+			defined := make(map[string]string)
+			for k, v := range config.Environment {
+				defined[k] = v
+			}
+			for k, v := range job.Environment {
+				defined[k] = v
+			}
+			for _, s := range steps {
+				if sd, ok := s.(map[string]interface{}); ok {
+					if step, ok := c.parseAzureStep(config, job.Name, defined, sd); ok {
+						job.Steps = append(job.Steps, step)
+					}
+				}
+			}
+
+			stageJobs[st.name] = append(stageJobs[st.name], job.Name)
+			config.Jobs = append(config.Jobs, job)
+		}
+	}
+
+	return config, nil
+}
+
+// parseAzureStep converts script shortcuts, checkout and tasks. defined
+// holds the pipeline and job variables.
+func (c *Converter) parseAzureStep(config *PipelineConfig, job string, defined map[string]string, sd map[string]interface{}) (Step, bool) {
+	var step Step
+	for _, key := range []string{"script", "bash", "pwsh", "powershell"} {
+		if run := getString(sd, key); run != "" {
+			step.Run = strings.TrimRight(run, "\n")
+			if key == "pwsh" || key == "powershell" {
+				config.approximated("pwsh", "job '%s' runs PowerShell; the converted step runs it in the default shell", job)
+			}
+		}
+	}
+
+	switch {
+	case step.Run != "":
+	case getString(sd, "publish") != "":
+		step = artifactStep(getString(sd, "publish"), getString(sd, "artifact"))
+	case getString(sd, "download") != "":
+		switch getString(sd, "download") {
+		case "none":
+			return Step{}, false
+		case "current":
+			name := getString(sd, "artifact")
+			step = downloadStepFor("$(Pipeline.Workspace)/"+name, name)
+			if name == "" {
+				step = downloadStepFor("", "")
+			}
+		default:
+			config.dropped("download", "job '%s' downloads artifacts of pipeline resource '%s', which is not converted", job, getString(sd, "download"))
+			return Step{}, false
+		}
+	case sd["checkout"] != nil:
+		if getString(sd, "checkout") == "none" {
+			return Step{}, false
+		}
+		step.Uses = "actions/checkout@v4"
+	case getString(sd, "task") != "":
+		task := getString(sd, "task")
+		inputs := make(map[string]string)
+		if in, ok := sd["inputs"].(map[string]interface{}); ok {
+			for k, v := range in {
+				inputs[k] = fmt.Sprint(v)
+			}
+		}
+		translated, ok := translateAzureTask(task, inputs)
+		if !ok {
+			keys := make([]string, 0, len(inputs))
+			for k := range inputs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			translated = Step{Run: fmt.Sprintf("echo \"Task %s (manual conversion needed): %s\" && exit 1", task, strings.Join(keys, ", "))}
+			config.dropped("task", "job '%s' uses task %s, which has no translation; add one with converter.RegisterAzureTask", job, task)
+		}
+		step = translated
+	case getString(sd, "template") != "":
+		// Left in place when it could not be expanded, which was noted
+		return Step{}, false
+	default:
+		return Step{}, false
+	}
+
+	if name := getString(sd, "displayName"); name != "" {
+		step.Name = name
+	}
+	label := step.Name
+	if label == "" {
+		label = strings.SplitN(step.Uses+step.Run, "\n", 2)[0]
+	}
+	config.dropKeys(fmt.Sprintf("step '%s' in job '%s'", label, job), sd, azureStepKeys)
+	if cond := getString(sd, "condition"); cond != "" {
+		step.If = cond
+	}
+	if wd := getString(sd, "workingDirectory"); wd != "" {
+		step.WorkDir = azureVariables(wd)
+	}
+	if env := azureVariablesMap(sd["env"]); len(env) > 0 {
+		step.Env = env
+	}
+
+	step.Run = azureMacros(config, job, step.Run)
+	for k, v := range step.With {
+		step.With[k] = azureMacros(config, job, v)
+	}
+	for k, v := range step.Env {
+		// A whole-value reference maps to an expression; undefined
+		// variables are secrets or come from a variable group
+		if m := azureMacroPattern.FindStringSubmatch(v); m != nil && m[0] == v && !strings.Contains(m[1], ".") {
+			if _, ok := defined[m[1]]; ok {
+				step.Env[k] = fmt.Sprintf("${{ env.%s }}", m[1])
+			} else {
+				step.Env[k] = fmt.Sprintf("${{ secrets.%s }}", m[1])
+			}
+			continue
+		}
+		step.Env[k] = azureMacros(config, job, v)
+	}
+	return step, true
+}
+
+// azureStepKeys are the step keys parseAzureStep converts
+var azureStepKeys = keySet("script", "bash", "pwsh", "powershell", "checkout", "task", "inputs", "publish", "download", "artifact", "name", "displayName", "condition", "workingDirectory", "env")
+
+var azureMacroPattern = regexp.MustCompile(`\$\(([A-Za-z_][A-Za-z0-9_.]*)\)`)
+
+// azurePredefined maps predefined Azure variables to the GitHub runner
+// variables that hold the same value
+var azurePredefined = map[string]string{
+	"Build.BuildId":          "$GITHUB_RUN_ID",
+	"Build.BuildNumber":      "$GITHUB_RUN_NUMBER",
+	"Build.SourceVersion":    "$GITHUB_SHA",
+	"Build.SourceBranch":     "$GITHUB_REF",
+	"Build.SourceBranchName": "$GITHUB_REF_NAME",
+	"Build.Repository.Name":  "$GITHUB_REPOSITORY",
+	"Build.RequestedFor":     "$GITHUB_ACTOR",
+	"Agent.TempDirectory":    "$RUNNER_TEMP",
+	"Agent.OS":               "$RUNNER_OS",
+}
+
+// azureMacros rewrites $(var) macro syntax, which a shell would run as a
+// command substitution, to variable references
+func azureMacros(config *PipelineConfig, job, s string) string {
+	s = azureVariables(s)
+	return azureMacroPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := azureMacroPattern.FindStringSubmatch(ref)[1]
+		if v, ok := azurePredefined[name]; ok {
+			return v
+		}
+		if strings.Contains(name, ".") {
+			config.note("job '%s' uses predefined variable %s, which has no equivalent; review the converted command", job, name)
+			return ref
+		}
+		return "$" + name
+	})
+}
+
+func azureJobName(jd map[string]interface{}) string {
+	if name := getString(jd, "job"); name != "" {
+		return name
+	}
+	return getString(jd, "deployment")
+}
+
+// azureDependsOn reads dependsOn given as a string or list; explicit is
+// true when the key is present, since dependsOn: [] removes the default
+func azureDependsOn(d map[string]interface{}) (deps []string, explicit bool) {
+	switch v := d["dependsOn"].(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		for _, x := range v {
+			deps = append(deps, fmt.Sprint(x))
+		}
+		return deps, true
+	}
+	return nil, false
+}
+
+// azurePool maps Microsoft-hosted images to runner labels
+func azurePool(v interface{}) string {
+	image := ""
+	switch p := v.(type) {
+	case map[string]interface{}:
+		image = getString(p, "vmImage")
+	case string:
+		image = p
+	}
+	switch {
+	case strings.HasPrefix(image, "windows"):
+		return "windows-latest"
+	case strings.HasPrefix(image, "macOS") || strings.HasPrefix(image, "macos"):
+		return "macos-latest"
+	}
+	return "ubuntu-latest"
+}
+
+// azureVariablesMap reads variables given as a map or as a list of
+// name/value entries; groups and templates are skipped
+func azureVariablesMap(v interface{}) map[string]string {
+	vars := make(map[string]string)
+	switch vs := v.(type) {
+	case map[string]interface{}:
+		for k, val := range vs {
+			vars[k] = fmt.Sprint(val)
+		}
+	case []interface{}:
+		for _, entry := range vs {
+			if e, ok := entry.(map[string]interface{}); ok && getString(e, "name") != "" {
+				vars[getString(e, "name")] = fmt.Sprint(e["value"])
+			}
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+	return vars
+}
+
+// azureVariableGroups notes the variable groups a variables: list links,
+// since their values live in the Azure DevOps library
+func azureVariableGroups(config *PipelineConfig, v interface{}) {
+	list, _ := v.([]interface{})
+	for _, entry := range list {
+		if e, ok := entry.(map[string]interface{}); ok && getString(e, "group") != "" {
+			config.dropped("group", "variable group '%s' is not converted; recreate its variables as secrets or variables on the target", getString(e, "group"))
+		}
+	}
+}
+
+// azureTriggers reads trigger: and pr: given as none, a branch list or a map
+func azureTriggers(az map[string]interface{}) []Trigger {
+	var triggers []Trigger
+	for key, typ := range map[string]string{"trigger": "push", "pr": "pull_request"} {
+		v, ok := az[key]
+		if !ok {
+			if key == "trigger" {
+				// CI runs on every branch when trigger is omitted
+				triggers = append(triggers, Trigger{Type: typ})
+			}
+			continue
+		}
+		t := Trigger{Type: typ}
+		switch tv := v.(type) {
+		case string:
+			if tv == "none" {
+				continue
+			}
+		case []interface{}:
+			for _, b := range tv {
+				t.Branches = append(t.Branches, fmt.Sprint(b))
+			}
+		case map[string]interface{}:
+			if branches, ok := tv["branches"].(map[string]interface{}); ok {
+				if include, ok := branches["include"].([]interface{}); ok {
+					for _, b := range include {
+						t.Branches = append(t.Branches, fmt.Sprint(b))
+					}
+				}
+			}
+			if paths, ok := tv["paths"].(map[string]interface{}); ok {
+				if include, ok := paths["include"].([]interface{}); ok {
+					for _, p := range include {
+						t.Paths = append(t.Paths, fmt.Sprint(p))
+					}
+				}
+			}
+		}
+		triggers = append(triggers, t)
+	}
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i].Type == "push" && triggers[j].Type != "push" })
+
+	if schedules, ok := az["schedules"].([]interface{}); ok {
+		for _, s := range schedules {
+			if sd, ok := s.(map[string]interface{}); ok && getString(sd, "cron") != "" {
+				triggers = append(triggers, Trigger{Type: "schedule", Cron: getString(sd, "cron")})
+			}
+		}
+	}
+	return triggers
+}
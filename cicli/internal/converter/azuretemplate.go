@@ -0,0 +1,261 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// azureTemplateKeys are the lists a template reference can appear in; the
+// template file provides the list under the same key
+var azureTemplateKeys = map[string]bool{"stages": true, "jobs": true, "steps": true, "variables": true}
+
+// maxTemplateDepth stops templates that include each other
+const maxTemplateDepth = 20
+
+var (
+	parameterPattern    = regexp.MustCompile(`\$\{\{\s*parameters\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	templateExprPattern = regexp.MustCompile(`\$\{\{`)
+)
+
+// azureTemplates expands local template references in an Azure pipeline:
+// extends:, and stage, job, step and variable templates. Parameters are
+// substituted from the reference, falling back to the template's defaults.
+// Templates from other repositories are left for the parser to report.
+type azureTemplates struct {
+	config *PipelineConfig
+}
+
+// expandAzureTemplates expands the pipeline read from dir in place
+func expandAzureTemplates(config *PipelineConfig, az map[string]interface{}, dir string) map[string]interface{} {
+	e := &azureTemplates{config: config}
+	az = substituteParameters(az, parameterDefaults(az["parameters"])).(map[string]interface{})
+
+	if ext, ok := az["extends"].(map[string]interface{}); ok {
+		if tpl := getString(ext, "template"); tpl != "" {
+			if base, baseDir, ok := e.load(tpl, dir, ext["parameters"]); ok {
+				// The extended template provides the body; the pipeline keeps its triggers
+				for k, v := range base {
+					if _, set := az[k]; !set || azureTemplateKeys[k] {
+						az[k] = v
+					}
+				}
+				delete(az, "extends")
+				return e.expand(az, baseDir, 0).(map[string]interface{})
+			}
+		}
+	}
+	return e.expand(az, dir, 0).(map[string]interface{})
+}
+
+// expand walks a node and splices templates into every stages, jobs, steps
+// and variables list
+func (e *azureTemplates) expand(node interface{}, dir string, depth int) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if list, ok := v.([]interface{}); ok && azureTemplateKeys[k] {
+				n[k] = e.expandList(list, k, dir, depth)
+				continue
+			}
+			n[k] = e.expand(v, dir, depth)
+		}
+		return n
+	case []interface{}:
+		for i, v := range n {
+			n[i] = e.expand(v, dir, depth)
+		}
+		return n
+	}
+	return node
+}
+
+func (e *azureTemplates) expandList(list []interface{}, key, dir string, depth int) []interface{} {
+	var out []interface{}
+	for _, item := range list {
+		im, ok := item.(map[string]interface{})
+		tpl := ""
+		if ok {
+			tpl = getString(im, "template")
+		}
+		if tpl == "" {
+			out = append(out, e.expand(item, dir, depth))
+			continue
+		}
+		if depth >= maxTemplateDepth {
+			e.config.dropped("template", "template '%s' is nested more than %d levels deep; not expanded", tpl, maxTemplateDepth)
+			out = append(out, item)
+			continue
+		}
+		body, tplDir, ok := e.load(tpl, dir, im["parameters"])
+		if !ok {
+			out = append(out, item)
+			continue
+		}
+		switch v := body[key].(type) {
+		case []interface{}:
+			out = append(out, e.expandList(v, key, tplDir, depth+1)...)
+		case map[string]interface{}:
+			// Variable templates may use the map form
+			for _, name := range sortedKeys(stringMap(v)) {
+				out = append(out, map[string]interface{}{"name": name, "value": v[name]})
+			}
+		default:
+			e.config.dropped("template", "template '%s' has no %s: list", tpl, key)
+		}
+	}
+	return out
+}
+
+// load reads a template relative to the file that references it and
+// substitutes its parameters
+func (e *azureTemplates) load(tpl, dir string, params interface{}) (map[string]interface{}, string, bool) {
+	if strings.Contains(tpl, "@") {
+		e.config.dropped("template", "template '%s' comes from another repository; not expanded", tpl)
+		return nil, "", false
+	}
+	path := filepath.Join(dir, tpl)
+	if strings.HasPrefix(tpl, "/") {
+		// Absolute template paths start at the repository root
+		path = filepath.Join(repoRoot(dir), tpl)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		e.config.dropped("template", "template '%s' not found; not expanded", tpl)
+		return nil, "", false
+	}
+	var body map[string]interface{}
+	if err := yaml.Unmarshal(data, &body); err != nil || body == nil {
+		e.config.dropped("template", "template '%s' is not valid YAML; not expanded", tpl)
+		return nil, "", false
+	}
+
+	values := parameterDefaults(body["parameters"])
+	if pm, ok := params.(map[string]interface{}); ok {
+		for k, v := range pm {
+			values[k] = v
+		}
+	}
+	delete(body, "parameters")
+	body = substituteParameters(body, values).(map[string]interface{})
+	if e.hasExpressions(body) {
+		e.config.approximated("${{ }}", "template '%s' uses ${{ }} conditions or loops, which are not evaluated", tpl)
+	}
+	return body, filepath.Dir(path), true
+}
+
+// hasExpressions reports whether template expressions remain after
+// parameters were substituted
+func (e *azureTemplates) hasExpressions(node interface{}) bool {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if templateExprPattern.MatchString(k) || e.hasExpressions(v) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range n {
+			if e.hasExpressions(v) {
+				return true
+			}
+		}
+	case string:
+		return templateExprPattern.MatchString(n)
+	}
+	return false
+}
+
+// parameterDefaults reads parameters given as a list of {name, default}
+// entries or as the older name: default map
+func parameterDefaults(v interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	switch ps := v.(type) {
+	case []interface{}:
+		for _, p := range ps {
+			if pm, ok := p.(map[string]interface{}); ok && getString(pm, "name") != "" {
+				if d, ok := pm["default"]; ok {
+					values[getString(pm, "name")] = d
+				}
+			}
+		}
+	case map[string]interface{}:
+		for k, d := range ps {
+			values[k] = d
+		}
+	}
+	return values
+}
+
+// substituteParameters replaces ${{ parameters.x }}. A list or object
+// parameter used as a whole value is inserted as is, so stepList and
+// object parameters splice in.
+func substituteParameters(node interface{}, values map[string]interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			n[k] = substituteParameters(v, values)
+		}
+		return n
+	case []interface{}:
+		var out []interface{}
+		for _, item := range n {
+			v := substituteParameters(item, values)
+			// A list parameter used as a list item splices its items in
+			if s, ok := item.(string); ok && isWholeParameter(s) {
+				if list, ok := v.([]interface{}); ok {
+					out = append(out, list...)
+					continue
+				}
+			}
+			out = append(out, v)
+		}
+		return out
+	case string:
+		if isWholeParameter(n) {
+			switch v := values[parameterPattern.FindStringSubmatch(n)[1]].(type) {
+			case []interface{}, map[string]interface{}:
+				return v
+			}
+		}
+		return parameterPattern.ReplaceAllStringFunc(n, func(ref string) string {
+			name := parameterPattern.FindStringSubmatch(ref)[1]
+			if v, ok := values[name]; ok {
+				return fmt.Sprint(v)
+			}
+			return ref
+		})
+	}
+	return node
+}
+
+func isWholeParameter(s string) bool {
+	m := parameterPattern.FindString(s)
+	return m != "" && m == strings.TrimSpace(s)
+}
+
+func stringMap(m map[string]interface{}) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = fmt.Sprint(v)
+	}
+	return out
+}
+
+// repoRoot returns the closest directory above dir that holds .git, or dir
+func repoRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
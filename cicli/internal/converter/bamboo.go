@@ -0,0 +1,443 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Bamboo Specs YAML (bamboo-specs/bamboo.yml) describes a plan: stages run
+// one after another and the jobs of a stage side by side. Jobs are
+// top-level keys named in the stages. Further documents in the file can
+// describe a deployment project whose environments deploy the plan's
+// artifacts. Bamboo is a conversion source only.
+
+var (
+	bambooReference = regexp.MustCompile(`\$\{bamboo[._]([A-Za-z0-9_.]+)\}`)
+	bambooSecret    = regexp.MustCompile(`(?i)password|secret|passphrase|sshkey|token`)
+)
+
+// bambooPlanKeys are the top-level keys of a plan document that are not jobs
+var bambooPlanKeys = keySet("version", "plan", "stages", "variables", "triggers", "branches", "notifications", "labels",
+	"dependencies", "other", "repositories", "plan-permissions", "deployment", "release-naming", "environments",
+	"deployment-permissions", "environment-permissions")
+
+var bambooJobKeys = keySet("key", "description", "docker", "tasks", "final-tasks", "artifacts", "artifact-subscriptions",
+	"requirements", "other", "variables", "triggers", "notifications")
+
+type bambooParser struct {
+	config    *PipelineConfig
+	names     map[string]bool
+	variables map[string]string // plan variables, inlined where no shell expands them
+}
+
+// parseBamboo parses Bamboo Specs: a plan document and any deployment
+// project documents after it
+func (c *Converter) parseBamboo(content []byte) (*PipelineConfig, error) {
+	config := &PipelineConfig{Name: "Pipeline", Jobs: []Job{}}
+	p := &bambooParser{config: config, names: make(map[string]bool), variables: make(map[string]string)}
+	if bytes.Contains(content, []byte("!include")) {
+		config.dropped("!include", "!include tags are not followed; convert the included files' jobs by hand")
+	}
+
+	var last []string
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		bd, _ := rawNode(doc.Content[0]).(map[string]interface{})
+		switch {
+		case bd["plan"] != nil:
+			last = p.plan(bd)
+		case bd["deployment"] != nil:
+			p.deployment(bd, last)
+		}
+	}
+	if len(config.Jobs) == 0 {
+		return nil, fmt.Errorf("no plan found")
+	}
+	if len(config.Triggers) == 0 {
+		config.Triggers = []Trigger{{Type: "push"}}
+		config.note("the plan has no triggers; Bamboo then builds on repository changes, so the workflow runs on push")
+	}
+	return config, nil
+}
+
+// plan converts a plan document and returns the jobs of its last stage
+func (p *bambooParser) plan(bd map[string]interface{}) []string {
+	config := p.config
+	if plan, ok := bd["plan"].(map[string]interface{}); ok && getString(plan, "name") != "" {
+		config.Name = getString(plan, "name")
+	}
+	for _, k := range sortedKeys(stringMap(bd)) {
+		if bambooPlanKeys[k] {
+			continue
+		}
+		if _, ok := bd[k].(map[string]interface{}); !ok {
+			config.dropped(k, "plan: '%s' is not converted", k)
+		}
+	}
+	for _, k := range []string{"notifications", "labels", "dependencies", "other", "repositories", "plan-permissions"} {
+		if bd[k] != nil {
+			config.dropped(k, "plan: '%s' is not converted", k)
+		}
+	}
+	config.Environment = p.env(bd["variables"])
+	config.Triggers = append(config.Triggers, p.triggers(bd["triggers"])...)
+	if branches, ok := bd["branches"].(map[string]interface{}); ok {
+		config.dropKeys("branches", branches, keySet("create", "delete", "link-to-jira"))
+		if getString(branches, "create") == "for-pull-request" || getString(branches, "create") == "for-new-branch-and-pull-request" {
+			config.Triggers = append(config.Triggers, Trigger{Type: "pull_request"})
+		}
+	}
+
+	var after []string
+	for _, item := range listOf(bd["stages"]) {
+		stages, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, stageName := range sortedKeys(stringMap(stages)) {
+			sd, _ := stages[stageName].(map[string]interface{})
+			where := fmt.Sprintf("stage '%s'", stageName)
+			config.dropKeys(where, sd, keySet("jobs", "manual", "final", "description"))
+			var current []string
+			for _, jobName := range flattenScript(listOf(sd["jobs"])) {
+				jd, ok := bd[jobName].(map[string]interface{})
+				if !ok {
+					config.dropped("jobs", "%s names job '%s', which is not defined in this file", where, jobName)
+					continue
+				}
+				job := p.job(jobName, jd)
+				job.DependsOn = append([]string{}, after...)
+				if fmt.Sprint(sd["manual"]) == "true" {
+					job.Gate = &Gate{Manual: true}
+				}
+				if fmt.Sprint(sd["final"]) == "true" {
+					job.Condition = "always()"
+				}
+				config.Jobs = append(config.Jobs, job)
+				current = append(current, job.Name)
+			}
+			if len(current) > 0 {
+				after = current
+			}
+		}
+	}
+	return after
+}
+
+// deployment converts a deployment project: every environment becomes a
+// job deploying after the plan's last stage
+func (p *bambooParser) deployment(bd map[string]interface{}, after []string) {
+	config := p.config
+	name := fmt.Sprint(bd["deployment"])
+	if dm, ok := bd["deployment"].(map[string]interface{}); ok {
+		name = getString(dm, "name")
+	}
+	for _, k := range []string{"deployment-permissions", "environment-permissions"} {
+		if bd[k] != nil {
+			config.dropped(k, "deployment '%s': '%s' is not converted; set up environment protection rules instead", name, k)
+		}
+	}
+	envJobs := make(map[string]string)
+	for _, envName := range flattenScript(listOf(bd["environments"])) {
+		ed, _ := bd[envName].(map[string]interface{})
+		job := p.job(envName, ed)
+		job.DependsOn = append([]string{}, after...)
+		job.Gate = &Gate{Environment: envName, Manual: true}
+		for _, t := range listOf(ed["triggers"]) {
+			switch tm := t.(type) {
+			case string:
+				if tm == "build-success" {
+					job.Gate.Manual = false
+				}
+			case map[string]interface{}:
+				if from := getString(tm, "environment-success"); from != "" && envJobs[from] != "" {
+					job.DependsOn = []string{envJobs[from]}
+					job.Gate.Manual = false
+				} else {
+					config.dropped("triggers", "environment '%s': trigger %v is not converted", envName, tm)
+				}
+			}
+		}
+		if job.Gate.Manual {
+			config.note("environment '%s' was deployed by hand; approve it through the environment's required reviewers", envName)
+		}
+		envJobs[envName] = job.Name
+		config.Jobs = append(config.Jobs, job)
+	}
+}
+
+// job converts a plan job or a deployment environment
+func (p *bambooParser) job(name string, jd map[string]interface{}) Job {
+	config := p.config
+	jobName := strings.Trim(nonNameChars.ReplaceAllString(sanitizeName(name), "-"), "-")
+	if jobName == "" {
+		jobName = fmt.Sprintf("job-%d", len(config.Jobs)+1)
+	}
+	base := jobName
+	for i := 2; p.names[jobName]; i++ {
+		jobName = fmt.Sprintf("%s-%d", base, i)
+	}
+	p.names[jobName] = true
+
+	where := fmt.Sprintf("job '%s'", name)
+	config.dropKeys(where, jd, bambooJobKeys)
+	job := Job{Name: jobName, RunsOn: "ubuntu-latest", Steps: []Step{}, Environment: p.env(jd["variables"])}
+	for _, k := range []string{"other", "notifications"} {
+		if jd[k] != nil {
+			config.dropped(k, "%s: '%s' is not converted", where, k)
+		}
+	}
+	if jd["requirements"] != nil {
+		config.note("%s has agent requirements; pick a runner with matching labels", where)
+	}
+
+	switch docker := jd["docker"].(type) {
+	case string:
+		job.Container = &Container{Image: p.value(docker)}
+	case map[string]interface{}:
+		config.dropKeys(where+" docker", docker, keySet("image", "docker-run-arguments", "volumes", "use-default-volumes"))
+		job.Container = &Container{Image: p.value(getString(docker, "image"))}
+		if args := flattenScript(listOf(docker["docker-run-arguments"])); len(args) > 0 {
+			job.Container.Options = strings.Join(args, " ")
+		}
+		if docker["volumes"] != nil {
+			config.dropped("volumes", "%s mounts volumes into its container; they are not converted", where)
+		}
+	}
+
+	for _, sub := range listOf(jd["artifact-subscriptions"]) {
+		sm, _ := sub.(map[string]interface{})
+		step := Step{Uses: downloadArtifact, With: map[string]string{"name": getString(sm, "artifact"), "path": "."}}
+		if dest := getString(sm, "destination"); dest != "" {
+			step.With["path"] = dest
+		}
+		job.Steps = append(job.Steps, step)
+	}
+	for _, task := range listOf(jd["tasks"]) {
+		job.Steps = append(job.Steps, p.task(where, task, "")...)
+	}
+	for _, task := range listOf(jd["final-tasks"]) {
+		job.Steps = append(job.Steps, p.task(where, task, "always()")...)
+	}
+
+	for _, a := range listOf(jd["artifacts"]) {
+		am, _ := a.(map[string]interface{})
+		config.dropKeys(where+" artifact", am, keySet("name", "location", "pattern", "shared", "required"))
+		pattern := getString(am, "pattern")
+		if pattern == "" {
+			pattern = "**/*"
+		}
+		job.Artifacts = append(job.Artifacts, Artifact{Name: getString(am, "name"), Paths: []string{path.Join(getString(am, "location"), p.text(pattern))}})
+	}
+	return job
+}
+
+// task converts a task entry: a name (- clean) or a one-key map
+func (p *bambooParser) task(where string, task interface{}, condition string) []Step {
+	kind, td := fmt.Sprint(task), map[string]interface{}{}
+	var value interface{}
+	if tm, ok := task.(map[string]interface{}); ok {
+		for k, v := range tm {
+			kind, value = k, v
+		}
+		td, _ = value.(map[string]interface{})
+	}
+	if td != nil && td["conditions"] != nil {
+		p.config.dropped("conditions", "%s: %s task runs under conditions; it now always runs", where, kind)
+	}
+	step := Step{Name: getString(td, "description"), If: condition}
+
+	switch kind {
+	case "checkout":
+		if td != nil && (getString(td, "repository") != "" || getString(td, "path") != "") {
+			p.config.dropped("checkout", "%s checks out another repository; add an actions/checkout step for it", where)
+		}
+		return nil
+	case "clean":
+		return nil
+	case "script":
+		var lines []string
+		switch s := value.(type) {
+		case string:
+			lines = []string{s}
+		case []interface{}:
+			lines = flattenScript(s)
+		case map[string]interface{}:
+			p.config.dropKeys(where+" script", s, keySet("interpreter", "scripts", "file", "argument", "environment", "working-dir", "description", "conditions"))
+			lines = flattenScript(listOf(s["scripts"]))
+			if file := getString(s, "file"); file != "" {
+				lines = []string{strings.TrimSpace("./" + strings.TrimPrefix(file, "./") + " " + getString(s, "argument"))}
+			}
+			if interpreter := getString(s, "interpreter"); strings.Contains(strings.ToUpper(interpreter), "POWER") || strings.ToUpper(interpreter) == "CMD_EXE" {
+				p.config.approximated("interpreter", "%s runs a %s script; the converted step runs it in the default shell", where, interpreter)
+			}
+			step.Env = bambooTaskEnv(getString(s, "environment"))
+			step.WorkDir = p.text(getString(s, "working-dir"))
+		}
+		step.Run = p.text(strings.TrimRight(strings.Join(lines, "\n"), "\n"))
+	case "command":
+		p.config.approximated("command", "%s runs executable '%s', an agent capability; it is now called by name", where, getString(td, "executable"))
+		step.Run = p.text(strings.TrimSpace(getString(td, "executable") + " " + getString(td, "argument")))
+		step.Env = bambooTaskEnv(getString(td, "environment"))
+		step.WorkDir = p.text(getString(td, "working-dir"))
+	case "maven":
+		step.Run = p.text(strings.TrimSpace("mvn " + getString(td, "goal")))
+		step.Env = bambooTaskEnv(getString(td, "environment"))
+		step.WorkDir = p.text(getString(td, "working-dir"))
+	case "npm":
+		step.Run = p.text(strings.TrimSpace("npm " + getString(td, "command")))
+		step.Env = bambooTaskEnv(getString(td, "environment"))
+		step.WorkDir = p.text(getString(td, "working-dir"))
+	case "artifact-download":
+		var steps []Step
+		dest := getString(td, "destination")
+		if dest == "" {
+			dest = "."
+		}
+		for _, a := range listOf(td["artifacts"]) {
+			am, _ := a.(map[string]interface{})
+			with := map[string]string{"path": p.text(firstNonEmpty(getString(am, "destination"), dest))}
+			if getString(am, "name") != "" {
+				with["name"] = getString(am, "name")
+			}
+			steps = append(steps, Step{Uses: downloadArtifact, With: with, If: condition})
+		}
+		if len(steps) == 0 {
+			p.config.approximated("artifact-download", "%s downloads every artifact; each now lands in a directory named after it", where)
+			steps = append(steps, Step{Uses: downloadArtifact, With: map[string]string{"path": p.text(dest)}, If: condition})
+		}
+		return steps
+	case "test-parser":
+		p.config.dropped("test-parser", "%s parses %s test results from %s; add a test report action", where, getString(td, "type"), strings.Join(flattenScript(listOf(td["test-results"])), ", "))
+		return nil
+	default:
+		p.config.dropped(kind, "%s: %s task is not converted", where, kind)
+		step.Run = fmt.Sprintf(`echo "Task %s (manual conversion needed)" && exit 1`, kind)
+	}
+	return []Step{step}
+}
+
+// bambooTaskEnv reads a task's environment: KEY=value pairs separated by
+// spaces
+func bambooTaskEnv(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	env := make(map[string]string)
+	for _, pair := range strings.Fields(s) {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			env[k] = strings.Trim(v, `"'`)
+		}
+	}
+	return env
+}
+
+// env turns variables into bamboo_ prefixed environment variables, the
+// names scripts read them by; encrypted and password-like values become
+// secrets
+func (p *bambooParser) env(v interface{}) map[string]string {
+	vars := stringValues(v)
+	if vars == nil {
+		return nil
+	}
+	env := make(map[string]string)
+	for name, value := range vars {
+		key := "bamboo_" + strings.ReplaceAll(name, ".", "_")
+		if strings.HasPrefix(value, "BAMSCRT@") || bambooSecret.MatchString(name) {
+			env[key] = fmt.Sprintf("${{ secrets.%s }}", nonVarChars.ReplaceAllString(strings.ToUpper(name), "_"))
+			continue
+		}
+		p.variables[name] = value
+		env[key] = p.value(value)
+	}
+	return env
+}
+
+// value inlines the plan variables a value references, for settings such
+// as images that no shell expands
+func (p *bambooParser) value(s string) string {
+	return bambooReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if v, ok := p.variables[bambooReference.FindStringSubmatch(ref)[1]]; ok {
+			return v
+		}
+		return p.text(ref)
+	})
+}
+
+// text rewrites ${bamboo.name} references to the variables Bamboo exports
+// to scripts
+func (p *bambooParser) text(s string) string {
+	return bambooReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := bambooReference.FindStringSubmatch(ref)[1]
+		return "${bamboo_" + strings.ReplaceAll(name, ".", "_") + "}"
+	})
+}
+
+// triggers converts plan triggers; repository triggers become push
+func (p *bambooParser) triggers(v interface{}) []Trigger {
+	var triggers []Trigger
+	push := false
+	for _, t := range listOf(v) {
+		kind, value := fmt.Sprint(t), interface{}(nil)
+		if tm, ok := t.(map[string]interface{}); ok {
+			for k, val := range tm {
+				kind, value = k, val
+			}
+		}
+		switch kind {
+		case "polling", "remote", "bitbucket-server-trigger", "stash-trigger":
+			if !push {
+				triggers = append(triggers, Trigger{Type: "push"})
+				push = true
+			}
+		case "cron":
+			expr := fmt.Sprint(value)
+			if m, ok := value.(map[string]interface{}); ok {
+				expr = getString(m, "expression")
+			}
+			cron, ok := quartzCron(expr)
+			if !ok {
+				p.config.dropped("cron", "plan: cron trigger '%s' is not converted", expr)
+				continue
+			}
+			p.config.approximated("cron", "plan runs on schedule '%s' in UTC; check it against the Bamboo server's time zone", cron)
+			triggers = append(triggers, Trigger{Type: "schedule", Cron: cron})
+		default:
+			p.config.dropped(kind, "plan: '%s' trigger is not converted", kind)
+		}
+	}
+	return triggers
+}
+
+// quartzCron converts a Quartz expression (seconds first, ? for any day,
+// an optional year) to a five-field cron
+func quartzCron(expr string) (string, bool) {
+	fields := strings.Fields(expr)
+	if len(fields) != 6 && len(fields) != 7 {
+		return "", false
+	}
+	fields = fields[1:6]
+	for i, f := range fields {
+		if f == "?" {
+			fields[i] = "*"
+		}
+	}
+	return strings.Join(fields, " "), true
+}
@@ -0,0 +1,367 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"cicli/internal/progress"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Mapping records one input file and the output it was converted to
+type Mapping struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	Status string `json:"status"` // converted, failed
+	Error  string `json:"error,omitempty"`
+
+	// Findings lists what the conversion dropped, approximated or left for review
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Manifest is written after a batch conversion
+type Manifest struct {
+	From     Platform  `json:"from"`
+	To       Platform  `json:"to"`
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Discover finds every CI file for a platform below root, including GitLab
+// child pipelines referenced through include and trigger:include
+func Discover(root string, platform Platform) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if seen[path] {
+			return
+		}
+		if _, err := os.Stat(path); err == nil {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	switch platform {
+	case GitHub:
+		for _, pattern := range []string{"*.yml", "*.yaml"} {
+			matches, _ := filepath.Glob(filepath.Join(root, ".github", "workflows", pattern))
+			for _, m := range matches {
+				add(m)
+			}
+		}
+	case GitLab:
+		queue := []string{filepath.Join(root, ".gitlab-ci.yml")}
+		for len(queue) > 0 {
+			path := queue[0]
+			queue = queue[1:]
+			if seen[filepath.Clean(path)] {
+				continue
+			}
+			add(path)
+			if !seen[filepath.Clean(path)] {
+				continue
+			}
+			for _, inc := range gitlabLocalIncludes(path) {
+				queue = append(queue, filepath.Join(root, strings.TrimPrefix(inc, "/")))
+			}
+		}
+		// Pick up stand-alone child pipeline files that are not referenced directly
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() && (info.Name() == ".git" || info.Name() == "node_modules" || info.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && strings.HasSuffix(info.Name(), ".gitlab-ci.yml") {
+				add(path)
+			}
+			return nil
+		})
+	case CircleCI:
+		add(filepath.Join(root, ".circleci", "config.yml"))
+	case Jenkins:
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() && (info.Name() == ".git" || info.Name() == "node_modules" || info.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && strings.HasPrefix(info.Name(), "Jenkinsfile") {
+				add(path)
+			}
+			return nil
+		})
+	case Azure:
+		matches, _ := filepath.Glob(filepath.Join(root, "azure-pipelines*.yml"))
+		for _, m := range matches {
+			add(m)
+		}
+	case Bitbucket:
+		add(filepath.Join(root, "bitbucket-pipelines.yml"))
+	case Drone:
+		add(filepath.Join(root, ".drone.yml"))
+		add(filepath.Join(root, ".drone.yaml"))
+	case Woodpecker:
+		add(filepath.Join(root, ".woodpecker.yml"))
+		add(filepath.Join(root, ".woodpecker.yaml"))
+		for _, pattern := range []string{"*.yml", "*.yaml"} {
+			matches, _ := filepath.Glob(filepath.Join(root, ".woodpecker", pattern))
+			for _, m := range matches {
+				add(m)
+			}
+		}
+	case Buildkite:
+		add(filepath.Join(root, "buildkite.yml"))
+		add(filepath.Join(root, "buildkite.yaml"))
+		for _, pattern := range []string{"*.yml", "*.yaml"} {
+			matches, _ := filepath.Glob(filepath.Join(root, ".buildkite", pattern))
+			for _, m := range matches {
+				add(m)
+			}
+		}
+	case TeamCity:
+		// A Kotlin DSL project, or one XML project per directory
+		add(filepath.Join(root, ".teamcity", "settings.kts"))
+		if len(files) == 0 {
+			filepath.Walk(filepath.Join(root, ".teamcity"), func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() && info.Name() == "project-config.xml" {
+					add(path)
+				}
+				return nil
+			})
+		}
+	case Bamboo:
+		add(filepath.Join(root, "bamboo-specs", "bamboo.yml"))
+		add(filepath.Join(root, "bamboo-specs", "bamboo.yaml"))
+	case Travis:
+		add(filepath.Join(root, ".travis.yml"))
+		add(filepath.Join(root, ".travis.yaml"))
+	default:
+		if err := discoverWithDriver(root, platform, add); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// DiscoverDir finds the CI files for a platform in dir. dir may be a
+// repository root or a directory holding the CI files themselves, such as
+// .github/workflows
+func DiscoverDir(dir string, platform Platform) ([]string, error) {
+	files, err := Discover(dir, platform)
+	if err != nil || len(files) > 0 {
+		return files, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(name)
+		if ext == ".yml" || ext == ".yaml" || (platform == Jenkins && strings.HasPrefix(name, "Jenkinsfile")) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// gitlabLocalIncludes returns the local files a GitLab config includes or
+// triggers as child pipelines
+func gitlabLocalIncludes(path string) []string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil
+	}
+
+	var includes []string
+	includes = append(includes, localIncludePaths(raw["include"])...)
+	for _, v := range raw {
+		job, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if trigger, ok := job["trigger"].(map[string]interface{}); ok {
+			includes = append(includes, localIncludePaths(trigger["include"])...)
+		}
+	}
+	return includes
+}
+
+func localIncludePaths(v interface{}) []string {
+	switch inc := v.(type) {
+	case string:
+		if !strings.HasPrefix(inc, "http") {
+			return []string{inc}
+		}
+	case map[string]interface{}:
+		if local := getString(inc, "local"); local != "" {
+			return []string{local}
+		}
+	case []interface{}:
+		var paths []string
+		for _, item := range inc {
+			paths = append(paths, localIncludePaths(item)...)
+		}
+		return paths
+	}
+	return nil
+}
+
+// OutputPaths assigns each input a unique output file for the target platform
+func OutputPaths(to Platform, inputs []string) map[string]string {
+	outputs := make(map[string]string)
+	used := make(map[string]bool)
+	for _, input := range inputs {
+		name := pipelineName(input)
+		path := outputPathFor(to, name)
+		for i := 2; used[path]; i++ {
+			path = outputPathFor(to, fmt.Sprintf("%s-%d", name, i))
+		}
+		used[path] = true
+		outputs[input] = path
+	}
+	return outputs
+}
+
+// pipelineName derives a short name from a CI file path, e.g.
+// ci/deploy.gitlab-ci.yml -> deploy, .gitlab-ci.yml -> ci
+func pipelineName(input string) string {
+	base := filepath.Base(input)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	if base == "project-config" {
+		// TeamCity XML projects are named by their directory
+		base = filepath.Base(filepath.Dir(input))
+	}
+	base = strings.TrimSuffix(base, ".gitlab-ci")
+	base = strings.TrimPrefix(base, "Jenkinsfile")
+	base = strings.TrimPrefix(base, "azure-pipelines")
+	base = strings.TrimPrefix(base, "pipeline.")
+	base = strings.Trim(base, ".-_")
+
+	switch base {
+	case "", ".gitlab-ci", "gitlab-ci", "config", "bitbucket-pipelines", "drone", "woodpecker", "pipeline", "buildkite", "settings", "bamboo", "travis":
+		return "ci"
+	}
+	return sanitizeName(base)
+}
+
+func outputPathFor(to Platform, name string) string {
+	switch to {
+	case GitHub:
+		return filepath.Join(".github", "workflows", name+".yml")
+	case GitLab:
+		if name == "ci" {
+			return ".gitlab-ci.yml"
+		}
+		return filepath.Join(".gitlab", "ci", name+".gitlab-ci.yml")
+	case CircleCI:
+		if name == "ci" {
+			return filepath.Join(".circleci", "config.yml")
+		}
+		return filepath.Join(".circleci", name+".yml")
+	case Jenkins:
+		if name == "ci" {
+			return "Jenkinsfile"
+		}
+		return "Jenkinsfile." + name
+	case Azure:
+		if name == "ci" {
+			return "azure-pipelines.yml"
+		}
+		return "azure-pipelines-" + name + ".yml"
+	case Bitbucket:
+		if name == "ci" {
+			return "bitbucket-pipelines.yml"
+		}
+		return "bitbucket-pipelines-" + name + ".yml"
+	case Drone:
+		if name == "ci" {
+			return ".drone.yml"
+		}
+		return ".drone-" + name + ".yml"
+	case Woodpecker:
+		return filepath.Join(".woodpecker", name+".yml")
+	case Buildkite:
+		if name == "ci" {
+			return filepath.Join(".buildkite", "pipeline.yml")
+		}
+		return filepath.Join(".buildkite", "pipeline."+name+".yml")
+	case Harness:
+		return filepath.Join(".harness", name+".yaml")
+	case Codefresh:
+		if name == "ci" {
+			return "codefresh.yml"
+		}
+		return "codefresh-" + name + ".yml"
+	case Tekton:
+		return filepath.Join(".tekton", name+".yaml")
+	default:
+		return name + ".yml"
+	}
+}
+
+// ConvertAll converts every input concurrently and returns one mapping per
+// input in the original order
+func (c *Converter) ConvertAll(from, to Platform, inputs []string, outputs map[string]string) []Mapping {
+	mappings := make([]Mapping, len(inputs))
+	bar := progress.NewBar("Converting", len(inputs))
+
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			m := Mapping{Input: input, Output: outputs[input], Status: "converted"}
+			findings, err := c.convertFile(from, to, input, m.Output)
+			if err != nil {
+				m.Status = "failed"
+				m.Error = err.Error()
+			}
+			m.Findings = findings
+			mappings[i] = m
+			bar.Increment(input)
+		}(i, input)
+	}
+	wg.Wait()
+	bar.Finish()
+
+	return mappings
+}
+
+// WriteManifest stores the input→output mapping of a batch conversion
+func WriteManifest(path string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
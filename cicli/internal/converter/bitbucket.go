@@ -0,0 +1,937 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// bitbucketDefaultImage is the image Bitbucket runs steps in when none is set
+const bitbucketDefaultImage = "atlassian/default-image:4"
+
+// bitbucketCaches maps the predefined Bitbucket caches to the directory each holds
+var bitbucketCaches = map[string]string{
+	"node":       "node_modules",
+	"pip":        "~/.cache/pip",
+	"maven":      "~/.m2/repository",
+	"gradle":     "~/.gradle/caches",
+	"composer":   "~/.composer/cache",
+	"dotnetcore": "~/.nuget/packages",
+	"sbt":        "~/.sbt",
+	"ivy2":       "~/.ivy2/cache",
+}
+
+// bitbucketEnvironments are the deployment environments every repository has
+var bitbucketEnvironments = map[string]bool{"test": true, "staging": true, "production": true}
+
+// servicePorts are the default ports of common service images. Bitbucket
+// services listen on localhost, so they are published on the same port.
+var servicePorts = map[string]string{
+	"postgres": "5432", "mysql": "3306", "mariadb": "3306", "redis": "6379",
+	"mongo": "27017", "rabbitmq": "5672", "memcached": "11211", "elasticsearch": "9200",
+}
+
+var (
+	nonNameChars         = regexp.MustCompile(`[^a-z0-9-]+`)
+	dockerCommandPattern = regexp.MustCompile(`(^|[;&|(\s])docker\s`)
+)
+
+// bitbucketSection is one pipeline of a bitbucket-pipelines.yml, e.g.
+// default or branches.main, and the condition a GitHub job needs to run only
+// when Bitbucket would start that pipeline
+type bitbucketSection struct {
+	label     string
+	prefix    string
+	condition string
+	items     []interface{}
+}
+
+// parseBitbucket parses Bitbucket Pipelines config. Every step becomes a job
+// that needs the step before it; steps of a parallel block share their
+// dependencies. Pipelines with the same steps become one set of jobs; when
+// pipelines differ, each gets its own jobs with a condition on when it runs.
+func (c *Converter) parseBitbucket(content []byte) (*PipelineConfig, error) {
+	var bb map[string]interface{}
+	if err := yaml.Unmarshal(content, &bb); err != nil {
+		return nil, err
+	}
+	pipelines, ok := bb["pipelines"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no pipelines: section found")
+	}
+
+	config := &PipelineConfig{Name: "Pipeline", Jobs: []Job{}, Comment: parseComments(content).header()}
+	config.dropKeys("config", bb, keySet("image", "definitions", "pipelines"))
+	defs, _ := bb["definitions"].(map[string]interface{})
+	p := &bitbucketParser{
+		config:   config,
+		image:    parseContainer(bb["image"]),
+		caches:   bitbucketCacheDefs(defs),
+		services: bitbucketServiceDefs(defs),
+		names:    make(map[string]bool),
+	}
+
+	sections := bitbucketSections(config, pipelines)
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no pipelines: section found")
+	}
+
+	// Pipelines with identical steps share one set of jobs
+	var groups [][]bitbucketSection
+	for _, s := range sections {
+		merged := false
+		for i, g := range groups {
+			if reflect.DeepEqual(g[0].items, s.items) {
+				groups[i] = append(groups[i], s)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			groups = append(groups, []bitbucketSection{s})
+		}
+	}
+
+	for i, g := range groups {
+		prefix, condition := "", ""
+		if len(groups) > 1 {
+			if i > 0 {
+				prefix = g[0].prefix
+			}
+			var conds []string
+			for _, s := range g {
+				conds = append(conds, s.condition)
+			}
+			condition = orConditions(conds)
+		}
+		p.parseItems(g[0].label, g[0].items, prefix, condition, nil)
+	}
+
+	return config, nil
+}
+
+// bitbucketSections lists the pipelines in the order Bitbucket matches them
+// and adds the triggers that start them
+func bitbucketSections(config *PipelineConfig, pipelines map[string]interface{}) []bitbucketSection {
+	var sections []bitbucketSection
+	keys := func(v interface{}) []string {
+		m, _ := v.(map[string]interface{})
+		var out []string
+		for k := range m {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+		return out
+	}
+	items := func(v interface{}, key string) []interface{} {
+		m, _ := v.(map[string]interface{})
+		list, _ := m[key].([]interface{})
+		return list
+	}
+
+	_, hasDefault := pipelines["default"]
+	branches := keys(pipelines["branches"])
+	var branchConds []string
+	for _, b := range branches {
+		cond := globCondition(config, "github.ref_name", b)
+		if cond == "" {
+			cond = "github.event_name == 'push'"
+		}
+		branchConds = append(branchConds, cond)
+	}
+
+	if list, ok := pipelines["default"].([]interface{}); ok {
+		// default only runs for branches no branch pipeline matches
+		cond := "github.event_name == 'push'"
+		for _, bc := range branchConds {
+			if bc != "github.event_name == 'push'" {
+				cond += " && " + negateCondition(bc)
+			}
+		}
+		sections = append(sections, bitbucketSection{label: "default", condition: cond, items: list})
+		config.Triggers = append(config.Triggers, Trigger{Type: "push"})
+	}
+
+	for i, b := range branches {
+		sections = append(sections, bitbucketSection{label: "branches." + b, prefix: b, condition: branchConds[i], items: items(pipelines["branches"], b)})
+	}
+	if len(branches) > 0 && !hasDefault {
+		config.Triggers = append(config.Triggers, Trigger{Type: "push", Branches: branches})
+	}
+
+	prs := keys(pipelines["pull-requests"])
+	for _, b := range prs {
+		cond := "github.event_name == 'pull_request'"
+		if glob := globCondition(config, "github.head_ref", b); glob != "" {
+			cond += " && " + glob
+		}
+		sections = append(sections, bitbucketSection{label: "pull-requests." + b, prefix: "pr-" + b, condition: cond, items: items(pipelines["pull-requests"], b)})
+	}
+	if len(prs) > 0 {
+		config.Triggers = append(config.Triggers, Trigger{Type: "pull_request"})
+	}
+
+	tags := keys(pipelines["tags"])
+	for _, t := range tags {
+		cond := "startsWith(github.ref, 'refs/tags/')"
+		if glob := globCondition(config, "github.ref_name", t); glob != "" {
+			cond += " && " + glob
+		}
+		sections = append(sections, bitbucketSection{label: "tags." + t, prefix: "tag-" + t, condition: cond, items: items(pipelines["tags"], t)})
+	}
+	if len(tags) > 0 && !hasDefault {
+		config.approximated("tags", "tag pipelines need a tags: filter on the push trigger to run")
+	}
+
+	custom := keys(pipelines["custom"])
+	for _, name := range custom {
+		sections = append(sections, bitbucketSection{label: "custom." + name, prefix: name, condition: "github.event_name == 'workflow_dispatch'", items: items(pipelines["custom"], name)})
+	}
+	if len(custom) > 0 {
+		config.Triggers = append(config.Triggers, Trigger{Type: "manual"})
+		if len(custom) > 1 {
+			config.approximated("custom", "custom pipelines %s all run on a manual trigger; add an input to pick one", strings.Join(custom, ", "))
+		}
+	}
+
+	return sections
+}
+
+// globCondition turns a Bitbucket branch or tag glob into an expression on
+// ref, or "" when the glob matches everything
+func globCondition(config *PipelineConfig, ref, glob string) string {
+	if glob == "**" || glob == "*" {
+		return ""
+	}
+	i := strings.IndexAny(glob, "*?[{")
+	if i < 0 {
+		return fmt.Sprintf("%s == '%s'", ref, glob)
+	}
+	if i < len(glob)-2 || (i == len(glob)-2 && glob[i:] != "**") {
+		config.approximated("branches", "pattern '%s' is approximated by the prefix '%s'", glob, glob[:i])
+	}
+	return fmt.Sprintf("startsWith(%s, '%s')", ref, glob[:i])
+}
+
+func negateCondition(cond string) string {
+	if strings.Contains(cond, " == ") {
+		return strings.Replace(cond, " == ", " != ", 1)
+	}
+	return "!" + cond
+}
+
+// orConditions joins conditions, wrapping each so && binds inside it
+func orConditions(conds []string) string {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	var parts []string
+	for _, c := range conds {
+		parts = append(parts, "("+c+")")
+	}
+	return strings.Join(parts, " || ")
+}
+
+type bitbucketParser struct {
+	config   *PipelineConfig
+	image    *Container
+	caches   map[string]Cache
+	services map[string]Service
+	names    map[string]bool
+}
+
+// bitbucketCacheDefs reads definitions.caches, given as a path or as
+// {key: {files}, path}
+func bitbucketCacheDefs(defs map[string]interface{}) map[string]Cache {
+	caches := make(map[string]Cache)
+	cd, _ := defs["caches"].(map[string]interface{})
+	for name, v := range cd {
+		switch c := v.(type) {
+		case string:
+			caches[name] = Cache{Key: name, Paths: []string{c}}
+		case map[string]interface{}:
+			cache := Cache{Key: name, Paths: []string{getString(c, "path")}}
+			if key, ok := c["key"].(map[string]interface{}); ok {
+				cache.Files = flattenScript(listOf(key["files"]))
+			}
+			caches[name] = cache
+		}
+	}
+	return caches
+}
+
+func bitbucketServiceDefs(defs map[string]interface{}) map[string]Service {
+	services := make(map[string]Service)
+	sd, _ := defs["services"].(map[string]interface{})
+	for name, v := range sd {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		svc := Service{Name: name}
+		if c := parseContainer(m["image"]); c != nil {
+			svc.Image = c.Image
+		}
+		if vars, ok := m["variables"].(map[string]interface{}); ok {
+			svc.Env = make(map[string]string)
+			for k, val := range vars {
+				svc.Env[k] = fmt.Sprint(val)
+			}
+		}
+		base := svc.Image
+		if i := strings.LastIndex(base, "/"); i >= 0 {
+			base = base[i+1:]
+		}
+		base = strings.SplitN(base, ":", 2)[0]
+		if port, ok := servicePorts[base]; ok {
+			svc.Ports = []string{port + ":" + port}
+		}
+		services[name] = svc
+	}
+	return services
+}
+
+// parseItems converts a list of step, parallel and stage entries. after
+// holds the jobs the first entry waits for; the last entry's jobs are returned.
+func (p *bitbucketParser) parseItems(section string, items []interface{}, prefix, condition string, after []string) []string {
+	for _, item := range items {
+		im, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch {
+		case im["step"] != nil:
+			sd, _ := im["step"].(map[string]interface{})
+			after = []string{p.parseStep(sd, prefix, condition, after, nil)}
+		case im["parallel"] != nil:
+			var steps []interface{}
+			switch pv := im["parallel"].(type) {
+			case []interface{}:
+				steps = pv
+			case map[string]interface{}:
+				steps, _ = pv["steps"].([]interface{})
+			}
+			var names []string
+			for _, s := range steps {
+				if sm, ok := s.(map[string]interface{}); ok {
+					sd, _ := sm["step"].(map[string]interface{})
+					names = append(names, p.parseStep(sd, prefix, condition, after, nil))
+				}
+			}
+			if len(names) > 0 {
+				after = names
+			}
+		case im["stage"] != nil:
+			stage, _ := im["stage"].(map[string]interface{})
+			steps, _ := stage["steps"].([]interface{})
+			for i, s := range steps {
+				sm, ok := s.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				sd, _ := sm["step"].(map[string]interface{})
+				// The stage's deployment covers every step; only the first waits for a trigger
+				inherit := map[string]interface{}{"deployment": stage["deployment"]}
+				if i == 0 {
+					inherit["trigger"] = stage["trigger"]
+				}
+				after = []string{p.parseStep(sd, prefix, condition, after, inherit)}
+			}
+		case im["variables"] != nil:
+			p.config.dropped("variables", "pipeline '%s' takes variables; add them as workflow_dispatch inputs", section)
+		}
+	}
+	return after
+}
+
+// bitbucketStepKeys are the step keys parseStep converts
+var bitbucketStepKeys = keySet("name", "image", "runs-on", "deployment", "trigger", "condition", "caches", "services", "script", "after-script", "artifacts")
+
+// parseStep converts one step to a job and returns the job's name
+func (p *bitbucketParser) parseStep(sd map[string]interface{}, prefix, condition string, after []string, inherit map[string]interface{}) string {
+	// Copy, since YAML anchors share one map between pipelines
+	step := make(map[string]interface{}, len(sd))
+	for k, v := range sd {
+		step[k] = v
+	}
+	for k, v := range inherit {
+		if v != nil && step[k] == nil {
+			step[k] = v
+		}
+	}
+	sd = step
+
+	name := sanitizeName(getString(sd, "name"))
+	if name == "" {
+		name = fmt.Sprintf("step-%d", len(p.config.Jobs)+1)
+	}
+	if prefix != "" {
+		name = strings.Trim(nonNameChars.ReplaceAllString(sanitizeName(prefix), "-"), "-") + "-" + name
+	}
+	base := name
+	for i := 2; p.names[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	p.names[name] = true
+
+	job := Job{
+		Name:      name,
+		RunsOn:    "ubuntu-latest",
+		DependsOn: append([]string{}, after...),
+		Container: parseContainer(sd["image"]),
+		Condition: condition,
+		Steps:     []Step{},
+	}
+	if job.Container == nil {
+		job.Container = p.image
+	}
+	p.config.dropKeys(fmt.Sprintf("step '%s'", name), sd, bitbucketStepKeys)
+	if sd["runs-on"] != nil {
+		job.RunsOn = "self-hosted"
+		p.config.note("step '%s' runs on a self-hosted runner; pick matching runner labels", name)
+	}
+
+	env := environmentName(sd["deployment"])
+	if getString(sd, "trigger") == "manual" || env != "" {
+		job.Gate = &Gate{Environment: env, Manual: getString(sd, "trigger") == "manual"}
+	}
+
+	if cond, ok := sd["condition"].(map[string]interface{}); ok {
+		if cs, ok := cond["changesets"].(map[string]interface{}); ok {
+			paths := flattenScript(listOf(cs["includePaths"]))
+			p.config.dropped("changesets", "step '%s' only runs when %s change; add a paths filter or a changed-files check", name, strings.Join(paths, ", "))
+		}
+	}
+
+	for _, c := range flattenScript(listOf(sd["caches"])) {
+		switch {
+		case c == "docker":
+			p.config.dropped("caches", "step '%s' caches Docker layers; use your target's Docker layer cache instead", name)
+		case len(p.caches[c].Paths) > 0:
+			job.Cache = append(job.Cache, p.caches[c])
+		case bitbucketCaches[c] != "":
+			job.Cache = append(job.Cache, Cache{Key: c, Paths: []string{bitbucketCaches[c]}})
+		default:
+			p.config.dropped("caches", "step '%s' uses undefined cache '%s'", name, c)
+		}
+	}
+
+	for _, s := range flattenScript(listOf(sd["services"])) {
+		if s == "docker" {
+			// The Docker daemon is available on hosted runners
+			continue
+		}
+		svc, ok := p.services[s]
+		if !ok || svc.Image == "" {
+			p.config.dropped("services", "step '%s' uses service '%s', which has no image in definitions.services", name, s)
+			continue
+		}
+		job.Services = append(job.Services, svc)
+	}
+
+	job.Steps = append(job.Steps, p.parseScript(name, listOf(sd["script"]), "")...)
+	job.Steps = append(job.Steps, p.parseScript(name, listOf(sd["after-script"]), "always()")...)
+
+	var paths []string
+	switch a := sd["artifacts"].(type) {
+	case []interface{}:
+		paths = flattenScript(a)
+	case map[string]interface{}:
+		paths = flattenScript(listOf(a["paths"]))
+	}
+	for i, path := range paths {
+		artifact := name
+		if i > 0 {
+			artifact = fmt.Sprintf("%s-%d", name, i+1)
+		}
+		job.Steps = append(job.Steps, Step{Uses: "actions/upload-artifact@v4", With: map[string]string{"name": artifact, "path": path}})
+	}
+	if len(paths) > 0 {
+		p.config.note("Bitbucket hands artifacts to every later step; jobs that read step '%s' artifacts may need a download step", name)
+	}
+
+	p.config.Jobs = append(p.config.Jobs, job)
+	return name
+}
+
+// parseScript converts script lines; pipes have no equivalent and become
+// failing steps that name them
+func (p *bitbucketParser) parseScript(job string, script []interface{}, cond string) []Step {
+	var steps []Step
+	for _, s := range script {
+		if pm, ok := s.(map[string]interface{}); ok {
+			pipe := getString(pm, "pipe")
+			if pipe == "" {
+				continue
+			}
+			var vars []string
+			if vm, ok := pm["variables"].(map[string]interface{}); ok {
+				for k := range vm {
+					vars = append(vars, k)
+				}
+			}
+			sort.Strings(vars)
+			steps = append(steps, Step{Name: pipe, Run: fmt.Sprintf("echo \"Pipe %s (manual conversion needed): %s\" && exit 1", pipe, strings.Join(vars, ", ")), If: cond})
+			p.config.dropped("pipe", "step '%s' uses pipe %s; replace it with an equivalent action or command", job, pipe)
+			continue
+		}
+		for _, line := range flattenScript([]interface{}{s}) {
+			steps = append(steps, Step{Run: strings.TrimRight(line, "\n"), If: cond})
+		}
+	}
+	return steps
+}
+
+// listOf returns v as a list; a single value becomes a list of one
+func listOf(v interface{}) []interface{} {
+	switch l := v.(type) {
+	case []interface{}:
+		return l
+	case nil:
+		return nil
+	default:
+		return []interface{}{l}
+	}
+}
+
+// bitbucketConfig is a bitbucket-pipelines.yml file
+type bitbucketConfig struct {
+	Image       string                `yaml:"image"`
+	Definitions *bitbucketDefinitions `yaml:"definitions,omitempty"`
+	Pipelines   yamlMap               `yaml:"pipelines"`
+}
+
+type bitbucketDefinitions struct {
+	Caches   yamlMap `yaml:"caches,omitempty"`
+	Services yamlMap `yaml:"services,omitempty"`
+}
+
+type bitbucketCache struct {
+	Key struct {
+		Files []string `yaml:"files"`
+	} `yaml:"key"`
+	Path string `yaml:"path"`
+}
+
+type bitbucketService struct {
+	Image     string            `yaml:"image"`
+	Variables map[string]string `yaml:"variables,omitempty"`
+}
+
+type bitbucketStep struct {
+	carried
+	Name        string    `yaml:"name"`
+	Image       string    `yaml:"image,omitempty"`
+	Deployment  string    `yaml:"deployment,omitempty"`
+	Trigger     string    `yaml:"trigger,omitempty"`
+	Caches      []string  `yaml:"caches,omitempty"`
+	Services    []string  `yaml:"services,omitempty"`
+	Script      *yamlList `yaml:"script"`
+	AfterScript *yamlList `yaml:"after-script,omitempty"`
+	Artifacts   []string  `yaml:"artifacts,omitempty"`
+}
+
+// generateBitbucket generates Bitbucket Pipelines config. Jobs run in
+// dependency levels: each level is a step, or a parallel block when several
+// jobs are ready at once. Jobs with a branch, pull request or manual
+// condition go to the matching pipeline.
+func (c *Converter) generateBitbucket(config *PipelineConfig) (string, error) {
+	// A shared image goes at the top; otherwise each step names its own
+	image := bitbucketDefaultImage
+	shared := len(config.Jobs) > 0
+	for _, job := range config.Jobs {
+		if job.Container == nil || job.Container.Image != config.Jobs[0].Container.Image {
+			shared = false
+			break
+		}
+	}
+	if shared {
+		image = config.Jobs[0].Container.Image
+	}
+	bb := bitbucketConfig{Image: image}
+
+	caches := make(map[string]Cache)
+	services := make(map[string]Service)
+	for _, job := range config.Jobs {
+		for _, cache := range job.Cache {
+			if p, ok := bitbucketCaches[cache.Key]; (ok && len(cache.Files) == 0 && len(cache.Paths) == 1 && cache.Paths[0] == p) || len(cache.Paths) == 0 {
+				continue
+			}
+			if len(cache.Paths) > 1 {
+				config.approximated("cache", "cache '%s' has several paths; Bitbucket caches hold one, so only %s is kept", cache.Key, cache.Paths[0])
+			}
+			caches[sanitizeName(cache.Key)] = cache
+		}
+		for _, svc := range job.Services {
+			services[sanitizeName(svc.Name)] = svc
+		}
+	}
+	if len(caches) > 0 || len(services) > 0 {
+		bb.Definitions = &bitbucketDefinitions{}
+		names := make([]string, 0, len(caches))
+		for k := range caches {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			cache := caches[k]
+			if len(cache.Files) == 0 {
+				bb.Definitions.Caches.set(k, cache.Paths[0])
+				continue
+			}
+			bc := bitbucketCache{Path: cache.Paths[0]}
+			bc.Key.Files = cache.Files
+			bb.Definitions.Caches.set(k, bc)
+		}
+		names = make([]string, 0, len(services))
+		for k := range services {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			bb.Definitions.Services.set(k, bitbucketService{Image: services[k].Image, Variables: services[k].Env})
+		}
+	}
+
+	sections := bitbucketTargetSections(config)
+	for _, kind := range []string{"default", "branches", "pull-requests", "tags", "custom"} {
+		var pipelines yamlMap
+		for _, s := range sections {
+			if s.kind != kind {
+				continue
+			}
+			if kind == "default" {
+				bb.Pipelines.set(kind, bitbucketSteps(config, s.jobs, image))
+				continue
+			}
+			pipelines.set(s.key, bitbucketSteps(config, s.jobs, image))
+		}
+		if len(pipelines) > 0 {
+			bb.Pipelines.set(kind, pipelines)
+		}
+	}
+
+	return marshalYAML(config.Comment, bb)
+}
+
+// bitbucketTarget is a pipeline being generated and the jobs it runs
+type bitbucketTarget struct {
+	kind, key string
+	jobs      []Job
+}
+
+var (
+	refNamePattern   = regexp.MustCompile(`^github\.ref_name == '([^']+)'$`)
+	refPrefixPattern = regexp.MustCompile(`^startsWith\(github\.ref_name, '([^']+)'\)$`)
+)
+
+// bitbucketTargetSections assigns jobs to pipelines. Jobs without a
+// condition run in every pipeline the triggers start.
+func bitbucketTargetSections(config *PipelineConfig) []bitbucketTarget {
+	var sections []bitbucketTarget
+	index := make(map[string]int)
+	add := func(kind, key string, job *Job) {
+		id := kind + "." + key
+		i, ok := index[id]
+		if !ok {
+			i = len(sections)
+			index[id] = i
+			sections = append(sections, bitbucketTarget{kind: kind, key: key})
+		}
+		if job != nil {
+			sections[i].jobs = append(sections[i].jobs, *job)
+		}
+	}
+
+	for _, t := range config.Triggers {
+		switch t.Type {
+		case "push":
+			if len(t.Branches) == 0 {
+				add("default", "", nil)
+			}
+			for _, b := range t.Branches {
+				add("branches", b, nil)
+			}
+		case "pull_request":
+			add("pull-requests", "**", nil)
+			if len(t.Branches) > 0 {
+				config.approximated("pull_request", "pull request branches %s filter the target branch; Bitbucket pull-requests pipelines match the source branch", strings.Join(t.Branches, ", "))
+			}
+		case "manual":
+			add("custom", "run", nil)
+		case "schedule":
+			add("custom", "scheduled", nil)
+			config.note("create a schedule for the custom pipeline 'scheduled' in Bitbucket (cron '%s')", t.Cron)
+		}
+	}
+	if len(sections) == 0 {
+		add("default", "", nil)
+	}
+	triggered := len(sections)
+
+	for i := range config.Jobs {
+		job := &config.Jobs[i]
+		if job.Condition == "" {
+			for s := 0; s < triggered; s++ {
+				sections[s].jobs = append(sections[s].jobs, *job)
+			}
+			continue
+		}
+		atoms := []string{job.Condition}
+		if strings.HasPrefix(job.Condition, "(") && strings.HasSuffix(job.Condition, ")") {
+			atoms = strings.Split(job.Condition[1:len(job.Condition)-1], ") || (")
+		}
+		for _, atom := range atoms {
+			switch {
+			case strings.HasPrefix(atom, "github.event_name == 'push'"):
+				add("default", "", job)
+			case refNamePattern.MatchString(atom):
+				add("branches", refNamePattern.FindStringSubmatch(atom)[1], job)
+			case refPrefixPattern.MatchString(atom):
+				add("branches", refPrefixPattern.FindStringSubmatch(atom)[1]+"**", job)
+			case strings.HasPrefix(atom, "github.event_name == 'pull_request'"):
+				add("pull-requests", "**", job)
+			case strings.HasPrefix(atom, "startsWith(github.ref, 'refs/tags/')"):
+				tag, glob := "*", strings.TrimPrefix(atom, "startsWith(github.ref, 'refs/tags/') && ")
+				if m := refNamePattern.FindStringSubmatch(glob); m != nil {
+					tag = m[1]
+				} else if m := refPrefixPattern.FindStringSubmatch(glob); m != nil {
+					tag = m[1] + "*"
+				}
+				add("tags", tag, job)
+			case atom == "github.event_name == 'workflow_dispatch'":
+				add("custom", "run", job)
+			default:
+				config.dropped("if", "job '%s' has condition '%s'; Bitbucket steps cannot be skipped by an expression, so it runs in every pipeline", job.Name, job.Condition)
+				for s := 0; s < triggered; s++ {
+					sections[s].jobs = append(sections[s].jobs, *job)
+				}
+			}
+		}
+	}
+
+	var out []bitbucketTarget
+	for _, s := range sections {
+		if len(s.jobs) > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// bitbucketSteps lays out the jobs of one pipeline in dependency levels
+func bitbucketSteps(config *PipelineConfig, jobs []Job, image string) []yamlMap {
+	in := make(map[string]bool)
+	for _, job := range jobs {
+		in[job.Name] = true
+	}
+	level := make(map[string]int)
+	var levelOf func(name string, seen map[string]bool) int
+	byName := make(map[string]Job)
+	for _, job := range jobs {
+		byName[job.Name] = job
+	}
+	levelOf = func(name string, seen map[string]bool) int {
+		if l, ok := level[name]; ok {
+			return l
+		}
+		if seen[name] {
+			return 0
+		}
+		seen[name] = true
+		l := 0
+		for _, dep := range byName[name].DependsOn {
+			if in[dep] {
+				if d := levelOf(dep, seen) + 1; d > l {
+					l = d
+				}
+			}
+		}
+		level[name] = l
+		return l
+	}
+	var levels [][]Job
+	for _, job := range jobs {
+		l := levelOf(job.Name, make(map[string]bool))
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], job)
+	}
+
+	var items []yamlMap
+	environments := make(map[string]bool)
+	first := true
+	for _, group := range levels {
+		if len(group) == 0 {
+			continue
+		}
+		for _, job := range group {
+			if job.Gate == nil {
+				continue
+			}
+			if job.Gate.Manual && first {
+				config.approximated("manual", "job '%s' is manual, but the first step of a Bitbucket pipeline cannot be; it starts automatically", job.Name)
+			}
+			if env := job.Gate.Environment; env != "" {
+				if environments[env] {
+					config.note("environment '%s' is used by several jobs; Bitbucket allows each deployment environment once per pipeline", env)
+				}
+				environments[env] = true
+			}
+		}
+		if len(group) == 1 {
+			items = append(items, yamlMap{{Key: "step", Value: bitbucketJobStep(config, group[0], image, first)}})
+		} else {
+			var parallel []yamlMap
+			for _, job := range group {
+				parallel = append(parallel, yamlMap{{Key: "step", Value: bitbucketJobStep(config, job, image, first)}})
+			}
+			items = append(items, yamlMap{{Key: "parallel", Value: parallel}})
+		}
+		first = false
+	}
+	return items
+}
+
+func bitbucketJobStep(config *PipelineConfig, job Job, image string, first bool) bitbucketStep {
+	bs := bitbucketStep{carried: carried{job.Comment}, Name: job.Name}
+	if job.Container != nil && job.Container.Image != image {
+		bs.Image = job.Container.Image
+	}
+	if job.Gate != nil {
+		if job.Gate.Environment != "" {
+			bs.Deployment = job.Gate.Environment
+			if !bitbucketEnvironments[job.Gate.Environment] {
+				config.note("job '%s' deploys to '%s'; add that deployment environment in the Bitbucket repository settings", job.Name, job.Gate.Environment)
+			}
+		}
+		if job.Gate.Manual && !first {
+			bs.Trigger = "manual"
+		}
+		if len(job.Gate.Approvers) > 0 {
+			config.note("job '%s' needs approval from %s; restrict who can deploy in the environment's Bitbucket settings", job.Name, strings.Join(job.Gate.Approvers, ", "))
+		}
+	}
+
+	for _, cache := range job.Cache {
+		bs.Caches = append(bs.Caches, sanitizeName(cache.Key))
+	}
+
+	dockerService := false
+	for _, step := range job.Steps {
+		if step.Image != "" || dockerCommandPattern.MatchString(step.Run) {
+			dockerService = true
+		}
+	}
+	for _, svc := range job.Services {
+		bs.Services = append(bs.Services, sanitizeName(svc.Name))
+	}
+	if dockerService {
+		bs.Services = append(bs.Services, "docker")
+	}
+
+	var script, after []string
+	// Bitbucket has no job variables; export them for the whole script
+	env := make(map[string]string)
+	for k, v := range config.Environment {
+		env[k] = v
+	}
+	if job.Container != nil {
+		for k, v := range job.Container.Env {
+			env[k] = v
+		}
+	}
+	for k, v := range job.Environment {
+		env[k] = v
+	}
+	for _, k := range sortedKeys(env) {
+		script = append(script, fmt.Sprintf("export %s=%s", k, yamlScalar(env[k])))
+	}
+
+	// Outputs of earlier jobs arrive as artifacts
+	for _, producer := range outputProducers(config, job) {
+		script = append(script, fmt.Sprintf("set -a && . %s && set +a", jobOutputFile(producer)))
+	}
+	if writesOutputs(job) {
+		script = append(script, "mkdir -p "+outputDir)
+	}
+
+	workspaceDownloads(config, job, "Bitbucket")
+	for _, step := range job.Steps {
+		var command string
+		switch {
+		case step.Image != "":
+			command = dockerRunCommand(step)
+		case step.Run != "":
+			command = convertRunnerVariables(shellOutputs(step.Run, step), Bitbucket)
+		case step.Uses != "":
+			command = convertActionToCommand(step)
+		}
+		command = strings.TrimRight(command, "\n")
+		if command == "" {
+			continue
+		}
+		command = scopedCommand(step, command)
+		switch step.If {
+		case "":
+			script = append(append(script, commentLines(step.Comment)...), command)
+		case "always()":
+			after = append(append(after, commentLines(step.Comment)...), command)
+		default:
+			config.dropped("if", "step in job '%s' has condition '%s'; Bitbucket runs it unconditionally", job.Name, step.If)
+			script = append(append(script, commentLines(step.Comment)...), command)
+		}
+	}
+	script = append(script, jobOutputCommands(job)...)
+	if len(script) == 0 {
+		script = []string{"echo \"Nothing to run\""}
+	}
+
+	bs.Script = bitbucketScript(script)
+	if len(after) > 0 {
+		bs.AfterScript = bitbucketScript(after)
+	}
+
+	bs.Artifacts = artifactPaths(job)
+	if len(job.Outputs) > 0 {
+		bs.Artifacts = append(bs.Artifacts, jobOutputFile(job.Name))
+	}
+	return bs
+}
+
+// bitbucketScript is a list of commands. Single-line commands starting with
+// # become comments, unless the list would be left empty.
+func bitbucketScript(commands []string) *yamlList {
+	comment := func(cmd string) bool {
+		return strings.HasPrefix(cmd, "#") && !strings.Contains(cmd, "\n")
+	}
+	empty := true
+	for _, cmd := range commands {
+		if !comment(cmd) {
+			empty = false
+		}
+	}
+	list := &yamlList{}
+	for _, cmd := range commands {
+		if comment(cmd) && !empty {
+			list.comment(cleanComment(cmd))
+			continue
+		}
+		list.add(cmd)
+	}
+	return list
+}
+
+// yamlScalar quotes a single-line value when YAML would misread it
+func yamlScalar(s string) string {
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		return s
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
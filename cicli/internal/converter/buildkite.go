@@ -0,0 +1,993 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// buildkiteDockerPlugin runs a step's commands in a container
+const buildkiteDockerPlugin = "docker#v5.12.0"
+
+var (
+	buildkiteMatrixRef   = regexp.MustCompile(`\{\{\s*matrix(?:\.([\w-]+))?\s*\}\}`)
+	buildkiteEmoji       = regexp.MustCompile(`:[\w+-]+:`)
+	buildkiteUpload      = regexp.MustCompile(`^buildkite-agent artifact upload\s+(["']?)([^"'\s]+)(["']?)\s*$`)
+	buildkiteDownload    = regexp.MustCompile(`^buildkite-agent artifact download\s+(["']?)([^"'\s]+)(["']?)(?:\s+\S+)?\s*$`)
+	buildkiteBranchRegex = regexp.MustCompile(`build\.branch\s*(=~|!~)\s*/\^((?:[\w-]|\\[./])+)/`)
+	buildkiteUnsupported = regexp.MustCompile(`\b(?:build|pipeline|organization)\.|=~|!~|"`)
+)
+
+// buildkiteConditions rewrite Buildkite conditionals to GitHub expressions
+var buildkiteConditions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`build\.branch\s*==\s*"([^"]*)"`), "github.ref_name == '$1'"},
+	{regexp.MustCompile(`build\.branch\s*!=\s*"([^"]*)"`), "github.ref_name != '$1'"},
+	{regexp.MustCompile(`build\.tag\s*!=\s*null`), "startsWith(github.ref, 'refs/tags/')"},
+	{regexp.MustCompile(`build\.tag\s*==\s*null`), "!startsWith(github.ref, 'refs/tags/')"},
+	{regexp.MustCompile(`build\.tag\s*==\s*"([^"]*)"`), "github.ref == 'refs/tags/$1'"},
+	{regexp.MustCompile(`build\.pull_request\.id\s*!=\s*null`), "github.event_name == 'pull_request'"},
+	{regexp.MustCompile(`build\.pull_request\.id\s*==\s*null`), "github.event_name != 'pull_request'"},
+	{regexp.MustCompile(`build\.pull_request\.base_branch\s*==\s*"([^"]*)"`), "github.base_ref == '$1'"},
+	{regexp.MustCompile(`build\.source\s*==\s*"schedule"`), "github.event_name == 'schedule'"},
+	{regexp.MustCompile(`build\.source\s*==\s*"(?:ui|api)"`), "github.event_name == 'workflow_dispatch'"},
+}
+
+// githubBuildkiteConditions rewrite GitHub expressions to Buildkite
+// conditionals; refPrefixCondition handles branch prefixes
+var githubBuildkiteConditions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`github\.(?:ref_name|head_ref) == '([^']*)'`), `build.branch == "$1"`},
+	{regexp.MustCompile(`github\.(?:ref_name|head_ref) != '([^']*)'`), `build.branch != "$1"`},
+	{regexp.MustCompile(`github\.ref == 'refs/heads/([^']*)'`), `build.branch == "$1"`},
+	{regexp.MustCompile(`github\.ref == 'refs/tags/([^']*)'`), `build.tag == "$1"`},
+	{regexp.MustCompile(`!startsWith\(github\.ref, 'refs/tags/'\)`), "build.tag == null"},
+	{regexp.MustCompile(`startsWith\(github\.ref, 'refs/tags/'\)`), "build.tag != null"},
+	{regexp.MustCompile(`github\.event_name == 'pull_request'`), "build.pull_request.id != null"},
+	{regexp.MustCompile(`github\.event_name != 'pull_request'`), "build.pull_request.id == null"},
+	{regexp.MustCompile(`github\.event_name == 'push'`), "build.pull_request.id == null"},
+	{regexp.MustCompile(`github\.event_name == 'schedule'`), `build.source == "schedule"`},
+	{regexp.MustCompile(`github\.event_name == 'workflow_dispatch'`), `build.source == "ui"`},
+	{regexp.MustCompile(`github\.base_ref == '([^']*)'`), `build.pull_request.base_branch == "$1"`},
+}
+
+var githubUnsupported = regexp.MustCompile(`\b(?:github|secrets|vars|env|matrix|needs|inputs|steps)\.|\w+\(`)
+
+// buildkiteStepKeys are the command step keys parseStep converts; name, id
+// and identifier are older spellings of label and key
+var buildkiteStepKeys = keySet("label", "name", "key", "id", "identifier", "command", "commands", "env", "agents", "plugins",
+	"depends_on", "allow_dependency_failure", "if", "branches", "artifact_paths", "matrix", "secrets")
+
+type buildkiteParser struct {
+	config  *PipelineConfig
+	agents  bool
+	names   map[string]bool
+	keys    map[string][]string // step and group keys to the jobs they stand for
+	blocks  map[string]buildkiteBlock
+	uploads map[string]Artifact // artifact paths to the artifact uploading them
+}
+
+// buildkiteBlock is a block or input step: the jobs it waits for and the
+// gate of the jobs waiting for it
+type buildkiteBlock struct {
+	after []string
+	gate  *Gate
+}
+
+// parseBuildkite parses a Buildkite pipeline. Every command step becomes a
+// job. Steps run in parallel until a wait step, so the steps after a wait
+// need every step before it; a block step also makes them manual.
+func (c *Converter) parseBuildkite(content []byte) (*PipelineConfig, error) {
+	bk := rawYAML(content)
+	steps, ok := bk["steps"].([]interface{})
+	if bk == nil || !ok {
+		return nil, fmt.Errorf("no steps: section found")
+	}
+
+	config := &PipelineConfig{Name: "Pipeline", Jobs: []Job{}, Comment: parseComments(content).header()}
+	config.dropKeys("pipeline", bk, keySet("env", "agents", "steps"))
+	config.Environment = stringValues(bk["env"])
+	p := &buildkiteParser{
+		config:  config,
+		agents:  bk["agents"] != nil,
+		names:   make(map[string]bool),
+		keys:    make(map[string][]string),
+		blocks:  make(map[string]buildkiteBlock),
+		uploads: make(map[string]Artifact),
+	}
+	for k, v := range config.Environment {
+		config.Environment[k] = p.text(v)
+	}
+	p.parseSteps(steps, nil, "")
+	if len(config.Jobs) == 0 {
+		return nil, fmt.Errorf("no command steps found")
+	}
+
+	// Buildkite picks the branches and events that start builds in the
+	// pipeline settings rather than in the YAML
+	config.Triggers = []Trigger{{Type: "push"}, {Type: "pull_request"}}
+	config.note("Buildkite sets which branches and pull requests start a build in the pipeline settings; check the converted triggers")
+	return config, nil
+}
+
+// parseSteps converts a steps: list; after is what its first steps wait for.
+// It returns the jobs the list adds.
+func (p *buildkiteParser) parseSteps(steps []interface{}, after []string, condition string) []string {
+	var added, current []string
+	var gate *Gate
+	var gated []string
+	wait := func() {
+		if len(current) > 0 {
+			after, current = current, nil
+			gate = nil
+		}
+	}
+	holdBack := func(where string) {
+		if len(gated) > 1 {
+			p.config.approximated("block", "%s holds back %s; each becomes a manual job of its own", where, strings.Join(gated, ", "))
+		}
+		gated = nil
+	}
+
+	for _, item := range steps {
+		sm, ok := item.(map[string]interface{})
+		if !ok {
+			// - wait, or the older - waiter and - block strings
+			switch s := fmt.Sprint(item); s {
+			case "wait", "waiter":
+				wait()
+			case "block", "input":
+				wait()
+				gate = &Gate{Manual: true}
+			}
+			continue
+		}
+
+		switch {
+		case hasKey(sm, "wait") || hasKey(sm, "waiter"):
+			p.config.dropKeys("wait step", sm, keySet("wait", "waiter", "key", "continue_on_failure", "if", "depends_on", "allow_dependency_failure"))
+			if fmt.Sprint(sm["continue_on_failure"]) == "true" {
+				p.config.approximated("continue_on_failure", "a wait step continues after failures; the steps after it now need the steps before it to succeed")
+			}
+			wait()
+		case hasKey(sm, "block") || hasKey(sm, "input"):
+			label := getString(sm, "block") + getString(sm, "input")
+			where := fmt.Sprintf("block step '%s'", label)
+			p.config.dropKeys(where, sm, keySet("block", "input", "key", "prompt", "fields", "allowed_teams", "branches", "if", "depends_on", "blocked_state", "allow_dependency_failure"))
+			if sm["fields"] != nil {
+				p.config.dropped("fields", "%s asks for input; add it as a workflow_dispatch input", where)
+			}
+			if sm["branches"] != nil || sm["if"] != nil {
+				p.config.approximated("block", "%s only blocks some builds; the steps after it are manual in every build", where)
+			}
+			holdBack(where)
+			wait()
+			gate = &Gate{Manual: true}
+			for _, team := range flattenScript(listOf(sm["allowed_teams"])) {
+				gate.Approvers = append(gate.Approvers, team)
+			}
+			if key := stepKey(sm); key != "" {
+				p.blocks[key] = buildkiteBlock{after: append([]string{}, after...), gate: gate}
+			}
+		case hasKey(sm, "trigger"):
+			p.config.dropped("trigger", "step triggers pipeline '%s'; convert that pipeline too and start it from a job", getString(sm, "trigger"))
+		case hasKey(sm, "group"):
+			where := fmt.Sprintf("group '%s'", getString(sm, "group"))
+			p.config.dropKeys(where, sm, keySet("group", "key", "steps", "depends_on", "if", "allow_dependency_failure", "notify"))
+			cond := condition
+			if c := p.condition(where, sm); c != "" {
+				cond = andConditions([]string{condition, c})
+			}
+			deps := append(append([]string{}, after...), p.dependencies(sm, nil)...)
+			jobs := p.parseSteps(listOf(sm["steps"]), deps, cond)
+			if gate != nil {
+				for i := range p.config.Jobs {
+					if containsString(jobs, p.config.Jobs[i].Name) && p.config.Jobs[i].Gate == nil {
+						g := *gate
+						p.config.Jobs[i].Gate = &g
+					}
+				}
+			}
+			if key := stepKey(sm); key != "" {
+				p.keys[key] = jobs
+			}
+			current = append(current, jobs...)
+			added = append(added, jobs...)
+		default:
+			name := p.parseStep(sm, after, gate, condition)
+			if gate != nil {
+				gated = append(gated, name)
+			}
+			current = append(current, name)
+			added = append(added, name)
+		}
+	}
+	holdBack("a block step")
+	return added
+}
+
+func hasKey(m map[string]interface{}, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// stepKey returns a step's key, given as key or its older spellings
+func stepKey(sm map[string]interface{}) string {
+	for _, k := range []string{"key", "id", "identifier"} {
+		if v := getString(sm, k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseStep converts a command step to a job and returns the job's name
+func (p *buildkiteParser) parseStep(sm map[string]interface{}, after []string, gate *Gate, condition string) string {
+	label := getString(sm, "label")
+	if label == "" {
+		label = getString(sm, "name")
+	}
+	label = strings.TrimSpace(buildkiteEmoji.ReplaceAllString(label, ""))
+	name := stepKey(sm)
+	if name == "" {
+		name = label
+	}
+	name = strings.Trim(nonNameChars.ReplaceAllString(sanitizeName(name), "-"), "-")
+	if name == "" {
+		name = fmt.Sprintf("step-%d", len(p.config.Jobs)+1)
+	}
+	base := name
+	for i := 2; p.names[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	p.names[name] = true
+	if key := stepKey(sm); key != "" {
+		p.keys[key] = []string{name}
+	}
+
+	where := fmt.Sprintf("step '%s'", name)
+	p.config.dropKeys(where, sm, buildkiteStepKeys)
+	job := Job{Name: name, RunsOn: "ubuntu-latest", Steps: []Step{}, Environment: stringValues(sm["env"])}
+	for k, v := range job.Environment {
+		job.Environment[k] = p.text(v)
+	}
+	for _, k := range sortedKeys(stringValues(sm["secrets"])) {
+		// secrets: maps variables to secret keys
+		if job.Environment == nil {
+			job.Environment = make(map[string]string)
+		}
+		job.Environment[k] = fmt.Sprintf("${{ secrets.%s }}", stringValues(sm["secrets"])[k])
+	}
+	if list, ok := sm["secrets"].([]interface{}); ok {
+		if job.Environment == nil {
+			job.Environment = make(map[string]string)
+		}
+		for _, s := range flattenScript(list) {
+			job.Environment[s] = fmt.Sprintf("${{ secrets.%s }}", s)
+		}
+	}
+	if sm["agents"] != nil || p.agents {
+		job.RunsOn = "self-hosted"
+		p.config.note("%s targets Buildkite agents by queue or tags; pick matching runner labels", where)
+	}
+
+	job.DependsOn = p.dependencies(sm, append([]string{}, after...))
+	for _, dep := range flattenScript(listOf(sm["depends_on"])) {
+		if block, ok := p.blocks[dep]; ok && gate == nil {
+			gate = block.gate
+		}
+	}
+	if gate != nil {
+		g := *gate
+		job.Gate = &g
+	}
+
+	conds := []string{condition, p.condition(where, sm)}
+	if fmt.Sprint(sm["allow_dependency_failure"]) == "true" {
+		conds = append([]string{"always()"}, conds...)
+	}
+	job.Condition = andConditions(conds)
+	job.Matrix = p.matrix(where, sm["matrix"])
+
+	var uploads []string
+	for _, plugin := range buildkitePlugins(sm["plugins"]) {
+		uploads = append(uploads, p.plugin(&job, where, plugin.name, plugin.config)...)
+	}
+
+	for i, cmd := range flattenScript(listOf(sm["command"])) {
+		p.command(&job, cmd, label, i)
+	}
+	for i, cmd := range flattenScript(listOf(sm["commands"])) {
+		p.command(&job, cmd, label, i)
+	}
+
+	var paths []string
+	switch a := sm["artifact_paths"].(type) {
+	case string:
+		paths = strings.Split(a, ";")
+	case []interface{}:
+		paths = flattenScript(a)
+	}
+	for _, path := range append(paths, uploads...) {
+		p.upload(&job, p.text(strings.TrimSpace(path)))
+	}
+
+	p.config.Jobs = append(p.config.Jobs, job)
+	return name
+}
+
+// dependencies adds a step's depends_on to after. Keys of groups stand
+// for all of their jobs and keys of block steps for what the block waits for.
+func (p *buildkiteParser) dependencies(sm map[string]interface{}, after []string) []string {
+	for _, d := range listOf(sm["depends_on"]) {
+		dep := fmt.Sprint(d)
+		if dm, ok := d.(map[string]interface{}); ok {
+			dep = getString(dm, "step")
+			if fmt.Sprint(dm["allow_failure"]) == "true" {
+				p.config.approximated("depends_on", "a step may start when '%s' fails; it now needs it to succeed", dep)
+			}
+		}
+		jobs, ok := p.keys[dep]
+		if block, isBlock := p.blocks[dep]; isBlock {
+			jobs, ok = block.after, true
+		}
+		if !ok {
+			p.config.dropped("depends_on", "depends_on names '%s', which is not a command step before it", dep)
+			continue
+		}
+		for _, job := range jobs {
+			if !containsString(after, job) {
+				after = append(after, job)
+			}
+		}
+	}
+	return after
+}
+
+// condition reads a step's branches: and if: as a GitHub condition
+func (p *buildkiteParser) condition(where string, sm map[string]interface{}) string {
+	var conds []string
+	if branches := strings.Fields(strings.Join(flattenScript(listOf(sm["branches"])), " ")); len(branches) > 0 {
+		var include, exclude []string
+		for _, b := range branches {
+			if strings.HasPrefix(b, "!") {
+				if c := globCondition(p.config, "github.ref_name", b[1:]); c != "" {
+					exclude = append(exclude, negateCondition(c))
+				}
+				continue
+			}
+			if c := globCondition(p.config, "github.ref_name", b); c != "" {
+				include = append(include, c)
+			} else {
+				include = nil
+				break
+			}
+		}
+		if len(include) > 0 {
+			conds = append(conds, orConditions(include))
+		}
+		conds = append(conds, exclude...)
+	}
+	if expr := getString(sm, "if"); expr != "" {
+		if c, ok := buildkiteCondition(expr); ok {
+			conds = append(conds, c)
+		} else {
+			p.config.dropped("if", "%s has condition '%s'; it now runs in every build", where, expr)
+		}
+	}
+	return andConditions(conds)
+}
+
+// buildkiteCondition rewrites a Buildkite conditional, reporting false when
+// it uses something without a GitHub equivalent
+func buildkiteCondition(expr string) (string, bool) {
+	cond := buildkiteBranchRegex.ReplaceAllStringFunc(expr, func(m string) string {
+		parts := buildkiteBranchRegex.FindStringSubmatch(m)
+		prefix := strings.NewReplacer(`\/`, "/", `\.`, ".").Replace(parts[2])
+		if parts[1] == "!~" {
+			return fmt.Sprintf("!startsWith(github.ref_name, '%s')", prefix)
+		}
+		return fmt.Sprintf("startsWith(github.ref_name, '%s')", prefix)
+	})
+	for _, rule := range buildkiteConditions {
+		cond = rule.pattern.ReplaceAllString(cond, rule.replacement)
+	}
+	if buildkiteUnsupported.MatchString(cond) {
+		return "", false
+	}
+	return cond, true
+}
+
+// buildkitePlugin is one entry of a plugins: list
+type buildkitePlugin struct {
+	name   string
+	config map[string]interface{}
+}
+
+// buildkitePlugins reads plugins: as a list of names or {name: config}, or
+// as the older map of name to config
+func buildkitePlugins(v interface{}) []buildkitePlugin {
+	var plugins []buildkitePlugin
+	add := func(name string, config interface{}) {
+		cm, _ := config.(map[string]interface{})
+		plugins = append(plugins, buildkitePlugin{name: name, config: cm})
+	}
+	switch pv := v.(type) {
+	case []interface{}:
+		for _, item := range pv {
+			im, ok := item.(map[string]interface{})
+			if !ok {
+				add(fmt.Sprint(item), nil)
+				continue
+			}
+			for _, name := range sortedKeys(stringMap(im)) {
+				add(name, im[name])
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range sortedKeys(stringMap(pv)) {
+			add(name, pv[name])
+		}
+	}
+	return plugins
+}
+
+// plugin converts the plugins cicli knows: docker runs the job in a
+// container, artifacts and cache map to their equivalents. Others become
+// failing steps that name them. It returns the paths the job uploads after
+// its commands.
+func (p *buildkiteParser) plugin(job *Job, where, name string, config map[string]interface{}) []string {
+	short := strings.SplitN(name, "#", 2)[0]
+	short = short[strings.LastIndex(short, "/")+1:]
+	short = strings.TrimSuffix(short, "-buildkite-plugin")
+	pluginWhere := fmt.Sprintf("%s plugin %s", where, short)
+
+	switch short {
+	case "docker":
+		p.config.dropKeys(pluginWhere, config, keySet("image", "always-pull", "environment", "propagate-environment", "mount-buildkite-agent", "workdir"))
+		job.Container = &Container{Image: p.text(getString(config, "image"))}
+		for _, e := range flattenScript(listOf(config["environment"])) {
+			// Names without a value pass the agent's variable through
+			if k, v, ok := strings.Cut(e, "="); ok {
+				if job.Container.Env == nil {
+					job.Container.Env = make(map[string]string)
+				}
+				job.Container.Env[k] = p.text(v)
+			}
+		}
+		return nil
+	case "artifacts":
+		p.config.dropKeys(pluginWhere, config, keySet("upload", "download"))
+		for _, path := range flattenScript(listOf(config["download"])) {
+			p.download(job, p.text(path))
+		}
+		return flattenScript(listOf(config["upload"]))
+	case "cache":
+		p.config.dropKeys(pluginWhere, config, keySet("path", "manifest", "restore", "save"))
+		paths := flattenScript(listOf(config["path"]))
+		if len(paths) > 0 {
+			job.Cache = append(job.Cache, Cache{Key: sanitizeName(job.Name), Paths: paths, Files: flattenScript(listOf(config["manifest"]))})
+		}
+		return nil
+	}
+
+	var settings []string
+	for k := range config {
+		settings = append(settings, k)
+	}
+	sort.Strings(settings)
+	job.Steps = append(job.Steps, Step{Name: short, Run: fmt.Sprintf("echo \"Plugin %s (manual conversion needed) with %s\" && exit 1", name, strings.Join(settings, ", "))})
+	p.config.dropped("plugin", "%s uses plugin %s; replace it with an equivalent action or command", where, name)
+	return nil
+}
+
+// command adds one command line; buildkite-agent artifact commands become
+// artifact steps
+func (p *buildkiteParser) command(job *Job, cmd, label string, i int) {
+	cmd = strings.TrimRight(p.text(cmd), "\n")
+	if m := buildkiteUpload.FindStringSubmatch(cmd); m != nil {
+		p.upload(job, m[2])
+		return
+	}
+	if m := buildkiteDownload.FindStringSubmatch(cmd); m != nil && p.download(job, m[2]) {
+		return
+	}
+	step := Step{Run: cmd}
+	if i == 0 && label != "" && len(job.Steps) == 0 {
+		step.Name = label
+	}
+	job.Steps = append(job.Steps, step)
+}
+
+// upload adds an upload-artifact step for path
+func (p *buildkiteParser) upload(job *Job, path string) {
+	name := job.Name
+	for i := 2; ; i++ {
+		taken := false
+		for _, a := range jobArtifacts(*job) {
+			if a.Name == name {
+				taken = true
+			}
+		}
+		if !taken {
+			break
+		}
+		name = fmt.Sprintf("%s-%d", job.Name, i)
+	}
+	job.Steps = append(job.Steps, Step{Uses: uploadArtifact, With: map[string]string{"name": name, "path": path}})
+	p.uploads[path] = Artifact{Name: name, Paths: []string{path}}
+}
+
+// download adds a download-artifact step for an artifact an earlier step
+// uploads under the same path; Buildkite matches paths across the whole build
+func (p *buildkiteParser) download(job *Job, path string) bool {
+	a, ok := p.uploads[path]
+	if !ok {
+		p.config.note("job '%s' downloads '%s', which no earlier step uploads under that path; replace the buildkite-agent command", job.Name, path)
+		return false
+	}
+	job.Steps = append(job.Steps, downloadStep(a))
+	return true
+}
+
+// matrix reads matrix: as a list of values, which steps read as {{matrix}},
+// or as setup: dimensions with adjustments
+func (p *buildkiteParser) matrix(where string, v interface{}) *Matrix {
+	setup := v
+	var adjustments []interface{}
+	if mm, ok := v.(map[string]interface{}); ok {
+		p.config.dropKeys(where+" matrix", mm, keySet("setup", "adjustments"))
+		setup, adjustments = mm["setup"], listOf(mm["adjustments"])
+	}
+
+	m := &Matrix{Axes: make(map[string][]string)}
+	switch s := setup.(type) {
+	case []interface{}:
+		m.Axes["value"] = matrixValues(p.config, where, s)
+	case map[string]interface{}:
+		for name, values := range s {
+			m.Axes[name] = matrixValues(p.config, where, values)
+		}
+	default:
+		return nil
+	}
+
+	for _, adj := range adjustments {
+		am, ok := adj.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		p.config.dropKeys(where+" matrix adjustment", am, keySet("with", "skip"))
+		entry := make(map[string]string)
+		switch with := am["with"].(type) {
+		case map[string]interface{}:
+			for k, val := range with {
+				entry[k] = matrixValues(p.config, where, val)[0]
+			}
+		case nil:
+			continue
+		default:
+			entry["value"] = fmt.Sprint(with)
+		}
+		if skip := fmt.Sprint(am["skip"]); am["skip"] != nil && skip != "false" {
+			m.Exclude = append(m.Exclude, entry)
+		} else {
+			m.Include = append(m.Include, entry)
+		}
+	}
+	return m
+}
+
+// text undoes the $$ escaping of Buildkite's interpolation and turns
+// {{matrix.x}} into ${{ matrix.x }}
+func (p *buildkiteParser) text(s string) string {
+	s = strings.ReplaceAll(s, "$$", "$")
+	return buildkiteMatrixRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := buildkiteMatrixRef.FindStringSubmatch(ref)[1]
+		if name == "" {
+			name = "value"
+		}
+		return "${{ matrix." + name + " }}"
+	})
+}
+
+// generateBuildkite generates a Buildkite pipeline with a command step per
+// job. Jobs that each need the whole level before them are separated by
+// wait steps; other graphs name their dependencies. Gated jobs wait behind
+// a block step.
+func (c *Converter) generateBuildkite(config *PipelineConfig) (string, error) {
+	g := &buildkiteGenerator{config: config, env: make(map[string]string), secrets: make(map[string]string)}
+	for k, v := range config.Environment {
+		if name := settingName(v); name != "" {
+			g.secrets[k] = name
+			continue
+		}
+		g.env[k] = v
+	}
+
+	for _, t := range config.Triggers {
+		switch t.Type {
+		case "push":
+			if len(t.Branches) > 0 {
+				config.note("builds ran on pushes to %s; set the Buildkite pipeline's branch filter to match", strings.Join(t.Branches, ", "))
+			}
+		case "pull_request":
+			config.note("builds ran for pull requests; enable building pull requests in the Buildkite pipeline settings")
+		case "schedule":
+			config.note("create a schedule for the pipeline in Buildkite (cron '%s')", t.Cron)
+		case "call":
+			config.approximated("workflow_call", "the pipeline is reusable; start it from other Buildkite pipelines with a trigger step")
+		}
+	}
+
+	var pipeline buildkitePipeline
+	for k, v := range g.env {
+		if pipeline.Env == nil {
+			pipeline.Env = make(map[string]string)
+		}
+		pipeline.Env[k] = g.value(k, v)
+	}
+
+	levels, waits := buildkiteLevels(config.Jobs)
+	for l, level := range levels {
+		if waits {
+			if gate := level[0].Gate; gate != nil {
+				pipeline.Steps = append(pipeline.Steps, g.block(level[0], "", nil))
+			} else if l > 0 {
+				pipeline.Steps = append(pipeline.Steps, "wait")
+			}
+		}
+		for _, job := range level {
+			deps := job.DependsOn
+			if !waits && job.Gate != nil {
+				key := job.Name + "-approval"
+				pipeline.Steps = append(pipeline.Steps, g.block(job, key, deps))
+				deps = []string{key}
+			}
+			if waits {
+				deps = nil
+			}
+			pipeline.Steps = append(pipeline.Steps, g.step(job, deps))
+		}
+	}
+	return marshalYAML(config.Comment, pipeline)
+}
+
+// buildkitePipeline is a Buildkite pipeline file
+type buildkitePipeline struct {
+	Env   map[string]string `yaml:"env,omitempty"`
+	Steps []interface{}     `yaml:"steps"`
+}
+
+type buildkiteBlockStep struct {
+	Block                  string   `yaml:"block"`
+	Key                    string   `yaml:"key,omitempty"`
+	DependsOn              []string `yaml:"depends_on,omitempty"`
+	AllowDependencyFailure bool     `yaml:"allow_dependency_failure,omitempty"`
+	AllowedTeams           []string `yaml:"allowed_teams,omitempty"`
+}
+
+type buildkiteCommandStep struct {
+	carried
+	Label                  string            `yaml:"label"`
+	Key                    string            `yaml:"key"`
+	DependsOn              []string          `yaml:"depends_on,omitempty"`
+	AllowDependencyFailure bool              `yaml:"allow_dependency_failure,omitempty"`
+	If                     string            `yaml:"if,omitempty"`
+	Env                    map[string]string `yaml:"env,omitempty"`
+	Secrets                map[string]string `yaml:"secrets,omitempty"`
+	Plugins                []yamlMap         `yaml:"plugins,omitempty"`
+	Commands               *yamlList         `yaml:"commands"`
+	ArtifactPaths          []string          `yaml:"artifact_paths,omitempty"`
+	Matrix                 *buildkiteMatrix  `yaml:"matrix,omitempty"`
+}
+
+type buildkiteDockerOptions struct {
+	Image                string `yaml:"image"`
+	PropagateEnvironment bool   `yaml:"propagate-environment"`
+}
+
+type buildkiteMatrix struct {
+	Setup       yamlMap               `yaml:"setup"`
+	Adjustments []buildkiteAdjustment `yaml:"adjustments,omitempty"`
+}
+
+type buildkiteAdjustment struct {
+	With yamlMap `yaml:"with"`
+	Skip bool    `yaml:"skip"`
+}
+
+type buildkiteGenerator struct {
+	config  *PipelineConfig
+	env     map[string]string
+	secrets map[string]string // variables bound to a secret of the same or another name
+}
+
+// buildkiteLevels groups jobs in dependency levels and reports whether wait
+// steps can separate them: each job needs exactly the level before it, and
+// the jobs of a level share their gate
+func buildkiteLevels(jobs []Job) ([][]Job, bool) {
+	level := make(map[string]int)
+	byName := make(map[string]Job)
+	for _, job := range jobs {
+		byName[job.Name] = job
+	}
+	var levelOf func(name string, seen map[string]bool) int
+	levelOf = func(name string, seen map[string]bool) int {
+		if l, ok := level[name]; ok {
+			return l
+		}
+		if seen[name] {
+			return 0
+		}
+		seen[name] = true
+		l := 0
+		for _, dep := range byName[name].DependsOn {
+			if _, ok := byName[dep]; ok {
+				if d := levelOf(dep, seen) + 1; d > l {
+					l = d
+				}
+			}
+		}
+		level[name] = l
+		return l
+	}
+	var levels [][]Job
+	for _, job := range droneJobOrder(jobs) {
+		l := levelOf(job.Name, make(map[string]bool))
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], job)
+	}
+
+	waits := true
+	for l, group := range levels {
+		var previous []string
+		if l > 0 {
+			for _, job := range levels[l-1] {
+				previous = append(previous, job.Name)
+			}
+		}
+		sort.Strings(previous)
+		for _, job := range group {
+			deps := append([]string{}, job.DependsOn...)
+			sort.Strings(deps)
+			if strings.Join(deps, ",") != strings.Join(previous, ",") || !sameGate(job.Gate, group[0].Gate) {
+				waits = false
+			}
+		}
+	}
+	return levels, waits
+}
+
+func sameGate(a, b *Gate) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Environment == b.Environment && a.Manual == b.Manual && strings.Join(a.Approvers, ",") == strings.Join(b.Approvers, ",")
+}
+
+// block is the block step guarding a gated job
+func (g *buildkiteGenerator) block(job Job, key string, deps []string) buildkiteBlockStep {
+	prompt := fmt.Sprintf("Run %s?", job.Name)
+	if env := job.Gate.Environment; env != "" {
+		prompt = fmt.Sprintf("Deploy %s to %s?", job.Name, env)
+		g.config.approximated("environment", "job '%s' used environment '%s'; Buildkite has no environments, so a block step guards it instead", job.Name, env)
+	}
+	block := buildkiteBlockStep{Block: prompt, Key: key, DependsOn: deps, AllowDependencyFailure: alwaysRuns(job.Condition)}
+	if len(job.Gate.Approvers) > 0 {
+		g.config.note("job '%s' needs approval from %s; allowed_teams takes Buildkite team slugs", job.Name, strings.Join(job.Gate.Approvers, ", "))
+		block.AllowedTeams = job.Gate.Approvers
+	}
+	return block
+}
+
+func (g *buildkiteGenerator) step(job Job, deps []string) buildkiteCommandStep {
+	bs := buildkiteCommandStep{carried: carried{job.Comment}, Label: job.Name, Key: job.Name, DependsOn: deps}
+
+	cond := job.Condition
+	if alwaysRuns(cond) {
+		bs.AllowDependencyFailure = true
+		cond = strings.TrimPrefix(strings.TrimPrefix(cond, "always()"), " && ")
+	}
+	if cond != "" {
+		if expr, ok := buildkiteExpression(cond); ok {
+			bs.If = expr
+		} else {
+			g.config.dropped("if", "job '%s' has condition '%s'; Buildkite runs it in every build", job.Name, cond)
+		}
+	}
+	if job.RunsOn != "" && !strings.HasPrefix(job.RunsOn, "ubuntu-") {
+		g.config.note("job '%s' runs on %s; target matching Buildkite agents with agents:", job.Name, job.RunsOn)
+	}
+	if len(job.Services) > 0 {
+		g.config.dropped("services", "job '%s' uses services %s; Buildkite has no service containers, so run them with the docker-compose plugin", job.Name, serviceNames(job))
+	}
+
+	env := copyStrings(job.Environment)
+	if job.Container != nil {
+		for k, v := range job.Container.Env {
+			env[k] = v
+		}
+	}
+	commands := g.commands(job)
+
+	// Steps only get the secrets they read
+	secrets := make(map[string]string)
+	text := strings.Join(commands, "\n")
+	for _, v := range env {
+		text += "\n" + v
+	}
+	for k, v := range env {
+		name := settingName(v)
+		if m := variablePattern.FindStringSubmatch(v); m != nil && m[0] == v && g.secrets[variableName(m)] != "" {
+			name = g.secrets[variableName(m)]
+		}
+		if name != "" {
+			secrets[k] = name
+			delete(env, k)
+		}
+	}
+	for _, m := range variablePattern.FindAllStringSubmatch(text, -1) {
+		name := variableName(m)
+		if _, set := env[name]; !set && g.secrets[name] != "" {
+			secrets[name] = g.secrets[name]
+		}
+	}
+
+	for k, v := range env {
+		env[k] = g.value(job.Name, v)
+	}
+	bs.Env, bs.Secrets = env, secrets
+	if job.Container != nil {
+		docker := buildkiteDockerOptions{Image: job.Container.Image, PropagateEnvironment: true}
+		bs.Plugins = []yamlMap{{{Key: buildkiteDockerPlugin, Value: docker}}}
+	}
+
+	escaped := make([]string, len(commands))
+	for i, cmd := range commands {
+		escaped[i] = cmd
+		if !strings.HasPrefix(cmd, "#") {
+			escaped[i] = strings.ReplaceAll(cmd, "$", "$$")
+		}
+	}
+	bs.Commands = bitbucketScript(escaped)
+
+	for _, p := range artifactPaths(job) {
+		bs.ArtifactPaths = append(bs.ArtifactPaths, buildkiteArtifactPath(p))
+	}
+
+	if job.Matrix != nil {
+		bs.Matrix = g.matrix(job)
+	}
+	return bs
+}
+
+// commands builds a job's script. Job outputs travel as build meta-data.
+func (g *buildkiteGenerator) commands(job Job) []string {
+	var script []string
+	for _, producer := range outputProducers(g.config, job) {
+		for _, other := range g.config.Jobs {
+			if other.Name != producer {
+				continue
+			}
+			for _, out := range other.Outputs {
+				name := outputVariable(producer, out.Name)
+				script = append(script, fmt.Sprintf(`export %s="$(buildkite-agent meta-data get %s)"`, name, name))
+			}
+		}
+	}
+	if writesOutputs(job) {
+		script = append(script, "mkdir -p "+outputDir)
+	}
+
+	workspaceDownloads(g.config, job, "Buildkite")
+	artifacts, _ := artifactDownloads(g.config, job)
+	for _, a := range artifacts {
+		for _, p := range a.Paths {
+			script = append(script, fmt.Sprintf(`buildkite-agent artifact download "%s" .`, buildkiteArtifactPath(p)))
+		}
+	}
+
+	for _, step := range job.Steps {
+		var command string
+		switch {
+		case step.Image != "":
+			command = dockerRunCommand(step)
+		case step.Run != "":
+			command = shellOutputs(step.Run, step)
+		case step.Uses != "":
+			command = convertActionToCommand(step)
+		}
+		command = strings.TrimRight(command, "\n")
+		if command == "" {
+			continue
+		}
+		command = scopedCommand(step, command)
+		if step.If != "" {
+			g.config.dropped("if", "step in job '%s' has condition '%s'; Buildkite runs it unconditionally", job.Name, step.If)
+		}
+		script = append(append(script, commentLines(step.Comment)...), command)
+	}
+
+	for _, out := range job.Outputs {
+		name := outputVariable(job.Name, out.Name)
+		script = append(script, fmt.Sprintf(`echo "%s=%s" >> %s`, name, shellOutputRefs(out.Value), jobOutputFile(job.Name)))
+		script = append(script, fmt.Sprintf(`buildkite-agent meta-data set %s "$(sed -n 's/^%s=//p' %s)"`, name, name, jobOutputFile(job.Name)))
+	}
+	if len(script) == 0 {
+		script = []string{"echo \"Nothing to run\""}
+	}
+	return script
+}
+
+// matrix is a job's combinations as setup: dimensions, skipping the
+// products the matrix does not run
+func (g *buildkiteGenerator) matrix(job Job) *buildkiteMatrix {
+	vars, setup, skipped := matrixGrid(g.config, job, "Buildkite")
+	m := &buildkiteMatrix{}
+	for _, v := range vars {
+		m.Setup.set(v, flowSeq(setup[v], true))
+	}
+	for _, with := range matrixList(skipped, true) {
+		m.Adjustments = append(m.Adjustments, buildkiteAdjustment{With: with, Skip: true})
+	}
+	return m
+}
+
+// value escapes an env: value. Buildkite interpolates its own variables when
+// the pipeline is uploaded; other references stay text.
+func (g *buildkiteGenerator) value(job, s string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range variablePattern.FindAllStringSubmatchIndex(s, -1) {
+		sb.WriteString(strings.ReplaceAll(s[last:m[0]], "$", "$$"))
+		ref := s[m[0]:m[1]]
+		name := variableName(variablePattern.FindStringSubmatch(ref))
+		if !isBuiltin(Buildkite, name) {
+			g.config.approximated("environment", "job '%s' sets a value from $%s; Buildkite only expands its own variables in env:, so it is passed as text", job, name)
+			ref = "$" + ref
+		}
+		sb.WriteString(ref)
+		last = m[1]
+	}
+	sb.WriteString(strings.ReplaceAll(s[last:], "$", "$$"))
+	return sb.String()
+}
+
+// buildkiteExpression rewrites a GitHub condition as a Buildkite
+// conditional, reporting false when it has no equivalent
+func buildkiteExpression(cond string) (string, bool) {
+	expr := refPrefixCondition.ReplaceAllStringFunc(cond, func(m string) string {
+		parts := refPrefixCondition.FindStringSubmatch(m)
+		op := "=~"
+		if parts[1] == "!" {
+			op = "!~"
+		}
+		return fmt.Sprintf("build.branch %s /^%s/", op, strings.ReplaceAll(regexp.QuoteMeta(parts[2]), "/", `\/`))
+	})
+	for _, rule := range githubBuildkiteConditions {
+		expr = rule.pattern.ReplaceAllString(expr, rule.replacement)
+	}
+	if githubUnsupported.MatchString(expr) {
+		return "", false
+	}
+	return expr, true
+}
+
+// buildkiteArtifactPath turns a directory into a glob; Buildkite uploads
+// files only
+func buildkiteArtifactPath(p string) string {
+	trimmed := strings.TrimSuffix(p, "/")
+	base := trimmed[strings.LastIndex(trimmed, "/")+1:]
+	if strings.ContainsAny(p, "*?[") || (strings.Contains(base, ".") && !strings.HasSuffix(p, "/")) {
+		return p
+	}
+	return trimmed + "/**/*"
+}
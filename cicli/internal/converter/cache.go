@@ -0,0 +1,278 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A Cache keeps Paths between runs under Key, a name, plus the hash of
+// Files such as lock files when there are any: a new lock file starts a
+// new cache, seeded from the last one with the same name.
+
+var (
+	githubCacheExpr   = regexp.MustCompile(`\$\{\{\s*([^}]*?)\s*\}\}`)
+	hashFilesPattern  = regexp.MustCompile(`^hashFiles\((.*)\)$`)
+	quotedArgPattern  = regexp.MustCompile(`'([^']*)'|"([^"]*)"`)
+	circleCITemplate  = regexp.MustCompile(`\{\{\s*([^}]*?)\s*\}\}`)
+	checksumPattern   = regexp.MustCompile(`^checksum\s+"([^"]+)"$`)
+	cacheKeySeparator = regexp.MustCompile(`^[-_.]+|[-_.]+$`)
+)
+
+// cacheKey joins the parts of a parsed key that stay constant
+func cacheKey(parts []string) string {
+	key := cacheKeySeparator.ReplaceAllString(strings.Join(parts, ""), "")
+	if key == "" {
+		return "cache"
+	}
+	return key
+}
+
+// parseGitHubCacheKey reads an actions/cache key such as
+// ${{ runner.os }}-npm-${{ hashFiles('**/package-lock.json') }}. Keys with
+// other expressions are not understood.
+func parseGitHubCacheKey(key string) (Cache, bool) {
+	var cache Cache
+	var parts []string
+	last := 0
+	for _, m := range githubCacheExpr.FindAllStringSubmatchIndex(key, -1) {
+		parts = append(parts, key[last:m[0]])
+		last = m[1]
+		expr := key[m[2]:m[3]]
+		switch {
+		case expr == "runner.os":
+		case hashFilesPattern.MatchString(expr):
+			for _, arg := range quotedArgPattern.FindAllStringSubmatch(hashFilesPattern.FindStringSubmatch(expr)[1], -1) {
+				cache.Files = append(cache.Files, arg[1]+arg[2])
+			}
+		default:
+			return Cache{}, false
+		}
+	}
+	cache.Key = cacheKey(append(parts, key[last:]))
+	return cache, true
+}
+
+// parseCircleCICache reads a save_cache key such as
+// v1-deps-{{ checksum "package-lock.json" }}. Branch, arch and environment
+// templates only narrow the key and are left out.
+func parseCircleCICache(key string) (Cache, bool) {
+	if key == "" {
+		return Cache{}, false
+	}
+	var cache Cache
+	var parts []string
+	last := 0
+	for _, m := range circleCITemplate.FindAllStringSubmatchIndex(key, -1) {
+		parts = append(parts, key[last:m[0]])
+		last = m[1]
+		if c := checksumPattern.FindStringSubmatch(key[m[2]:m[3]]); c != nil {
+			cache.Files = append(cache.Files, c[1])
+		}
+	}
+	cache.Key = cacheKey(append(parts, key[last:]))
+	return cache, true
+}
+
+// parseGitLabCache reads cache: given as one cache or a list. A key is a
+// string or {files, prefix}.
+func parseGitLabCache(config *PipelineConfig, where string, v interface{}) []Cache {
+	var caches []Cache
+	for _, item := range listOf(v) {
+		cm, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		config.dropKeys("cache in "+where, cm, keySet("key", "paths", "policy", "when"))
+		cache := Cache{Key: "cache", Paths: flattenScript(listOf(cm["paths"]))}
+		switch key := cm["key"].(type) {
+		case string:
+			cache.Key = cacheKey([]string{strings.ReplaceAll(key, "$CI_COMMIT_REF_SLUG", "")})
+		case map[string]interface{}:
+			cache.Files = flattenScript(listOf(key["files"]))
+			if prefix := getString(key, "prefix"); prefix != "" {
+				cache.Key = prefix
+			}
+		}
+		if policy := getString(cm, "policy"); policy == "pull" || policy == "push" {
+			config.approximated("cache:policy", "%s: cache '%s' is only %sed on GitLab; the converted job restores and saves it", where, cache.Key, policy)
+		}
+		if len(cache.Paths) > 0 {
+			caches = append(caches, cache)
+		}
+	}
+	return caches
+}
+
+// azureCacheKey reads a Cache@2 key such as
+// npm | "$(Agent.OS)" | package-lock.json: segments that look like paths are
+// files to hash, the others strings
+func azureCacheKey(key string) Cache {
+	var cache Cache
+	var parts []string
+	for _, seg := range strings.Split(key, "|") {
+		seg = strings.TrimSpace(seg)
+		switch {
+		case strings.HasPrefix(seg, `"`):
+			if s := strings.Trim(seg, `"`); !strings.Contains(s, "$(") {
+				parts = append(parts, s+"-")
+			}
+		case strings.ContainsAny(seg, "./*"):
+			cache.Files = append(cache.Files, seg)
+		case seg != "":
+			parts = append(parts, seg+"-")
+		}
+	}
+	cache.Key = cacheKey(parts)
+	return cache
+}
+
+// liftCaches turns actions/cache steps, from GitHub or from translated
+// tasks, into job caches the generators lay out for the target
+func liftCaches(config *PipelineConfig) {
+	for i, job := range config.Jobs {
+		var steps []Step
+		for _, step := range job.Steps {
+			if !strings.HasPrefix(step.Uses, "actions/cache@") {
+				steps = append(steps, step)
+				continue
+			}
+			cache, ok := parseGitHubCacheKey(step.With["key"])
+			if !ok {
+				steps = append(steps, step)
+				continue
+			}
+			cache.Paths = splitInput(step.With["path"])
+			config.Jobs[i].Cache = append(config.Jobs[i].Cache, cache)
+		}
+		config.Jobs[i].Steps = steps
+	}
+}
+
+// githubCacheKey is the actions/cache key for cache
+func githubCacheKey(cache Cache) string {
+	key := "${{ runner.os }}-" + cache.Key
+	if len(cache.Files) == 0 {
+		return key
+	}
+	files := make([]string, len(cache.Files))
+	for i, f := range cache.Files {
+		files[i] = "'" + f + "'"
+	}
+	return fmt.Sprintf("%s-${{ hashFiles(%s) }}", key, strings.Join(files, ", "))
+}
+
+// githubCacheStep is the actions/cache step restoring and saving cache
+func githubCacheStep(cache Cache) githubStep {
+	path := strings.Join(cache.Paths, "\n")
+	if len(cache.Paths) > 1 {
+		path += "\n"
+	}
+	with := yamlMap{{Key: "path", Value: path}, {Key: "key", Value: githubCacheKey(cache)}}
+	if len(cache.Files) > 0 {
+		with.set("restore-keys", fmt.Sprintf("${{ runner.os }}-%s-", cache.Key))
+	}
+	return githubStep{Uses: "actions/cache@v4", With: with}
+}
+
+type gitlabCache struct {
+	Key   interface{} `yaml:"key"` // the key, or a gitlabCacheKey
+	Paths []string    `yaml:"paths"`
+}
+
+type gitlabCacheKey struct {
+	Files  []string `yaml:"files"`
+	Prefix string   `yaml:"prefix"`
+}
+
+// gitlabCaches is a job's cache:. GitLab hashes at most two files for a key
+// and only caches paths inside the project directory.
+func gitlabCaches(config *PipelineConfig, job Job) []gitlabCache {
+	var caches []gitlabCache
+	for _, cache := range job.Cache {
+		gc := gitlabCache{Key: sanitizeName(cache.Key), Paths: cache.Paths}
+		if len(cache.Files) > 0 {
+			files := cache.Files
+			if len(files) > 2 {
+				config.approximated("cache", "job '%s': cache '%s' hashes %d files; GitLab keys use the first two", job.Name, cache.Key, len(files))
+				files = files[:2]
+			}
+			gc.Key = gitlabCacheKey{Files: files, Prefix: sanitizeName(cache.Key)}
+		}
+		for _, p := range cache.Paths {
+			if strings.HasPrefix(p, "~") || strings.HasPrefix(p, "/") {
+				config.approximated("cache", "job '%s': GitLab only caches paths inside the project, so %s needs moving there (e.g. npm --cache .npm)", job.Name, p)
+			}
+		}
+		caches = append(caches, gc)
+	}
+	return caches
+}
+
+// circleCICacheKey is the save_cache key; checksum takes one file, so
+// globs are narrowed to the file they name
+func circleCICacheKey(config *PipelineConfig, job Job, cache Cache) string {
+	key := sanitizeName(cache.Key)
+	for _, f := range cache.Files {
+		if strings.ContainsAny(f, "*?[") {
+			config.approximated("cache", "job '%s': cache '%s' hashes %s; CircleCI checksums one file, so the glob is dropped", job.Name, cache.Key, f)
+			f = strings.TrimPrefix(f[strings.LastIndexAny(f, "*?]")+1:], "/")
+		}
+		key += fmt.Sprintf(`-{{ checksum "%s" }}`, f)
+	}
+	return key
+}
+
+type circleCIRestore struct {
+	Keys []string `yaml:"keys"`
+}
+
+type circleCISave struct {
+	Key   string   `yaml:"key"`
+	Paths []string `yaml:"paths"`
+}
+
+// circleCIRestores restores a job's caches, falling back to the newest
+// cache with the same name
+func circleCIRestores(config *PipelineConfig, job Job) []interface{} {
+	var steps []interface{}
+	for _, cache := range job.Cache {
+		keys := []string{circleCICacheKey(config, job, cache)}
+		if len(cache.Files) > 0 {
+			keys = append(keys, sanitizeName(cache.Key)+"-")
+		}
+		steps = append(steps, yamlMap{{Key: "restore_cache", Value: circleCIRestore{Keys: keys}}})
+	}
+	return steps
+}
+
+func circleCISaves(config *PipelineConfig, job Job) []interface{} {
+	var steps []interface{}
+	for _, cache := range job.Cache {
+		save := circleCISave{Key: circleCICacheKey(config, job, cache), Paths: cache.Paths}
+		steps = append(steps, yamlMap{{Key: "save_cache", Value: save}})
+	}
+	return steps
+}
+
+// azureCaches is a Cache@2 task per cached path; the task keeps one path,
+// so several paths get keys of their own
+func azureCaches(job Job) []azureStep {
+	var steps []azureStep
+	for _, cache := range job.Cache {
+		for i, p := range cache.Paths {
+			key := sanitizeName(cache.Key)
+			if len(cache.Paths) > 1 {
+				key = fmt.Sprintf("%s-%d", key, i+1)
+			}
+			segments := append([]string{`"` + key + `"`, `"$(Agent.OS)"`}, cache.Files...)
+			inputs := yamlMap{{Key: "key", Value: strings.Join(segments, " | ")}}
+			if len(cache.Files) > 0 {
+				inputs.set("restoreKeys", strings.Join(segments[:2], " | "))
+			}
+			inputs.set("path", p)
+			steps = append(steps, azureStep{Task: "Cache@2", Inputs: inputs})
+		}
+	}
+	return steps
+}
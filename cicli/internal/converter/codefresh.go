@@ -0,0 +1,324 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// codefreshCloneStep is the git-clone step; freestyle steps run in the
+// directory of the step named main_clone by default
+const codefreshCloneStep = "main_clone"
+
+var nonCodefreshChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// githubCodefreshConditions rewrite GitHub expressions to Codefresh
+// condition expressions; refPrefixCondition handles branch prefixes
+var githubCodefreshConditions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`github\.(?:ref_name|head_ref) == '([^']*)'`), "'$${{CF_BRANCH}}' == '$1'"},
+	{regexp.MustCompile(`github\.(?:ref_name|head_ref) != '([^']*)'`), "'$${{CF_BRANCH}}' != '$1'"},
+	{regexp.MustCompile(`github\.ref == 'refs/heads/([^']*)'`), "'$${{CF_BRANCH}}' == '$1'"},
+	{regexp.MustCompile(`github\.ref != 'refs/heads/([^']*)'`), "'$${{CF_BRANCH}}' != '$1'"},
+	{regexp.MustCompile(`github\.base_ref == '([^']*)'`), "'$${{CF_PULL_REQUEST_TARGET}}' == '$1'"},
+}
+
+// generateCodefresh generates a Codefresh pipeline with a freestyle step per
+// job after a main_clone step. Steps share the pipeline volume and run in
+// order, so jobs are grouped in dependency levels and the jobs of a level
+// run in a parallel step. Gated jobs wait behind a pending-approval step.
+func (c *Converter) generateCodefresh(config *PipelineConfig) (string, error) {
+	g := &codefreshGenerator{config: config, names: make(map[string]bool)}
+
+	for _, t := range config.Triggers {
+		switch t.Type {
+		case "push":
+			if len(t.Branches) > 0 {
+				config.note("builds ran on pushes to %s; add a Git trigger to the Codefresh pipeline with a matching branch filter", strings.Join(t.Branches, ", "))
+			} else {
+				config.note("builds ran on pushes; add a Git trigger to the Codefresh pipeline")
+			}
+		case "pull_request":
+			config.note("builds ran for pull requests; add a Git trigger for pull request events to the Codefresh pipeline")
+		case "schedule":
+			config.note("add a cron trigger to the Codefresh pipeline (cron '%s')", t.Cron)
+		case "call":
+			config.approximated("workflow_call", "the pipeline is reusable; start it from other Codefresh pipelines with the codefresh-run step")
+		}
+	}
+	config.note("the main_clone step reads the repository through the Git integration named github; change git: if yours has another name")
+
+	levels, exact := buildkiteLevels(config.Jobs)
+	if !exact {
+		config.approximated("needs", "Codefresh runs steps in order, so each job waits for every job of the level before it rather than only the jobs it needs")
+	}
+	stages := make([]string, len(levels))
+	for l, level := range levels {
+		var names []string
+		for _, job := range level {
+			names = append(names, job.Name)
+		}
+		stages[l] = strings.Join(names, ", ")
+	}
+
+	pipeline := codefreshPipeline{Version: "1.0", Stages: append([]string{"clone"}, stages...)}
+	pipeline.Steps.set(codefreshCloneStep, codefreshStep{
+		Title:    "Clone repository",
+		Type:     "git-clone",
+		Stage:    "clone",
+		Repo:     "${{CF_REPO_OWNER}}/${{CF_REPO_NAME}}",
+		Revision: "${{CF_REVISION}}",
+		Git:      "github",
+	})
+	g.names[codefreshCloneStep] = true
+
+	for l, level := range levels {
+		for _, job := range level {
+			if job.Gate != nil {
+				pipeline.Steps.set(g.name(job.Name+"_approval"), g.approval(job, stages[l], len(level)))
+			}
+		}
+		if len(level) == 1 {
+			pipeline.Steps.setCommented(g.name(level[0].Name), level[0].Comment, g.step(level[0], stages[l]))
+			continue
+		}
+		parallel := codefreshParallel{Type: "parallel", Stage: stages[l]}
+		name := g.name(stages[l])
+		for _, job := range level {
+			parallel.Steps.setCommented(g.name(job.Name), job.Comment, g.step(job, ""))
+		}
+		pipeline.Steps.set(name, parallel)
+	}
+	return marshalYAML(config.Comment, pipeline)
+}
+
+// codefreshPipeline is a codefresh.yml file
+type codefreshPipeline struct {
+	Version string   `yaml:"version"`
+	Stages  []string `yaml:"stages"`
+	Steps   yamlMap  `yaml:"steps"`
+}
+
+type codefreshStep struct {
+	Title       string             `yaml:"title"`
+	Type        string             `yaml:"type"`
+	Stage       string             `yaml:"stage,omitempty"`
+	Image       string             `yaml:"image,omitempty"`
+	Repo        string             `yaml:"repo,omitempty"`
+	Revision    string             `yaml:"revision,omitempty"`
+	Git         string             `yaml:"git,omitempty"`
+	Environment []string           `yaml:"environment,omitempty"`
+	Commands    *yamlList          `yaml:"commands,omitempty"`
+	Services    *codefreshServices `yaml:"services,omitempty"`
+	When        *codefreshWhen     `yaml:"when,omitempty"`
+}
+
+type codefreshApproval struct {
+	Type  string         `yaml:"type"`
+	Title string         `yaml:"title"`
+	Stage string         `yaml:"stage"`
+	When  *codefreshWhen `yaml:"when,omitempty"`
+}
+
+type codefreshParallel struct {
+	Type  string  `yaml:"type"`
+	Stage string  `yaml:"stage"`
+	Steps yamlMap `yaml:"steps"`
+}
+
+type codefreshServices struct {
+	Composition yamlMap `yaml:"composition"`
+}
+
+type codefreshService struct {
+	Image       string   `yaml:"image"`
+	Environment []string `yaml:"environment,omitempty"`
+}
+
+type codefreshWhen struct {
+	Condition struct {
+		All struct {
+			Condition *yaml.Node `yaml:"condition"`
+		} `yaml:"all"`
+	} `yaml:"condition"`
+}
+
+type codefreshGenerator struct {
+	config *PipelineConfig
+	names  map[string]bool // step names in use
+}
+
+// name returns a unique step name for s
+func (g *codefreshGenerator) name(s string) string {
+	base := nonCodefreshChars.ReplaceAllString(s, "_")
+	name := base
+	for n := 2; g.names[name]; n++ {
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+	g.names[name] = true
+	return name
+}
+
+// approval is the pending-approval step guarding a gated job. The steps of
+// a level wait for it together.
+func (g *codefreshGenerator) approval(job Job, stage string, level int) codefreshApproval {
+	if level > 1 {
+		g.config.approximated("approval", "job '%s' waits for approval; Codefresh runs the jobs of a level together, so the approval also holds back the other jobs started with it", job.Name)
+	}
+	title := fmt.Sprintf("Run %s?", job.Name)
+	if env := job.Gate.Environment; env != "" {
+		title = fmt.Sprintf("Deploy %s to %s?", job.Name, env)
+		g.config.approximated("environment", "job '%s' used environment '%s'; a pending-approval step guards it instead", job.Name, env)
+	}
+	if len(job.Gate.Approvers) > 0 {
+		g.config.dropped("approvers", "job '%s' needs approval from %s; anyone who can run the Codefresh pipeline can approve it", job.Name, strings.Join(job.Gate.Approvers, ", "))
+	}
+	return codefreshApproval{Type: "pending-approval", Title: title, Stage: stage, When: g.when(job)}
+}
+
+// step is a job as a freestyle step; top-level steps name their stage
+func (g *codefreshGenerator) step(job Job, stage string) codefreshStep {
+	image := droneDefaultImage
+	if job.Container != nil {
+		image = job.Container.Image
+	} else {
+		g.config.approximated("runs-on", "job '%s' runs on %s; Codefresh runs steps in containers, so it uses %s", job.Name, job.RunsOn, droneDefaultImage)
+	}
+
+	step := codefreshStep{Title: job.Name, Type: "freestyle", Stage: stage, Image: image}
+
+	env := copyStrings(g.config.Environment)
+	for _, m := range []map[string]string{job.Environment, containerEnv(job)} {
+		for k, v := range m {
+			env[k] = v
+		}
+	}
+	for _, k := range sortedKeys(env) {
+		step.Environment = append(step.Environment, k+"="+codefreshValue(env[k]))
+	}
+
+	step.Commands = bitbucketScript(g.commands(job))
+
+	if len(job.Services) > 0 {
+		if usesLocalhost(job) {
+			g.config.note("job '%s' reaches its services on localhost; on Codefresh they are reachable by name (%s)", job.Name, serviceNames(job))
+		}
+		step.Services = &codefreshServices{}
+		for _, svc := range job.Services {
+			service := codefreshService{Image: svc.Image}
+			for _, k := range sortedKeys(svc.Env) {
+				service.Environment = append(service.Environment, k+"="+codefreshValue(svc.Env[k]))
+			}
+			step.Services.Composition.set(svc.Name, service)
+		}
+	}
+
+	step.When = g.when(job)
+	return step
+}
+
+// when is the condition a job, or the approval guarding it, runs on
+func (g *codefreshGenerator) when(job Job) *codefreshWhen {
+	cond := job.Condition
+	if alwaysRuns(cond) {
+		g.config.approximated("if", "job '%s' always runs on GitHub; Codefresh stops at the first failed step, so run it from hooks.on_finish if it has to run after failures", job.Name)
+		cond = strings.TrimPrefix(strings.TrimPrefix(cond, "always()"), " && ")
+	}
+	if cond == "" {
+		return nil
+	}
+	expr, ok := codefreshExpression(cond)
+	if !ok {
+		g.config.dropped("if", "job '%s' has condition '%s'; Codefresh runs it in every build", job.Name, cond)
+		return nil
+	}
+	when := &codefreshWhen{}
+	// Quoted the way Codefresh documents its conditions
+	when.Condition.All.Condition = &yaml.Node{Kind: yaml.ScalarNode, Style: yaml.DoubleQuotedStyle, Value: expr}
+	return when
+}
+
+// commands builds a job's script. Files stay on the shared volume, so
+// artifacts need no handover; job outputs are exported with cf_export.
+func (g *codefreshGenerator) commands(job Job) []string {
+	var script []string
+	if writesOutputs(job) {
+		script = append(script, "mkdir -p "+outputDir)
+	}
+	workspaceDownloads(g.config, job, "Codefresh")
+	if uploads := jobArtifacts(job); len(uploads) > 0 && !downloadedJobs(g.config)[job.Name] {
+		var names []string
+		for _, a := range uploads {
+			names = append(names, a.Name)
+		}
+		g.config.dropped("upload-artifact", "job '%s' uploads %s; Codefresh keeps no artifacts after the build, so publish them to storage", job.Name, strings.Join(names, ", "))
+	}
+
+	for _, step := range job.Steps {
+		var command string
+		switch {
+		case step.Image != "":
+			command = dockerRunCommand(step)
+			g.config.approximated("container step", "job '%s' runs %s with docker run; freestyle steps need Docker access for that, so consider a step of its own", job.Name, step.Image)
+		case step.Run != "":
+			command = shellOutputs(step.Run, step)
+		case step.Uses != "":
+			command = convertActionToCommand(step)
+		}
+		command = strings.TrimRight(command, "\n")
+		if command == "" {
+			continue
+		}
+		if len(step.Env) > 0 || step.WorkDir != "" {
+			// A subshell keeps the step's directory and variables to itself
+			lines := []string{"("}
+			for _, k := range sortedKeys(step.Env) {
+				lines = append(lines, fmt.Sprintf("export %s=%s", k, yamlScalar(step.Env[k])))
+			}
+			if step.WorkDir != "" {
+				lines = append(lines, "cd "+step.WorkDir)
+			}
+			command = strings.Join(append(append(lines, command), ")"), "\n")
+		}
+		if step.If != "" {
+			g.config.dropped("if", "step in job '%s' has condition '%s'; Codefresh runs it unconditionally", job.Name, step.If)
+		}
+		script = append(append(script, commentLines(step.Comment)...), command)
+	}
+
+	for _, out := range job.Outputs {
+		script = append(script, fmt.Sprintf(`cf_export %s="%s"`, outputVariable(job.Name, out.Name), shellOutputRefs(out.Value)))
+	}
+	if len(script) == 0 {
+		script = []string{"echo \"Nothing to run\""}
+	}
+	return script
+}
+
+// codefreshValue rewrites variable references in an environment value to
+// ${{NAME}}, which Codefresh substitutes from pipeline variables
+func codefreshValue(s string) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		return "${{" + variableName(variablePattern.FindStringSubmatch(ref)) + "}}"
+	})
+}
+
+// codefreshExpression rewrites a GitHub condition as a Codefresh condition,
+// reporting false when it has no equivalent
+func codefreshExpression(cond string) (string, bool) {
+	expr := refPrefixCondition.ReplaceAllStringFunc(cond, func(m string) string {
+		parts := refPrefixCondition.FindStringSubmatch(m)
+		return fmt.Sprintf("%smatch('${{CF_BRANCH}}', '^%s', false)", parts[1], regexp.QuoteMeta(parts[2]))
+	})
+	for _, rule := range githubCodefreshConditions {
+		expr = rule.pattern.ReplaceAllString(expr, rule.replacement)
+	}
+	if githubUnsupported.MatchString(strings.ReplaceAll(expr, "match(", "")) || sourceCondition.MatchString(expr) {
+		return "", false
+	}
+	return expr, true
+}
@@ -0,0 +1,193 @@
+package converter
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"cicli/internal/marker"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlComments looks up the comments written next to the constructs of a
+// YAML source, so they can be carried over to what those constructs become
+type yamlComments struct {
+	doc  *yaml.Node
+	root *yaml.Node
+}
+
+// parseComments reads the comments of content. A cicli marker block is not
+// carried over, since the output gets its own.
+func parseComments(content []byte) yamlComments {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(marker.Strip(string(content))), &doc); err != nil || len(doc.Content) == 0 {
+		return yamlComments{}
+	}
+	return yamlComments{doc: &doc, root: doc.Content[0]}
+}
+
+// header returns the comment at the top of the file
+func (c yamlComments) header() string {
+	if c.doc == nil {
+		return ""
+	}
+	text := c.doc.HeadComment
+	if c.root.Kind == yaml.MappingNode && len(c.root.Content) > 0 {
+		// Without a blank line, the file's comment belongs to its first key
+		text = joinComments(text, c.root.Content[0].HeadComment)
+	}
+	return cleanComment(text)
+}
+
+// at returns the comment of the entry at path, whose elements are mapping
+// keys (strings) and sequence indexes (ints): the comment lines above it and
+// the comment at the end of its line
+func (c yamlComments) at(path ...interface{}) string {
+	if len(path) == 0 {
+		return ""
+	}
+	key, node := c.lookup(path...)
+	if node == nil {
+		return ""
+	}
+
+	var text string
+	if key != nil {
+		text = joinComments(key.HeadComment, key.LineComment)
+		if key == c.root.Content[0] {
+			// Its comment lines are the file's header
+			text = key.LineComment
+		}
+	} else {
+		text = node.HeadComment
+		if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+			// A list item's comment belongs to its first key
+			first := node.Content[0]
+			text = joinComments(text, first.HeadComment, first.LineComment)
+			if value := node.Content[1]; value.Kind == yaml.ScalarNode {
+				text = joinComments(text, value.LineComment)
+			}
+		}
+	}
+	if node.Kind == yaml.ScalarNode {
+		text = joinComments(text, node.LineComment)
+	}
+	return cleanComment(text)
+}
+
+// lookup returns the node at path and, when its last element is a mapping
+// key, the key's node
+func (c yamlComments) lookup(path ...interface{}) (key, node *yaml.Node) {
+	if c.root == nil {
+		return nil, nil
+	}
+	node = c.root
+	for _, p := range path {
+		key = nil
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		switch p := p.(type) {
+		case string:
+			if node.Kind != yaml.MappingNode {
+				return nil, nil
+			}
+			var value *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == p {
+					key, value = node.Content[i], node.Content[i+1]
+					break
+				}
+			}
+			if value == nil {
+				return nil, nil
+			}
+			node = value
+		case int:
+			if node.Kind != yaml.SequenceNode || p < 0 || p >= len(node.Content) {
+				return nil, nil
+			}
+			node = node.Content[p]
+		}
+	}
+	return key, node
+}
+
+// keys returns the keys of m, decoded from the mapping at path, in the order
+// they are written there. Keys the source does not spell out, such as ones
+// from a merge, follow in sorted order.
+func (c yamlComments) keys(m map[string]interface{}, path ...interface{}) []string {
+	keys := make([]string, 0, len(m))
+	seen := make(map[string]bool)
+	if _, node := c.lookup(path...); node != nil {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				k := node.Content[i].Value
+				if _, ok := m[k]; ok && !seen[k] {
+					seen[k] = true
+					keys = append(keys, k)
+				}
+			}
+		}
+	}
+	var rest []string
+	for k := range m {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// joinComments joins the non-empty comments, one per line
+func joinComments(comments ...string) string {
+	var parts []string
+	for _, c := range comments {
+		if c != "" {
+			parts = append(parts, c)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// cleanComment strips the # markers of a comment, leaving its text
+func cleanComment(comment string) string {
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		line = strings.TrimPrefix(line, "#")
+		lines = append(lines, strings.TrimPrefix(line, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeComment writes a carried-over comment as # lines at indent
+func writeComment(sb io.StringWriter, indent, comment string) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		sb.WriteString(strings.TrimRight(indent+"# "+line, " ") + "\n")
+	}
+}
+
+// commentLines returns a comment as # lines for targets that only take a
+// list of commands
+func commentLines(comment string) []string {
+	if comment == "" {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		lines = append(lines, strings.TrimRight("# "+line, " "))
+	}
+	return lines
+}
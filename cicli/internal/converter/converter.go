@@ -1,11 +1,17 @@
 package converter
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
+	"cicli/internal/marker"
+	"cicli/internal/term"
+
 	"gopkg.in/yaml.v3"
 )
 
@@ -13,12 +19,21 @@ import (
 type Platform string
 
 const (
-	GitHub    Platform = "github"
-	GitLab    Platform = "gitlab"
-	Jenkins   Platform = "jenkins"
-	CircleCI  Platform = "circleci"
-	Azure     Platform = "azure"
-	Bitbucket Platform = "bitbucket"
+	GitHub     Platform = "github"
+	GitLab     Platform = "gitlab"
+	Jenkins    Platform = "jenkins"
+	CircleCI   Platform = "circleci"
+	Azure      Platform = "azure"
+	Bitbucket  Platform = "bitbucket"
+	Drone      Platform = "drone"
+	Woodpecker Platform = "woodpecker"
+	Buildkite  Platform = "buildkite"
+	TeamCity   Platform = "teamcity"
+	Bamboo     Platform = "bamboo"
+	Travis     Platform = "travis"
+	Harness    Platform = "harness"
+	Codefresh  Platform = "codefresh"
+	Tekton     Platform = "tekton"
 )
 
 // PipelineConfig represents a normalized pipeline configuration
@@ -27,11 +42,28 @@ type PipelineConfig struct {
 	Triggers    []Trigger         `yaml:"triggers"`
 	Environment map[string]string `yaml:"environment,omitempty"`
 	Jobs        []Job             `yaml:"jobs"`
+
+	// A reusable pipeline (workflow_call) takes inputs and secrets from its
+	// callers and can return outputs, which reference jobs.<job>.outputs
+	Inputs  []Input  `yaml:"inputs,omitempty"`
+	Secrets []Input  `yaml:"secrets,omitempty"`
+	Outputs []Output `yaml:"outputs,omitempty"`
+
+	// Variables the jobs read without the config defining them: secrets
+	// and settings the source platform injected
+	Variables []string `yaml:"variables,omitempty"`
+
+	// Comment is the comment at the top of the source file; jobs and steps
+	// carry their own. YAML targets write them back next to what they became.
+	Comment string `yaml:"comment,omitempty"`
+
+	// Findings collects what the target drops or can only approximate
+	Findings []Finding `yaml:"-"`
 }
 
 // Trigger represents what triggers the pipeline
 type Trigger struct {
-	Type     string   `yaml:"type"` // push, pull_request, schedule, manual
+	Type     string   `yaml:"type"` // push, pull_request, schedule, manual, call
 	Branches []string `yaml:"branches,omitempty"`
 	Paths    []string `yaml:"paths,omitempty"`
 	Cron     string   `yaml:"cron,omitempty"`
@@ -41,13 +73,34 @@ type Trigger struct {
 type Job struct {
 	Name        string            `yaml:"name"`
 	RunsOn      string            `yaml:"runs_on"`
+	Matrix      *Matrix           `yaml:"matrix,omitempty"`
 	DependsOn   []string          `yaml:"depends_on,omitempty"`
 	Environment map[string]string `yaml:"environment,omitempty"`
+	Container   *Container        `yaml:"container,omitempty"`
 	Services    []Service         `yaml:"services,omitempty"`
 	Steps       []Step            `yaml:"steps"`
 	Artifacts   []Artifact        `yaml:"artifacts,omitempty"`
 	Cache       []Cache           `yaml:"cache,omitempty"`
 	Condition   string            `yaml:"condition,omitempty"`
+	Gate        *Gate             `yaml:"gate,omitempty"`
+	Outputs     []Output          `yaml:"outputs,omitempty"`
+	Call        *WorkflowCall     `yaml:"call,omitempty"`  // runs a reusable workflow instead of steps
+	Stage       string            `yaml:"stage,omitempty"` // stage the source groups the job in
+	Comment     string            `yaml:"comment,omitempty"`
+}
+
+// Output is a value a job passes to the jobs that need it. Value uses the
+// GitHub expression syntax, e.g. ${{ steps.version.outputs.tag }}.
+type Output struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// Gate is a manual approval or protected environment a job waits for
+type Gate struct {
+	Environment string   `yaml:"environment,omitempty"` // deployment environment name
+	Manual      bool     `yaml:"manual,omitempty"`      // someone has to start or approve the job
+	Approvers   []string `yaml:"approvers,omitempty"`
 }
 
 // Service represents a service container
@@ -58,15 +111,26 @@ type Service struct {
 	Env   map[string]string `yaml:"env,omitempty"`
 }
 
+// Container is the image a job runs in
+type Container struct {
+	Image      string            `yaml:"image"`
+	Entrypoint string            `yaml:"entrypoint,omitempty"`
+	Env        map[string]string `yaml:"env,omitempty"`
+	Options    string            `yaml:"options,omitempty"`
+}
+
 // Step represents a pipeline step
 type Step struct {
 	Name    string            `yaml:"name"`
-	Uses    string            `yaml:"uses,omitempty"`    // For actions/plugins
-	Run     string            `yaml:"run,omitempty"`     // For shell commands
-	With    map[string]string `yaml:"with,omitempty"`    // Action inputs
+	ID      string            `yaml:"id,omitempty"`    // Referenced by steps.<id>.outputs
+	Uses    string            `yaml:"uses,omitempty"`  // For actions/plugins
+	Run     string            `yaml:"run,omitempty"`   // For shell commands
+	Image   string            `yaml:"image,omitempty"` // Run the step in this container (docker:// uses)
+	With    map[string]string `yaml:"with,omitempty"`  // Action inputs
 	Env     map[string]string `yaml:"env,omitempty"`
 	If      string            `yaml:"if,omitempty"`
 	WorkDir string            `yaml:"working_directory,omitempty"`
+	Comment string            `yaml:"comment,omitempty"`
 }
 
 // Artifact represents build artifacts
@@ -79,10 +143,15 @@ type Artifact struct {
 type Cache struct {
 	Key   string   `yaml:"key"`
 	Paths []string `yaml:"paths"`
+	Files []string `yaml:"files,omitempty"` // lock files whose hash is part of the key
 }
 
 // Converter handles pipeline conversions
-type Converter struct{}
+type Converter struct {
+	// Generator is recorded in the marker block of converted files; empty
+	// leaves them unmarked
+	Generator string
+}
 
 // NewConverter creates a new converter instance
 func NewConverter() *Converter {
@@ -91,29 +160,74 @@ func NewConverter() *Converter {
 
 // Convert converts between CI/CD platforms
 func (c *Converter) Convert(from, to Platform, inputPath, outputPath string) error {
-	// Parse input file
-	config, err := c.Parse(from, inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to parse %s config: %w", from, err)
+	if _, err := c.convertFile(from, to, inputPath, outputPath); err != nil {
+		return err
 	}
 
-	// Generate output
-	output, err := c.Generate(to, config)
+	term.Printf("✅ Converted %s → %s\n", from, to)
+	term.Printf("   Output: %s\n", outputPath)
+	return nil
+}
+
+// convertFile parses, generates and writes a single file without printing
+func (c *Converter) convertFile(from, to Platform, inputPath, outputPath string) ([]Finding, error) {
+	output, findings, err := c.RenderWithFindings(from, to, inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to generate %s config: %w", to, err)
+		return nil, err
 	}
 
 	// Write output
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return err
+		return nil, err
 	}
 	if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
-		return fmt.Errorf("failed to write output: %w", err)
+		return nil, fmt.Errorf("failed to write output: %w", err)
 	}
+	return findings, nil
+}
 
-	fmt.Printf("✅ Converted %s → %s\n", from, to)
-	fmt.Printf("   Output: %s\n", outputPath)
-	return nil
+// Render converts inputPath and returns the generated config without writing it
+func (c *Converter) Render(from, to Platform, inputPath string) (string, error) {
+	output, _, err := c.RenderWithFindings(from, to, inputPath)
+	return output, err
+}
+
+// RenderWithFindings is Render plus what the conversion dropped,
+// approximated or left for review
+func (c *Converter) RenderWithFindings(from, to Platform, inputPath string) (string, []Finding, error) {
+	// Parse input file
+	config, err := c.Parse(from, inputPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse %s config: %w", from, err)
+	}
+
+	// Generate output
+	output, err := c.Generate(to, config)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate %s config: %w", to, err)
+	}
+	if !isBuiltinPlatform(to) && !capabilities(to).NotYAML {
+		if err := checkYAML(output); err != nil {
+			return "", nil, fmt.Errorf("generated %s config is not valid YAML: %w", to, err)
+		}
+	}
+	actionPlaceholders(config, output)
+	if c.Generator != "" {
+		source, _ := os.ReadFile(inputPath)
+		comment := firstNonEmpty(capabilities(to).Comment, "#")
+		if to == Jenkins {
+			comment = "//"
+		}
+		output = marker.Stamp(output, marker.Marker{Generator: c.Generator, Template: fmt.Sprintf("convert/%s-to-%s", from, to), Analysis: marker.Hash(source)}, comment)
+	}
+	sort.SliceStable(config.Findings, func(i, j int) bool {
+		fi, fj := config.Findings[i], config.Findings[j]
+		if kindRank(fi.Kind) != kindRank(fj.Kind) {
+			return kindRank(fi.Kind) < kindRank(fj.Kind)
+		}
+		return fi.Message < fj.Message
+	})
+	return output, config.Findings, nil
 }
 
 // Parse parses a CI config file into normalized format
@@ -122,23 +236,56 @@ func (c *Converter) Parse(platform Platform, inputPath string) (*PipelineConfig,
 	if err != nil {
 		return nil, err
 	}
+	// Windows checkouts may have CRLF line endings, which the line-based
+	// Jenkinsfile and Kotlin DSL parsers would keep in commands
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
 
+	var config *PipelineConfig
 	switch platform {
 	case GitHub:
-		return c.parseGitHub(content)
+		config, err = c.parseGitHub(content, filepath.Dir(inputPath))
 	case GitLab:
-		return c.parseGitLab(content)
+		config, err = c.parseGitLab(content)
 	case CircleCI:
-		return c.parseCircleCI(content)
+		config, err = c.parseCircleCI(content)
 	case Jenkins:
-		return c.parseJenkins(content)
+		config, err = c.parseJenkins(content)
+	case Azure:
+		config, err = c.parseAzure(content, filepath.Dir(inputPath))
+	case Bitbucket:
+		config, err = c.parseBitbucket(content)
+	case Drone:
+		config, err = c.parseDrone(content, Drone, "")
+	case Woodpecker:
+		config, err = c.parseDrone(content, Woodpecker, pipelineName(inputPath))
+	case Buildkite:
+		config, err = c.parseBuildkite(content)
+	case TeamCity:
+		config, err = c.parseTeamCity(content, inputPath)
+	case Bamboo:
+		config, err = c.parseBamboo(content)
+	case Travis:
+		config, err = c.parseTravis(content, filepath.Dir(inputPath))
 	default:
-		return nil, fmt.Errorf("unsupported source platform: %s", platform)
+		config, err = parseWithDriver(platform, content, inputPath)
+	}
+	if err != nil {
+		return nil, err
 	}
+	liftCaches(config)
+	mapSourceVariables(config, platform)
+	return config, nil
 }
 
 // Generate generates a CI config from normalized format
 func (c *Converter) Generate(platform Platform, config *PipelineConfig) (string, error) {
+	noteCaches(config, platform)
+	jobs := config.Jobs
+	config.Jobs = lowerWorkflowCalls(config, platform)
+	config.Jobs = lowerMatrices(config, platform)
+	env := config.Environment
+	config.Jobs, config.Environment = lowerVariables(config, platform)
+	defer func() { config.Jobs, config.Environment = jobs, env }()
 	switch platform {
 	case GitHub:
 		return c.generateGitHub(config)
@@ -150,77 +297,182 @@ func (c *Converter) Generate(platform Platform, config *PipelineConfig) (string,
 		return c.generateAzure(config)
 	case Jenkins:
 		return c.generateJenkins(config)
+	case Bitbucket:
+		return c.generateBitbucket(config)
+	case Drone, Woodpecker:
+		return c.generateDrone(config, platform)
+	case Buildkite:
+		return c.generateBuildkite(config)
+	case Harness:
+		return c.generateHarness(config)
+	case Codefresh:
+		return c.generateCodefresh(config)
+	case Tekton:
+		return c.generateTekton(config)
 	default:
-		return "", fmt.Errorf("unsupported target platform: %s", platform)
+		return generateWithDriver(platform, config)
 	}
 }
 
-// parseGitHub parses GitHub Actions workflow
-func (c *Converter) parseGitHub(content []byte) (*PipelineConfig, error) {
+// parseGitHub parses GitHub Actions workflow read from dir
+func (c *Converter) parseGitHub(content []byte, dir string) (*PipelineConfig, error) {
+	return c.parseGitHubWorkflow(content, dir, 0)
+}
+
+// parseGitHubWorkflow parses a workflow called through depth levels of
+// reusable workflows
+func (c *Converter) parseGitHubWorkflow(content []byte, dir string, depth int) (*PipelineConfig, error) {
 	var gh map[string]interface{}
 	if err := yaml.Unmarshal(content, &gh); err != nil {
 		return nil, err
 	}
 
 	config := &PipelineConfig{
-		Name:     getString(gh, "name"),
-		Triggers: []Trigger{},
-		Jobs:     []Job{},
+		Name:        getString(gh, "name"),
+		Triggers:    []Trigger{},
+		Environment: stringValues(gh["env"]),
+		Jobs:        []Job{},
 	}
-
-	// Parse triggers
-	if on, ok := gh["on"].(map[string]interface{}); ok {
-		if push, ok := on["push"].(map[string]interface{}); ok {
-			trigger := Trigger{Type: "push"}
-			if branches, ok := push["branches"].([]interface{}); ok {
-				for _, b := range branches {
-					trigger.Branches = append(trigger.Branches, fmt.Sprint(b))
-				}
-			}
-			config.Triggers = append(config.Triggers, trigger)
+	config.dropKeys("workflow", gh, keySet("name", "on", "env", "jobs"))
+	raw := rawYAML(content)
+	comments := parseComments(content)
+	config.Comment = comments.header()
+
+	// Parse triggers, given as an event name, a list or a map
+	switch on := gh["on"].(type) {
+	case string:
+		config.Triggers = append(config.Triggers, githubTrigger(config, on, nil))
+	case []interface{}:
+		for _, event := range on {
+			config.Triggers = append(config.Triggers, githubTrigger(config, fmt.Sprint(event), nil))
 		}
-		if pr, ok := on["pull_request"].(map[string]interface{}); ok {
-			trigger := Trigger{Type: "pull_request"}
-			if branches, ok := pr["branches"].([]interface{}); ok {
-				for _, b := range branches {
-					trigger.Branches = append(trigger.Branches, fmt.Sprint(b))
+	case map[string]interface{}:
+		events := sortedKeys(stringMap(on))
+		sort.SliceStable(events, func(i, j int) bool { return events[i] == "push" && events[j] != "push" })
+		for _, event := range events {
+			if event == "workflow_call" {
+				config.Triggers = append(config.Triggers, Trigger{Type: "call"})
+				parseWorkflowCallTrigger(config, rawPath(raw, "on", event))
+				continue
+			}
+			if event == "schedule" {
+				schedules, _ := on[event].([]interface{})
+				for _, s := range schedules {
+					if sm, ok := s.(map[string]interface{}); ok {
+						config.Triggers = append(config.Triggers, Trigger{Type: "schedule", Cron: getString(sm, "cron")})
+					}
 				}
+				continue
 			}
-			config.Triggers = append(config.Triggers, trigger)
+			opts, _ := on[event].(map[string]interface{})
+			config.Triggers = append(config.Triggers, githubTrigger(config, event, opts))
 		}
 	}
+	config.Triggers = compactTriggers(config.Triggers)
 
 	// Parse jobs
 	if jobs, ok := gh["jobs"].(map[string]interface{}); ok {
-		for jobName, jobData := range jobs {
-			if jd, ok := jobData.(map[string]interface{}); ok {
+		for _, jobName := range comments.keys(jobs, "jobs") {
+			if jd, ok := jobs[jobName].(map[string]interface{}); ok {
 				job := Job{
-					Name:   jobName,
-					RunsOn: getString(jd, "runs-on"),
-					Steps:  []Step{},
+					Name:        jobName,
+					RunsOn:      getString(jd, "runs-on"),
+					Container:   parseContainer(jd["container"]),
+					Environment: stringValues(jd["env"]),
+					Condition:   strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(getString(jd, "if")), "${{"), "}}")),
+					Steps:       []Step{},
+					Comment:     comments.at("jobs", jobName),
+				}
+				where := fmt.Sprintf("job '%s'", jobName)
+
+				// A job that calls a reusable workflow has no runner or steps
+				if uses := getString(jd, "uses"); uses != "" {
+					config.dropKeys(where, jd, keySet("name", "uses", "with", "secrets", "needs", "if"))
+					job.DependsOn = githubNeeds(jd["needs"])
+					rawJob, _ := rawPath(raw, "jobs", jobName).(map[string]interface{})
+					job.Call = c.parseWorkflowCall(config, where, uses, jd, rawJob, dir, depth)
+					config.Jobs = append(config.Jobs, job)
+					continue
+				}
+				config.dropKeys(where, jd, keySet("name", "runs-on", "strategy", "container", "services", "env", "if", "environment", "needs", "outputs", "steps"))
+				if jd["runs-on"] != nil && job.RunsOn == "" {
+					job.RunsOn = "ubuntu-latest"
+					config.approximated("runs-on", "%s: runs-on labels or groups are replaced by ubuntu-latest", where)
+				}
+
+				// Matrix values are read as written, so 3.10 stays 3.10
+				if strategy, ok := jd["strategy"].(map[string]interface{}); ok {
+					config.dropKeys("strategy in "+where, strategy, keySet("matrix"))
+					job.Matrix = parseGitHubMatrix(config, where, rawPath(raw, "jobs", jobName, "strategy", "matrix"))
+				}
+
+				// Required reviewers live in the environment's settings, not the workflow
+				if env := environmentName(jd["environment"]); env != "" {
+					job.Gate = &Gate{Environment: env}
+				}
+
+				if services, ok := jd["services"].(map[string]interface{}); ok {
+					for _, name := range sortedKeys(stringMap(services)) {
+						svc := parseContainer(services[name])
+						if svc == nil {
+							continue
+						}
+						service := Service{Name: name, Image: svc.Image, Env: svc.Env}
+						if sm, ok := services[name].(map[string]interface{}); ok {
+							if ports, ok := sm["ports"].([]interface{}); ok {
+								for _, p := range ports {
+									service.Ports = append(service.Ports, fmt.Sprint(p))
+								}
+							}
+						}
+						job.Services = append(job.Services, service)
+					}
 				}
 
-				if needs, ok := jd["needs"].([]interface{}); ok {
-					for _, n := range needs {
-						job.DependsOn = append(job.DependsOn, fmt.Sprint(n))
+				job.DependsOn = githubNeeds(jd["needs"])
+
+				if outputs, ok := jd["outputs"].(map[string]interface{}); ok {
+					for name, value := range outputs {
+						job.Outputs = append(job.Outputs, Output{Name: name, Value: fmt.Sprint(value)})
 					}
+					sort.Slice(job.Outputs, func(i, j int) bool { return job.Outputs[i].Name < job.Outputs[j].Name })
 				}
 
 				if steps, ok := jd["steps"].([]interface{}); ok {
-					for _, s := range steps {
+					for i, s := range steps {
 						if sd, ok := s.(map[string]interface{}); ok {
 							step := Step{
-								Name: getString(sd, "name"),
-								Uses: getString(sd, "uses"),
-								Run:  getString(sd, "run"),
-								If:   getString(sd, "if"),
+								Name:    getString(sd, "name"),
+								ID:      getString(sd, "id"),
+								Uses:    getString(sd, "uses"),
+								Run:     getString(sd, "run"),
+								If:      getString(sd, "if"),
+								WorkDir: getString(sd, "working-directory"),
+								Comment: comments.at("jobs", jobName, "steps", i),
+							}
+							label := step.Name
+							if label == "" {
+								label = strings.SplitN(step.Uses+step.Run, "\n", 2)[0]
 							}
+							config.dropKeys(fmt.Sprintf("step '%s' in %s", label, where), sd, keySet("name", "id", "uses", "run", "if", "working-directory", "with", "env"))
 							if with, ok := sd["with"].(map[string]interface{}); ok {
 								step.With = make(map[string]string)
 								for k, v := range with {
 									step.With[k] = fmt.Sprint(v)
 								}
 							}
+							if env, ok := sd["env"].(map[string]interface{}); ok {
+								step.Env = make(map[string]string)
+								for k, v := range env {
+									step.Env[k] = fmt.Sprint(v)
+								}
+							}
+							if strings.HasPrefix(step.Uses, "docker://") {
+								step.Image = strings.TrimPrefix(step.Uses, "docker://")
+								step.Uses = ""
+								step.Run = step.With["args"]
+								delete(step.With, "args")
+							}
 							job.Steps = append(job.Steps, step)
 						}
 					}
@@ -234,6 +486,79 @@ func (c *Converter) parseGitHub(content []byte) (*PipelineConfig, error) {
 	return config, nil
 }
 
+// githubNeeds reads needs: given as a job name or a list
+func githubNeeds(v interface{}) []string {
+	switch needs := v.(type) {
+	case []interface{}:
+		var deps []string
+		for _, n := range needs {
+			deps = append(deps, fmt.Sprint(n))
+		}
+		return deps
+	case string:
+		return []string{needs}
+	}
+	return nil
+}
+
+// githubTrigger converts one on: event. Events without a normalized
+// equivalent are recorded as dropped and return an empty trigger.
+func githubTrigger(config *PipelineConfig, event string, opts map[string]interface{}) Trigger {
+	var trigger Trigger
+	switch event {
+	case "push", "pull_request":
+		trigger.Type = event
+		if branches, ok := opts["branches"].([]interface{}); ok {
+			for _, b := range branches {
+				trigger.Branches = append(trigger.Branches, fmt.Sprint(b))
+			}
+		}
+		config.dropKeys(fmt.Sprintf("%s trigger", event), opts, keySet("branches"))
+	case "workflow_call":
+		trigger.Type = "call"
+	case "workflow_dispatch":
+		trigger.Type = "manual"
+		if opts["inputs"] != nil {
+			config.dropped("workflow_dispatch.inputs", "workflow_dispatch inputs are not converted")
+		}
+	default:
+		config.dropped("on."+event, "the %s trigger is not converted", event)
+	}
+	return trigger
+}
+
+// compactTriggers removes the empty triggers of unsupported events
+func compactTriggers(triggers []Trigger) []Trigger {
+	out := []Trigger{}
+	for _, t := range triggers {
+		if t.Type != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// triggerScope describes the branches and paths a push trigger is limited to
+func triggerScope(t Trigger) string {
+	scope := "every branch"
+	if len(t.Branches) > 0 {
+		scope = strings.Join(t.Branches, ", ")
+	}
+	if len(t.Paths) > 0 {
+		scope += " changing " + strings.Join(t.Paths, ", ")
+	}
+	return scope
+}
+
+// stringValues reads a map of scalars, such as env:, or nil
+func stringValues(v interface{}) map[string]string {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	return stringMap(m)
+}
+
 // parseGitLab parses GitLab CI config
 func (c *Converter) parseGitLab(content []byte) (*PipelineConfig, error) {
 	var gl map[string]interface{}
@@ -242,61 +567,282 @@ func (c *Converter) parseGitLab(content []byte) (*PipelineConfig, error) {
 	}
 
 	config := &PipelineConfig{
-		Name:     "Pipeline",
-		Triggers: []Trigger{{Type: "push", Branches: []string{"main"}}},
-		Jobs:     []Job{},
+		Name:        "Pipeline",
+		Triggers:    []Trigger{{Type: "push", Branches: []string{"main"}}},
+		Environment: gitlabVariables(gl["variables"]),
+		Jobs:        []Job{},
+	}
+	raw := rawYAML(content)
+	comments := parseComments(content)
+	config.Comment = comments.header()
+
+	// A top-level or default image and services apply to every job
+	// without its own
+	defaultImage := parseContainer(gl["image"])
+	defaultServices := gl["services"]
+	defaultCache := gl["cache"]
+	if def, ok := gl["default"].(map[string]interface{}); ok {
+		if defaultImage == nil {
+			defaultImage = parseContainer(def["image"])
+		}
+		if defaultServices == nil {
+			defaultServices = def["services"]
+		}
+		if defaultCache == nil {
+			defaultCache = def["cache"]
+		}
+		config.dropKeys("default", def, keySet("image", "services", "cache"))
+	}
+	for _, key := range []string{"include", "workflow", "before_script", "after_script"} {
+		if gl[key] != nil {
+			config.dropped(key, "top-level '%s' is not converted", key)
+		}
+	}
+	if stages, ok := gl["stages"].([]interface{}); ok && len(stages) > 1 {
+		config.approximated("stages", "stage order is not kept; only needs: orders the converted jobs")
 	}
 
 	// Parse stages and jobs
-	for key, value := range gl {
-		// Skip reserved keywords
-		if key == "stages" || key == "variables" || key == "image" || key == "default" {
+	artifactsFrom := make(map[string][]string)
+	for _, key := range comments.keys(gl) {
+		value := gl[key]
+		// Skip reserved keywords and hidden template jobs (often anchor targets)
+		if gitlabReserved[key] || strings.HasPrefix(key, ".") {
 			continue
 		}
 
 		if jd, ok := value.(map[string]interface{}); ok {
 			job := Job{
-				Name:   key,
-				RunsOn: "ubuntu-latest",
-				Steps:  []Step{},
+				Name:        key,
+				RunsOn:      "ubuntu-latest",
+				Container:   parseContainer(jd["image"]),
+				Environment: gitlabVariables(jd["variables"]),
+				Steps:       []Step{},
+				Comment:     comments.at(key),
+			}
+			if job.Container == nil {
+				job.Container = defaultImage
+			}
+			where := fmt.Sprintf("job '%s'", key)
+			config.dropKeys(where, jd, keySet("image", "services", "variables", "stage", "when", "environment", "script", "needs", "dependencies", "rules", "parallel", "artifacts", "cache"))
+			if services, ok := jd["services"]; ok {
+				job.Services = parseGitLabServices(config, where, services)
+			} else {
+				job.Services = parseGitLabServices(config, "default", defaultServices)
+			}
+			if cache, ok := jd["cache"]; ok {
+				job.Cache = parseGitLabCache(config, where, cache)
+			} else {
+				job.Cache = parseGitLabCache(config, "default", defaultCache)
+			}
+			job.Artifacts = parseGitLabArtifacts(config, where, key, jd["artifacts"])
+
+			env := environmentName(jd["environment"])
+			when := getString(jd, "when")
+			if when == "manual" || env != "" {
+				job.Gate = &Gate{Environment: env, Manual: when == "manual"}
+			}
+			if when != "" && when != "manual" && when != "on_success" {
+				config.approximated("when", "%s: 'when: %s' is not converted; the job runs when earlier jobs succeed", where, when)
 			}
 
-			// Parse script
-			if script, ok := jd["script"].([]interface{}); ok {
-				for _, s := range script {
-					job.Steps = append(job.Steps, Step{
-						Run: fmt.Sprint(s),
-					})
+			// Parse script, a command or a list; aliases of lists nest,
+			// GitLab flattens them. Its commands become steps named after
+			// what they do
+			switch script := jd["script"].(type) {
+			case []interface{}:
+				lines := flattenScript(script)
+				var lineComments []string
+				if len(lines) == len(script) {
+					for i := range lines {
+						lineComments = append(lineComments, comments.at(key, "script", i))
+					}
 				}
+				job.Steps = append(job.Steps, groupCommands(lines, lineComments)...)
+			case string:
+				job.Steps = append(job.Steps, groupCommands([]string{script}, nil)...)
+			}
+			if stage := getString(jd, "stage"); stage != "" && stage != key {
+				job.Stage = stage
 			}
 
-			// Parse dependencies
+			// Parse dependencies, given as job names or {job: name} entries.
+			// Artifacts come from dependencies: if set, else from needs
 			if needs, ok := jd["needs"].([]interface{}); ok {
 				for _, n := range needs {
+					if nm, ok := n.(map[string]interface{}); ok {
+						job.DependsOn = append(job.DependsOn, getString(nm, "job"))
+						if nm["artifacts"] != false {
+							artifactsFrom[key] = append(artifactsFrom[key], getString(nm, "job"))
+						}
+						continue
+					}
 					job.DependsOn = append(job.DependsOn, fmt.Sprint(n))
+					artifactsFrom[key] = append(artifactsFrom[key], fmt.Sprint(n))
+				}
+			}
+			if deps, ok := jd["dependencies"].([]interface{}); ok {
+				artifactsFrom[key] = nil
+				for _, d := range deps {
+					artifactsFrom[key] = append(artifactsFrom[key], fmt.Sprint(d))
+					if !containsString(job.DependsOn, fmt.Sprint(d)) {
+						job.DependsOn = append(job.DependsOn, fmt.Sprint(d))
+					}
 				}
 			}
 
-			// Parse rules/conditions
+			// Parse rules/conditions; only the first if: carries over
 			if rules, ok := jd["rules"].([]interface{}); ok {
+				hasIf := false
 				for _, r := range rules {
-					if rd, ok := r.(map[string]interface{}); ok {
-						if ifCond, ok := rd["if"].(string); ok {
-							job.Condition = ifCond
-							break
+					rd, ok := r.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					if ifCond, ok := rd["if"].(string); ok && !hasIf {
+						hasIf = true
+						if cond, ok := githubCondition(ifCond); ok {
+							job.Condition = cond
+						} else {
+							config.dropped("rules:if", "%s: condition '%s' has no GitHub equivalent, so the job runs in every pipeline", where, ifCond)
+						}
+					}
+					for _, k := range sortedKeys(stringMap(rd)) {
+						if k != "if" {
+							config.dropped("rules:"+k, "%s: 'rules:%s' is not converted", where, k)
 						}
 					}
 				}
+				if len(rules) > 1 {
+					config.approximated("rules", "%s: only the first rule's if: is kept out of %d rules", where, len(rules))
+				}
+			}
+
+			// parallel:matrix values are variables; parallel: N has no equivalent
+			switch parallel := jd["parallel"].(type) {
+			case map[string]interface{}:
+				config.dropKeys("parallel in "+where, parallel, keySet("matrix"))
+				job.Matrix = parseGitLabMatrix(config, where, rawPath(raw, key, "parallel", "matrix"))
+				job = useMatrixRefs(job, func(name string) string { return `\$(?:\{` + name + `\}|` + name + `\b)` })
+			case nil:
+			default:
+				config.dropped("parallel", "%s: 'parallel: %v' is not converted", where, parallel)
 			}
 
 			config.Jobs = append(config.Jobs, job)
 		}
 	}
+	gitlabArtifactDownloads(config, artifactsFrom)
 
 	return config, nil
 }
 
+// gitlabVariables reads variables given as values or as {value, description}
+func gitlabVariables(v interface{}) map[string]string {
+	vars, ok := v.(map[string]interface{})
+	if !ok || len(vars) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(vars))
+	for k, val := range vars {
+		if vm, ok := val.(map[string]interface{}); ok {
+			out[k] = fmt.Sprint(vm["value"])
+			continue
+		}
+		out[k] = fmt.Sprint(val)
+	}
+	return out
+}
+
 // parseCircleCI parses CircleCI config
+// parseContainer reads a container given as an image string or as a mapping
+// (GitHub container:, GitLab image:, CircleCI docker: entries)
+func parseContainer(v interface{}) *Container {
+	switch c := v.(type) {
+	case string:
+		if c != "" {
+			return &Container{Image: c}
+		}
+	case map[string]interface{}:
+		image := getString(c, "image")
+		if image == "" {
+			image = getString(c, "name")
+		}
+		if image == "" {
+			return nil
+		}
+		container := &Container{Image: image, Options: getString(c, "options")}
+		switch ep := c["entrypoint"].(type) {
+		case string:
+			container.Entrypoint = ep
+		case []interface{}:
+			var parts []string
+			for _, p := range ep {
+				parts = append(parts, fmt.Sprint(p))
+			}
+			container.Entrypoint = strings.Join(parts, " ")
+		}
+		envKey := "env"
+		if _, ok := c["environment"]; ok {
+			envKey = "environment"
+		}
+		if env, ok := c[envKey].(map[string]interface{}); ok {
+			container.Env = make(map[string]string)
+			for k, val := range env {
+				container.Env[k] = fmt.Sprint(val)
+			}
+		}
+		return container
+	}
+	return nil
+}
+
+// dockerRunCommand runs a containerized step on platforms without per-step images
+func dockerRunCommand(step Step) string {
+	cmd := fmt.Sprintf(`docker run --rm -v "$PWD:$PWD" -w "$PWD" %s`, step.Image)
+	if step.Run != "" {
+		cmd += " " + step.Run
+	}
+	return cmd
+}
+
+// scopedCommand runs command with the step's env and working directory on
+// platforms whose script steps have neither. A subshell keeps the step's
+// directory and variables to itself.
+func scopedCommand(step Step, command string) string {
+	if len(step.Env) == 0 && step.WorkDir == "" {
+		return command
+	}
+	lines := []string{"("}
+	for _, k := range sortedKeys(step.Env) {
+		lines = append(lines, fmt.Sprintf("export %s=%s", k, yamlScalar(step.Env[k])))
+	}
+	if step.WorkDir != "" {
+		lines = append(lines, "cd "+step.WorkDir)
+	}
+	return strings.Join(append(append(lines, strings.TrimRight(command, "\n")), ")"), "\n")
+}
+
+// gitlabReserved lists top-level GitLab keywords that are not jobs
+var gitlabReserved = map[string]bool{
+	"stages": true, "variables": true, "image": true, "default": true,
+	"include": true, "workflow": true, "services": true, "cache": true,
+	"before_script": true, "after_script": true,
+}
+
+// flattenScript flattens nested script arrays the way GitLab does
+func flattenScript(script []interface{}) []string {
+	var lines []string
+	for _, s := range script {
+		if nested, ok := s.([]interface{}); ok {
+			lines = append(lines, flattenScript(nested)...)
+			continue
+		}
+		lines = append(lines, fmt.Sprint(s))
+	}
+	return lines
+}
+
 func (c *Converter) parseCircleCI(content []byte) (*PipelineConfig, error) {
 	var ci map[string]interface{}
 	if err := yaml.Unmarshal(content, &ci); err != nil {
@@ -308,58 +854,332 @@ func (c *Converter) parseCircleCI(content []byte) (*PipelineConfig, error) {
 		Triggers: []Trigger{{Type: "push"}},
 		Jobs:     []Job{},
 	}
+	config.dropKeys("config", ci, keySet("version", "jobs", "workflows", "orbs"))
+	comments := parseComments(content)
+	config.Comment = comments.header()
+	orbs, err := loadCircleCIOrbs(config, ci)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse jobs
 	if jobs, ok := ci["jobs"].(map[string]interface{}); ok {
-		for jobName, jobData := range jobs {
-			if jd, ok := jobData.(map[string]interface{}); ok {
+		for _, jobName := range comments.keys(jobs, "jobs") {
+			if jd, ok := jobs[jobName].(map[string]interface{}); ok {
 				job := Job{
-					Name:   jobName,
-					RunsOn: "ubuntu-latest",
-					Steps:  []Step{},
+					Name:        jobName,
+					RunsOn:      "ubuntu-latest",
+					Environment: stringValues(jd["environment"]),
+					Steps:       []Step{},
+					Comment:     comments.at("jobs", jobName),
 				}
+				where := fmt.Sprintf("job '%s'", jobName)
+				config.dropKeys(where, jd, keySet("docker", "environment", "parameters", "steps"))
 
-				// Parse docker executor
+				// Parse docker executor; the first image is the primary
+				// container and the others run as services
 				if docker, ok := jd["docker"].([]interface{}); ok {
 					if len(docker) > 0 {
-						if d, ok := docker[0].(map[string]interface{}); ok {
-							if image, ok := d["image"].(string); ok {
-								job.RunsOn = image
+						job.Container = parseContainer(docker[0])
+					}
+					for _, d := range docker[1:] {
+						if svc := parseContainer(d); svc != nil {
+							name := serviceAlias(svc.Image)
+							if dm, ok := d.(map[string]interface{}); ok && getString(dm, "name") != "" {
+								// name: makes the container reachable by that host name
+								name = getString(dm, "name")
 							}
+							job.Services = append(job.Services, Service{Name: name, Image: svc.Image, Env: svc.Env})
 						}
 					}
 				}
 
 				// Parse steps
+				restores := false
 				if steps, ok := jd["steps"].([]interface{}); ok {
-					for _, s := range steps {
-						switch st := s.(type) {
-						case string:
-							if st == "checkout" {
-								job.Steps = append(job.Steps, Step{
-									Name: "Checkout",
-									Uses: "actions/checkout@v4",
-								})
-							}
-						case map[string]interface{}:
-							if run, ok := st["run"].(map[string]interface{}); ok {
-								job.Steps = append(job.Steps, Step{
-									Name: getString(run, "name"),
-									Run:  getString(run, "command"),
-								})
-							}
+					for i, s := range steps {
+						if sm, ok := s.(map[string]interface{}); ok && sm["restore_cache"] != nil {
+							restores = true
+						}
+						if circleCIWorkspaceStep(config, &job, s) {
+							continue
 						}
+						converted := circleCISteps(config, orbs, where, s)
+						if len(converted) > 0 {
+							converted[0].Comment = comments.at("jobs", jobName, "steps", i)
+						}
+						job.Steps = append(job.Steps, converted...)
 					}
 				}
+				if restores && len(job.Cache) == 0 {
+					config.approximated("restore_cache", "%s restores a cache it does not save; converted caches are restored only by the jobs that save them", where)
+				}
 
 				config.Jobs = append(config.Jobs, job)
 			}
 		}
 	}
 
+	raw := rawYAML(content)
+	parseCircleCIWorkflows(raw, config, orbs)
+	circleCIWorkspaces(config)
+	circleCIParameterDefaults(raw, config)
 	return config, nil
 }
 
+// circleCISteps expands orb commands that have a translation and converts
+// the other steps with circleCIStep
+func circleCISteps(config *PipelineConfig, orbs *circleCIOrbs, where string, s interface{}) []Step {
+	ref, params := "", map[string]string(nil)
+	switch st := s.(type) {
+	case string:
+		ref = st
+	case map[string]interface{}:
+		if len(st) == 1 {
+			for key, v := range st {
+				ref, params = key, orbParameters(v, nil)
+			}
+		}
+	}
+	if steps, ok := orbs.expand(ref, params); ok {
+		config.approximated("orbs", "%s: orb command %s is expanded into equivalent steps", where, ref)
+		return steps
+	}
+
+	if step, ok := circleCIStep(config, where, s); ok {
+		return []Step{step}
+	}
+	return nil
+}
+
+// circleCIStep converts checkout, run and store_artifacts steps and records
+// the others, such as orb commands and caches, as dropped
+func circleCIStep(config *PipelineConfig, where string, s interface{}) (Step, bool) {
+	switch st := s.(type) {
+	case string:
+		if st == "checkout" {
+			return Step{Name: "Checkout", Uses: "actions/checkout@v4"}, true
+		}
+		circleCIDropStep(config, where, st)
+	case map[string]interface{}:
+		for _, key := range sortedKeys(stringMap(st)) {
+			switch key {
+			case "run":
+				// run: is a command or a map with a command
+				if command, ok := st["run"].(string); ok {
+					return Step{Run: command}, true
+				}
+				run, _ := st["run"].(map[string]interface{})
+				config.dropKeys("run step in "+where, run, keySet("name", "command", "environment", "working_directory"))
+				return Step{
+					Name:    getString(run, "name"),
+					Run:     getString(run, "command"),
+					Env:     stringValues(run["environment"]),
+					WorkDir: getString(run, "working_directory"),
+				}, true
+			case "store_artifacts":
+				opts, _ := st[key].(map[string]interface{})
+				name := getString(opts, "destination")
+				if name == "" {
+					name = "artifacts"
+				}
+				return Step{Uses: "actions/upload-artifact@v4", With: map[string]string{"name": name, "path": getString(opts, "path")}}, true
+			default:
+				circleCIDropStep(config, where, key)
+			}
+		}
+	}
+	return Step{}, false
+}
+
+func circleCIDropStep(config *PipelineConfig, where, name string) {
+	if strings.Contains(name, "/") {
+		config.dropped("orbs", "%s: orb command %s is not converted; add a translation to %s", where, name, OrbMappingFile)
+		return
+	}
+	config.dropped(name, "%s: '%s' step is not converted", where, name)
+}
+
+// parseCircleCIWorkflows reads requires: dependencies and matrices, turns
+// type: approval hold jobs into gates on the jobs that require them and adds
+// the orb jobs that have a translation
+func parseCircleCIWorkflows(ci map[string]interface{}, config *PipelineConfig, orbs *circleCIOrbs) {
+	workflows, ok := ci["workflows"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	defined := make(map[string]bool)
+	for _, job := range config.Jobs {
+		defined[job.Name] = true
+	}
+	var names []string
+	for name, wf := range workflows {
+		if _, ok := wf.(map[string]interface{}); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 1 {
+		sort.Strings(names)
+		config.approximated("workflows", "workflows %s are merged into one pipeline", strings.Join(names, ", "))
+	}
+
+	requires := make(map[string][]string)
+	approvals := make(map[string]bool)
+	matrices := make(map[string]*Matrix)
+	renamed := make(map[string]string) // orb job reference -> job name
+
+	// orbJob adds the job an orb job expands to, named after its name:
+	// option or its reference (node/test becomes node-test)
+	orbJob := func(where, ref string, od map[string]interface{}) bool {
+		workflowKeys := keySet("type", "requires", "matrix", "name", "context", "filters")
+		steps, ok := orbs.expand(ref, orbParameters(od, workflowKeys))
+		if !ok {
+			return false
+		}
+		name := getString(od, "name")
+		if name == "" {
+			name = strings.ReplaceAll(ref, "/", "-")
+		}
+		renamed[ref] = name
+		if !defined[name] {
+			defined[name] = true
+			config.Jobs = append(config.Jobs, Job{Name: name, RunsOn: "ubuntu-latest", Steps: steps})
+			config.approximated("orbs", "%s runs orb job %s, which is expanded into job '%s'", where, ref, name)
+		}
+		return true
+	}
+	for wfName, wf := range workflows {
+		wd, ok := wf.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		where := fmt.Sprintf("workflow '%s'", wfName)
+		config.dropKeys(where, wd, keySet("jobs"))
+		jobs, _ := wd["jobs"].([]interface{})
+		for _, entry := range jobs {
+			em, ok := entry.(map[string]interface{})
+			if !ok {
+				if name := fmt.Sprint(entry); !defined[name] && !orbJob(where, name, nil) {
+					config.dropped("orbs", "%s runs job %s, which comes from an orb and is not converted", where, name)
+				}
+				continue
+			}
+			for name, opts := range em {
+				od, _ := opts.(map[string]interface{})
+				jobWhere := fmt.Sprintf("%s, job '%s'", where, name)
+				if getString(od, "type") == "approval" {
+					approvals[name] = true
+				} else if !defined[name] && orbJob(where, name, od) {
+					// The other options are the orb job's parameters
+					name = renamed[name]
+					jobWhere = fmt.Sprintf("%s, job '%s'", where, name)
+					od = map[string]interface{}{"requires": od["requires"], "matrix": od["matrix"], "context": od["context"], "filters": od["filters"]}
+					for key, v := range od {
+						if v == nil {
+							delete(od, key)
+						}
+					}
+				} else if !defined[name] {
+					config.dropped("orbs", "%s runs job %s, which comes from an orb and is not converted", where, name)
+				}
+				config.dropKeys(jobWhere, od, keySet("type", "requires", "matrix"))
+				if m := parseCircleCIMatrix(config, jobWhere, od["matrix"]); m != nil && matrices[name] == nil {
+					matrices[name] = m
+				}
+				if reqs, ok := od["requires"].([]interface{}); ok {
+					for _, r := range reqs {
+						requires[name] = append(requires[name], fmt.Sprint(r))
+					}
+				}
+			}
+		}
+	}
+
+	for i := range config.Jobs {
+		job := &config.Jobs[i]
+		if m := matrices[job.Name]; m != nil {
+			job.Matrix = m
+			*job = useMatrixRefs(*job, func(name string) string { return `<<\s*parameters\.` + name + `\s*>>` })
+		}
+		for _, dep := range requires[job.Name] {
+			if approvals[dep] {
+				job.Gate = &Gate{Manual: true}
+				// Inherit whatever the approval job itself waited for
+				for _, inherited := range requires[dep] {
+					job.DependsOn = append(job.DependsOn, orDefault(renamed[inherited], inherited))
+				}
+				continue
+			}
+			job.DependsOn = append(job.DependsOn, orDefault(renamed[dep], dep))
+		}
+	}
+
+	// Orb jobs were appended; move them ahead of the jobs that need them
+	if len(renamed) > 0 {
+		config.Jobs = droneJobOrder(config.Jobs)
+	}
+}
+
+// circleCIParameterDefaults substitutes the defaults of job parameters no
+// matrix sets. Parameters without a default are passed by the workflow and
+// are reported.
+func circleCIParameterDefaults(ci map[string]interface{}, config *PipelineConfig) {
+	for i := range config.Jobs {
+		job := &config.Jobs[i]
+		params, _ := rawPath(ci, "jobs", job.Name, "parameters").(map[string]interface{})
+		for _, name := range sortedKeys(stringMap(params)) {
+			if job.Matrix != nil && job.Matrix.Axes[name] != nil {
+				continue
+			}
+			def, ok := rawPath(params, name, "default").(string)
+			if !ok {
+				config.dropped("parameters", "job '%s': parameter '%s' has no default and is not converted", job.Name, name)
+				continue
+			}
+			ref := regexp.MustCompile(`<<\s*parameters\.` + regexp.QuoteMeta(name) + `\s*>>`)
+			*job = mapJobStrings(*job, func(s string) string { return ref.ReplaceAllLiteralString(s, def) })
+		}
+	}
+}
+
+// environmentName reads an environment given as a string or as {name: ...}
+func environmentName(v interface{}) string {
+	switch e := v.(type) {
+	case string:
+		return e
+	case map[string]interface{}:
+		return getString(e, "name")
+	}
+	return ""
+}
+
+var (
+	inputPattern     = regexp.MustCompile(`(?m)^\s*input\s*[({]`)
+	submitterPattern = regexp.MustCompile(`submitter\s*[:]?\s*['"]([^'"]+)['"]`)
+	stagePattern     = regexp.MustCompile(`stage\s*\(['"]([^'"]+)['"]\)`)
+)
+
+// jenkinsDirectives are declarative blocks and steps the basic Jenkinsfile
+// parser does not convert
+var jenkinsDirectives = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"agent", regexp.MustCompile(`agent\s*\{\s*(docker|dockerfile|kubernetes|label|node)\b`)},
+	{"environment", regexp.MustCompile(`(?m)^\s*environment\s*\{`)},
+	{"options", regexp.MustCompile(`(?m)^\s*options\s*\{`)},
+	{"parameters", regexp.MustCompile(`(?m)^\s*parameters\s*\{`)},
+	{"triggers", regexp.MustCompile(`(?m)^\s*triggers\s*\{`)},
+	{"tools", regexp.MustCompile(`(?m)^\s*tools\s*\{`)},
+	{"when", regexp.MustCompile(`(?m)^\s*when\s*\{`)},
+	{"parallel", regexp.MustCompile(`(?m)^\s*parallel\s*[{(]`)},
+	{"post", regexp.MustCompile(`(?m)^\s*post\s*\{`)},
+	{"script", regexp.MustCompile(`(?m)^\s*script\s*\{`)},
+	{"withCredentials", regexp.MustCompile(`\bwithCredentials\s*\(`)},
+	{"bat", regexp.MustCompile(`(?m)^\s*bat[\s(]`)},
+}
+
 // parseJenkins parses Jenkinsfile (basic support)
 func (c *Converter) parseJenkins(content []byte) (*PipelineConfig, error) {
 	// Jenkins uses Groovy DSL, so we do basic pattern matching
@@ -371,9 +1191,22 @@ func (c *Converter) parseJenkins(content []byte) (*PipelineConfig, error) {
 		Jobs:     []Job{},
 	}
 
-	// Extract stages
-	stagePattern := `stage\s*\(['"]([^'"]+)['"]\)`
 	// This is simplified - real Jenkins parsing would need a proper parser
+	var stages []string
+	for _, m := range stagePattern.FindAllStringSubmatch(contentStr, -1) {
+		stages = append(stages, m[1])
+	}
+	if len(stages) > 1 {
+		config.approximated("stages", "stages %s are merged into one job", strings.Join(stages, ", "))
+	}
+	for _, d := range jenkinsDirectives {
+		if d.pattern.MatchString(contentStr) {
+			config.dropped(d.name, "'%s' is not converted", d.name)
+		}
+	}
+	if strings.Contains(contentStr, "'''") || strings.Contains(contentStr, `"""`) {
+		config.approximated("sh", "multi-line sh scripts are converted line by line; check the commands")
+	}
 
 	job := Job{
 		Name:   "build",
@@ -397,65 +1230,172 @@ func (c *Converter) parseJenkins(content []byte) (*PipelineConfig, error) {
 			Name: "Build",
 			Run:  "echo 'Converted from Jenkins - please review'",
 		})
+		config.dropped("sh", "no sh steps were found; the job only echoes a placeholder")
+	}
+
+	// input directives/steps pause the pipeline for a person to confirm
+	if inputPattern.MatchString(contentStr) {
+		job.Gate = &Gate{Manual: true}
+		if m := submitterPattern.FindStringSubmatch(contentStr); m != nil {
+			for _, who := range strings.Split(m[1], ",") {
+				if who = strings.TrimSpace(who); who != "" {
+					job.Gate.Approvers = append(job.Gate.Approvers, who)
+				}
+			}
+		}
 	}
 
-	_ = stagePattern // Suppress unused variable warning
 	config.Jobs = append(config.Jobs, job)
 	return config, nil
 }
 
-// generateGitHub generates GitHub Actions workflow
-func (c *Converter) generateGitHub(config *PipelineConfig) (string, error) {
-	var sb strings.Builder
+// githubWorkflow is a GitHub Actions workflow file
+type githubWorkflow struct {
+	Name string            `yaml:"name"`
+	On   yamlMap           `yaml:"on"`
+	Env  map[string]string `yaml:"env,omitempty"`
+	Jobs yamlMap           `yaml:"jobs"`
+}
 
-	sb.WriteString(fmt.Sprintf("name: %s\n\n", config.Name))
+type githubBranches struct {
+	Branches []string `yaml:"branches,omitempty"`
+}
 
-	// Generate triggers
-	sb.WriteString("on:\n")
-	for _, trigger := range config.Triggers {
-		switch trigger.Type {
-		case "push":
-			sb.WriteString("  push:\n")
-			if len(trigger.Branches) > 0 {
-				sb.WriteString("    branches:\n")
-				for _, b := range trigger.Branches {
-					sb.WriteString(fmt.Sprintf("      - %s\n", b))
-				}
-			}
-		case "pull_request":
-			sb.WriteString("  pull_request:\n")
+type githubSchedule struct {
+	Cron string `yaml:"cron"`
+}
+
+type githubJob struct {
+	Name        string            `yaml:"name,omitempty"`
+	RunsOn      string            `yaml:"runs-on"`
+	Strategy    *githubStrategy   `yaml:"strategy,omitempty"`
+	Container   interface{}       `yaml:"container,omitempty"` // the image, or a githubContainer
+	Services    yamlMap           `yaml:"services,omitempty"`
+	Needs       []string          `yaml:"needs,omitempty"`
+	If          string            `yaml:"if,omitempty"`
+	Environment interface{}       `yaml:"environment,omitempty"`
+	Outputs     yamlMap           `yaml:"outputs,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty"`
+	Steps       []githubStep      `yaml:"steps"`
+}
+
+type githubStrategy struct {
+	Matrix yamlMap `yaml:"matrix"`
+}
+
+type githubContainer struct {
+	Image   string            `yaml:"image"`
+	Options string            `yaml:"options,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+}
+
+type githubService struct {
+	Image string            `yaml:"image"`
+	Env   map[string]string `yaml:"env,omitempty"`
+	Ports []string          `yaml:"ports,omitempty"`
+}
+
+type githubStep struct {
+	carried
+	Name    string            `yaml:"name,omitempty"`
+	ID      string            `yaml:"id,omitempty"`
+	Uses    string            `yaml:"uses,omitempty"`
+	With    interface{}       `yaml:"with,omitempty"`
+	Run     string            `yaml:"run,omitempty"`
+	If      string            `yaml:"if,omitempty"`
+	WorkDir string            `yaml:"working-directory,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+}
+
+// generateGitHub generates GitHub Actions workflow
+func (c *Converter) generateGitHub(config *PipelineConfig) (string, error) {
+	wf := githubWorkflow{Name: config.Name, Env: config.Environment}
+
+	// Generate triggers
+	for _, trigger := range config.Triggers {
+		switch trigger.Type {
+		case "push", "pull_request":
 			if len(trigger.Branches) > 0 {
-				sb.WriteString("    branches:\n")
-				for _, b := range trigger.Branches {
-					sb.WriteString(fmt.Sprintf("      - %s\n", b))
-				}
+				wf.On.set(trigger.Type, githubBranches{Branches: trigger.Branches})
+			} else {
+				wf.On.set(trigger.Type, emptyValue{})
 			}
 		case "schedule":
-			sb.WriteString("  schedule:\n")
-			sb.WriteString(fmt.Sprintf("    - cron: '%s'\n", trigger.Cron))
+			wf.On.set("schedule", []githubSchedule{{Cron: trigger.Cron}})
+		case "manual":
+			wf.On.set("workflow_dispatch", emptyValue{})
+		case "call":
+			wf.On.set("workflow_call", githubWorkflowCallTrigger(config))
 		}
 	}
 
-	sb.WriteString("\njobs:\n")
-
 	// Generate jobs
 	for _, job := range config.Jobs {
-		sb.WriteString(fmt.Sprintf("  %s:\n", sanitizeName(job.Name)))
-		sb.WriteString(fmt.Sprintf("    runs-on: %s\n", job.RunsOn))
+		if job.Call != nil {
+			wf.Jobs.setCommented(sanitizeName(job.Name), job.Comment, githubCall(job))
+			continue
+		}
+		gj := githubJob{RunsOn: job.RunsOn, If: job.Condition, Env: job.Environment}
+		if job.Stage != "" {
+			// GitHub has no stages; the job's name keeps the one it was in
+			gj.Name = job.Stage + " / " + job.Name
+		}
 
-		if len(job.DependsOn) > 0 {
-			sb.WriteString("    needs:\n")
-			for _, dep := range job.DependsOn {
-				sb.WriteString(fmt.Sprintf("      - %s\n", dep))
+		if job.Matrix != nil {
+			var matrix yamlMap
+			for _, name := range job.Matrix.axisNames() {
+				matrix.set(name, flowSeq(job.Matrix.Axes[name], false))
+			}
+			if len(job.Matrix.Include) > 0 {
+				matrix.set("include", matrixList(job.Matrix.Include, false))
 			}
+			if len(job.Matrix.Exclude) > 0 {
+				matrix.set("exclude", matrixList(job.Matrix.Exclude, false))
+			}
+			gj.Strategy = &githubStrategy{Matrix: matrix}
 		}
 
-		if job.Condition != "" {
-			sb.WriteString(fmt.Sprintf("    if: %s\n", convertCondition(job.Condition, GitHub)))
+		if job.Container != nil {
+			if job.Container.Entrypoint == "" && job.Container.Options == "" && len(job.Container.Env) == 0 {
+				gj.Container = job.Container.Image
+			} else {
+				options := job.Container.Options
+				if job.Container.Entrypoint != "" {
+					options = strings.TrimSpace(fmt.Sprintf("--entrypoint %s %s", job.Container.Entrypoint, options))
+				}
+				gj.Container = githubContainer{Image: job.Container.Image, Options: options, Env: job.Container.Env}
+			}
+		}
+
+		if len(job.Services) > 0 {
+			if job.Container != nil {
+				config.note("job '%s' runs in a container, so its services are reachable by service name rather than localhost", job.Name)
+			}
+			for _, svc := range job.Services {
+				gj.Services.set(sanitizeName(svc.Name), githubService{Image: svc.Image, Env: svc.Env, Ports: publishedPorts(config, job, svc)})
+			}
+		}
+
+		gj.Needs = sanitizeNames(job.DependsOn)
+
+		if job.Gate != nil {
+			env := job.Gate.Environment
+			if env == "" {
+				env = sanitizeName(job.Name) + "-approval"
+			}
+			gj.Environment = env
+			if job.Gate.Manual {
+				// GitHub cannot start a single job by hand; a protected environment
+				// with required reviewers pauses the job until someone approves it
+				gj.Environment = commented{Comment: "Manual gate: add required reviewers to this environment in the repository settings", Value: env}
+				config.approximated("manual", "job '%s' is manual; approximated with environment '%s', which needs required reviewers configured in GitHub", job.Name, env)
+			}
+		}
+
+		for _, out := range job.Outputs {
+			gj.Outputs.set(out.Name, out.Value)
 		}
 
-		sb.WriteString("    steps:\n")
-		
 		// Always add checkout first if not present
 		hasCheckout := false
 		for _, step := range job.Steps {
@@ -464,184 +1404,735 @@ func (c *Converter) generateGitHub(config *PipelineConfig) (string, error) {
 				break
 			}
 		}
+		// Caches are restored right after checkout
 		if !hasCheckout {
-			sb.WriteString("      - uses: actions/checkout@v4\n")
+			gj.Steps = append(gj.Steps, githubStep{Uses: "actions/checkout@v4"})
+			for _, cache := range job.Cache {
+				gj.Steps = append(gj.Steps, githubCacheStep(cache))
+			}
 		}
 
 		for _, step := range job.Steps {
-			if step.Name != "" {
-				sb.WriteString(fmt.Sprintf("      - name: %s\n", step.Name))
-			} else {
-				sb.WriteString("      -")
-			}
-
-			if step.Uses != "" {
-				if step.Name != "" {
-					sb.WriteString(fmt.Sprintf("        uses: %s\n", step.Uses))
-				} else {
-					sb.WriteString(fmt.Sprintf(" uses: %s\n", step.Uses))
+			gs := githubStep{carried: carried{step.Comment}, Name: step.Name, ID: step.ID, If: step.If, Env: step.Env}
+			if step.Image != "" {
+				gs.Uses = "docker://" + step.Image
+				if step.Run != "" || len(step.With) > 0 {
+					with := copyStrings(step.With)
+					if step.Run != "" {
+						if with == nil {
+							with = make(map[string]string)
+						}
+						with["args"] = step.Run
+					}
+					gs.With = with
 				}
+			} else if step.Uses != "" {
+				gs.Uses = step.Uses
 				if len(step.With) > 0 {
-					sb.WriteString("        with:\n")
-					for k, v := range step.With {
-						sb.WriteString(fmt.Sprintf("          %s: %s\n", k, v))
-					}
+					gs.With = step.With
 				}
 			} else if step.Run != "" {
-				if step.Name != "" {
-					sb.WriteString(fmt.Sprintf("        run: %s\n", step.Run))
-				} else {
-					sb.WriteString(fmt.Sprintf(" run: %s\n", step.Run))
-				}
+				gs.Run = step.Run
+				gs.WorkDir = step.WorkDir
 			}
-
-			if step.If != "" {
-				sb.WriteString(fmt.Sprintf("        if: %s\n", step.If))
+			if gs.Name != "" || gs.Uses != "" || gs.Run != "" {
+				gj.Steps = append(gj.Steps, gs)
+			}
+			if strings.Contains(step.Uses, "checkout") && hasCheckout {
+				for _, cache := range job.Cache {
+					gj.Steps = append(gj.Steps, githubCacheStep(cache))
+				}
+				hasCheckout = false
 			}
 		}
+		for _, a := range job.Artifacts {
+			gj.Steps = append(gj.Steps, githubStep{Uses: uploadArtifact, With: map[string]string{"name": a.Name, "path": strings.Join(a.Paths, "\n")}})
+		}
+		wf.Jobs.setCommented(sanitizeName(job.Name), job.Comment, gj)
 	}
 
-	return sb.String(), nil
+	return marshalYAML(config.Comment, wf)
+}
+
+// gitlabConfig is a GitLab CI config file
+type gitlabConfig struct {
+	Stages    []string          `yaml:"stages"`
+	Variables map[string]string `yaml:"variables,omitempty"`
+	Jobs      yamlMap           `yaml:",inline"`
+}
+
+type gitlabJob struct {
+	Stage       string            `yaml:"stage"`
+	Image       interface{}       `yaml:"image,omitempty"` // the image, or a gitlabImage
+	Variables   map[string]string `yaml:"variables,omitempty"`
+	Services    []interface{}     `yaml:"services,omitempty"`
+	Cache       []gitlabCache     `yaml:"cache,omitempty"`
+	Parallel    *gitlabParallel   `yaml:"parallel,omitempty"`
+	Needs       []string          `yaml:"needs,omitempty"`
+	Rules       []gitlabRule      `yaml:"rules,omitempty"`
+	Trigger     *gitlabTrigger    `yaml:"trigger,omitempty"`
+	Environment string            `yaml:"environment,omitempty"`
+	When        string            `yaml:"when,omitempty"`
+	Script      *yamlList         `yaml:"script,omitempty"`
+	AfterScript *yamlList         `yaml:"after_script,omitempty"`
+	Artifacts   *gitlabArtifacts  `yaml:"artifacts,omitempty"`
+}
+
+type gitlabImage struct {
+	Name       string     `yaml:"name"`
+	Entrypoint *yaml.Node `yaml:"entrypoint"`
+}
+
+type gitlabParallel struct {
+	Matrix []yamlMap `yaml:"matrix"`
+}
+
+type gitlabRule struct {
+	If string `yaml:"if"`
+}
+
+type gitlabArtifacts struct {
+	Paths   []string          `yaml:"paths,omitempty"`
+	Reports map[string]string `yaml:"reports,omitempty"`
 }
 
 // generateGitLab generates GitLab CI config
 func (c *Converter) generateGitLab(config *PipelineConfig) (string, error) {
-	var sb strings.Builder
+	for _, t := range config.Triggers {
+		switch t.Type {
+		case "push":
+			if len(t.Branches) > 0 || len(t.Paths) > 0 {
+				config.approximated("push", "builds ran on pushes to %s; GitLab runs the pipeline for every push unless workflow: rules filter it", triggerScope(t))
+			}
+		case "pull_request":
+			config.approximated("pull_request", "builds ran for pull requests; GitLab runs merge request pipelines only for jobs with a rule matching $CI_PIPELINE_SOURCE == 'merge_request_event'")
+		case "schedule":
+			config.note("create a pipeline schedule in GitLab (cron '%s')", t.Cron)
+		case "manual":
+			config.note("builds could be started by hand; run the pipeline from Build > Pipelines in GitLab")
+		case "call":
+			config.approximated("workflow_call", "the pipeline is reusable; include it in other GitLab pipelines or start it with a trigger job")
+		}
+	}
 
-	// Generate stages
-	sb.WriteString("stages:\n")
+	gl := gitlabConfig{Stages: []string{}, Variables: config.Environment}
 	for _, job := range config.Jobs {
-		sb.WriteString(fmt.Sprintf("  - %s\n", sanitizeName(job.Name)))
+		gl.Stages = append(gl.Stages, sanitizeName(job.Name))
 	}
-	sb.WriteString("\n")
 
-	// Generate jobs
 	for _, job := range config.Jobs {
-		sb.WriteString(fmt.Sprintf("%s:\n", sanitizeName(job.Name)))
-		sb.WriteString(fmt.Sprintf("  stage: %s\n", sanitizeName(job.Name)))
-
-		if len(job.DependsOn) > 0 {
-			sb.WriteString("  needs:\n")
-			for _, dep := range job.DependsOn {
-				sb.WriteString(fmt.Sprintf("    - %s\n", dep))
+		gj := gitlabJob{Stage: sanitizeName(job.Name)}
+		if job.Container != nil {
+			gj.Image = job.Container.Image
+			if job.Container.Entrypoint != "" {
+				gj.Image = gitlabImage{Name: job.Container.Image, Entrypoint: flowSeq([]string{job.Container.Entrypoint}, false)}
+			}
+			gj.Variables = job.Container.Env
+		}
+		gj.Services = gitlabServices(config, job)
+		gj.Cache = gitlabCaches(config, job)
+
+		if job.Matrix != nil {
+			// One group multiplies the axes out; include and exclude need one
+			// group per combination
+			groups := []map[string][]string{job.Matrix.Axes}
+			if len(job.Matrix.Include) > 0 || len(job.Matrix.Exclude) > 0 {
+				groups = nil
+				for _, combo := range job.Matrix.Combinations() {
+					group := make(map[string][]string, len(combo))
+					for k, v := range combo {
+						group[k] = []string{v}
+					}
+					groups = append(groups, group)
+				}
+			}
+			gj.Parallel = &gitlabParallel{}
+			for _, group := range groups {
+				var entry yamlMap
+				for _, name := range (&Matrix{Axes: group}).axisNames() {
+					value := flowSeq(group[name], true)
+					if len(group[name]) == 1 {
+						value = keptScalar(group[name][0], true)
+					}
+					entry.set(matrixVariable(name), value)
+				}
+				gj.Parallel.Matrix = append(gj.Parallel.Matrix, entry)
 			}
 		}
 
+		gj.Needs = sanitizeNames(job.DependsOn)
+
 		if job.Condition != "" {
-			sb.WriteString("  rules:\n")
-			sb.WriteString(fmt.Sprintf("    - if: %s\n", convertCondition(job.Condition, GitLab)))
+			if expr, ok := gitlabExpression(job.Condition); ok {
+				gj.Rules = []gitlabRule{{If: expr}}
+			} else {
+				config.dropped("if", "job '%s' has condition '%s'; GitLab runs it in every pipeline", job.Name, job.Condition)
+			}
+		}
+
+		if job.Call != nil {
+			gj.Trigger = gitlabCall(config, job)
+			gl.Jobs.setCommented(sanitizeName(job.Name), job.Comment, gj)
+			continue
 		}
 
-		sb.WriteString("  script:\n")
+		if job.Gate != nil {
+			gj.Environment = job.Gate.Environment
+			if job.Gate.Manual {
+				gj.When = "manual"
+			} else {
+				config.note("job '%s' deploys to '%s'; configure deployment approvals on the protected environment in GitLab if the source required reviewers", job.Name, job.Gate.Environment)
+			}
+		}
+
+		workspaceDownloads(config, job, "GitLab")
+		gj.Script = &yamlList{}
+		if writesOutputs(job) {
+			gj.Script.add(fmt.Sprintf("mkdir -p %s", outputDir))
+		}
 		for _, step := range job.Steps {
-			if step.Run != "" {
-				sb.WriteString(fmt.Sprintf("    - %s\n", step.Run))
+			// after_script runs whether or not the script failed
+			script := gj.Script
+			switch step.If {
+			case "":
+			case "always()":
+				if gj.AfterScript == nil {
+					gj.AfterScript = &yamlList{}
+				}
+				script = gj.AfterScript
+			default:
+				config.dropped("if", "step in job '%s' has condition '%s'; GitLab runs it unconditionally", job.Name, step.If)
+			}
+
+			script.comment(step.Comment)
+			var command string
+			if step.Image != "" {
+				// GitLab has no per-step images; needs a docker:dind service
+				command = dockerRunCommand(step)
+			} else if step.Run != "" {
+				command = convertRunnerVariables(shellOutputs(step.Run, step), GitLab)
 			} else if step.Uses != "" {
-				// Convert common actions to commands
-				cmd := convertActionToCommand(step)
-				if cmd != "" {
-					sb.WriteString(fmt.Sprintf("    - %s\n", cmd))
+				// Convert common actions to commands; some only leave a note
+				command = convertActionToCommand(step)
+				if strings.HasPrefix(command, "#") {
+					script.comment(cleanComment(command))
+					continue
 				}
 			}
+			if command != "" {
+				script.add(scopedCommand(step, command))
+			}
+		}
+
+		// Job outputs travel as a dotenv report; jobs that need this one get
+		// them as variables
+		for _, cmd := range jobOutputCommands(job) {
+			gj.Script.add(cmd)
+		}
+		if gj.Script.empty() {
+			// Only comments were written, and GitLab needs a command
+			gj.Script.add(`echo "Nothing to run"`)
 		}
-		sb.WriteString("\n")
+		paths := artifactPaths(job)
+		if len(paths) > 0 || len(job.Outputs) > 0 {
+			gj.Artifacts = &gitlabArtifacts{Paths: paths}
+			if len(job.Outputs) > 0 {
+				gj.Artifacts.Reports = map[string]string{"dotenv": jobOutputFile(job.Name)}
+			}
+		}
+		gl.Jobs.setCommented(sanitizeName(job.Name), job.Comment, gj)
 	}
 
-	return sb.String(), nil
+	if len(config.Inputs) > 0 {
+		return marshalYAML(config.Comment, gitlabSpec(config), gl)
+	}
+	return marshalYAML(config.Comment, gl)
+}
+
+// circleCIConfig is a CircleCI config file
+type circleCIConfig struct {
+	Version   float64 `yaml:"version"`
+	Orbs      yamlMap `yaml:"orbs,omitempty"`
+	Jobs      yamlMap `yaml:"jobs"`
+	Workflows yamlMap `yaml:"workflows"`
+}
+
+type circleCIJob struct {
+	Parameters yamlMap             `yaml:"parameters,omitempty"`
+	Docker     []circleCIContainer `yaml:"docker"`
+	Steps      []interface{}       `yaml:"steps"`
+}
+
+type circleCIParameter struct {
+	Type    string     `yaml:"type"`
+	Default *yaml.Node `yaml:"default,omitempty"`
+}
+
+type circleCIContainer struct {
+	Image       string            `yaml:"image"`
+	Name        string            `yaml:"name,omitempty"`
+	Entrypoint  *yaml.Node        `yaml:"entrypoint,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+}
+
+type circleCIRun struct {
+	Name             string `yaml:"name,omitempty"`
+	Command          string `yaml:"command"`
+	WorkingDirectory string `yaml:"working_directory,omitempty"`
+	When             string `yaml:"when,omitempty"`
+}
+
+type circleCIPersist struct {
+	Root  string   `yaml:"root"`
+	Paths []string `yaml:"paths"`
+}
+
+type circleCIWorkflow struct {
+	Jobs []interface{} `yaml:"jobs"`
+}
+
+type circleCIWorkflowJob struct {
+	Type     string                  `yaml:"type,omitempty"`
+	Requires []string                `yaml:"requires,omitempty"`
+	Filters  *circleCIFilters        `yaml:"filters,omitempty"`
+	Matrix   *circleCIWorkflowMatrix `yaml:"matrix,omitempty"`
+}
+
+type circleCIFilters struct {
+	Branches struct {
+		Only []string `yaml:"only"`
+	} `yaml:"branches"`
+}
+
+type circleCIWorkflowMatrix struct {
+	Parameters yamlMap   `yaml:"parameters"`
+	Exclude    []yamlMap `yaml:"exclude,omitempty"`
 }
 
 // generateCircleCI generates CircleCI config
 func (c *Converter) generateCircleCI(config *PipelineConfig) (string, error) {
-	var sb strings.Builder
+	ci := circleCIConfig{Version: 2.1, Jobs: yamlMap{}}
+
+	for _, t := range config.Triggers {
+		switch t.Type {
+		case "push":
+			if len(t.Branches) > 0 || len(t.Paths) > 0 {
+				config.approximated("push", "builds ran on pushes to %s; CircleCI runs the workflow for every push unless its jobs have branch filters", triggerScope(t))
+			}
+		case "pull_request":
+			config.note("builds ran for pull requests; enable building forked pull requests in the CircleCI project settings if needed")
+		case "schedule":
+			config.note("create a scheduled pipeline in the CircleCI project settings (cron '%s')", t.Cron)
+		case "manual":
+			config.note("builds could be started by hand; trigger the pipeline from the CircleCI web app or API")
+		case "call":
+			config.approximated("workflow_call", "the pipeline is reusable; publish its jobs in an orb to call them from other CircleCI configs")
+		}
+	}
 
-	sb.WriteString("version: 2.1\n\n")
-	sb.WriteString("jobs:\n")
+	// Remote reusable workflows map to orb jobs
+	orbJobs := make(map[string]string)
+	for _, job := range config.Jobs {
+		if job.Call != nil {
+			alias, orb, orbJob := circleCIOrb(config, job)
+			orbJobs[job.Name] = alias + "/" + orbJob
+			ci.Orbs.set(alias, orb)
+		}
+	}
 
+	downloaded := downloadedJobs(config)
 	for _, job := range config.Jobs {
-		sb.WriteString(fmt.Sprintf("  %s:\n", sanitizeName(job.Name)))
-		sb.WriteString("    docker:\n")
-		sb.WriteString("      - image: cimg/base:stable\n")
-		sb.WriteString("    steps:\n")
-		sb.WriteString("      - checkout\n")
+		if job.Call != nil {
+			continue
+		}
+		var cj circleCIJob
+		for _, p := range circleCIJobParameters(config, job) {
+			param := circleCIParameter{Type: circleCIParameterType(p)}
+			if p.Default != "" {
+				param.Default = keptScalar(p.Default, p.Type != "boolean")
+			}
+			cj.Parameters.set(p.Name, param)
+		}
+		executor := circleCIContainer{Image: "cimg/base:stable"}
+		if job.Container != nil {
+			executor.Image = job.Container.Image
+			if job.Container.Entrypoint != "" {
+				executor.Entrypoint = flowSeq([]string{job.Container.Entrypoint}, false)
+			}
+			executor.Environment = job.Container.Env
+		}
+		cj.Docker = append([]circleCIContainer{executor}, circleCIServices(job)...)
+		cj.Steps = append([]interface{}{"checkout"}, circleCIRestores(config, job)...)
+
+		// Outputs and artifacts of required jobs arrive through the
+		// workspace; outputs are exported to every later step via $BASH_ENV
+		producers := outputProducers(config, job)
+		if len(producers) > 0 || workspaceDownloads(config, job, "CircleCI") {
+			cj.Steps = append(cj.Steps, yamlMap{{Key: "attach_workspace", Value: yamlMap{{Key: "at", Value: "."}}}})
+		}
+		if len(producers) > 0 {
+			var files []string
+			for _, p := range producers {
+				files = append(files, jobOutputFile(p))
+			}
+			cj.Steps = append(cj.Steps, yamlMap{{Key: "run", Value: circleCIRun{
+				Name:    "Load job outputs",
+				Command: fmt.Sprintf(`sed 's/^/export /' %s >> "$BASH_ENV"`, strings.Join(files, " ")),
+			}}})
+		}
+		if writesOutputs(job) {
+			cj.Steps = append(cj.Steps, yamlMap{{Key: "run", Value: fmt.Sprintf("mkdir -p %s", outputDir)}})
+		}
 
+		remoteDocker := false
 		for _, step := range job.Steps {
-			if step.Run != "" {
-				sb.WriteString("      - run:\n")
-				if step.Name != "" {
-					sb.WriteString(fmt.Sprintf("          name: %s\n", step.Name))
+			var command string
+			switch {
+			case step.Image != "":
+				if !remoteDocker {
+					cj.Steps = append(cj.Steps, "setup_remote_docker")
+					remoteDocker = true
 				}
-				sb.WriteString(fmt.Sprintf("          command: %s\n", step.Run))
+				command = dockerRunCommand(step)
+			case step.Run != "":
+				command = convertRunnerVariables(shellOutputs(step.Run, step), CircleCI)
+			case step.Uses != "":
+				// Convert common actions to commands; checkout, caches and
+				// artifacts are written as CircleCI steps of their own
+				command = convertActionToCommand(step)
+				if strings.HasPrefix(command, "#") {
+					config.dropped("uses", "step in job '%s' uses %s; %s", job.Name, step.Uses, cleanComment(command))
+					continue
+				}
+			}
+			if command == "" {
+				continue
+			}
+			// environment: values are not expanded, so the step's env is
+			// exported by the command itself
+			run := circleCIRun{Name: step.Name, Command: scopedCommand(Step{Env: step.Env}, command), WorkingDirectory: step.WorkDir}
+			switch step.If {
+			case "":
+			case "always()":
+				run.When = "always"
+			case "failure()":
+				run.When = "on_fail"
+			default:
+				config.dropped("if", "step in job '%s' has condition '%s'; CircleCI runs it unconditionally", job.Name, step.If)
+			}
+			cj.Steps = append(cj.Steps, commented{step.Comment, yamlMap{{Key: "run", Value: run}}})
+		}
+
+		for _, p := range artifactPaths(job) {
+			cj.Steps = append(cj.Steps, yamlMap{{Key: "store_artifacts", Value: yamlMap{{Key: "path", Value: p}}}})
+		}
+
+		cj.Steps = append(cj.Steps, circleCISaves(config, job)...)
+
+		var persist []string
+		if downloaded[job.Name] {
+			persist = artifactPaths(job)
+		}
+		if len(job.Outputs) > 0 {
+			cj.Steps = append(cj.Steps, yamlMap{{Key: "run", Value: circleCIRun{
+				Name:    "Save job outputs",
+				Command: strings.Join(jobOutputCommands(job), "\n") + "\n",
+			}}})
+			persist = append(persist, jobOutputFile(job.Name))
+		}
+		if len(persist) > 0 {
+			paths := make([]string, len(persist))
+			for i, p := range persist {
+				paths[i] = strings.TrimPrefix(p, "./")
 			}
+			cj.Steps = append(cj.Steps, yamlMap{{Key: "persist_to_workspace", Value: circleCIPersist{Root: ".", Paths: paths}}})
 		}
+		ci.Jobs.setCommented(sanitizeName(job.Name), job.Comment, cj)
 	}
 
-	sb.WriteString("\nworkflows:\n")
-	sb.WriteString(fmt.Sprintf("  %s:\n", sanitizeName(config.Name)))
-	sb.WriteString("    jobs:\n")
+	var wf circleCIWorkflow
 	for _, job := range config.Jobs {
-		if len(job.DependsOn) > 0 {
-			sb.WriteString(fmt.Sprintf("      - %s:\n", sanitizeName(job.Name)))
-			sb.WriteString("          requires:\n")
-			for _, dep := range job.DependsOn {
-				sb.WriteString(fmt.Sprintf("            - %s\n", dep))
+		deps := sanitizeNames(job.DependsOn)
+
+		// Branch conditions become branch filters; jobs requiring a
+		// filtered-out job do not run either
+		var filters *circleCIFilters
+		if job.Condition != "" {
+			if branch, ok := branchCondition(job.Condition); ok {
+				filters = &circleCIFilters{}
+				filters.Branches.Only = []string{branch}
+			} else {
+				config.dropped("if", "job '%s' has condition '%s'; CircleCI runs it in every workflow", job.Name, job.Condition)
+			}
+		}
+
+		if job.Gate != nil {
+			// Approval jobs hold the workflow until someone approves in the UI
+			hold := "hold-" + sanitizeName(job.Name)
+			wf.Jobs = append(wf.Jobs, yamlMap{{Key: hold, Value: circleCIWorkflowJob{Type: "approval", Requires: deps, Filters: filters}}})
+			deps = []string{hold}
+			if job.Gate.Environment != "" {
+				config.approximated("environment", "job '%s' used environment '%s'; CircleCI has no environments, so an approval job guards it instead", job.Name, job.Gate.Environment)
+			}
+		}
+		if orbJob := orbJobs[job.Name]; orbJob != "" {
+			// Named after the calling job so requires: keeps working
+			entry := yamlMap{{Key: "name", Value: sanitizeName(job.Name)}}
+			for _, k := range sortedKeys(job.Call.With) {
+				// Orb parameters keep their type, such as a boolean
+				entry.set(k, keptScalar(job.Call.With[k], false))
+			}
+			if len(deps) > 0 {
+				entry.set("requires", deps)
+			}
+			if filters != nil {
+				entry.set("filters", filters)
 			}
+			wf.Jobs = append(wf.Jobs, yamlMap{{Key: orbJob, Value: entry}})
+		} else if len(deps) > 0 || job.Matrix != nil || filters != nil {
+			wj := circleCIWorkflowJob{Requires: deps, Filters: filters}
+			if job.Matrix != nil {
+				axes, exclude := circleCIMatrix(config, job)
+				wj.Matrix = &circleCIWorkflowMatrix{Exclude: matrixList(exclude, true)}
+				for _, name := range (&Matrix{Axes: axes}).axisNames() {
+					wj.Matrix.Parameters.set(name, flowSeq(axes[name], true))
+				}
+			}
+			wf.Jobs = append(wf.Jobs, yamlMap{{Key: sanitizeName(job.Name), Value: wj}})
 		} else {
-			sb.WriteString(fmt.Sprintf("      - %s\n", sanitizeName(job.Name)))
+			wf.Jobs = append(wf.Jobs, sanitizeName(job.Name))
 		}
 	}
+	ci.Workflows.set(sanitizeName(config.Name), wf)
 
-	return sb.String(), nil
+	return marshalYAML(config.Comment, ci)
+}
+
+// azurePipeline is an Azure Pipelines file
+type azurePipeline struct {
+	Name      string          `yaml:"name"`
+	Trigger   interface{}     `yaml:"trigger"`
+	PR        interface{}     `yaml:"pr,omitempty"`
+	Schedules []azureSchedule `yaml:"schedules,omitempty"`
+	Resources *azureResources `yaml:"resources,omitempty"`
+	Pool      azureAgentPool  `yaml:"pool"`
+	Stages    []azureStage    `yaml:"stages"`
+}
+
+type azureBranches struct {
+	Branches struct {
+		Include []string `yaml:"include"`
+	} `yaml:"branches"`
+}
+
+type azureSchedule struct {
+	Cron        string `yaml:"cron"`
+	DisplayName string `yaml:"displayName"`
+	Always      bool   `yaml:"always"`
+}
+
+type azureAgentPool struct {
+	VMImage string `yaml:"vmImage"`
+}
+
+type azureStage struct {
+	Stage string     `yaml:"stage"`
+	Jobs  []azureJob `yaml:"jobs"`
+}
+
+type azureJob struct {
+	carried
+	Job              string            `yaml:"job,omitempty"`
+	Deployment       string            `yaml:"deployment,omitempty"`
+	Environment      string            `yaml:"environment,omitempty"`
+	Pool             string            `yaml:"pool,omitempty"`
+	TimeoutInMinutes int               `yaml:"timeoutInMinutes,omitempty"`
+	DependsOn        []string          `yaml:"dependsOn,omitempty"`
+	Condition        string            `yaml:"condition,omitempty"`
+	Container        *azureContainer   `yaml:"container,omitempty"`
+	Services         map[string]string `yaml:"services,omitempty"`
+	Strategy         *azureStrategy    `yaml:"strategy,omitempty"`
+	Steps            []azureStep       `yaml:"steps,omitempty"`
+}
+
+type azureContainer struct {
+	Image   string            `yaml:"image"`
+	Options string            `yaml:"options,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+}
+
+// azureStrategy nests a deployment job's steps under runOnce
+type azureStrategy struct {
+	RunOnce struct {
+		Deploy struct {
+			Steps []azureStep `yaml:"steps"`
+		} `yaml:"deploy"`
+	} `yaml:"runOnce"`
+}
+
+type azureStep struct {
+	carried
+	Checkout         string            `yaml:"checkout,omitempty"`
+	Task             string            `yaml:"task,omitempty"`
+	Inputs           yamlMap           `yaml:"inputs,omitempty"`
+	Script           string            `yaml:"script,omitempty"`
+	DisplayName      string            `yaml:"displayName,omitempty"`
+	WorkingDirectory string            `yaml:"workingDirectory,omitempty"`
+	Env              map[string]string `yaml:"env,omitempty"`
+	Condition        string            `yaml:"condition,omitempty"`
+}
+
+// azureSetupTasks are the tool installer tasks for setup actions: the task,
+// its version input and the action input it is read from
+var azureSetupTasks = map[string]struct{ name, input, from string }{
+	"actions/setup-node":   {"NodeTool@0", "versionSpec", "node-version"},
+	"actions/setup-python": {"UsePythonVersion@0", "versionSpec", "python-version"},
+	"actions/setup-go":     {"GoTool@0", "version", "go-version"},
+	"actions/setup-dotnet": {"UseDotNet@2", "version", "dotnet-version"},
 }
 
 // generateAzure generates Azure Pipelines config
 func (c *Converter) generateAzure(config *PipelineConfig) (string, error) {
-	var sb strings.Builder
+	az := azurePipeline{Name: config.Name, Trigger: emptyValue{}, Pool: azureAgentPool{VMImage: "ubuntu-latest"}}
 
-	sb.WriteString(fmt.Sprintf("name: %s\n\n", config.Name))
-
-	// Triggers
-	sb.WriteString("trigger:\n")
+	// Triggers; without pr: Azure builds pull requests into every branch
+	var branches, prBranches azureBranches
+	pullRequests := false
 	for _, trigger := range config.Triggers {
-		if trigger.Type == "push" && len(trigger.Branches) > 0 {
-			sb.WriteString("  branches:\n")
-			sb.WriteString("    include:\n")
-			for _, b := range trigger.Branches {
-				sb.WriteString(fmt.Sprintf("      - %s\n", b))
-			}
+		switch trigger.Type {
+		case "push":
+			branches.Branches.Include = append(branches.Branches.Include, trigger.Branches...)
+		case "pull_request":
+			pullRequests = true
+			prBranches.Branches.Include = append(prBranches.Branches.Include, trigger.Branches...)
+		case "schedule":
+			az.Schedules = append(az.Schedules, azureSchedule{Cron: trigger.Cron, DisplayName: "Scheduled build", Always: true})
+		case "manual":
+			config.note("builds could be started by hand; run the pipeline from Pipelines > Run pipeline in Azure DevOps")
+		case "call":
+			config.approximated("workflow_call", "the pipeline is reusable; turn it into a template to use it from other Azure pipelines")
 		}
 	}
+	if len(branches.Branches.Include) > 0 {
+		az.Trigger = branches
+	}
+	switch {
+	case !pullRequests:
+		az.PR = "none"
+	case len(prBranches.Branches.Include) > 0:
+		az.PR = prBranches
+	}
 
-	sb.WriteString("\npool:\n")
-	sb.WriteString("  vmImage: 'ubuntu-latest'\n\n")
+	resources, services := azureServices(config)
+	az.Resources = azureResourceList(resources)
 
-	sb.WriteString("stages:\n")
 	for _, job := range config.Jobs {
-		sb.WriteString(fmt.Sprintf("  - stage: %s\n", sanitizeName(job.Name)))
-		sb.WriteString("    jobs:\n")
-		sb.WriteString(fmt.Sprintf("      - job: %s\n", sanitizeName(job.Name)))
+		stage := azureStage{Stage: sanitizeName(job.Name)}
+
+		deps := job.DependsOn
+		if job.Gate != nil && job.Gate.Manual {
+			// ManualValidation only runs in agentless (server) jobs
+			approval := sanitizeName(job.Name) + "-approval"
+			inputs := yamlMap{{Key: "instructions", Value: "Approve " + job.Name}}
+			if len(job.Gate.Approvers) > 0 {
+				inputs.set("notifyUsers", strings.Join(job.Gate.Approvers, ","))
+			}
+			inputs.set("onTimeout", "reject")
+			stage.Jobs = append(stage.Jobs, azureJob{
+				Job:              approval,
+				Pool:             "server",
+				TimeoutInMinutes: 1440,
+				Steps:            []azureStep{{Task: "ManualValidation@0", Inputs: inputs}},
+			})
+			deps = append(append([]string{}, deps...), approval)
+		}
+
+		if len(job.Outputs) > 0 {
+			config.dropped("outputs", "job '%s' has outputs; set them with ##vso[task.setvariable variable=<name>;isOutput=true] and read them through dependencies in Azure", job.Name)
+		}
 
-		if len(job.DependsOn) > 0 {
-			sb.WriteString("        dependsOn:\n")
-			for _, dep := range job.DependsOn {
-				sb.WriteString(fmt.Sprintf("          - %s\n", dep))
+		aj := azureJob{carried: carried{job.Comment}, Job: sanitizeName(job.Name), DependsOn: sanitizeNames(deps)}
+		if job.Condition != "" {
+			if cond, ok := azureCondition(job.Condition); ok {
+				aj.Condition = cond
+				for i := range stage.Jobs {
+					// The approval waits on the same condition as the job
+					stage.Jobs[i].Condition = cond
+				}
+			} else {
+				config.dropped("if", "job '%s' has condition '%s'; Azure runs it in every pipeline", job.Name, job.Condition)
 			}
 		}
+		deployment := job.Gate != nil && job.Gate.Environment != ""
+		if deployment {
+			// Approvals and checks are configured on the environment in Azure DevOps
+			aj.Job, aj.Deployment, aj.Environment = "", sanitizeName(job.Name), job.Gate.Environment
+		}
 
-		sb.WriteString("        steps:\n")
-		sb.WriteString("          - checkout: self\n")
+		if job.Container != nil {
+			aj.Container = &azureContainer{Image: job.Container.Image, Options: job.Container.Options, Env: job.Container.Env}
+		}
+		aj.Services = services[job.Name]
 
+		steps := append([]azureStep{{Checkout: "self"}}, azureCaches(job)...)
 		for _, step := range job.Steps {
-			if step.Run != "" {
-				sb.WriteString("          - script: |\n")
-				sb.WriteString(fmt.Sprintf("              %s\n", step.Run))
-				if step.Name != "" {
-					sb.WriteString(fmt.Sprintf("            displayName: '%s'\n", step.Name))
+			command := step.Run
+			if step.Image != "" {
+				command = dockerRunCommand(step)
+			}
+			switch {
+			case isUpload(step):
+				steps = append(steps, azurePublish(config, job.Name, Artifact{Name: artifactName(step.With["name"]), Paths: splitInput(step.With["path"])}))
+			case isDownload(step):
+				artifacts, _ := stepArtifacts(config, job, step)
+				for _, a := range artifacts {
+					dest := downloadPath(step, a)
+					if !strings.HasPrefix(dest, "/") {
+						dest = "$(Build.SourcesDirectory)/" + strings.TrimPrefix(dest, ".")
+					}
+					inputs := yamlMap{{Key: "artifact", Value: a.Name}, {Key: "path", Value: strings.TrimSuffix(dest, "/")}}
+					steps = append(steps, azureStep{Task: "DownloadPipelineArtifact@2", Inputs: inputs})
+				}
+			case step.Uses != "" && command == "" && !strings.Contains(step.Uses, "checkout"):
+				task, ok := azureSetupTasks[strings.SplitN(step.Uses, "@", 2)[0]]
+				if !ok {
+					config.dropped("uses", "step in job '%s' uses %s; Azure has no matching task, so it was left out", job.Name, step.Uses)
+					break
+				}
+				s := azureStep{carried: carried{step.Comment}, Task: task.name, DisplayName: step.Name}
+				if version := step.With[task.from]; version != "" {
+					s.Inputs = yamlMap{{Key: task.input, Value: version}}
+				}
+				steps = append(steps, s)
+			}
+			if command != "" {
+				s := azureStep{carried: carried{step.Comment}, Script: command, DisplayName: step.Name, WorkingDirectory: step.WorkDir, Env: step.Env}
+				if step.If != "" {
+					if cond, ok := azureCondition(step.If); ok {
+						s.Condition = cond
+					} else {
+						config.dropped("if", "step in job '%s' has condition '%s'; Azure runs it unconditionally", job.Name, step.If)
+					}
 				}
+				steps = append(steps, s)
 			}
 		}
+		for _, a := range job.Artifacts {
+			steps = append(steps, azurePublish(config, job.Name, a))
+		}
+
+		// Deployment jobs nest their steps under a runOnce strategy
+		if deployment {
+			aj.Strategy = &azureStrategy{}
+			aj.Strategy.RunOnce.Deploy.Steps = steps
+		} else {
+			aj.Steps = steps
+		}
+		stage.Jobs = append(stage.Jobs, aj)
+		az.Stages = append(az.Stages, stage)
 	}
 
-	return sb.String(), nil
+	return marshalYAML(config.Comment, az)
 }
 
 // generateJenkins generates Jenkinsfile
@@ -650,19 +2141,150 @@ func (c *Converter) generateJenkins(config *PipelineConfig) (string, error) {
 
 	sb.WriteString("pipeline {\n")
 	sb.WriteString("    agent any\n\n")
+	var crons []string
+	for _, t := range config.Triggers {
+		switch t.Type {
+		case "push":
+			if len(t.Branches) > 0 || len(t.Paths) > 0 {
+				config.note("builds ran on pushes to %s; set the branch sources of the multibranch job to match", triggerScope(t))
+			}
+		case "pull_request":
+			config.note("builds ran for pull requests; discover pull requests in the multibranch job's branch source")
+		case "schedule":
+			crons = append(crons, t.Cron)
+		case "manual":
+			config.note("builds could be started by hand; use Build Now on the Jenkins job")
+		case "call":
+			config.approximated("workflow_call", "the pipeline is reusable; move its stages into a shared library to call them from other Jenkinsfiles")
+		}
+	}
+	if len(crons) > 0 {
+		sb.WriteString("    triggers {\n")
+		for _, cron := range crons {
+			sb.WriteString(fmt.Sprintf("        cron('%s')\n", escapeJenkinsString(cron)))
+		}
+		sb.WriteString("    }\n\n")
+	}
+	jenkinsEnvironment(&sb, config.Environment)
 	sb.WriteString("    stages {\n")
 
+	downloaded := downloadedJobs(config)
+
 	for _, job := range config.Jobs {
 		sb.WriteString(fmt.Sprintf("        stage('%s') {\n", job.Name))
+		if len(job.Outputs) > 0 {
+			config.dropped("outputs", "job '%s' has outputs; Jenkins stages share the workspace, so write them to a file or env var by hand", job.Name)
+		}
+		if job.Container != nil {
+			sb.WriteString("            agent {\n")
+			sb.WriteString("                docker {\n")
+			sb.WriteString(fmt.Sprintf("                    image '%s'\n", escapeJenkinsString(job.Container.Image)))
+			if job.Container.Entrypoint != "" || job.Container.Options != "" {
+				args := job.Container.Options
+				if job.Container.Entrypoint != "" {
+					args = strings.TrimSpace(fmt.Sprintf("--entrypoint=%s %s", job.Container.Entrypoint, args))
+				}
+				sb.WriteString(fmt.Sprintf("                    args '%s'\n", escapeJenkinsString(args)))
+			}
+			sb.WriteString("                }\n")
+			sb.WriteString("            }\n")
+		}
+		if job.Condition != "" {
+			if branch, ok := branchCondition(job.Condition); ok {
+				sb.WriteString("            when {\n")
+				if job.Gate != nil {
+					// Only ask for approval on the branch the stage runs on
+					sb.WriteString("                beforeInput true\n")
+				}
+				sb.WriteString(fmt.Sprintf("                branch '%s'\n", escapeJenkinsString(branch)))
+				sb.WriteString("            }\n")
+			} else {
+				config.dropped("if", "job '%s' has condition '%s'; Jenkins runs the stage in every build", job.Name, job.Condition)
+			}
+		}
+		if job.Gate != nil {
+			// input pauses the stage until someone confirms in the Jenkins UI
+			message := "Proceed with " + job.Name + "?"
+			if job.Gate.Environment != "" {
+				message = fmt.Sprintf("Deploy %s to %s?", job.Name, job.Gate.Environment)
+				config.approximated("environment", "job '%s' used environment '%s'; Jenkins has no environments, so an input step guards it instead", job.Name, job.Gate.Environment)
+			}
+			sb.WriteString("            input {\n")
+			sb.WriteString(fmt.Sprintf("                message '%s'\n", escapeJenkinsString(message)))
+			if len(job.Gate.Approvers) > 0 {
+				sb.WriteString(fmt.Sprintf("                submitter '%s'\n", escapeJenkinsString(strings.Join(job.Gate.Approvers, ","))))
+			}
+			sb.WriteString("            }\n")
+		}
 		sb.WriteString("            steps {\n")
+		containers := jenkinsServices(config, &sb, job)
 
+		// Steps that run always or on failure go to the stage's post
+		// conditions of the same name
+		post := make(map[string][]string)
+		workspaceDownloads(config, job, "Jenkins")
 		for _, step := range job.Steps {
-			if step.Run != "" {
-				sb.WriteString(fmt.Sprintf("                sh '%s'\n", escapeJenkinsString(step.Run)))
+			var command string
+			switch {
+			case step.Image != "":
+				command = dockerRunCommand(step)
+			case step.Run != "":
+				command = step.Run
+			case step.Uses != "":
+				command = convertActionToCommand(step)
+				if strings.HasPrefix(command, "#") {
+					config.dropped("uses", "step in job '%s' uses %s; %s", job.Name, step.Uses, cleanComment(command))
+					continue
+				}
+			}
+			if isDownload(step) {
+				artifacts, _ := stepArtifacts(config, job, step)
+				for _, a := range artifacts {
+					sb.WriteString(fmt.Sprintf("                unstash '%s'\n", escapeJenkinsString(a.Name)))
+				}
+			}
+			if command == "" {
+				continue
 			}
+			sh := jenkinsSh(scopedCommand(step, command))
+			switch step.If {
+			case "":
+				sb.WriteString("                " + sh + "\n")
+			case "always()":
+				post["always"] = append(post["always"], sh)
+			case "failure()":
+				post["failure"] = append(post["failure"], sh)
+			default:
+				config.dropped("if", "step in job '%s' has condition '%s'; Jenkins runs it unconditionally", job.Name, step.If)
+				sb.WriteString("                " + sh + "\n")
+			}
+		}
+		for _, a := range jobArtifacts(job) {
+			includes := escapeJenkinsString(jenkinsIncludes(a.Paths))
+			if downloaded[job.Name] {
+				sb.WriteString(fmt.Sprintf("                stash name: '%s', includes: '%s'\n", escapeJenkinsString(a.Name), includes))
+			}
+			sb.WriteString(fmt.Sprintf("                archiveArtifacts artifacts: '%s'\n", includes))
 		}
 
 		sb.WriteString("            }\n")
+		if len(containers) > 0 {
+			post["always"] = append(post["always"], jenkinsSh("docker rm -f "+strings.Join(containers, " ")))
+		}
+		if len(post) > 0 {
+			sb.WriteString("            post {\n")
+			for _, condition := range []string{"always", "failure"} {
+				if len(post[condition]) == 0 {
+					continue
+				}
+				sb.WriteString(fmt.Sprintf("                %s {\n", condition))
+				for _, sh := range post[condition] {
+					sb.WriteString("                    " + sh + "\n")
+				}
+				sb.WriteString("                }\n")
+			}
+			sb.WriteString("            }\n")
+		}
 		sb.WriteString("        }\n")
 	}
 
@@ -687,16 +2309,218 @@ func sanitizeName(name string) string {
 	return strings.ToLower(name)
 }
 
-func convertCondition(condition string, target Platform) string {
-	// Basic condition conversion
-	switch target {
-	case GitHub:
-		return condition
-	case GitLab:
-		return strings.ReplaceAll(condition, "github.", "$CI_")
-	default:
-		return condition
+// sanitizeNames sanitizes each of names, such as the jobs a job needs
+func sanitizeNames(names []string) []string {
+	var sanitized []string
+	for _, name := range names {
+		sanitized = append(sanitized, sanitizeName(name))
 	}
+	return sanitized
+}
+
+// gitlabExpression rewrites a GitHub condition as a GitLab rules: if:
+// expression, mapping github.* contexts through the runner variable table.
+// It reports false when the condition has no equivalent.
+func gitlabExpression(cond string) (string, bool) {
+	expr := refPrefixCondition.ReplaceAllStringFunc(cond, func(m string) string {
+		parts := refPrefixCondition.FindStringSubmatch(m)
+		op := "=~"
+		if parts[1] == "!" {
+			op = "!~"
+		}
+		return fmt.Sprintf("$CI_COMMIT_REF_NAME %s /^%s/", op, strings.ReplaceAll(regexp.QuoteMeta(parts[2]), "/", `\/`))
+	})
+	for _, rule := range gitlabConditions {
+		expr = rule.pattern.ReplaceAllString(expr, rule.replacement)
+	}
+
+	vars := platformVariables(GitLab)
+	mapped := true
+	expr = githubContextRef.ReplaceAllStringFunc(expr, func(ref string) string {
+		name, ok := vars[githubContexts[strings.TrimPrefix(ref, "github.")]]
+		if !ok {
+			mapped = false
+			return ref
+		}
+		return "$" + name
+	})
+	if !mapped || githubUnsupported.MatchString(expr) {
+		return "", false
+	}
+	return expr, true
+}
+
+// branchCondition reports the branch a condition limits a job to, for
+// targets that filter jobs by branch rather than by expression
+func branchCondition(cond string) (string, bool) {
+	if m := branchRefCondition.FindStringSubmatch(strings.TrimSpace(cond)); m != nil {
+		return m[1] + m[2], true
+	}
+	return "", false
+}
+
+// azureCondition rewrites a GitHub condition as an Azure condition: status
+// functions become their Azure names and branch conditions compare
+// Build.SourceBranch. Conditions already in Azure syntax are kept. It
+// reports false when the condition has no equivalent.
+func azureCondition(cond string) (string, bool) {
+	switch cond = strings.TrimSpace(cond); cond {
+	case "always()":
+		return "always()", true
+	case "success()":
+		return "succeeded()", true
+	case "failure()":
+		return "failed()", true
+	case "cancelled()":
+		return "canceled()", true
+	}
+	if branch, ok := branchCondition(cond); ok {
+		return fmt.Sprintf("and(succeeded(), eq(variables['Build.SourceBranch'], 'refs/heads/%s'))", branch), true
+	}
+	if azureFunction.MatchString(cond) && !githubContextRef.MatchString(cond) {
+		return cond, true
+	}
+	return "", false
+}
+
+var (
+	azureFunction      = regexp.MustCompile(`^(?:and|or|not|eq|ne|in|notIn|succeeded|failed|canceled|succeededOrFailed)\(`)
+	branchRefCondition = regexp.MustCompile(`^github\.(?:ref == 'refs/heads/([^']+)'|ref_name == '([^']+)')$`)
+	refPrefixCondition = regexp.MustCompile(`(!?)startsWith\(github\.(?:ref_name|head_ref), '([^']*)'\)`)
+	githubContextRef   = regexp.MustCompile(`\bgithub\.[a-z_]+`)
+)
+
+// gitlabConditions rewrite GitHub expressions with no one-to-one variable in
+// GitLab; other github.* contexts go through runnerVariables
+var gitlabConditions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`startsWith\(github\.ref, 'refs/tags/'\)`), "$$CI_COMMIT_TAG"},
+	{regexp.MustCompile(`github\.ref == 'refs/heads/([^']*)'`), "$$CI_COMMIT_BRANCH == '$1'"},
+	{regexp.MustCompile(`github\.ref != 'refs/heads/([^']*)'`), "$$CI_COMMIT_BRANCH != '$1'"},
+	{regexp.MustCompile(`github\.ref == 'refs/tags/([^']*)'`), "$$CI_COMMIT_TAG == '$1'"},
+	{regexp.MustCompile(`github\.ref != 'refs/tags/([^']*)'`), "$$CI_COMMIT_TAG != '$1'"},
+	{regexp.MustCompile(`github\.event_name == 'pull_request'`), "$$CI_PIPELINE_SOURCE == 'merge_request_event'"},
+	{regexp.MustCompile(`github\.event_name != 'pull_request'`), "$$CI_PIPELINE_SOURCE != 'merge_request_event'"},
+	{regexp.MustCompile(`github\.event_name == 'workflow_dispatch'`), "$$CI_PIPELINE_SOURCE == 'web'"},
+	{regexp.MustCompile(`github\.event_name != 'workflow_dispatch'`), "$$CI_PIPELINE_SOURCE != 'web'"},
+}
+
+// gitlabSources maps $CI_PIPELINE_SOURCE values to GitHub event names
+var gitlabSources = map[string]string{
+	"push":                "push",
+	"merge_request_event": "pull_request",
+	"web":                 "workflow_dispatch",
+	"schedule":            "schedule",
+}
+
+var (
+	gitlabMatch      = regexp.MustCompile(`\$\{?(\w+)\}?\s*(=~|!~)\s*/((?:\\.|[^/\\])*)/`)
+	gitlabComparison = regexp.MustCompile(`\$\{?(\w+)\}?\s*(==|!=)\s*("[^"]*"|'[^']*'|null|\$\{?\w+\}?)`)
+	gitlabBareRef    = regexp.MustCompile(`\$\{?(\w+)\}?`)
+	gitlabEscape     = regexp.MustCompile(`\\(.)`)
+	gitlabLiteral    = regexp.MustCompile(`^\^((?:\\[^A-Za-z0-9]|[A-Za-z0-9_ ,:@=-])*)$`)
+	githubTokens     = regexp.MustCompile(`'(?:[^']|'')*'|\bgithub\.[a-z_]+|startsWith\(|&&|\|\||==|!=|[()!,\s]`)
+)
+
+// githubCondition rewrites a GitLab rules: if: expression as a GitHub
+// condition: predefined variables become the matching github.* contexts and
+// regex matches on a literal prefix become startsWith(). It reports false
+// when the expression reads other variables or uses other regexes.
+func githubCondition(expr string) (string, bool) {
+	ok := true
+	context := func(name string) string {
+		c, found := gitlabContext(name)
+		if !found {
+			ok = false
+		}
+		return c
+	}
+
+	cond := gitlabMatch.ReplaceAllStringFunc(expr, func(m string) string {
+		parts := gitlabMatch.FindStringSubmatch(m)
+		lit := gitlabLiteral.FindStringSubmatch(parts[3])
+		if lit == nil {
+			ok = false
+			return m
+		}
+		not := ""
+		if parts[2] == "!~" {
+			not = "!"
+		}
+		prefix := gitlabEscape.ReplaceAllString(lit[1], "$1")
+		return fmt.Sprintf("%sstartsWith(%s, %s)", not, context(parts[1]), githubString(prefix))
+	})
+
+	cond = gitlabComparison.ReplaceAllStringFunc(cond, func(m string) string {
+		parts := gitlabComparison.FindStringSubmatch(m)
+		name, op, value := parts[1], parts[2], parts[3]
+		if strings.HasPrefix(value, "$") {
+			return fmt.Sprintf("%s %s %s", context(name), op, context(strings.Trim(value, "${}")))
+		}
+		if value == "null" {
+			if name == "CI_COMMIT_TAG" {
+				if op == "==" {
+					return "!startsWith(github.ref, 'refs/tags/')"
+				}
+				return "startsWith(github.ref, 'refs/tags/')"
+			}
+			return fmt.Sprintf("%s %s ''", context(name), op)
+		}
+		value = value[1 : len(value)-1]
+		switch name {
+		case "CI_COMMIT_TAG":
+			return fmt.Sprintf("github.ref %s %s", op, githubString("refs/tags/"+value))
+		case "CI_PIPELINE_SOURCE":
+			event, found := gitlabSources[value]
+			if !found {
+				ok = false
+			}
+			return fmt.Sprintf("github.event_name %s %s", op, githubString(event))
+		}
+		return fmt.Sprintf("%s %s %s", context(name), op, githubString(value))
+	})
+
+	cond = gitlabBareRef.ReplaceAllStringFunc(cond, func(m string) string {
+		switch name := strings.Trim(m, "${}"); name {
+		case "CI_COMMIT_TAG":
+			return "startsWith(github.ref, 'refs/tags/')"
+		case "CI_MERGE_REQUEST_ID", "CI_MERGE_REQUEST_IID":
+			return "github.event_name == 'pull_request'"
+		default:
+			return context(name) + " != ''"
+		}
+	})
+
+	if !ok || githubTokens.ReplaceAllString(cond, "") != "" {
+		return "", false
+	}
+	return cond, true
+}
+
+// gitlabContext returns the github.* context holding the value of a GitLab
+// predefined variable
+func gitlabContext(name string) (string, bool) {
+	if name == "CI_COMMIT_BRANCH" {
+		return "github.ref_name", true
+	}
+	for gh, native := range platformVariables(GitLab) {
+		if native != name {
+			continue
+		}
+		for context, variable := range githubContexts {
+			if variable == gh {
+				return "github." + context, true
+			}
+		}
+	}
+	return "", false
+}
+
+// githubString quotes s as a GitHub expression string literal
+func githubString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
 }
 
 func convertActionToCommand(step Step) string {
@@ -714,6 +2538,12 @@ func convertActionToCommand(step Step) string {
 	if strings.Contains(step.Uses, "setup-go") {
 		return "# Go setup - configure in image"
 	}
+	if strings.Contains(step.Uses, "setup-dotnet") {
+		return "# .NET setup - configure in image"
+	}
+	if isUpload(step) || isDownload(step) {
+		return "" // Emitted as job artifacts, which later jobs receive
+	}
 	if strings.Contains(step.Uses, "setup-python") {
 		version := step.With["python-version"]
 		if version == "" {
@@ -724,18 +2554,79 @@ func convertActionToCommand(step Step) string {
 	return fmt.Sprintf("# Action: %s (manual conversion needed)", step.Uses)
 }
 
+// cachePlugins suggest a replacement on targets without a built-in cache
+var cachePlugins = map[Platform]string{
+	Jenkins:    "Jenkins has no built-in cache, so use a plugin such as Job Cacher",
+	Drone:      "Drone has no built-in cache, so use a plugin such as meltwater/drone-cache",
+	Woodpecker: "Woodpecker has no built-in cache, so use a plugin such as meltwater/drone-cache",
+	Buildkite:  "Buildkite has no built-in cache, so use a plugin such as cache#v1",
+	Tekton:     "Tekton has no built-in cache, so keep the cached directories on a persistent workspace",
+}
+
+// noteCaches warns about job caches the target's generator does not write
+func noteCaches(config *PipelineConfig, target Platform) {
+	advice, ok := cachePlugins[target]
+	if !ok {
+		return
+	}
+	for _, job := range config.Jobs {
+		if len(job.Cache) > 0 {
+			var keys []string
+			for _, cache := range job.Cache {
+				keys = append(keys, cache.Key)
+			}
+			config.dropped("cache", "job '%s' caches %s; %s", job.Name, strings.Join(keys, ", "), advice)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapeJenkinsString escapes s for a single-quoted Groovy string, which
+// cannot span lines
 func escapeJenkinsString(s string) string {
-	s = strings.ReplaceAll(s, "'", "\\'")
-	return s
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "'", `\'`)
+	return strings.ReplaceAll(s, "\n", `\n`)
 }
 
-// GetSupportedPlatforms returns list of supported platforms
+// jenkinsSh is an sh step running command. Multi-line commands are written
+// as a triple-quoted Groovy string, in which only backslashes and quotes
+// that would end the string need escaping.
+func jenkinsSh(command string) string {
+	command = strings.TrimSuffix(command, "\n")
+	if !strings.Contains(command, "\n") {
+		return fmt.Sprintf("sh '%s'", escapeJenkinsString(command))
+	}
+	s := strings.ReplaceAll(command, `\`, `\\`)
+	s = strings.ReplaceAll(s, "'''", `\'\'\'`)
+	return "sh '''" + s + "\n'''"
+}
+
+// builtinPlatforms are the platforms converted without a driver
+var builtinPlatforms = []Platform{GitHub, GitLab, Jenkins, CircleCI, Azure, Bitbucket, Drone, Woodpecker, Buildkite, TeamCity, Bamboo, Travis, Harness, Codefresh, Tekton}
+
+// GetSupportedPlatforms returns list of supported platforms, the built-in
+// ones followed by registered drivers
 func GetSupportedPlatforms() []Platform {
-	return []Platform{GitHub, GitLab, Jenkins, CircleCI, Azure, Bitbucket}
+	platforms := append([]Platform{}, builtinPlatforms...)
+	for _, d := range Drivers() {
+		platforms = append(platforms, d.Platform())
+	}
+	return platforms
 }
 
-// DetectPlatform detects CI platform from file path
+// DetectPlatform detects CI platform from file path. Backslashes are read
+// as separators, so Windows paths are detected too.
 func DetectPlatform(path string) Platform {
+	path = strings.ReplaceAll(path, `\`, "/")
 	switch {
 	case strings.Contains(path, ".github/workflows"):
 		return GitHub
@@ -749,7 +2640,19 @@ func DetectPlatform(path string) Platform {
 		return Azure
 	case strings.Contains(path, "bitbucket-pipelines"):
 		return Bitbucket
+	case strings.Contains(path, ".drone"):
+		return Drone
+	case strings.Contains(path, ".woodpecker"):
+		return Woodpecker
+	case strings.Contains(path, "buildkite"):
+		return Buildkite
+	case strings.Contains(path, ".teamcity"):
+		return TeamCity
+	case strings.Contains(path, "bamboo-specs"):
+		return Bamboo
+	case strings.Contains(path, ".travis"):
+		return Travis
 	default:
-		return ""
+		return detectWithDriver(path)
 	}
 }
@@ -0,0 +1,40 @@
+package converter
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestGenerateGolden converts testdata/workflow.yml to every target and
+// compares the output with testdata/<target>.golden. Run with -update to
+// rewrite the golden files after checking a change.
+func TestGenerateGolden(t *testing.T) {
+	targets := []Platform{GitHub, GitLab, Jenkins, CircleCI, Azure, Bitbucket, Drone, Woodpecker, Buildkite, Harness, Codefresh, Tekton}
+	source := filepath.Join("testdata", "workflow.yml")
+	for _, to := range targets {
+		t.Run(string(to), func(t *testing.T) {
+			got, err := NewConverter().Render(GitHub, to, source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", string(to)+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v; run go test -update to create it", err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s; run go test -update and review the diff\ngot:\n%s", golden, got)
+			}
+		})
+	}
+}
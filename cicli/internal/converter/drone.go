@@ -0,0 +1,1370 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// droneDefaultImage runs the steps of jobs without a container. Drone and
+// Woodpecker run every step in an image; this one has git, curl and the
+// usual build tools.
+const droneDefaultImage = "buildpack-deps:bookworm"
+
+// droneEvents maps Drone and Woodpecker events to GitHub conditions.
+// Promotions and deployments are started by hand, like workflow_dispatch.
+var droneEvents = map[string]string{
+	"push":         "github.event_name == 'push'",
+	"pull_request": "github.event_name == 'pull_request'",
+	"tag":          "startsWith(github.ref, 'refs/tags/')",
+	"cron":         "github.event_name == 'schedule'",
+	"custom":       "github.event_name == 'workflow_dispatch'",
+	"manual":       "github.event_name == 'workflow_dispatch'",
+	"promote":      "github.event_name == 'workflow_dispatch'",
+	"rollback":     "github.event_name == 'workflow_dispatch'",
+	"deployment":   "github.event_name == 'workflow_dispatch'",
+}
+
+var (
+	droneMatrixRef   = regexp.MustCompile(`\$\$\{\{\s*matrix\.([\w-]+)\s*\}\}`)
+	droneVariableRef = regexp.MustCompile(`\$\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$\$([A-Za-z_][A-Za-z0-9_]*)`)
+	eventPattern     = regexp.MustCompile(`^github\.event_name (==|!=) '([^']+)'$`)
+	refNameNotEqual  = regexp.MustCompile(`^github\.ref_name != '([^']+)'$`)
+	baseRefPattern   = regexp.MustCompile(`^github\.base_ref == '([^']+)'$`)
+	refPattern       = regexp.MustCompile(`^github\.ref == '([^']+)'$`)
+	refStartsPattern = regexp.MustCompile(`^startsWith\(github\.ref, '([^']+)'\)$`)
+)
+
+// droneFilter is a trigger: or when: block as a GitHub condition, plus
+// the events and branches of each of its blocks, which become triggers
+type droneFilter struct {
+	condition string
+	matches   []droneMatch
+	targets   []string // promotion targets or deployment environments
+	// exact is set when the triggers alone start the pipeline when Drone would
+	exact bool
+}
+
+type droneMatch struct {
+	events, branches []string
+}
+
+type droneParser struct {
+	config   *PipelineConfig
+	platform Platform
+	refs     *regexp.Regexp // $$ escapes and the workflow's matrix variables
+}
+
+// parseDrone parses a .drone.yml, one job per pipeline document, or a
+// Woodpecker workflow, which becomes the job name. Steps of a pipeline share
+// its workspace, so they become steps of that job.
+func (c *Converter) parseDrone(content []byte, platform Platform, name string) (*PipelineConfig, error) {
+	config := &PipelineConfig{Name: "Pipeline", Jobs: []Job{}}
+	p := &droneParser{config: config, platform: platform}
+
+	var filters []droneFilter
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+		pd, _ := rawNode(root).(map[string]interface{})
+
+		jobName := name
+		if platform == Drone {
+			switch kind := getString(pd, "kind"); kind {
+			case "pipeline":
+			case "secret":
+				config.note("secret '%s' comes from an external secret store; create it on the target", getString(pd, "name"))
+				continue
+			case "signature":
+				continue
+			default:
+				config.dropped("kind", "'kind: %s' documents are not converted", kind)
+				continue
+			}
+			jobName = getString(pd, "name")
+			if jobName == "" {
+				jobName = "default"
+			}
+		}
+		job, filter := p.parseJob(sanitizeName(jobName), root, pd)
+		config.Jobs = append(config.Jobs, job)
+		filters = append(filters, filter)
+	}
+	if len(config.Jobs) == 0 {
+		return nil, fmt.Errorf("no pipeline found")
+	}
+
+	// Jobs only need a condition when the triggers cannot tell them apart
+	config.Triggers = droneTriggers(config, filters)
+	same := true
+	for _, f := range filters {
+		if f.condition != filters[0].condition {
+			same = false
+		}
+	}
+	for i, f := range filters {
+		if !same || !f.exact {
+			config.Jobs[i].Condition = f.condition
+		}
+	}
+	return config, nil
+}
+
+// parseJob converts one pipeline or workflow and returns the filter that
+// decides when it runs
+func (p *droneParser) parseJob(name string, root *yaml.Node, pd map[string]interface{}) (Job, droneFilter) {
+	where := fmt.Sprintf("pipeline '%s'", name)
+	handled := keySet("kind", "type", "name", "steps", "pipeline", "services", "environment", "trigger", "when", "depends_on", "runs_on", "matrix", "variables")
+	for k := range pd {
+		if strings.HasPrefix(k, "x-") {
+			handled[k] = true
+		}
+	}
+	p.config.dropKeys(where, pd, handled)
+
+	job := Job{Name: name, RunsOn: "ubuntu-latest"}
+	switch t := getString(pd, "type"); t {
+	case "", "docker", "kubernetes":
+	default:
+		job.RunsOn = "self-hosted"
+		p.config.approximated("type", "%s is a '%s' pipeline, which runs on the host; it becomes a job on a self-hosted runner", where, t)
+	}
+
+	job.Matrix = p.parseMatrix(where, pd["matrix"])
+	// Matrix variables are substituted in the config and set in the
+	// environment, so escaped references read them too
+	var alts []string
+	if job.Matrix != nil {
+		for _, v := range job.Matrix.Variables() {
+			q := regexp.QuoteMeta(v)
+			alts = append(alts, `\$\$?\{`+q+`\}`, `\$\$?`+q+`\b`)
+		}
+	}
+	p.refs = regexp.MustCompile(strings.Join(append(alts, `\$\$`), "|"))
+	job.Environment = p.env(pd["environment"])
+
+	var filter droneFilter
+	if p.platform == Woodpecker {
+		filter = p.filter(where, pd["when"])
+		if deps := flattenScript(listOf(pd["depends_on"])); len(deps) > 0 {
+			p.config.dropped("depends_on", "%s depends on workflows %s in other files; convert them too and add them to needs", where, strings.Join(deps, ", "))
+		}
+	} else {
+		filter = p.filter(where, pd["trigger"])
+		for _, dep := range flattenScript(listOf(pd["depends_on"])) {
+			job.DependsOn = append(job.DependsOn, sanitizeName(dep))
+		}
+	}
+	if status := droneStatus(flattenScript(listOf(pd["runs_on"]))); status != "" {
+		filter.condition = andConditions([]string{status, filter.condition})
+		filter.exact = false
+	}
+	if len(filter.targets) > 0 {
+		job.Gate = &Gate{Environment: filter.targets[0]}
+		p.config.approximated("promote", "%s runs on promotion to %s; it becomes a manually started job in environment '%s'", where, strings.Join(filter.targets, ", "), filter.targets[0])
+	}
+
+	for _, sm := range droneItems(root, "services") {
+		job.Services = append(job.Services, p.service(where, sm))
+	}
+
+	steps := droneItems(root, "steps")
+	if len(steps) == 0 {
+		steps = droneItems(root, "pipeline")
+	}
+	// The first command step's image becomes the job's container
+	for _, sm := range steps {
+		if getString(sm, "image") != "" && sm["commands"] != nil && fmt.Sprint(sm["detach"]) != "true" {
+			job.Container = &Container{Image: p.text(getString(sm, "image"))}
+			break
+		}
+	}
+	graph := false
+	for _, sm := range steps {
+		if sm["depends_on"] != nil {
+			graph = true
+		}
+		p.parseStep(&job, where, sm)
+	}
+	if graph {
+		p.config.approximated("depends_on", "steps of %s declare depends_on; they run one after another in the order written", where)
+	}
+	return job, filter
+}
+
+// parseStep adds a step's commands, plugin or detached service to job
+func (p *droneParser) parseStep(job *Job, where string, sm map[string]interface{}) {
+	name := getString(sm, "name")
+	stepWhere := fmt.Sprintf("step '%s' in %s", name, where)
+	p.config.dropKeys(stepWhere, sm, keySet("name", "image", "commands", "environment", "settings", "secrets", "when", "depends_on", "detach", "directory", "pull", "failure"))
+
+	image := p.text(getString(sm, "image"))
+	env := p.env(sm["environment"])
+	for _, s := range listOf(sm["secrets"]) {
+		from, to := fmt.Sprint(s), fmt.Sprint(s)
+		if m, ok := s.(map[string]interface{}); ok {
+			from, to = getString(m, "source"), getString(m, "target")
+		}
+		if env == nil {
+			env = make(map[string]string)
+		}
+		env[strings.ToUpper(to)] = droneSecret(from)
+	}
+	commands := flattenScript(listOf(sm["commands"]))
+	for i, cmd := range commands {
+		commands[i] = p.text(cmd)
+	}
+
+	if fmt.Sprint(sm["detach"]) == "true" {
+		if len(commands) > 0 {
+			p.config.approximated("detach", "detached %s becomes a service; its commands are not run", stepWhere)
+		}
+		job.Services = append(job.Services, Service{Name: name, Image: image, Env: env})
+		return
+	}
+	if getString(sm, "failure") == "ignore" {
+		p.config.dropped("failure", "%s may fail without failing the pipeline; it now fails the job", stepWhere)
+	}
+
+	condition := ""
+	if w, ok := sm["when"]; ok {
+		f := p.filter(stepWhere, w)
+		condition = f.condition
+		if len(f.targets) > 0 {
+			p.config.approximated("promote", "%s runs on promotion to %s; it now runs when the workflow is started by hand", stepWhere, strings.Join(f.targets, ", "))
+		}
+	}
+	workDir := p.text(getString(sm, "directory"))
+
+	// Plugins are images configured through PLUGIN_ variables
+	if settings, ok := sm["settings"].(map[string]interface{}); ok || (len(commands) == 0 && image != "") {
+		if env == nil {
+			env = make(map[string]string)
+		}
+		for k, v := range settings {
+			env["PLUGIN_"+nonVarChars.ReplaceAllString(strings.ToUpper(k), "_")] = p.setting(v)
+		}
+		p.config.approximated("plugin", "%s runs plugin %s as a container step; check it works there or replace it with an action", stepWhere, image)
+		job.Steps = append(job.Steps, Step{Name: name, Image: image, Env: env, If: condition})
+		return
+	}
+
+	if image != "" && (job.Container == nil || image != job.Container.Image) {
+		if workDir != "" {
+			commands = append([]string{"cd " + workDir}, commands...)
+		}
+		quoted := strings.ReplaceAll(strings.Join(commands, " && "), "'", `'"'"'`)
+		job.Steps = append(job.Steps, Step{Name: name, Image: image, Run: "sh -c '" + quoted + "'", Env: env, If: condition})
+		return
+	}
+	for i, cmd := range commands {
+		step := Step{Run: cmd, Env: env, If: condition, WorkDir: workDir}
+		if i == 0 {
+			step.Name = name
+		}
+		job.Steps = append(job.Steps, step)
+	}
+}
+
+// service reads a services: entry; services are reachable by name
+func (p *droneParser) service(where string, sm map[string]interface{}) Service {
+	svc := Service{Name: getString(sm, "name"), Image: p.text(getString(sm, "image")), Env: p.env(sm["environment"])}
+	p.config.dropKeys(fmt.Sprintf("service '%s' in %s", svc.Name, where), sm, keySet("name", "image", "environment", "ports"))
+	for _, port := range flattenScript(listOf(sm["ports"])) {
+		if !strings.Contains(port, ":") {
+			port = port + ":" + port
+		}
+		svc.Ports = append(svc.Ports, port)
+	}
+	return svc
+}
+
+// parseMatrix reads a Woodpecker matrix: axes, or include: combinations
+func (p *droneParser) parseMatrix(where string, v interface{}) *Matrix {
+	mm, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	m := &Matrix{Axes: make(map[string][]string)}
+	for name, values := range mm {
+		if name == "include" {
+			m.Include = matrixEntries(p.config, where, values)
+			continue
+		}
+		m.Axes[name] = matrixValues(p.config, where, values)
+	}
+	return m
+}
+
+// text undoes the $$ escaping of commands and values and turns matrix
+// variables into ${{ matrix.x }}
+func (p *droneParser) text(s string) string {
+	return p.refs.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		return "${{ matrix." + strings.Trim(ref, "${}") + " }}"
+	})
+}
+
+// env reads environment: values; {from_secret: name} reads a secret
+func (p *droneParser) env(v interface{}) map[string]string {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	env := make(map[string]string, len(m))
+	for k, val := range m {
+		env[k] = p.setting(val)
+	}
+	return env
+}
+
+// setting reads a plugin setting the way Drone passes it: lists joined with
+// commas and objects as JSON
+func (p *droneParser) setting(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		if name := getString(s, "from_secret"); name != "" {
+			return droneSecret(name)
+		}
+		out, _ := json.Marshal(s)
+		return string(out)
+	case []interface{}:
+		var items []string
+		for _, item := range s {
+			items = append(items, p.setting(item))
+		}
+		return strings.Join(items, ",")
+	}
+	return p.text(fmt.Sprint(v))
+}
+
+// droneSecret references a Drone or Woodpecker secret as a GitHub secret
+func droneSecret(name string) string {
+	return fmt.Sprintf("${{ secrets.%s }}", nonVarChars.ReplaceAllString(strings.ToUpper(name), "_"))
+}
+
+// droneItems returns the entries of a steps: or services: section in the
+// order written. Drone lists them; Woodpecker also takes a map by name.
+func droneItems(root *yaml.Node, key string) []map[string]interface{} {
+	var section *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			section = root.Content[i+1]
+		}
+	}
+	if section == nil {
+		return nil
+	}
+	var items []map[string]interface{}
+	switch section.Kind {
+	case yaml.SequenceNode:
+		for _, n := range section.Content {
+			if m, ok := rawNode(n).(map[string]interface{}); ok {
+				items = append(items, m)
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(section.Content); i += 2 {
+			if m, ok := rawNode(section.Content[i+1]).(map[string]interface{}); ok {
+				if getString(m, "name") == "" {
+					m["name"] = section.Content[i].Value
+				}
+				items = append(items, m)
+			}
+		}
+	}
+	return items
+}
+
+// filter reads a trigger: or when: block. Woodpecker takes a list of
+// blocks, any of which can match.
+func (p *droneParser) filter(where string, v interface{}) droneFilter {
+	f := droneFilter{exact: true}
+	var alternatives []string
+	for _, item := range listOf(v) {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		p.config.dropKeys(where+" trigger", m, keySet("branch", "event", "ref", "status", "target", "environment", "cron", "path"))
+
+		var parts []string
+		events, skipEvents := droneIncludes(m["event"])
+		var eventConds []string
+		for _, e := range events {
+			cond, ok := droneEvents[e]
+			if !ok {
+				p.config.dropped("event", "%s: event '%s' is not converted", where, e)
+				continue
+			}
+			if !containsString(eventConds, cond) {
+				eventConds = append(eventConds, cond)
+			}
+			if e == "tag" || e == "cron" {
+				f.exact = false
+			}
+		}
+		if len(eventConds) > 0 {
+			parts = append(parts, strings.Join(eventConds, " || "))
+		}
+		for _, e := range skipEvents {
+			if cond, ok := droneEvents[e]; ok {
+				parts = append(parts, negateCondition(cond))
+			}
+		}
+
+		// On pull requests the branch is the one merged into
+		ref := "github.ref_name"
+		if len(events) == 1 && events[0] == "pull_request" {
+			ref = "github.base_ref"
+		}
+		branches, skipBranches := droneIncludes(m["branch"])
+		var branchConds []string
+		for _, b := range branches {
+			if cond := globCondition(p.config, ref, b); cond != "" {
+				branchConds = append(branchConds, cond)
+			}
+		}
+		f.matches = append(f.matches, droneMatch{events: events, branches: branches})
+		if len(branchConds) > 0 {
+			parts = append(parts, strings.Join(branchConds, " || "))
+		}
+		for _, b := range skipBranches {
+			if cond := globCondition(p.config, ref, b); cond != "" {
+				parts = append(parts, negateCondition(cond))
+			}
+		}
+
+		refs, skipRefs := droneIncludes(m["ref"])
+		var refConds []string
+		for _, r := range refs {
+			if cond := globCondition(p.config, "github.ref", r); cond != "" {
+				refConds = append(refConds, cond)
+			}
+		}
+		if len(refConds) > 0 {
+			parts = append(parts, strings.Join(refConds, " || "))
+		}
+		for _, r := range skipRefs {
+			if cond := globCondition(p.config, "github.ref", r); cond != "" {
+				parts = append(parts, negateCondition(cond))
+			}
+		}
+		if len(skipEvents) > 0 || len(skipBranches) > 0 || len(refs) > 0 || len(skipRefs) > 0 {
+			f.exact = false
+		}
+
+		statuses, _ := droneIncludes(m["status"])
+		if status := droneStatus(statuses); status != "" {
+			parts = append([]string{status}, parts...)
+			f.exact = false
+		}
+		for _, key := range []string{"target", "environment"} {
+			targets, _ := droneIncludes(m[key])
+			f.targets = append(f.targets, targets...)
+		}
+		if crons, _ := droneIncludes(m["cron"]); len(crons) > 0 {
+			p.config.dropped("cron", "%s runs for cron jobs %s; add a schedule trigger with their times", where, strings.Join(crons, ", "))
+		}
+		if m["path"] != nil {
+			p.config.dropped("path", "%s only runs when certain files change; add a paths filter to the trigger", where)
+		}
+		alternatives = append(alternatives, andConditions(parts))
+	}
+	for _, alt := range alternatives {
+		if alt == "" {
+			// One block matches everything
+			return f
+		}
+	}
+	if len(alternatives) > 0 {
+		f.condition = orConditions(alternatives)
+	}
+	return f
+}
+
+// droneIncludes reads a filter given as a value, a list or {include, exclude}
+func droneIncludes(v interface{}) (include, exclude []string) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return flattenScript(listOf(m["include"])), flattenScript(listOf(m["exclude"]))
+	}
+	return flattenScript(listOf(v)), nil
+}
+
+// droneStatus is the status function matching a status filter
+func droneStatus(statuses []string) string {
+	if !containsString(statuses, "failure") {
+		return ""
+	}
+	if containsString(statuses, "success") {
+		return "always()"
+	}
+	return "failure()"
+}
+
+// andConditions joins conditions, wrapping those with || so they bind first
+func andConditions(conds []string) string {
+	var parts []string
+	for _, c := range conds {
+		if c == "" {
+			continue
+		}
+		parts = append(parts, c)
+	}
+	if len(parts) > 1 {
+		for i, c := range parts {
+			if strings.Contains(c, " || ") {
+				parts[i] = "(" + c + ")"
+			}
+		}
+	}
+	return strings.Join(parts, " && ")
+}
+
+// droneTriggers lists the events that start any pipeline. Branch filters
+// are kept when every pipeline the event starts has one.
+func droneTriggers(config *PipelineConfig, filters []droneFilter) []Trigger {
+	type trigger struct {
+		seen, any bool
+		branches  []string
+	}
+	triggers := make(map[string]*trigger)
+	var matches []droneMatch
+	for _, f := range filters {
+		matches = append(matches, f.matches...)
+		if len(f.matches) == 0 {
+			matches = append(matches, droneMatch{})
+		}
+	}
+	for _, match := range matches {
+		events := match.events
+		if len(events) == 0 {
+			events = []string{"push", "pull_request"}
+		}
+		for _, e := range events {
+			var kind string
+			switch e {
+			case "push", "tag":
+				kind = "push"
+			case "pull_request":
+				kind = "pull_request"
+			case "custom", "manual", "promote", "rollback", "deployment":
+				kind = "manual"
+			default:
+				continue
+			}
+			t, ok := triggers[kind]
+			if !ok {
+				t = &trigger{}
+				triggers[kind] = t
+			}
+			t.seen = true
+			if len(match.branches) == 0 || e == "tag" {
+				t.any = true
+			}
+			for _, b := range match.branches {
+				if !containsString(t.branches, b) {
+					t.branches = append(t.branches, b)
+				}
+			}
+		}
+	}
+
+	var out []Trigger
+	for _, kind := range []string{"push", "pull_request", "manual"} {
+		t, ok := triggers[kind]
+		if !ok {
+			continue
+		}
+		trigger := Trigger{Type: kind}
+		if !t.any && kind != "manual" {
+			trigger.Branches = t.branches
+		}
+		out = append(out, trigger)
+	}
+	if len(out) == 0 {
+		config.note("no pipeline runs on push or pull request; the workflow is started by hand")
+		out = append(out, Trigger{Type: "manual"})
+	}
+	return out
+}
+
+// generateDrone generates a .drone.yml with one pipeline per job, or a
+// Woodpecker workflow. A workflow is a single pipeline, so its jobs become
+// groups of steps that run in dependency order.
+func (c *Converter) generateDrone(config *PipelineConfig, platform Platform) (string, error) {
+	g := &droneGenerator{config: config, platform: platform, env: make(map[string]string), secrets: make(map[string]string)}
+	for k, v := range config.Environment {
+		if name := settingName(v); name != "" {
+			g.secrets[k] = name
+			continue
+		}
+		g.env[k] = v
+	}
+
+	if platform == Woodpecker {
+		return marshalYAML(config.Comment, g.woodpecker())
+	}
+	return marshalYAML(config.Comment, g.drone()...)
+}
+
+// dronePipeline is a pipeline document of a .drone.yml
+type dronePipeline struct {
+	Kind      string         `yaml:"kind"`
+	Type      string         `yaml:"type"`
+	Name      string         `yaml:"name"`
+	Trigger   yamlMap        `yaml:"trigger,omitempty"`
+	Services  []droneService `yaml:"services,omitempty"`
+	Steps     []droneSpec    `yaml:"steps"`
+	DependsOn []string       `yaml:"depends_on,omitempty"`
+}
+
+// woodpeckerWorkflow is a Woodpecker workflow file
+type woodpeckerWorkflow struct {
+	When     []yamlMap      `yaml:"when,omitempty"`
+	Matrix   yamlMap        `yaml:"matrix,omitempty"`
+	Services []droneService `yaml:"services,omitempty"`
+	Steps    []droneSpec    `yaml:"steps"`
+}
+
+type droneService struct {
+	Name        string       `yaml:"name"`
+	Image       string       `yaml:"image"`
+	Environment yamlMap      `yaml:"environment,omitempty"`
+	Ports       []*yaml.Node `yaml:"ports,omitempty"`
+}
+
+// droneSpec is a generated step as written out
+type droneSpec struct {
+	carried
+	Name        string    `yaml:"name"`
+	Image       string    `yaml:"image"`
+	Directory   string    `yaml:"directory,omitempty"`
+	Environment yamlMap   `yaml:"environment,omitempty"`
+	Settings    yamlMap   `yaml:"settings,omitempty"`
+	Commands    *yamlList `yaml:"commands,omitempty"`
+	When        yamlMap   `yaml:"when,omitempty"`
+}
+
+type droneGenerator struct {
+	config   *PipelineConfig
+	platform Platform
+	env      map[string]string
+	secrets  map[string]string // variables bound to a secret of the same or another name
+}
+
+// droneStep is a step being generated: commands, or a plugin's settings
+type droneStep struct {
+	name     string
+	image    string
+	commands []string
+	env      map[string]string
+	settings map[string]string
+	cond     string
+	workDir  string
+	comment  string
+}
+
+func (g *droneGenerator) drone() []interface{} {
+	var docs []interface{}
+	trigger := g.droneTrigger()
+	for _, job := range g.config.Jobs {
+		pipeline := dronePipeline{Kind: "pipeline", Type: "docker", Name: job.Name, Trigger: g.jobWhen(job, trigger).yaml()}
+		pipeline.Services = g.services(job.Services)
+		if _, producers := artifactDownloads(g.config, job); len(producers) > 0 {
+			g.config.dropped("download-artifact", "job '%s' downloads artifacts of %s; Drone pipelines do not share a workspace, so hand them over through a volume or a storage plugin", job.Name, strings.Join(producers, ", "))
+		}
+		if producers := outputProducers(g.config, job); len(producers) > 0 {
+			g.config.dropped("outputs", "job '%s' reads outputs of %s; Drone pipelines do not share a workspace, so pass them another way", job.Name, strings.Join(producers, ", "))
+		}
+		g.keptArtifacts(job)
+
+		pipeline.Steps = g.steps(job, g.jobSteps(job), "", newDroneWhen(), make(map[string]bool))
+		pipeline.DependsOn = job.DependsOn
+		docs = append(docs, commented{job.Comment, pipeline})
+	}
+	return docs
+}
+
+func (g *droneGenerator) woodpecker() woodpeckerWorkflow {
+	var wf woodpeckerWorkflow
+	whens := g.triggerWhens()
+	for _, job := range g.config.Jobs {
+		if job.Gate != nil {
+			w := newDroneWhen()
+			w.add("event", "deployment")
+			whens = append(whens, w)
+			break
+		}
+	}
+	for _, w := range whens {
+		if entry := w.yaml(); len(entry) > 0 {
+			wf.When = append(wf.When, entry)
+		}
+	}
+
+	// lowerMatrices keeps the matrix of a single job for the workflow
+	if len(g.config.Jobs) == 1 && g.config.Jobs[0].Matrix != nil {
+		m := g.config.Jobs[0].Matrix
+		if len(m.Include) > 0 || len(m.Exclude) > 0 {
+			wf.Matrix.set("include", matrixList(m.Combinations(), false))
+		} else {
+			for _, name := range m.axisNames() {
+				values := flowSeq(m.Axes[name], false)
+				values.Style = 0
+				wf.Matrix.set(name, values)
+			}
+		}
+	}
+
+	var services []Service
+	seen := make(map[string]bool)
+	for _, job := range g.config.Jobs {
+		for _, svc := range job.Services {
+			if !seen[svc.Name] {
+				seen[svc.Name] = true
+				services = append(services, svc)
+			}
+		}
+	}
+	wf.Services = g.services(services)
+
+	// Steps run one after another, so jobs come after the jobs they need
+	downloaded := downloadedJobs(g.config)
+	names := make(map[string]bool)
+	wf.Steps = []droneSpec{}
+	for _, job := range droneJobOrder(g.config.Jobs) {
+		prefix := ""
+		if len(g.config.Jobs) > 1 {
+			prefix = job.Name + "/"
+		}
+		workspaceDownloads(g.config, job, "Woodpecker")
+		if !downloaded[job.Name] {
+			g.keptArtifacts(job)
+		}
+		steps := g.jobSteps(job)
+		if producers := outputProducers(g.config, job); len(producers) > 0 {
+			// Every step is a new shell; job outputs wait in the workspace
+			var load []string
+			for _, producer := range producers {
+				load = append(load, fmt.Sprintf("set -a && . %s && set +a", jobOutputFile(producer)))
+			}
+			for i := range steps {
+				if len(steps[i].commands) > 0 {
+					steps[i].commands = append(append([]string{}, load...), steps[i].commands...)
+				}
+			}
+		}
+		wf.Steps = append(wf.Steps, g.steps(job, steps, prefix, g.jobWhen(job, newDroneWhen()), names)...)
+	}
+	return wf
+}
+
+// keptArtifacts records artifacts that only the GitHub UI would keep
+func (g *droneGenerator) keptArtifacts(job Job) {
+	var names []string
+	for _, a := range jobArtifacts(job) {
+		names = append(names, a.Name)
+	}
+	if len(names) > 0 {
+		g.config.dropped("upload-artifact", "job '%s' uploads %s; %s keeps no artifacts, so publish them with a plugin such as plugins/s3", job.Name, strings.Join(names, ", "), g.platform)
+	}
+}
+
+// jobSteps turns a job's steps into Drone steps. Consecutive unnamed
+// commands with the same settings share a step, as they would in Drone.
+func (g *droneGenerator) jobSteps(job Job) []droneStep {
+	image := droneDefaultImage
+	if job.Container != nil {
+		image = job.Container.Image
+	}
+
+	var steps []droneStep
+	for _, step := range job.Steps {
+		ds := droneStep{name: step.Name, image: image, env: step.Env, cond: step.If, workDir: step.WorkDir, comment: step.Comment}
+		switch {
+		case step.Image != "":
+			ds.image, ds.env, ds.settings = step.Image, make(map[string]string), make(map[string]string)
+			for k, v := range step.Env {
+				if strings.HasPrefix(k, "PLUGIN_") {
+					ds.settings[strings.ToLower(strings.TrimPrefix(k, "PLUGIN_"))] = v
+				} else {
+					ds.env[k] = v
+				}
+			}
+			switch {
+			case strings.HasPrefix(step.Run, "sh -c '") && strings.HasSuffix(step.Run, "'"):
+				script := strings.ReplaceAll(step.Run[len("sh -c '"):len(step.Run)-1], `'"'"'`, "'")
+				ds.commands = strings.Split(script, " && ")
+			case step.Run != "":
+				ds.commands = []string{step.Run}
+				g.config.approximated("container step", "job '%s' runs %s with arguments '%s'; %s runs them as shell commands instead of through the image's entrypoint", job.Name, step.Image, step.Run, g.platform)
+			}
+			steps = append(steps, ds)
+			continue
+		case step.Run != "":
+			ds.commands = []string{shellOutputs(step.Run, step)}
+		case step.Uses != "":
+			cmd := convertActionToCommand(step)
+			if cmd == "" {
+				continue
+			}
+			ds.commands = []string{cmd}
+		default:
+			continue
+		}
+		if n := len(steps); n > 0 && step.Name == "" && steps[n-1].settings == nil && steps[n-1].image == ds.image &&
+			steps[n-1].cond == ds.cond && steps[n-1].workDir == ds.workDir && reflect.DeepEqual(steps[n-1].env, ds.env) {
+			steps[n-1].commands = append(steps[n-1].commands, ds.commands...)
+			steps[n-1].comment = joinComments(steps[n-1].comment, ds.comment)
+			continue
+		}
+		steps = append(steps, ds)
+	}
+
+	if job.Container == nil && len(steps) > 0 {
+		g.config.approximated("runs-on", "job '%s' runs on %s; %s runs steps in containers, so it uses %s", job.Name, job.RunsOn, g.platform, droneDefaultImage)
+	}
+	if job.Container == nil && len(job.Services) > 0 && usesLocalhost(job) {
+		g.config.note("job '%s' reaches its services on localhost; on %s they are reachable by name (%s)", job.Name, g.platform, serviceNames(job))
+	}
+	if writesOutputs(job) {
+		if len(steps) > 0 && len(steps[0].commands) > 0 {
+			steps[0].commands = append([]string{"mkdir -p " + outputDir}, steps[0].commands...)
+		}
+		if commands := jobOutputCommands(job); len(commands) > 0 {
+			if g.platform == Drone {
+				g.config.dropped("outputs", "job '%s' sets outputs; Drone pipelines do not share a workspace, so later pipelines cannot read them", job.Name)
+			} else {
+				steps = append(steps, droneStep{name: "outputs", image: image, commands: commands})
+			}
+		}
+	}
+	return steps
+}
+
+// steps names steps uniquely in the pipeline; when holds the job's
+// conditions, which every step repeats on Woodpecker
+func (g *droneGenerator) steps(job Job, steps []droneStep, prefix string, when droneWhen, names map[string]bool) []droneSpec {
+	var specs []droneSpec
+	for i, ds := range steps {
+		name := ds.name
+		if name == "" {
+			name = job.Name
+			if i > 0 {
+				name = fmt.Sprintf("%s-%d", job.Name, i+1)
+			}
+		}
+		name = prefix + g.escape(name)
+		for n := 2; names[name]; n++ {
+			name = fmt.Sprintf("%s%s-%d", prefix, g.escape(ds.name), n)
+		}
+		names[name] = true
+
+		comment := ds.comment
+		if i == 0 && g.platform == Woodpecker {
+			// Drone writes it above the job's pipeline instead
+			comment = joinComments(job.Comment, comment)
+		}
+		spec := droneSpec{carried: carried{comment}, Name: name, Image: g.escape(ds.image)}
+		commands := ds.commands
+		if ds.workDir != "" {
+			if g.platform == Woodpecker {
+				spec.Directory = g.escape(ds.workDir)
+			} else {
+				commands = append([]string{"cd " + ds.workDir}, commands...)
+			}
+		}
+
+		env := make(map[string]string)
+		for _, m := range []map[string]string{g.env, job.Environment, ds.env} {
+			for k, v := range m {
+				env[k] = v
+			}
+		}
+		if job.Container != nil && ds.image == job.Container.Image {
+			for k, v := range job.Container.Env {
+				env[k] = v
+			}
+		}
+		// Steps only get the secrets they read
+		text := strings.Join(commands, "\n")
+		for _, m := range []map[string]string{env, ds.settings} {
+			for _, v := range m {
+				if whole := variablePattern.FindString(v); whole != v {
+					text += "\n" + v
+				}
+			}
+		}
+		for _, m := range variablePattern.FindAllStringSubmatch(text, -1) {
+			name := variableName(m)
+			if _, set := env[name]; !set && g.secrets[name] != "" {
+				env[name] = "$" + name
+			}
+		}
+		spec.Environment = g.values(job.Name, env)
+		spec.Settings = g.values(job.Name, ds.settings)
+
+		if len(commands) > 0 {
+			escaped := make([]string, len(commands))
+			for j, cmd := range commands {
+				escaped[j] = g.escape(cmd)
+			}
+			spec.Commands = bitbucketScript(escaped)
+		}
+
+		stepWhen, ok := g.conditionWhen(ds.cond)
+		if !ok {
+			g.config.dropped("if", "step in job '%s' has condition '%s'; %s runs it unconditionally", job.Name, ds.cond, g.platform)
+		}
+		spec.When = when.merge(stepWhen).yaml()
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+type droneFromSecret struct {
+	FromSecret string `yaml:"from_secret"`
+}
+
+// values is environment: or settings:. Values that are a secret are read
+// from_secret; Drone does not expand other variables there.
+func (g *droneGenerator) values(job string, values map[string]string) yamlMap {
+	var out yamlMap
+	for _, k := range sortedKeys(values) {
+		v := values[k]
+		secret := settingName(v)
+		if m := variablePattern.FindStringSubmatch(v); m != nil && m[0] == v {
+			if s, ok := g.secrets[variableName(m)]; ok {
+				secret = s
+			}
+		}
+		if secret != "" {
+			out.set(k, droneFromSecret{FromSecret: secret})
+			continue
+		}
+		if (strings.HasPrefix(v, "{") || strings.HasPrefix(v, "[")) && json.Valid([]byte(v)) {
+			// JSON is a YAML flow collection, so it goes in as written
+			var doc yaml.Node
+			if yaml.Unmarshal([]byte(v), &doc) == nil && len(doc.Content) > 0 {
+				out.set(k, doc.Content[0])
+				continue
+			}
+		}
+		out.set(k, g.value(job, v))
+	}
+	return out
+}
+
+// escape doubles $ so Drone leaves variables to the shell. Woodpecker
+// substitutes matrix variables itself.
+func (g *droneGenerator) escape(s string) string {
+	s = strings.ReplaceAll(s, "$", "$$")
+	if g.platform == Woodpecker {
+		s = droneMatrixRef.ReplaceAllStringFunc(s, func(ref string) string {
+			return "${" + droneMatrixRef.FindStringSubmatch(ref)[1] + "}"
+		})
+	}
+	return s
+}
+
+// value escapes an environment or settings value. Drone substitutes its
+// own variables there; other references stay text.
+func (g *droneGenerator) value(job, s string) string {
+	return droneVariableRef.ReplaceAllStringFunc(g.escape(s), func(ref string) string {
+		m := droneVariableRef.FindStringSubmatch(ref)
+		name := m[1] + m[2]
+		if isBuiltin(g.platform, name) {
+			return "${" + name + "}"
+		}
+		g.config.approximated("environment", "job '%s' sets a value from $%s; %s does not expand variables in environment: or settings:, so it is passed as text", job, name, g.platform)
+		return ref
+	})
+}
+
+func (g *droneGenerator) services(services []Service) []droneService {
+	var out []droneService
+	for _, svc := range services {
+		ds := droneService{Name: svc.Name, Image: g.escape(svc.Image), Environment: g.values(svc.Name, svc.Env)}
+		if g.platform == Woodpecker {
+			for _, port := range svc.Ports {
+				parts := strings.Split(port, ":")
+				ds.Ports = append(ds.Ports, keptScalar(parts[len(parts)-1], false))
+			}
+		}
+		out = append(out, ds)
+	}
+	return out
+}
+
+// droneJobOrder sorts jobs so each comes after the jobs it needs
+func droneJobOrder(jobs []Job) []Job {
+	byName := make(map[string]Job)
+	for _, job := range jobs {
+		byName[job.Name] = job
+	}
+	var order []Job
+	done := make(map[string]bool)
+	var visit func(job Job)
+	visit = func(job Job) {
+		if done[job.Name] {
+			return
+		}
+		done[job.Name] = true
+		for _, dep := range job.DependsOn {
+			if d, ok := byName[dep]; ok {
+				visit(d)
+			}
+		}
+		order = append(order, job)
+	}
+	for _, job := range jobs {
+		visit(job)
+	}
+	return order
+}
+
+// droneWhen is a generated trigger: or when: block: the values each key
+// matches and the values it must not match
+type droneWhen struct {
+	include map[string][]string
+	exclude map[string][]string
+}
+
+func newDroneWhen() droneWhen {
+	return droneWhen{include: make(map[string][]string), exclude: make(map[string][]string)}
+}
+
+func (w droneWhen) add(key string, values ...string) {
+	for _, v := range values {
+		if !containsString(w.include[key], v) {
+			w.include[key] = append(w.include[key], v)
+		}
+	}
+}
+
+func (w droneWhen) skip(key string, values ...string) {
+	for _, v := range values {
+		if !containsString(w.exclude[key], v) {
+			w.exclude[key] = append(w.exclude[key], v)
+		}
+	}
+}
+
+// merge returns w with the keys other matches replaced by other's values
+func (w droneWhen) merge(other droneWhen) droneWhen {
+	out := newDroneWhen()
+	for _, m := range []droneWhen{w, other} {
+		for k, v := range m.include {
+			out.include[k] = append([]string{}, v...)
+		}
+		for k, v := range m.exclude {
+			out.skip(k, v...)
+		}
+	}
+	return out
+}
+
+type droneFilterSpec struct {
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// yaml is the block as written out: a list of values per key, or include:
+// and exclude: lists when the key has values to skip
+func (w droneWhen) yaml() yamlMap {
+	keys := make(map[string]string)
+	for k := range w.include {
+		keys[k] = ""
+	}
+	for k := range w.exclude {
+		keys[k] = ""
+	}
+	var out yamlMap
+	for _, k := range sortedKeys(keys) {
+		if len(w.exclude[k]) == 0 {
+			out.set(k, w.include[k])
+			continue
+		}
+		out.set(k, droneFilterSpec{Include: w.include[k], Exclude: w.exclude[k]})
+	}
+	return out
+}
+
+// triggerWhens has a when: entry for each workflow trigger
+func (g *droneGenerator) triggerWhens() []droneWhen {
+	var whens []droneWhen
+	for _, t := range g.config.Triggers {
+		w := newDroneWhen()
+		switch t.Type {
+		case "push":
+			w.add("event", "push")
+			if len(t.Branches) == 0 {
+				w.add("event", "tag")
+			}
+		case "pull_request":
+			w.add("event", "pull_request")
+		case "manual":
+			w.add("event", g.manualEvent())
+		case "schedule":
+			w.add("event", "cron")
+			g.config.note("create a cron job on %s for schedule '%s'", g.platform, t.Cron)
+		default:
+			continue
+		}
+		w.add("branch", t.Branches...)
+		if len(t.Paths) > 0 {
+			if g.platform == Woodpecker {
+				w.add("path", t.Paths...)
+			} else {
+				g.config.dropped("paths", "the %s trigger only runs for changes to %s; Drone has no path filter", t.Type, strings.Join(t.Paths, ", "))
+			}
+		}
+		whens = append(whens, w)
+	}
+	return whens
+}
+
+// droneTrigger merges the workflow triggers into one Drone trigger. Branch
+// filters are kept when every push and pull request trigger has one.
+func (g *droneGenerator) droneTrigger() droneWhen {
+	trigger := newDroneWhen()
+	filtered := true
+	var branches [][]string
+	for _, w := range g.triggerWhens() {
+		trigger.add("event", w.include["event"]...)
+		if !containsString(w.include["event"], "push") && !containsString(w.include["event"], "pull_request") {
+			continue
+		}
+		if len(w.include["branch"]) == 0 {
+			filtered = false
+		}
+		branches = append(branches, w.include["branch"])
+	}
+	if !filtered {
+		return trigger
+	}
+	for _, b := range branches {
+		if !reflect.DeepEqual(b, branches[0]) {
+			g.config.approximated("branches", "the triggers filter different branches; the Drone trigger matches all of them for every event")
+		}
+		trigger.add("branch", b...)
+	}
+	return trigger
+}
+
+func (g *droneGenerator) manualEvent() string {
+	if g.platform == Woodpecker {
+		return "manual"
+	}
+	return "custom"
+}
+
+// jobWhen adds a job's condition and gate to trigger
+func (g *droneGenerator) jobWhen(job Job, trigger droneWhen) droneWhen {
+	w, ok := g.conditionWhen(job.Condition)
+	if !ok {
+		g.config.dropped("if", "job '%s' has condition '%s'; %s cannot express it, so the job runs whenever the pipeline does", job.Name, job.Condition, g.platform)
+	}
+	w = trigger.merge(w)
+	if job.Gate != nil {
+		env := job.Gate.Environment
+		if env == "" {
+			env = sanitizeName(job.Name)
+		}
+		if g.platform == Woodpecker {
+			w.include["event"] = []string{"deployment"}
+			w.include["environment"] = []string{env}
+			g.config.approximated("environment", "job '%s' waits for environment '%s'; on Woodpecker it runs when a build is deployed there (woodpecker-cli deploy)", job.Name, env)
+		} else {
+			w.include["event"] = []string{"promote"}
+			w.include["target"] = []string{env}
+			g.config.approximated("environment", "job '%s' waits for environment '%s'; on Drone it runs when a build is promoted there (drone build promote)", job.Name, env)
+		}
+		if len(job.Gate.Approvers) > 0 {
+			g.config.note("job '%s' needs approval from %s; limit who can promote builds on %s", job.Name, strings.Join(job.Gate.Approvers, ", "), g.platform)
+		}
+	}
+	return w
+}
+
+// conditionWhen turns a GitHub condition into a when: block. Conjunctions
+// of event, branch, tag and status checks can be expressed, each of which
+// can be a choice between values of one key.
+func (g *droneGenerator) conditionWhen(cond string) (droneWhen, bool) {
+	w := newDroneWhen()
+	for _, atom := range splitConditions(cond, "&&") {
+		if len(splitConditions(atom, "&&")) > 1 {
+			inner, ok := g.conditionWhen(atom)
+			if !ok {
+				return w, false
+			}
+			for k, v := range inner.include {
+				w.add(k, v...)
+			}
+			for k, v := range inner.exclude {
+				w.skip(k, v...)
+			}
+			continue
+		}
+		alts := splitConditions(atom, "||")
+		if len(alts) == 1 {
+			if !g.whenAtom(w, atom, false) {
+				return w, false
+			}
+			continue
+		}
+		choice := newDroneWhen()
+		for _, alt := range alts {
+			if !g.whenAtom(choice, alt, true) {
+				return w, false
+			}
+		}
+		if len(choice.include) != 1 {
+			return w, false
+		}
+		for k, v := range choice.include {
+			w.add(k, v...)
+		}
+	}
+	return w, true
+}
+
+// whenAtom adds a single check to w; in a choice, negations cannot be
+// expressed
+func (g *droneGenerator) whenAtom(w droneWhen, atom string, choice bool) bool {
+	events := map[string]string{
+		"push": "push", "pull_request": "pull_request", "pull_request_target": "pull_request",
+		"workflow_dispatch": g.manualEvent(), "schedule": "cron",
+	}
+	switch {
+	case eventPattern.MatchString(atom):
+		m := eventPattern.FindStringSubmatch(atom)
+		event, ok := events[m[2]]
+		if !ok || (m[1] == "!=" && choice) {
+			return false
+		}
+		if m[1] == "!=" {
+			w.skip("event", event)
+		} else {
+			w.add("event", event)
+		}
+	case refNamePattern.MatchString(atom):
+		w.add("branch", refNamePattern.FindStringSubmatch(atom)[1])
+	case refPrefixPattern.MatchString(atom):
+		w.add("branch", refPrefixPattern.FindStringSubmatch(atom)[1]+"*")
+	case baseRefPattern.MatchString(atom):
+		w.add("branch", baseRefPattern.FindStringSubmatch(atom)[1])
+	case refNameNotEqual.MatchString(atom) && !choice:
+		w.skip("branch", refNameNotEqual.FindStringSubmatch(atom)[1])
+	case strings.HasPrefix(atom, "!") && refPrefixPattern.MatchString(atom[1:]) && !choice:
+		w.skip("branch", refPrefixPattern.FindStringSubmatch(atom[1:])[1]+"*")
+	case refPattern.MatchString(atom):
+		ref := refPattern.FindStringSubmatch(atom)[1]
+		if branch := strings.TrimPrefix(ref, "refs/heads/"); branch != ref {
+			w.add("branch", branch)
+			break
+		}
+		if strings.HasPrefix(ref, "refs/tags/") {
+			w.add("event", "tag")
+		}
+		w.add("ref", ref)
+	case refStartsPattern.MatchString(atom):
+		ref := refStartsPattern.FindStringSubmatch(atom)[1]
+		if branch := strings.TrimPrefix(ref, "refs/heads/"); branch != ref {
+			w.add("branch", branch+"*")
+			break
+		}
+		if strings.HasPrefix(ref, "refs/tags/") {
+			w.add("event", "tag")
+			if ref == "refs/tags/" {
+				break
+			}
+		}
+		w.add("ref", ref+"*")
+	case atom == "always()" || atom == "!cancelled()":
+		w.add("status", "success", "failure")
+	case atom == "failure()":
+		w.add("status", "failure")
+	case atom == "success()":
+	default:
+		return false
+	}
+	return true
+}
+
+// splitConditions splits cond at the top-level occurrences of op ("&&" or
+// "||") and removes parentheses around each part
+func splitConditions(cond, op string) []string {
+	var parts []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(cond); i++ {
+		switch c := cond[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(cond[i:], op):
+			parts = append(parts, cond[start:i])
+			start = i + len(op)
+			i++
+		}
+	}
+	parts = append(parts, cond[start:])
+
+	var out []string
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		for strings.HasPrefix(part, "(") && strings.HasSuffix(part, ")") && balanced(part[1:len(part)-1]) {
+			part = strings.TrimSpace(part[1 : len(part)-1])
+		}
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// balanced reports whether the parentheses outside quotes in s match up
+func balanced(s string) bool {
+	depth, quoted := 0, false
+	for _, c := range s {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
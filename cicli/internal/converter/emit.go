@@ -0,0 +1,343 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isMultiline reports whether value needs a block, ignoring a final newline
+func isMultiline(value string) bool {
+	return strings.Contains(strings.TrimRight(value, "\n"), "\n")
+}
+
+// checkYAML reports whether the output of a registered driver parses as
+// YAML, every document of it; the built-in generators marshal theirs
+func checkYAML(output string) error {
+	decoder := yaml.NewDecoder(bytes.NewReader([]byte(output)))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// yamlMap is a mapping whose keys are only known while generating, such as
+// job names. Entries keep the order they were added in.
+type yamlMap []yamlEntry
+
+type yamlEntry struct {
+	Key     string
+	Value   interface{}
+	Comment string // carried-over comment, written above the key
+}
+
+// set adds key with value, or replaces the value of an existing key
+func (m *yamlMap) set(key string, value interface{}) {
+	m.setCommented(key, "", value)
+}
+
+// setCommented is set with a comment written above the key
+func (m *yamlMap) setCommented(key, comment string, value interface{}) {
+	for i := range *m {
+		if (*m)[i].Key == key {
+			(*m)[i].Value, (*m)[i].Comment = value, comment
+			return
+		}
+	}
+	*m = append(*m, yamlEntry{Key: key, Value: value, Comment: comment})
+}
+
+// commented is a value, such as a list item or a document, with a
+// carried-over comment written above it
+type commented struct {
+	Comment string
+	Value   interface{}
+}
+
+// carried holds the carried-over comment of a generated struct, such as a
+// step, which is written above it
+type carried struct {
+	comment string
+}
+
+func (c carried) carriedComment() string {
+	return c.comment
+}
+
+// yamlList is a list whose items can have comment lines between them, such
+// as a script with the notes left for actions it could not convert. Comment
+// lines go above the next item, or below the last one.
+type yamlList struct {
+	items   []commented
+	pending []string
+}
+
+// add appends an item
+func (l *yamlList) add(v interface{}) {
+	l.items = append(l.items, commented{Comment: strings.Join(l.pending, "\n"), Value: v})
+	l.pending = nil
+}
+
+// comment adds comment lines before the next item
+func (l *yamlList) comment(comment string) {
+	if comment != "" {
+		l.pending = append(l.pending, comment)
+	}
+}
+
+// empty reports whether the list has no items, though it may have comments
+func (l *yamlList) empty() bool {
+	return len(l.items) == 0
+}
+
+// emptyValue is written as a key with nothing after it, as in
+// `workflow_dispatch:`
+type emptyValue struct{}
+
+// yamlDoc converts a generated document to a node tree. Structs are written
+// in field order by their yaml tags, which take omitempty, flow and inline;
+// maps are written with sorted keys. Scalars are encoded by yaml.v3, which
+// quotes anything that would read back as another type and writes
+// multi-line strings as literal blocks.
+func yamlDoc(v interface{}) (*yaml.Node, error) {
+	switch v := v.(type) {
+	case *yaml.Node:
+		return v, nil
+	case yamlMap:
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		for _, e := range v {
+			if err := addEntry(n, e.Key, e.Comment, e.Value, ""); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	case commented:
+		n, err := yamlDoc(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		n.HeadComment = yamlComment(v.Comment)
+		return n, nil
+	case *yamlList:
+		n := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range v.items {
+			child, err := yamlDoc(item)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, child)
+		}
+		if len(n.Content) > 0 {
+			n.Content[len(n.Content)-1].FootComment = yamlComment(strings.Join(v.pending, "\n"))
+		}
+		return n, nil
+	case emptyValue:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return yamlDoc(nil)
+		}
+		return yamlDoc(rv.Elem().Interface())
+	case reflect.Struct:
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		if err := yamlFields(n, rv); err != nil {
+			return nil, err
+		}
+		if c, ok := v.(interface{ carriedComment() string }); ok {
+			n.HeadComment = yamlComment(c.carriedComment())
+		}
+		return n, nil
+	case reflect.Slice:
+		n := &yaml.Node{Kind: yaml.SequenceNode}
+		for i := 0; i < rv.Len(); i++ {
+			item, err := yamlDoc(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, item)
+		}
+		return n, nil
+	case reflect.Map:
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		for _, k := range keys {
+			if err := addEntry(n, fmt.Sprint(k), "", rv.MapIndex(k).Interface(), ""); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	}
+
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// yamlFields adds the fields of the struct rv to the mapping n
+func yamlFields(n *yaml.Node, rv reflect.Value) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		if tag == "-" || !t.Field(i).IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		field := rv.Field(i)
+		if strings.Contains(opts, "omitempty") && isEmptyValue(field) {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			if m, ok := field.Interface().(yamlMap); ok {
+				for _, e := range m {
+					if err := addEntry(n, e.Key, e.Comment, e.Value, ""); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if field.Kind() == reflect.Ptr {
+				field = field.Elem()
+			}
+			if err := yamlFields(n, field); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(t.Field(i).Name)
+		}
+		if err := addEntry(n, name, "", field.Interface(), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addEntry adds key: value to the mapping n. The comment of a commented
+// value goes above its key.
+func addEntry(n *yaml.Node, key, comment string, value interface{}, opts string) error {
+	if c, ok := value.(commented); ok {
+		comment, value = joinComments(comment, c.Comment), c.Value
+	}
+	v, err := yamlDoc(value)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(opts, "flow") {
+		v.Style |= yaml.FlowStyle
+	}
+	n.Content = append(n.Content, yamlKey(key, comment), v)
+	return nil
+}
+
+// isEmptyValue reports whether an omitempty field is left out: zero values,
+// and empty slices, maps and yamlMaps
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+func yamlKey(key, comment string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key, HeadComment: yamlComment(comment)}
+}
+
+// yamlComment returns a carried-over comment as # lines
+func yamlComment(comment string) string {
+	return strings.Join(commentLines(comment), "\n")
+}
+
+// marshalYAML encodes the documents of a generated file with yaml.v3,
+// separated by ---. comment goes at the top of the file. Top-level entries
+// that span several lines are set apart by blank lines.
+func marshalYAML(comment string, docs ...interface{}) (string, error) {
+	var parts []string
+	for i, doc := range docs {
+		n, err := yamlDoc(doc)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if i == 0 {
+			writeComment(&buf, "", comment)
+		}
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(n); err != nil {
+			return "", err
+		}
+		if err := enc.Close(); err != nil {
+			return "", err
+		}
+		parts = append(parts, spaceTopLevel(buf.String()))
+	}
+	return strings.Join(parts, "---\n"), nil
+}
+
+// spaceTopLevel puts a blank line between top-level entries when either of
+// them spans several lines. Comment lines stay with the entry below them.
+func spaceTopLevel(doc string) string {
+	var blocks [][]string
+	var comments []string
+	lines := strings.Split(strings.TrimSuffix(doc, "\n"), "\n")
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "#"):
+			comments = append(comments, line)
+		case line != "" && line[0] != ' ' && !strings.HasPrefix(line, "- ") || len(blocks) == 0:
+			blocks = append(blocks, append(comments, line))
+			comments = nil
+		default:
+			last := len(blocks) - 1
+			blocks[last] = append(append(blocks[last], comments...), line)
+			comments = nil
+		}
+	}
+
+	// Comment lines above an entry do not make it span several lines
+	spans := func(block []string) bool {
+		n := 0
+		for _, line := range block {
+			if !strings.HasPrefix(line, "#") {
+				n++
+			}
+		}
+		return n > 1
+	}
+	var sb strings.Builder
+	for i, block := range blocks {
+		if i > 0 && (spans(block) || spans(blocks[i-1])) {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(strings.Join(block, "\n") + "\n")
+	}
+	for _, c := range comments {
+		sb.WriteString(c + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,607 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// harnessImageConnector is the account-level Docker connector Harness Cloud
+// pulls public images through
+const harnessImageConnector = "account.harnessImage"
+
+// harnessOutputStep is the step collecting a stage's job outputs as output
+// variables, which later stages read by its identifier
+const harnessOutputStep = "outputs"
+
+var (
+	nonHarnessChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+	// sourceCondition matches conditions still in a source platform's
+	// syntax, such as GitLab rules, which no target expression can read
+	sourceCondition = regexp.MustCompile(`\$(?:[A-Za-z_]|\{[A-Za-z_])|=~|!~`)
+)
+
+// harnessVariables are the runner variables Harness also offers as
+// expressions, which it resolves in variables and envVariables
+var harnessVariables = map[string]string{
+	"DRONE_COMMIT_SHA":    "<+codebase.commitSha>",
+	"DRONE_COMMIT_BRANCH": "<+codebase.branch>",
+	"DRONE_SOURCE_BRANCH": "<+codebase.sourceBranch>",
+	"DRONE_TARGET_BRANCH": "<+codebase.targetBranch>",
+	"DRONE_BUILD_NUMBER":  "<+pipeline.sequenceId>",
+	"HARNESS_BUILD_ID":    "<+pipeline.executionId>",
+	"HARNESS_STAGE_ID":    "<+stage.identifier>",
+}
+
+// githubHarnessConditions rewrite GitHub expressions to Harness codebase
+// expressions; refPrefixCondition handles branch prefixes
+var githubHarnessConditions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`github\.(?:ref_name|head_ref) == '([^']*)'`), `<+codebase.branch> == "$1"`},
+	{regexp.MustCompile(`github\.(?:ref_name|head_ref) != '([^']*)'`), `<+codebase.branch> != "$1"`},
+	{regexp.MustCompile(`github\.ref == 'refs/heads/([^']*)'`), `<+codebase.branch> == "$1"`},
+	{regexp.MustCompile(`github\.ref != 'refs/heads/([^']*)'`), `<+codebase.branch> != "$1"`},
+	{regexp.MustCompile(`github\.ref == 'refs/tags/([^']*)'`), `<+codebase.tag> == "$1"`},
+	{regexp.MustCompile(`!startsWith\(github\.ref, 'refs/tags/'\)`), `<+codebase.build.type> != "tag"`},
+	{regexp.MustCompile(`startsWith\(github\.ref, 'refs/tags/'\)`), `<+codebase.build.type> == "tag"`},
+	{regexp.MustCompile(`github\.event_name == 'pull_request'`), `<+codebase.build.type> == "PR"`},
+	{regexp.MustCompile(`github\.event_name != 'pull_request'`), `<+codebase.build.type> != "PR"`},
+	{regexp.MustCompile(`github\.event_name == 'push'`), `<+codebase.build.type> == "branch"`},
+	{regexp.MustCompile(`github\.base_ref == '([^']*)'`), `<+codebase.targetBranch> == "$1"`},
+}
+
+// generateHarness generates a Harness CI pipeline with a CI stage per job.
+// Harness runs stages in order, so jobs are grouped in dependency levels and
+// the jobs of a level run as parallel stages. Gated jobs wait behind an
+// Approval stage.
+func (c *Converter) generateHarness(config *PipelineConfig) (string, error) {
+	g := &harnessGenerator{config: config, env: make(map[string]string), secrets: make(map[string]string), stages: make(map[string]string)}
+	for k, v := range config.Environment {
+		if name := settingName(v); name != "" {
+			g.secrets[k] = name
+			continue
+		}
+		g.env[k] = v
+	}
+	for _, job := range config.Jobs {
+		g.stages[job.Name] = harnessID(job.Name)
+	}
+
+	for _, t := range config.Triggers {
+		switch t.Type {
+		case "push":
+			if len(t.Branches) > 0 {
+				config.note("builds ran on pushes to %s; create a Harness push trigger with a matching branch condition", strings.Join(t.Branches, ", "))
+			} else {
+				config.note("builds ran on pushes; create a Harness push trigger for the pipeline")
+			}
+		case "pull_request":
+			config.note("builds ran for pull requests; create a Harness pull request trigger for the pipeline")
+		case "schedule":
+			config.note("create a Harness cron trigger for the pipeline (cron '%s')", t.Cron)
+		case "call":
+			config.approximated("workflow_call", "the pipeline is reusable; run it from other Harness pipelines with a Pipeline stage")
+		}
+	}
+	config.note("set projectIdentifier and orgIdentifier to your Harness project, and the codebase connector to the repository's Git connector")
+
+	name := config.Name
+	if name == "" {
+		name = "ci"
+	}
+	var doc harnessPipeline
+	p := &doc.Pipeline
+	p.Name, p.Identifier = name, harnessID(name)
+	p.ProjectIdentifier, p.OrgIdentifier = "default_project", "default"
+	p.Properties.CI.Codebase.ConnectorRef = "<+input>"
+	p.Properties.CI.Codebase.Build = "<+input>"
+	p.Stages = []interface{}{}
+
+	levels, exact := buildkiteLevels(config.Jobs)
+	if !exact {
+		config.approximated("needs", "Harness runs stages in order, so each job waits for every job of the level before it rather than only the jobs it needs")
+	}
+	for _, level := range levels {
+		p.Stages = append(p.Stages, g.approvals(level)...)
+		if len(level) == 1 {
+			p.Stages = append(p.Stages, g.stage(level[0]))
+			continue
+		}
+		var parallel []interface{}
+		for _, job := range level {
+			parallel = append(parallel, g.stage(job))
+		}
+		p.Stages = append(p.Stages, yamlMap{{Key: "parallel", Value: parallel}})
+	}
+	return marshalYAML(config.Comment, doc)
+}
+
+// harnessPipeline is a Harness pipeline file
+type harnessPipeline struct {
+	Pipeline struct {
+		Name              string            `yaml:"name"`
+		Identifier        string            `yaml:"identifier"`
+		ProjectIdentifier string            `yaml:"projectIdentifier"`
+		OrgIdentifier     string            `yaml:"orgIdentifier"`
+		Properties        harnessProperties `yaml:"properties"`
+		Stages            []interface{}     `yaml:"stages"`
+	} `yaml:"pipeline"`
+}
+
+type harnessProperties struct {
+	CI struct {
+		Codebase struct {
+			ConnectorRef string `yaml:"connectorRef"`
+			Build        string `yaml:"build"`
+		} `yaml:"codebase"`
+	} `yaml:"ci"`
+}
+
+type harnessApprovalStage struct {
+	Name       string `yaml:"name"`
+	Identifier string `yaml:"identifier"`
+	Type       string `yaml:"type"`
+	Spec       struct {
+		Execution harnessExecution `yaml:"execution"`
+	} `yaml:"spec"`
+	When *harnessWhen `yaml:"when,omitempty"`
+}
+
+type harnessApprovalStep struct {
+	Type       string              `yaml:"type"`
+	Name       string              `yaml:"name"`
+	Identifier string              `yaml:"identifier"`
+	Timeout    string              `yaml:"timeout"`
+	Spec       harnessApprovalSpec `yaml:"spec"`
+}
+
+type harnessApprovalSpec struct {
+	ApprovalMessage                 string `yaml:"approvalMessage"`
+	IncludePipelineExecutionHistory bool   `yaml:"includePipelineExecutionHistory"`
+	Approvers                       struct {
+		UserGroups               []string `yaml:"userGroups"`
+		MinimumCount             int      `yaml:"minimumCount"`
+		DisallowPipelineExecutor bool     `yaml:"disallowPipelineExecutor"`
+	} `yaml:"approvers"`
+	ApproverInputs []string `yaml:"approverInputs"`
+}
+
+type harnessStage struct {
+	Name       string            `yaml:"name"`
+	Identifier string            `yaml:"identifier"`
+	Type       string            `yaml:"type"`
+	Spec       harnessStageSpec  `yaml:"spec"`
+	Variables  []harnessVariable `yaml:"variables,omitempty"`
+	Strategy   *harnessStrategy  `yaml:"strategy,omitempty"`
+	When       *harnessWhen      `yaml:"when,omitempty"`
+}
+
+type harnessStageSpec struct {
+	CloneCodebase bool            `yaml:"cloneCodebase"`
+	Caching       *harnessCaching `yaml:"caching,omitempty"`
+	Platform      struct {
+		OS   string `yaml:"os"`
+		Arch string `yaml:"arch"`
+	} `yaml:"platform"`
+	Runtime struct {
+		Type string  `yaml:"type"`
+		Spec yamlMap `yaml:"spec"`
+	} `yaml:"runtime"`
+	Execution harnessExecution `yaml:"execution"`
+}
+
+type harnessCaching struct {
+	Enabled bool     `yaml:"enabled"`
+	Paths   []string `yaml:"paths"`
+}
+
+type harnessExecution struct {
+	Steps []interface{} `yaml:"steps"`
+}
+
+type harnessStep struct {
+	Type       string          `yaml:"type"`
+	Name       string          `yaml:"name"`
+	Identifier string          `yaml:"identifier"`
+	Spec       harnessStepSpec `yaml:"spec"`
+	When       *harnessWhen    `yaml:"when,omitempty"`
+}
+
+type harnessStepSpec struct {
+	ConnectorRef    string            `yaml:"connectorRef,omitempty"`
+	Image           string            `yaml:"image,omitempty"`
+	Shell           string            `yaml:"shell,omitempty"`
+	Command         string            `yaml:"command,omitempty"`
+	EnvVariables    map[string]string `yaml:"envVariables,omitempty"`
+	OutputVariables []harnessOutput   `yaml:"outputVariables,omitempty"`
+}
+
+type harnessOutput struct {
+	Name string `yaml:"name"`
+}
+
+type harnessVariable struct {
+	Name  string `yaml:"name"`
+	Type  string `yaml:"type"`
+	Value string `yaml:"value"`
+}
+
+type harnessStrategy struct {
+	Matrix yamlMap `yaml:"matrix"`
+}
+
+type harnessWhen struct {
+	PipelineStatus string `yaml:"pipelineStatus,omitempty"`
+	StageStatus    string `yaml:"stageStatus,omitempty"`
+	Condition      string `yaml:"condition,omitempty"`
+}
+
+type harnessGenerator struct {
+	config  *PipelineConfig
+	env     map[string]string
+	secrets map[string]string // variables bound to a secret of the same or another name
+	stages  map[string]string // job names to stage identifiers
+}
+
+// harnessID turns a name into a Harness identifier
+func harnessID(name string) string {
+	id := strings.Trim(nonHarnessChars.ReplaceAllString(name, "_"), "_")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "_" + id
+	}
+	return id
+}
+
+// approvals is an Approval stage for each gated job of a level. The stages
+// before a level finish first, so a gate also holds back the other jobs of
+// its level.
+func (g *harnessGenerator) approvals(level []Job) []interface{} {
+	var stages []interface{}
+	for _, job := range level {
+		if job.Gate == nil {
+			continue
+		}
+		if len(level) > 1 {
+			g.config.approximated("approval", "job '%s' waits for approval; Harness approves stages in order, so the approval also holds back the other jobs started with it", job.Name)
+		}
+		message := fmt.Sprintf("Run %s?", job.Name)
+		if env := job.Gate.Environment; env != "" {
+			message = fmt.Sprintf("Deploy %s to %s?", job.Name, env)
+			g.config.approximated("environment", "job '%s' used environment '%s'; Harness CI stages have no environments, so an Approval stage guards it instead", job.Name, env)
+		}
+		groups := []string{"_project_all_users"}
+		if len(job.Gate.Approvers) > 0 {
+			groups = job.Gate.Approvers
+			g.config.note("job '%s' needs approval from %s; userGroups takes Harness user group identifiers", job.Name, strings.Join(job.Gate.Approvers, ", "))
+		}
+
+		spec := harnessApprovalSpec{ApprovalMessage: message, IncludePipelineExecutionHistory: true, ApproverInputs: []string{}}
+		spec.Approvers.UserGroups = groups
+		spec.Approvers.MinimumCount = 1
+		step := harnessApprovalStep{Type: "HarnessApproval", Name: "Approve", Identifier: "approve", Timeout: "1d", Spec: spec}
+		stage := harnessApprovalStage{Name: job.Name + " approval", Identifier: harnessID(job.Name + "_approval"), Type: "Approval"}
+		stage.Spec.Execution.Steps = []interface{}{yamlMap{{Key: "step", Value: step}}}
+		stage.When = g.when("pipelineStatus", fmt.Sprintf("job '%s'", job.Name), job.Condition)
+		stages = append(stages, yamlMap{{Key: "stage", Value: stage}})
+	}
+	return stages
+}
+
+// stage is a job as a CI stage
+func (g *harnessGenerator) stage(job Job) commented {
+	stage := harnessStage{Name: job.Name, Identifier: g.stages[job.Name], Type: "CI"}
+	stage.Spec.CloneCodebase = true
+	stage.Spec.Caching = g.caching(job)
+
+	platform, arch := "Linux", "Amd64"
+	switch runsOn := strings.ToLower(job.RunsOn); {
+	case strings.HasPrefix(runsOn, "windows"):
+		platform = "Windows"
+	case strings.HasPrefix(runsOn, "macos"):
+		platform, arch = "MacOS", "Arm64"
+	case strings.Contains(runsOn, "arm"):
+		arch = "Arm64"
+	case runsOn != "" && !strings.HasPrefix(runsOn, "ubuntu-") && !matrixRefPattern.MatchString(job.RunsOn):
+		g.config.note("job '%s' runs on %s; the stage uses Harness Cloud, so point its runtime at your own infrastructure if it needs that machine", job.Name, job.RunsOn)
+	}
+	stage.Spec.Platform.OS, stage.Spec.Platform.Arch = platform, arch
+	stage.Spec.Runtime.Type = "Cloud"
+	stage.Spec.Execution.Steps = g.steps(job)
+
+	stage.Variables = g.variables(job)
+	if job.Matrix != nil {
+		stage.Strategy = g.matrix(job)
+	}
+
+	stage.When = g.when("pipelineStatus", fmt.Sprintf("job '%s'", job.Name), job.Condition)
+	return commented{job.Comment, yamlMap{{Key: "stage", Value: stage}}}
+}
+
+// when is the when: block running a stage or step on cond; key is
+// pipelineStatus for stages and stageStatus for steps
+func (g *harnessGenerator) when(key, where, cond string) *harnessWhen {
+	status := "Success"
+	switch {
+	case alwaysRuns(cond):
+		status = "All"
+		cond = strings.TrimPrefix(strings.TrimPrefix(cond, "always()"), " && ")
+	case cond == "failure()":
+		status, cond = "Failure", ""
+	case cond == "success()":
+		cond = ""
+	}
+	expr := ""
+	if cond != "" {
+		var ok bool
+		if expr, ok = harnessExpression(cond); !ok {
+			g.config.dropped("if", "%s has condition '%s'; Harness runs it unconditionally", where, cond)
+			expr = ""
+		}
+	}
+	if status == "Success" && expr == "" {
+		return nil
+	}
+	when := &harnessWhen{Condition: expr}
+	if key == "pipelineStatus" {
+		when.PipelineStatus = status
+	} else {
+		when.StageStatus = status
+	}
+	return when
+}
+
+// caching turns job caches on with Cache Intelligence, which keys the cache
+// on the project's lock files itself
+func (g *harnessGenerator) caching(job Job) *harnessCaching {
+	var paths []string
+	for _, cache := range job.Cache {
+		for _, p := range cache.Paths {
+			if !containsString(paths, p) {
+				paths = append(paths, p)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	g.config.approximated("cache", "job '%s' caches %s with Cache Intelligence, which derives the cache key from the project's lock files", job.Name, strings.Join(paths, ", "))
+	return &harnessCaching{Enabled: true, Paths: paths}
+}
+
+// steps are the job's services as Background steps and each step as a Run
+// step. Steps share the stage's workspace.
+func (g *harnessGenerator) steps(job Job) []interface{} {
+	var steps []interface{}
+	ids := make(map[string]bool)
+	unique := func(id string) string {
+		base := id
+		for n := 2; ids[id]; n++ {
+			id = fmt.Sprintf("%s_%d", base, n)
+		}
+		ids[id] = true
+		return id
+	}
+
+	if len(job.Services) > 0 && job.Container != nil && !usesLocalhost(job) {
+		g.config.note("job '%s' reaches its services by name; Harness Cloud runs Background steps on localhost (%s)", job.Name, serviceNames(job))
+	}
+	for _, svc := range job.Services {
+		spec := harnessStepSpec{ConnectorRef: harnessImageConnector, Image: svc.Image, EnvVariables: g.stepEnv(job.Name, svc.Env)}
+		step := harnessStep{Type: "Background", Name: svc.Name, Identifier: unique(harnessID(svc.Name)), Spec: spec}
+		steps = append(steps, yamlMap{{Key: "step", Value: step}})
+	}
+
+	if _, producers := artifactDownloads(g.config, job); len(producers) > 0 {
+		g.config.dropped("download-artifact", "job '%s' downloads artifacts of %s; Harness stages do not share a workspace, so hand them over with Save Cache and Restore Cache steps", job.Name, strings.Join(producers, ", "))
+	}
+	var uploads []string
+	for _, a := range jobArtifacts(job) {
+		uploads = append(uploads, a.Name)
+	}
+	if len(uploads) > 0 {
+		g.config.dropped("upload-artifact", "job '%s' uploads %s; Harness keeps no artifacts of CI stages, so publish them with an Upload Artifacts step", job.Name, strings.Join(uploads, ", "))
+	}
+
+	image := ""
+	if job.Container != nil {
+		image = job.Container.Image
+	}
+	count := 0
+	for _, step := range job.Steps {
+		var command string
+		stepImage := image
+		switch {
+		case step.Image != "":
+			stepImage = step.Image
+			command = step.Run
+			if strings.HasPrefix(command, "sh -c '") && strings.HasSuffix(command, "'") {
+				command = strings.ReplaceAll(command[len("sh -c '"):len(command)-1], `'"'"'`, "'")
+			} else if command != "" {
+				g.config.approximated("container step", "job '%s' runs %s with arguments '%s'; Harness runs them as shell commands instead of through the image's entrypoint", job.Name, step.Image, command)
+			}
+		case step.Run != "":
+			command = shellOutputs(step.Run, step)
+		case step.Uses != "":
+			command = convertActionToCommand(step)
+		}
+		command = strings.TrimRight(command, "\n")
+		if command == "" {
+			continue
+		}
+		title := strings.SplitN(command, "\n", 2)[0]
+		if count == 0 && writesOutputs(job) {
+			command = "mkdir -p " + outputDir + "\n" + command
+		}
+		if step.WorkDir != "" {
+			command = "cd " + step.WorkDir + "\n" + command
+		}
+		count++
+
+		name := step.Name
+		if name == "" {
+			// Named the way GitHub shows unnamed steps
+			name = "Run " + title
+			if len(name) > 60 {
+				name = name[:60]
+			}
+		}
+		id := step.ID
+		if id == "" {
+			id = name
+		}
+		hs := harnessStep{Type: "Run", Name: name, Identifier: unique(harnessID(id))}
+		hs.Spec = harnessStepSpec{Image: stepImage, Shell: "Bash", Command: command, EnvVariables: g.stepEnv(job.Name, step.Env)}
+		if stepImage != "" {
+			hs.Spec.ConnectorRef = harnessImageConnector
+		}
+		if step.If != "" {
+			hs.When = g.when("stageStatus", fmt.Sprintf("step in job '%s'", job.Name), step.If)
+		}
+		steps = append(steps, commented{step.Comment, yamlMap{{Key: "step", Value: hs}}})
+	}
+
+	if len(job.Outputs) > 0 {
+		var lines []string
+		hs := harnessStep{Type: "Run", Name: "Job outputs", Identifier: unique(harnessOutputStep)}
+		for _, out := range job.Outputs {
+			name := outputVariable(job.Name, out.Name)
+			lines = append(lines, fmt.Sprintf(`%s="%s"`, name, shellOutputRefs(out.Value)))
+			hs.Spec.OutputVariables = append(hs.Spec.OutputVariables, harnessOutput{Name: name})
+		}
+		if image != "" {
+			hs.Spec.ConnectorRef, hs.Spec.Image = harnessImageConnector, image
+		}
+		hs.Spec.Shell, hs.Spec.Command = "Bash", strings.Join(lines, "\n")
+		steps = append(steps, yamlMap{{Key: "step", Value: hs}})
+		count++
+	}
+
+	if count == 0 && len(job.Services) == 0 {
+		hs := harnessStep{Type: "Run", Name: "Nothing to run", Identifier: unique("nothing_to_run")}
+		hs.Spec = harnessStepSpec{Shell: "Bash", Command: `echo "Nothing to run"`}
+		steps = append(steps, yamlMap{{Key: "step", Value: hs}})
+	}
+	return steps
+}
+
+// stepEnv is a step's envVariables. Secrets are read with secrets.getValue,
+// since Harness resolves expressions before the step runs.
+func (g *harnessGenerator) stepEnv(job string, env map[string]string) map[string]string {
+	if len(env) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(env))
+	for k, v := range env {
+		values[k] = g.value(job, v)
+	}
+	return values
+}
+
+// variables are the pipeline and job environment as stage variables, which
+// Harness exports to every step of the stage. Outputs of the jobs this one
+// needs are read from their output step.
+func (g *harnessGenerator) variables(job Job) []harnessVariable {
+	env := copyStrings(g.env)
+
+	// Stages only get the secrets they read
+	secrets := make(map[string]string)
+	mapJobStrings(job, func(s string) string {
+		for _, m := range variablePattern.FindAllStringSubmatch(s, -1) {
+			if name := variableName(m); g.secrets[name] != "" {
+				secrets[name] = g.secrets[name]
+			}
+		}
+		return s
+	})
+	for _, m := range []map[string]string{job.Environment, containerEnv(job)} {
+		for k, v := range m {
+			if name := settingName(v); name != "" {
+				secrets[k] = name
+				delete(env, k)
+				continue
+			}
+			env[k] = v
+			delete(secrets, k)
+		}
+	}
+	for _, producer := range outputProducers(g.config, job) {
+		for _, other := range g.config.Jobs {
+			if other.Name != producer {
+				continue
+			}
+			for _, out := range other.Outputs {
+				name := outputVariable(producer, out.Name)
+				env[name] = fmt.Sprintf("<+pipeline.stages.%s.spec.execution.steps.%s.output.outputVariables.%s>", g.stages[producer], harnessOutputStep, name)
+			}
+		}
+	}
+	names := copyStrings(env)
+	for k := range secrets {
+		names[k] = ""
+	}
+	var variables []harnessVariable
+	for _, k := range sortedKeys(names) {
+		if secret, ok := secrets[k]; ok {
+			variables = append(variables, harnessVariable{Name: k, Type: "Secret", Value: secret})
+			continue
+		}
+		v := env[k]
+		if !strings.HasPrefix(v, "<+pipeline.stages.") {
+			v = g.value(job.Name, v)
+		}
+		variables = append(variables, harnessVariable{Name: k, Type: "String", Value: v})
+	}
+	return variables
+}
+
+// matrix is the job's strategy. Harness runs the product of the axes, so
+// combinations the matrix does not run are excluded.
+func (g *harnessGenerator) matrix(job Job) *harnessStrategy {
+	vars, setup, skipped := matrixGrid(g.config, job, "Harness")
+	strategy := &harnessStrategy{}
+	for _, v := range vars {
+		strategy.Matrix.set(v, flowSeq(setup[v], true))
+	}
+	if len(skipped) > 0 {
+		strategy.Matrix.set("exclude", matrixList(skipped, true))
+	}
+	return strategy
+}
+
+// value rewrites a variable value. Secrets become secrets.getValue
+// expressions and runner variables their expression; Harness does not
+// expand other variables there, so they stay text.
+func (g *harnessGenerator) value(job, s string) string {
+	if name := settingName(s); name != "" {
+		return fmt.Sprintf(`<+secrets.getValue("%s")>`, name)
+	}
+	if m := variablePattern.FindStringSubmatch(s); m != nil && m[0] == s && g.secrets[variableName(m)] != "" {
+		return fmt.Sprintf(`<+secrets.getValue("%s")>`, g.secrets[variableName(m)])
+	}
+	return variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := variableName(variablePattern.FindStringSubmatch(ref))
+		if expr, ok := harnessVariables[name]; ok {
+			return expr
+		}
+		g.config.approximated("environment", "job '%s' sets a value from $%s; Harness does not expand variables in variables or envVariables, so it is passed as text", job, name)
+		return ref
+	})
+}
+
+// harnessExpression rewrites a GitHub condition as a Harness expression,
+// reporting false when it has no equivalent
+func harnessExpression(cond string) (string, bool) {
+	expr := refPrefixCondition.ReplaceAllStringFunc(cond, func(m string) string {
+		parts := refPrefixCondition.FindStringSubmatch(m)
+		return fmt.Sprintf(`%s<+codebase.branch>.startsWith("%s")`, parts[1], parts[2])
+	})
+	for _, rule := range githubHarnessConditions {
+		expr = rule.pattern.ReplaceAllString(expr, rule.replacement)
+	}
+	if githubUnsupported.MatchString(strings.ReplaceAll(expr, ".startsWith(", "")) || sourceCondition.MatchString(expr) {
+		return "", false
+	}
+	return expr, true
+}
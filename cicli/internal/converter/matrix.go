@@ -0,0 +1,600 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Matrix runs a job once per combination of values, with GitHub's
+// semantics: Axes are multiplied out, Exclude removes the combinations it
+// matches and Include extends matching combinations or adds new ones. Steps
+// refer to the values as ${{ matrix.<name> }}.
+type Matrix struct {
+	Axes    map[string][]string `yaml:"axes,omitempty"`
+	Include []map[string]string `yaml:"include,omitempty"`
+	Exclude []map[string]string `yaml:"exclude,omitempty"`
+}
+
+var (
+	matrixRefPattern   = regexp.MustCompile(`\$\{\{\s*matrix\.([\w-]+)\s*\}\}`)
+	nonIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// Combinations lists every job the matrix runs
+func (m *Matrix) Combinations() []map[string]string {
+	var combos []map[string]string
+	if len(m.Axes) > 0 {
+		combos = []map[string]string{{}}
+		for _, name := range m.axisNames() {
+			var next []map[string]string
+			for _, c := range combos {
+				for _, v := range m.Axes[name] {
+					n := copyStrings(c)
+					n[name] = v
+					next = append(next, n)
+				}
+			}
+			combos = next
+		}
+	}
+
+	kept := combos[:0]
+	for _, c := range combos {
+		excluded := false
+		for _, ex := range m.Exclude {
+			if matchesAll(c, ex) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, c)
+		}
+	}
+	combos = kept
+
+	// An include entry extends every original combination whose axis values
+	// it does not overwrite; if there is none, it becomes a combination
+	original := len(combos)
+	for _, inc := range m.Include {
+		added := false
+		for _, c := range combos[:original] {
+			if m.overwritesAxis(c, inc) {
+				continue
+			}
+			for k, v := range inc {
+				c[k] = v
+			}
+			added = true
+		}
+		if !added {
+			combos = append(combos, copyStrings(inc))
+		}
+	}
+	return combos
+}
+
+// Variables lists every name a combination can set
+func (m *Matrix) Variables() []string {
+	set := make(map[string]string)
+	for name := range m.Axes {
+		set[name] = ""
+	}
+	for _, entries := range [][]map[string]string{m.Include, m.Exclude} {
+		for _, e := range entries {
+			for k := range e {
+				set[k] = ""
+			}
+		}
+	}
+	return sortedKeys(set)
+}
+
+func (m *Matrix) axisNames() []string {
+	names := make([]string, 0, len(m.Axes))
+	for name := range m.Axes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *Matrix) overwritesAxis(combo, inc map[string]string) bool {
+	for k, v := range inc {
+		if _, axis := m.Axes[k]; axis && combo[k] != v {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAll(combo, entry map[string]string) bool {
+	for k, v := range entry {
+		if combo[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func copyStrings(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// parseGitHubMatrix reads strategy.matrix: axes plus include and exclude
+func parseGitHubMatrix(config *PipelineConfig, where string, v interface{}) *Matrix {
+	mm, ok := v.(map[string]interface{})
+	if !ok {
+		if v != nil {
+			config.dropped("strategy:matrix", "%s: a matrix computed by an expression is not converted", where)
+		}
+		return nil
+	}
+	m := &Matrix{Axes: make(map[string][]string)}
+	for _, name := range sortedKeys(stringMap(mm)) {
+		switch name {
+		case "include":
+			m.Include = matrixEntries(config, where, mm[name])
+		case "exclude":
+			m.Exclude = matrixEntries(config, where, mm[name])
+		default:
+			m.Axes[name] = matrixValues(config, where, mm[name])
+		}
+	}
+	return m
+}
+
+// parseGitLabMatrix reads parallel:matrix, a list of groups whose values
+// are multiplied out separately. A single group maps to axes; several
+// groups become one include entry per combination.
+func parseGitLabMatrix(config *PipelineConfig, where string, v interface{}) *Matrix {
+	groups, _ := v.([]interface{})
+	m := &Matrix{}
+	for _, g := range groups {
+		gm, ok := g.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		group := &Matrix{Axes: make(map[string][]string)}
+		for name, values := range gm {
+			group.Axes[name] = matrixValues(config, where, values)
+		}
+		if len(groups) == 1 {
+			return group
+		}
+		m.Include = append(m.Include, group.Combinations()...)
+	}
+	if len(m.Include) == 0 {
+		return nil
+	}
+	return m
+}
+
+// parseCircleCIMatrix reads a workflow job's matrix: parameters and exclude
+func parseCircleCIMatrix(config *PipelineConfig, where string, v interface{}) *Matrix {
+	mm, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	config.dropKeys(where+" matrix", mm, keySet("parameters", "exclude"))
+	params, _ := mm["parameters"].(map[string]interface{})
+	if len(params) == 0 {
+		return nil
+	}
+	m := &Matrix{Axes: make(map[string][]string)}
+	for name, values := range params {
+		m.Axes[name] = matrixValues(config, where, values)
+	}
+	m.Exclude = matrixEntries(config, where, mm["exclude"])
+	return m
+}
+
+// matrixValues reads an axis given as a list or a single value
+func matrixValues(config *PipelineConfig, where string, v interface{}) []string {
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+	var values []string
+	for _, item := range list {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}:
+			config.approximated("matrix", "%s: matrix values that are objects or lists are converted to text", where)
+		}
+		values = append(values, fmt.Sprint(item))
+	}
+	return values
+}
+
+func matrixEntries(config *PipelineConfig, where string, v interface{}) []map[string]string {
+	list, _ := v.([]interface{})
+	var entries []map[string]string
+	for _, item := range list {
+		if im, ok := item.(map[string]interface{}); ok {
+			entry := make(map[string]string, len(im))
+			for k, val := range im {
+				entry[k] = matrixValues(config, where, val)[0]
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// rawYAML decodes content like yaml.Unmarshal but keeps scalars as written,
+// so matrix values such as 3.10 or 08 are not read as numbers
+func rawYAML(content []byte) map[string]interface{} {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	m, _ := rawNode(doc.Content[0]).(map[string]interface{})
+	return m
+}
+
+func rawNode(n *yaml.Node) interface{} {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return rawNode(n.Alias)
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			list = append(list, rawNode(item))
+		}
+		return list
+	case yaml.MappingNode:
+		m := make(map[string]interface{})
+		var merged []interface{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if k.ShortTag() == "!!merge" {
+				if v.Kind == yaml.SequenceNode {
+					for _, src := range v.Content {
+						merged = append(merged, rawNode(src))
+					}
+				} else {
+					merged = append(merged, rawNode(v))
+				}
+				continue
+			}
+			m[k.Value] = rawNode(v)
+		}
+		// Keys set on the mapping itself win over merged ones
+		for _, src := range merged {
+			if sm, ok := src.(map[string]interface{}); ok {
+				for k, v := range sm {
+					if _, set := m[k]; !set {
+						m[k] = v
+					}
+				}
+			}
+		}
+		return m
+	case yaml.ScalarNode:
+		if n.ShortTag() == "!!null" {
+			return nil
+		}
+		return n.Value
+	}
+	return nil
+}
+
+// rawPath follows map keys through a rawYAML tree
+func rawPath(v interface{}, keys ...string) interface{} {
+	for _, k := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// matrixVariable is the variable name a matrix value gets on GitLab
+func matrixVariable(name string) string {
+	return nonIdentifierChars.ReplaceAllString(name, "_")
+}
+
+// useMatrixRefs rewrites the given references to matrix variables, such as
+// GitLab's $NODE, into ${{ matrix.NODE }}
+func useMatrixRefs(job Job, pattern func(name string) string) Job {
+	if job.Matrix == nil {
+		return job
+	}
+	var refs []*regexp.Regexp
+	vars := job.Matrix.Variables()
+	for _, name := range vars {
+		refs = append(refs, regexp.MustCompile(pattern(regexp.QuoteMeta(name))))
+	}
+	return mapJobStrings(job, func(s string) string {
+		for i, re := range refs {
+			s = re.ReplaceAllLiteralString(s, "${{ matrix."+vars[i]+" }}")
+		}
+		return s
+	})
+}
+
+// matrixGrid lays a job's combinations out as dimensions for targets that
+// run the product of their values: the values of each variable, and the
+// products the matrix does not run, which have to be skipped
+func matrixGrid(config *PipelineConfig, job Job, target string) (vars []string, setup map[string][]string, skipped []map[string]string) {
+	combos := job.Matrix.Combinations()
+	vars = job.Matrix.Variables()
+	setup = make(map[string][]string)
+	for _, c := range combos {
+		for _, v := range vars {
+			value, ok := c[v]
+			if !ok {
+				config.approximated("matrix", "job '%s': combination %s sets no %s; %s gives every combination a value for each dimension", job.Name, describeCombination(c), v, target)
+				continue
+			}
+			if !containsString(setup[v], value) {
+				setup[v] = append(setup[v], value)
+			}
+		}
+	}
+
+	product := []map[string]string{{}}
+	for _, v := range vars {
+		var next []map[string]string
+		for _, c := range product {
+			for _, value := range setup[v] {
+				n := copyStrings(c)
+				n[v] = value
+				next = append(next, n)
+			}
+		}
+		product = next
+	}
+	for _, c := range product {
+		found := false
+		for _, combo := range combos {
+			if matchesAll(combo, c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			skipped = append(skipped, c)
+		}
+	}
+	return vars, setup, skipped
+}
+
+// lowerMatrices rewrites ${{ matrix.x }} for the target. GitLab, CircleCI,
+// Buildkite and Harness get their own variable syntax, as do a Woodpecker
+// workflow of one job and registered platforms giving one; targets without
+// matrix support keep the first combination only.
+func lowerMatrices(config *PipelineConfig, target Platform) []Job {
+	if target == GitHub {
+		return config.Jobs
+	}
+	jobs := make([]Job, len(config.Jobs))
+	for i, job := range config.Jobs {
+		jobs[i] = job
+		if job.Matrix == nil {
+			continue
+		}
+		if target == Woodpecker && len(config.Jobs) == 1 {
+			// The workflow runs the job's matrix itself
+			continue
+		}
+		if matrixRefPattern.MatchString(job.RunsOn) && (target == GitLab || target == CircleCI) {
+			config.approximated("runs-on", "job '%s' picks its runner from the matrix; every combination runs on the same %s executor", job.Name, target)
+		}
+		switch target {
+		case GitLab:
+			jobs[i] = mapJobStrings(job, func(s string) string {
+				return matrixRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+					return "$" + matrixVariable(matrixRefPattern.FindStringSubmatch(ref)[1])
+				})
+			})
+		case CircleCI:
+			jobs[i] = mapJobStrings(job, func(s string) string {
+				return matrixRefPattern.ReplaceAllString(s, "<< parameters.$1 >>")
+			})
+		case Buildkite:
+			jobs[i] = mapJobStrings(job, func(s string) string {
+				return matrixRefPattern.ReplaceAllString(s, "{{matrix.$1}}")
+			})
+		case Harness:
+			jobs[i] = mapJobStrings(job, func(s string) string {
+				return matrixRefPattern.ReplaceAllString(s, "<+matrix.$1>")
+			})
+		default:
+			if syntax := capabilities(target).Matrix; syntax != "" {
+				// A registered platform with matrices of its own
+				jobs[i] = mapJobStrings(job, func(s string) string {
+					return matrixRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+						return fmt.Sprintf(syntax, matrixRefPattern.FindStringSubmatch(ref)[1])
+					})
+				})
+				continue
+			}
+			combos := job.Matrix.Combinations()
+			if len(combos) == 0 {
+				continue
+			}
+			first := combos[0]
+			jobs[i] = mapJobStrings(job, func(s string) string {
+				return matrixRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+					if v, ok := first[matrixRefPattern.FindStringSubmatch(ref)[1]]; ok {
+						return v
+					}
+					return ref
+				})
+			})
+			jobs[i].Matrix = nil
+			config.approximated("matrix", "job '%s' runs a matrix of %d combinations; the %s generator has no matrix support, so only %s is converted", job.Name, len(combos), target, describeCombination(first))
+		}
+	}
+	return jobs
+}
+
+func describeCombination(c map[string]string) string {
+	var parts []string
+	for _, k := range sortedKeys(c) {
+		parts = append(parts, k+"="+c[k])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// mapJobStrings returns a copy of job with f applied to the strings steps
+// and containers can reference matrix values in
+func mapJobStrings(job Job, f func(string) string) Job {
+	mapAll := func(m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		out := make(map[string]string, len(m))
+		for k, v := range m {
+			out[k] = f(v)
+		}
+		return out
+	}
+
+	job.RunsOn = f(job.RunsOn)
+	job.Condition = f(job.Condition)
+	job.Environment = mapAll(job.Environment)
+	if job.Container != nil {
+		c := *job.Container
+		c.Image = f(c.Image)
+		c.Env = mapAll(c.Env)
+		job.Container = &c
+	}
+	services := make([]Service, len(job.Services))
+	for i, svc := range job.Services {
+		svc.Image = f(svc.Image)
+		svc.Env = mapAll(svc.Env)
+		services[i] = svc
+	}
+	job.Services = services
+	steps := make([]Step, len(job.Steps))
+	for i, step := range job.Steps {
+		step.Name = f(step.Name)
+		step.Run = f(step.Run)
+		step.Image = f(step.Image)
+		step.If = f(step.If)
+		step.WorkDir = f(step.WorkDir)
+		step.With = mapAll(step.With)
+		step.Env = mapAll(step.Env)
+		steps[i] = step
+	}
+	job.Steps = steps
+	if job.Call != nil {
+		call := *job.Call
+		call.With = mapAll(call.With)
+		job.Call = &call
+	}
+	return job
+}
+
+// circleCIMatrix lays a matrix out as CircleCI parameters plus exclude
+// entries, which have to name a full combination. Values of variables that
+// only some include entries set are left empty elsewhere.
+func circleCIMatrix(config *PipelineConfig, job Job) (map[string][]string, []map[string]string) {
+	combos := job.Matrix.Combinations()
+	vars := job.Matrix.Variables()
+	axes := make(map[string][]string, len(vars))
+	partial := false
+	for _, c := range combos {
+		for _, name := range vars {
+			v, ok := c[name]
+			partial = partial || !ok
+			if !containsString(axes[name], v) {
+				axes[name] = append(axes[name], v)
+			}
+		}
+	}
+	if partial {
+		config.approximated("matrix", "job '%s': matrix include entries that add variables to only some combinations leave them empty in the other CircleCI jobs", job.Name)
+	}
+
+	// Exclude every combination of the axes the source does not run
+	present := make(map[string]bool, len(combos))
+	for _, c := range combos {
+		present[describeCombination(fillVars(c, vars))] = true
+	}
+	var exclude []map[string]string
+	for _, c := range (&Matrix{Axes: axes}).Combinations() {
+		if !present[describeCombination(c)] {
+			exclude = append(exclude, c)
+		}
+	}
+	return axes, exclude
+}
+
+func fillVars(c map[string]string, vars []string) map[string]string {
+	out := copyStrings(c)
+	for _, name := range vars {
+		if _, ok := out[name]; !ok {
+			out[name] = ""
+		}
+	}
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matrixScalar quotes a matrix value that YAML would not read back as the
+// same text, such as 3.10 or a value with a comma. With strict, values YAML
+// reads as numbers or booleans are quoted too, for targets whose variables
+// must be strings.
+func matrixScalar(s string, strict bool) string {
+	var v interface{}
+	plain := s != "" && strings.TrimSpace(s) == s && !strings.ContainsAny(s, ",[]{}#&*!|>'\"%@`") && !strings.Contains(s, ": ")
+	if plain && yaml.Unmarshal([]byte(s), &v) == nil && fmt.Sprint(v) == s {
+		if _, isString := v.(string); isString || !strict {
+			return s
+		}
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// keptScalar is a matrix or input value as written: plain when YAML reads
+// it back as the same text, as matrixScalar decides, and a quoted string
+// otherwise
+func keptScalar(s string, strict bool) *yaml.Node {
+	if matrixScalar(s, strict) == s {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: s}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.SingleQuotedStyle, Value: s}
+}
+
+// flowSeq is values as a YAML flow sequence of kept scalars
+func flowSeq(values []string, strict bool) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+	for _, v := range values {
+		n.Content = append(n.Content, keptScalar(v, strict))
+	}
+	return n
+}
+
+// matrixList is include or exclude entries with their keys sorted
+func matrixList(entries []map[string]string, strict bool) []yamlMap {
+	var list []yamlMap
+	for _, e := range entries {
+		var m yamlMap
+		for _, k := range sortedKeys(e) {
+			m.set(k, keptScalar(e[k], strict))
+		}
+		list = append(list, m)
+	}
+	return list
+}
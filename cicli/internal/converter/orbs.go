@@ -0,0 +1,336 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OrbTranslation turns the parameters of a CircleCI orb command or job into
+// normalized steps. Like TaskTranslation, steps set Uses to the GitHub
+// Actions equivalent and Run to a shell equivalent where one exists.
+type OrbTranslation func(params map[string]string) []Step
+
+// CircleCIOrbs maps orb commands and jobs to translations, keyed by the orb's
+// registry name and the command or job, e.g. circleci/node/install. Register
+// additional ones with RegisterOrb or in OrbMappingFile.
+var CircleCIOrbs = map[string]OrbTranslation{
+	"circleci/node/install": func(p map[string]string) []Step {
+		return []Step{setupStep("actions/setup-node@v4", "node-version", p["node-version"], nvmCommand)}
+	},
+	"circleci/node/install-packages": func(p map[string]string) []Step {
+		return []Step{nodeInstallPackages(p)}
+	},
+	"circleci/node/test": func(p map[string]string) []Step {
+		run := p["run-command"]
+		if run == "" {
+			run = "test"
+		}
+		return []Step{
+			{Name: "Checkout", Uses: "actions/checkout@v4"},
+			setupStep("actions/setup-node@v4", "node-version", p["version"], nvmCommand),
+			nodeInstallPackages(p),
+			{Run: nodePackageManager(p) + " run " + run, WorkDir: p["app-dir"]},
+		}
+	},
+	"circleci/python/install-packages": func(p map[string]string) []Step {
+		run := "pipenv install --dev"
+		switch p["pkg-manager"] {
+		case "pip":
+			file := p["pip-dependency-file"]
+			if file == "" {
+				file = "requirements.txt"
+			}
+			run = "pip install -r " + file
+		case "poetry":
+			run = "poetry install"
+		}
+		return []Step{{Run: run, WorkDir: p["app-dir"]}}
+	},
+	"circleci/go/install": func(p map[string]string) []Step {
+		return []Step{setupStep("actions/setup-go@v5", "go-version", p["version"], "")}
+	},
+	"circleci/go/mod-download": func(p map[string]string) []Step {
+		return []Step{{Run: "go mod download"}}
+	},
+	"circleci/go/mod-download-cached": func(p map[string]string) []Step {
+		return []Step{{Run: "go mod download"}}
+	},
+	"circleci/aws-cli/install": func(p map[string]string) []Step {
+		return []Step{{Name: "Install AWS CLI", Run: awsCLIInstall}}
+	},
+	"circleci/aws-cli/setup": func(p map[string]string) []Step {
+		return []Step{awsCredentials(p)}
+	},
+	"circleci/docker/check": func(p map[string]string) []Step {
+		return []Step{dockerLogin(p)}
+	},
+	"circleci/docker/build": func(p map[string]string) []Step {
+		return []Step{{Run: dockerBuild(dockerImage(p), p)}}
+	},
+	"circleci/docker/push": func(p map[string]string) []Step {
+		return []Step{{Run: "docker push " + dockerImage(p)}}
+	},
+	"circleci/docker/publish": func(p map[string]string) []Step {
+		image := dockerImage(p)
+		return []Step{
+			{Name: "Checkout", Uses: "actions/checkout@v4"},
+			dockerLogin(p),
+			{Run: dockerBuild(image, p)},
+			{Run: "docker push " + image},
+		}
+	},
+	"circleci/aws-ecr/build-and-push-image": func(p map[string]string) []Step {
+		region := p["region"]
+		if region == "" {
+			region = "$AWS_DEFAULT_REGION"
+		}
+		registry := fmt.Sprintf("$%s.dkr.ecr.%s.amazonaws.com", envVarName(p["account-id"], "AWS_ACCOUNT_ID"), region)
+		image := registry + "/" + p["repo"] + ":" + orDefault(p["tag"], "latest")
+		return []Step{
+			{Name: "Checkout", Uses: "actions/checkout@v4"},
+			awsCredentials(p),
+			{Run: fmt.Sprintf("aws ecr get-login-password --region %s | docker login --username AWS --password-stdin %s", region, registry)},
+			{Run: dockerBuild(image, p)},
+			{Run: "docker push " + image},
+		}
+	},
+	"circleci/kubernetes/install-kubectl": func(p map[string]string) []Step {
+		step := Step{Uses: "azure/setup-kubectl@v4", Run: kubectlInstall}
+		if version := p["kubectl-version"]; version != "" && version != "latest" {
+			step.With = map[string]string{"version": version}
+		}
+		return []Step{step}
+	},
+}
+
+// RegisterOrb adds or replaces the translation for an orb command or job
+func RegisterOrb(name string, t OrbTranslation) {
+	CircleCIOrbs[name] = t
+}
+
+// OrbMappingFile holds project-specific orb translations, read when
+// converting from CircleCI. Each entry names an orb command or job, the
+// defaults of its parameters and the steps it expands to; << parameters.x >>
+// in a step is replaced with the parameter's value:
+//
+//	acme/deploy/release:
+//	  parameters:
+//	    version: latest
+//	  steps:
+//	    - run: ./release.sh << parameters.version >>
+var OrbMappingFile = filepath.Join(".cicli", "orbs.yml")
+
+// orbMapping is one entry of OrbMappingFile
+type orbMapping struct {
+	Parameters map[string]string `yaml:"parameters"`
+	Steps      []struct {
+		Name    string            `yaml:"name"`
+		Uses    string            `yaml:"uses"`
+		With    map[string]string `yaml:"with"`
+		Run     string            `yaml:"run"`
+		Env     map[string]string `yaml:"env"`
+		WorkDir string            `yaml:"working-directory"`
+	} `yaml:"steps"`
+}
+
+var orbParameterRef = regexp.MustCompile(`<<\s*parameters\.([\w-]+)\s*>>`)
+
+// translation substitutes parameters into the mapping's steps
+func (m orbMapping) translation() OrbTranslation {
+	return func(params map[string]string) []Step {
+		value := func(s string) string {
+			return orbParameterRef.ReplaceAllStringFunc(s, func(ref string) string {
+				name := orbParameterRef.FindStringSubmatch(ref)[1]
+				if v, ok := params[name]; ok {
+					return v
+				}
+				return m.Parameters[name]
+			})
+		}
+		values := func(in map[string]string) map[string]string {
+			if len(in) == 0 {
+				return nil
+			}
+			out := make(map[string]string, len(in))
+			for k, v := range in {
+				out[k] = value(v)
+			}
+			return out
+		}
+
+		steps := make([]Step, len(m.Steps))
+		for i, s := range m.Steps {
+			steps[i] = Step{
+				Name:    value(s.Name),
+				Uses:    s.Uses,
+				With:    values(s.With),
+				Run:     value(s.Run),
+				Env:     values(s.Env),
+				WorkDir: value(s.WorkDir),
+			}
+		}
+		return steps
+	}
+}
+
+// circleCIOrbs resolves the orb commands and jobs a CircleCI config uses
+type circleCIOrbs struct {
+	aliases      map[string]string // alias in orbs: -> registry name without version
+	translations map[string]OrbTranslation
+}
+
+// loadCircleCIOrbs reads the orbs: section and overlays OrbMappingFile, when
+// present, on the built-in translations
+func loadCircleCIOrbs(config *PipelineConfig, ci map[string]interface{}) (*circleCIOrbs, error) {
+	orbs := &circleCIOrbs{aliases: make(map[string]string), translations: make(map[string]OrbTranslation)}
+	for name, t := range CircleCIOrbs {
+		orbs.translations[name] = t
+	}
+
+	data, err := os.ReadFile(OrbMappingFile)
+	if err == nil {
+		var mappings map[string]orbMapping
+		if err := yaml.Unmarshal(data, &mappings); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", OrbMappingFile, err)
+		}
+		for name, m := range mappings {
+			orbs.translations[name] = m.translation()
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	declared, _ := ci["orbs"].(map[string]interface{})
+	for _, alias := range sortedKeys(stringMap(declared)) {
+		ref, ok := declared[alias].(string)
+		if !ok {
+			config.dropped("orbs", "inline orb %s is not converted", alias)
+			continue
+		}
+		orbs.aliases[alias] = strings.SplitN(ref, "@", 2)[0]
+	}
+	return orbs, nil
+}
+
+// expand translates a reference such as node/install; ok is false when the
+// reference is not an orb command or job with a translation
+func (o *circleCIOrbs) expand(ref string, params map[string]string) ([]Step, bool) {
+	alias, name, found := strings.Cut(ref, "/")
+	if !found || o.aliases[alias] == "" {
+		return nil, false
+	}
+	t, ok := o.translations[o.aliases[alias]+"/"+name]
+	if !ok {
+		return nil, false
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	return t(params), true
+}
+
+// orbParameters reads the parameters passed to an orb command or job,
+// skipping the workflow keys that are not parameters
+func orbParameters(v interface{}, skip map[string]bool) map[string]string {
+	m, _ := v.(map[string]interface{})
+	params := make(map[string]string, len(m))
+	for k, val := range m {
+		if !skip[k] {
+			params[k] = fmt.Sprint(val)
+		}
+	}
+	return params
+}
+
+const awsCLIInstall = `command -v aws || (curl -sSL https://awscli.amazonaws.com/awscli-exe-linux-x86_64.zip -o awscliv2.zip && unzip -q awscliv2.zip && sudo ./aws/install)`
+
+const kubectlInstall = `command -v kubectl || (curl -sSLO "https://dl.k8s.io/release/$(curl -sSL https://dl.k8s.io/release/stable.txt)/bin/linux/amd64/kubectl" && sudo install kubectl /usr/local/bin/kubectl)`
+
+// awsCredentials configures the AWS CLI from the orb's credential
+// parameters, which name environment variables that become secrets
+func awsCredentials(p map[string]string) Step {
+	region := p["region"]
+	if region == "" {
+		region = "${{ secrets.AWS_DEFAULT_REGION }}"
+	}
+	step := Step{
+		Uses: "aws-actions/configure-aws-credentials@v4",
+		With: map[string]string{"aws-region": region},
+		Run:  "aws configure set region " + orDefault(p["region"], "$AWS_DEFAULT_REGION"),
+	}
+	if role := p["role_arn"]; role != "" {
+		step.With["role-to-assume"] = role
+		return step
+	}
+	step.With["aws-access-key-id"] = fmt.Sprintf("${{ secrets.%s }}", envVarName(p["aws_access_key_id"], "AWS_ACCESS_KEY_ID"))
+	step.With["aws-secret-access-key"] = fmt.Sprintf("${{ secrets.%s }}", envVarName(p["aws_secret_access_key"], "AWS_SECRET_ACCESS_KEY"))
+	return step
+}
+
+// nodePackageManager is the node orb's pkg-manager parameter
+func nodePackageManager(p map[string]string) string {
+	return orDefault(p["pkg-manager"], "npm")
+}
+
+func nodeInstallPackages(p map[string]string) Step {
+	run := "npm ci"
+	switch nodePackageManager(p) {
+	case "yarn", "yarn-berry":
+		run = "yarn install --frozen-lockfile"
+	case "pnpm":
+		run = "pnpm install --frozen-lockfile"
+	}
+	return Step{Run: run, WorkDir: p["app-dir"]}
+}
+
+// dockerLogin logs in with the docker orb's credential parameters, which
+// name environment variables that become secrets
+func dockerLogin(p map[string]string) Step {
+	user := envVarName(p["docker-username"], "DOCKER_LOGIN")
+	password := envVarName(p["docker-password"], "DOCKER_PASSWORD")
+	step := Step{
+		Uses: "docker/login-action@v3",
+		With: map[string]string{
+			"username": fmt.Sprintf("${{ secrets.%s }}", user),
+			"password": fmt.Sprintf("${{ secrets.%s }}", password),
+		},
+		Run: fmt.Sprintf(`echo "$%s" | docker login -u "$%s" --password-stdin`, password, user),
+	}
+	if registry := p["registry"]; registry != "" && registry != "docker.io" {
+		step.With["registry"] = registry
+		step.Run += " " + registry
+	}
+	return step
+}
+
+// dockerImage is the registry/image:tag the docker orb builds and pushes
+func dockerImage(p map[string]string) string {
+	image := p["image"] + ":" + strings.SplitN(orDefault(p["tag"], "latest"), ",", 2)[0]
+	if registry := p["registry"]; registry != "" && registry != "docker.io" {
+		image = registry + "/" + image
+	}
+	return image
+}
+
+func dockerBuild(image string, p map[string]string) string {
+	path := orDefault(p["path"], ".")
+	return fmt.Sprintf("docker build -t %s -f %s %s", image, filepath.Join(path, orDefault(p["dockerfile"], "Dockerfile")), path)
+}
+
+// envVarName strips the $ from an env_var_name parameter
+func envVarName(v, def string) string {
+	v = strings.Trim(strings.TrimPrefix(v, "$"), "{}")
+	return orDefault(v, def)
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,87 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// outputDir holds step and job output files on platforms without native
+// outputs. Each step with an id writes key=value lines to <id>.env and each
+// job collects its outputs in <job>.env, which is dotenv-compatible.
+const outputDir = ".outputs"
+
+var (
+	needsOutputPattern = regexp.MustCompile(`\$\{\{\s*needs\.([\w-]+)\.outputs\.([\w-]+)\s*\}\}`)
+	stepOutputPattern  = regexp.MustCompile(`\$\{\{\s*steps\.([\w-]+)\.outputs\.([\w-]+)\s*\}\}`)
+	githubOutputVar    = regexp.MustCompile(`"?\$\{?GITHUB_OUTPUT\}?"?`)
+	nonVarChars        = regexp.MustCompile(`[^A-Z0-9_]+`)
+)
+
+// outputVariable is the variable a job output is exposed as downstream,
+// e.g. build's version becomes BUILD_VERSION
+func outputVariable(job, name string) string {
+	return nonVarChars.ReplaceAllString(strings.ToUpper(job+"_"+name), "_")
+}
+
+// jobOutputFile is the dotenv file collecting a job's outputs
+func jobOutputFile(job string) string {
+	return fmt.Sprintf("%s/%s.env", outputDir, sanitizeName(job))
+}
+
+// writesOutputs reports whether a job needs the output directory
+func writesOutputs(job Job) bool {
+	if len(job.Outputs) > 0 {
+		return true
+	}
+	for _, step := range job.Steps {
+		if githubOutputVar.MatchString(step.Run) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellOutputs rewrites GitHub output plumbing in a shell command:
+// writes to $GITHUB_OUTPUT go to the step's file, steps.<id>.outputs.<key>
+// reads it back and needs.<job>.outputs.<name> becomes a variable
+func shellOutputs(command string, step Step) string {
+	if step.ID != "" {
+		command = githubOutputVar.ReplaceAllString(command, fmt.Sprintf("%s/%s.env", outputDir, step.ID))
+	} else {
+		// Nothing can reference an output of a step without an id
+		command = githubOutputVar.ReplaceAllString(command, "/dev/null")
+	}
+	return shellOutputRefs(command)
+}
+
+// shellOutputRefs replaces output expressions with shell equivalents
+func shellOutputRefs(s string) string {
+	s = stepOutputPattern.ReplaceAllString(s, fmt.Sprintf("$$(sed -n 's/^${2}=//p' %s/${1}.env)", outputDir))
+	return needsOutputPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := needsOutputPattern.FindStringSubmatch(ref)
+		return "$" + outputVariable(m[1], m[2])
+	})
+}
+
+// jobOutputCommands append the job's outputs to its dotenv file
+func jobOutputCommands(job Job) []string {
+	var commands []string
+	for _, out := range job.Outputs {
+		commands = append(commands, fmt.Sprintf(`echo "%s=%s" >> %s`, outputVariable(job.Name, out.Name), shellOutputRefs(out.Value), jobOutputFile(job.Name)))
+	}
+	return commands
+}
+
+// outputProducers returns the jobs this job depends on that have outputs
+func outputProducers(config *PipelineConfig, job Job) []string {
+	var producers []string
+	for _, dep := range job.DependsOn {
+		for _, other := range config.Jobs {
+			if other.Name == dep && len(other.Outputs) > 0 {
+				producers = append(producers, dep)
+			}
+		}
+	}
+	return producers
+}
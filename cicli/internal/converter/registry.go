@@ -0,0 +1,163 @@
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// PlatformDriver converts a CI platform the converter has no built-in
+// support for. A driver lives in a package of its own and registers itself
+// from an init function; Parse, Generate, DetectPlatform and Discover fall
+// back to the registered drivers for platforms they do not know, and the
+// shared passes around them (caches, matrices, variables, secrets) read
+// what they need from Capabilities.
+type PlatformDriver interface {
+	// Platform is the name given to --from and --to
+	Platform() Platform
+	// Detect reports whether path is a CI file of the platform. Paths use
+	// forward slashes.
+	Detect(path string) bool
+	// Parse reads a CI file into the normalized config. content has LF line
+	// endings; inputPath is where it was read from.
+	Parse(content []byte, inputPath string) (*PipelineConfig, error)
+	// Generate writes a normalized config as the platform's CI file
+	Generate(config *PipelineConfig) (string, error)
+	// Capabilities describes the platform to the shared passes
+	Capabilities() Capabilities
+}
+
+// Capabilities describes a driver's platform
+type Capabilities struct {
+	Source bool // Parse is implemented
+	Target bool // Generate is implemented
+
+	// Files are glob patterns, relative to a repository root, of the
+	// platform's CI files
+	Files []string
+	// Output is where a generated file goes by default
+	Output string
+	// Variables maps GitHub runner variables, such as GITHUB_SHA, to the
+	// platform's own
+	Variables map[string]string
+	// VariablePrefixes start the names of variables the platform provides
+	// itself, so they are not taken for secrets
+	VariablePrefixes []string
+	// Matrix refers to a matrix value in the platform's syntax, with the
+	// value's name as %s. Without it a job with a matrix runs its first
+	// combination only.
+	Matrix string
+	// Secrets tells how to create a secret on the platform, with its name
+	// as %s
+	Secrets string
+	// Comment starts a line comment in the platform's files; # when empty
+	Comment string
+	// NotYAML is set for platforms whose files are not YAML, so the output
+	// of their driver is not checked as YAML
+	NotYAML bool
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[Platform]PlatformDriver)
+)
+
+// Register makes a driver available by its platform name. It panics if the
+// name is empty, built in or already registered, like database/sql.Register.
+func Register(driver PlatformDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	name := driver.Platform()
+	if name == "" {
+		panic("converter: Register driver with an empty platform name")
+	}
+	if isBuiltinPlatform(name) {
+		panic(fmt.Sprintf("converter: Register driver for built-in platform %s", name))
+	}
+	if _, dup := drivers[name]; dup {
+		panic(fmt.Sprintf("converter: Register called twice for platform %s", name))
+	}
+	drivers[name] = driver
+}
+
+// Drivers lists the registered drivers by platform name
+func Drivers() []PlatformDriver {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	list := make([]PlatformDriver, 0, len(drivers))
+	for _, d := range drivers {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Platform() < list[j].Platform() })
+	return list
+}
+
+// LookupDriver returns the registered driver of a platform, or nil
+func LookupDriver(platform Platform) PlatformDriver {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	return drivers[platform]
+}
+
+func isBuiltinPlatform(platform Platform) bool {
+	for _, p := range builtinPlatforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilities returns a registered platform's capabilities; built-in
+// platforms have none
+func capabilities(platform Platform) Capabilities {
+	if d := LookupDriver(platform); d != nil {
+		return d.Capabilities()
+	}
+	return Capabilities{}
+}
+
+// parseWithDriver parses content with the platform's driver
+func parseWithDriver(platform Platform, content []byte, inputPath string) (*PipelineConfig, error) {
+	d := LookupDriver(platform)
+	if d == nil || !d.Capabilities().Source {
+		return nil, fmt.Errorf("unsupported source platform: %s", platform)
+	}
+	return d.Parse(content, inputPath)
+}
+
+// generateWithDriver generates config with the platform's driver
+func generateWithDriver(platform Platform, config *PipelineConfig) (string, error) {
+	d := LookupDriver(platform)
+	if d == nil || !d.Capabilities().Target {
+		return "", fmt.Errorf("unsupported target platform: %s", platform)
+	}
+	return d.Generate(config)
+}
+
+// detectWithDriver returns the first registered platform, by name, whose
+// driver claims path
+func detectWithDriver(path string) Platform {
+	for _, d := range Drivers() {
+		if d.Detect(path) {
+			return d.Platform()
+		}
+	}
+	return ""
+}
+
+// discoverWithDriver finds a registered platform's files under root
+func discoverWithDriver(root string, platform Platform, add func(string)) error {
+	d := LookupDriver(platform)
+	if d == nil || !d.Capabilities().Source {
+		return fmt.Errorf("unsupported source platform: %s", platform)
+	}
+	for _, pattern := range d.Capabilities().Files {
+		matches, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		for _, m := range matches {
+			add(m)
+		}
+	}
+	return nil
+}
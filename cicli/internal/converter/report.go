@@ -0,0 +1,174 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FindingKind says how much of a source construct made it into the output
+type FindingKind string
+
+const (
+	Dropped      FindingKind = "dropped"      // nothing in the output corresponds to it
+	Approximated FindingKind = "approximated" // converted to something that behaves differently
+	NeedsReview  FindingKind = "review"       // converted, but relies on settings outside the file
+)
+
+// findingOrder ranks findings from most to least severe
+var findingOrder = []FindingKind{Dropped, Approximated, NeedsReview}
+
+// Finding is a source construct the conversion could not carry over exactly
+type Finding struct {
+	Kind      FindingKind `json:"kind"`
+	Construct string      `json:"construct,omitempty"` // source keyword, e.g. rules:changes or orbs
+	Message   string      `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Kind, f.Message)
+}
+
+// record adds a finding unless the same message was already recorded
+func (p *PipelineConfig) record(kind FindingKind, construct, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	for _, f := range p.Findings {
+		if f.Message == msg {
+			return
+		}
+	}
+	p.Findings = append(p.Findings, Finding{Kind: kind, Construct: construct, Message: msg})
+}
+
+// note records a conversion caveat someone has to check by hand
+func (p *PipelineConfig) note(format string, args ...interface{}) {
+	p.record(NeedsReview, "", format, args...)
+}
+
+// dropped records a source construct the output leaves out
+func (p *PipelineConfig) dropped(construct, format string, args ...interface{}) {
+	p.record(Dropped, construct, format, args...)
+}
+
+// approximated records a source construct the output only imitates
+func (p *PipelineConfig) approximated(construct, format string, args ...interface{}) {
+	p.record(Approximated, construct, format, args...)
+}
+
+// dropKeys records every key of m the parser has no translation for. where
+// names the place the keys appear in, e.g. "job 'build'".
+func (p *PipelineConfig) dropKeys(where string, m map[string]interface{}, handled map[string]bool) {
+	for _, k := range sortedKeys(stringMap(m)) {
+		if !handled[k] {
+			p.dropped(k, "%s: '%s' is not converted", where, k)
+		}
+	}
+}
+
+// keySet builds the handled keys for dropKeys
+func keySet(keys ...string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+var actionPlaceholder = regexp.MustCompile(`# Action: (\S+) \(manual conversion needed\)`)
+
+// actionPlaceholders records the actions a generator left as placeholder
+// comments because the target has no equivalent
+func actionPlaceholders(config *PipelineConfig, output string) {
+	for _, m := range actionPlaceholder.FindAllStringSubmatch(output, -1) {
+		config.dropped("uses", "action %s has no equivalent; the output has a placeholder comment instead", m[1])
+	}
+}
+
+// Report lists what conversions dropped, approximated or left for review,
+// file by file
+type Report struct {
+	From  Platform     `json:"from"`
+	To    Platform     `json:"to"`
+	Files []FileReport `json:"files"`
+}
+
+// FileReport holds the findings for one converted file
+type FileReport struct {
+	Input    string    `json:"input"`
+	Output   string    `json:"output"`
+	Findings []Finding `json:"findings"`
+}
+
+// Counts returns the number of findings of each kind
+func (r *Report) Counts() map[FindingKind]int {
+	counts := make(map[FindingKind]int)
+	for _, f := range r.Files {
+		for _, finding := range f.Findings {
+			counts[finding.Kind]++
+		}
+	}
+	return counts
+}
+
+// Markdown renders the report for reviewers
+func (r *Report) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Conversion report: %s → %s\n\n", r.From, r.To))
+
+	counts := r.Counts()
+	sb.WriteString("| Dropped | Approximated | Needs review |\n|---------|--------------|--------------|\n")
+	sb.WriteString(fmt.Sprintf("| %d | %d | %d |\n", counts[Dropped], counts[Approximated], counts[NeedsReview]))
+
+	for _, f := range r.Files {
+		sb.WriteString(fmt.Sprintf("\n## `%s` → `%s`\n\n", f.Input, f.Output))
+		if len(f.Findings) == 0 {
+			sb.WriteString("Converted without losing anything cicli knows about.\n")
+			continue
+		}
+		sb.WriteString("| Kind | Construct | Details |\n|------|-----------|---------|\n")
+		for _, finding := range f.Findings {
+			construct := ""
+			if finding.Construct != "" {
+				construct = "`" + finding.Construct + "`"
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s |\n", finding.Kind, construct, strings.ReplaceAll(finding.Message, "|", `\|`)))
+		}
+	}
+	return sb.String()
+}
+
+func kindRank(kind FindingKind) int {
+	for i, k := range findingOrder {
+		if k == kind {
+			return i
+		}
+	}
+	return len(findingOrder)
+}
+
+// Render formats the report as JSON for .json paths and as Markdown otherwise
+func (r *Report) Render(path string) (string, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+	return r.Markdown(), nil
+}
+
+// WriteReport stores the report at path, in the format its extension picks
+func WriteReport(path string, r *Report) error {
+	content, err := r.Render(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
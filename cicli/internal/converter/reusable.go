@@ -0,0 +1,589 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WorkflowCall is a job that runs a reusable GitHub workflow instead of steps
+type WorkflowCall struct {
+	Workflow       string            `yaml:"workflow"` // ./.github/workflows/x.yml or org/repo/.github/workflows/x.yml@ref
+	With           map[string]string `yaml:"with,omitempty"`
+	Secrets        map[string]string `yaml:"secrets,omitempty"`
+	InheritSecrets bool              `yaml:"inherit_secrets,omitempty"`
+
+	// quoted holds the with: values that were YAML strings but read as
+	// numbers or booleans without quotes, such as "1.22"
+	quoted map[string]bool
+
+	// A local workflow is parsed with the caller's inputs and secrets
+	// substituted, so targets without reusable workflows can inline it
+	Jobs     []Job     `yaml:"-"`
+	Outputs  []Output  `yaml:"-"`
+	Findings []Finding `yaml:"-"`
+}
+
+// Input is a value callers pass to a reusable pipeline (workflow_call inputs)
+type Input struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Type        string `yaml:"type,omitempty"` // string, boolean or number
+	Default     string `yaml:"default,omitempty"`
+	Required    bool   `yaml:"required,omitempty"`
+}
+
+// maxWorkflowNesting is how deep GitHub lets reusable workflows call each other
+const maxWorkflowNesting = 10
+
+var (
+	inputRefPattern     = regexp.MustCompile(`\$\{\{\s*inputs\.([\w-]+)\s*\}\}`)
+	inputExprPattern    = regexp.MustCompile(`\$\{\{[^}]*\binputs\.`)
+	secretRefPattern    = regexp.MustCompile(`\$\{\{\s*secrets\.([\w-]+)\s*\}\}`)
+	jobsOutputPattern   = regexp.MustCompile(`\$\{\{\s*jobs\.([\w-]+)\.outputs\.([\w-]+)\s*\}\}`)
+	parameterRefPattern = regexp.MustCompile(`<<\s*parameters\.([\w-]+)\s*>>`)
+	orbVersionPattern   = regexp.MustCompile(`^v?(\d+(\.\d+){0,2})$`)
+	gitlabInputTypes    = map[string]bool{"boolean": true, "number": true}
+)
+
+// Local reports whether the workflow lives in the same repository
+func (w *WorkflowCall) Local() bool {
+	return strings.HasPrefix(w.Workflow, "./")
+}
+
+// remote splits org/repo/path@ref
+func (w *WorkflowCall) remote() (repo, file, ref string) {
+	ref = "main"
+	uses := w.Workflow
+	if i := strings.LastIndex(uses, "@"); i >= 0 {
+		uses, ref = uses[:i], uses[i+1:]
+	}
+	parts := strings.SplitN(uses, "/", 3)
+	if len(parts) < 3 {
+		return uses, "", ref
+	}
+	return parts[0] + "/" + parts[1], parts[2], ref
+}
+
+// parseWorkflowCall reads a job's uses:, with: and secrets:. with: values
+// come from the job's rawYAML tree, so they keep their text. Local workflows
+// are parsed relative to the repository root.
+func (c *Converter) parseWorkflowCall(config *PipelineConfig, where, uses string, jd, raw map[string]interface{}, dir string, depth int) *WorkflowCall {
+	call := &WorkflowCall{Workflow: uses, quoted: make(map[string]bool)}
+	if with, ok := raw["with"].(map[string]interface{}); ok {
+		call.With = stringMap(with)
+		typed, _ := jd["with"].(map[string]interface{})
+		for k, v := range call.With {
+			_, isString := typed[k].(string)
+			call.quoted[k] = isString && matrixScalar(v, true) != v
+		}
+	}
+	switch secrets := jd["secrets"].(type) {
+	case string:
+		call.InheritSecrets = secrets == "inherit"
+	case map[string]interface{}:
+		call.Secrets = stringMap(secrets)
+	}
+	if !call.Local() {
+		return call
+	}
+	if depth >= maxWorkflowNesting {
+		config.dropped("uses", "%s: reusable workflows nest more than %d levels deep; %s is not inlined", where, maxWorkflowNesting, uses)
+		return call
+	}
+
+	path := filepath.Join(workflowRoot(dir), uses)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		config.dropped("uses", "%s: reusable workflow %s not found; not inlined", where, uses)
+		return call
+	}
+	child, err := c.parseGitHubWorkflow(content, filepath.Dir(path), depth+1)
+	if err != nil {
+		config.dropped("uses", "%s: reusable workflow %s is not valid YAML; not inlined", where, uses)
+		return call
+	}
+
+	values := make(map[string]string)
+	for _, in := range child.Inputs {
+		if in.Default != "" {
+			values[in.Name] = in.Default
+		}
+	}
+	for k, v := range call.With {
+		values[k] = v
+	}
+	for _, in := range child.Inputs {
+		if _, ok := values[in.Name]; !ok && in.Required {
+			config.dropped("with", "%s: required input '%s' of %s is not passed", where, in.Name, uses)
+		}
+	}
+	substitute := func(s string) string {
+		s = inputRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			if v, ok := values[inputRefPattern.FindStringSubmatch(ref)[1]]; ok {
+				return v
+			}
+			return ref
+		})
+		return secretRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			if v, ok := call.Secrets[secretRefPattern.FindStringSubmatch(ref)[1]]; ok {
+				return v
+			}
+			return ref
+		})
+	}
+
+	// The called workflow's env applies to its own jobs only
+	for _, job := range child.Jobs {
+		if len(child.Environment) > 0 {
+			env := copyStrings(child.Environment)
+			for k, v := range job.Environment {
+				env[k] = v
+			}
+			job.Environment = env
+		}
+		job = mapJobStrings(job, substitute)
+		mapJobStrings(job, func(s string) string {
+			if inputExprPattern.MatchString(s) {
+				child.approximated("inputs", "%s: expressions over inputs are not evaluated when the workflow is inlined", where)
+			}
+			return s
+		})
+		call.Jobs = append(call.Jobs, job)
+	}
+	call.Outputs = child.Outputs
+	call.Findings = child.Findings
+	return call
+}
+
+// workflowRoot returns the repository root for a workflow directory
+func workflowRoot(dir string) string {
+	if filepath.Base(dir) == "workflows" && filepath.Base(filepath.Dir(dir)) == ".github" {
+		return filepath.Dir(filepath.Dir(dir))
+	}
+	return repoRoot(dir)
+}
+
+// parseWorkflowCallTrigger reads the inputs, outputs and secrets of
+// on.workflow_call from a rawYAML tree
+func parseWorkflowCallTrigger(config *PipelineConfig, v interface{}) {
+	inputs, _ := rawPath(v, "inputs").(map[string]interface{})
+	for _, name := range sortedKeys(stringMap(inputs)) {
+		config.Inputs = append(config.Inputs, workflowInput(name, inputs[name]))
+	}
+	secrets, _ := rawPath(v, "secrets").(map[string]interface{})
+	for _, name := range sortedKeys(stringMap(secrets)) {
+		config.Secrets = append(config.Secrets, workflowInput(name, secrets[name]))
+	}
+	outputs, _ := rawPath(v, "outputs").(map[string]interface{})
+	for _, name := range sortedKeys(stringMap(outputs)) {
+		if value, ok := rawPath(outputs[name], "value").(string); ok {
+			config.Outputs = append(config.Outputs, Output{Name: name, Value: value})
+		}
+	}
+}
+
+func workflowInput(name string, v interface{}) Input {
+	in := Input{Name: name}
+	if m, ok := v.(map[string]interface{}); ok {
+		in.Description = getString(m, "description")
+		in.Type = getString(m, "type")
+		in.Default = getString(m, "default")
+		in.Required = getString(m, "required") == "true"
+	}
+	return in
+}
+
+// lowerWorkflowCalls prepares reusable workflow calls and inputs for a target
+// without GitHub's reusable workflows. Local workflows are inlined as jobs
+// named <caller>-<job>; GitLab and CircleCI generate remote calls themselves,
+// other targets get a failing placeholder.
+func lowerWorkflowCalls(config *PipelineConfig, target Platform) []Job {
+	if target == GitHub {
+		return config.Jobs
+	}
+	jobs := inlineWorkflowCalls(config, config.Jobs)
+
+	for i, job := range jobs {
+		if job.Call == nil || (!job.Call.Local() && (target == GitLab || target == CircleCI)) {
+			continue
+		}
+		// Local workflows that could not be inlined were reported when parsing
+		if !job.Call.Local() {
+			config.dropped("uses", "job '%s' calls reusable workflow %s, which %s has no equivalent for; the output has a failing placeholder instead", job.Name, job.Call.Workflow, target)
+		}
+		jobs[i].Call = nil
+		jobs[i].RunsOn = "ubuntu-latest"
+		jobs[i].Steps = []Step{{
+			Name: "Reusable workflow",
+			Run:  fmt.Sprintf(`echo "Reusable workflow %s has no equivalent; convert it by hand" && exit 1`, job.Call.Workflow),
+		}}
+	}
+
+	// Inputs of a reusable pipeline: GitLab and CircleCI keep them as
+	// inputs and parameters, other targets use the defaults
+	if len(config.Inputs) > 0 {
+		defaults := make(map[string]string)
+		for _, in := range config.Inputs {
+			defaults[in.Name] = in.Default
+		}
+		for i := range jobs {
+			jobs[i] = mapJobStrings(jobs[i], func(s string) string {
+				if inputExprPattern.MatchString(inputRefPattern.ReplaceAllString(s, "")) {
+					config.approximated("inputs", "job '%s': expressions over inputs are not evaluated on %s", jobs[i].Name, target)
+				}
+				return inputRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+					name := inputRefPattern.FindStringSubmatch(ref)[1]
+					switch target {
+					case GitLab:
+						return "$[[ inputs." + name + " ]]"
+					case CircleCI:
+						return "<< parameters." + name + " >>"
+					}
+					return defaults[name]
+				})
+			})
+		}
+		if target != GitLab && target != CircleCI {
+			config.approximated("workflow_call", "workflow_call inputs are replaced by their defaults; %s has no pipeline inputs", target)
+		}
+	}
+	if len(config.Outputs) > 0 {
+		var names []string
+		for _, out := range config.Outputs {
+			names = append(names, out.Name)
+		}
+		config.dropped("workflow_call", "workflow_call outputs %s are not converted; %s pipelines cannot return values to a caller", strings.Join(names, ", "), target)
+	}
+	if len(config.Secrets) > 0 {
+		var names []string
+		for _, s := range config.Secrets {
+			names = append(names, s.Name)
+		}
+		config.note("callers pass secrets %s; define them as CI/CD variables for %s", strings.Join(names, ", "), target)
+	}
+	return jobs
+}
+
+// inlineWorkflowCalls replaces jobs that call local workflows with the
+// workflow's jobs. Jobs that needed the caller need the inlined jobs nothing
+// else in the workflow depends on, and needs.<caller>.outputs.<name> points
+// at the job that produces the output.
+func inlineWorkflowCalls(config *PipelineConfig, jobs []Job) []Job {
+	var out []Job
+	terminals := make(map[string][]string)
+	outputs := make(map[string]map[string]string)
+
+	for _, job := range jobs {
+		if job.Call == nil || !job.Call.Local() || len(job.Call.Jobs) == 0 {
+			out = append(out, job)
+			continue
+		}
+		call := job.Call
+		for _, f := range call.Findings {
+			config.record(f.Kind, f.Construct, "%s (in %s)", f.Message, call.Workflow)
+		}
+
+		prefix := job.Name + "-"
+		inner := inlineWorkflowCalls(config, call.Jobs)
+		names := make(map[string]bool)
+		for _, child := range inner {
+			names[child.Name] = true
+		}
+		needed := make(map[string]bool)
+		for _, child := range inner {
+			for _, dep := range child.DependsOn {
+				needed[dep] = true
+			}
+		}
+
+		for _, child := range inner {
+			if !needed[child.Name] {
+				terminals[job.Name] = append(terminals[job.Name], prefix+child.Name)
+			}
+			var deps []string
+			for _, dep := range child.DependsOn {
+				if names[dep] {
+					dep = prefix + dep
+				}
+				deps = append(deps, dep)
+			}
+			if len(deps) == 0 {
+				deps = job.DependsOn
+			}
+			child.DependsOn = deps
+			switch {
+			case child.Condition == "":
+				child.Condition = job.Condition
+			case job.Condition != "":
+				child.Condition = fmt.Sprintf("(%s) && (%s)", job.Condition, child.Condition)
+			}
+			child = mapJobStrings(child, func(s string) string {
+				return needsOutputPattern.ReplaceAllStringFunc(s, func(ref string) string {
+					m := needsOutputPattern.FindStringSubmatch(ref)
+					if names[m[1]] {
+						return fmt.Sprintf("${{ needs.%s%s.outputs.%s }}", prefix, m[1], m[2])
+					}
+					return ref
+				})
+			})
+			child.Name = prefix + child.Name
+			out = append(out, child)
+		}
+
+		outputs[job.Name] = make(map[string]string)
+		for _, o := range call.Outputs {
+			if m := jobsOutputPattern.FindStringSubmatch(o.Value); m != nil {
+				outputs[job.Name][o.Name] = fmt.Sprintf("${{ needs.%s%s.outputs.%s }}", prefix, m[1], m[2])
+			}
+		}
+	}
+	if len(terminals) == 0 {
+		return out
+	}
+
+	// Point dependencies and output references at the inlined jobs
+	for i, job := range out {
+		var deps []string
+		for _, dep := range job.DependsOn {
+			if t, ok := terminals[dep]; ok {
+				deps = append(deps, t...)
+				continue
+			}
+			deps = append(deps, dep)
+		}
+		job = mapJobStrings(job, func(s string) string {
+			return needsOutputPattern.ReplaceAllStringFunc(s, func(ref string) string {
+				m := needsOutputPattern.FindStringSubmatch(ref)
+				if v, ok := outputs[m[1]][m[2]]; ok {
+					// The producer may not be one of the jobs the caller ended with
+					if producer := needsOutputPattern.FindStringSubmatch(v)[1]; !containsString(deps, producer) {
+						deps = append(deps, producer)
+					}
+					return v
+				}
+				return ref
+			})
+		})
+		job.DependsOn = deps
+		out[i] = job
+	}
+	return out
+}
+
+// runtimeInputs reports with: values computed while the pipeline runs, which
+// GitLab inputs and orb parameters cannot take: they are fixed when the
+// pipeline is created
+func runtimeInputs(config *PipelineConfig, job Job, target Platform) {
+	for _, k := range sortedKeys(job.Call.With) {
+		if strings.Contains(job.Call.With[k], "${{") {
+			config.approximated("with", "job '%s': input '%s' is computed at run time, but %s fixes it when the pipeline is created; it is passed as text", job.Name, k, target)
+		}
+	}
+}
+
+// gitlabCallInclude is the include entry of a trigger job that runs a remote
+// reusable workflow as a child pipeline. The workflow has to be converted
+// and committed to its repository under cicli's GitLab output path.
+func gitlabCallInclude(config *PipelineConfig, job Job) (project, file, ref string) {
+	project, file, ref = job.Call.remote()
+	file = filepath.ToSlash(outputPathFor(GitLab, pipelineName(file)))
+	config.note("job '%s' runs %s as a child pipeline; convert that workflow to GitLab and commit it to %s as %s", job.Name, job.Call.Workflow, project, file)
+	runtimeInputs(config, job, GitLab)
+	if len(job.Call.Secrets) > 0 {
+		config.approximated("secrets", "job '%s': secrets passed to %s are not renamed; the child pipeline sees the project's variables under their own names", job.Name, job.Call.Workflow)
+	}
+	return project, file, ref
+}
+
+// circleCIOrb is the orb a remote reusable workflow maps to: the repository
+// becomes the orb and the workflow file a job in it
+func circleCIOrb(config *PipelineConfig, job Job) (alias, orb, orbJob string) {
+	repo, file, ref := job.Call.remote()
+	alias = sanitizeName(strings.ToLower(filepath.Base(repo)))
+	version := "volatile"
+	if m := orbVersionPattern.FindStringSubmatch(ref); m != nil {
+		version = m[1]
+	} else {
+		config.approximated("uses", "job '%s': ref %s of %s is not an orb version; the orb is pinned to volatile", job.Name, ref, job.Call.Workflow)
+	}
+	orbJob = pipelineName(file)
+	config.note("job '%s' calls %s; publish that workflow as the orb %s with a job named %s", job.Name, job.Call.Workflow, strings.ToLower(repo), orbJob)
+	runtimeInputs(config, job, CircleCI)
+	return alias, strings.ToLower(repo) + "@" + version, orbJob
+}
+
+// circleCIJobParameters lists the parameters a CircleCI job declares: its
+// matrix variables and the pipeline inputs it references
+func circleCIJobParameters(config *PipelineConfig, job Job) []Input {
+	var params []Input
+	declared := make(map[string]bool)
+	if job.Matrix != nil {
+		for _, name := range job.Matrix.Variables() {
+			params = append(params, Input{Name: name})
+			declared[name] = true
+		}
+	}
+	used := make(map[string]bool)
+	mapJobStrings(job, func(s string) string {
+		for _, m := range parameterRefPattern.FindAllStringSubmatch(s, -1) {
+			used[m[1]] = true
+		}
+		return s
+	})
+	for _, in := range config.Inputs {
+		if used[in.Name] && !declared[in.Name] {
+			params = append(params, in)
+			if in.Default == "" {
+				config.note("job '%s': input '%s' has no default; pass it wherever the job is invoked", job.Name, in.Name)
+			}
+		}
+	}
+	sort.SliceStable(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+// circleCIParameterType maps a workflow_call input type to a CircleCI
+// parameter type
+func circleCIParameterType(in Input) string {
+	if in.Type == "boolean" {
+		return "boolean"
+	}
+	return "string"
+}
+
+type githubWorkflowCall struct {
+	Inputs  yamlMap `yaml:"inputs,omitempty"`
+	Secrets yamlMap `yaml:"secrets,omitempty"`
+	Outputs yamlMap `yaml:"outputs,omitempty"`
+}
+
+type githubInput struct {
+	Description *yaml.Node `yaml:"description,omitempty"`
+	Type        string     `yaml:"type,omitempty"`
+	Required    bool       `yaml:"required"`
+	Default     *yaml.Node `yaml:"default,omitempty"`
+}
+
+type githubOutput struct {
+	Value string `yaml:"value"`
+}
+
+// githubWorkflowCallTrigger is the workflow_call trigger of a reusable
+// GitHub workflow
+func githubWorkflowCallTrigger(config *PipelineConfig) githubWorkflowCall {
+	var call githubWorkflowCall
+	for _, section := range []struct {
+		inputs *yamlMap
+		list   []Input
+	}{{&call.Inputs, config.Inputs}, {&call.Secrets, config.Secrets}} {
+		for _, in := range section.list {
+			input := githubInput{Type: in.Type, Required: in.Required}
+			if in.Description != "" {
+				input.Description = keptScalar(in.Description, false)
+			}
+			if in.Default != "" {
+				input.Default = keptScalar(in.Default, in.Type == "string")
+			}
+			section.inputs.set(in.Name, input)
+		}
+	}
+	for _, out := range config.Outputs {
+		call.Outputs.set(out.Name, githubOutput{Value: out.Value})
+	}
+	return call
+}
+
+type githubCallJob struct {
+	Needs   []string    `yaml:"needs,omitempty"`
+	If      string      `yaml:"if,omitempty"`
+	Uses    string      `yaml:"uses"`
+	With    yamlMap     `yaml:"with,omitempty"`
+	Secrets interface{} `yaml:"secrets,omitempty"` // inherit, or the secrets passed
+}
+
+// githubCall is a job that calls a reusable workflow
+func githubCall(job Job) githubCallJob {
+	gj := githubCallJob{If: job.Condition, Uses: job.Call.Workflow}
+	for _, dep := range job.DependsOn {
+		gj.Needs = append(gj.Needs, sanitizeName(dep))
+	}
+	for _, k := range sortedKeys(job.Call.With) {
+		v := job.Call.With[k]
+		if job.Call.quoted[k] || isMultiline(v) {
+			gj.With.set(k, v)
+			continue
+		}
+		// Unquoted values keep their type, such as a number or boolean
+		gj.With.set(k, keptScalar(v, false))
+	}
+	if job.Call.InheritSecrets {
+		gj.Secrets = "inherit"
+	} else if len(job.Call.Secrets) > 0 {
+		gj.Secrets = job.Call.Secrets
+	}
+	return gj
+}
+
+type gitlabSpecDoc struct {
+	Spec struct {
+		Inputs yamlMap `yaml:"inputs"`
+	} `yaml:"spec"`
+}
+
+type gitlabInput struct {
+	Type        string     `yaml:"type,omitempty"`
+	Description *yaml.Node `yaml:"description,omitempty"`
+	Default     *yaml.Node `yaml:"default,omitempty"`
+}
+
+// gitlabSpec is the spec: header document that declares a GitLab config's
+// inputs; the config is then used through include: with inputs:
+func gitlabSpec(config *PipelineConfig) gitlabSpecDoc {
+	var doc gitlabSpecDoc
+	for _, in := range config.Inputs {
+		var gi gitlabInput
+		if gitlabInputTypes[in.Type] {
+			gi.Type = in.Type
+		}
+		if in.Description != "" {
+			gi.Description = keptScalar(in.Description, false)
+		}
+		if in.Default != "" || !in.Required {
+			gi.Default = keptScalar(in.Default, !gitlabInputTypes[in.Type])
+		}
+		doc.Spec.Inputs.set(in.Name, gi)
+	}
+	return doc
+}
+
+type gitlabTrigger struct {
+	Include  []gitlabInclude `yaml:"include"`
+	Strategy string          `yaml:"strategy"`
+}
+
+type gitlabInclude struct {
+	Project string            `yaml:"project"`
+	Ref     string            `yaml:"ref"`
+	File    string            `yaml:"file"`
+	Inputs  map[string]string `yaml:"inputs,omitempty"`
+}
+
+// gitlabCall is the trigger: of a job that runs a remote reusable workflow
+// as a child pipeline
+func gitlabCall(config *PipelineConfig, job Job) *gitlabTrigger {
+	project, file, ref := gitlabCallInclude(config, job)
+	include := gitlabInclude{Project: project, Ref: ref, File: file}
+	for k, v := range job.Call.With {
+		if include.Inputs == nil {
+			include.Inputs = make(map[string]string)
+		}
+		include.Inputs[k] = convertRunnerVariables(shellOutputRefs(v), GitLab)
+	}
+	return &gitlabTrigger{Include: []gitlabInclude{include}, Strategy: "depend"}
+}
@@ -0,0 +1,267 @@
+package converter
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var localhostPattern = regexp.MustCompile(`\b(?:localhost|127\.0\.0\.1)\b`)
+
+// serviceAlias is the host name a service gets without an explicit one: the
+// last path element of its image, without tag or digest
+func serviceAlias(image string) string {
+	name := path.Base(strings.SplitN(image, "@", 2)[0])
+	return strings.SplitN(name, ":", 2)[0]
+}
+
+// parseGitLabServices reads services: given as images or as {name, alias,
+// variables} entries. A service is reachable by its first alias.
+func parseGitLabServices(config *PipelineConfig, where string, v interface{}) []Service {
+	list, _ := v.([]interface{})
+	var services []Service
+	for _, item := range list {
+		switch s := item.(type) {
+		case string:
+			services = append(services, Service{Name: serviceAlias(s), Image: s})
+		case map[string]interface{}:
+			image := getString(s, "name")
+			if image == "" {
+				continue
+			}
+			svc := Service{Name: serviceAlias(image), Image: image, Env: gitlabVariables(s["variables"])}
+			if alias := getString(s, "alias"); alias != "" {
+				svc.Name = strings.TrimSpace(strings.Split(alias, ",")[0])
+			}
+			config.dropKeys(fmt.Sprintf("service '%s' in %s", svc.Name, where), s, keySet("name", "alias", "variables"))
+			services = append(services, svc)
+		}
+	}
+	return services
+}
+
+// azureContainerResources reads resources.containers, which container: and
+// services: refer to by name
+func azureContainerResources(config *PipelineConfig, v interface{}) map[string]Service {
+	resources := make(map[string]Service)
+	res, ok := v.(map[string]interface{})
+	if !ok {
+		return resources
+	}
+	config.dropKeys("resources", res, keySet("containers"))
+	list, _ := res["containers"].([]interface{})
+	for _, item := range list {
+		cm, ok := item.(map[string]interface{})
+		if !ok || getString(cm, "container") == "" {
+			continue
+		}
+		c := parseContainer(cm)
+		if c == nil {
+			continue
+		}
+		svc := Service{Name: getString(cm, "container"), Image: c.Image, Env: c.Env}
+		if ports, ok := cm["ports"].([]interface{}); ok {
+			for _, p := range ports {
+				svc.Ports = append(svc.Ports, fmt.Sprint(p))
+			}
+		}
+		resources[svc.Name] = svc
+	}
+	return resources
+}
+
+// azureJobServices resolves a job's services: map of host name to
+// container resource
+func azureJobServices(config *PipelineConfig, job string, v interface{}, resources map[string]Service) []Service {
+	sm, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var services []Service
+	for _, name := range sortedKeys(stringMap(sm)) {
+		res, ok := resources[fmt.Sprint(sm[name])]
+		if !ok {
+			config.dropped("services", "job '%s': service '%s' refers to container resource '%v', which is not defined", job, name, sm[name])
+			continue
+		}
+		res.Name = name
+		services = append(services, res)
+	}
+	return services
+}
+
+// publishedPorts are the ports a service publishes on the host. A job that
+// runs on the host reaches its services through them; services from
+// platforms that network by host name get the default port of their image.
+func publishedPorts(config *PipelineConfig, job Job, svc Service) []string {
+	if len(svc.Ports) > 0 || job.Container != nil {
+		return svc.Ports
+	}
+	if usesHost(job, svc.Name) {
+		config.note("job '%s' runs on the host, so service '%s' is reachable on localhost rather than by its name", job.Name, svc.Name)
+	}
+	if p, ok := servicePorts[serviceAlias(svc.Image)]; ok {
+		return []string{p + ":" + p}
+	}
+	config.note("job '%s' runs on the host and service '%s' publishes no ports; add the port it listens on", job.Name, svc.Name)
+	return nil
+}
+
+// usesLocalhost reports whether a job's commands or settings name localhost
+func usesLocalhost(job Job) bool {
+	found := false
+	mapJobStrings(job, func(s string) string {
+		found = found || localhostPattern.MatchString(s)
+		return s
+	})
+	return found
+}
+
+// usesHost reports whether a job's commands or settings connect to host
+func usesHost(job Job, host string) bool {
+	pattern := regexp.MustCompile(`(?:-h\s*|--host[=\s]|://|@)` + regexp.QuoteMeta(host) + `\b|\b` + regexp.QuoteMeta(host) + `:\d`)
+	found := false
+	mapJobStrings(job, func(s string) string {
+		found = found || pattern.MatchString(s)
+		return s
+	})
+	return found
+}
+
+func serviceNames(job Job) string {
+	var names []string
+	for _, svc := range job.Services {
+		names = append(names, sanitizeName(svc.Name))
+	}
+	return strings.Join(names, ", ")
+}
+
+type gitlabService struct {
+	Name      string            `yaml:"name"`
+	Alias     string            `yaml:"alias,omitempty"`
+	Variables map[string]string `yaml:"variables,omitempty"`
+}
+
+// gitlabServices is a job's services:. An image whose default alias
+// matches the service name is given as is.
+func gitlabServices(config *PipelineConfig, job Job) []interface{} {
+	if len(job.Services) == 0 {
+		return nil
+	}
+	if job.Container == nil && usesLocalhost(job) {
+		config.note("job '%s' reaches its services on localhost; on GitLab they are reachable by host name (%s)", job.Name, serviceNames(job))
+	}
+	var services []interface{}
+	for _, svc := range job.Services {
+		name := sanitizeName(svc.Name)
+		if name == serviceAlias(svc.Image) && len(svc.Env) == 0 {
+			services = append(services, svc.Image)
+			continue
+		}
+		gs := gitlabService{Name: svc.Image, Variables: svc.Env}
+		if name != serviceAlias(svc.Image) {
+			gs.Alias = name
+		}
+		services = append(services, gs)
+	}
+	return services
+}
+
+// circleCIServices are a job's services as secondary containers of its
+// docker executor. Those listen on localhost; jobs that ran in a container
+// reached them by name, so they keep it with name:.
+func circleCIServices(job Job) []circleCIContainer {
+	var containers []circleCIContainer
+	for _, svc := range job.Services {
+		container := circleCIContainer{Image: svc.Image, Environment: svc.Env}
+		if job.Container != nil {
+			container.Name = sanitizeName(svc.Name)
+		}
+		containers = append(containers, container)
+	}
+	return containers
+}
+
+// azureServices lays out the container resources that job services refer
+// to, one per distinct service, and returns the resource each job's
+// services use by host name
+func azureServices(config *PipelineConfig) ([]Service, map[string]map[string]string) {
+	var resources []Service
+	byKey := make(map[string]string)
+	taken := make(map[string]bool)
+	refs := make(map[string]map[string]string)
+	for _, job := range config.Jobs {
+		for _, svc := range job.Services {
+			svc.Ports = publishedPorts(config, job, svc)
+			key := fmt.Sprint(svc.Image, svc.Ports, svc.Env)
+			name, ok := byKey[key]
+			if !ok {
+				// Resource names are identifiers and unique in the pipeline
+				name = strings.ReplaceAll(sanitizeName(svc.Name), "-", "_")
+				if taken[name] {
+					name = strings.ReplaceAll(sanitizeName(job.Name+"_"+svc.Name), "-", "_")
+				}
+				taken[name] = true
+				byKey[key] = name
+				resource := svc
+				resource.Name = name
+				resources = append(resources, resource)
+			}
+			if refs[job.Name] == nil {
+				refs[job.Name] = make(map[string]string)
+			}
+			refs[job.Name][sanitizeName(svc.Name)] = name
+		}
+	}
+	return resources, refs
+}
+
+type azureResources struct {
+	Containers []azureResource `yaml:"containers"`
+}
+
+type azureResource struct {
+	Container string            `yaml:"container"`
+	Image     string            `yaml:"image"`
+	Ports     []string          `yaml:"ports,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty"`
+}
+
+// azureResourceList is resources.containers for job services
+func azureResourceList(resources []Service) *azureResources {
+	if len(resources) == 0 {
+		return nil
+	}
+	list := &azureResources{}
+	for _, r := range resources {
+		list.Containers = append(list.Containers, azureResource{Container: r.Name, Image: r.Image, Ports: r.Ports, Env: r.Env})
+	}
+	return list
+}
+
+// jenkinsServices starts a stage's services as containers on the agent
+// before its steps, and returns the containers to remove afterwards
+func jenkinsServices(config *PipelineConfig, sb *strings.Builder, job Job) []string {
+	if len(job.Services) == 0 {
+		return nil
+	}
+	config.approximated("services", "job '%s' starts services %s with docker run on the agent; they are reachable on localhost through their published ports", job.Name, serviceNames(job))
+	host := job
+	host.Container = nil
+	var containers []string
+	for _, svc := range job.Services {
+		name := sanitizeName(job.Name + "-" + svc.Name)
+		args := []string{"docker run -d --name " + name}
+		for _, k := range sortedKeys(svc.Env) {
+			args = append(args, fmt.Sprintf(`-e "%s=%s"`, k, svc.Env[k]))
+		}
+		for _, p := range publishedPorts(config, host, svc) {
+			args = append(args, "-p "+p)
+		}
+		args = append(args, svc.Image)
+		sb.WriteString("                " + jenkinsSh(strings.Join(args, " ")) + "\n")
+		containers = append(containers, name)
+	}
+	return containers
+}
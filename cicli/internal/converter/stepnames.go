@@ -0,0 +1,98 @@
+package converter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// stepNames name the steps that script commands are grouped into, by what
+// the commands do. The first matching pattern wins.
+var stepNames = []struct {
+	pattern *regexp.Regexp
+	name    string
+}{
+	{regexp.MustCompile(`^(?:sudo\s+)?(?:npm (?:ci|install|i)\b|yarn(?: install)?(?:\s+--\S+)*\s*$|pnpm (?:install|i)\b|pip3? install\b|python3? -m pip install\b|pipenv (?:install|sync)\b|poetry install\b|uv sync\b|bundle install\b|composer install\b|go mod (?:download|tidy)\b|cargo fetch\b|dotnet restore\b|mvn\S* dependency:|apt-get (?:update|install)\b|apt (?:update|install)\b|apk (?:update|add)\b|yum install\b|dnf install\b|gem install\b)`), "Install dependencies"},
+	{regexp.MustCompile(`^(?:(?:npm|pnpm|yarn) (?:run )?lint\b|npx eslint\b|eslint\b|golangci-lint\b|go vet\b|gofmt\b|flake8\b|pylint\b|ruff\b|black --check\b|mypy\b|rubocop\b|bundle exec rubocop\b|cargo (?:clippy|fmt)\b|make lint\b)`), "Lint"},
+	{regexp.MustCompile(`^(?:(?:npm|pnpm|yarn) (?:run )?test\b|npx (?:jest|vitest)\b|jest\b|vitest\b|go test\b|pytest\b|python3? -m (?:pytest|unittest)\b|tox\b|(?:\./)?(?:mvnw?|mvn) (?:\S+ )*(?:test|verify)\b|(?:\./gradlew|gradle) (?:\S+ )*(?:test|check)\b|cargo test\b|(?:bundle exec )?(?:rspec|rake test)\b|dotnet test\b|(?:vendor/bin/)?phpunit\b|make (?:test|check)\b)`), "Run tests"},
+	{regexp.MustCompile(`^(?:(?:npm|pnpm|yarn) (?:run )?build\b|go build\b|(?:\./)?(?:mvnw?|mvn) (?:\S+ )*(?:package|install)\b|(?:\./gradlew|gradle) (?:\S+ )*(?:build|assemble)\b|cargo build\b|dotnet (?:build|publish)\b|python3? -m build\b|make(?: build| all)?\s*$)`), "Build"},
+	{regexp.MustCompile(`^(?:docker (?:build|push|tag|login)\b|docker buildx\b)`), "Build image"},
+	{regexp.MustCompile(`^(?:kubectl (?:apply|rollout|set)\b|helm (?:upgrade|install)\b|terraform apply\b|serverless deploy\b|sls deploy\b|firebase deploy\b|vercel\b|netlify deploy\b|aws (?:s3 sync|ecs update-service)\b|\S*deploy\S*(?:\s|$))`), "Deploy"},
+}
+
+// stepName returns the name of what a command does, or "" if no pattern
+// recognises it
+func stepName(command string) string {
+	command = strings.TrimSpace(command)
+	for _, s := range stepNames {
+		if s.pattern.MatchString(command) {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// shellStatePattern matches commands that change the shell later commands
+// run in, which separate steps would not share
+var shellStatePattern = regexp.MustCompile(`^(?:cd|pushd|popd|export|source|\.|set|alias|eval|nvm use|conda activate)\s|^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// groupCommands turns a script into named steps. Consecutive commands that do
+// the same thing share a step; commands no pattern recognises stay with the
+// step they come before. A script that changes its shell, with cd or export
+// for example, stays in one step named after everything it does. comments are
+// the commands' comments, matching them by index.
+func groupCommands(commands, comments []string) []Step {
+	for i, cmd := range commands {
+		if i < len(commands)-1 && shellStatePattern.MatchString(strings.TrimSpace(cmd)) {
+			var names []string
+			for _, c := range commands {
+				if name := stepName(c); name != "" && !containsString(names, name) {
+					names = append(names, name)
+				}
+			}
+			step := Step{Run: strings.Join(commands, "\n"), Comment: joinComments(comments...)}
+			if len(names) > 0 {
+				step.Name = names[0]
+				for _, name := range names[1:] {
+					step.Name += ", " + strings.ToLower(name[:1]) + name[1:]
+				}
+			}
+			return []Step{step}
+		}
+	}
+
+	var steps []Step
+	var pending []string // unrecognised commands waiting for a step
+	var pendingComments []string
+	for i, cmd := range commands {
+		var comment string
+		if i < len(comments) {
+			comment = comments[i]
+		}
+		name := stepName(cmd)
+		if name == "" {
+			pending = append(pending, cmd)
+			pendingComments = append(pendingComments, comment)
+			continue
+		}
+		if n := len(steps); n > 0 && steps[n-1].Name == name {
+			last := &steps[n-1]
+			last.Run = strings.Join(append(append([]string{last.Run}, pending...), cmd), "\n")
+			last.Comment = joinComments(append(append([]string{last.Comment}, pendingComments...), comment)...)
+		} else {
+			steps = append(steps, Step{
+				Name:    name,
+				Run:     strings.Join(append(pending, cmd), "\n"),
+				Comment: joinComments(append(pendingComments, comment)...),
+			})
+		}
+		pending, pendingComments = nil, nil
+	}
+	if len(pending) > 0 {
+		// Trailing commands no pattern names stay in a step of their own
+		steps = append(steps, Step{
+			Run:     strings.Join(pending, "\n"),
+			Comment: joinComments(pendingComments...),
+		})
+	}
+	return steps
+}
@@ -0,0 +1,1508 @@
+package converter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// TeamCity keeps versioned settings in .teamcity/, either as a Kotlin DSL
+// project (settings.kts) or as XML: a project-config.xml and one file per
+// build configuration under buildTypes/. Both are read into tcBuildType and
+// converted the same way; each build configuration becomes a job. TeamCity
+// is a conversion source only.
+
+// tcBuildType is one build configuration
+type tcBuildType struct {
+	id, name      string
+	kind          string // REGULAR, DEPLOYMENT or COMPOSITE
+	params        []tcParam
+	steps         []tcStep
+	triggers      []tcTrigger
+	snapshots     []tcDependency
+	artifactDeps  []tcDependency
+	artifactRules string
+	requirements  bool
+	features      []string
+	unsupported   []string
+}
+
+type tcParam struct {
+	name, value string
+	secret      bool // password parameter
+	prompt      bool // text, select or checkbox parameter shown when a build is started
+}
+
+// tcStep is a build step. Runner and params use the Kotlin DSL names, e.g.
+// script with scriptContent; the XML reader translates its runner types.
+type tcStep struct {
+	name    string
+	runner  string
+	image   string
+	workDir string
+	mode    string // always or failure; empty runs the step while the build succeeds
+	params  map[string]string
+}
+
+type tcTrigger struct {
+	kind   string // vcs, schedule, finishBuildTrigger, …
+	params map[string]string
+}
+
+type tcDependency struct {
+	source    string // build configuration id
+	rules     string // artifact rules of an artifact dependency
+	onFailure string // FAIL_TO_START, IGNORE, ADD_PROBLEM, …
+}
+
+var (
+	teamCityReference = regexp.MustCompile(`%%|%([A-Za-z0-9_.\-]+)%`)
+	teamCityNameChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// teamCityPredefined maps TeamCity's predefined parameters to GitHub runner
+// variables
+var teamCityPredefined = map[string]string{
+	"build.number":                        "GITHUB_RUN_NUMBER",
+	"build.vcs.number":                    "GITHUB_SHA",
+	"teamcity.build.id":                   "GITHUB_RUN_ID",
+	"teamcity.build.branch":               "GITHUB_REF_NAME",
+	"vcsroot.branch":                      "GITHUB_REF_NAME",
+	"teamcity.build.checkoutDir":          "GITHUB_WORKSPACE",
+	"teamcity.build.workingDir":           "GITHUB_WORKSPACE",
+	"teamcity.build.tempDir":              "RUNNER_TEMP",
+	"teamcity.build.triggeredBy.username": "GITHUB_ACTOR",
+	"system.teamcity.buildType.id":        "GITHUB_JOB",
+}
+
+type teamCityParser struct {
+	config *PipelineConfig
+	names  map[string]string   // build configuration id → job name
+	params map[string]tcParam  // parameters by name, for references in env values
+	needs  map[string][]string // job → jobs a build chain runs before it
+}
+
+// parseTeamCity reads a Kotlin DSL settings.kts, a project-config.xml with
+// the build configurations next to it, or a single build configuration XML
+func (c *Converter) parseTeamCity(content []byte, inputPath string) (*PipelineConfig, error) {
+	config := &PipelineConfig{Name: "Pipeline", Jobs: []Job{}}
+	p := &teamCityParser{config: config, names: map[string]string{}, params: map[string]tcParam{}, needs: map[string][]string{}}
+
+	var buildTypes []tcBuildType
+	var projectParams []tcParam
+	var chains []ktNode
+	if strings.HasSuffix(inputPath, ".kts") {
+		buildTypes, projectParams, chains = teamCityKotlin(config, parseKotlinDSL(string(content)))
+	} else {
+		var err error
+		buildTypes, projectParams, err = teamCityXML(config, content, inputPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(buildTypes) == 0 {
+		return nil, fmt.Errorf("no build configurations found")
+	}
+
+	for _, bt := range buildTypes {
+		name := bt.name
+		if name == "" {
+			name = bt.id
+		}
+		name = strings.Trim(nonNameChars.ReplaceAllString(sanitizeName(name), "-"), "-")
+		if name == "" {
+			name = fmt.Sprintf("build-%d", len(p.names)+1)
+		}
+		base := name
+		for i := 2; p.taken(name); i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		p.names[bt.id] = name
+	}
+	for _, param := range projectParams {
+		p.params[param.name] = param
+	}
+	config.Environment = p.env("project", projectParams)
+
+	var triggers []Trigger
+	var triggered []string
+	for _, bt := range buildTypes {
+		job, jobTriggers := p.buildType(bt)
+		config.Jobs = append(config.Jobs, job)
+		if len(jobTriggers) > 0 {
+			triggered = append(triggered, job.Name)
+		}
+		triggers = append(triggers, jobTriggers...)
+	}
+	for _, chain := range chains {
+		p.sequence(chain.body, nil, false)
+	}
+	for i, job := range config.Jobs {
+		for _, need := range p.needs[job.Name] {
+			if !containsString(job.DependsOn, need) {
+				config.Jobs[i].DependsOn = append(config.Jobs[i].DependsOn, need)
+			}
+		}
+	}
+
+	config.Triggers = teamCityTriggers(triggers)
+	switch {
+	case len(config.Triggers) == 0:
+		config.Triggers = []Trigger{{Type: "manual"}}
+		config.note("no build configuration has triggers; the pipeline is started by hand")
+	case len(triggered) > 1:
+		config.approximated("triggers", "build configurations %s have triggers of their own; every job now runs on all of them", strings.Join(triggered, ", "))
+	}
+	return config, nil
+}
+
+func (p *teamCityParser) taken(name string) bool {
+	for _, n := range p.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// buildType converts a build configuration and returns its triggers
+func (p *teamCityParser) buildType(bt tcBuildType) (Job, []Trigger) {
+	name := p.names[bt.id]
+	where := fmt.Sprintf("build configuration '%s'", name)
+	job := Job{Name: name, RunsOn: "ubuntu-latest", Steps: []Step{}}
+	for _, u := range bt.unsupported {
+		p.config.dropped(u, "%s: '%s' is not converted", where, u)
+	}
+	if bt.requirements {
+		p.config.note("%s has agent requirements; pick a runner with matching labels", where)
+	}
+
+	for _, param := range bt.params {
+		p.params[param.name] = param
+	}
+	job.Environment = p.env(where, bt.params)
+
+	var triggers []Trigger
+	for _, f := range bt.features {
+		switch f {
+		case "pullRequests":
+			triggers = append(triggers, Trigger{Type: "pull_request"})
+		case "commitStatusPublisher":
+			p.config.note("%s publishes commit statuses; GitHub reports them for workflow runs itself", where)
+		default:
+			p.config.dropped(f, "%s: build feature '%s' is not converted", where, f)
+		}
+	}
+	for _, t := range bt.triggers {
+		if trigger, ok := p.trigger(where, t); ok {
+			triggers = append(triggers, trigger)
+		}
+	}
+
+	for _, dep := range bt.snapshots {
+		source, ok := p.dependency(where, dep.source)
+		if !ok {
+			continue
+		}
+		job.DependsOn = append(job.DependsOn, source)
+		switch dep.onFailure {
+		case "", "FAIL_TO_START", "CANCEL":
+		default:
+			job.Condition = "always()"
+		}
+	}
+	for _, dep := range bt.artifactDeps {
+		source, ok := p.dependency(where, dep.source)
+		if !ok {
+			continue
+		}
+		if !containsString(job.DependsOn, source) {
+			job.DependsOn = append(job.DependsOn, source)
+		}
+		for _, rule := range teamCityRules(dep.rules) {
+			if rule.exclude {
+				continue
+			}
+			download := Step{Uses: downloadArtifact, With: map[string]string{"name": source, "path": "."}}
+			if rule.target != "" {
+				download.With["path"] = rule.target
+			}
+			if strings.HasSuffix(rule.source, ".zip") || strings.Contains(rule.source, "!") {
+				p.config.approximated("artifacts", "%s unpacks an archive from '%s'; the converted step downloads the files as uploaded", where, source)
+			}
+			job.Steps = append(job.Steps, download)
+			break
+		}
+	}
+
+	switch bt.kind {
+	case "DEPLOYMENT":
+		job.Gate = &Gate{Environment: name}
+		p.config.approximated("type", "%s is a deployment configuration; it now deploys to environment '%s', where approvals can be required", where, name)
+	case "COMPOSITE":
+		p.config.note("%s is a composite build; the job only waits for its dependencies", where)
+		job.Steps = append(job.Steps, Step{Name: "Composite", Run: `echo "Dependencies finished"`})
+	}
+
+	image := ""
+	for i, st := range bt.steps {
+		if i == 0 {
+			image = st.image
+		}
+		if st.image != image {
+			image = ""
+			break
+		}
+	}
+	if image != "" {
+		job.Container = &Container{Image: p.text(image)}
+	}
+	for _, st := range bt.steps {
+		job.Steps = append(job.Steps, p.step(where, st, job.Container))
+	}
+
+	var uploads []string
+	for _, rule := range teamCityRules(bt.artifactRules) {
+		if rule.exclude {
+			p.config.approximated("artifactRules", "%s excludes '%s' from its artifacts; every matching file is now uploaded", where, rule.source)
+			continue
+		}
+		if rule.target != "" && strings.Contains(path.Base(rule.target), ".") {
+			p.config.approximated("artifactRules", "%s packs '%s' into %s; the files are uploaded as they are", where, rule.source, rule.target)
+		}
+		uploads = append(uploads, p.text(rule.source))
+	}
+	if len(uploads) > 0 {
+		job.Artifacts = []Artifact{{Name: name, Paths: uploads}}
+	}
+	return job, triggers
+}
+
+// dependency resolves the build configuration a dependency points at
+func (p *teamCityParser) dependency(where, id string) (string, bool) {
+	if name, ok := p.names[id]; ok {
+		return name, true
+	}
+	p.config.dropped("dependencies", "%s depends on build configuration '%s', which is not part of this project; convert it too and connect the pipelines", where, id)
+	return "", false
+}
+
+// step converts a build step; steps in a container other than the job's
+// run through sh -c
+func (p *teamCityParser) step(where string, st tcStep, container *Container) Step {
+	run, ok := teamCityCommand(st)
+	if !ok {
+		p.config.dropped("runner", "%s: %s step is not converted", where, st.runner)
+		run = fmt.Sprintf(`echo "Runner %s (manual conversion needed)" && exit 1`, st.runner)
+	}
+	if st.params["conditions"] != "" {
+		p.config.dropped("conditions", "%s: %s step only runs under execution conditions; it now always runs", where, st.runner)
+	}
+	step := Step{Name: st.name, Run: strings.TrimRight(p.text(run), "\n"), WorkDir: p.text(st.workDir)}
+	switch st.mode {
+	case "always":
+		step.If = "always()"
+	case "failure":
+		step.If = "failure()"
+	}
+	if st.image != "" && container == nil {
+		script := step.Run
+		if step.WorkDir != "" {
+			script = "cd " + step.WorkDir + " && " + script
+			step.WorkDir = ""
+		}
+		step.Image = p.text(st.image)
+		step.Run = "sh -c '" + strings.ReplaceAll(script, "'", `'"'"'`) + "'"
+	}
+	return step
+}
+
+// teamCityCommand is the shell command of a runner's step
+func teamCityCommand(st tcStep) (string, bool) {
+	in := st.params
+	join := func(parts ...string) string {
+		var out []string
+		for _, s := range parts {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		return strings.Join(out, " ")
+	}
+	switch st.runner {
+	case "script":
+		return in["scriptContent"], in["scriptContent"] != ""
+	case "exec":
+		return join(in["path"], in["arguments"]), in["path"] != ""
+	case "gradle":
+		cmd := "gradle"
+		if in["useGradleWrapper"] != "false" {
+			cmd = "./" + path.Join(in["gradleWrapperPath"], "gradlew")
+		}
+		file := ""
+		if in["buildFile"] != "" {
+			file = "-b " + in["buildFile"]
+		}
+		return join(cmd, file, in["tasks"], in["gradleParams"]), true
+	case "maven":
+		pom := ""
+		if in["pomLocation"] != "" {
+			pom = "-f " + in["pomLocation"]
+		}
+		return join("mvn", pom, in["goals"], in["runnerArgs"]), in["goals"] != ""
+	case "nodeJS":
+		return in["shellScript"], in["shellScript"] != ""
+	case "dockerCommand":
+		tags := strings.Fields(strings.ReplaceAll(in["namesAndTags"], ",", " "))
+		switch in["type"] {
+		case "build":
+			args := []string{"docker build"}
+			if in["path"] != "" {
+				args = append(args, "-f "+in["path"])
+			}
+			for _, tag := range tags {
+				args = append(args, "-t "+tag)
+			}
+			context := in["contextDir"]
+			if context == "" {
+				context = "."
+			}
+			return join(append(args, in["commandArgs"], context)...), true
+		case "push":
+			var lines []string
+			for _, tag := range tags {
+				lines = append(lines, join("docker push", in["commandArgs"], tag))
+			}
+			return strings.Join(lines, "\n"), len(lines) > 0
+		}
+	}
+	return "", false
+}
+
+// env turns parameters into environment variables; parameters other than
+// env.* ones become upper-case variables so scripts can read them
+func (p *teamCityParser) env(where string, params []tcParam) map[string]string {
+	env := make(map[string]string)
+	for _, param := range params {
+		if strings.HasPrefix(param.name, "system.") {
+			p.config.dropped("params", "%s: system property '%s' is not converted; pass it to the build tool with -D", where, strings.TrimPrefix(param.name, "system."))
+			continue
+		}
+		name := teamCityEnvName(param.name)
+		switch {
+		case param.secret:
+			env[name] = fmt.Sprintf("${{ secrets.%s }}", name)
+			continue
+		case param.prompt:
+			p.config.dropped("params", "%s: parameter '%s' is asked for when a build is started; add it as a workflow_dispatch input", where, param.name)
+		}
+		env[name] = p.value(param.value, 0)
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	return env
+}
+
+// value resolves parameter references in an environment value, which no
+// shell expands: other parameters are inlined
+func (p *teamCityParser) value(s string, depth int) string {
+	return teamCityReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "%%" {
+			return "%"
+		}
+		name := ref[1 : len(ref)-1]
+		if param, ok := p.params[name]; ok && !param.secret && depth < 5 {
+			return p.value(param.value, depth+1)
+		}
+		return p.reference(name)
+	})
+}
+
+// text rewrites parameter references in a command to shell variables
+func (p *teamCityParser) text(s string) string {
+	return teamCityReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "%%" {
+			return "%"
+		}
+		return p.reference(ref[1 : len(ref)-1])
+	})
+}
+
+func (p *teamCityParser) reference(name string) string {
+	if v, ok := teamCityPredefined[name]; ok {
+		return "${" + v + "}"
+	}
+	if strings.HasPrefix(name, "build.vcs.number.") {
+		return "${GITHUB_SHA}"
+	}
+	if strings.HasPrefix(name, "dep.") {
+		p.config.dropped("dep", "parameter '%s' of a dependency is not available; pass it as a job output", name)
+		return "%" + name + "%"
+	}
+	if strings.HasPrefix(name, "teamcity.") || strings.HasPrefix(name, "system.") {
+		p.config.note("parameter '%s' has no GitHub equivalent; review the converted command", name)
+		return "%" + name + "%"
+	}
+	return "${" + teamCityEnvName(name) + "}"
+}
+
+func teamCityEnvName(name string) string {
+	if strings.HasPrefix(name, "env.") {
+		return strings.TrimPrefix(name, "env.")
+	}
+	return strings.ToUpper(strings.Trim(teamCityNameChars.ReplaceAllString(name, "_"), "_"))
+}
+
+// trigger converts a vcs or schedule trigger
+func (p *teamCityParser) trigger(where string, t tcTrigger) (Trigger, bool) {
+	switch t.kind {
+	case "vcs":
+		trigger := Trigger{Type: "push"}
+		for _, rule := range teamCityFilter(t.params["branchFilter"]) {
+			switch {
+			case rule.exclude:
+				p.config.approximated("branchFilter", "%s excludes branch '%s'; the trigger now includes it", where, rule.source)
+			case rule.source == "*":
+				trigger.Branches = nil
+				return p.paths(where, trigger, t), true
+			case rule.source == "<default>":
+				p.config.approximated("branchFilter", "%s triggers on the default branch, assumed to be main", where)
+				trigger.Branches = append(trigger.Branches, "main")
+			default:
+				trigger.Branches = append(trigger.Branches, rule.source)
+			}
+		}
+		return p.paths(where, trigger, t), true
+	case "schedule":
+		minute, hour := firstNonEmpty(t.params["minute"], "0"), firstNonEmpty(t.params["hour"], "0")
+		cron := ""
+		switch t.params["schedulingPolicy"] {
+		case "daily", "":
+			cron = fmt.Sprintf("%s %s * * *", minute, hour)
+		case "weekly":
+			day := strings.ToLower(t.params["dayOfWeek"])
+			if len(day) > 3 {
+				day = day[:3]
+			}
+			cron = fmt.Sprintf("%s %s * * %s", minute, hour, firstNonEmpty(day, "sun"))
+		case "cron":
+			var fields []string
+			for _, key := range []string{"minutes", "hours", "dayOfMonth", "month", "dayOfWeek"} {
+				field := firstNonEmpty(t.params[key], "*")
+				if field == "?" {
+					field = "*"
+				}
+				fields = append(fields, field)
+			}
+			cron = strings.Join(fields, " ")
+		default:
+			p.config.dropped("schedule", "%s: '%s' schedule is not converted", where, t.params["schedulingPolicy"])
+			return Trigger{}, false
+		}
+		p.config.approximated("schedule", "%s runs on schedule '%s' in UTC; check it against the TeamCity server's time zone", where, cron)
+		return Trigger{Type: "schedule", Cron: cron}, true
+	case "finishBuildTrigger":
+		p.config.dropped("finishBuildTrigger", "%s starts when build configuration '%s' finishes; it now runs with the pipeline's triggers", where, t.params["buildType"])
+	default:
+		p.config.dropped(t.kind, "%s: '%s' trigger is not converted", where, t.kind)
+	}
+	return Trigger{}, false
+}
+
+// paths adds a vcs trigger's rules on changed files
+func (p *teamCityParser) paths(where string, trigger Trigger, t tcTrigger) Trigger {
+	for _, rule := range teamCityFilter(t.params["triggerRules"]) {
+		source := rule.source
+		if strings.Contains(source, ":") {
+			p.config.dropped("triggerRules", "%s: trigger rule '%s' is not converted", where, source)
+			continue
+		}
+		if rule.exclude {
+			source = "!" + source
+		}
+		trigger.Paths = append(trigger.Paths, source)
+	}
+	return trigger
+}
+
+// sequence adds the dependencies of a build chain: sequential blocks run
+// in order, parallel ones side by side. It returns the last build
+// configurations of the chain.
+func (p *teamCityParser) sequence(nodes []ktNode, after []string, parallel bool) []string {
+	var last []string
+	for _, n := range nodes {
+		var out []string
+		switch n.name {
+		case "buildType":
+			if len(n.args) == 0 {
+				continue
+			}
+			name, ok := p.names[teamCityRef(n.args[0])]
+			if !ok {
+				continue
+			}
+			for _, a := range after {
+				if !containsString(p.needs[name], a) {
+					p.needs[name] = append(p.needs[name], a)
+				}
+			}
+			out = []string{name}
+		case "sequential":
+			out = p.sequence(n.body, after, false)
+		case "parallel":
+			out = p.sequence(n.body, after, true)
+		default:
+			continue
+		}
+		if parallel {
+			last = append(last, out...)
+		} else if len(out) > 0 {
+			after, last = out, out
+		}
+	}
+	return last
+}
+
+// teamCityTriggers merges the triggers of all build configurations
+func teamCityTriggers(triggers []Trigger) []Trigger {
+	var out []Trigger
+	push := -1
+	for _, t := range triggers {
+		switch {
+		case t.Type == "push" && push >= 0:
+			merged := &out[push]
+			if len(merged.Branches) == 0 || len(t.Branches) == 0 {
+				merged.Branches = nil
+			} else {
+				merged.Branches = appendMissing(merged.Branches, t.Branches...)
+			}
+			if len(merged.Paths) == 0 || len(t.Paths) == 0 {
+				merged.Paths = nil
+			} else {
+				merged.Paths = appendMissing(merged.Paths, t.Paths...)
+			}
+		case t.Type == "push":
+			push = len(out)
+			out = append(out, t)
+		default:
+			seen := false
+			for _, o := range out {
+				if o.Type == t.Type && o.Cron == t.Cron {
+					seen = true
+				}
+			}
+			if !seen {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		if !containsString(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// tcRule is one line of artifact rules (source => target) or of a filter
+// (+:value, -:value)
+type tcRule struct {
+	source, target string
+	exclude        bool
+}
+
+func teamCityFilter(s string) []tcRule {
+	var rules []tcRule
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		rule := tcRule{source: line}
+		switch {
+		case strings.HasPrefix(line, "+:"):
+			rule.source = strings.TrimSpace(line[2:])
+		case strings.HasPrefix(line, "-:"):
+			rule.source, rule.exclude = strings.TrimSpace(line[2:]), true
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func teamCityRules(s string) []tcRule {
+	var rules []tcRule
+	for _, r := range teamCityFilter(strings.ReplaceAll(s, ",", "\n")) {
+		if i := strings.Index(r.source, "=>"); i >= 0 {
+			r.source, r.target = strings.TrimSpace(r.source[:i]), strings.TrimSpace(r.source[i+2:])
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// teamCityRef is the build configuration id a DSL reference names:
+// Build, RelativeId("Build") or AbsoluteId("Project_Build")
+func teamCityRef(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if i := strings.Index(arg, "("); i >= 0 && strings.HasSuffix(arg, ")") {
+		return ktString(arg[i+1 : len(arg)-1])
+	}
+	return strings.TrimSuffix(arg, ".id")
+}
+
+// teamCityKotlin reads the build configurations, project parameters and
+// build chains of a Kotlin DSL project
+func teamCityKotlin(config *PipelineConfig, nodes []ktNode) ([]tcBuildType, []tcParam, []ktNode) {
+	var buildTypes []tcBuildType
+	var params []tcParam
+	var chains []ktNode
+	var project func(body []ktNode)
+	project = func(body []ktNode) {
+		for _, n := range body {
+			switch {
+			case n.name == "buildType" && n.block && len(n.args) == 0:
+				buildTypes = append(buildTypes, teamCityKotlinBuildType(config, "", n.body))
+			case n.name == "params":
+				params = append(params, teamCityKotlinParams(n.body)...)
+			case n.name == "sequential":
+				chains = append(chains, n)
+			case n.assign && strings.HasPrefix(n.value, "sequential"):
+				chains = append(chains, parseKotlinDSL(n.value)...)
+			case n.name == "subProject" && n.block:
+				project(n.body)
+			case n.name == "vcsRoot", n.name == "template", n.name == "features", n.name == "cleanup":
+				config.dropped(n.name, "project '%s' settings are not converted", n.name)
+			}
+		}
+	}
+	for _, n := range nodes {
+		switch {
+		case n.name == "object" && n.value == "BuildType":
+			buildTypes = append(buildTypes, teamCityKotlinBuildType(config, n.args[0], n.body))
+		case n.name == "object" && n.value == "Project", n.name == "project" && n.block:
+			project(n.body)
+		}
+	}
+	return buildTypes, params, chains
+}
+
+func teamCityKotlinBuildType(config *PipelineConfig, id string, body []ktNode) tcBuildType {
+	bt := tcBuildType{id: id, kind: "REGULAR"}
+	for _, n := range body {
+		switch n.name {
+		case "id":
+			if len(n.args) > 0 {
+				bt.id = ktString(n.args[0])
+			} else if n.assign {
+				bt.id = ktString(n.value)
+			}
+		case "name":
+			bt.name = ktString(n.value)
+		case "type":
+			bt.kind = n.value[strings.LastIndex(n.value, ".")+1:]
+		case "artifactRules":
+			bt.artifactRules = ktString(n.value)
+		case "params":
+			bt.params = append(bt.params, teamCityKotlinParams(n.body)...)
+		case "steps":
+			for _, s := range n.body {
+				bt.steps = append(bt.steps, teamCityKotlinStep(s))
+			}
+		case "triggers":
+			for _, t := range n.body {
+				bt.triggers = append(bt.triggers, teamCityKotlinTrigger(t))
+			}
+		case "dependencies":
+			for _, d := range n.body {
+				if len(d.args) == 0 {
+					continue
+				}
+				dep := tcDependency{source: teamCityRef(d.args[0])}
+				switch d.name {
+				case "snapshot":
+					dep.onFailure = teamCityEnum(ktValue(d.body, "onDependencyFailure"))
+					bt.snapshots = append(bt.snapshots, dep)
+				case "artifacts":
+					dep.rules = ktValue(d.body, "artifactRules")
+					bt.artifactDeps = append(bt.artifactDeps, dep)
+				case "dependency":
+					for _, kind := range d.body {
+						switch kind.name {
+						case "snapshot":
+							bt.snapshots = append(bt.snapshots, tcDependency{source: dep.source, onFailure: teamCityEnum(ktValue(kind.body, "onDependencyFailure"))})
+						case "artifacts":
+							bt.artifactDeps = append(bt.artifactDeps, tcDependency{source: dep.source, rules: ktValue(kind.body, "artifactRules")})
+						}
+					}
+				}
+			}
+		case "requirements":
+			bt.requirements = len(n.body) > 0
+		case "features":
+			for _, f := range n.body {
+				bt.features = append(bt.features, f.name)
+			}
+		case "description", "vcs", "uuid", "paused", "enablePersonalBuilds", "allowExternalStatus", "publishArtifacts":
+		default:
+			bt.unsupported = append(bt.unsupported, n.name)
+		}
+	}
+	if bt.id == "" {
+		bt.id = bt.name
+	}
+	return bt
+}
+
+func teamCityKotlinParams(nodes []ktNode) []tcParam {
+	var params []tcParam
+	for _, n := range nodes {
+		if len(n.args) == 0 {
+			continue
+		}
+		param := tcParam{name: ktString(n.args[0])}
+		if len(n.args) > 1 && !strings.Contains(n.args[1], "=") {
+			param.value = ktString(n.args[1])
+		}
+		for _, arg := range n.args[1:] {
+			if k, v, ok := strings.Cut(arg, "="); ok && strings.TrimSpace(k) == "value" {
+				param.value = ktString(v)
+			}
+		}
+		switch n.name {
+		case "param":
+		case "password":
+			param.secret = true
+		case "text", "select", "checkbox":
+			param.prompt = true
+		default:
+			continue
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// teamCityKotlinStep reads a runner block such as script { } or gradle { }
+func teamCityKotlinStep(n ktNode) tcStep {
+	st := tcStep{name: ktValue(n.body, "name"), runner: n.name, params: map[string]string{}}
+	for _, c := range n.body {
+		switch {
+		case c.name == "conditions":
+			st.params["conditions"] = "true"
+		case !c.assign:
+		case c.name == "workingDir":
+			st.workDir = ktString(c.value)
+		case c.name == "dockerImage":
+			st.image = ktString(c.value)
+		case c.name == "executionMode":
+			st.mode = teamCityStepMode(teamCityEnum(c.value))
+		case c.name == "commandType":
+			// build { source = file { path = "Dockerfile" } namesAndTags = "…" }
+			for _, command := range parseKotlinDSL(c.value) {
+				st.params["type"] = command.name
+				for _, opt := range command.body {
+					if opt.name == "source" {
+						for _, source := range parseKotlinDSL(opt.value) {
+							st.params["path"] = ktValue(source.body, "path")
+						}
+					} else if opt.assign {
+						st.params[opt.name] = ktString(opt.value)
+					}
+				}
+			}
+		default:
+			st.params[c.name] = ktString(c.value)
+		}
+	}
+	return st
+}
+
+func teamCityKotlinTrigger(n ktNode) tcTrigger {
+	t := tcTrigger{kind: n.name, params: map[string]string{}}
+	for _, c := range n.body {
+		if !c.assign {
+			continue
+		}
+		if c.name != "schedulingPolicy" {
+			t.params[c.name] = ktString(c.value)
+			continue
+		}
+		// daily { hour = 3 }, weekly { dayOfWeek = … }, cron { hours = "3" }
+		for _, policy := range parseKotlinDSL(c.value) {
+			t.params["schedulingPolicy"] = policy.name
+			for _, opt := range policy.body {
+				if opt.assign {
+					t.params[opt.name] = teamCityEnum(ktString(opt.value))
+				}
+			}
+		}
+	}
+	if n.name == "finishBuildTrigger" {
+		t.params["buildType"] = strings.Trim(strings.TrimSuffix(strings.TrimPrefix(t.params["buildType"], "${"), ".id}"), "\"")
+	}
+	return t
+}
+
+// teamCityEnum is the last part of an enum value, e.g. ALWAYS for
+// BuildStep.ExecutionMode.ALWAYS
+func teamCityEnum(s string) string {
+	return s[strings.LastIndex(s, ".")+1:]
+}
+
+func teamCityStepMode(mode string) string {
+	switch mode {
+	case "ALWAYS", "execute_always":
+		return "always"
+	case "RUN_ON_FAILURE", "execute_if_failed":
+		return "failure"
+	}
+	return ""
+}
+
+// The XML settings format
+
+type tcXMLParam struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+	Text  string `xml:",chardata"`
+	Spec  string `xml:"spec,attr"`
+}
+
+type tcXMLProject struct {
+	Name   string       `xml:"name"`
+	Params []tcXMLParam `xml:"parameters>param"`
+}
+
+type tcXMLBuildType struct {
+	XMLName  xml.Name `xml:"build-type"`
+	Name     string   `xml:"name"`
+	Settings struct {
+		Ref     string       `xml:"ref,attr"`
+		Options []tcXMLParam `xml:"options>option"`
+		Params  []tcXMLParam `xml:"parameters>param"`
+		Runners []struct {
+			Name   string       `xml:"name,attr"`
+			Type   string       `xml:"type,attr"`
+			Params []tcXMLParam `xml:"parameters>param"`
+		} `xml:"build-runners>runner"`
+		Triggers []struct {
+			Type   string       `xml:"type,attr"`
+			Params []tcXMLParam `xml:"parameters>param"`
+		} `xml:"build-triggers>build-trigger"`
+		Features []struct {
+			Type string `xml:"type,attr"`
+		} `xml:"build-extensions>extension"`
+		Snapshots []struct {
+			Source  string       `xml:"sourceBuildTypeId,attr"`
+			Options []tcXMLParam `xml:"options>option"`
+		} `xml:"dependencies>depend-on"`
+		ArtifactDeps []struct {
+			Source    string `xml:"sourceBuildTypeId,attr"`
+			Artifacts []struct {
+				SourcePath string `xml:"sourcePath,attr"`
+			} `xml:"artifact"`
+		} `xml:"artifact-dependencies>dependency"`
+		Requirements struct {
+			Inner string `xml:",innerxml"`
+		} `xml:"requirements"`
+	} `xml:"settings"`
+}
+
+func (p tcXMLParam) value() string {
+	if p.Value != "" {
+		return p.Value
+	}
+	return strings.TrimSpace(p.Text)
+}
+
+func tcXMLParams(params []tcXMLParam) map[string]string {
+	m := make(map[string]string)
+	for _, p := range params {
+		m[p.Name] = p.value()
+	}
+	return m
+}
+
+func tcXMLParamList(params []tcXMLParam) []tcParam {
+	var out []tcParam
+	for _, p := range params {
+		param := tcParam{name: p.Name, value: p.value()}
+		switch strings.Fields(p.Spec + " x")[0] {
+		case "password":
+			param.secret = true
+		case "text", "select", "checkbox":
+			param.prompt = true
+		}
+		out = append(out, param)
+	}
+	return out
+}
+
+// teamCityXML reads a project-config.xml with every build configuration in
+// its buildTypes/ directory, or a single build configuration
+func teamCityXML(config *PipelineConfig, content []byte, inputPath string) ([]tcBuildType, []tcParam, error) {
+	if filepath.Base(inputPath) != "project-config.xml" {
+		bt, err := teamCityXMLBuildType(config, content, inputPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []tcBuildType{bt}, nil, nil
+	}
+
+	var project tcXMLProject
+	if err := xml.Unmarshal(content, &project); err != nil {
+		return nil, nil, err
+	}
+	if project.Name != "" {
+		config.Name = project.Name
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(inputPath), "buildTypes", "*.xml"))
+	var buildTypes []tcBuildType
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		bt, err := teamCityXMLBuildType(config, data, file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		buildTypes = append(buildTypes, bt)
+	}
+	return buildTypes, tcXMLParamList(project.Params), nil
+}
+
+// tcXMLRunners maps XML runner types to DSL runners and their parameters
+var tcXMLRunners = map[string]struct {
+	runner string
+	params map[string]string
+}{
+	"simpleRunner": {"script", map[string]string{"script.content": "scriptContent", "command.executable": "path", "command.parameters": "arguments"}},
+	"gradle-runner": {"gradle", map[string]string{
+		"ui.gradleRunner.gradle.tasks.names":           "tasks",
+		"ui.gradleRunner.additional.gradle.cmd.params": "gradleParams",
+		"ui.gradleRunner.gradle.build.file":            "buildFile",
+		"ui.gradleRunner.gradle.wrapper.useWrapper":    "useGradleWrapper",
+		"ui.gradleRunner.gradle.wrapper.path":          "gradleWrapperPath",
+	}},
+	"Maven2":        {"maven", map[string]string{"goals": "goals", "pomLocation": "pomLocation", "runnerArgs": "runnerArgs"}},
+	"nodejs-runner": {"nodeJS", map[string]string{"shellScript": "shellScript"}},
+	"DockerCommand": {"dockerCommand", map[string]string{
+		"docker.command.type":       "type",
+		"dockerfile.path":           "path",
+		"dockerfile.contextDir":     "contextDir",
+		"docker.image.namesAndTags": "namesAndTags",
+		"docker.command.args":       "commandArgs",
+	}},
+}
+
+var tcXMLTriggers = map[string]string{
+	"vcsTrigger":             "vcs",
+	"schedulingTrigger":      "schedule",
+	"buildDependencyTrigger": "finishBuildTrigger",
+}
+
+// tcXMLSchedule maps schedulingTrigger parameters to the DSL's
+var tcXMLSchedule = map[string]string{
+	"cronExpression_min":   "minutes",
+	"cronExpression_hour":  "hours",
+	"cronExpression_dm":    "dayOfMonth",
+	"cronExpression_month": "month",
+	"cronExpression_dw":    "dayOfWeek",
+	"dependsOn":            "buildType",
+}
+
+func teamCityXMLBuildType(config *PipelineConfig, content []byte, file string) (tcBuildType, error) {
+	var x tcXMLBuildType
+	if err := xml.Unmarshal(content, &x); err != nil {
+		return tcBuildType{}, err
+	}
+	s := x.Settings
+	bt := tcBuildType{id: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)), name: x.Name, kind: "REGULAR", params: tcXMLParamList(s.Params)}
+	if s.Ref != "" {
+		bt.unsupported = append(bt.unsupported, "template "+s.Ref)
+	}
+	options := tcXMLParams(s.Options)
+	bt.artifactRules = options["artifactRules"]
+	if kind := options["buildConfigurationType"]; kind != "" {
+		bt.kind = kind
+	}
+
+	for _, r := range s.Runners {
+		params := tcXMLParams(r.Params)
+		st := tcStep{name: r.Name, runner: r.Type, params: map[string]string{}, image: params["plugin.docker.imageId"], workDir: params["teamcity.build.workingDir"], mode: teamCityStepMode(params["teamcity.step.mode"])}
+		if known, ok := tcXMLRunners[r.Type]; ok {
+			st.runner = known.runner
+			for from, to := range known.params {
+				if v, ok := params[from]; ok {
+					st.params[to] = v
+				}
+			}
+			if r.Type == "simpleRunner" && params["use.custom.script"] != "true" && params["script.content"] == "" {
+				st.runner = "exec"
+			}
+			if r.Type == "gradle-runner" && params["ui.gradleRunner.gradle.wrapper.useWrapper"] != "true" {
+				st.params["useGradleWrapper"] = "false"
+			}
+		}
+		bt.steps = append(bt.steps, st)
+	}
+	for _, t := range s.Triggers {
+		trigger := tcTrigger{kind: t.Type, params: map[string]string{}}
+		if kind, ok := tcXMLTriggers[t.Type]; ok {
+			trigger.kind = kind
+		}
+		for k, v := range tcXMLParams(t.Params) {
+			if to, ok := tcXMLSchedule[k]; ok {
+				k = to
+			}
+			trigger.params[k] = v
+		}
+		bt.triggers = append(bt.triggers, trigger)
+	}
+	for _, f := range s.Features {
+		bt.features = append(bt.features, f.Type)
+	}
+	for _, d := range s.Snapshots {
+		dep := tcDependency{source: d.Source}
+		switch tcXMLParams(d.Options)["run-build-if-dependency-failed"] {
+		case "RUN", "RUN_ADD_PROBLEM":
+			dep.onFailure = "IGNORE"
+		}
+		bt.snapshots = append(bt.snapshots, dep)
+	}
+	for _, d := range s.ArtifactDeps {
+		var rules []string
+		for _, a := range d.Artifacts {
+			rules = append(rules, a.SourcePath)
+		}
+		bt.artifactDeps = append(bt.artifactDeps, tcDependency{source: d.Source, rules: strings.Join(rules, "\n")})
+	}
+	bt.requirements = strings.TrimSpace(s.Requirements.Inner) != ""
+	return bt, nil
+}
+
+// The Kotlin DSL is read with a small scanner that knows statements, not
+// Kotlin: assignments (name = value), calls (name(args)) and blocks
+// (name { … }, name(args) { … }, object Name : Type({ … })). That covers
+// the declarative settings TeamCity generates and most hand-written ones;
+// loops and helper functions are skipped.
+
+// ktNode is one statement
+type ktNode struct {
+	name   string
+	args   []string // raw arguments of a call
+	value  string   // raw value of an assignment; the type of an object
+	body   []ktNode // statements of a block
+	assign bool
+	block  bool
+}
+
+type ktScanner struct {
+	src string
+	i   int
+}
+
+func parseKotlinDSL(src string) []ktNode {
+	s := &ktScanner{src: src}
+	return s.statements()
+}
+
+// statements reads statements up to the closing brace of a block
+func (s *ktScanner) statements() []ktNode {
+	var nodes []ktNode
+	for {
+		s.space(true)
+		if s.i >= len(s.src) {
+			return nodes
+		}
+		c := s.src[s.i]
+		switch {
+		case c == '}':
+			s.i++
+			return nodes
+		case c == '@':
+			// Annotation
+			s.i++
+			s.ident()
+			if s.peek('(') {
+				s.group()
+			}
+			continue
+		case !isIdentStart(c):
+			s.skip()
+			continue
+		}
+
+		name := s.ident()
+		switch name {
+		case "import", "package":
+			s.line()
+			continue
+		case "object":
+			nodes = append(nodes, s.object())
+			continue
+		case "val", "var":
+			s.space(false)
+			name = s.ident()
+			s.space(false)
+			if s.peek(':') {
+				s.i++
+				s.space(false)
+				s.ident()
+			}
+		case "fun", "class", "if", "for", "while", "when", "return":
+			s.skip()
+			continue
+		}
+
+		n := ktNode{name: name}
+		s.space(false)
+		switch {
+		case strings.HasPrefix(s.src[s.i:], "=="):
+			s.skip()
+			continue
+		case s.peek('='):
+			s.i++
+			n.assign = true
+			n.value = strings.TrimSpace(s.expression())
+		case s.peek('('):
+			n.args = splitKotlinArgs(s.group())
+			s.space(false)
+			if s.peek('{') {
+				s.i++
+				n.block = true
+				n.body = s.statements()
+			}
+		case s.peek('{'):
+			s.i++
+			n.block = true
+			n.body = s.statements()
+		default:
+			s.skip()
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+// object reads object Name : Type({ … }) or object Name : Type() { … }
+func (s *ktScanner) object() ktNode {
+	s.space(false)
+	n := ktNode{name: "object", block: true, args: []string{s.ident()}}
+	s.space(false)
+	if s.peek(':') {
+		s.i++
+		s.space(false)
+		n.value = s.ident()
+	}
+	s.space(false)
+	if s.peek('(') {
+		s.i++
+		s.space(true)
+		if s.peek('{') {
+			s.i++
+			n.body = s.statements()
+		}
+		s.close('(', ')')
+		s.space(false)
+	}
+	if s.peek('{') {
+		s.i++
+		n.body = append(n.body, s.statements()...)
+	}
+	return n
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (s *ktScanner) ident() string {
+	start := s.i
+	for s.i < len(s.src) {
+		c := s.src[s.i]
+		if !isIdentStart(c) && !(c >= '0' && c <= '9') && c != '.' {
+			break
+		}
+		s.i++
+	}
+	return s.src[start:s.i]
+}
+
+func (s *ktScanner) peek(c byte) bool {
+	return s.i < len(s.src) && s.src[s.i] == c
+}
+
+// space skips blanks and comments, and line breaks when newlines is set
+func (s *ktScanner) space(newlines bool) {
+	for s.i < len(s.src) {
+		switch c := s.src[s.i]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			s.i++
+		case newlines && (c == '\n' || c == ';'):
+			s.i++
+		case strings.HasPrefix(s.src[s.i:], "//"):
+			s.line()
+		case strings.HasPrefix(s.src[s.i:], "/*"):
+			if end := strings.Index(s.src[s.i+2:], "*/"); end >= 0 {
+				s.i += end + 4
+			} else {
+				s.i = len(s.src)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *ktScanner) line() {
+	if end := strings.IndexByte(s.src[s.i:], '\n'); end >= 0 {
+		s.i += end
+	} else {
+		s.i = len(s.src)
+	}
+}
+
+// str skips a string literal
+func (s *ktScanner) str() {
+	if strings.HasPrefix(s.src[s.i:], `"""`) {
+		end := strings.Index(s.src[s.i+3:], `"""`)
+		if end < 0 {
+			s.i = len(s.src)
+			return
+		}
+		s.i += end + 6
+		for s.peek('"') {
+			s.i++
+		}
+		return
+	}
+	s.i++
+	for s.i < len(s.src) {
+		switch s.src[s.i] {
+		case '\\':
+			s.i++
+		case '"':
+			s.i++
+			return
+		case '$':
+			if strings.HasPrefix(s.src[s.i:], "${") {
+				s.i += 2
+				s.close('{', '}')
+				continue
+			}
+		}
+		s.i++
+	}
+}
+
+// close skips past the bracket closing the one just read
+func (s *ktScanner) close(open, end byte) {
+	depth := 1
+	for s.i < len(s.src) {
+		switch c := s.src[s.i]; c {
+		case '"':
+			s.str()
+			continue
+		case open:
+			depth++
+		case end:
+			depth--
+			if depth == 0 {
+				s.i++
+				return
+			}
+		}
+		s.i++
+	}
+}
+
+// group reads a parenthesized argument list and returns what is inside
+func (s *ktScanner) group() string {
+	start := s.i + 1
+	s.i++
+	s.close('(', ')')
+	if s.i-1 < start {
+		return ""
+	}
+	return s.src[start : s.i-1]
+}
+
+// expression reads the value of an assignment: up to the end of the line,
+// or further while brackets are open or the next line continues a call chain
+func (s *ktScanner) expression() string {
+	start := s.i
+	depth := 0
+	for s.i < len(s.src) {
+		c := s.src[s.i]
+		switch {
+		case c == '"':
+			s.str()
+			continue
+		case c == '(' || c == '{' || c == '[':
+			depth++
+		case c == ')' || c == '}' || c == ']':
+			if depth == 0 {
+				return s.src[start:s.i]
+			}
+			depth--
+		case depth == 0 && c == ';':
+			v := s.src[start:s.i]
+			s.i++
+			return v
+		case depth == 0 && c == '\n':
+			j := s.i
+			for j < len(s.src) && strings.IndexByte(" \t\r\n", s.src[j]) >= 0 {
+				j++
+			}
+			if j < len(s.src) && s.src[j] == '.' {
+				s.i = j
+				continue
+			}
+			return s.src[start:s.i]
+		case depth == 0 && strings.HasPrefix(s.src[s.i:], "//"):
+			v := s.src[start:s.i]
+			s.line()
+			return v
+		}
+		s.i++
+	}
+	return s.src[start:]
+}
+
+// skip passes over a statement the scanner does not read
+func (s *ktScanner) skip() {
+	start := s.i
+	s.expression()
+	switch {
+	case s.peek('{'):
+		s.i++
+		s.close('{', '}')
+	case s.peek('('):
+		s.i++
+		s.close('(', ')')
+	}
+	if s.i == start {
+		s.i++
+	}
+}
+
+// splitKotlinArgs splits an argument list at its top-level commas
+func splitKotlinArgs(s string) []string {
+	var args []string
+	sc := &ktScanner{src: s}
+	start, depth := 0, 0
+	for sc.i < len(s) {
+		switch c := s[sc.i]; c {
+		case '"':
+			sc.str()
+			continue
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:sc.i]))
+				start = sc.i + 1
+			}
+		}
+		sc.i++
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		args = append(args, rest)
+	}
+	return args
+}
+
+// ktValue is the string value assigned to name in a block
+func ktValue(nodes []ktNode, name string) string {
+	value := ""
+	for _, n := range nodes {
+		if n.assign && n.name == name {
+			value = ktString(n.value)
+		}
+	}
+	return value
+}
+
+// ktString is the value of a string literal, including raw strings with
+// .trimIndent() or .trimMargin(); other expressions come back as written
+func ktString(v string) string {
+	v = strings.TrimSpace(v)
+	trim := ""
+	for _, suffix := range []string{".trimIndent()", ".trimMargin()"} {
+		if strings.HasSuffix(v, suffix) {
+			trim = suffix
+			v = strings.TrimSpace(strings.TrimSuffix(v, suffix))
+		}
+	}
+	switch {
+	case len(v) >= 6 && strings.HasPrefix(v, `"""`) && strings.HasSuffix(v, `"""`):
+		v = v[3 : len(v)-3]
+	case len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`):
+		v = ktUnescape(v[1 : len(v)-1])
+	default:
+		return v
+	}
+	v = strings.ReplaceAll(v, "${'$'}", "$")
+	switch trim {
+	case ".trimIndent()":
+		v = trimIndent(v, "")
+	case ".trimMargin()":
+		v = trimIndent(v, "|")
+	}
+	return v
+}
+
+func ktUnescape(s string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\r`, "\r", `\"`, `"`, `\\`, `\`, `\$`, "$", `\'`, "'")
+	return replacer.Replace(s)
+}
+
+// trimIndent removes blank first and last lines and the common indentation,
+// or with a margin the blanks up to and including it
+func trimIndent(s, margin string) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if margin != "" {
+		for i, line := range lines {
+			trimmed := strings.TrimLeft(line, " \t")
+			lines[i] = strings.TrimPrefix(trimmed, margin)
+		}
+		return strings.Join(lines, "\n")
+	}
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			lines[i] = line[indent:]
+		} else {
+			lines[i] = strings.TrimLeft(line, " \t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,667 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tektonCloneTask is the pipeline task that clones the repository into the
+// shared workspace with the git-clone task of the Tekton catalog
+const tektonCloneTask = "fetch-source"
+
+// tektonWorkspace is the workspace every task works in
+const tektonWorkspace = "source"
+
+var nonTektonChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// tektonParams are the Pipeline's parameters and the Pipelines-as-Code
+// variables its PipelineRun fills them from
+var tektonParams = []struct {
+	name  string
+	value string
+}{
+	{"repo-url", "{{ repo_url }}"},
+	{"revision", "{{ revision }}"},
+	{"branch", "{{ source_branch }}"},
+	{"target-branch", "{{ target_branch }}"},
+	{"event", "{{ event_type }}"},
+}
+
+// tektonVariables are the variables tasks get from a Pipeline parameter,
+// for the runner variables they replace
+var tektonVariables = map[string]string{
+	"CI_COMMIT_SHA":     "revision",
+	"CI_COMMIT_BRANCH":  "branch",
+	"CI_TARGET_BRANCH":  "target-branch",
+	"CI_REPOSITORY_URL": "repo-url",
+	"CI_EVENT":          "event",
+}
+
+// tektonConditions rewrite parts of a GitHub condition to when expressions
+// on a Pipeline parameter; == becomes in and != notin
+var tektonConditions = []struct {
+	pattern *regexp.Regexp
+	param   string
+}{
+	{regexp.MustCompile(`^github\.(?:ref_name|head_ref) (==|!=) '([^']*)'$`), "branch"},
+	{regexp.MustCompile(`^github\.ref (==|!=) 'refs/heads/([^']*)'$`), "branch"},
+	{regexp.MustCompile(`^github\.base_ref (==|!=) '([^']*)'$`), "target-branch"},
+	{regexp.MustCompile(`^github\.event_name (==|!=) '([^']*)'$`), "event"},
+}
+
+// generateTekton generates a Tekton Task per job and a Pipeline running them
+// after a task that clones the repository, followed by a PipelineRun for
+// Pipelines-as-Code. Tasks share a workspace, so artifacts need no handover.
+func (c *Converter) generateTekton(config *PipelineConfig) (string, error) {
+	name := config.Name
+	if name == "" {
+		name = "ci"
+	}
+	g := &tektonGenerator{
+		config:   config,
+		pipeline: tektonName(name),
+		env:      make(map[string]string),
+		secrets:  make(map[string]string),
+		tasks:    make(map[string]string),
+		names:    map[string]bool{tektonCloneTask: true},
+	}
+	for k, v := range config.Environment {
+		if secret := settingName(v); secret != "" {
+			g.secrets[k] = secret
+			continue
+		}
+		g.env[k] = v
+	}
+	jobs := droneJobOrder(config.Jobs)
+	for _, job := range jobs {
+		g.tasks[job.Name] = g.name(g.names, job.Name)
+	}
+
+	var docs []interface{}
+	for _, job := range jobs {
+		docs = append(docs, commented{job.Comment, g.task(job)})
+	}
+	docs = append(docs, g.pipelineResource(jobs), g.pipelineRun())
+	return marshalYAML(config.Comment, docs...)
+}
+
+// tektonResource is a Tekton Task, Pipeline or PipelineRun
+type tektonResource struct {
+	APIVersion string         `yaml:"apiVersion"`
+	Kind       string         `yaml:"kind"`
+	Metadata   tektonMetadata `yaml:"metadata"`
+	Spec       interface{}    `yaml:"spec"`
+}
+
+type tektonMetadata struct {
+	Name         string  `yaml:"name,omitempty"`
+	GenerateName string  `yaml:"generateName,omitempty"`
+	Annotations  yamlMap `yaml:"annotations,omitempty"`
+}
+
+type tektonTaskSpec struct {
+	Params       []tektonParam            `yaml:"params,omitempty"`
+	Workspaces   []tektonWorkspaceBinding `yaml:"workspaces"`
+	StepTemplate struct {
+		WorkingDir string      `yaml:"workingDir"`
+		Env        []tektonEnv `yaml:"env,omitempty"`
+	} `yaml:"stepTemplate"`
+	Sidecars []tektonContainer `yaml:"sidecars,omitempty"`
+	Steps    []interface{}     `yaml:"steps"`
+}
+
+type tektonContainer struct {
+	Name       string      `yaml:"name"`
+	Image      string      `yaml:"image"`
+	WorkingDir string      `yaml:"workingDir,omitempty"`
+	Env        []tektonEnv `yaml:"env,omitempty"`
+	Script     *yaml.Node  `yaml:"script,omitempty"`
+}
+
+type tektonEnv struct {
+	Name      string      `yaml:"name"`
+	ValueFrom interface{} `yaml:"valueFrom,omitempty"`
+	Value     interface{} `yaml:"value,omitempty"`
+}
+
+type tektonSecretKeyRef struct {
+	SecretKeyRef struct {
+		Name string `yaml:"name"`
+		Key  string `yaml:"key"`
+	} `yaml:"secretKeyRef"`
+}
+
+type tektonParam struct {
+	Name    string      `yaml:"name"`
+	Type    string      `yaml:"type,omitempty"`
+	Default *string     `yaml:"default,omitempty"`
+	Value   interface{} `yaml:"value,omitempty"`
+}
+
+type tektonWorkspaceBinding struct {
+	Name                string      `yaml:"name"`
+	Workspace           string      `yaml:"workspace,omitempty"`
+	VolumeClaimTemplate interface{} `yaml:"volumeClaimTemplate,omitempty"`
+}
+
+type tektonPipelineSpec struct {
+	Params     []tektonParam            `yaml:"params"`
+	Workspaces []tektonWorkspaceBinding `yaml:"workspaces"`
+	Tasks      []tektonPipelineTask     `yaml:"tasks"`
+	Finally    []tektonPipelineTask     `yaml:"finally,omitempty"`
+}
+
+type tektonPipelineTask struct {
+	Name     string   `yaml:"name"`
+	RunAfter []string `yaml:"runAfter,omitempty"`
+	TaskRef  struct {
+		Name     string        `yaml:"name,omitempty"`
+		Resolver string        `yaml:"resolver,omitempty"`
+		Params   []tektonParam `yaml:"params,omitempty"`
+	} `yaml:"taskRef"`
+	Params     []tektonParam            `yaml:"params,omitempty"`
+	Workspaces []tektonWorkspaceBinding `yaml:"workspaces"`
+	When       []tektonWhen             `yaml:"when,omitempty"`
+}
+
+type tektonWhen struct {
+	Input    string   `yaml:"input"`
+	Operator string   `yaml:"operator"`
+	Values   []string `yaml:"values"`
+}
+
+type tektonPipelineRunSpec struct {
+	PipelineRef struct {
+		Name string `yaml:"name"`
+	} `yaml:"pipelineRef"`
+	Params     []tektonParam            `yaml:"params"`
+	Workspaces []tektonWorkspaceBinding `yaml:"workspaces"`
+}
+
+// tektonClaim is the volume claim of the PipelineRun's workspace
+type tektonClaim struct {
+	Spec struct {
+		AccessModes []string `yaml:"accessModes"`
+		Resources   struct {
+			Requests map[string]string `yaml:"requests"`
+		} `yaml:"resources"`
+	} `yaml:"spec"`
+}
+
+type tektonGenerator struct {
+	config   *PipelineConfig
+	pipeline string
+	env      map[string]string
+	secrets  map[string]string // variables bound to a secret of the same or another name
+	tasks    map[string]string // job names to pipeline task names
+	names    map[string]bool   // pipeline task names in use
+}
+
+// name returns a name for s that is unique among names
+func (g *tektonGenerator) name(names map[string]bool, s string) string {
+	base := tektonName(s)
+	name := base
+	for n := 2; names[name]; n++ {
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	names[name] = true
+	return name
+}
+
+// task is the Task running a job: its steps run in the job's container, its
+// services as sidecars
+func (g *tektonGenerator) task(job Job) tektonResource {
+	image := droneDefaultImage
+	if job.Container != nil {
+		image = job.Container.Image
+	} else {
+		g.config.approximated("runs-on", "job '%s' runs on %s; Tekton runs steps in containers, so it uses %s", job.Name, job.RunsOn, droneDefaultImage)
+	}
+
+	var spec tektonTaskSpec
+	for _, p := range g.params(job) {
+		spec.Params = append(spec.Params, tektonParam{Name: p, Type: "string"})
+	}
+	spec.Workspaces = []tektonWorkspaceBinding{{Name: tektonWorkspace}}
+	spec.StepTemplate.WorkingDir = fmt.Sprintf("$(workspaces.%s.path)", tektonWorkspace)
+	env, secrets := g.jobEnv(job)
+	for _, v := range g.variables(job) {
+		if v == "CI_WORKSPACE" {
+			env[v] = fmt.Sprintf("$(workspaces.%s.path)", tektonWorkspace)
+		} else {
+			env[v] = fmt.Sprintf("$(params.%s)", tektonVariables[v])
+		}
+	}
+	spec.StepTemplate.Env = g.envList(job.Name, env, secrets)
+
+	if len(job.Services) > 0 {
+		names := make(map[string]bool)
+		for _, svc := range job.Services {
+			if usesHost(job, svc.Name) {
+				g.config.note("job '%s' reaches service '%s' by name; sidecars share the task's pod, so on Tekton it is on localhost", job.Name, svc.Name)
+			}
+			env, secrets := g.splitEnv(svc.Env)
+			spec.Sidecars = append(spec.Sidecars, tektonContainer{Name: g.name(names, svc.Name), Image: svc.Image, Env: g.envList(job.Name, env, secrets)})
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, step := range g.steps(job) {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step-%d", i+1)
+		}
+		c := tektonContainer{Name: g.name(names, name), Image: image}
+		if step.Image != "" {
+			c.Image = step.Image
+		}
+		if step.WorkDir != "" {
+			c.WorkingDir = fmt.Sprintf("$(workspaces.%s.path)/%s", tektonWorkspace, strings.TrimPrefix(step.WorkDir, "./"))
+		}
+		env, secrets := g.splitEnv(step.Env)
+		c.Env = g.envList(job.Name, env, secrets)
+		if step.Run != "" {
+			c.Script = tektonScript(step.Run)
+		}
+		spec.Steps = append(spec.Steps, commented{step.Comment, c})
+	}
+	return tektonResource{APIVersion: "tekton.dev/v1", Kind: "Task", Metadata: tektonMetadata{Name: g.taskRef(job)}, Spec: spec}
+}
+
+// steps builds the Tekton steps of a job. Each runs in a container of its
+// own, so a step that reads outputs of the jobs this one needs loads them
+// first. Files stay on the shared workspace, so artifacts need no handover.
+func (g *tektonGenerator) steps(job Job) []Step {
+	workspaceDownloads(g.config, job, "Tekton")
+	if uploads := jobArtifacts(job); len(uploads) > 0 && !downloadedJobs(g.config)[job.Name] {
+		var names []string
+		for _, a := range uploads {
+			names = append(names, a.Name)
+		}
+		g.config.dropped("upload-artifact", "job '%s' uploads %s; the workspace goes away with the PipelineRun, so publish them to storage", job.Name, strings.Join(names, ", "))
+	}
+
+	var load []string
+	var outputs []string
+	for _, producer := range outputProducers(g.config, job) {
+		load = append(load, fmt.Sprintf("set -a && . %s && set +a", jobOutputFile(producer)))
+		for _, other := range g.config.Jobs {
+			if other.Name == producer {
+				for _, out := range other.Outputs {
+					outputs = append(outputs, outputVariable(producer, out.Name))
+				}
+			}
+		}
+	}
+	readsOutputs := func(s string) bool {
+		for _, m := range variablePattern.FindAllStringSubmatch(s, -1) {
+			if containsString(outputs, variableName(m)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var steps []Step
+	for _, step := range job.Steps {
+		var command string
+		switch {
+		case step.Image != "":
+			command = step.Run
+		case step.Run != "":
+			command = shellOutputs(step.Run, step)
+		case step.Uses != "":
+			command = convertActionToCommand(step)
+		}
+		command = strings.TrimRight(command, "\n")
+		if command == "" && step.Image == "" {
+			continue
+		}
+		if step.If != "" {
+			g.config.dropped("if", "step in job '%s' has condition '%s'; Tekton runs it unconditionally", job.Name, step.If)
+		}
+		if command != "" && readsOutputs(command) {
+			command = strings.Join(append(append([]string{}, load...), command), "\n")
+		}
+		steps = append(steps, Step{Name: step.Name, Image: step.Image, Run: command, Env: step.Env, WorkDir: step.WorkDir, Comment: step.Comment})
+	}
+
+	if writesOutputs(job) {
+		mkdir := "mkdir -p " + outputDir
+		if len(steps) > 0 && steps[0].Run != "" {
+			steps[0].Run = mkdir + "\n" + steps[0].Run
+		} else {
+			steps = append([]Step{{Name: "outputs-dir", Run: mkdir}}, steps...)
+		}
+	}
+	if commands := jobOutputCommands(job); len(commands) > 0 {
+		steps = append(steps, Step{Name: "outputs", Run: strings.Join(commands, "\n")})
+	}
+	if len(steps) == 0 {
+		steps = []Step{{Name: "run", Run: "echo \"Nothing to run\""}}
+	}
+	return steps
+}
+
+// jobEnv returns the environment of a job's steps and the variables among
+// it bound to secrets. Tasks only get the secrets they read.
+func (g *tektonGenerator) jobEnv(job Job) (env, secrets map[string]string) {
+	env = copyStrings(g.env)
+	secrets = make(map[string]string)
+	mapJobStrings(job, func(s string) string {
+		for _, m := range variablePattern.FindAllStringSubmatch(s, -1) {
+			if name := variableName(m); g.secrets[name] != "" {
+				secrets[name] = g.secrets[name]
+			}
+		}
+		return s
+	})
+	for _, m := range []map[string]string{job.Environment, containerEnv(job)} {
+		for k, v := range m {
+			if name := g.secret(v); name != "" {
+				secrets[k] = name
+				delete(env, k)
+				continue
+			}
+			env[k] = v
+			delete(secrets, k)
+		}
+	}
+	return env, secrets
+}
+
+// splitEnv separates the variables of env that read a secret, returning
+// the others and the secret each of those reads
+func (g *tektonGenerator) splitEnv(m map[string]string) (env, secrets map[string]string) {
+	env = make(map[string]string)
+	secrets = make(map[string]string)
+	for k, v := range m {
+		if name := g.secret(v); name != "" {
+			secrets[k] = name
+			continue
+		}
+		env[k] = v
+	}
+	return env, secrets
+}
+
+// secret returns the secret a whole value reads, directly or through a
+// pipeline variable bound to it, or ""
+func (g *tektonGenerator) secret(v string) string {
+	if name := settingName(v); name != "" {
+		return name
+	}
+	if m := variablePattern.FindStringSubmatch(v); m != nil && m[0] == v {
+		return g.secrets[variableName(m)]
+	}
+	return ""
+}
+
+// variables returns the CI_ variables a job reads that the Pipeline
+// provides
+func (g *tektonGenerator) variables(job Job) []string {
+	used := make(map[string]string)
+	mapJobStrings(job, func(s string) string {
+		for _, m := range variablePattern.FindAllStringSubmatch(s, -1) {
+			if name := variableName(m); tektonVariables[name] != "" || name == "CI_WORKSPACE" {
+				used[name] = ""
+			}
+		}
+		return s
+	})
+	return sortedKeys(used)
+}
+
+// params returns the Pipeline parameters a job's Task takes
+func (g *tektonGenerator) params(job Job) []string {
+	var params []string
+	for _, v := range g.variables(job) {
+		if p := tektonVariables[v]; p != "" && !containsString(params, p) {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// envList is an env list. Secrets come first and are read from the
+// Kubernetes secret of their name, so values after them can refer to them.
+func (g *tektonGenerator) envList(job string, env, secrets map[string]string) []tektonEnv {
+	var list []tektonEnv
+	for _, k := range sortedKeys(secrets) {
+		var ref tektonSecretKeyRef
+		ref.SecretKeyRef.Name, ref.SecretKeyRef.Key = tektonSecretName(secrets[k]), "value"
+		list = append(list, tektonEnv{Name: k, ValueFrom: ref})
+	}
+	for _, k := range sortedKeys(env) {
+		list = append(list, tektonEnv{Name: k, Value: g.value(job, env[k], secrets)})
+	}
+	return list
+}
+
+// value rewrites variable references in an env value. Kubernetes expands
+// $(NAME) for variables set before it, which secrets are; Pipeline
+// variables become their parameter. Other references stay text.
+func (g *tektonGenerator) value(job, s string, secrets map[string]string) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := variableName(variablePattern.FindStringSubmatch(ref))
+		if _, ok := secrets[name]; ok {
+			return "$(" + name + ")"
+		}
+		if p := tektonVariables[name]; p != "" {
+			return "$(params." + p + ")"
+		}
+		if name == "CI_WORKSPACE" {
+			return fmt.Sprintf("$(workspaces.%s.path)", tektonWorkspace)
+		}
+		g.config.approximated("environment", "job '%s' sets a value from $%s; Kubernetes does not expand it in env values, so it is passed as text", job, name)
+		return ref
+	})
+}
+
+// pipelineResource is the Pipeline: the clone task, then a task per job
+// running after the jobs it needs. Jobs that always run become finally
+// tasks.
+func (g *tektonGenerator) pipelineResource(jobs []Job) tektonResource {
+	var spec tektonPipelineSpec
+	for _, p := range tektonParams {
+		param := tektonParam{Name: p.name, Type: "string"}
+		if p.name != "repo-url" && p.name != "revision" {
+			param.Default = new(string)
+		}
+		spec.Params = append(spec.Params, param)
+	}
+	spec.Workspaces = []tektonWorkspaceBinding{{Name: tektonWorkspace}}
+
+	clone := tektonPipelineTask{Name: tektonCloneTask}
+	clone.TaskRef.Resolver = "hub"
+	clone.TaskRef.Params = []tektonParam{{Name: "kind", Value: "task"}, {Name: "name", Value: "git-clone"}, {Name: "version", Value: "0.9"}}
+	clone.Params = []tektonParam{{Name: "url", Value: "$(params.repo-url)"}, {Name: "revision", Value: "$(params.revision)"}}
+	clone.Workspaces = []tektonWorkspaceBinding{{Name: "output", Workspace: tektonWorkspace}}
+	spec.Tasks = []tektonPipelineTask{clone}
+
+	var finally []Job
+	for _, job := range jobs {
+		if alwaysRuns(job.Condition) {
+			finally = append(finally, job)
+			continue
+		}
+		spec.Tasks = append(spec.Tasks, g.pipelineTask(job, true))
+	}
+	for _, job := range finally {
+		g.config.approximated("if", "job '%s' always runs; it becomes a finally task, which runs after every other task rather than only the jobs it needs", job.Name)
+		spec.Finally = append(spec.Finally, g.pipelineTask(job, false))
+	}
+	return tektonResource{APIVersion: "tekton.dev/v1", Kind: "Pipeline", Metadata: tektonMetadata{Name: g.pipeline}, Spec: spec}
+}
+
+// pipelineTask is a job's entry in the Pipeline. Finally tasks cannot name
+// tasks to run after.
+func (g *tektonGenerator) pipelineTask(job Job, after bool) tektonPipelineTask {
+	if job.Gate != nil {
+		g.config.dropped("approval", "job '%s' waits for approval; Tekton has no approval gate, so add one such as the ApprovalTask custom task", job.Name)
+	}
+	if job.Gate != nil && len(job.Gate.Approvers) > 0 {
+		g.config.dropped("approvers", "job '%s' needs approval from %s", job.Name, strings.Join(job.Gate.Approvers, ", "))
+	}
+
+	task := tektonPipelineTask{Name: g.tasks[job.Name]}
+	if after {
+		var runAfter []string
+		for _, dep := range job.DependsOn {
+			if task, ok := g.tasks[dep]; ok {
+				runAfter = append(runAfter, task)
+			}
+		}
+		if len(runAfter) == 0 {
+			runAfter = []string{tektonCloneTask}
+		}
+		task.RunAfter = runAfter
+	}
+	task.TaskRef.Name = g.taskRef(job)
+	for _, p := range g.params(job) {
+		task.Params = append(task.Params, tektonParam{Name: p, Value: fmt.Sprintf("$(params.%s)", p)})
+	}
+	task.Workspaces = []tektonWorkspaceBinding{{Name: tektonWorkspace, Workspace: tektonWorkspace}}
+	task.When = g.when(job)
+	return task
+}
+
+// when is a job's condition as when expressions. Only conditions joining
+// comparisons of the branch or event with && have an equivalent.
+func (g *tektonGenerator) when(job Job) []tektonWhen {
+	cond := strings.TrimPrefix(strings.TrimPrefix(job.Condition, "always()"), " && ")
+	if cond == "" {
+		return nil
+	}
+	var when []tektonWhen
+	for _, part := range strings.Split(cond, " && ") {
+		var m []string
+		var param string
+		for _, rule := range tektonConditions {
+			if m = rule.pattern.FindStringSubmatch(strings.TrimSpace(part)); m != nil {
+				param = rule.param
+				break
+			}
+		}
+		if m == nil {
+			g.config.dropped("if", "job '%s' has condition '%s'; Tekton runs it in every PipelineRun", job.Name, cond)
+			return nil
+		}
+		operator := "in"
+		if m[1] == "!=" {
+			operator = "notin"
+		}
+		when = append(when, tektonWhen{Input: fmt.Sprintf("$(params.%s)", param), Operator: operator, Values: []string{m[2]}})
+	}
+	return when
+}
+
+// pipelineRun is the PipelineRun that starts the Pipeline, with the
+// Pipelines-as-Code annotations for its triggers
+func (g *tektonGenerator) pipelineRun() tektonResource {
+	var events, branches, paths []string
+	var sameBranches, samePaths = true, true
+	first := true
+	for _, t := range g.config.Triggers {
+		switch t.Type {
+		case "push", "pull_request":
+			events = append(events, t.Type)
+			if !first {
+				sameBranches = sameBranches && strings.Join(t.Branches, ",") == strings.Join(branches, ",")
+				samePaths = samePaths && strings.Join(t.Paths, ",") == strings.Join(paths, ",")
+			}
+			first = false
+			for _, b := range t.Branches {
+				if !containsString(branches, b) {
+					branches = append(branches, b)
+				}
+			}
+			for _, p := range t.Paths {
+				if !containsString(paths, p) {
+					paths = append(paths, p)
+				}
+			}
+		case "schedule":
+			g.config.note("Pipelines-as-Code does not schedule runs; create a CronJob that creates the PipelineRun (cron '%s')", t.Cron)
+		case "manual":
+			g.config.note("builds could be started by hand; start the pipeline with tkn pipeline start %s", g.pipeline)
+		case "call":
+			g.config.approximated("workflow_call", "the pipeline is reusable; start it from other PipelineRuns with pipelineRef: %s", g.pipeline)
+		}
+	}
+	if !sameBranches && len(branches) > 0 {
+		g.config.approximated("on", "Pipelines-as-Code filters every event on the same branches, so the pipeline runs for %s on %s", strings.Join(events, " and "), strings.Join(branches, ", "))
+	}
+	if !samePaths && len(paths) > 0 {
+		g.config.approximated("paths", "Pipelines-as-Code filters every event on the same paths, so the pipeline runs for %s when %s change", strings.Join(events, " and "), strings.Join(paths, ", "))
+	}
+	g.config.note("the PipelineRun is written for Pipelines-as-Code, which fills in its {{ }} parameters; set them yourself to start it with kubectl create")
+
+	metadata := tektonMetadata{GenerateName: g.pipeline + "-"}
+	if len(events) > 0 {
+		metadata.Annotations.set("pipelinesascode.tekton.dev/on-event", "["+strings.Join(events, ", ")+"]")
+		if len(branches) > 0 {
+			metadata.Annotations.set("pipelinesascode.tekton.dev/on-target-branch", "["+strings.Join(branches, ", ")+"]")
+		}
+		if len(paths) > 0 {
+			metadata.Annotations.set("pipelinesascode.tekton.dev/on-path-change", "["+strings.Join(paths, ", ")+"]")
+		}
+	}
+
+	var spec tektonPipelineRunSpec
+	spec.PipelineRef.Name = g.pipeline
+	for _, p := range tektonParams {
+		spec.Params = append(spec.Params, tektonParam{Name: p.name, Value: p.value})
+	}
+	var claim tektonClaim
+	claim.Spec.AccessModes = []string{"ReadWriteOnce"}
+	claim.Spec.Resources.Requests = map[string]string{"storage": "1Gi"}
+	spec.Workspaces = []tektonWorkspaceBinding{{Name: tektonWorkspace, VolumeClaimTemplate: claim}}
+	return tektonResource{APIVersion: "tekton.dev/v1", Kind: "PipelineRun", Metadata: metadata, Spec: spec}
+}
+
+// taskRef is the name of a job's Task, which is cluster-wide, so it starts
+// with the pipeline's name
+func (g *tektonGenerator) taskRef(job Job) string {
+	return tektonName(g.pipeline + "-" + g.tasks[job.Name])
+}
+
+// tektonScript is a step's script as a block scalar; Tekton runs scripts
+// without a shebang with sh -e
+func tektonScript(script string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Style: yaml.LiteralStyle, Tag: "!!str", Value: script}
+}
+
+// tektonName turns s into a Kubernetes resource name: lower case letters,
+// digits and dashes, at most 63 characters
+func tektonName(s string) string {
+	name := strings.Trim(nonTektonChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	if name == "" {
+		name = "task"
+	}
+	return name
+}
+
+// tektonSecretName is the Kubernetes secret holding a secret's value
+func tektonSecretName(name string) string {
+	return tektonName(name)
+}
+
+// alwaysRuns reports whether a job runs even when the jobs it needs fail
+func alwaysRuns(cond string) bool {
+	return cond == "always()" || strings.HasPrefix(cond, "always() && ")
+}
+
+// containerEnv is the environment of a job's container, if it has one
+func containerEnv(job Job) map[string]string {
+	if job.Container == nil {
+		return nil
+	}
+	return job.Container.Env
+}
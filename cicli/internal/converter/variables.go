@@ -0,0 +1,571 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	variablePattern       = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+	runnerVariablePattern = regexp.MustCompile(`\$\{?((?:GITHUB|RUNNER)_[A-Z_]+)\}?`)
+	githubContextPattern  = regexp.MustCompile(`\$\{\{\s*github\.([a-z_]+)\s*\}\}`)
+	settingRefPattern     = regexp.MustCompile(`\$\{\{\s*(secrets|vars)\.([\w-]+)\s*\}\}`)
+	upperNamePattern      = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+	assignmentPattern     = regexp.MustCompile(`(?:^|[\s;&|(])(?:export\s+|local\s+|readonly\s+|declare\s+(?:-\w+\s+)*)?([A-Za-z_][A-Za-z0-9_]*)=`)
+	loopVariablePattern   = regexp.MustCompile(`\b(?:for|read(?:\s+-\w+)*)\s+([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// runnerVariables maps GitHub runner variables to the target's predefined ones
+var runnerVariables = map[Platform]map[string]string{
+	GitLab: {
+		"GITHUB_SHA":        "CI_COMMIT_SHA",
+		"GITHUB_REF_NAME":   "CI_COMMIT_REF_NAME",
+		"GITHUB_RUN_ID":     "CI_PIPELINE_ID",
+		"GITHUB_RUN_NUMBER": "CI_PIPELINE_IID",
+		"GITHUB_REPOSITORY": "CI_PROJECT_PATH",
+		"GITHUB_ACTOR":      "GITLAB_USER_LOGIN",
+		"GITHUB_WORKSPACE":  "CI_PROJECT_DIR",
+		"GITHUB_JOB":        "CI_JOB_NAME",
+		"GITHUB_SERVER_URL": "CI_SERVER_URL",
+		"GITHUB_HEAD_REF":   "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME",
+		"GITHUB_BASE_REF":   "CI_MERGE_REQUEST_TARGET_BRANCH_NAME",
+		"GITHUB_EVENT_NAME": "CI_PIPELINE_SOURCE",
+		"RUNNER_TEMP":       "CI_BUILDS_DIR",
+	},
+	CircleCI: {
+		"GITHUB_SHA":        "CIRCLE_SHA1",
+		"GITHUB_REF_NAME":   "CIRCLE_BRANCH",
+		"GITHUB_RUN_ID":     "CIRCLE_WORKFLOW_ID",
+		"GITHUB_RUN_NUMBER": "CIRCLE_BUILD_NUM",
+		"GITHUB_REPOSITORY": "CIRCLE_PROJECT_REPONAME",
+		"GITHUB_ACTOR":      "CIRCLE_USERNAME",
+		"GITHUB_WORKSPACE":  "CIRCLE_WORKING_DIRECTORY",
+		"GITHUB_JOB":        "CIRCLE_JOB",
+	},
+	Bitbucket: {
+		"GITHUB_SHA":        "BITBUCKET_COMMIT",
+		"GITHUB_REF_NAME":   "BITBUCKET_BRANCH",
+		"GITHUB_RUN_ID":     "BITBUCKET_PIPELINE_UUID",
+		"GITHUB_RUN_NUMBER": "BITBUCKET_BUILD_NUMBER",
+		"GITHUB_REPOSITORY": "BITBUCKET_REPO_FULL_NAME",
+		"GITHUB_WORKSPACE":  "BITBUCKET_CLONE_DIR",
+		"GITHUB_BASE_REF":   "BITBUCKET_PR_DESTINATION_BRANCH",
+	},
+	// Azure exposes predefined variables to scripts with dots turned into
+	// underscores; azurePredefined handles the $(Build.X) macro form
+	Azure: {
+		"GITHUB_SHA":        "BUILD_SOURCEVERSION",
+		"GITHUB_REF":        "BUILD_SOURCEBRANCH",
+		"GITHUB_REF_NAME":   "BUILD_SOURCEBRANCHNAME",
+		"GITHUB_RUN_ID":     "BUILD_BUILDID",
+		"GITHUB_RUN_NUMBER": "BUILD_BUILDNUMBER",
+		"GITHUB_REPOSITORY": "BUILD_REPOSITORY_NAME",
+		"GITHUB_ACTOR":      "BUILD_REQUESTEDFOR",
+		"GITHUB_WORKSPACE":  "BUILD_SOURCESDIRECTORY",
+		"RUNNER_TEMP":       "AGENT_TEMPDIRECTORY",
+	},
+	Jenkins: {
+		"GITHUB_SHA":        "GIT_COMMIT",
+		"GITHUB_REF_NAME":   "BRANCH_NAME",
+		"GITHUB_RUN_ID":     "BUILD_ID",
+		"GITHUB_RUN_NUMBER": "BUILD_NUMBER",
+		"GITHUB_WORKSPACE":  "WORKSPACE",
+		"GITHUB_JOB":        "STAGE_NAME",
+	},
+	Drone: {
+		"GITHUB_SHA":        "DRONE_COMMIT_SHA",
+		"GITHUB_REF":        "DRONE_COMMIT_REF",
+		"GITHUB_REF_NAME":   "DRONE_BRANCH",
+		"GITHUB_RUN_NUMBER": "DRONE_BUILD_NUMBER",
+		"GITHUB_REPOSITORY": "DRONE_REPO",
+		"GITHUB_ACTOR":      "DRONE_COMMIT_AUTHOR",
+		"GITHUB_WORKSPACE":  "DRONE_WORKSPACE",
+		"GITHUB_JOB":        "DRONE_STEP_NAME",
+		"GITHUB_HEAD_REF":   "DRONE_SOURCE_BRANCH",
+		"GITHUB_BASE_REF":   "DRONE_TARGET_BRANCH",
+		"GITHUB_EVENT_NAME": "DRONE_BUILD_EVENT",
+	},
+	Woodpecker: {
+		"GITHUB_SHA":        "CI_COMMIT_SHA",
+		"GITHUB_REF":        "CI_COMMIT_REF",
+		"GITHUB_REF_NAME":   "CI_COMMIT_BRANCH",
+		"GITHUB_RUN_NUMBER": "CI_PIPELINE_NUMBER",
+		"GITHUB_REPOSITORY": "CI_REPO",
+		"GITHUB_ACTOR":      "CI_COMMIT_AUTHOR",
+		"GITHUB_WORKSPACE":  "CI_WORKSPACE",
+		"GITHUB_JOB":        "CI_STEP_NAME",
+		"GITHUB_HEAD_REF":   "CI_COMMIT_SOURCE_BRANCH",
+		"GITHUB_BASE_REF":   "CI_COMMIT_TARGET_BRANCH",
+		"GITHUB_EVENT_NAME": "CI_PIPELINE_EVENT",
+	},
+	Buildkite: {
+		"GITHUB_SHA":        "BUILDKITE_COMMIT",
+		"GITHUB_REF_NAME":   "BUILDKITE_BRANCH",
+		"GITHUB_RUN_ID":     "BUILDKITE_BUILD_ID",
+		"GITHUB_RUN_NUMBER": "BUILDKITE_BUILD_NUMBER",
+		"GITHUB_ACTOR":      "BUILDKITE_BUILD_CREATOR",
+		"GITHUB_WORKSPACE":  "BUILDKITE_BUILD_CHECKOUT_PATH",
+		"GITHUB_JOB":        "BUILDKITE_STEP_KEY",
+		"GITHUB_BASE_REF":   "BUILDKITE_PULL_REQUEST_BASE_BRANCH",
+	},
+	Harness: {
+		"GITHUB_SHA":        "DRONE_COMMIT_SHA",
+		"GITHUB_REF":        "DRONE_COMMIT_REF",
+		"GITHUB_REF_NAME":   "DRONE_COMMIT_BRANCH",
+		"GITHUB_RUN_ID":     "HARNESS_BUILD_ID",
+		"GITHUB_RUN_NUMBER": "DRONE_BUILD_NUMBER",
+		"GITHUB_REPOSITORY": "DRONE_REPO",
+		"GITHUB_ACTOR":      "DRONE_COMMIT_AUTHOR",
+		"GITHUB_WORKSPACE":  "HARNESS_WORKSPACE",
+		"GITHUB_JOB":        "HARNESS_STAGE_ID",
+		"GITHUB_HEAD_REF":   "DRONE_SOURCE_BRANCH",
+		"GITHUB_BASE_REF":   "DRONE_TARGET_BRANCH",
+		"GITHUB_EVENT_NAME": "DRONE_BUILD_EVENT",
+	},
+	Codefresh: {
+		"GITHUB_SHA":      "CF_REVISION",
+		"GITHUB_REF_NAME": "CF_BRANCH",
+		"GITHUB_RUN_ID":   "CF_BUILD_ID",
+		"GITHUB_ACTOR":    "CF_BUILD_INITIATOR",
+		"GITHUB_HEAD_REF": "CF_PULL_REQUEST_HEAD_BRANCH",
+		"GITHUB_BASE_REF": "CF_PULL_REQUEST_TARGET",
+	},
+	// Tekton tasks get these from Pipeline parameters
+	Tekton: {
+		"GITHUB_SHA":        "CI_COMMIT_SHA",
+		"GITHUB_REF_NAME":   "CI_COMMIT_BRANCH",
+		"GITHUB_HEAD_REF":   "CI_COMMIT_BRANCH",
+		"GITHUB_BASE_REF":   "CI_TARGET_BRANCH",
+		"GITHUB_WORKSPACE":  "CI_WORKSPACE",
+		"GITHUB_EVENT_NAME": "CI_EVENT",
+	},
+	// TeamCity, Bamboo and Travis are only read; scripts see these as
+	// environment variables
+	TeamCity: {
+		"GITHUB_SHA":        "BUILD_VCS_NUMBER",
+		"GITHUB_RUN_NUMBER": "BUILD_NUMBER",
+		"GITHUB_JOB":        "TEAMCITY_BUILDCONF_NAME",
+	},
+	Bamboo: {
+		"GITHUB_SHA":        "bamboo_planRepository_revision",
+		"GITHUB_REF_NAME":   "bamboo_planRepository_branchName",
+		"GITHUB_RUN_ID":     "bamboo_buildResultKey",
+		"GITHUB_RUN_NUMBER": "bamboo_buildNumber",
+		"GITHUB_WORKSPACE":  "bamboo_build_working_directory",
+		"GITHUB_JOB":        "bamboo_shortJobName",
+	},
+	Travis: {
+		"GITHUB_SHA":        "TRAVIS_COMMIT",
+		"GITHUB_REF_NAME":   "TRAVIS_BRANCH",
+		"GITHUB_RUN_ID":     "TRAVIS_BUILD_ID",
+		"GITHUB_RUN_NUMBER": "TRAVIS_BUILD_NUMBER",
+		"GITHUB_REPOSITORY": "TRAVIS_REPO_SLUG",
+		"GITHUB_WORKSPACE":  "TRAVIS_BUILD_DIR",
+		"GITHUB_HEAD_REF":   "TRAVIS_PULL_REQUEST_BRANCH",
+		"GITHUB_EVENT_NAME": "TRAVIS_EVENT_TYPE",
+		"GITHUB_JOB":        "TRAVIS_JOB_NAME",
+	},
+}
+
+// githubContexts maps github.* expressions to the runner variable holding
+// the same value
+var githubContexts = map[string]string{
+	"sha":        "GITHUB_SHA",
+	"ref":        "GITHUB_REF",
+	"ref_name":   "GITHUB_REF_NAME",
+	"run_id":     "GITHUB_RUN_ID",
+	"run_number": "GITHUB_RUN_NUMBER",
+	"repository": "GITHUB_REPOSITORY",
+	"actor":      "GITHUB_ACTOR",
+	"workspace":  "GITHUB_WORKSPACE",
+	"job":        "GITHUB_JOB",
+	"server_url": "GITHUB_SERVER_URL",
+	"head_ref":   "GITHUB_HEAD_REF",
+	"base_ref":   "GITHUB_BASE_REF",
+	"event_name": "GITHUB_EVENT_NAME",
+}
+
+// builtinPrefixes are the names of variables each platform provides itself
+var builtinPrefixes = map[Platform][]string{
+	GitLab:     {"CI_", "GITLAB_"},
+	CircleCI:   {"CIRCLE_"},
+	Bitbucket:  {"BITBUCKET_"},
+	Azure:      {"BUILD_", "SYSTEM_", "AGENT_", "PIPELINE_", "ENVIRONMENT_", "RESOURCES_"},
+	Jenkins:    {"BUILD_", "JOB_", "JENKINS_", "NODE_", "EXECUTOR_", "GIT_", "CHANGE_", "STAGE_NAME", "WORKSPACE"},
+	Drone:      {"DRONE_", "CI_"},
+	Woodpecker: {"CI_"},
+	Buildkite:  {"BUILDKITE", "CI"},
+	TeamCity:   {"TEAMCITY_", "BUILD_"},
+	Bamboo:     {"bamboo_"},
+	Travis:     {"TRAVIS_"},
+	Harness:    {"DRONE_", "HARNESS_", "CI_"},
+	Codefresh:  {"CF_"},
+	Tekton:     {"CI_"},
+}
+
+// fileCommands are the runner files GitHub steps write outputs and
+// environment to; the generators rewrite those commands themselves
+var fileCommands = map[string]bool{
+	"GITHUB_OUTPUT": true, "GITHUB_ENV": true, "GITHUB_PATH": true, "GITHUB_STEP_SUMMARY": true,
+}
+
+// shellVariables are set by the shell or the OS, not by the CI platform
+var shellVariables = map[string]bool{
+	"HOME": true, "PATH": true, "PWD": true, "USER": true, "SHELL": true, "TMPDIR": true,
+	"RANDOM": true, "HOSTNAME": true, "OLDPWD": true, "CI": true, "LANG": true, "TERM": true,
+	"IFS": true, "UID": true,
+}
+
+// secretSetups shows how to create a secret or variable on each platform
+var secretSetups = map[Platform]string{
+	GitHub:     "gh secret set %s",
+	GitLab:     "glab variable set %s --masked",
+	CircleCI:   "Project Settings → Environment Variables → %s",
+	Azure:      "az pipelines variable create --name %s --secret true",
+	Jenkins:    "Manage Jenkins → Credentials → %s",
+	Bitbucket:  "Repository settings → Repository variables → %s",
+	Drone:      "drone secret add --repository <owner/repo> --name %s --data <value>",
+	Woodpecker: "woodpecker-cli secret add --repository <owner/repo> --name %s --value <value>",
+	Buildkite:  "Cluster settings → Secrets → New Secret → %s",
+	Harness:    "Project Settings → Secrets → New Secret → Text → %s",
+	Codefresh:  "Pipeline settings → Variables → Add Variable → %s (encrypted)",
+	Tekton:     "kubectl create secret generic %s --from-literal=value=<value>",
+}
+
+// platformVariables are a platform's predefined variables by the GitHub
+// runner variable they match, from its driver if it has one
+func platformVariables(platform Platform) map[string]string {
+	if vars, ok := runnerVariables[platform]; ok {
+		return vars
+	}
+	return capabilities(platform).Variables
+}
+
+// secretSetup shows how to create a secret on a platform, with its name as
+// %s
+func secretSetup(platform Platform) string {
+	if setup, ok := secretSetups[platform]; ok {
+		return setup
+	}
+	return firstNonEmpty(capabilities(platform).Secrets, "add secret %s in the platform's settings")
+}
+
+func variableName(m []string) string {
+	if m[1] != "" {
+		return m[1]
+	}
+	return m[2]
+}
+
+// renameVariables renames $NAME and ${NAME} references, keeping the braces
+func renameVariables(s string, names map[string]string) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := variablePattern.FindStringSubmatch(ref)
+		to, ok := names[variableName(m)]
+		if !ok {
+			return ref
+		}
+		if m[1] != "" {
+			return "${" + to + "}"
+		}
+		return "$" + to
+	})
+}
+
+// convertRunnerVariables rewrites GitHub runner variables in a shell command
+func convertRunnerVariables(command string, target Platform) string {
+	return renameVariables(command, platformVariables(target))
+}
+
+// mapSourceVariables rewrites the source platform's predefined variables to
+// the GitHub runner variables of the normalized config (github.* expressions
+// in env: and with: values, which no shell expands), and collects the
+// variables the pipeline reads without defining them
+func mapSourceVariables(config *PipelineConfig, source Platform) {
+	if source == GitHub {
+		return
+	}
+	native := make(map[string]string)
+	for gh, name := range platformVariables(source) {
+		native[name] = gh
+	}
+	toGitHub := func(s string) string { return renameVariables(s, native) }
+	for i, job := range config.Jobs {
+		condition := job.Condition
+		job = mapJobStrings(job, toGitHub)
+		job.Condition = condition
+		config.Jobs[i] = githubEnvValues(job)
+	}
+	for k, v := range config.Environment {
+		config.Environment[k] = githubExpressions(toGitHub(v))
+	}
+	config.Variables = externalVariables(config, source)
+}
+
+// externalVariables lists the variables jobs read that neither the config
+// nor the scripts set: secrets and settings of the source platform.
+// Predefined variables without a GitHub equivalent are noted instead.
+func externalVariables(config *PipelineConfig, source Platform) []string {
+	external := make(map[string]string)
+	for _, job := range config.Jobs {
+		defined := make(map[string]bool)
+		for _, env := range []map[string]string{config.Environment, job.Environment} {
+			for k := range env {
+				defined[k] = true
+			}
+		}
+		if job.Container != nil {
+			for k := range job.Container.Env {
+				defined[k] = true
+			}
+		}
+		for _, step := range job.Steps {
+			for k := range step.Env {
+				defined[k] = true
+			}
+			for _, pattern := range []*regexp.Regexp{assignmentPattern, loopVariablePattern} {
+				for _, m := range pattern.FindAllStringSubmatch(step.Run, -1) {
+					defined[m[1]] = true
+				}
+			}
+		}
+
+		job.Condition = ""
+		mapJobStrings(job, func(s string) string {
+			for _, m := range variablePattern.FindAllStringSubmatch(s, -1) {
+				name := variableName(m)
+				switch {
+				case defined[name] || shellVariables[name] || !upperNamePattern.MatchString(name):
+				case strings.HasPrefix(name, "GITHUB_") || strings.HasPrefix(name, "RUNNER_"):
+				case isBuiltin(source, name):
+					config.note("job '%s' uses %s, which has no GitHub equivalent; review the converted command", job.Name, name)
+				default:
+					external[name] = ""
+				}
+			}
+			return s
+		})
+	}
+	return sortedKeys(external)
+}
+
+func isBuiltin(platform Platform, name string) bool {
+	for _, prefix := range append(builtinPrefixes[platform], capabilities(platform).VariablePrefixes...) {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerVariables rewrites variable references for the target: secrets and
+// vars expressions become the target's variable syntax, GitHub runner
+// variables its predefined ones. Each secret or variable the target has to
+// provide is listed as a finding. It returns the jobs and pipeline
+// environment to generate.
+func lowerVariables(config *PipelineConfig, target Platform) ([]Job, map[string]string) {
+	names := make(map[string]string)
+	for _, name := range config.Variables {
+		names[name] = ""
+	}
+	collect := func(s string) string {
+		for _, m := range settingRefPattern.FindAllStringSubmatch(s, -1) {
+			names[m[2]] = ""
+		}
+		return s
+	}
+	for _, v := range config.Environment {
+		collect(v)
+	}
+	for _, job := range config.Jobs {
+		mapJobStrings(job, collect)
+	}
+
+	env := copyStrings(config.Environment)
+	jobs := make([]Job, len(config.Jobs))
+	if target == GitHub {
+		// Variables the source platform injected have to come from secrets
+		for _, name := range config.Variables {
+			if _, ok := env[name]; !ok {
+				if env == nil {
+					env = make(map[string]string)
+				}
+				env[name] = fmt.Sprintf("${{ secrets.%s }}", name)
+			}
+		}
+		copy(jobs, config.Jobs)
+		listSecrets(config, target, names)
+		return jobs, env
+	}
+
+	lower := func(s string) string {
+		s = githubContextPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			if v, ok := githubContexts[githubContextPattern.FindStringSubmatch(ref)[1]]; ok {
+				return "$" + v
+			}
+			return ref
+		})
+		s = settingRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			return settingReference(config, settingRefPattern.FindStringSubmatch(ref)[2], target)
+		})
+		if target == Azure {
+			// Secret variables only reach scripts through macros
+			s = variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+				if name := variableName(variablePattern.FindStringSubmatch(ref)); containsString(config.Variables, name) {
+					return "$(" + name + ")"
+				}
+				return ref
+			})
+		}
+		return convertRunnerVariables(s, target)
+	}
+	for i, job := range config.Jobs {
+		condition := job.Condition
+		job = mapJobStrings(job, lower)
+		job.Condition = condition
+		unmapped := make(map[string]string)
+		mapJobStrings(job, func(s string) string {
+			for _, m := range runnerVariablePattern.FindAllStringSubmatch(s, -1) {
+				if _, secret := names[m[1]]; !secret && !fileCommands[m[1]] {
+					unmapped[m[1]] = ""
+				}
+			}
+			return s
+		})
+		for _, name := range sortedKeys(unmapped) {
+			config.note("job '%s' uses %s, which %s does not provide; review the converted command", job.Name, name, target)
+		}
+		jobs[i] = job
+	}
+
+	if target == Jenkins || target == Drone || target == Woodpecker || target == Buildkite || target == Harness || target == Tekton {
+		// Jenkins binds credentials to environment variables and Drone,
+		// Buildkite, Harness and Tekton steps read secrets into them; the
+		// generators write whole-value secret references as credentials(),
+		// from_secret, secrets:, Secret variables or secretKeyRef
+		for _, name := range sortedKeys(names) {
+			if _, ok := env[name]; ok {
+				continue
+			}
+			if env == nil {
+				env = make(map[string]string)
+			}
+			env[name] = fmt.Sprintf("${{ secrets.%s }}", name)
+		}
+	}
+	if target != Jenkins {
+		for k, v := range env {
+			if (target == Drone || target == Woodpecker || target == Buildkite || target == Harness || target == Tekton) && settingName(v) != "" {
+				continue
+			}
+			env[k] = lower(v)
+			if env[k] == settingReference(config, k, target) {
+				// Platform variables reach jobs without redefining them
+				delete(env, k)
+			}
+		}
+	}
+	listSecrets(config, target, names)
+	return jobs, env
+}
+
+// settingName returns the secret or variable a whole value refers to, or ""
+func settingName(v string) string {
+	if m := settingRefPattern.FindStringSubmatch(v); m != nil && m[0] == strings.TrimSpace(v) {
+		return m[2]
+	}
+	return ""
+}
+
+// settingReference is how the target reads a secret or variable
+func settingReference(config *PipelineConfig, name string, target Platform) string {
+	switch {
+	case target == GitLab && name == "GITHUB_TOKEN":
+		config.approximated("secrets", "GITHUB_TOKEN became $CI_JOB_TOKEN, which has the project's permissions on GitLab rather than GitHub's")
+		return "$CI_JOB_TOKEN"
+	case target == Azure:
+		return "$(" + name + ")"
+	}
+	return "$" + name
+}
+
+// listSecrets records a finding for each secret or variable the target
+// platform has to provide before the pipeline can run
+func listSecrets(config *PipelineConfig, target Platform, names map[string]string) {
+	for _, name := range sortedKeys(names) {
+		if target == GitLab && name == "GITHUB_TOKEN" {
+			continue
+		}
+		id := name
+		switch target {
+		case Jenkins:
+			id = jenkinsCredentialID(name)
+		case Tekton:
+			id = tektonSecretName(name)
+		}
+		config.record(NeedsReview, "secrets", "create %s on %s before running the pipeline: %s", name, target, fmt.Sprintf(secretSetup(target), id))
+	}
+}
+
+// jenkinsCredentialID is the credential ID the Jenkins output binds a
+// secret from
+func jenkinsCredentialID(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+}
+
+// githubExpressions rewrites runner variables in values GitHub does not
+// pass through a shell, such as env: and with:, to github.* expressions
+func githubExpressions(s string) string {
+	contexts := make(map[string]string, len(githubContexts))
+	for ctx, name := range githubContexts {
+		contexts[name] = ctx
+	}
+	return variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if ctx, ok := contexts[variableName(variablePattern.FindStringSubmatch(ref))]; ok {
+			return fmt.Sprintf("${{ github.%s }}", ctx)
+		}
+		return ref
+	})
+}
+
+// githubEnvValues applies githubExpressions to a job's env: and with: values
+func githubEnvValues(job Job) Job {
+	mapAll := func(m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		out := make(map[string]string, len(m))
+		for k, v := range m {
+			out[k] = githubExpressions(v)
+		}
+		return out
+	}
+	job.Environment = mapAll(job.Environment)
+	steps := make([]Step, len(job.Steps))
+	for i, step := range job.Steps {
+		step.Env = mapAll(step.Env)
+		step.With = mapAll(step.With)
+		steps[i] = step
+	}
+	job.Steps = steps
+	return job
+}
+
+// jenkinsEnvironment writes the pipeline environment block, binding whole
+// secret references to credentials
+func jenkinsEnvironment(sb *strings.Builder, env map[string]string) {
+	if len(env) == 0 {
+		return
+	}
+	sb.WriteString("    environment {\n")
+	for _, k := range sortedKeys(env) {
+		v := env[k]
+		if m := settingRefPattern.FindStringSubmatch(v); m != nil && m[0] == strings.TrimSpace(v) {
+			sb.WriteString(fmt.Sprintf("        %s = credentials('%s')\n", k, jenkinsCredentialID(m[2])))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("        %s = '%s'\n", k, escapeJenkinsString(v)))
+	}
+	sb.WriteString("    }\n\n")
+}
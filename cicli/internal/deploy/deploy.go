@@ -1,27 +1,163 @@
 package deploy
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
 	"time"
 
+	"cicli/internal/progress"
 	"cicli/internal/store"
+	"cicli/internal/term"
+
+	"gopkg.in/yaml.v3"
 )
 
-type Deployer struct{}
+type Deployer struct {
+	// KubeContext pins kubectl to a specific context; empty uses the current one
+	KubeContext string
+	// Cluster labels history records when deploying to several clusters
+	Cluster string
+	// LockMode selects how concurrent deployments are prevented (cluster, local, none)
+	LockMode string
+	// OverrideReason is recorded when a deploy freeze was bypassed
+	OverrideReason string
+	// PromotedFrom is recorded when the image was promoted from another environment
+	PromotedFrom string
+	// Commit is the git commit the image was built from
+	Commit string
+	// Service selects the workload of a multi-service project; it replaces the
+	// app name as the deployment and lock name and is recorded in history
+	Service string
+	// SkipHistory leaves recording the deploy to the caller, which records it
+	// as part of a larger run
+	SkipHistory bool
+}
 
 func NewDeployer() *Deployer {
 	return &Deployer{}
 }
 
+// ConfigureEKS points kubectl at an EKS cluster via the AWS CLI
+func (d *Deployer) ConfigureEKS(region, clusterName string) error {
+	if clusterName == "" {
+		return fmt.Errorf("deploy.cluster_name is required for the aws provider")
+	}
+
+	term.Printf("Configuring kubectl for EKS cluster %s...\n", clusterName)
+	args := []string{"eks", "update-kubeconfig", "--name", clusterName}
+	if region != "" {
+		args = append(args, "--region", region)
+	}
+	cmd := exec.Command("aws", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to update kubeconfig: %w", err)
+	}
+	return d.verifyContext(clusterName)
+}
+
+// ConfigureGKE points kubectl at a GKE cluster via the gcloud CLI
+func (d *Deployer) ConfigureGKE(project, location, clusterName string) error {
+	if clusterName == "" {
+		return fmt.Errorf("deploy.cluster_name is required for the gke provider")
+	}
+
+	term.Printf("Configuring kubectl for GKE cluster %s...\n", clusterName)
+	args := []string{"container", "clusters", "get-credentials", clusterName}
+	if location != "" {
+		args = append(args, "--location", location)
+	}
+	if project != "" {
+		args = append(args, "--project", project)
+	}
+	cmd := exec.Command("gcloud", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to get GKE credentials: %w", err)
+	}
+	return d.verifyContext(clusterName)
+}
+
+// ConfigureAKS points kubectl at an AKS cluster via the Azure CLI
+func (d *Deployer) ConfigureAKS(resourceGroup, clusterName string) error {
+	if clusterName == "" || resourceGroup == "" {
+		return fmt.Errorf("deploy.cluster_name and deploy.resource_group are required for the aks provider")
+	}
+
+	term.Printf("Configuring kubectl for AKS cluster %s...\n", clusterName)
+	cmd := exec.Command("az", "aks", "get-credentials", "--resource-group", resourceGroup, "--name", clusterName, "--overwrite-existing")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to get AKS credentials: %w", err)
+	}
+	return d.verifyContext(clusterName)
+}
+
+// verifyContext makes sure the current kubectl context refers to the expected cluster
+func (d *Deployer) verifyContext(clusterName string) error {
+	out, err := exec.Command("kubectl", "config", "current-context").Output()
+	if err != nil {
+		return fmt.Errorf("failed to read current kubectl context: %w", err)
+	}
+
+	current := strings.TrimSpace(string(out))
+	if !strings.Contains(current, clusterName) {
+		return fmt.Errorf("kubectl context %q does not match configured cluster %q", current, clusterName)
+	}
+
+	term.Printf("Using kubectl context: %s\n", current)
+	d.KubeContext = current
+	return nil
+}
+
+// kubectl builds a kubectl command bound to the deployer's context
+func (d *Deployer) kubectl(args ...string) *exec.Cmd {
+	if d.KubeContext != "" {
+		args = append([]string{"--context", d.KubeContext}, args...)
+	}
+	return exec.Command("kubectl", args...)
+}
+
+// workload is the deployment the deployer acts on: the service when one is
+// selected, otherwise the app
+func (d *Deployer) workload(appName string) string {
+	if d.Service != "" {
+		return d.Service
+	}
+	return appName
+}
+
 func (d *Deployer) DeployToK8s(manifestPath, imageName, appName, env string) error {
-	fmt.Printf("Deploying to Kubernetes (Env: %s)...\n", env)
+	term.Printf("Deploying to Kubernetes (Env: %s)...\n", env)
+
+	workload := d.workload(appName)
+
+	if err := d.AcquireLock(workload, env); err != nil {
+		return err
+	}
+	defer func() {
+		if err := d.ReleaseLock(workload, env); err != nil {
+			term.Printf("Warning: %v\n", err)
+		}
+	}()
 
 	status := "success"
 	var deployErr error
 
 	defer func() {
+		if d.SkipHistory {
+			return
+		}
 		// Record history
 		s, err := store.NewStore()
 		if err == nil {
@@ -29,20 +165,25 @@ func (d *Deployer) DeployToK8s(manifestPath, imageName, appName, env string) err
 				status = "failed"
 			}
 			_ = s.Add(store.Deployment{
-				ID:        fmt.Sprintf("%d", time.Now().Unix()),
-				Timestamp: time.Now(),
-				Project:   appName,
-				Env:       env,
-				Image:     imageName,
-				Status:    status,
+				ID:           fmt.Sprintf("%d", time.Now().Unix()),
+				Timestamp:    time.Now(),
+				Project:      appName,
+				Service:      d.Service,
+				Env:          env,
+				Image:        imageName,
+				Status:       status,
+				Cluster:      d.Cluster,
+				Override:     d.OverrideReason,
+				PromotedFrom: d.PromotedFrom,
+				Commit:       d.Commit,
 			})
-			fmt.Println("Deployment recorded in history.")
+			term.Println("Deployment recorded in history.")
 		}
 	}()
 
 	// 1. Apply manifest
-	fmt.Printf("Applying manifest: %s\n", manifestPath)
-	applyCmd := exec.Command("kubectl", "apply", "-f", manifestPath)
+	term.Printf("Applying manifest: %s\n", manifestPath)
+	applyCmd := d.kubectl("apply", "-f", manifestPath)
 	applyCmd.Stdout = os.Stdout
 	applyCmd.Stderr = os.Stderr
 	if err := applyCmd.Run(); err != nil {
@@ -51,8 +192,8 @@ func (d *Deployer) DeployToK8s(manifestPath, imageName, appName, env string) err
 	}
 
 	// 2. Set image
-	fmt.Printf("Updating image for deployment/%s to %s\n", appName, imageName)
-	setImageCmd := exec.Command("kubectl", "set", "image", fmt.Sprintf("deployment/%s", appName), fmt.Sprintf("%s=%s", appName, imageName))
+	term.Printf("Updating image for deployment/%s to %s\n", workload, imageName)
+	setImageCmd := d.kubectl("set", "image", fmt.Sprintf("deployment/%s", workload), fmt.Sprintf("%s=%s", workload, imageName))
 	setImageCmd.Stdout = os.Stdout
 	setImageCmd.Stderr = os.Stderr
 	if err := setImageCmd.Run(); err != nil {
@@ -61,11 +202,8 @@ func (d *Deployer) DeployToK8s(manifestPath, imageName, appName, env string) err
 	}
 
 	// 3. Rollout status
-	fmt.Printf("Waiting for rollout status...\n")
-	rolloutCmd := exec.Command("kubectl", "rollout", "status", fmt.Sprintf("deployment/%s", appName))
-	rolloutCmd.Stdout = os.Stdout
-	rolloutCmd.Stderr = os.Stderr
-	if err := rolloutCmd.Run(); err != nil {
+	rolloutCmd := d.kubectl("rollout", "status", fmt.Sprintf("deployment/%s", workload))
+	if err := progress.RunCommand(rolloutCmd, fmt.Sprintf("Waiting for deployment/%s rollout", workload)); err != nil {
 		deployErr = err
 		return deployErr
 	}
@@ -73,8 +211,10 @@ func (d *Deployer) DeployToK8s(manifestPath, imageName, appName, env string) err
 	return nil
 }
 
-func (d *Deployer) Rollback(appName, env string) error {
-	fmt.Printf("Initiating rollback for %s (Env: %s)...\n", appName, env)
+// Rollback redeploys the image of the deployment before the current one of
+// the app or selected service, applying manifestPath first
+func (d *Deployer) Rollback(appName, env, manifestPath string) error {
+	term.Printf("Initiating rollback for %s (Env: %s)...\n", d.workload(appName), env)
 
 	s, err := store.NewStore()
 	if err != nil {
@@ -86,52 +226,296 @@ func (d *Deployer) Rollback(appName, env string) error {
 		return fmt.Errorf("failed to load history: %w", err)
 	}
 
-	// Find the last successful deployment for this app and env
-	// We need to skip the *current* deployment if it was successful (which is unlikely if we are rolling back,
-	// but if we are rolling back a bad deployment, the bad one might be 'failed' or 'success' but buggy).
-	// Strategy: Find the most recent 'success' that is NOT the latest deployment if the latest is also 'success'.
-	// Actually, simpler strategy for v2: Find the most recent 'success' that isn't the one we just did.
-	// But to be safe, let's just look for the last successful deployment that has a different image than the current state?
-	// For simplicity in this CLI: Just find the last successful deployment. If the user just deployed a bad version,
-	// it likely failed or they are manually rolling back.
-
+	// The newest success for this app, service, env and cluster is what is
+	// running now, so roll back to the success before it
 	var targetDeployment *store.Deployment
-
-	// Iterate backwards
+	skippedCurrent := false
 	for i := len(deployments) - 1; i >= 0; i-- {
 		dep := deployments[i]
-		if dep.Project == appName && dep.Env == env && dep.Status == "success" {
-			// Found a candidate.
-			// In a real system we might check if this is the *current* running version.
-			// Here we assume the user wants the *previous* one.
-			// So if the last entry is success, we might want the one before it?
-			// Let's assume the user runs rollback because the *current* state is bad.
-			// So we want the *latest successful* deployment.
-			// Wait, if the bad deployment failed, then the latest success IS the stable one.
-			// If the bad deployment succeeded (but is buggy), then the latest success IS the bad one.
-			// We need to find the success *before* the current head if the head is success.
-
-			// Let's keep it simple: List the last 5 successes and ask user?
-			// Or just take the last success.
-			// If the latest deployment in history is 'failed', take the last 'success'.
-			// If the latest deployment in history is 'success', take the *previous* 'success'.
-
-			isLatest := (i == len(deployments)-1)
-			if isLatest {
-				continue // Skip the very latest if it's success (assume it's the buggy one we want to revert)
-			}
-
-			targetDeployment = &dep
-			break
+		if d.Cluster != "" && dep.Cluster != d.Cluster {
+			continue
+		}
+		if dep.Project != appName || dep.Service != d.Service || dep.Env != env || dep.Status != "success" {
+			continue
+		}
+		if !skippedCurrent {
+			skippedCurrent = true
+			continue
 		}
+		targetDeployment = &dep
+		break
 	}
 
 	if targetDeployment == nil {
 		return fmt.Errorf("no stable deployment found to rollback to")
 	}
 
-	fmt.Printf("Rolling back to version: %s (Image: %s)\n", targetDeployment.Timestamp.Format(time.RFC3339), targetDeployment.Image)
+	term.Printf("Rolling back to version: %s (Image: %s)\n", targetDeployment.Timestamp.Format(time.RFC3339), targetDeployment.Image)
 
 	// Perform deployment
-	return d.DeployToK8s("k8s/deployment.yaml", targetDeployment.Image, appName, env)
+	return d.DeployToK8s(manifestPath, targetDeployment.Image, appName, env)
+}
+
+// Logs streams logs from all pods belonging to the app or selected service
+func (d *Deployer) Logs(appName, env, since string, follow bool) error {
+	workload := d.workload(appName)
+	term.Printf("Fetching logs for %s (Env: %s)...\n", workload, env)
+
+	args := []string{"logs", "-l", fmt.Sprintf("app=%s", workload), "--all-containers", "--prefix"}
+	if since != "" {
+		args = append(args, fmt.Sprintf("--since=%s", since))
+	}
+	if follow {
+		args = append(args, "--follow", "--max-log-requests=10")
+	}
+
+	cmd := d.kubectl(args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to fetch logs: %w", err)
+	}
+	return nil
+}
+
+// Event is a Kubernetes event related to the app
+type Event struct {
+	Type    string
+	Reason  string
+	Object  string
+	Message string
+	Time    time.Time
+}
+
+// AppStatus describes the live state of a deployed app
+type AppStatus struct {
+	App           string
+	Env           string
+	Replicas      int
+	ReadyReplicas int
+	Images        []string
+	LastDeploy    *store.Deployment
+	Events        []Event
+}
+
+// Status collects replica, image and event information for the app or
+// selected service
+func (d *Deployer) Status(appName, env string) (*AppStatus, error) {
+	workload := d.workload(appName)
+	status := &AppStatus{App: workload, Env: env}
+
+	out, err := d.kubectl("get", "deployment", workload, "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment/%s: %w", workload, err)
+	}
+
+	var dep struct {
+		Spec struct {
+			Replicas int `json:"replicas"`
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Image string `json:"image"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+		Status struct {
+			ReadyReplicas int `json:"readyReplicas"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &dep); err != nil {
+		return nil, fmt.Errorf("failed to parse deployment: %w", err)
+	}
+
+	status.Replicas = dep.Spec.Replicas
+	status.ReadyReplicas = dep.Status.ReadyReplicas
+	for _, c := range dep.Spec.Template.Spec.Containers {
+		status.Images = append(status.Images, c.Image)
+	}
+
+	if s, err := store.NewStore(); err == nil {
+		status.LastDeploy, _ = s.Last(appName, d.Service, env)
+	}
+
+	status.Events = d.recentEvents(workload)
+	return status, nil
+}
+
+// recentEvents returns the latest events for a deployment, its replica sets and pods
+func (d *Deployer) recentEvents(workload string) []Event {
+	out, err := d.kubectl("get", "events", "-o", "json").Output()
+	if err != nil {
+		return nil
+	}
+
+	var list struct {
+		Items []struct {
+			Type           string    `json:"type"`
+			Reason         string    `json:"reason"`
+			Message        string    `json:"message"`
+			LastTimestamp  time.Time `json:"lastTimestamp"`
+			InvolvedObject struct {
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+			} `json:"involvedObject"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil
+	}
+
+	var events []Event
+	for _, item := range list.Items {
+		if !strings.HasPrefix(item.InvolvedObject.Name, workload) {
+			continue
+		}
+		events = append(events, Event{
+			Type:    item.Type,
+			Reason:  item.Reason,
+			Object:  fmt.Sprintf("%s/%s", strings.ToLower(item.InvolvedObject.Kind), item.InvolvedObject.Name),
+			Message: item.Message,
+			Time:    item.LastTimestamp,
+		})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+	if len(events) > 10 {
+		events = events[:10]
+	}
+	return events
+}
+
+// PrintReport outputs a formatted status report
+func (s *AppStatus) PrintReport() {
+	term.Printf("\n📡 Status: %s (Env: %s)\n", s.App, s.Env)
+	term.Println(strings.Repeat("─", 50))
+
+	icon := "✅"
+	if s.ReadyReplicas < s.Replicas {
+		icon = "⚠️"
+	}
+	term.Printf("   Replicas: %s %d/%d ready\n", icon, s.ReadyReplicas, s.Replicas)
+	for _, image := range s.Images {
+		term.Printf("   Image:    %s\n", image)
+	}
+
+	if s.LastDeploy != nil {
+		term.Printf("\n   Last deploy: %s (%s)\n", s.LastDeploy.Timestamp.Format("2006-01-02 15:04"), s.LastDeploy.Status)
+		term.Printf("   Deployed image: %s\n", s.LastDeploy.Image)
+	} else {
+		term.Println("\n   Last deploy: no history recorded")
+	}
+
+	if len(s.Events) > 0 {
+		term.Println("\n   Recent events:")
+		for _, e := range s.Events {
+			term.Printf("      %s %-8s %-20s %s: %s\n", e.Time.Format("15:04:05"), e.Type, e.Reason, e.Object, e.Message)
+		}
+	}
+
+	term.Println()
+}
+
+// ContainerPort finds the first containerPort of the app's Deployment in the manifest
+func (d *Deployer) ContainerPort(manifestPath, appName string) (int, error) {
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	for {
+		var doc struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name string `yaml:"name"`
+			} `yaml:"metadata"`
+			Spec struct {
+				Template struct {
+					Spec struct {
+						Containers []struct {
+							Ports []struct {
+								ContainerPort int `yaml:"containerPort"`
+							} `yaml:"ports"`
+						} `yaml:"containers"`
+					} `yaml:"spec"`
+				} `yaml:"template"`
+			} `yaml:"spec"`
+		}
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+
+		if doc.Kind != "Deployment" || (appName != "" && doc.Metadata.Name != appName) {
+			continue
+		}
+		for _, c := range doc.Spec.Template.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.ContainerPort > 0 {
+					return p.ContainerPort, nil
+				}
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("no containerPort found for deployment/%s in %s", appName, manifestPath)
+}
+
+// PortForward forwards a local port to the deployment of the app or selected
+// service, reconnecting when the tunnel drops
+func (d *Deployer) PortForward(appName, env string, localPort, remotePort int) error {
+	workload := d.workload(appName)
+	term.Printf("Forwarding localhost:%d → deployment/%s:%d (Env: %s)\n", localPort, workload, remotePort, env)
+	term.Println("Press Ctrl+C to stop.")
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	backoff := time.Second
+	for {
+		cmd := d.kubectl("port-forward", fmt.Sprintf("deployment/%s", workload), fmt.Sprintf("%d:%d", localPort, remotePort))
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		started := time.Now()
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start port-forward: %w", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+
+		select {
+		case <-interrupt:
+			_ = cmd.Process.Kill()
+			<-done
+			term.Println("\nPort-forward stopped.")
+			return nil
+		case err := <-done:
+			// A tunnel that stayed up for a while was healthy; start over with a short delay
+			if time.Since(started) > 30*time.Second {
+				backoff = time.Second
+			}
+			term.Printf("Port-forward exited (%v), reconnecting in %s...\n", err, backoff)
+		}
+
+		select {
+		case <-interrupt:
+			term.Println("\nPort-forward stopped.")
+			return nil
+		case <-time.After(backoff):
+		}
+
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
 }
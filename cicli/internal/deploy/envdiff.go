@@ -0,0 +1,248 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"cicli/internal/term"
+)
+
+// EnvState is what is deployed to one environment, combining the live
+// Deployment with the last successful deploy in history
+type EnvState struct {
+	Env      string
+	Cluster  string
+	Image    string // image of the Deployment spec
+	Digest   string // digest the pods are running
+	Commit   string
+	Deployed time.Time
+	Replicas int
+	EnvVars  map[string]string
+	Err      error // set when the cluster could not be read
+}
+
+var shaTagPattern = regexp.MustCompile(`:([0-9a-f]{7,40})$`)
+
+// EnvState reads the app's Deployment and running digest. History fills in
+// the commit and deploy time, and stands in for the image when the cluster
+// is unreachable.
+func (d *Deployer) EnvState(appName, env string) *EnvState {
+	state := &EnvState{Env: env, Cluster: d.Cluster, EnvVars: make(map[string]string)}
+
+	if last, err := LastSuccessful(appName, env, d.Cluster); err == nil && last != nil {
+		state.Image = last.Image
+		state.Commit = last.Commit
+		state.Deployed = last.Timestamp
+	}
+
+	out, err := d.kubectl("get", "deployment", appName, "-o", "json").Output()
+	if err != nil {
+		state.Err = fmt.Errorf("failed to get deployment/%s: %w", appName, err)
+		return state
+	}
+
+	var dep struct {
+		Spec struct {
+			Replicas int `json:"replicas"`
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Name  string `json:"name"`
+						Image string `json:"image"`
+						Env   []struct {
+							Name      string          `json:"name"`
+							Value     string          `json:"value"`
+							ValueFrom json.RawMessage `json:"valueFrom"`
+						} `json:"env"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(out, &dep); err != nil {
+		state.Err = fmt.Errorf("failed to parse deployment: %w", err)
+		return state
+	}
+
+	state.Replicas = dep.Spec.Replicas
+	for _, c := range dep.Spec.Template.Spec.Containers {
+		if c.Name != appName && len(dep.Spec.Template.Spec.Containers) > 1 {
+			continue
+		}
+		state.Image = c.Image
+		for _, e := range c.Env {
+			value := e.Value
+			if len(e.ValueFrom) > 0 {
+				value = valueSource(e.ValueFrom)
+			}
+			state.EnvVars[e.Name] = value
+		}
+	}
+
+	if digest, err := d.RunningImage(appName); err == nil {
+		state.Digest = digest[strings.Index(digest, "@")+1:]
+	}
+	if state.Commit == "" {
+		// Pipelines generated by cicli tag images with the short commit SHA
+		if m := shaTagPattern.FindStringSubmatch(state.Image); m != nil {
+			state.Commit = m[1]
+		}
+	}
+	return state
+}
+
+// valueSource describes a valueFrom reference without resolving it, so
+// secret values never end up in the terminal
+func valueSource(raw json.RawMessage) string {
+	var from map[string]struct {
+		Name string `json:"name"`
+		Key  string `json:"key"`
+	}
+	if err := json.Unmarshal(raw, &from); err != nil {
+		return "(ref)"
+	}
+	for kind, ref := range from {
+		return fmt.Sprintf("(%s %s/%s)", kind, ref.Name, ref.Key)
+	}
+	return "(ref)"
+}
+
+// PrintEnvDiff prints environments side by side and marks rows that differ
+func PrintEnvDiff(appName string, states []*EnvState) {
+	term.Printf("\n🔀 Environments of %s\n", appName)
+
+	header := []string{""}
+	for _, s := range states {
+		name := s.Env
+		if s.Cluster != "" {
+			name += " (" + s.Cluster + ")"
+		}
+		header = append(header, name)
+	}
+
+	rows := [][]string{header}
+	add := func(label string, value func(*EnvState) string) {
+		row := []string{label}
+		for _, s := range states {
+			v := value(s)
+			if v == "" {
+				v = "-"
+			}
+			row = append(row, v)
+		}
+		rows = append(rows, row)
+	}
+
+	add("Image", func(s *EnvState) string { return s.Image })
+	add("Digest", func(s *EnvState) string { return shortDigest(s.Digest) })
+	add("Commit", func(s *EnvState) string { return s.Commit })
+	add("Deployed", func(s *EnvState) string {
+		if s.Deployed.IsZero() {
+			return ""
+		}
+		return s.Deployed.Format("2006-01-02 15:04")
+	})
+	add("Replicas", func(s *EnvState) string {
+		if s.Err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%d", s.Replicas)
+	})
+
+	names := make(map[string]bool)
+	for _, s := range states {
+		for name := range s.EnvVars {
+			names[name] = true
+		}
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		add("$"+name, func(s *EnvState) string {
+			if s.Err != nil {
+				return ""
+			}
+			v, ok := s.EnvVars[name]
+			if !ok {
+				return "(unset)"
+			}
+			return truncate(v, 30)
+		})
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	term.Println(strings.Repeat("─", 50))
+	drift := 0
+	for r, row := range rows {
+		marker := "  "
+		if r > 0 && differs(row[1:]) {
+			marker = "≠ "
+			drift++
+		}
+		var sb strings.Builder
+		sb.WriteString("   " + marker)
+		for i, cell := range row {
+			sb.WriteString(cell + strings.Repeat(" ", widths[i]-len([]rune(cell))+2))
+		}
+		term.Println(strings.TrimRight(sb.String(), " "))
+	}
+
+	term.Println()
+	for _, s := range states {
+		if s.Err != nil {
+			term.Printf("   ⚠️  %s: %v (showing history only)\n", s.Env, s.Err)
+		}
+	}
+	if drift > 0 {
+		term.Printf("   %d row(s) differ between environments (marked ≠)\n", drift)
+	} else {
+		term.Println("   ✅ No drift between environments")
+	}
+	term.Println()
+}
+
+// differs reports whether a row has different values across environments,
+// ignoring "-" cells of environments with nothing to show
+func differs(cells []string) bool {
+	first := ""
+	for _, c := range cells {
+		if c == "-" {
+			continue
+		}
+		if first == "" {
+			first = c
+		} else if c != first {
+			return true
+		}
+	}
+	return false
+}
+
+func shortDigest(digest string) string {
+	if strings.HasPrefix(digest, "sha256:") && len(digest) > 19 {
+		return digest[:19]
+	}
+	return digest
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
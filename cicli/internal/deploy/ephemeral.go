@@ -0,0 +1,162 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"cicli/internal/progress"
+	"cicli/internal/store"
+	"cicli/internal/term"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EphemeralLabel marks namespaces created by `cicli env create`
+const EphemeralLabel = "cicli.dev/ephemeral"
+
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// EphemeralNamespace returns a valid namespace name (DNS-1123 label) for
+// an ephemeral environment of project
+func EphemeralNamespace(project, name string) string {
+	ns := invalidLabelChars.ReplaceAllString(strings.ToLower(project+"-"+name), "-")
+	ns = strings.Trim(ns, "-")
+	if len(ns) > 63 {
+		ns = strings.TrimRight(ns[:63], "-")
+	}
+	return ns
+}
+
+// CreateEphemeral deploys the project manifests into the environment's own
+// namespace and, when env.Host is set, exposes the app through an Ingress
+func (d *Deployer) CreateEphemeral(manifestPath, appName, ingressClass string, env *store.Environment) error {
+	term.Printf("Creating environment %s in namespace %s...\n", env.Name, env.Namespace)
+
+	namespace := fmt.Sprintf(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: %s
+  labels:
+    %s: "true"
+    app.kubernetes.io/managed-by: cicli
+  annotations:
+    cicli.dev/expires-at: "%s"
+`, env.Namespace, EphemeralLabel, env.ExpiresAt.Format(time.RFC3339))
+	if err := d.applyStdin(namespace); err != nil {
+		return fmt.Errorf("failed to create namespace: %w", err)
+	}
+
+	term.Printf("Applying manifest: %s\n", manifestPath)
+	apply := d.kubectl("apply", "-n", env.Namespace, "-f", manifestPath)
+	apply.Stdout = os.Stdout
+	apply.Stderr = os.Stderr
+	if err := apply.Run(); err != nil {
+		return fmt.Errorf("failed to apply manifest: %w", err)
+	}
+
+	setImage := d.kubectl("set", "image", "-n", env.Namespace, fmt.Sprintf("deployment/%s", appName), fmt.Sprintf("%s=%s", appName, env.Image))
+	setImage.Stdout = os.Stdout
+	setImage.Stderr = os.Stderr
+	if err := setImage.Run(); err != nil {
+		return fmt.Errorf("failed to set image: %w", err)
+	}
+
+	if env.Host != "" {
+		port, err := servicePort(manifestPath, appName)
+		if err != nil {
+			return err
+		}
+		class := ""
+		if ingressClass != "" {
+			class = "\n  ingressClassName: " + ingressClass
+		}
+		ingress := fmt.Sprintf(`apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: %s
+  namespace: %s
+  labels:
+    app.kubernetes.io/managed-by: cicli
+spec:%s
+  rules:
+    - host: %s
+      http:
+        paths:
+          - path: /
+            pathType: Prefix
+            backend:
+              service:
+                name: %s
+                port:
+                  number: %d
+`, appName, env.Namespace, class, env.Host, appName, port)
+		if err := d.applyStdin(ingress); err != nil {
+			return fmt.Errorf("failed to create ingress: %w", err)
+		}
+	}
+
+	rollout := d.kubectl("rollout", "status", "-n", env.Namespace, fmt.Sprintf("deployment/%s", appName))
+	return progress.RunCommand(rollout, fmt.Sprintf("Waiting for deployment/%s rollout", appName))
+}
+
+// DestroyEphemeral deletes the environment's namespace and everything in it
+func (d *Deployer) DestroyEphemeral(namespace string) error {
+	term.Printf("Deleting namespace %s...\n", namespace)
+	cmd := d.kubectl("delete", "namespace", namespace, "--ignore-not-found", "--wait=false")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to delete namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// applyStdin applies a manifest passed as a string
+func (d *Deployer) applyStdin(manifest string) error {
+	cmd := d.kubectl("apply", "-f", "-")
+	cmd.Stdin = strings.NewReader(manifest)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// servicePort finds the port of the app's Service in the manifest, falling
+// back to the Deployment's containerPort
+func servicePort(manifestPath, appName string) (int, error) {
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	for {
+		var doc struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name string `yaml:"name"`
+			} `yaml:"metadata"`
+			Spec struct {
+				Ports []struct {
+					Port int `yaml:"port"`
+				} `yaml:"ports"`
+			} `yaml:"spec"`
+		}
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if doc.Kind == "Service" && doc.Metadata.Name == appName && len(doc.Spec.Ports) > 0 {
+			return doc.Spec.Ports[0].Port, nil
+		}
+	}
+
+	return NewDeployer().ContainerPort(manifestPath, appName)
+}
@@ -0,0 +1,186 @@
+package deploy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"cicli/internal/store"
+	"cicli/internal/term"
+)
+
+// LockInfo identifies who holds a deployment lock
+type LockInfo struct {
+	Holder   string    `json:"holder"`
+	Host     string    `json:"host"`
+	Acquired time.Time `json:"acquired"`
+}
+
+// LockHeldError is returned when another deployment owns the lock
+type LockHeldError struct {
+	Name string
+	Info LockInfo
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("deployment locked by %s@%s since %s (%s ago); rerun with --force-unlock if the lock is stale",
+		e.Info.Holder, e.Info.Host, e.Info.Acquired.Format(time.RFC3339), time.Since(e.Info.Acquired).Round(time.Second))
+}
+
+var lockNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// lockName returns a DNS-1123 compatible name for the app/env lock. Local
+// locks pass the cluster too, since they share one directory across the
+// clusters of an env. Names cut to 63 characters end in a hash of the full
+// name so that long names differing only at the end stay distinct.
+func lockName(appName, env, cluster string) string {
+	name := fmt.Sprintf("cicli-lock-%s-%s", appName, env)
+	if cluster != "" {
+		name += "-" + cluster
+	}
+	name = strings.ToLower(name)
+	name = lockNameInvalid.ReplaceAllString(name, "-")
+	if len(name) > 63 {
+		sum := sha256.Sum256([]byte(name))
+		name = strings.TrimRight(name[:54], "-") + "-" + hex.EncodeToString(sum[:])[:8]
+	}
+	return strings.TrimRight(name, "-")
+}
+
+func currentLockInfo() LockInfo {
+	info := LockInfo{Holder: "unknown", Host: "unknown", Acquired: time.Now().UTC()}
+	if u, err := user.Current(); err == nil {
+		info.Holder = u.Username
+	}
+	if h, err := os.Hostname(); err == nil {
+		info.Host = h
+	}
+	return info
+}
+
+// AcquireLock takes the deployment lock for appName/env. Lock modes are
+// "cluster" (a ConfigMap in the target cluster), "local" (a file under
+// locks in the cicli data directory) and "none".
+func (d *Deployer) AcquireLock(appName, env string) error {
+	switch d.LockMode {
+	case "none":
+		return nil
+	case "local":
+		return d.acquireLocalLock(appName, env)
+	default:
+		return d.acquireClusterLock(appName, env)
+	}
+}
+
+// ReleaseLock releases a lock previously taken with AcquireLock
+func (d *Deployer) ReleaseLock(appName, env string) error {
+	switch d.LockMode {
+	case "none":
+		return nil
+	case "local":
+		path, err := localLockPath(lockName(appName, env, d.Cluster))
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to release lock: %w", err)
+		}
+		return nil
+	default:
+		var stderr bytes.Buffer
+		cmd := d.kubectl("delete", "configmap", lockName(appName, env, ""), "--ignore-not-found")
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to release lock: %s", strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+}
+
+// ForceUnlock removes the lock of the app or selected service regardless of
+// who holds it
+func (d *Deployer) ForceUnlock(appName, env string) error {
+	workload := d.workload(appName)
+	term.Printf("Force-releasing deployment lock for %s (Env: %s)\n", workload, env)
+	return d.ReleaseLock(workload, env)
+}
+
+func (d *Deployer) acquireClusterLock(appName, env string) error {
+	name := lockName(appName, env, "")
+	info := currentLockInfo()
+
+	var stderr bytes.Buffer
+	cmd := d.kubectl("create", "configmap", name,
+		"--from-literal=holder="+info.Holder,
+		"--from-literal=host="+info.Host,
+		"--from-literal=acquired="+info.Acquired.Format(time.RFC3339))
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		return nil
+	}
+
+	if !strings.Contains(stderr.String(), "AlreadyExists") {
+		return fmt.Errorf("failed to acquire lock: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	out, err := d.kubectl("get", "configmap", name, "-o", "json").Output()
+	if err != nil {
+		return &LockHeldError{Name: name}
+	}
+
+	var cm struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(out, &cm); err != nil {
+		return &LockHeldError{Name: name}
+	}
+
+	held := LockInfo{Holder: cm.Data["holder"], Host: cm.Data["host"]}
+	held.Acquired, _ = time.Parse(time.RFC3339, cm.Data["acquired"])
+	return &LockHeldError{Name: name, Info: held}
+}
+
+func localLockPath(name string) (string, error) {
+	dir, err := store.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	lockDir := filepath.Join(dir, "locks")
+	if err := os.MkdirAll(lockDir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(lockDir, name+".json"), nil
+}
+
+func (d *Deployer) acquireLocalLock(appName, env string) error {
+	name := lockName(appName, env, d.Cluster)
+	path, err := localLockPath(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if !os.IsExist(err) {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		held := LockInfo{}
+		if data, err := os.ReadFile(path); err == nil {
+			_ = json.Unmarshal(data, &held)
+		}
+		return &LockHeldError{Name: name, Info: held}
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(currentLockInfo())
+}
@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cicli/internal/store"
+)
+
+// HasDigest reports whether an image reference is pinned to a digest
+func HasDigest(image string) bool {
+	return strings.Contains(image, "@sha256:")
+}
+
+// RunningImage returns the digest-pinned image the app's pods are running.
+// The digest comes from the container status, so it is the exact image
+// the node pulled even when the Deployment refers to a tag.
+func (d *Deployer) RunningImage(appName string) (string, error) {
+	out, err := d.kubectl("get", "pods", "-l", fmt.Sprintf("app=%s", appName), "-o", "json").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list pods of %s: %w", appName, err)
+	}
+
+	var pods struct {
+		Items []struct {
+			Status struct {
+				Phase             string `json:"phase"`
+				ContainerStatuses []struct {
+					Name    string `json:"name"`
+					Image   string `json:"image"`
+					ImageID string `json:"imageID"`
+					Ready   bool   `json:"ready"`
+				} `json:"containerStatuses"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &pods); err != nil {
+		return "", fmt.Errorf("failed to parse pods: %w", err)
+	}
+
+	images := make(map[string]bool)
+	var image string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != "Running" {
+			continue
+		}
+		for _, c := range pod.Status.ContainerStatuses {
+			if c.Name != appName || !c.Ready {
+				continue
+			}
+			ref := pinnedImage(c.Image, c.ImageID)
+			if ref != "" && !images[ref] {
+				images[ref] = true
+				image = ref
+			}
+		}
+	}
+
+	switch len(images) {
+	case 0:
+		return "", fmt.Errorf("no ready pods of %s report an image digest", appName)
+	case 1:
+		return image, nil
+	}
+	return "", fmt.Errorf("pods of %s run %d different images (rollout in progress?)", appName, len(images))
+}
+
+// pinnedImage combines the image repository with the digest from imageID,
+// which looks like docker-pullable://repo@sha256:... depending on the runtime
+func pinnedImage(image, imageID string) string {
+	at := strings.Index(imageID, "@sha256:")
+	if at < 0 {
+		if HasDigest(image) {
+			return image
+		}
+		return ""
+	}
+
+	repo := image
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	} else if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	return repo + imageID[at:]
+}
+
+// LastSuccessful returns the latest successful deployment of the app to env
+// recorded in history, or nil when there is none
+func LastSuccessful(appName, env, cluster string) (*store.Deployment, error) {
+	s, err := store.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	deployments, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(deployments) - 1; i >= 0; i-- {
+		dep := deployments[i]
+		if dep.Project != appName || dep.Env != env || dep.Status != "success" {
+			continue
+		}
+		if cluster != "" && dep.Cluster != "" && dep.Cluster != cluster {
+			continue
+		}
+		return &dep, nil
+	}
+	return nil, nil
+}
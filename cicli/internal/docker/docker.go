@@ -2,9 +2,10 @@ package docker
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
 	"strings"
+
+	"cicli/internal/progress"
 )
 
 type Client struct{}
@@ -14,19 +15,50 @@ func NewClient() *Client {
 }
 
 func (c *Client) Build(imageName, context, dockerfile string) error {
-	fmt.Printf("Building Docker image: %s\n", imageName)
 	cmd := exec.Command("docker", "build", "-t", imageName, "-f", dockerfile, context)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return progress.RunCommand(cmd, fmt.Sprintf("Building Docker image: %s", imageName))
 }
 
 func (c *Client) Push(imageName string) error {
-	fmt.Printf("Pushing Docker image: %s\n", imageName)
 	cmd := exec.Command("docker", "push", imageName)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return progress.RunCommand(cmd, fmt.Sprintf("Pushing Docker image: %s", imageName))
+}
+
+// Digest returns the digest-pinned reference of a pushed image, e.g.
+// registry.example.com/app@sha256:...
+func (c *Client) Digest(imageName string) (string, error) {
+	out, err := exec.Command("docker", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", imageName).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect %s: %w", imageName, err)
+	}
+
+	repo := imageName
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	for _, ref := range strings.Fields(string(out)) {
+		if strings.HasPrefix(ref, repo+"@") {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("%s has no digest for %s; was it pushed?", imageName, repo)
+}
+
+// Scan checks an image for high and critical vulnerabilities with trivy, or
+// grype when trivy is not installed. scanned is false when neither is.
+func (c *Client) Scan(imageName string) (scanned bool, err error) {
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("trivy"); err == nil {
+		cmd = exec.Command("trivy", "image", "--exit-code", "1", "--severity", "HIGH,CRITICAL", "--no-progress", imageName)
+	} else if _, err := exec.LookPath("grype"); err == nil {
+		cmd = exec.Command("grype", imageName, "--fail-on", "high")
+	} else {
+		return false, nil
+	}
+	if err := progress.RunCommand(cmd, fmt.Sprintf("Scanning Docker image: %s", imageName)); err != nil {
+		return true, fmt.Errorf("vulnerability scan failed: %w", err)
+	}
+	return true, nil
 }
 
 func (c *Client) GetGitSHA() (string, error) {
@@ -0,0 +1,245 @@
+package freeze
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cicli/internal/httpclient"
+)
+
+// Window is a recurring freeze that starts on a cron schedule and lasts Duration
+type Window struct {
+	Name     string `yaml:"name"`
+	Cron     string `yaml:"cron"`
+	Duration string `yaml:"duration"`
+}
+
+// Range is a one-off freeze between two dates (inclusive)
+type Range struct {
+	Name  string `yaml:"name"`
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// Policy describes when deployments to protected environments are blocked
+type Policy struct {
+	Environments []string `yaml:"environments,omitempty"`
+	Windows      []Window `yaml:"windows,omitempty"`
+	Ranges       []Range  `yaml:"ranges,omitempty"`
+	APIURL       string   `yaml:"api_url,omitempty"`
+}
+
+// Status reports whether a freeze is active and why
+type Status struct {
+	Frozen bool
+	Reason string
+}
+
+// Checker evaluates freeze policies
+type Checker struct {
+	client *http.Client
+}
+
+// NewChecker creates a new freeze checker
+func NewChecker() *Checker {
+	return &Checker{client: httpclient.New(10 * time.Second)}
+}
+
+// Protects reports whether env is subject to the policy
+func (p *Policy) Protects(env string) bool {
+	for _, e := range p.Environments {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// Check evaluates the policy for env at time now
+func (c *Checker) Check(p *Policy, env string, now time.Time) (*Status, error) {
+	if p == nil || !p.Protects(env) {
+		return &Status{}, nil
+	}
+
+	for _, r := range p.Ranges {
+		start, err := parseDate(r.Start)
+		if err != nil {
+			return nil, fmt.Errorf("freeze range %q: %w", r.Name, err)
+		}
+		end, err := parseDate(r.End)
+		if err != nil {
+			return nil, fmt.Errorf("freeze range %q: %w", r.Name, err)
+		}
+		// Date-only ends cover the whole day
+		if !strings.Contains(r.End, "T") {
+			end = end.Add(24 * time.Hour)
+		}
+		if !now.Before(start) && now.Before(end) {
+			return &Status{Frozen: true, Reason: fmt.Sprintf("freeze %q (%s → %s)", r.Name, r.Start, r.End)}, nil
+		}
+	}
+
+	for _, w := range p.Windows {
+		active, err := windowActive(w, now)
+		if err != nil {
+			return nil, fmt.Errorf("freeze window %q: %w", w.Name, err)
+		}
+		if active {
+			return &Status{Frozen: true, Reason: fmt.Sprintf("freeze window %q (%s for %s)", w.Name, w.Cron, w.Duration)}, nil
+		}
+	}
+
+	if p.APIURL != "" {
+		return c.checkAPI(p.APIURL, env)
+	}
+
+	return &Status{}, nil
+}
+
+// checkAPI asks a remote freeze service, which must answer {"frozen": bool, "reason": string}
+func (c *Checker) checkAPI(url, env string) (*Status, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build freeze API request: %w", err)
+	}
+	q := req.URL.Query()
+	q.Set("env", env)
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query freeze API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("freeze API returned status: %s", resp.Status)
+	}
+
+	var body struct {
+		Frozen bool   `json:"frozen"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode freeze API response: %w", err)
+	}
+
+	status := &Status{Frozen: body.Frozen, Reason: body.Reason}
+	if status.Frozen && status.Reason == "" {
+		status.Reason = "freeze reported by " + url
+	}
+	return status, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// windowActive reports whether a cron-started window of the given duration covers now
+func windowActive(w Window, now time.Time) (bool, error) {
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil {
+		return false, fmt.Errorf("invalid duration %q: %w", w.Duration, err)
+	}
+
+	schedule, err := parseCron(w.Cron)
+	if err != nil {
+		return false, err
+	}
+
+	// Walk back minute by minute looking for a start time inside the window
+	t := now.Truncate(time.Minute)
+	for elapsed := time.Duration(0); elapsed <= duration; elapsed += time.Minute {
+		if schedule.matches(t.Add(-elapsed)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+}
+
+func (s *cronSchedule) matches(t time.Time) bool {
+	return s.minute[t.Minute()] && s.hour[t.Hour()] && s.dom[t.Day()] &&
+		s.month[int(t.Month())] && s.dow[int(t.Weekday())]
+}
+
+// parseCron parses a standard five-field cron expression
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron %q: expected 5 fields", expr)
+	}
+
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+	sets := make([]map[int]bool, 5)
+	for i, f := range fields {
+		set, err := parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+
+	// Sunday may be written as 7
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+
+	return &cronSchedule{minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4]}, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("bad step in %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			if i := strings.Index(part, "-"); i >= 0 {
+				a, err1 := strconv.Atoi(part[:i])
+				b, err2 := strconv.Atoi(part[i+1:])
+				if err1 != nil || err2 != nil {
+					return nil, fmt.Errorf("bad range %q", part)
+				}
+				lo, hi = a, b
+			} else {
+				n, err := strconv.Atoi(part)
+				if err != nil {
+					return nil, fmt.Errorf("bad value %q", part)
+				}
+				lo, hi = n, n
+			}
+		}
+
+		// Allow 7 for Sunday in the day-of-week field
+		limit := max
+		if max == 6 {
+			limit = 7
+		}
+		if lo < min || hi > limit || lo > hi {
+			return nil, fmt.Errorf("value out of range in %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
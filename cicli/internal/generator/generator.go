@@ -2,9 +2,11 @@ package generator
 
 import (
 	"cicli/internal/config"
+	"cicli/internal/term"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/template"
 )
 
@@ -90,7 +92,12 @@ jobs:
 `
 
 func (g *Generator) Generate(cfg *config.Config) error {
-	fmt.Printf("Generating pipeline for project: %s\n", cfg.ProjectName)
+	term.Printf("Generating pipeline for project: %s\n", cfg.ProjectName)
+
+	content, err := g.Render(cfg)
+	if err != nil {
+		return err
+	}
 
 	// Ensure .github/workflows exists
 	workflowDir := filepath.Join(".github", "workflows")
@@ -98,22 +105,30 @@ func (g *Generator) Generate(cfg *config.Config) error {
 		return fmt.Errorf("failed to create directory %s: %w", workflowDir, err)
 	}
 
-	filePath := filepath.Join(workflowDir, "ci-cd.yml")
-	f, err := os.Create(filePath)
-	if err != nil {
+	filePath := g.OutputPath()
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to create file %s: %w", filePath, err)
 	}
-	defer f.Close()
 
+	term.Printf("Generated %s\n", filePath)
+	return nil
+}
+
+// OutputPath returns where Generate writes the workflow
+func (g *Generator) OutputPath() string {
+	return filepath.Join(".github", "workflows", "ci-cd.yml")
+}
+
+// Render executes the workflow template without writing it
+func (g *Generator) Render(cfg *config.Config) (string, error) {
 	tmpl, err := template.New("workflow").Parse(workflowTemplate)
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+		return "", fmt.Errorf("failed to parse template: %w", err)
 	}
 
-	if err := tmpl.Execute(f, cfg); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, cfg); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
 	}
-
-	fmt.Printf("Generated %s\n", filePath)
-	return nil
+	return sb.String(), nil
 }
@@ -0,0 +1,261 @@
+package github
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cicli/internal/store"
+)
+
+const apiURL = "https://api.github.com"
+
+// MaxRateLimitWait is the longest a request waits for a rate limit to lift
+// before giving up; primary limits can take up to an hour to reset
+var MaxRateLimitWait = 2 * time.Minute
+
+// maxAttempts bounds how often a rate-limited request is sent
+const maxAttempts = 4
+
+// APIError is a response from the GitHub API with an error status
+type APIError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GitHub API returned status: %s", e.Status)
+}
+
+// cachedResponse is a GET response stored with its ETag, so that repeated
+// requests can be revalidated; GitHub does not count 304s against the rate limit
+type cachedResponse struct {
+	ETag string `json:"etag"`
+	Link string `json:"link,omitempty"`
+	Body []byte `json:"body"`
+}
+
+// Get decodes the response to a GET request of path into out
+func (c *Client) Get(path string, out interface{}) error {
+	data, _, err := c.get(apiURL + path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// GetPages calls page with the body of every page of a list endpoint,
+// following the Link header until the last page or until page returns false
+func (c *Client) GetPages(path string, page func(data []byte) (bool, error)) error {
+	next := apiURL + path
+	for next != "" {
+		data, link, err := c.get(next)
+		if err != nil {
+			return err
+		}
+		more, err := page(data)
+		if err != nil || !more {
+			return err
+		}
+		next = nextPage(link)
+	}
+	return nil
+}
+
+// Open sends a GET request without caching and returns the response, e.g.
+// to stream job logs. The caller closes the body.
+func (c *Client) Open(path string) (*http.Response, error) {
+	resp, err := c.send(http.MethodGet, apiURL+path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, &APIError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp, nil
+}
+
+// Post sends body as JSON to path and decodes the response into out, if set
+func (c *Client) Post(path string, body, out interface{}) error {
+	return c.do(http.MethodPost, path, body, out)
+}
+
+func (c *Client) do(method, path string, body, out interface{}) error {
+	if method == http.MethodGet && body == nil {
+		if out == nil {
+			out = &json.RawMessage{}
+		}
+		return c.Get(path, out)
+	}
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	resp, err := c.send(method, apiURL+path, data, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return &APIError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// get returns the body and Link header of a GET request, revalidating a
+// cached response with If-None-Match when there is one
+func (c *Client) get(url string) ([]byte, string, error) {
+	cachePath := c.cachePath(url)
+	var cached *cachedResponse
+	if cachePath != "" {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			cached = &cachedResponse{}
+			if json.Unmarshal(data, cached) != nil {
+				cached = nil
+			}
+		}
+	}
+
+	header := http.Header{}
+	if cached != nil {
+		header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := c.send(http.MethodGet, url, nil, header)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached.Body, cached.Link, nil
+	}
+	if resp.StatusCode >= 400 {
+		return nil, "", &APIError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read GitHub response: %w", err)
+	}
+
+	link := resp.Header.Get("Link")
+	if etag := resp.Header.Get("ETag"); etag != "" && cachePath != "" {
+		if entry, err := json.Marshal(cachedResponse{ETag: etag, Link: link, Body: data}); err == nil {
+			_ = os.WriteFile(cachePath, entry, 0600)
+		}
+	}
+	return data, link, nil
+}
+
+// cachePath is where the response to url is cached for this token, or empty
+// when the cache directory is unavailable
+func (c *Client) cachePath(url string) string {
+	dir, err := store.Dir()
+	if err != nil {
+		return ""
+	}
+	dir = filepath.Join(dir, "api-cache")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(c.token + "\n" + url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// send performs a request, waiting and retrying while GitHub rate limits it
+func (c *Client) send(method, url string, body []byte, header http.Header) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query GitHub: %w", err)
+		}
+		wait, limited := rateLimited(resp)
+		if !limited {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if wait > MaxRateLimitWait {
+			return nil, fmt.Errorf("GitHub API rate limit exceeded; it resets at %s", time.Now().Add(wait).Format("15:04"))
+		}
+		if attempt == maxAttempts {
+			return nil, fmt.Errorf("GitHub API rate limit exceeded after %d attempts", attempt)
+		}
+		// Back off further on each attempt, as GitHub asks for secondary limits
+		wait += time.Duration(attempt-1) * 30 * time.Second
+		fmt.Fprintf(os.Stderr, "GitHub API rate limit reached, retrying in %s\n", wait.Round(time.Second))
+		time.Sleep(wait)
+	}
+}
+
+var secondaryLimit = regexp.MustCompile(`(?i)secondary rate limit|abuse detection`)
+
+// rateLimited reports whether resp is a rate limit rather than a permission
+// error, and how long GitHub asks to wait before retrying
+func rateLimited(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Until(time.Unix(reset, 0)) + time.Second, true
+		}
+	}
+
+	// Secondary limits without headers say so in the body; keep it readable
+	// for the caller in case this is a permission error after all
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if resp.StatusCode == http.StatusTooManyRequests || secondaryLimit.Match(data) {
+		return time.Minute, true
+	}
+	return 0, false
+}
+
+// nextPage returns the rel="next" URL of a Link header
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		fields := strings.Split(part, ";")
+		if len(fields) < 2 || !strings.Contains(fields[1], `rel="next"`) {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(fields[0]), "<>")
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cicli/internal/httpclient"
+)
+
+// Protection are the deployment protection rules of an environment
+type Protection struct {
+	Reviewers []string `yaml:"reviewers,omitempty"`  // users, or teams as org/slug
+	WaitTimer int      `yaml:"wait_timer,omitempty"` // minutes to wait before deploying
+	Branches  []string `yaml:"branches,omitempty"`   // branch patterns allowed to deploy
+}
+
+// Client calls the GitHub REST API with GITHUB_TOKEN or GH_TOKEN
+type Client struct {
+	repo   string
+	token  string
+	client *http.Client
+}
+
+// NewClient creates a client for owner/name
+func NewClient(repo string) *Client {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		token = os.Getenv("GH_TOKEN")
+	}
+	return &Client{repo: repo, token: token, client: httpclient.New(30 * time.Second)}
+}
+
+// EnsureEnvironment creates or updates an environment with its protection
+// rules, so deployments show up in the Environments UI behind the right gates
+func (c *Client) EnsureEnvironment(name string, p Protection) error {
+	if c.token == "" {
+		return fmt.Errorf("set GITHUB_TOKEN with administration:write access to create environments")
+	}
+
+	body := map[string]interface{}{"wait_timer": p.WaitTimer}
+	var reviewers []map[string]interface{}
+	for _, r := range p.Reviewers {
+		reviewer, err := c.reviewer(r)
+		if err != nil {
+			return err
+		}
+		reviewers = append(reviewers, reviewer)
+	}
+	if len(reviewers) > 0 {
+		body["reviewers"] = reviewers
+	}
+	if len(p.Branches) > 0 {
+		body["deployment_branch_policy"] = map[string]bool{"protected_branches": false, "custom_branch_policies": true}
+	} else {
+		body["deployment_branch_policy"] = nil
+	}
+
+	envPath := fmt.Sprintf("/repos/%s/environments/%s", c.repo, url.PathEscape(name))
+	if err := c.do(http.MethodPut, envPath, body, nil); err != nil {
+		return fmt.Errorf("failed to create environment %s: %w", name, err)
+	}
+
+	if len(p.Branches) == 0 {
+		return nil
+	}
+	have := make(map[string]bool)
+	err := c.GetPages(envPath+"/deployment-branch-policies?per_page=100", func(data []byte) (bool, error) {
+		var page struct {
+			Policies []struct {
+				Name string `json:"name"`
+			} `json:"branch_policies"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			return false, err
+		}
+		for _, policy := range page.Policies {
+			have[policy.Name] = true
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, branch := range p.Branches {
+		if have[branch] {
+			continue
+		}
+		if err := c.do(http.MethodPost, envPath+"/deployment-branch-policies", map[string]string{"name": branch}, nil); err != nil {
+			return fmt.Errorf("failed to allow branch %s: %w", branch, err)
+		}
+	}
+	return nil
+}
+
+// reviewer resolves a user login or an org/team slug to the API's reviewer form
+func (c *Client) reviewer(name string) (map[string]interface{}, error) {
+	var found struct {
+		ID int64 `json:"id"`
+	}
+	if org, team, ok := strings.Cut(name, "/"); ok {
+		if err := c.do(http.MethodGet, fmt.Sprintf("/orgs/%s/teams/%s", org, team), nil, &found); err != nil {
+			return nil, fmt.Errorf("unknown team %s: %w", name, err)
+		}
+		return map[string]interface{}{"type": "Team", "id": found.ID}, nil
+	}
+	if err := c.do(http.MethodGet, "/users/"+name, nil, &found); err != nil {
+		return nil, fmt.Errorf("unknown user %s: %w", name, err)
+	}
+	return map[string]interface{}{"type": "User", "id": found.ID}, nil
+}
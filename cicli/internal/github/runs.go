@@ -0,0 +1,161 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Run is a GitHub Actions workflow run
+type Run struct {
+	ID         int64     `json:"id"`
+	Status     string    `json:"status"`
+	Conclusion string    `json:"conclusion"`
+	HTMLURL    string    `json:"html_url"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"run_started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Duration is how long a completed run took, excluding time spent queued
+func (r *Run) Duration() time.Duration {
+	return r.UpdatedAt.Sub(r.StartedAt)
+}
+
+// DispatchWorkflow starts a workflow_dispatch run of a workflow file on ref
+func (c *Client) DispatchWorkflow(workflow, ref string) error {
+	if c.token == "" {
+		return fmt.Errorf("set GITHUB_TOKEN with actions:write access to trigger workflow runs")
+	}
+	path := fmt.Sprintf("/repos/%s/actions/workflows/%s/dispatches", c.repo, url.PathEscape(workflow))
+	if err := c.do(http.MethodPost, path, map[string]string{"ref": ref}, nil); err != nil {
+		return fmt.Errorf("failed to dispatch %s on %s: %w", workflow, ref, err)
+	}
+	return nil
+}
+
+// WaitForRun polls for the dispatch run of a workflow on branch created after
+// since, and returns it once it has completed
+func (c *Client) WaitForRun(workflow, branch string, since time.Time, timeout time.Duration) (*Run, error) {
+	path := fmt.Sprintf("/repos/%s/actions/workflows/%s/runs?event=workflow_dispatch&branch=%s&per_page=5",
+		c.repo, url.PathEscape(workflow), url.QueryEscape(branch))
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		var list struct {
+			Runs []Run `json:"workflow_runs"`
+		}
+		if err := c.do(http.MethodGet, path, nil, &list); err != nil {
+			return nil, err
+		}
+		for _, run := range list.Runs {
+			// Allow for clock skew between this machine and GitHub
+			if run.CreatedAt.Before(since.Add(-time.Minute)) {
+				continue
+			}
+			if run.Status == "completed" {
+				return &run, nil
+			}
+			break
+		}
+		time.Sleep(15 * time.Second)
+	}
+	return nil, fmt.Errorf("timed out after %s waiting for %s on %s", timeout, workflow, branch)
+}
+
+// WorkflowRunner benchmarks workflow content by pushing it to a temporary
+// branch, dispatching it there and timing the real run. The workflow must
+// have a workflow_dispatch trigger. Each branch is deleted afterwards.
+type WorkflowRunner struct {
+	Client  *Client
+	Remote  string        // git remote to push to, usually origin
+	Timeout time.Duration // how long to wait for a run to complete
+}
+
+// Name identifies the runner in reports
+func (r WorkflowRunner) Name() string {
+	return "github"
+}
+
+// Run pushes the content as file on a branch cut from HEAD, dispatches the
+// workflow there and returns the run's duration
+func (r WorkflowRunner) Run(file string, content []byte) (time.Duration, error) {
+	if !strings.Contains(string(content), "workflow_dispatch") {
+		return 0, fmt.Errorf("%s needs a workflow_dispatch trigger to be benchmarked on GitHub", file)
+	}
+
+	branch := fmt.Sprintf("cicli-benchmark/%s-%d", strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)), time.Now().UnixNano())
+	if err := pushContent(r.Remote, branch, file, content); err != nil {
+		return 0, err
+	}
+	defer exec.Command("git", "push", "--quiet", r.Remote, "--delete", branch).Run()
+
+	since := time.Now()
+	workflow := filepath.Base(file)
+	if err := r.Client.DispatchWorkflow(workflow, branch); err != nil {
+		return 0, err
+	}
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = time.Hour
+	}
+	run, err := r.Client.WaitForRun(workflow, branch, since, timeout)
+	if err != nil {
+		return 0, err
+	}
+	if run.Conclusion != "success" {
+		return 0, fmt.Errorf("run %s (%s)", run.Conclusion, run.HTMLURL)
+	}
+	return run.Duration(), nil
+}
+
+// pushContent commits content as file on top of HEAD in a throwaway worktree
+// and pushes it to branch, leaving the working tree untouched
+func pushContent(remote, branch, file string, content []byte) error {
+	top, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return fmt.Errorf("not a git repository: %w", err)
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(strings.TrimSpace(string(top)), abs)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "cicli-benchmark-")
+	if err != nil {
+		return err
+	}
+	os.Remove(dir)
+	if out, err := exec.Command("git", "worktree", "add", "--quiet", "--detach", dir, "HEAD").CombinedOutput(); err != nil {
+		return fmt.Errorf("git worktree add failed: %s", strings.TrimSpace(string(out)))
+	}
+	defer exec.Command("git", "worktree", "remove", "--force", dir).Run()
+
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, rel)), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, rel), content, 0644); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"add", rel},
+		{"commit", "--quiet", "--allow-empty", "-m", "cicli benchmark: " + rel},
+		{"push", "--quiet", remote, "HEAD:refs/heads/" + branch},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
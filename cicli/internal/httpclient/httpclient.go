@@ -0,0 +1,75 @@
+// Package httpclient creates the HTTP clients cicli uses for webhooks, the
+// GitHub API, freeze APIs and self-update, so they share proxy and TLS settings
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Settings adjusts TLS for networks behind a TLS-intercepting proxy. Proxies
+// themselves come from HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+type Settings struct {
+	CABundle           string `yaml:"ca_bundle,omitempty"`            // PEM file trusted in addition to the system roots
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"` // disables certificate verification; last resort
+}
+
+// transport is shared by every client New returns
+var transport http.RoundTripper = newTransport(nil)
+
+func newTransport(tlsConfig *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	t.TLSClientConfig = tlsConfig
+	return t
+}
+
+// Configure applies settings to the clients created afterwards.
+// CICLI_CA_BUNDLE and CICLI_INSECURE_SKIP_VERIFY override the settings, so
+// commands run outside a project can use them too.
+func Configure(settings Settings) error {
+	if bundle := os.Getenv("CICLI_CA_BUNDLE"); bundle != "" {
+		settings.CABundle = bundle
+	}
+	if v := os.Getenv("CICLI_INSECURE_SKIP_VERIFY"); v != "" {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("CICLI_INSECURE_SKIP_VERIFY: %w", err)
+		}
+		settings.InsecureSkipVerify = insecure
+	}
+
+	if settings.CABundle == "" && !settings.InsecureSkipVerify {
+		transport = newTransport(nil)
+		return nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+	if settings.CABundle != "" {
+		pem, err := os.ReadFile(settings.CABundle)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA bundle %s contains no PEM certificates", settings.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport = newTransport(tlsConfig)
+	return nil
+}
+
+// New returns a client with the given timeout that uses the configured proxy
+// and TLS settings
+func New(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,173 @@
+package i18n
+
+var spanish = map[string]string{
+	// Lint report
+	"Lint Report: %s":       "Informe de lint: %s",
+	"Platform: %s":          "Plataforma: %s",
+	"Score: %d/100":         "Puntuación: %d/100",
+	"No issues found!":      "¡No se encontraron problemas!",
+	"Errors:":               "Errores:",
+	"Warnings:":             "Advertencias:",
+	"Info:":                 "Información:",
+	" (line %d)":            " (línea %d)",
+	" (line %d, column %d)": " (línea %d, columna %d)",
+
+	// Lint rules
+	"Potential %s detected": "Posible %s detectado",
+	"Use secrets/environment variables instead of hardcoded values":  "Usa secretos/variables de entorno en lugar de valores fijos en el código",
+	"Piping curl to shell is dangerous":                              "Redirigir curl a la shell es peligroso",
+	"Piping wget to shell is dangerous":                              "Redirigir wget a la shell es peligroso",
+	"Download and verify scripts before execution":                   "Descarga y verifica los scripts antes de ejecutarlos",
+	"Setting 777 permissions is insecure":                            "Asignar permisos 777 es inseguro",
+	"Use more restrictive permissions (e.g., 755 or 644)":            "Usa permisos más restrictivos (p. ej., 755 o 644)",
+	"Disabling SSL verification is insecure":                         "Desactivar la verificación SSL es inseguro",
+	"Fix SSL certificates instead of disabling verification":         "Corrige los certificados SSL en lugar de desactivar la verificación",
+	"Using eval can be dangerous":                                    "Usar eval puede ser peligroso",
+	"Avoid eval when possible, use safer alternatives":               "Evita eval siempre que sea posible; usa alternativas más seguras",
+	"Action '%s' uses tag '%s' instead of SHA pin":                   "La acción '%s' usa la etiqueta '%s' en lugar de fijar un SHA",
+	"Pin to a specific commit SHA for security (e.g., @a1b2c3d4...)": "Fija un SHA de commit concreto por seguridad (p. ej., @a1b2c3d4...)",
+	"Job '%s' has no timeout defined":                                "El job '%s' no tiene tiempo límite definido",
+	"Add 'timeout-minutes' to prevent hung jobs":                     "Añade 'timeout-minutes' para evitar jobs colgados",
+	"Workflow has no concurrency control":                            "El workflow no tiene control de concurrencia",
+	"Add 'concurrency' to cancel outdated runs on the same branch":   "Añade 'concurrency' para cancelar ejecuciones obsoletas en la misma rama",
+	"Action '%s@v%d' is outdated (latest: v%d)":                      "La acción '%s@v%d' está desactualizada (última: v%d)",
+	"Update to %s@v%d":                                                                                 "Actualiza a %s@v%d",
+	"Using %s but no cache configured":                                                                 "Se usa %s pero no hay caché configurada",
+	"Add caching for %s dependencies to speed up builds":                                               "Añade caché para las dependencias de %s y acelera las compilaciones",
+	"Jobs appear to be running sequentially":                                                           "Los jobs parecen ejecutarse en secuencia",
+	"Consider if some jobs can run in parallel to reduce build time":                                   "Valora si algunos jobs pueden ejecutarse en paralelo para reducir el tiempo de compilación",
+	"'%s' may fail due to network issues":                                                              "'%s' puede fallar por problemas de red",
+	"Consider adding retry logic for network-dependent operations":                                     "Considera añadir reintentos para las operaciones que dependen de la red",
+	"Multi-line script without explicit error handling":                                                "Script de varias líneas sin manejo explícito de errores",
+	"Add 'set -e' at the start of multi-line scripts":                                                  "Añade 'set -e' al comienzo de los scripts de varias líneas",
+	"Inline script has %d lines (limit %d)":                                                            "Script en línea de %d líneas (límite %d)",
+	"Move it to a script file under scripts/ so it can be shellchecked and run locally":                "Muévelo a un archivo en scripts/ para poder analizarlo con shellcheck y ejecutarlo en local",
+	"See https://www.shellcheck.net/wiki/SC%d":                                                         "Consulta https://www.shellcheck.net/wiki/SC%d",
+	"Spell out the intended values or restructure the anchors so the expanded YAML matches":            "Escribe explícitamente los valores deseados o reorganiza los anchors para que el YAML expandido coincida",
+	"Add 'concurrency' with cancel-in-progress: false so deployments queue instead of being cancelled": "Añade 'concurrency' con cancel-in-progress: false para que los despliegues esperen en cola en lugar de cancelarse",
+	"Add 'concurrency' keyed on the pull request so new pushes cancel superseded runs":                 "Añade 'concurrency' por pull request para que los nuevos pushes cancelen las ejecuciones obsoletas",
+	"CI runs %q, which is not defined in %s":                                                           "CI ejecuta %q, que no está definido en %s",
+	"Add %q to %s or update the CI step":                                                               "Añade %q a %s o actualiza el paso de CI",
+	"Did you mean %q? Update the CI step or restore the old name in %s":                                "¿Querías decir %q? Actualiza el paso de CI o restaura el nombre anterior en %s",
+	"Image '%s' uses the mutable :latest tag":                                                          "La imagen '%s' usa la etiqueta mutable :latest",
+	"Image '%s' has no tag and defaults to :latest":                                                    "La imagen '%s' no tiene etiqueta y usa :latest por defecto",
+	"Pin a version tag, or a digest from 'docker buildx imagetools inspect %s'":                        "Fija una etiqueta de versión, o un digest obtenido con 'docker buildx imagetools inspect %s'",
+
+	"Workflow grants GITHUB_TOKEN write-all permissions":                                           "El workflow concede permisos write-all a GITHUB_TOKEN",
+	"Job '%s' grants GITHUB_TOKEN write-all permissions":                                           "El job '%s' concede permisos write-all a GITHUB_TOKEN",
+	"Replace write-all with the scopes the job uses: %s":                                           "Sustituye write-all por los ámbitos que usa el job: %s",
+	"Workflow has no permissions block, so GITHUB_TOKEN gets the repository's default permissions": "El workflow no tiene bloque permissions, así que GITHUB_TOKEN recibe los permisos por defecto del repositorio",
+	"Set 'permissions: contents: read' at the top level":                                           "Define 'permissions: contents: read' en el nivel superior",
+	"Add 'permissions: contents: read' above jobs:":                                                "Añade 'permissions: contents: read' encima de jobs:",
+	"%s; no job writes with GITHUB_TOKEN":                                                          "%s; ningún job escribe con GITHUB_TOKEN",
+	"%s, then grant each job only the scopes it writes to: %s":                                     "%s y concede a cada job solo los ámbitos en los que escribe: %s",
+
+	"Image is built with raw 'docker build' in job '%s'":                                                                "La imagen se construye con 'docker build' directamente en el job '%s'",
+	"Use docker/build-push-action with GitHub Actions layer caching, plus the setup-buildx, login and metadata actions": "Usa docker/build-push-action con la caché de capas de GitHub Actions, junto con las acciones setup-buildx, login y metadata",
+
+	"Job '%s' checks out the pull request's code in a %s workflow, which runs with secrets and a write token":                                                                                                                          "El job '%s' hace checkout del código del pull request en un workflow %s, que se ejecuta con secretos y un token de escritura",
+	"Build and test fork code in a pull_request workflow, which gets no secrets, and only handle its artifacts here. If the checkout must stay, remove secrets from the job, set persist-credentials: false and permissions: read-all": "Compila y prueba el código del fork en un workflow pull_request, que no recibe secretos, y aquí maneja solo sus artefactos. Si el checkout debe quedarse, quita los secretos del job y usa persist-credentials: false y permissions: read-all",
+	"Job '%s' uses secret %s, which is empty in pull requests from forks":                                                                                                                                                              "El job '%s' usa el secreto %s, que está vacío en los pull requests desde forks",
+	"Skip the step for forks with '%s'. Do not switch to pull_request_target to get the secret":                                                                                                                                        "Omite el paso para los forks con '%s'. No cambies a pull_request_target para obtener el secreto",
+	"Job '%s' runs pull requests from forks on a self-hosted runner":                                                                                                                                                                   "El job '%s' ejecuta pull requests desde forks en un runner autoalojado",
+	"Run pull request jobs on GitHub-hosted runners, or skip forks with '%s'. A fork can run any code on the runner and leave it behind on a non-ephemeral one":                                                                        "Ejecuta los jobs de pull request en runners alojados por GitHub, u omite los forks con '%s'. Un fork puede ejecutar cualquier código en el runner y dejarlo en uno no efímero",
+	"Job '%s' saves a cache in a %s workflow, which shares the default branch's cache":                                                                                                                                                 "El job '%s' guarda una caché en un workflow %s, que comparte la caché de la rama principal",
+	"Use actions/cache/restore, which never saves, or remove the cache input of setup actions here. Save caches only from push workflows on the default branch":                                                                        "Usa actions/cache/restore, que nunca guarda, o quita la entrada cache de las acciones setup aquí. Guarda cachés solo desde workflows push en la rama principal",
+	"Job '%s' runs on a self-hosted runner for %s events, which any GitHub user can trigger":                                                                                                                                           "El job '%s' se ejecuta en un runner autoalojado con eventos %s, que cualquier usuario de GitHub puede disparar",
+	"Use a GitHub-hosted runner, or only run for trusted users: if: contains(fromJSON('[\"OWNER\",\"MEMBER\",\"COLLABORATOR\"]'), github.event.comment.author_association)":                                                            "Usa un runner alojado en GitHub, o ejec\u00fatalo solo para usuarios de confianza: if: contains(fromJSON('[\"OWNER\",\"MEMBER\",\"COLLABORATOR\"]'), github.event.comment.author_association)",
+	"Job '%s' needs this repository's secrets, environments or runners but has no github.repository guard, so forks run it too":                                                                                                        "El job '%s' necesita los secretos, entornos o runners de este repositorio pero no tiene una condici\u00f3n sobre github.repository, as\u00ed que los forks tambi\u00e9n lo ejecutan",
+	"Add a guard with your repository's name to the job: %s":                                                                                                                                                                           "A\u00f1ade al job una condici\u00f3n con el nombre de tu repositorio: %s",
+
+	"Invalid expression: %s": "Expresi\u00f3n no v\u00e1lida: %s",
+	"See https://docs.github.com/actions/learn-github-actions/expressions for the syntax, functions and contexts":                       "Consulta https://docs.github.com/actions/learn-github-actions/expressions para ver la sintaxis, las funciones y los contextos",
+	"text outside ${{ }} makes the condition a string, which is always true; put the whole condition inside ${{ }} or leave ${{ }} out": "el texto fuera de ${{ }} convierte la condici\u00f3n en una cadena, que siempre es verdadera; pon toda la condici\u00f3n dentro de ${{ }} o quita ${{ }}",
+	"${{ has no closing }}":                                          "${{ no tiene }} de cierre",
+	"unterminated string":                                            "cadena sin cerrar",
+	"strings must use single quotes":                                 "las cadenas deben usar comillas simples",
+	"use == to compare, not =":                                       "usa == para comparar, no =",
+	"use %[1]s%[1]s, not a single %[1]s":                             "usa %[1]s%[1]s, no un solo %[1]s",
+	"$%[1]s is a shell variable; read it as env.%[1]s or vars.%[1]s": "$%[1]s es una variable de shell; l\u00e9ela como env.%[1]s o vars.%[1]s",
+	"unexpected character '%s'":                                      "car\u00e1cter inesperado '%s'",
+	"empty expression":                                               "expresi\u00f3n vac\u00eda",
+	"unexpected '%s'":                                                "'%s' inesperado",
+	"unexpected '%s' where %s was expected":                          "'%s' inesperado donde se esperaba %s",
+	"expression ends where %s was expected":                          "la expresi\u00f3n termina donde se esperaba %s",
+	"a property name":                                                "un nombre de propiedad",
+	"a value":                                                        "un valor",
+	"unknown context '%s'":                                           "contexto desconocido '%s'",
+	"unknown function '%s'":                                          "funci\u00f3n desconocida '%s'",
+	"%s() does not take %d arguments":                                "%s() no admite %d argumentos",
+
+	"Job '%s' needs itself":                                                                 "El job '%s' se necesita a s\u00ed mismo",
+	"Remove '%s' from its own needs":                                                        "Quita '%s' de sus propios needs",
+	"Job '%s' needs '%s', which is not a job in this workflow":                              "El job '%s' necesita '%s', que no es un job de este workflow",
+	"Jobs %s need each other, so none of them can start":                                    "Los jobs %s se necesitan entre s\u00ed, as\u00ed que ninguno puede empezar",
+	"Remove '%s' from the needs of '%s', or merge the jobs":                                 "Quita '%s' de los needs de '%s', o une los jobs",
+	"Job '%s' never runs: its condition '%s' is always false":                               "El job '%s' nunca se ejecuta: su condici\u00f3n '%s' siempre es falsa",
+	"Remove the job, or its if: when it should run":                                         "Elimina el job, o su if: si debe ejecutarse",
+	"Job '%s' never runs: it needs '%s', which never runs":                                  "El job '%s' nunca se ejecuta: necesita '%s', que nunca se ejecuta",
+	"Fix the condition of '%s', or add 'if: ${{ !cancelled() }}' to run after skipped jobs": "Corrige la condici\u00f3n de '%s', o a\u00f1ade 'if: ${{ !cancelled() }}' para ejecutarlo tras jobs omitidos",
+	"Step %d of job '%s' never runs: its condition '%s' is always false":                    "El paso %d del job '%s' nunca se ejecuta: su condici\u00f3n '%s' siempre es falsa",
+	"Remove the step, or its if: when it should run":                                        "Elimina el paso, o su if: si debe ejecutarse",
+	"Step %d of job '%s' never runs: step %d always exits with status %d":                   "El paso %d del job '%s' nunca se ejecuta: el paso %d siempre termina con el estado %d",
+	"Remove the exit from step %d, or add 'if: always()' to steps that should run after it": "Quita el exit del paso %d, o a\u00f1ade 'if: always()' a los pasos que deban ejecutarse despu\u00e9s",
+
+	"Unknown key '%s' in %s":                                "Clave desconocida '%s' en %s",
+	"Remove it or check the spelling against the %s schema": "Elimínala o revisa la ortografía con el esquema de %s",
+	"Did you mean '%s'?":                                    "¿Querías decir '%s'?",
+	"%s has type %s, but the schema expects %s":             "%s es de tipo %s, pero el esquema espera %s",
+	"Check the %s schema for the expected value":            "Consulta el esquema de %s para ver el valor esperado",
+	"'%s' is not a valid value for %s":                      "'%s' no es un valor válido para %s",
+	"Use one of: %s":                                        "Usa uno de: %s",
+	"%s is missing the required key '%s'":                   "A %s le falta la clave obligatoria '%s'",
+	"%s needs one of: %s":                                   "%s necesita una de: %s",
+	"Unknown trigger '%s'":                                  "Disparador desconocido '%s'",
+	"See https://docs.github.com/actions/using-workflows/events-that-trigger-workflows": "Consulta https://docs.github.com/es/actions/using-workflows/events-that-trigger-workflows",
+	"the document": "el documento",
+
+	// Score report
+	"CI/CD Maturity Scorecard": "Tarjeta de madurez de CI/CD",
+	"Overall: %d/100 (%s)":     "Total: %d/100 (%s)",
+	"Deductions:":              "Deducciones:",
+	"containerization":         "contenedores",
+	"testing":                  "pruebas",
+	"security":                 "seguridad",
+	"speed":                    "velocidad",
+	"deployability":            "despliegue",
+
+	// Optimization report
+	"Optimization Report: %s":                              "Informe de optimización: %s",
+	"Potential time savings: %s":                           "Ahorro de tiempo potencial: %s",
+	"No optimizations needed - your pipeline looks great!": "No hacen falta optimizaciones: ¡tu pipeline se ve genial!",
+	"High Impact:":                                         "Impacto alto:",
+	"Medium Impact:":                                       "Impacto medio:",
+	"Low Impact:":                                          "Impacto bajo:",
+	" [auto-fixable]":                                      " [corrección automática]",
+	"Estimated save: %s":                                   "Ahorro estimado: %s",
+	"Benchmark: %s":                                        "Benchmark: %s",
+	"Runner: %s (%d runs each)":                            "Runner: %s (%d ejecuciones de cada versión)",
+	"Applied:":                                             "Aplicadas:",
+	"Before:":                                              "Antes:",
+	"After:":                                               "Después:",
+	"Delta:":                                               "Diferencia:",
+	"Estimated:":                                           "Estimado:",
+	"The optimized workflow was not faster; keep the original or benchmark with more runs": "El workflow optimizado no fue más rápido; conserva el original o repite la prueba con más ejecuciones",
+
+	// Analysis report
+	"Project Analysis Report": "Informe de análisis del proyecto",
+	"Project: %s":             "Proyecto: %s",
+	"Language: %s":            "Lenguaje: %s",
+	"Framework: %s":           "Framework: %s",
+	"Package Manager: %s":     "Gestor de paquetes: %s",
+	"Commands:":               "Comandos:",
+	"Build: %s":               "Compilación: %s",
+	"Test:  %s":               "Pruebas: %s",
+	"Detection:":              "Detección:",
+	"Ports:  %v":              "Puertos: %v",
+	"Quality: %s":             "Calidad: %s",
+	"Codegen: %s":             "Generación de código: %s",
+	"Bazel: %s":               "Bazel: %s",
+	"E2E: %s (%s)":            "E2E: %s (%s)",
+	"Monorepo: %s (%s)":       "Monorepo: %s (%s)",
+	"Suggestions:":            "Sugerencias:",
+}
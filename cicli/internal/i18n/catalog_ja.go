@@ -0,0 +1,173 @@
+package i18n
+
+var japanese = map[string]string{
+	// Lint report
+	"Lint Report: %s":       "Lint レポート: %s",
+	"Platform: %s":          "プラットフォーム: %s",
+	"Score: %d/100":         "スコア: %d/100",
+	"No issues found!":      "問題は見つかりませんでした！",
+	"Errors:":               "エラー:",
+	"Warnings:":             "警告:",
+	"Info:":                 "情報:",
+	" (line %d)":            " (%d 行目)",
+	" (line %d, column %d)": " (%d 行目 %d 列)",
+
+	// Lint rules
+	"Potential %s detected": "%s の可能性があります",
+	"Use secrets/environment variables instead of hardcoded values":  "値をハードコードせず、シークレットや環境変数を使用してください",
+	"Piping curl to shell is dangerous":                              "curl の出力をシェルにパイプするのは危険です",
+	"Piping wget to shell is dangerous":                              "wget の出力をシェルにパイプするのは危険です",
+	"Download and verify scripts before execution":                   "スクリプトは実行前にダウンロードして検証してください",
+	"Setting 777 permissions is insecure":                            "777 のパーミッション設定は安全ではありません",
+	"Use more restrictive permissions (e.g., 755 or 644)":            "より制限の厳しいパーミッション (例: 755 や 644) を使用してください",
+	"Disabling SSL verification is insecure":                         "SSL 検証の無効化は安全ではありません",
+	"Fix SSL certificates instead of disabling verification":         "検証を無効にせず、SSL 証明書を修正してください",
+	"Using eval can be dangerous":                                    "eval の使用は危険な場合があります",
+	"Avoid eval when possible, use safer alternatives":               "可能な限り eval を避け、より安全な方法を使用してください",
+	"Action '%s' uses tag '%s' instead of SHA pin":                   "アクション '%s' は SHA 固定ではなくタグ '%s' を使用しています",
+	"Pin to a specific commit SHA for security (e.g., @a1b2c3d4...)": "セキュリティのため特定のコミット SHA に固定してください (例: @a1b2c3d4...)",
+	"Job '%s' has no timeout defined":                                "ジョブ '%s' にタイムアウトが設定されていません",
+	"Add 'timeout-minutes' to prevent hung jobs":                     "ジョブのハングを防ぐため 'timeout-minutes' を追加してください",
+	"Workflow has no concurrency control":                            "ワークフローに同時実行制御がありません",
+	"Add 'concurrency' to cancel outdated runs on the same branch":   "同じブランチの古い実行をキャンセルするため 'concurrency' を追加してください",
+	"Action '%s@v%d' is outdated (latest: v%d)":                      "アクション '%s@v%d' は古くなっています (最新: v%d)",
+	"Update to %s@v%d":                                                                                 "%s@v%d に更新してください",
+	"Using %s but no cache configured":                                                                 "%s を使用していますが、キャッシュが設定されていません",
+	"Add caching for %s dependencies to speed up builds":                                               "ビルドを高速化するため %s の依存関係をキャッシュしてください",
+	"Jobs appear to be running sequentially":                                                           "ジョブが順番に実行されているようです",
+	"Consider if some jobs can run in parallel to reduce build time":                                   "ビルド時間短縮のため、並列実行できるジョブがないか検討してください",
+	"'%s' may fail due to network issues":                                                              "'%s' はネットワークの問題で失敗する可能性があります",
+	"Consider adding retry logic for network-dependent operations":                                     "ネットワークに依存する処理にはリトライを追加することを検討してください",
+	"Multi-line script without explicit error handling":                                                "明示的なエラー処理のない複数行スクリプトです",
+	"Add 'set -e' at the start of multi-line scripts":                                                  "複数行スクリプトの先頭に 'set -e' を追加してください",
+	"Inline script has %d lines (limit %d)":                                                            "インラインスクリプトが %d 行あります (上限 %d 行)",
+	"Move it to a script file under scripts/ so it can be shellchecked and run locally":                "shellcheck での検査やローカル実行ができるよう scripts/ 配下のファイルに移動してください",
+	"See https://www.shellcheck.net/wiki/SC%d":                                                         "https://www.shellcheck.net/wiki/SC%d を参照してください",
+	"Spell out the intended values or restructure the anchors so the expanded YAML matches":            "意図した値を明示的に書くか、展開後の YAML が一致するようにアンカーを見直してください",
+	"Add 'concurrency' with cancel-in-progress: false so deployments queue instead of being cancelled": "デプロイがキャンセルされずに順番待ちになるよう cancel-in-progress: false 付きの 'concurrency' を追加してください",
+	"Add 'concurrency' keyed on the pull request so new pushes cancel superseded runs":                 "新しいプッシュで古い実行がキャンセルされるよう、プルリクエスト単位の 'concurrency' を追加してください",
+	"CI runs %q, which is not defined in %s":                                                           "CI が %q を実行していますが、%s に定義されていません",
+	"Add %q to %s or update the CI step":                                                               "%q を %s に追加するか、CI のステップを更新してください",
+	"Did you mean %q? Update the CI step or restore the old name in %s":                                "%q のことですか？CI のステップを更新するか、%s の古い名前を戻してください",
+	"Image '%s' uses the mutable :latest tag":                                                          "イメージ '%s' は変更されうる :latest タグを使っています",
+	"Image '%s' has no tag and defaults to :latest":                                                    "イメージ '%s' にはタグがなく、:latest が使われます",
+	"Pin a version tag, or a digest from 'docker buildx imagetools inspect %s'":                        "バージョンタグか、'docker buildx imagetools inspect %s' で得られるダイジェストに固定してください",
+
+	"Workflow grants GITHUB_TOKEN write-all permissions":                                           "ワークフローが GITHUB_TOKEN に write-all 権限を与えています",
+	"Job '%s' grants GITHUB_TOKEN write-all permissions":                                           "ジョブ '%s' が GITHUB_TOKEN に write-all 権限を与えています",
+	"Replace write-all with the scopes the job uses: %s":                                           "write-all をジョブが使うスコープに置き換えてください: %s",
+	"Workflow has no permissions block, so GITHUB_TOKEN gets the repository's default permissions": "ワークフローに permissions ブロックがないため、GITHUB_TOKEN にはリポジトリの既定の権限が与えられます",
+	"Set 'permissions: contents: read' at the top level":                                           "トップレベルに 'permissions: contents: read' を設定してください",
+	"Add 'permissions: contents: read' above jobs:":                                                "jobs: の上に 'permissions: contents: read' を追加してください",
+	"%s; no job writes with GITHUB_TOKEN":                                                          "%s。GITHUB_TOKEN で書き込むジョブはありません",
+	"%s, then grant each job only the scopes it writes to: %s":                                     "%s。そのうえで各ジョブには書き込むスコープだけを与えてください: %s",
+
+	"Image is built with raw 'docker build' in job '%s'":                                                                "ジョブ '%s' でイメージを 'docker build' で直接ビルドしています",
+	"Use docker/build-push-action with GitHub Actions layer caching, plus the setup-buildx, login and metadata actions": "GitHub Actions のレイヤーキャッシュを使う docker/build-push-action と、setup-buildx・login・metadata アクションを使ってください",
+
+	"Job '%s' checks out the pull request's code in a %s workflow, which runs with secrets and a write token":                                                                                                                          "ジョブ '%[1]s' は、シークレットと書き込みトークン付きで実行される %[2]s ワークフローでプルリクエストのコードをチェックアウトしています",
+	"Build and test fork code in a pull_request workflow, which gets no secrets, and only handle its artifacts here. If the checkout must stay, remove secrets from the job, set persist-credentials: false and permissions: read-all": "フォークのコードはシークレットを受け取らない pull_request ワークフローでビルド・テストし、ここではその成果物だけを扱ってください。チェックアウトが必要な場合は、ジョブからシークレットを外し、persist-credentials: false と permissions: read-all を設定してください",
+	"Job '%s' uses secret %s, which is empty in pull requests from forks":                                                                                                                                                              "ジョブ '%s' はシークレット %s を使っていますが、フォークからのプルリクエストでは空になります",
+	"Skip the step for forks with '%s'. Do not switch to pull_request_target to get the secret":                                                                                                                                        "'%s' でフォークではステップをスキップしてください。シークレットを得るために pull_request_target に切り替えないでください",
+	"Job '%s' runs pull requests from forks on a self-hosted runner":                                                                                                                                                                   "ジョブ '%s' はフォークからのプルリクエストをセルフホストランナーで実行します",
+	"Run pull request jobs on GitHub-hosted runners, or skip forks with '%s'. A fork can run any code on the runner and leave it behind on a non-ephemeral one":                                                                        "プルリクエストのジョブは GitHub ホストランナーで実行するか、'%s' でフォークをスキップしてください。フォークはランナー上で任意のコードを実行でき、非エフェメラルなランナーにはそれが残ります",
+	"Job '%s' saves a cache in a %s workflow, which shares the default branch's cache":                                                                                                                                                 "ジョブ '%[1]s' は、デフォルトブランチのキャッシュを共有する %[2]s ワークフローでキャッシュを保存しています",
+	"Use actions/cache/restore, which never saves, or remove the cache input of setup actions here. Save caches only from push workflows on the default branch":                                                                        "保存しない actions/cache/restore を使うか、ここでは setup アクションの cache 入力を削除してください。キャッシュはデフォルトブランチの push ワークフローからのみ保存してください",
+	"Job '%s' runs on a self-hosted runner for %s events, which any GitHub user can trigger":                                                                                                                                           "\u30b8\u30e7\u30d6 '%[1]s' \u306f %[2]s \u30a4\u30d9\u30f3\u30c8\u3067\u30bb\u30eb\u30d5\u30db\u30b9\u30c8\u30e9\u30f3\u30ca\u30fc\u3092\u4f7f\u3044\u307e\u3059\u3002\u3053\u306e\u30a4\u30d9\u30f3\u30c8\u306f GitHub \u306e\u8ab0\u3067\u3082\u767a\u751f\u3055\u305b\u3089\u308c\u307e\u3059",
+	"Use a GitHub-hosted runner, or only run for trusted users: if: contains(fromJSON('[\"OWNER\",\"MEMBER\",\"COLLABORATOR\"]'), github.event.comment.author_association)":                                                            "GitHub \u30db\u30b9\u30c8\u30e9\u30f3\u30ca\u30fc\u3092\u4f7f\u3046\u304b\u3001\u4fe1\u983c\u3067\u304d\u308b\u30e6\u30fc\u30b6\u30fc\u3060\u3051\u306b\u5b9f\u884c\u3092\u9650\u5b9a\u3057\u3066\u304f\u3060\u3055\u3044: if: contains(fromJSON('[\"OWNER\",\"MEMBER\",\"COLLABORATOR\"]'), github.event.comment.author_association)",
+	"Job '%s' needs this repository's secrets, environments or runners but has no github.repository guard, so forks run it too":                                                                                                        "\u30b8\u30e7\u30d6 '%s' \u306f\u3053\u306e\u30ea\u30dd\u30b8\u30c8\u30ea\u306e\u30b7\u30fc\u30af\u30ec\u30c3\u30c8\u3001\u74b0\u5883\u307e\u305f\u306f\u30e9\u30f3\u30ca\u30fc\u3092\u5fc5\u8981\u3068\u3057\u307e\u3059\u304c\u3001github.repository \u306e\u6761\u4ef6\u304c\u306a\u3044\u305f\u3081\u30d5\u30a9\u30fc\u30af\u3067\u3082\u5b9f\u884c\u3055\u308c\u307e\u3059",
+	"Add a guard with your repository's name to the job: %s":                                                                                                                                                                           "\u30ea\u30dd\u30b8\u30c8\u30ea\u540d\u3092\u4f7f\u3063\u305f\u6761\u4ef6\u3092\u30b8\u30e7\u30d6\u306b\u8ffd\u52a0\u3057\u3066\u304f\u3060\u3055\u3044: %s",
+
+	"Invalid expression: %s": "\u7121\u52b9\u306a\u5f0f: %s",
+	"See https://docs.github.com/actions/learn-github-actions/expressions for the syntax, functions and contexts":                       "\u69cb\u6587\u3001\u95a2\u6570\u3001\u30b3\u30f3\u30c6\u30ad\u30b9\u30c8\u306b\u3064\u3044\u3066\u306f https://docs.github.com/actions/learn-github-actions/expressions \u3092\u53c2\u7167\u3057\u3066\u304f\u3060\u3055\u3044",
+	"text outside ${{ }} makes the condition a string, which is always true; put the whole condition inside ${{ }} or leave ${{ }} out": "${{ }} \u306e\u5916\u5074\u306b\u30c6\u30ad\u30b9\u30c8\u304c\u3042\u308b\u305f\u3081\u6761\u4ef6\u306f\u6587\u5b57\u5217\u306b\u306a\u308a\u3001\u5e38\u306b\u771f\u306b\u306a\u308a\u307e\u3059\u3002\u6761\u4ef6\u5168\u4f53\u3092 ${{ }} \u306e\u4e2d\u306b\u5165\u308c\u308b\u304b\u3001${{ }} \u3092\u5916\u3057\u3066\u304f\u3060\u3055\u3044",
+	"${{ has no closing }}":                                          "${{ \u306b\u5bfe\u5fdc\u3059\u308b }} \u304c\u3042\u308a\u307e\u305b\u3093",
+	"unterminated string":                                            "\u6587\u5b57\u5217\u304c\u9589\u3058\u3089\u308c\u3066\u3044\u307e\u305b\u3093",
+	"strings must use single quotes":                                 "\u6587\u5b57\u5217\u306b\u306f\u30b7\u30f3\u30b0\u30eb\u30af\u30a9\u30fc\u30c8\u3092\u4f7f\u3063\u3066\u304f\u3060\u3055\u3044",
+	"use == to compare, not =":                                       "\u6bd4\u8f03\u306b\u306f = \u3067\u306f\u306a\u304f == \u3092\u4f7f\u3063\u3066\u304f\u3060\u3055\u3044",
+	"use %[1]s%[1]s, not a single %[1]s":                             "%[1]s \u3092 1 \u3064\u3067\u306f\u306a\u304f %[1]s%[1]s \u3092\u4f7f\u3063\u3066\u304f\u3060\u3055\u3044",
+	"$%[1]s is a shell variable; read it as env.%[1]s or vars.%[1]s": "$%[1]s \u306f\u30b7\u30a7\u30eb\u5909\u6570\u3067\u3059\u3002env.%[1]s \u307e\u305f\u306f vars.%[1]s \u3068\u3057\u3066\u53c2\u7167\u3057\u3066\u304f\u3060\u3055\u3044",
+	"unexpected character '%s'":                                      "\u4e88\u671f\u3057\u306a\u3044\u6587\u5b57 '%s'",
+	"empty expression":                                               "\u5f0f\u304c\u7a7a\u3067\u3059",
+	"unexpected '%s'":                                                "\u4e88\u671f\u3057\u306a\u3044 '%s'",
+	"unexpected '%s' where %s was expected":                          "%[2]s \u304c\u5fc5\u8981\u306a\u4f4d\u7f6e\u306b\u4e88\u671f\u3057\u306a\u3044 '%[1]s' \u304c\u3042\u308a\u307e\u3059",
+	"expression ends where %s was expected":                          "%s \u304c\u5fc5\u8981\u306a\u4f4d\u7f6e\u3067\u5f0f\u304c\u7d42\u308f\u3063\u3066\u3044\u307e\u3059",
+	"a property name":                                                "\u30d7\u30ed\u30d1\u30c6\u30a3\u540d",
+	"a value":                                                        "\u5024",
+	"unknown context '%s'":                                           "\u4e0d\u660e\u306a\u30b3\u30f3\u30c6\u30ad\u30b9\u30c8 '%s'",
+	"unknown function '%s'":                                          "\u4e0d\u660e\u306a\u95a2\u6570 '%s'",
+	"%s() does not take %d arguments":                                "%s() \u306f %d \u500b\u306e\u5f15\u6570\u3092\u53d6\u308a\u307e\u305b\u3093",
+
+	"Job '%s' needs itself":                                                                 "\u30b8\u30e7\u30d6 '%s' \u304c\u81ea\u5206\u81ea\u8eab\u3092 needs \u306b\u6307\u5b9a\u3057\u3066\u3044\u307e\u3059",
+	"Remove '%s' from its own needs":                                                        "'%s' \u3092\u81ea\u8eab\u306e needs \u304b\u3089\u524a\u9664\u3057\u3066\u304f\u3060\u3055\u3044",
+	"Job '%s' needs '%s', which is not a job in this workflow":                              "\u30b8\u30e7\u30d6 '%s' \u306e needs \u306b\u3042\u308b '%s' \u306f\u3053\u306e\u30ef\u30fc\u30af\u30d5\u30ed\u30fc\u306e\u30b8\u30e7\u30d6\u3067\u306f\u3042\u308a\u307e\u305b\u3093",
+	"Jobs %s need each other, so none of them can start":                                    "\u30b8\u30e7\u30d6 %s \u304c\u4e92\u3044\u3092 needs \u306b\u6307\u5b9a\u3057\u3066\u3044\u308b\u305f\u3081\u3001\u3069\u308c\u3082\u958b\u59cb\u3067\u304d\u307e\u305b\u3093",
+	"Remove '%s' from the needs of '%s', or merge the jobs":                                 "'%[2]s' \u306e needs \u304b\u3089 '%[1]s' \u3092\u524a\u9664\u3059\u308b\u304b\u3001\u30b8\u30e7\u30d6\u3092\u7d71\u5408\u3057\u3066\u304f\u3060\u3055\u3044",
+	"Job '%s' never runs: its condition '%s' is always false":                               "\u30b8\u30e7\u30d6 '%s' \u306f\u5b9f\u884c\u3055\u308c\u307e\u305b\u3093: \u6761\u4ef6 '%s' \u304c\u5e38\u306b\u507d\u3067\u3059",
+	"Remove the job, or its if: when it should run":                                         "\u30b8\u30e7\u30d6\u3092\u524a\u9664\u3059\u308b\u304b\u3001\u5b9f\u884c\u3059\u3079\u304d\u306a\u3089 if: \u3092\u524a\u9664\u3057\u3066\u304f\u3060\u3055\u3044",
+	"Job '%s' never runs: it needs '%s', which never runs":                                  "\u30b8\u30e7\u30d6 '%s' \u306f\u5b9f\u884c\u3055\u308c\u307e\u305b\u3093: needs \u306e '%s' \u304c\u5b9f\u884c\u3055\u308c\u306a\u3044\u305f\u3081\u3067\u3059",
+	"Fix the condition of '%s', or add 'if: ${{ !cancelled() }}' to run after skipped jobs": "'%s' \u306e\u6761\u4ef6\u3092\u4fee\u6b63\u3059\u308b\u304b\u3001\u30b9\u30ad\u30c3\u30d7\u3055\u308c\u305f\u30b8\u30e7\u30d6\u306e\u5f8c\u3067\u3082\u5b9f\u884c\u3059\u308b\u306b\u306f 'if: ${{ !cancelled() }}' \u3092\u8ffd\u52a0\u3057\u3066\u304f\u3060\u3055\u3044",
+	"Step %d of job '%s' never runs: its condition '%s' is always false":                    "\u30b8\u30e7\u30d6 '%[2]s' \u306e\u30b9\u30c6\u30c3\u30d7 %[1]d \u306f\u5b9f\u884c\u3055\u308c\u307e\u305b\u3093: \u6761\u4ef6 '%[3]s' \u304c\u5e38\u306b\u507d\u3067\u3059",
+	"Remove the step, or its if: when it should run":                                        "\u30b9\u30c6\u30c3\u30d7\u3092\u524a\u9664\u3059\u308b\u304b\u3001\u5b9f\u884c\u3059\u3079\u304d\u306a\u3089 if: \u3092\u524a\u9664\u3057\u3066\u304f\u3060\u3055\u3044",
+	"Step %d of job '%s' never runs: step %d always exits with status %d":                   "\u30b8\u30e7\u30d6 '%[2]s' \u306e\u30b9\u30c6\u30c3\u30d7 %[1]d \u306f\u5b9f\u884c\u3055\u308c\u307e\u305b\u3093: \u30b9\u30c6\u30c3\u30d7 %[3]d \u304c\u5e38\u306b\u30b9\u30c6\u30fc\u30bf\u30b9 %[4]d \u3067\u7d42\u4e86\u3057\u307e\u3059",
+	"Remove the exit from step %d, or add 'if: always()' to steps that should run after it": "\u30b9\u30c6\u30c3\u30d7 %d \u306e exit \u3092\u524a\u9664\u3059\u308b\u304b\u3001\u305d\u306e\u5f8c\u306b\u5b9f\u884c\u3059\u3079\u304d\u30b9\u30c6\u30c3\u30d7\u306b 'if: always()' \u3092\u8ffd\u52a0\u3057\u3066\u304f\u3060\u3055\u3044",
+
+	"Unknown key '%s' in %s":                                "%[2]s に不明なキー '%[1]s' があります",
+	"Remove it or check the spelling against the %s schema": "削除するか、%s スキーマでつづりを確認してください",
+	"Did you mean '%s'?":                                    "'%s' のことですか？",
+	"%s has type %s, but the schema expects %s":             "%s の型は %s ですが、スキーマでは %s が必要です",
+	"Check the %s schema for the expected value":            "%s スキーマで期待される値を確認してください",
+	"'%s' is not a valid value for %s":                      "'%s' は %s の有効な値ではありません",
+	"Use one of: %s":                                        "次のいずれかを使ってください: %s",
+	"%s is missing the required key '%s'":                   "%s に必須キー '%s' がありません",
+	"%s needs one of: %s":                                   "%s には次のいずれかが必要です: %s",
+	"Unknown trigger '%s'":                                  "不明なトリガー '%s'",
+	"See https://docs.github.com/actions/using-workflows/events-that-trigger-workflows": "https://docs.github.com/ja/actions/using-workflows/events-that-trigger-workflows を参照してください",
+	"the document": "ドキュメント",
+
+	// Score report
+	"CI/CD Maturity Scorecard": "CI/CD 成熟度スコアカード",
+	"Overall: %d/100 (%s)":     "総合: %d/100 (%s)",
+	"Deductions:":              "減点:",
+	"containerization":         "コンテナ化",
+	"testing":                  "テスト",
+	"security":                 "セキュリティ",
+	"speed":                    "速度",
+	"deployability":            "デプロイ",
+
+	// Optimization report
+	"Optimization Report: %s":                              "最適化レポート: %s",
+	"Potential time savings: %s":                           "短縮できる可能性のある時間: %s",
+	"No optimizations needed - your pipeline looks great!": "最適化は不要です。パイプラインは良好です！",
+	"High Impact:":                                         "影響大:",
+	"Medium Impact:":                                       "影響中:",
+	"Low Impact:":                                          "影響小:",
+	" [auto-fixable]":                                      " [自動修正可能]",
+	"Estimated save: %s":                                   "推定短縮時間: %s",
+	"Benchmark: %s":                                        "ベンチマーク: %s",
+	"Runner: %s (%d runs each)":                            "ランナー: %s (各 %d 回実行)",
+	"Applied:":                                             "適用済み:",
+	"Before:":                                              "適用前:",
+	"After:":                                               "適用後:",
+	"Delta:":                                               "差分:",
+	"Estimated:":                                           "見積もり:",
+	"The optimized workflow was not faster; keep the original or benchmark with more runs": "最適化後のワークフローは速くなりませんでした。元のままにするか、実行回数を増やして再計測してください",
+
+	// Analysis report
+	"Project Analysis Report": "プロジェクト分析レポート",
+	"Project: %s":             "プロジェクト: %s",
+	"Language: %s":            "言語: %s",
+	"Framework: %s":           "フレームワーク: %s",
+	"Package Manager: %s":     "パッケージマネージャー: %s",
+	"Commands:":               "コマンド:",
+	"Build: %s":               "ビルド: %s",
+	"Test:  %s":               "テスト: %s",
+	"Detection:":              "検出結果:",
+	"Ports:  %v":              "ポート: %v",
+	"Quality: %s":             "品質ツール: %s",
+	"Codegen: %s":             "コード生成: %s",
+	"Bazel: %s":               "Bazel: %s",
+	"E2E: %s (%s)":            "E2E: %s (%s)",
+	"Monorepo: %s (%s)":       "モノレポ: %s (%s)",
+	"Suggestions:":            "提案:",
+}
@@ -0,0 +1,63 @@
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Supported lists the languages with a message catalog
+var Supported = []string{"en", "es", "ja"}
+
+// catalogs maps a language to translations keyed by the English format string
+var catalogs = map[string]map[string]string{
+	"es": spanish,
+	"ja": japanese,
+}
+
+var current = "en"
+
+// SetLanguage selects the output language. Locale strings such as
+// "es_ES.UTF-8" are accepted; unknown languages fall back to English.
+func SetLanguage(lang string) {
+	current = normalize(lang)
+}
+
+// Language returns the active language code
+func Language() string {
+	return current
+}
+
+// Detect picks the language from LC_ALL, LC_MESSAGES or LANG
+func Detect() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(key); v != "" {
+			return normalize(v)
+		}
+	}
+	return "en"
+}
+
+func normalize(lang string) string {
+	lang = strings.ToLower(lang)
+	if i := strings.IndexAny(lang, "_.-@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := catalogs[lang]; ok {
+		return lang
+	}
+	return "en"
+}
+
+// T translates an English format string and applies args
+func T(format string, args ...interface{}) string {
+	if catalog, ok := catalogs[current]; ok {
+		if translated, ok := catalog[format]; ok {
+			format = translated
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
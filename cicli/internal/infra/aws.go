@@ -0,0 +1,369 @@
+package infra
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"cicli/internal/config"
+)
+
+// Clouds are the values --cloud accepts
+var Clouds = []string{"aws"}
+
+// awsRegion is used when cicli.yaml sets no region
+const awsRegion = "us-east-1"
+
+// AWSInput holds what the Terraform for AWS is generated from
+type AWSInput struct {
+	Project      string
+	Repository   string   // GitHub owner/name whose workflows assume the role
+	Branch       string   // branch that pushes images
+	Region       string   // AWS region
+	Environments []string // GitHub environments the deploy job runs in
+	ECR          []string // ECR repositories the images are pushed to
+	Clusters     []string // EKS clusters the role deploys to
+}
+
+// NewAWSInput collects the region, environments, images and EKS clusters of
+// a project from cicli.yaml, which may be nil. Repository is left empty.
+func NewAWSInput(project string, cfg *config.Config) AWSInput {
+	in := AWSInput{Project: project, Branch: "main", Region: awsRegion}
+	if cfg == nil {
+		in.Environments = []string{"prod"}
+		in.ECR = []string{project}
+		return in
+	}
+
+	if cfg.ProjectName != "" {
+		in.Project = cfg.ProjectName
+	}
+	if cfg.Deploy.Region != "" {
+		in.Region = cfg.Deploy.Region
+	}
+	for env := range cfg.Environments {
+		in.Environments = append(in.Environments, env)
+	}
+	sort.Strings(in.Environments)
+	if len(in.Environments) == 0 {
+		in.Environments = []string{"prod"}
+	}
+
+	images := []string{cfg.Docker.ImageName}
+	for _, svc := range cfg.Services {
+		if resolved, err := cfg.ServiceNamed(svc.Name); err == nil {
+			images = append(images, resolved.Image)
+		}
+	}
+	for _, image := range images {
+		if name := ecrRepository(image); name != "" && !contains(in.ECR, name) {
+			in.ECR = append(in.ECR, name)
+		}
+	}
+	if len(in.ECR) == 0 {
+		in.ECR = []string{in.Project}
+	}
+
+	for _, env := range in.Environments {
+		for _, cluster := range cfg.ClustersFor(env) {
+			if (cluster.Provider == "aws" || cluster.Provider == "eks") && cluster.ClusterName != "" && !contains(in.Clusters, cluster.ClusterName) {
+				in.Clusters = append(in.Clusters, cluster.ClusterName)
+			}
+		}
+	}
+	return in
+}
+
+// ecrRepository returns the repository path of an image reference: the
+// part after the registry host and before the tag
+func ecrRepository(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	if host, rest, found := strings.Cut(image, "/"); found && strings.ContainsAny(host, ".:") {
+		image = rest
+	}
+	return strings.ToLower(image)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AWS returns the Terraform files for the AWS resources generated pipelines
+// assume, by file name: main.tf, variables.tf and outputs.tf
+func AWS(in AWSInput) (map[string]string, error) {
+	files := map[string]string{"main.tf": awsMain, "outputs.tf": awsOutputs}
+	tmpl, err := template.New("variables.tf").Funcs(template.FuncMap{"list": hclList}).Parse(awsVariables)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, in); err != nil {
+		return nil, err
+	}
+	files["variables.tf"] = buf.String()
+	return files, nil
+}
+
+// hclList formats strings as an HCL list
+func hclList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+const awsVariables = `variable "region" {
+  description = "AWS region of the ECR repositories and the cache bucket"
+  type        = string
+  default     = "{{ .Region }}"
+}
+
+variable "github_repository" {
+  description = "GitHub repository (owner/name) whose workflows assume the CI role"
+  type        = string
+  default     = "{{ .Repository }}"
+}
+
+variable "github_branch" {
+  description = "Branch whose push workflows build and push images"
+  type        = string
+  default     = "{{ .Branch }}"
+}
+
+variable "github_environments" {
+  description = "GitHub environments the deploy job runs in"
+  type        = list(string)
+  default     = {{ list .Environments }}
+}
+
+variable "ecr_repositories" {
+  description = "ECR repositories that cicli docker publish pushes to"
+  type        = list(string)
+  default     = {{ list .ECR }}
+}
+
+variable "eks_clusters" {
+  description = "EKS clusters that cicli deploy rolls out to"
+  type        = list(string)
+  default     = {{ list .Clusters }}
+}
+
+variable "cache_bucket_name" {
+  description = "S3 bucket for build caches shared between runners; empty to skip it"
+  type        = string
+  default     = "{{ .Project }}-ci-cache"
+}
+
+variable "create_oidc_provider" {
+  description = "Create the GitHub OIDC provider; set to false when the account already has one"
+  type        = bool
+  default     = true
+}
+
+variable "role_name" {
+  description = "Name of the IAM role the workflows assume"
+  type        = string
+  default     = "{{ .Project }}-github-actions"
+}
+`
+
+const awsMain = `terraform {
+  required_version = ">= 1.5"
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = ">= 5.40"
+    }
+  }
+}
+
+provider "aws" {
+  region = var.region
+}
+
+data "aws_caller_identity" "current" {}
+
+# GitHub's OIDC provider lets workflows assume the role without stored keys.
+# An account has at most one, so reuse it with create_oidc_provider = false.
+resource "aws_iam_openid_connect_provider" "github" {
+  count           = var.create_oidc_provider ? 1 : 0
+  url             = "https://token.actions.githubusercontent.com"
+  client_id_list  = ["sts.amazonaws.com"]
+  thumbprint_list = ["6938fd4d98bab03faadb97b34396831e3780aea1", "1c58a3a8518e8759bf075b76b750d4f2df264fcd"]
+}
+
+data "aws_iam_openid_connect_provider" "github" {
+  count = var.create_oidc_provider ? 0 : 1
+  url   = "https://token.actions.githubusercontent.com"
+}
+
+locals {
+  oidc_provider_arn = var.create_oidc_provider ? aws_iam_openid_connect_provider.github[0].arn : data.aws_iam_openid_connect_provider.github[0].arn
+  # Pushes to the branch build images; deploy jobs run in an environment
+  subjects = concat(
+    ["repo:${var.github_repository}:ref:refs/heads/${var.github_branch}"],
+    [for env in var.github_environments : "repo:${var.github_repository}:environment:${env}"],
+  )
+}
+
+data "aws_iam_policy_document" "assume" {
+  statement {
+    actions = ["sts:AssumeRoleWithWebIdentity"]
+    principals {
+      type        = "Federated"
+      identifiers = [local.oidc_provider_arn]
+    }
+    condition {
+      test     = "StringEquals"
+      variable = "token.actions.githubusercontent.com:aud"
+      values   = ["sts.amazonaws.com"]
+    }
+    condition {
+      test     = "StringEquals"
+      variable = "token.actions.githubusercontent.com:sub"
+      values   = local.subjects
+    }
+  }
+}
+
+# The role of the AWS_ROLE_ARN secret
+resource "aws_iam_role" "github_actions" {
+  name               = var.role_name
+  assume_role_policy = data.aws_iam_policy_document.assume.json
+}
+
+resource "aws_ecr_repository" "images" {
+  for_each             = toset(var.ecr_repositories)
+  name                 = each.value
+  image_tag_mutability = "MUTABLE"
+  image_scanning_configuration {
+    scan_on_push = true
+  }
+}
+
+resource "aws_s3_bucket" "cache" {
+  count  = var.cache_bucket_name == "" ? 0 : 1
+  bucket = var.cache_bucket_name
+}
+
+resource "aws_s3_bucket_public_access_block" "cache" {
+  count                   = length(aws_s3_bucket.cache)
+  bucket                  = aws_s3_bucket.cache[0].id
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+# Caches are rebuilt on a miss, so old entries are dropped
+resource "aws_s3_bucket_lifecycle_configuration" "cache" {
+  count  = length(aws_s3_bucket.cache)
+  bucket = aws_s3_bucket.cache[0].id
+  rule {
+    id     = "expire"
+    status = "Enabled"
+    filter {}
+    expiration {
+      days = 30
+    }
+  }
+}
+
+data "aws_iam_policy_document" "ci" {
+  statement {
+    sid       = "EcrLogin"
+    actions   = ["ecr:GetAuthorizationToken"]
+    resources = ["*"]
+  }
+  statement {
+    sid = "EcrPush"
+    actions = [
+      "ecr:BatchCheckLayerAvailability",
+      "ecr:BatchGetImage",
+      "ecr:CompleteLayerUpload",
+      "ecr:DescribeImages",
+      "ecr:GetDownloadUrlForLayer",
+      "ecr:InitiateLayerUpload",
+      "ecr:PutImage",
+      "ecr:UploadLayerPart",
+    ]
+    resources = [for repo in aws_ecr_repository.images : repo.arn]
+  }
+  dynamic "statement" {
+    for_each = aws_s3_bucket.cache
+    content {
+      sid       = "Cache"
+      actions   = ["s3:GetObject", "s3:PutObject", "s3:DeleteObject", "s3:ListBucket"]
+      resources = [statement.value.arn, "${statement.value.arn}/*"]
+    }
+  }
+  dynamic "statement" {
+    for_each = length(var.eks_clusters) > 0 ? [1] : []
+    content {
+      sid       = "EksKubeconfig"
+      actions   = ["eks:DescribeCluster"]
+      resources = [for name in var.eks_clusters : "arn:aws:eks:${var.region}:${data.aws_caller_identity.current.account_id}:cluster/${name}"]
+    }
+  }
+}
+
+resource "aws_iam_role_policy" "ci" {
+  name   = "ci"
+  role   = aws_iam_role.github_actions.id
+  policy = data.aws_iam_policy_document.ci.json
+}
+
+# Lets the role apply manifests: the clusters must use the API or
+# API_AND_CONFIG_MAP authentication mode
+resource "aws_eks_access_entry" "github_actions" {
+  for_each      = toset(var.eks_clusters)
+  cluster_name  = each.value
+  principal_arn = aws_iam_role.github_actions.arn
+}
+
+resource "aws_eks_access_policy_association" "github_actions" {
+  for_each      = aws_eks_access_entry.github_actions
+  cluster_name  = each.value.cluster_name
+  principal_arn = each.value.principal_arn
+  policy_arn    = "arn:aws:eks::aws:cluster-access-policy/AmazonEKSEditPolicy"
+  access_scope {
+    type = "cluster"
+  }
+}
+`
+
+const awsOutputs = `output "role_arn" {
+  description = "Store as the AWS_ROLE_ARN secret"
+  value       = aws_iam_role.github_actions.arn
+}
+
+output "region" {
+  description = "Store as the AWS_REGION variable"
+  value       = var.region
+}
+
+output "registry" {
+  description = "ECR registry the deploy job pushes to; amazon-ecr-login returns it"
+  value       = "${data.aws_caller_identity.current.account_id}.dkr.ecr.${var.region}.amazonaws.com"
+}
+
+output "repository_urls" {
+  description = "ECR repository of each image"
+  value       = { for name, repo in aws_ecr_repository.images : name => repo.repository_url }
+}
+
+output "cache_bucket" {
+  description = "S3 bucket for build caches"
+  value       = one(aws_s3_bucket.cache[*].bucket)
+}
+`
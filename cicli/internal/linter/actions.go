@@ -0,0 +1,62 @@
+package linter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// latestActionVersions maps well-known actions to their current major version
+var latestActionVersions = map[string]int{
+	"actions/checkout":           4,
+	"actions/setup-node":         4,
+	"actions/setup-python":       5,
+	"actions/setup-go":           5,
+	"actions/cache":              4,
+	"actions/upload-artifact":    4,
+	"actions/download-artifact":  4,
+	"docker/build-push-action":   6,
+	"docker/login-action":        3,
+	"docker/metadata-action":     5,
+	"docker/setup-buildx-action": 3,
+}
+
+// outdatedActionPattern matches a uses: reference pinned to a version tag.
+// The full tag (v3, v3.1, v3.1.0) is captured so a fix replaces all of it.
+var outdatedActionPattern = regexp.MustCompile(`(uses:\s*["']?)([^@\s"']+)@(v(\d+)(?:\.\d+)*)`)
+
+// outdatedAction reports the latest major version for the action on line
+// when the line pins an older one
+func outdatedAction(line string) (action string, version, latest int, ok bool) {
+	m := outdatedActionPattern.FindStringSubmatch(line)
+	if m == nil {
+		return "", 0, 0, false
+	}
+	latest, known := latestActionVersions[m[2]]
+	version, _ = strconv.Atoi(m[4])
+	if !known || version >= latest {
+		return "", 0, 0, false
+	}
+	return m[2], version, latest, true
+}
+
+// FixOutdatedActions bumps every outdated action reference to its latest
+// major tag. Only the version on the uses: line changes, so quoting and
+// trailing comments are kept.
+func FixOutdatedActions(content []byte) ([]byte, bool) {
+	lines := strings.Split(string(content), "\n")
+	changed := false
+	for i, line := range lines {
+		_, _, latest, ok := outdatedAction(line)
+		if !ok {
+			continue
+		}
+		loc := outdatedActionPattern.FindStringSubmatchIndex(line)
+		lines[i] = line[:loc[6]] + "v" + strconv.Itoa(latest) + line[loc[7]:]
+		changed = true
+	}
+	if !changed {
+		return content, false
+	}
+	return []byte(strings.Join(lines, "\n")), true
+}
@@ -0,0 +1,174 @@
+package linter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConcurrencyGroup keys runs by pull request number, falling back to the ref
+// for pushes, so a new commit on a PR replaces the run for the previous one
+const ConcurrencyGroup = "${{ github.workflow }}-${{ github.event.pull_request.number || github.ref }}"
+
+// pullRequestEvents are the triggers whose runs are superseded by the next push
+var pullRequestEvents = map[string]bool{
+	"pull_request":        true,
+	"pull_request_target": true,
+}
+
+// deployCommandPattern matches run: commands that change a live environment
+var deployCommandPattern = regexp.MustCompile(`\b(kubectl\s+(apply|set|rollout)|helm\s+(upgrade|install)|terraform\s+apply|cicli\s+(deploy|promote)|gcloud\s+run\s+deploy|aws\s+ecs\s+update-service|flyctl\s+deploy|vercel\s+(--prod|deploy))\b`)
+
+// concurrencyPlan describes the concurrency block a workflow should get
+type concurrencyPlan struct {
+	Triggers   []string
+	PullReq    bool   // triggered by pull requests
+	Deploy     bool   // changes a live environment, so runs must not be cancelled
+	Configured bool   // already has a top-level or job-level concurrency key
+	Cancel     string // value for cancel-in-progress
+}
+
+// Fixable reports whether FixConcurrency would add a block
+func (p concurrencyPlan) Fixable() bool {
+	return p.PullReq && !p.Deploy && !p.Configured
+}
+
+// planConcurrency inspects a workflow's triggers and jobs. Workflows that
+// only run for pull requests cancel unconditionally; when they also run on
+// push, only pull request runs are cancelled so every commit on the default
+// branch still gets a complete run.
+func planConcurrency(content []byte) (concurrencyPlan, bool) {
+	var plan concurrencyPlan
+
+	var workflow map[string]interface{}
+	if err := yaml.Unmarshal(content, &workflow); err != nil || workflow == nil {
+		return plan, false
+	}
+
+	plan.Triggers = workflowTriggers(workflow["on"])
+	for _, t := range plan.Triggers {
+		if pullRequestEvents[t] {
+			plan.PullReq = true
+		}
+	}
+
+	_, plan.Configured = workflow["concurrency"]
+	jobs, _ := workflow["jobs"].(map[string]interface{})
+	for name, data := range jobs {
+		job, ok := data.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := job["concurrency"]; ok {
+			plan.Configured = true
+		}
+		if isDeployJob(name, job) {
+			plan.Deploy = true
+		}
+	}
+
+	plan.Cancel = "true"
+	for _, t := range plan.Triggers {
+		if !pullRequestEvents[t] && t != "workflow_dispatch" {
+			plan.Cancel = "${{ startsWith(github.event_name, 'pull_request') }}"
+			break
+		}
+	}
+
+	return plan, true
+}
+
+// workflowTriggers returns the event names of an on: value, which may be a
+// single event, a list of events or a map of events to their filters
+func workflowTriggers(on interface{}) []string {
+	var triggers []string
+	switch v := on.(type) {
+	case string:
+		triggers = append(triggers, v)
+	case []interface{}:
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				triggers = append(triggers, s)
+			}
+		}
+	case map[string]interface{}:
+		for e := range v {
+			triggers = append(triggers, e)
+		}
+	}
+	sort.Strings(triggers)
+	return triggers
+}
+
+// isDeployJob reports whether a job targets an environment or runs
+// deployment commands
+func isDeployJob(name string, job map[string]interface{}) bool {
+	if _, ok := job["environment"]; ok {
+		return true
+	}
+	if strings.Contains(strings.ToLower(name), "deploy") {
+		return true
+	}
+	if n, ok := job["name"].(string); ok && strings.Contains(strings.ToLower(n), "deploy") {
+		return true
+	}
+
+	steps, _ := job["steps"].([]interface{})
+	for _, s := range steps {
+		step, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if n, ok := step["name"].(string); ok && strings.Contains(strings.ToLower(n), "deploy") {
+			return true
+		}
+		if run, ok := step["run"].(string); ok && deployCommandPattern.MatchString(run) {
+			return true
+		}
+	}
+	return false
+}
+
+// FixConcurrency adds a top-level concurrency block to pull request
+// workflows so superseded runs are cancelled. Deploy workflows and workflows
+// that already configure concurrency are returned unchanged. The block is
+// inserted as text above jobs: so comments and formatting are preserved.
+func FixConcurrency(content []byte) ([]byte, bool) {
+	plan, ok := planConcurrency(content)
+	if !ok || !plan.Fixable() {
+		return content, false
+	}
+
+	lines := strings.Split(string(content), "\n")
+	at := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "jobs:") {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return content, false
+	}
+	// Keep comments that introduce jobs: attached to it
+	for at > 0 && strings.HasPrefix(lines[at-1], "#") {
+		at--
+	}
+
+	block := []string{
+		"concurrency:",
+		"  group: " + ConcurrencyGroup,
+		"  cancel-in-progress: " + plan.Cancel,
+		"",
+	}
+	if at > 0 && strings.TrimSpace(lines[at-1]) != "" {
+		block = append([]string{""}, block...)
+	}
+
+	updated := append([]string{}, lines[:at]...)
+	updated = append(updated, block...)
+	updated = append(updated, lines[at:]...)
+	return []byte(strings.Join(updated, "\n")), true
+}
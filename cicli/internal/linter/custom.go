@@ -0,0 +1,123 @@
+package linter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// allPlatforms are the platforms a registered rule applies to when it names none
+var allPlatforms = []string{"github", "gitlab", "circleci", "azure", "jenkins", "bitbucket"}
+
+// registered holds the rules added with RegisterRule; every Linter created
+// afterwards runs them after the built-in rules
+var registered []Rule
+
+// RegisterRule adds a rule to every Linter created afterwards. Organization
+// rules written in Go call it from an init function in a file added to the
+// build; declarative rules from cicli.yaml go through CustomRule.Register.
+func RegisterRule(rule Rule) error {
+	if rule.ID == "" {
+		return fmt.Errorf("lint rule has no id")
+	}
+	if rule.Check == nil {
+		return fmt.Errorf("lint rule %s has no check", rule.ID)
+	}
+	builtin := &Linter{}
+	builtin.registerRules()
+	for _, existing := range append(builtin.rules, registered...) {
+		if existing.ID == rule.ID {
+			return fmt.Errorf("lint rule %s is already defined", rule.ID)
+		}
+	}
+	if rule.Name == "" {
+		rule.Name = strings.ToLower(rule.ID)
+	}
+	if rule.Severity == "" {
+		rule.Severity = Warning
+	}
+	if len(rule.Platforms) == 0 {
+		rule.Platforms = allPlatforms
+	}
+	registered = append(registered, rule)
+	return nil
+}
+
+// CustomRule is a declarative lint rule from the lint.rules section of
+// cicli.yaml. A forbid rule reports every line its pattern matches; a
+// require rule reports files in which its pattern matches no line.
+type CustomRule struct {
+	ID          string   `yaml:"id"`
+	Name        string   `yaml:"name,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	Severity    Severity `yaml:"severity,omitempty"`  // error, warning (default) or info
+	Platforms   []string `yaml:"platforms,omitempty"` // default every platform
+	Forbid      string   `yaml:"forbid,omitempty"`    // regexp that must not match any line
+	Require     string   `yaml:"require,omitempty"`   // regexp that must match some line
+	When        string   `yaml:"when,omitempty"`      // regexp; the rule only checks files it matches
+	Message     string   `yaml:"message"`
+	Suggestion  string   `yaml:"suggestion,omitempty"`
+}
+
+// Register compiles the rule and adds it with RegisterRule
+func (c CustomRule) Register() error {
+	if (c.Forbid == "") == (c.Require == "") {
+		return fmt.Errorf("lint rule %s: set exactly one of forbid and require", c.ID)
+	}
+	if c.Message == "" {
+		return fmt.Errorf("lint rule %s has no message", c.ID)
+	}
+	switch c.Severity {
+	case "", Error, Warning, Info:
+	default:
+		return fmt.Errorf("lint rule %s: unknown severity %q (supported: error, warning, info)", c.ID, c.Severity)
+	}
+
+	// ^ and $ match at line boundaries, as they do in forbid's per-line matching
+	pattern, err := regexp.Compile("(?m)" + c.Forbid + c.Require)
+	if err != nil {
+		return fmt.Errorf("lint rule %s: %w", c.ID, err)
+	}
+	var when *regexp.Regexp
+	if c.When != "" {
+		if when, err = regexp.Compile("(?m)" + c.When); err != nil {
+			return fmt.Errorf("lint rule %s: when: %w", c.ID, err)
+		}
+	}
+	if c.Severity == "" {
+		c.Severity = Warning
+	}
+	description := c.Description
+	if description == "" {
+		description = c.Message
+	}
+
+	return RegisterRule(Rule{
+		ID:          c.ID,
+		Name:        c.Name,
+		Description: description,
+		Severity:    c.Severity,
+		Platforms:   c.Platforms,
+		Check: func(content []byte, file string) []Issue {
+			if when != nil && !when.Match(content) {
+				return nil
+			}
+			issue := Issue{Severity: c.Severity, Message: c.Message, File: file, Suggestion: c.Suggestion}
+			if c.Require != "" {
+				if pattern.Match(content) {
+					return nil
+				}
+				return []Issue{issue}
+			}
+
+			var issues []Issue
+			for lineNum, line := range strings.Split(string(content), "\n") {
+				if pattern.MatchString(line) {
+					issue.Line = lineNum + 1
+					issues = append(issues, issue)
+				}
+			}
+			return issues
+		},
+	})
+}
@@ -0,0 +1,274 @@
+package linter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cicli/internal/i18n"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// falseConditions are if: values that can never be true
+	falseConditions = map[string]bool{"false": true, "0": true, "''": true, "null": true, "!true": true, "!1": true}
+	// rescuePattern matches conditions that run a job after a needed job was
+	// skipped or failed, or a step after an earlier step failed
+	rescuePattern = regexp.MustCompile(`(?i)\b(always|failure|cancelled)\s*\(`)
+	// exitPattern matches a shell exit with a status
+	exitPattern = regexp.MustCompile(`^exit\s+(\d+)\s*(#.*)?$`)
+	// blockOpen and blockClose match the shell keywords that open and close a
+	// compound command at the start of a line
+	blockOpen   = regexp.MustCompile(`^(if|case|for|while|until|select)\b|^\w[\w-]*\s*\(\)|^function\b|\{\s*$`)
+	blockClose  = regexp.MustCompile(`^(fi|esac|done|\})(\s|;|$)`)
+	inlineClose = regexp.MustCompile(`[;\s](fi|esac|done|\})\s*;?$`)
+)
+
+// jobNeeds returns the needs: entries of a job with their nodes
+func jobNeeds(job *yaml.Node) []*yaml.Node {
+	_, needs := mappingEntry(job, "needs")
+	if needs == nil {
+		return nil
+	}
+	if needs.Kind == yaml.ScalarNode {
+		return []*yaml.Node{needs}
+	}
+	var out []*yaml.Node
+	for _, n := range needs.Content {
+		if n.Kind == yaml.ScalarNode {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// alwaysFalse reports whether an if: condition is a constant that is never
+// true, such as false or ${{ false }}
+func alwaysFalse(cond string) bool {
+	c := strings.TrimSpace(cond)
+	if strings.HasPrefix(c, "${{") && strings.HasSuffix(c, "}}") {
+		c = strings.TrimSpace(c[3 : len(c)-2])
+	}
+	c = strings.ToLower(strings.Join(strings.Fields(c), ""))
+	return falseConditions[c] || strings.HasPrefix(c, "false&&")
+}
+
+// checkUnknownNeeds flags needs: entries that name no job of the workflow,
+// which GitHub rejects before any job runs
+func checkUnknownNeeds(content []byte, file string) []Issue {
+	var issues []Issue
+	jobs := workflowJobs(parseRoot(content))
+	names := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		names[job.Name] = true
+	}
+
+	for _, job := range jobs {
+		for _, need := range jobNeeds(job.Body) {
+			issue := Issue{Severity: Error, File: file, Line: need.Line, Column: need.Column}
+			switch {
+			case need.Value == job.Name:
+				issue.Message = i18n.T("Job '%s' needs itself", job.Name)
+				issue.Suggestion = i18n.T("Remove '%s' from its own needs", job.Name)
+			case !names[need.Value]:
+				issue.Message = i18n.T("Job '%s' needs '%s', which is not a job in this workflow", job.Name, need.Value)
+				others := jobNames(jobs, job.Name)
+				issue.Suggestion = i18n.T("Use one of: %s", strings.Join(others, ", "))
+				if close := closestName(need.Value, toSet(others)); close != "" && editDistance(need.Value, close) <= 2 {
+					issue.Suggestion = i18n.T("Did you mean '%s'?", close)
+				}
+			default:
+				continue
+			}
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// jobNames returns the names of the jobs other than skip
+func jobNames(jobs []jobNode, skip string) []string {
+	var names []string
+	for _, job := range jobs {
+		if job.Name != skip {
+			names = append(names, job.Name)
+		}
+	}
+	return names
+}
+
+// checkCircularNeeds flags jobs that need each other, directly or through
+// other jobs. Each cycle is reported once, at the needs: entry that closes it.
+func checkCircularNeeds(content []byte, file string) []Issue {
+	var issues []Issue
+	jobs := workflowJobs(parseRoot(content))
+	needs := make(map[string][]*yaml.Node, len(jobs))
+	for _, job := range jobs {
+		needs[job.Name] = jobNeeds(job.Body)
+	}
+
+	// Depth-first search; state is 1 while a job is on the path, 2 when done
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = 1
+		path = append(path, name)
+		for _, need := range needs[name] {
+			switch state[need.Value] {
+			case 0:
+				if _, ok := needs[need.Value]; ok && need.Value != name {
+					visit(need.Value)
+				}
+			case 1:
+				if need.Value == name {
+					continue // reported by checkUnknownNeeds
+				}
+				start := indexOf(path, need.Value)
+				cycle := append(append([]string{}, path[start:]...), need.Value)
+				issues = append(issues, Issue{
+					Severity:   Error,
+					Message:    i18n.T("Jobs %s need each other, so none of them can start", strings.Join(cycle, " → ")),
+					File:       file,
+					Line:       need.Line,
+					Column:     need.Column,
+					Suggestion: i18n.T("Remove '%s' from the needs of '%s', or merge the jobs", need.Value, name),
+				})
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = 2
+	}
+	for _, job := range jobs {
+		if state[job.Name] == 0 {
+			visit(job.Name)
+		}
+	}
+	return issues
+}
+
+// checkDeadJobs flags jobs whose if: is always false, and jobs that need one
+// of them without an always(), failure() or cancelled() condition: GitHub
+// skips a job when a job it needs was skipped
+func checkDeadJobs(content []byte, file string) []Issue {
+	var issues []Issue
+	jobs := workflowJobs(parseRoot(content))
+
+	dead := make(map[string]string) // job -> the job that makes it dead
+	for _, job := range jobs {
+		if _, cond := mappingEntry(job.Body, "if"); cond != nil && alwaysFalse(cond.Value) {
+			dead[job.Name] = job.Name
+			issues = append(issues, Issue{
+				Severity:   Warning,
+				Message:    i18n.T("Job '%s' never runs: its condition '%s' is always false", job.Name, cond.Value),
+				File:       file,
+				Line:       cond.Line,
+				Column:     cond.Column,
+				Suggestion: i18n.T("Remove the job, or its if: when it should run"),
+			})
+		}
+	}
+
+	// Skips spread along needs until no job changes
+	for changed := true; changed; {
+		changed = false
+		for _, job := range jobs {
+			if _, ok := dead[job.Name]; ok || rescuePattern.MatchString(scalarValue(job.Body, "if")) {
+				continue
+			}
+			for _, need := range jobNeeds(job.Body) {
+				cause, ok := dead[need.Value]
+				if !ok || need.Value == job.Name {
+					continue
+				}
+				dead[job.Name] = cause
+				changed = true
+				issues = append(issues, Issue{
+					Severity:   Warning,
+					Message:    i18n.T("Job '%s' never runs: it needs '%s', which never runs", job.Name, need.Value),
+					File:       file,
+					Line:       need.Line,
+					Column:     need.Column,
+					Suggestion: i18n.T("Fix the condition of '%s', or add 'if: ${{ !cancelled() }}' to run after skipped jobs", cause),
+				})
+				break
+			}
+		}
+	}
+	return issues
+}
+
+// exitStatus returns the status of an exit that every run of a script
+// reaches: a non-zero exit outside if, case, loops and functions. It returns
+// 0 when the script has none.
+func exitStatus(script string) int {
+	depth := 0
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// A one-line compound command opens and closes on the same line
+		opens := blockOpen.MatchString(line)
+		if opens {
+			depth++
+		}
+		if blockClose.MatchString(line) || (opens && inlineClose.MatchString(line)) {
+			depth--
+		}
+		if m := exitPattern.FindStringSubmatch(line); m != nil && depth == 0 {
+			if status, _ := strconv.Atoi(m[1]); status != 0 {
+				return status
+			}
+		}
+	}
+	return 0
+}
+
+// checkUnreachableSteps flags steps whose if: is always false, and steps
+// after one that always exits with an error, which only run with an
+// always(), failure() or cancelled() condition
+func checkUnreachableSteps(content []byte, file string) []Issue {
+	var issues []Issue
+	for _, job := range workflowJobs(parseRoot(content)) {
+		failing := 0 // 1-based number of the step that always fails
+		status := 0
+		for i, step := range jobSteps(job.Body) {
+			_, cond := mappingEntry(step, "if")
+			if cond != nil && alwaysFalse(cond.Value) {
+				issues = append(issues, Issue{
+					Severity:   Warning,
+					Message:    i18n.T("Step %d of job '%s' never runs: its condition '%s' is always false", i+1, job.Name, cond.Value),
+					File:       file,
+					Line:       cond.Line,
+					Column:     cond.Column,
+					Suggestion: i18n.T("Remove the step, or its if: when it should run"),
+				})
+				continue
+			}
+
+			if failing > 0 {
+				if cond == nil || !rescuePattern.MatchString(cond.Value) {
+					issues = append(issues, Issue{
+						Severity:   Warning,
+						Message:    i18n.T("Step %d of job '%s' never runs: step %d always exits with status %d", i+1, job.Name, failing, status),
+						File:       file,
+						Line:       step.Line,
+						Column:     step.Column,
+						Suggestion: i18n.T("Remove the exit from step %d, or add 'if: always()' to steps that should run after it", failing),
+					})
+					break
+				}
+				continue
+			}
+
+			if cond == nil && scalarValue(step, "continue-on-error") != "true" {
+				if s := exitStatus(scalarValue(step, "run")); s != 0 {
+					failing, status = i+1, s
+				}
+			}
+		}
+	}
+	return issues
+}
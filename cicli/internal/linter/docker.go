@@ -0,0 +1,657 @@
+package linter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cicli/internal/i18n"
+)
+
+// dockerBuild is a docker build command and the tags pushed after it
+type dockerBuild struct {
+	Context   string
+	File      string
+	Target    string
+	Platforms string
+	BuildArgs []string
+	Tags      []string
+	Pushed    map[string]bool
+}
+
+// dockerLogin is a docker login command
+type dockerLogin struct {
+	Registry string
+	Username string
+	Password string
+}
+
+// dockerStep is a run: step that calls docker
+type dockerStep struct {
+	Script inlineScript
+	Start  int  // 0-based first line of the step item
+	End    int  // 0-based last line of the step item
+	Item   int  // indentation of the step's "- "
+	Build  bool // runs docker build
+	Plain  bool // only runs docker build, tag, push and login, with keys a fix can keep
+}
+
+// dockerJob is the docker usage of one job, and whether FixDockerBuilds can
+// turn it into build-push-action steps
+type dockerJob struct {
+	Steps   []dockerStep
+	Build   *dockerBuild
+	Login   *dockerLogin
+	Fixable bool
+}
+
+var (
+	// shellVariable matches $VAR and ${VAR}, which do not expand in with: inputs
+	shellVariable = regexp.MustCompile(`\$([A-Za-z_(]|\{[^{])`)
+	// dockerStepKeys are the step keys a fix can carry over
+	dockerStepKeys = map[string]bool{"name": true, "run": true, "shell": true, "working-directory": true}
+	stepKeyPattern = regexp.MustCompile(`^(?:- )?([A-Za-z-]+):`)
+	// dockerBuildPattern finds builds in scripts shellCommands cannot split
+	dockerBuildPattern = regexp.MustCompile(`\bdocker\s+(buildx\s+)?build\b`)
+)
+
+// checkRawDockerBuilds flags jobs that build images with docker build in a
+// run: step instead of docker/build-push-action, which sets up BuildKit and
+// caches layers between runs
+func checkRawDockerBuilds(content []byte, file string) []Issue {
+	var issues []Issue
+
+	for _, job := range dockerJobs(content) {
+		for _, step := range job.Steps {
+			if !step.Build {
+				continue
+			}
+			issues = append(issues, Issue{
+				Severity:    Info,
+				Message:     i18n.T("Image is built with raw 'docker build' in job '%s'", step.Script.Job),
+				File:        file,
+				Line:        step.Script.Line,
+				Suggestion:  i18n.T("Use docker/build-push-action with GitHub Actions layer caching, plus the setup-buildx, login and metadata actions"),
+				AutoFixable: job.Fixable,
+			})
+		}
+	}
+
+	return issues
+}
+
+// FixDockerBuilds replaces the raw docker build, tag, push and login steps of
+// each job with docker/setup-buildx-action, docker/login-action,
+// docker/metadata-action and docker/build-push-action using the GitHub
+// Actions cache. Jobs whose commands cannot be expressed exactly as action
+// inputs, such as ones using shell variables, are left alone.
+func FixDockerBuilds(content []byte) ([]byte, bool) {
+	lines := strings.Split(string(content), "\n")
+	metaID := "meta"
+	if strings.Contains(string(content), "steps.meta.") || strings.Contains(string(content), "id: meta") {
+		metaID = "image-meta"
+	}
+
+	type edit struct {
+		start, end int
+		with       []string
+	}
+	var edits []edit
+	for _, job := range dockerJobs(content) {
+		if !job.Fixable {
+			continue
+		}
+		for _, step := range job.Steps {
+			e := edit{start: step.Start, end: step.End}
+			if step.Build {
+				e.with = buildPushSteps(job, step, metaID)
+			}
+			edits = append(edits, e)
+		}
+	}
+	if len(edits) == 0 {
+		return content, false
+	}
+
+	// Rewrite from the bottom so earlier line indices stay valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		lines = append(lines[:e.start], append(e.with, lines[e.end+1:]...)...)
+	}
+	return []byte(strings.Join(lines, "\n")), true
+}
+
+// dockerJobs groups the docker run: steps of a workflow by job
+func dockerJobs(content []byte) []*dockerJob {
+	lines := strings.Split(string(content), "\n")
+	var jobs []*dockerJob
+	byName := make(map[string]*dockerJob)
+	scriptsByJob := make(map[string][]inlineScript)
+
+	for _, s := range findInlineScripts(content) {
+		scriptsByJob[s.Job] = append(scriptsByJob[s.Job], s)
+		commands, ok := shellCommands(strings.Join(s.Body, "\n"))
+		build, plain := false, ok
+		for _, cmd := range commands {
+			build = build || isDockerBuild(cmd)
+			plain = plain && isImageCommand(cmd)
+		}
+		if !ok {
+			build = dockerBuildPattern.MatchString(strings.Join(s.Body, "\n"))
+		}
+		// Steps that only use images, such as docker run, stay as they are
+		if !build && (!plain || len(commands) == 0) {
+			continue
+		}
+		job := byName[s.Job]
+		if job == nil {
+			job = &dockerJob{}
+			byName[s.Job] = job
+			jobs = append(jobs, job)
+		}
+		start, end := stepBounds(lines, s.Line-1, s.Indent)
+		step := dockerStep{Script: s, Start: start, End: end, Item: s.Indent - 2, Build: build, Plain: plain && !s.Folded}
+		for k := start; k <= end; k++ {
+			indent := len(lines[k]) - len(strings.TrimLeft(lines[k], " "))
+			if k != start && indent != s.Indent {
+				continue
+			}
+			if m := stepKeyPattern.FindStringSubmatch(strings.TrimSpace(lines[k])); m != nil && !dockerStepKeys[m[1]] {
+				step.Plain = false
+			}
+		}
+		if s.Shell != "" && s.Shell != "bash" && s.Shell != "sh" {
+			step.Plain = false
+		}
+		job.Steps = append(job.Steps, step)
+	}
+
+	for name, job := range byName {
+		job.Fixable = planDockerJob(lines, job, scriptsByJob[name])
+	}
+	return jobs
+}
+
+// planDockerJob parses a job's docker commands into one build, its pushed
+// tags and an optional login, and reports whether they can be rewritten
+func planDockerJob(lines []string, job *dockerJob, scripts []inlineScript) bool {
+	buildStep := -1
+	for i, step := range job.Steps {
+		if !step.Plain {
+			return false
+		}
+		commands, _ := shellCommands(strings.Join(step.Script.Body, "\n"))
+		for _, cmd := range commands {
+			for _, word := range cmd {
+				if shellVariable.MatchString(strings.ReplaceAll(word, "${{", "")) {
+					return false
+				}
+			}
+			switch {
+			case isDockerBuild(cmd):
+				if job.Build != nil {
+					return false
+				}
+				build, ok := parseDockerBuild(cmd, step.Script.WorkDir)
+				if !ok {
+					return false
+				}
+				job.Build, buildStep = build, i
+			case len(cmd) >= 2 && cmd[0] == "docker" && cmd[1] == "tag":
+				if job.Build == nil || len(cmd) != 4 || !contains(job.Build.Tags, cmd[2]) {
+					return false
+				}
+				job.Build.Tags = append(job.Build.Tags, cmd[3])
+			case len(cmd) >= 2 && cmd[0] == "docker" && cmd[1] == "push":
+				if job.Build == nil || !pushTags(job.Build, cmd[2:]) {
+					return false
+				}
+			case len(cmd) >= 2 && (cmd[0] == "echo" || cmd[0] == "docker" && cmd[1] == "login"):
+				login, ok := parseDockerLogin(cmd)
+				if !ok || job.Login != nil {
+					return false
+				}
+				job.Login = login
+			default:
+				return false
+			}
+		}
+	}
+	if job.Build == nil {
+		return false
+	}
+
+	// Pushes must directly follow the build: build-push-action pushes as it
+	// builds, and does not leave the image in the local daemon for steps in between
+	build := job.Steps[buildStep]
+	last := job.Steps[len(job.Steps)-1]
+	for k := build.End + 1; k < last.Start; k++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[k]), "- ") && len(lines[k])-len(strings.TrimLeft(lines[k], " ")) == build.Item {
+			if !inDockerStep(job, k) {
+				return false
+			}
+		}
+	}
+	if len(job.Build.Pushed) > 0 {
+		// push: true pushes every tag, and the image is never loaded, so
+		// other steps cannot run it
+		if len(job.Build.Pushed) != len(job.Build.Tags) {
+			return false
+		}
+		for _, s := range scripts {
+			body := strings.Join(s.Body, "\n")
+			if !inDockerStep(job, s.Line-1) && mentionsImage(body, job.Build.Tags) {
+				return false
+			}
+		}
+	}
+	images, _ := imageTags(job.Build.Tags)
+	return len(images) > 0 || len(job.Build.Tags) == 0
+}
+
+// inDockerStep reports whether line is within one of the job's docker steps
+func inDockerStep(job *dockerJob, line int) bool {
+	for _, step := range job.Steps {
+		if line >= step.Start && line <= step.End {
+			return true
+		}
+	}
+	return false
+}
+
+// buildPushSteps returns the action steps that replace the job's build step
+func buildPushSteps(job *dockerJob, step dockerStep, metaID string) []string {
+	item := strings.Repeat(" ", step.Item)
+	key := item + "  "
+	with := key + "  "
+	b := job.Build
+	action := func(name string) string {
+		return fmt.Sprintf("%s@v%d", name, latestActionVersions[name])
+	}
+
+	out := []string{
+		item + "- name: Set up Docker Buildx",
+		key + "uses: " + action("docker/setup-buildx-action"),
+	}
+	if l := job.Login; l != nil {
+		registry := l.Registry
+		if registry == "" {
+			registry = "Docker Hub"
+		}
+		out = append(out, item+"- name: Log in to "+registry, key+"uses: "+action("docker/login-action"), key+"with:")
+		if l.Registry != "" {
+			out = append(out, with+"registry: "+yamlValue(l.Registry))
+		}
+		out = append(out, with+"username: "+yamlValue(l.Username), with+"password: "+yamlValue(l.Password))
+	}
+
+	tagged := len(b.Tags) > 0
+	if tagged {
+		images, tags := imageTags(b.Tags)
+		out = append(out, item+"- name: Docker metadata", key+"id: "+metaID, key+"uses: "+action("docker/metadata-action"), key+"with:", with+"images: |")
+		for _, image := range images {
+			out = append(out, with+"  "+image)
+		}
+		out = append(out, with+"tags: |")
+		for _, tag := range tags {
+			if tag == "${{ github.sha }}" {
+				out = append(out, with+"  type=sha,prefix=,format=long")
+			} else {
+				out = append(out, with+"  type=raw,value="+tag)
+			}
+		}
+	}
+
+	name := step.Script.Step
+	if name == "" && len(b.Pushed) > 0 {
+		name = "Build and push image"
+	} else if name == "" {
+		name = "Build image"
+	}
+	out = append(out, item+"- name: "+yamlValue(name), key+"uses: "+action("docker/build-push-action"), key+"with:", with+"context: "+yamlValue(b.Context))
+	if b.File != "" {
+		out = append(out, with+"file: "+yamlValue(b.File))
+	}
+	if b.Target != "" {
+		out = append(out, with+"target: "+yamlValue(b.Target))
+	}
+	if b.Platforms != "" {
+		out = append(out, with+"platforms: "+yamlValue(b.Platforms))
+	}
+	if len(b.BuildArgs) > 0 {
+		out = append(out, with+"build-args: |")
+		for _, arg := range b.BuildArgs {
+			out = append(out, with+"  "+arg)
+		}
+	}
+	if len(b.Pushed) > 0 {
+		out = append(out, with+"push: true")
+	} else {
+		// Keep the image in the local daemon for later docker run steps
+		out = append(out, with+"load: true")
+	}
+	if tagged {
+		out = append(out,
+			with+"tags: ${{ steps."+metaID+".outputs.tags }}",
+			with+"labels: ${{ steps."+metaID+".outputs.labels }}")
+	}
+	out = append(out, with+"cache-from: type=gha", with+"cache-to: type=gha,mode=max")
+	return out
+}
+
+// parseDockerBuild reads the flags of a docker build command; unknown flags
+// make it unfixable
+func parseDockerBuild(cmd []string, workDir string) (*dockerBuild, bool) {
+	b := &dockerBuild{Pushed: make(map[string]bool)}
+	args := cmd[2:]
+	if cmd[1] == "buildx" {
+		args = cmd[3:]
+	}
+	var contexts []string
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		if !strings.HasPrefix(flag, "-") {
+			contexts = append(contexts, args[i])
+			continue
+		}
+		switch flag {
+		case "--push":
+			b.Pushed[""] = true
+			continue
+		case "--load", "--cache-from", "--cache-to":
+			if flag != "--load" && !hasValue {
+				i++
+			}
+			continue
+		case "-t", "--tag", "-f", "--file", "--target", "--platform", "--build-arg":
+		default:
+			return nil, false
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, false
+			}
+			i++
+			value = args[i]
+		}
+		switch flag {
+		case "-t", "--tag":
+			b.Tags = append(b.Tags, value)
+		case "-f", "--file":
+			b.File = joinPath(workDir, value)
+		case "--target":
+			b.Target = value
+		case "--platform":
+			b.Platforms = value
+		case "--build-arg":
+			if !strings.Contains(value, "=") {
+				return nil, false
+			}
+			b.BuildArgs = append(b.BuildArgs, value)
+		}
+	}
+	if len(contexts) != 1 || contexts[0] == "-" {
+		return nil, false
+	}
+	b.Context = joinPath(workDir, contexts[0])
+	if b.Pushed[""] {
+		delete(b.Pushed, "")
+		for _, tag := range b.Tags {
+			b.Pushed[tag] = true
+		}
+	}
+	return b, true
+}
+
+// pushTags marks the references of a docker push as pushed; every tag has
+// to be pushed for build-push-action's single push: true to be equivalent
+func pushTags(b *dockerBuild, args []string) bool {
+	allTags := len(args) == 2 && (args[0] == "--all-tags" || args[0] == "-a")
+	if allTags {
+		args = args[1:]
+	} else if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		return false
+	}
+	found := false
+	for _, tag := range b.Tags {
+		name, _ := splitImageRef(tag)
+		if tag == args[0] || tag == args[0]+":latest" || (allTags && name == args[0]) {
+			b.Pushed[tag] = true
+			found = true
+		}
+	}
+	return found
+}
+
+// parseDockerLogin reads a docker login command, optionally fed the password
+// by echo through --password-stdin
+func parseDockerLogin(cmd []string) (*dockerLogin, bool) {
+	l := &dockerLogin{}
+	if cmd[0] == "echo" {
+		pipe := indexOf(cmd, "|")
+		if pipe != 2 || len(cmd) < 5 || cmd[3] != "docker" || cmd[4] != "login" {
+			return nil, false
+		}
+		l.Password = cmd[1]
+		cmd = cmd[3:]
+	} else if contains(cmd, "|") {
+		return nil, false
+	}
+	args := cmd[2:]
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		switch flag {
+		case "--password-stdin":
+			if l.Password == "" {
+				return nil, false
+			}
+			continue
+		case "-u", "--username", "-p", "--password":
+		default:
+			if strings.HasPrefix(flag, "-") || l.Registry != "" {
+				return nil, false
+			}
+			l.Registry = args[i]
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, false
+			}
+			i++
+			value = args[i]
+		}
+		if flag == "-u" || flag == "--username" {
+			l.Username = value
+		} else {
+			l.Password = value
+		}
+	}
+	return l, l.Username != "" && l.Password != ""
+}
+
+// imageTags splits references into image names and tags, returning nothing
+// unless every name carries every tag, which is what metadata-action produces
+func imageTags(refs []string) ([]string, []string) {
+	var images, tags []string
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		name, tag := splitImageRef(ref)
+		if !contains(images, name) {
+			images = append(images, name)
+		}
+		if !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+		seen[name+":"+tag] = true
+	}
+	if len(seen) != len(images)*len(tags) {
+		return nil, nil
+	}
+	return images, tags
+}
+
+// splitImageRef splits an image reference into name and tag (default latest)
+func splitImageRef(ref string) (string, string) {
+	if tag := imageTag(ref); tag != "" {
+		return strings.TrimSuffix(ref, ":"+tag), tag
+	}
+	return ref, "latest"
+}
+
+// mentionsImage reports whether a script refers to one of the built images
+func mentionsImage(body string, refs []string) bool {
+	for _, ref := range refs {
+		if name, _ := splitImageRef(ref); strings.Contains(body, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// stepBounds returns the first and last line of the step item holding the
+// run: key at runLine
+func stepBounds(lines []string, runLine, runIndent int) (int, int) {
+	start := runLine
+	if !strings.HasPrefix(strings.TrimSpace(lines[runLine]), "- ") {
+		for k := runLine - 1; k >= 0; k-- {
+			indent := len(lines[k]) - len(strings.TrimLeft(lines[k], " "))
+			if indent == runIndent-2 && strings.HasPrefix(strings.TrimSpace(lines[k]), "- ") {
+				start = k
+				break
+			}
+		}
+	}
+	end := start
+	for k := start + 1; k < len(lines); k++ {
+		trimmed := strings.TrimSpace(lines[k])
+		indent := len(lines[k]) - len(strings.TrimLeft(lines[k], " "))
+		if trimmed != "" && indent < runIndent {
+			break
+		}
+		if trimmed != "" {
+			end = k
+		}
+	}
+	return start, end
+}
+
+// shellCommands splits a script into commands of words. Quotes are removed,
+// ${{ }} expressions stay whole, and a pipe is kept as a "|" word. It fails
+// on constructs a fix cannot translate, such as redirects and substitutions.
+func shellCommands(script string) ([][]string, bool) {
+	script = strings.ReplaceAll(script, "\\\n", " ")
+	var commands [][]string
+	var cmd []string
+	var word strings.Builder
+	inWord := false
+	flushWord := func() {
+		if inWord {
+			cmd = append(cmd, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	flushCommand := func() {
+		flushWord()
+		if len(cmd) > 0 && cmd[0] != "set" {
+			commands = append(commands, cmd)
+		}
+		cmd = nil
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case strings.HasPrefix(script[i:], "${{"):
+			end := strings.Index(script[i:], "}}")
+			if end < 0 {
+				return nil, false
+			}
+			word.WriteString(script[i : i+end+2])
+			inWord = true
+			i += end + 1
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(script[i+1:], c)
+			if end < 0 {
+				return nil, false
+			}
+			word.WriteString(script[i+1 : i+1+end])
+			inWord = true
+			i += end + 1
+		case c == '#' && !inWord:
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			flushCommand()
+		case c == '\n' || c == ';':
+			flushCommand()
+		case c == '&' && i+1 < len(script) && script[i+1] == '&':
+			flushCommand()
+			i++
+		case c == '|' && (i+1 >= len(script) || script[i+1] != '|'):
+			flushWord()
+			cmd = append(cmd, "|")
+		case c == ' ' || c == '\t':
+			flushWord()
+		case c == '`' || c == '>' || c == '<' || c == '&' || c == '|' || strings.HasPrefix(script[i:], "$("):
+			return nil, false
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flushCommand()
+	return commands, true
+}
+
+// isImageCommand reports whether cmd is a docker build, tag, push or login,
+// the commands build-push-action and login-action replace
+func isImageCommand(cmd []string) bool {
+	if len(cmd) >= 5 && cmd[0] == "echo" && cmd[2] == "|" {
+		cmd = cmd[3:]
+	}
+	if isDockerBuild(cmd) {
+		return true
+	}
+	return len(cmd) >= 2 && cmd[0] == "docker" && (cmd[1] == "tag" || cmd[1] == "push" || cmd[1] == "login")
+}
+
+func isDockerBuild(cmd []string) bool {
+	return len(cmd) >= 2 && cmd[0] == "docker" &&
+		(cmd[1] == "build" || len(cmd) >= 3 && cmd[1] == "buildx" && cmd[2] == "build")
+}
+
+// yamlValue quotes a scalar when YAML would read it as something else
+func yamlValue(s string) string {
+	if s == "" || strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") && !strings.HasPrefix(s, "${{") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func joinPath(dir, path string) string {
+	if dir == "" || dir == "." || strings.HasPrefix(path, "/") {
+		return path
+	}
+	if path == "." {
+		return dir
+	}
+	return strings.TrimSuffix(dir, "/") + "/" + path
+}
+
+func contains(list []string, s string) bool {
+	return indexOf(list, s) >= 0
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,398 @@
+package linter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"cicli/internal/i18n"
+
+	"gopkg.in/yaml.v3"
+)
+
+// taskCall is a CI command that runs a package.json script, a Makefile
+// target or a Taskfile task
+type taskCall struct {
+	Runner string // npm, make or task
+	Name   string
+	Dir    string // directory the command runs in, relative to the project root
+	File   string // definitions file given with -f / --taskfile
+}
+
+// taskDefs are the names defined by a package.json, Makefile or Taskfile
+type taskDefs struct {
+	File     string
+	Names    map[string]bool
+	Patterns []*regexp.Regexp // Makefile pattern rules
+	Open     bool             // includes or computed names make missing names unknowable
+}
+
+func (d *taskDefs) has(name string) bool {
+	if d.Open || d.Names[name] {
+		return true
+	}
+	for _, p := range d.Patterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// packageManagerBuiltins are yarn and pnpm commands that are not scripts,
+// since both also run scripts without "run"
+var packageManagerBuiltins = map[string]bool{
+	"add": true, "audit": true, "autoclean": true, "bin": true, "cache": true, "config": true,
+	"create": true, "dedupe": true, "dlx": true, "env": true, "exec": true, "fetch": true,
+	"global": true, "help": true, "i": true, "import": true, "info": true, "init": true,
+	"install": true, "link": true, "list": true, "ls": true, "node": true, "outdated": true,
+	"pack": true, "patch": true, "plugin": true, "prune": true, "publish": true, "rebuild": true,
+	"remove": true, "rm": true, "set": true, "setup": true, "store": true, "unlink": true,
+	"up": true, "update": true, "upgrade": true, "version": true, "why": true,
+	"workspace": true, "workspaces": true,
+}
+
+var (
+	// commandKeyPattern strips the key of lines such as "- run: make test"
+	commandKeyPattern = regexp.MustCompile(`^(run|command|script|bash|sh|pwsh|powershell|inlineScript):\s*`)
+	otherKeyPattern   = regexp.MustCompile(`^[A-Za-z_][\w.-]*:(\s|$)`)
+	envAssignPattern  = regexp.MustCompile(`^[A-Za-z_]\w*=`)
+)
+
+// checkTaskDrift reports CI commands that call package.json scripts,
+// Makefile targets or Taskfile tasks that no longer exist, for example
+// after a script was renamed locally but not in CI
+func checkTaskDrift(content []byte, file string) []Issue {
+	var issues []Issue
+	root := workflowRoot(file)
+	defs := make(map[string]*taskDefs)
+
+	report := func(line int, call taskCall) {
+		d := loadTaskDefs(root, call, defs)
+		if d == nil || d.has(call.Name) {
+			return
+		}
+		issue := Issue{
+			Severity:   Warning,
+			Message:    i18n.T("CI runs %q, which is not defined in %s", call.Name, d.File),
+			File:       file,
+			Line:       line,
+			Suggestion: i18n.T("Add %q to %s or update the CI step", call.Name, d.File),
+		}
+		if closest := closestName(call.Name, d.Names); closest != "" {
+			issue.Suggestion = i18n.T("Did you mean %q? Update the CI step or restore the old name in %s", closest, d.File)
+		}
+		issues = append(issues, issue)
+	}
+
+	if detectPlatform(file) == "github" {
+		for _, s := range findInlineScripts(content) {
+			if s.Shell != "" && s.Shell != "bash" && s.Shell != "sh" {
+				continue
+			}
+			dir := s.WorkDir
+			for i, line := range s.Body {
+				var calls []taskCall
+				calls, dir = parseTaskCalls(line, dir)
+				at := s.Line
+				if !s.Inline {
+					at = s.BodyFrom + i + 1
+				}
+				for _, call := range calls {
+					report(at, call)
+				}
+			}
+		}
+		return issues
+	}
+
+	for i, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "- "))
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if loc := commandKeyPattern.FindStringIndex(trimmed); loc != nil {
+			trimmed = trimmed[loc[1]:]
+		} else if otherKeyPattern.MatchString(trimmed) {
+			continue
+		}
+		calls, _ := parseTaskCalls(strings.Trim(trimmed, `"'`), "")
+		for _, call := range calls {
+			report(i+1, call)
+		}
+	}
+	return issues
+}
+
+// parseTaskCalls finds the script, target and task calls in one shell line.
+// dir is the directory the line starts in; the directory after any cd on
+// the line is returned so multi-line scripts can carry it on.
+func parseTaskCalls(line, dir string) ([]taskCall, string) {
+	var calls []taskCall
+	for _, segment := range regexp.MustCompile(`&&|\|\||;|\|`).Split(line, -1) {
+		fields := strings.Fields(segment)
+		for len(fields) > 0 && envAssignPattern.MatchString(fields[0]) {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		args := fields[1:]
+
+		switch fields[0] {
+		case "cd":
+			if len(args) == 1 && !strings.ContainsAny(args[0], "$~`") {
+				dir = filepath.Join(dir, args[0])
+			}
+		case "npm", "yarn", "pnpm", "bun":
+			if call, ok := packageScriptCall(fields[0], args, dir); ok {
+				calls = append(calls, call)
+			}
+		case "make", "gmake":
+			calls = append(calls, targetCalls("make", args, dir, "-C", "--directory", "-f", "--file", "--makefile")...)
+		case "task":
+			calls = append(calls, targetCalls("task", args, dir, "-d", "--dir", "-t", "--taskfile", "")...)
+		}
+	}
+
+	var kept []taskCall
+	for _, call := range calls {
+		if call.Name != "" && !strings.ContainsAny(call.Name, "$`{}") {
+			kept = append(kept, call)
+		}
+	}
+	return kept, dir
+}
+
+// packageScriptCall recognises "npm run x", "npm test", "yarn x" and the like
+func packageScriptCall(manager string, args []string, dir string) (taskCall, bool) {
+	var words []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--prefix" || arg == "--cwd" || arg == "-C" || arg == "--dir":
+			if i+1 < len(args) {
+				dir = filepath.Join(dir, args[i+1])
+				i++
+			}
+		case strings.HasPrefix(arg, "--prefix=") || strings.HasPrefix(arg, "--cwd=") || strings.HasPrefix(arg, "--dir="):
+			dir = filepath.Join(dir, arg[strings.Index(arg, "=")+1:])
+		case arg == "-w" || arg == "-r" || arg == "--recursive" || arg == "--filter" ||
+			strings.HasPrefix(arg, "--workspace") || strings.HasPrefix(arg, "--filter="):
+			// Scripts of other workspace packages are not checked
+			return taskCall{}, false
+		case arg == "--":
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+		default:
+			words = append(words, arg)
+		}
+	}
+	if len(words) == 0 {
+		return taskCall{}, false
+	}
+
+	call := taskCall{Runner: "npm", Dir: dir}
+	switch {
+	case words[0] == "run" || words[0] == "run-script" || (manager == "npm" && words[0] == "rum"):
+		if len(words) < 2 {
+			return taskCall{}, false
+		}
+		call.Name = words[1]
+	case (words[0] == "test" && manager != "bun") || (manager == "npm" && words[0] == "t"):
+		call.Name = "test"
+	case (manager == "yarn" || manager == "pnpm") && !packageManagerBuiltins[words[0]] && words[0] != "start":
+		call.Name = words[0]
+	default:
+		return taskCall{}, false
+	}
+	return call, true
+}
+
+// targetCalls lists the targets given to make or task, following the flags
+// that change directory or definitions file
+func targetCalls(runner string, args []string, dir, dirShort, dirLong, fileShort, fileLong, fileAlt string) []taskCall {
+	var calls []taskCall
+	defsFile := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch {
+		case arg == dirShort || arg == dirLong:
+			dir = filepath.Join(dir, value())
+		case strings.HasPrefix(arg, dirLong+"="):
+			dir = filepath.Join(dir, strings.TrimPrefix(arg, dirLong+"="))
+		case arg == fileShort || arg == fileLong || (fileAlt != "" && arg == fileAlt):
+			defsFile = value()
+		case strings.HasPrefix(arg, fileLong+"="):
+			defsFile = strings.TrimPrefix(arg, fileLong+"=")
+		case arg == "--":
+			i = len(args)
+		case strings.HasPrefix(arg, "-"), strings.Contains(arg, "="), regexp.MustCompile(`^\d+$`).MatchString(arg):
+			// Other flags, their numeric values (-j 4) and VAR=value overrides
+		default:
+			calls = append(calls, taskCall{Runner: runner, Name: arg})
+		}
+	}
+	for i := range calls {
+		calls[i].Dir = dir
+		calls[i].File = defsFile
+	}
+	return calls
+}
+
+// loadTaskDefs reads the definitions a call refers to, caching them per file.
+// It returns nil when the file does not exist, since CI may create it.
+func loadTaskDefs(root string, call taskCall, cache map[string]*taskDefs) *taskDefs {
+	var candidates []string
+	switch {
+	case call.File != "":
+		candidates = []string{call.File}
+	case call.Runner == "npm":
+		candidates = []string{"package.json"}
+	case call.Runner == "make":
+		candidates = []string{"GNUmakefile", "makefile", "Makefile"}
+	case call.Runner == "task":
+		candidates = []string{"Taskfile.yml", "Taskfile.yaml", "taskfile.yml", "taskfile.yaml", "Taskfile.dist.yml", "Taskfile.dist.yaml"}
+	}
+
+	for _, name := range candidates {
+		path := filepath.Join(root, call.Dir, name)
+		if d, ok := cache[path]; ok {
+			return d
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			rel = path
+		}
+		d := &taskDefs{File: filepath.ToSlash(rel), Names: make(map[string]bool)}
+		switch call.Runner {
+		case "npm":
+			parsePackageScripts(data, d)
+		case "make":
+			parseMakeTargets(data, d)
+		case "task":
+			parseTaskfile(data, d, call.Name)
+		}
+		cache[path] = d
+		return d
+	}
+	return nil
+}
+
+func parsePackageScripts(data []byte, d *taskDefs) {
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		d.Open = true
+		return
+	}
+	for name := range pkg.Scripts {
+		d.Names[name] = true
+	}
+}
+
+var makeRulePattern = regexp.MustCompile(`^([^\s:#=][^:=]*?)\s*::?(\s|$|[^=])`)
+
+func parseMakeTargets(data []byte, d *taskDefs) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "\t") {
+			continue
+		}
+		if regexp.MustCompile(`^-?s?include\s`).MatchString(line) {
+			d.Open = true
+			continue
+		}
+		m := makeRulePattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for _, target := range strings.Fields(m[1]) {
+			switch {
+			case strings.Contains(target, "$"):
+				d.Open = true
+			case strings.Contains(target, "%"):
+				parts := strings.SplitN(target, "%", 2)
+				d.Patterns = append(d.Patterns, regexp.MustCompile("^"+regexp.QuoteMeta(parts[0])+".+"+regexp.QuoteMeta(parts[1])+"$"))
+			default:
+				d.Names[target] = true
+			}
+		}
+	}
+}
+
+// parseTaskfile reads task names and aliases. Tasks of included Taskfiles
+// are namespaced with a colon and are not checked.
+func parseTaskfile(data []byte, d *taskDefs, name string) {
+	var tf struct {
+		Includes map[string]interface{} `yaml:"includes"`
+		Tasks    map[string]struct {
+			Aliases []string `yaml:"aliases"`
+		} `yaml:"tasks"`
+	}
+	if err := yaml.Unmarshal(data, &tf); err != nil {
+		d.Open = true
+		return
+	}
+	for task, def := range tf.Tasks {
+		if strings.Contains(task, "*") {
+			d.Open = true
+		}
+		d.Names[task] = true
+		for _, alias := range def.Aliases {
+			d.Names[alias] = true
+		}
+	}
+	if len(tf.Includes) > 0 && strings.Contains(name, ":") {
+		d.Open = true
+	}
+}
+
+// closestName finds the defined name most like a missing one, such as the
+// new name of a renamed script
+func closestName(name string, names map[string]bool) string {
+	best, bestDistance := "", len(name)/2+1
+	for candidate := range names {
+		distance := editDistance(name, candidate)
+		if strings.HasPrefix(candidate, name) || strings.HasPrefix(name, candidate) {
+			distance = min(distance, 2)
+		}
+		if distance < bestDistance || (distance == bestDistance && best != "" && candidate < best) {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
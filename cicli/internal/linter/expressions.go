@@ -0,0 +1,404 @@
+package linter
+
+import (
+	"errors"
+	"strings"
+
+	"cicli/internal/i18n"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expressionContexts are the contexts a GitHub Actions expression can read
+var expressionContexts = map[string]bool{
+	"github": true, "env": true, "vars": true, "job": true, "jobs": true, "steps": true, "runner": true,
+	"secrets": true, "strategy": true, "matrix": true, "needs": true, "inputs": true,
+}
+
+// expressionFunctions maps the built-in functions to their minimum and
+// maximum argument counts; -1 means any number
+var expressionFunctions = map[string][2]int{
+	"contains":   {2, 2},
+	"startswith": {2, 2},
+	"endswith":   {2, 2},
+	"format":     {1, -1},
+	"join":       {1, 2},
+	"tojson":     {1, 1},
+	"fromjson":   {1, 1},
+	"hashfiles":  {1, -1},
+	"success":    {0, 0},
+	"always":     {0, 0},
+	"cancelled":  {0, 0},
+	"failure":    {0, 0},
+}
+
+// exprToken is a token of an expression: a number, a 'string', an identifier,
+// an operator or punctuation, or the end of the input
+type exprToken struct {
+	kind string // number, string, ident, op or end
+	text string
+}
+
+// exprParser is a recursive-descent parser of the expression grammar, from
+// || down to property access, that validates function and context names
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// tokenizeExpression splits an expression into tokens
+func tokenizeExpression(expr string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			j := i + 1
+			for ; j < len(expr); j++ {
+				if expr[j] == '\'' {
+					// '' is an escaped quote
+					if j+1 < len(expr) && expr[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(expr) {
+				return nil, errors.New(i18n.T("unterminated string"))
+			}
+			tokens = append(tokens, exprToken{"string", expr[i : j+1]})
+			i = j + 1
+		case c == '"':
+			return nil, errors.New(i18n.T("strings must use single quotes"))
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(expr) && expr[i+1] >= '0' && expr[i+1] <= '9':
+			j := i + 1
+			for j < len(expr) && (isIdentChar(expr[j]) || expr[j] == '.' || (expr[j] == '-' || expr[j] == '+') && (expr[j-1] == 'e' || expr[j-1] == 'E')) {
+				j++
+			}
+			tokens = append(tokens, exprToken{"number", expr[i:j]})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(expr) && (isIdentChar(expr[j]) || expr[j] == '-') {
+				j++
+			}
+			tokens = append(tokens, exprToken{"ident", expr[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ".", ",", "*"} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			switch {
+			case op != "":
+			case c == '=':
+				return nil, errors.New(i18n.T("use == to compare, not ="))
+			case c == '$' && i+1 < len(expr) && isIdentChar(expr[i+1]):
+				j := i + 1
+				for j < len(expr) && isIdentChar(expr[j]) {
+					j++
+				}
+				return nil, errors.New(i18n.T("$%[1]s is a shell variable; read it as env.%[1]s or vars.%[1]s", expr[i+1:j]))
+			case c == '&' || c == '|':
+				return nil, errors.New(i18n.T("use %[1]s%[1]s, not a single %[1]s", string(c)))
+			default:
+				return nil, errors.New(i18n.T("unexpected character '%s'", string(c)))
+			}
+			tokens = append(tokens, exprToken{"op", op})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: "end"}), nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// parseExpression validates the text of an expression, without ${{ }}
+func parseExpression(expr string) error {
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return err
+	}
+	p := &exprParser{tokens: tokens}
+	if p.peek().kind == "end" {
+		return errors.New(i18n.T("empty expression"))
+	}
+	if err := p.binary(0); err != nil {
+		return err
+	}
+	if t := p.peek(); t.kind != "end" {
+		return errors.New(i18n.T("unexpected '%s'", t.text))
+	}
+	return nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != "end" {
+		p.pos++
+	}
+	return t
+}
+
+// binaryLevels are the binary operators from the loosest to the tightest
+var binaryLevels = [][]string{{"||"}, {"&&"}, {"==", "!="}, {"<", "<=", ">", ">="}}
+
+func (p *exprParser) binary(level int) error {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+	if err := p.binary(level + 1); err != nil {
+		return err
+	}
+	for t := p.peek(); t.kind == "op" && contains(binaryLevels[level], t.text); t = p.peek() {
+		p.next()
+		if err := p.binary(level + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) unary() error {
+	if t := p.peek(); t.kind == "op" && t.text == "!" {
+		p.next()
+		return p.unary()
+	}
+	return p.postfix()
+}
+
+// postfix parses a primary value followed by property accesses and indexes
+func (p *exprParser) postfix() error {
+	if err := p.primary(); err != nil {
+		return err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == "op" && t.text == ".":
+			p.next()
+			if name := p.next(); name.kind != "ident" && name.text != "*" {
+				return unexpected(name, i18n.T("a property name"))
+			}
+		case t.kind == "op" && t.text == "[":
+			p.next()
+			if p.peek().text == "*" {
+				p.next()
+			} else if err := p.binary(0); err != nil {
+				return err
+			}
+			if err := p.expect("]"); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *exprParser) primary() error {
+	t := p.next()
+	switch t.kind {
+	case "number", "string":
+		return nil
+	case "ident":
+		name := strings.ToLower(t.text)
+		if next := p.peek(); next.kind == "op" && next.text == "(" {
+			p.next()
+			return p.call(t.text, name)
+		}
+		if name == "true" || name == "false" || name == "null" {
+			return nil
+		}
+		if !expressionContexts[name] {
+			return errors.New(i18n.T("unknown context '%s'", t.text))
+		}
+		return nil
+	case "op":
+		if t.text == "(" {
+			if err := p.binary(0); err != nil {
+				return err
+			}
+			return p.expect(")")
+		}
+	}
+	return unexpected(t, i18n.T("a value"))
+}
+
+// call parses the arguments of a function call and checks the function
+// exists and takes that many arguments
+func (p *exprParser) call(original, name string) error {
+	arity, known := expressionFunctions[name]
+	if !known {
+		return errors.New(i18n.T("unknown function '%s'", original))
+	}
+	args := 0
+	if t := p.peek(); t.kind == "op" && t.text == ")" {
+		p.next()
+	} else {
+		for {
+			if err := p.binary(0); err != nil {
+				return err
+			}
+			args++
+			if t := p.next(); t.text == ")" {
+				break
+			} else if t.text != "," {
+				return unexpected(t, "')'")
+			}
+		}
+	}
+	if args < arity[0] || (arity[1] >= 0 && args > arity[1]) {
+		return errors.New(i18n.T("%s() does not take %d arguments", original, args))
+	}
+	return nil
+}
+
+func (p *exprParser) expect(op string) error {
+	if t := p.next(); t.kind != "op" || t.text != op {
+		return unexpected(t, "'"+op+"'")
+	}
+	return nil
+}
+
+// unexpected reports a token where something else was expected
+func unexpected(t exprToken, want string) error {
+	if t.kind == "end" {
+		return errors.New(i18n.T("expression ends where %s was expected", want))
+	}
+	return errors.New(i18n.T("unexpected '%s' where %s was expected", t.text, want))
+}
+
+// expressionSpans returns the text inside each ${{ }} of a value. A ${{
+// without a closing }} is returned as an error; }} inside a string literal
+// does not close the expression.
+func expressionSpans(value string) ([]string, error) {
+	var spans []string
+	for {
+		start := strings.Index(value, "${{")
+		if start < 0 {
+			return spans, nil
+		}
+		value = value[start+3:]
+		end, inString := -1, false
+		for i := 0; i < len(value); i++ {
+			if value[i] == '\'' {
+				inString = !inString
+			} else if !inString && strings.HasPrefix(value[i:], "}}") {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return spans, errors.New(i18n.T("${{ has no closing }}"))
+		}
+		spans = append(spans, value[:end])
+		value = value[end+2:]
+	}
+}
+
+// checkExpressions validates the expressions of a workflow: every ${{ }} in
+// a value, and the if: conditions of jobs and steps, which may leave out the
+// ${{ }}
+func checkExpressions(content []byte, file string) []Issue {
+	var issues []Issue
+	root := parseRoot(content)
+	if root == nil {
+		return issues
+	}
+	lines := strings.Split(string(content), "\n")
+	report := func(node *yaml.Node, needle string, err error) {
+		line, column := scalarPosition(lines, node, needle)
+		issues = append(issues, Issue{
+			Severity:   Error,
+			Message:    i18n.T("Invalid expression: %s", err.Error()),
+			File:       file,
+			Line:       line,
+			Column:     column,
+			Suggestion: i18n.T("See https://docs.github.com/actions/learn-github-actions/expressions for the syntax, functions and contexts"),
+		})
+	}
+
+	conditions := make(map[*yaml.Node]bool)
+	for _, job := range workflowJobs(root) {
+		if _, cond := mappingEntry(job.Body, "if"); cond != nil {
+			conditions[cond] = true
+		}
+		for _, step := range jobSteps(job.Body) {
+			if _, cond := mappingEntry(step, "if"); cond != nil {
+				conditions[cond] = true
+			}
+		}
+	}
+
+	walkScalars(root, func(node *yaml.Node) {
+		if conditions[node] {
+			if err := checkCondition(node.Value); err != nil {
+				report(node, firstLine(node.Value), err)
+			}
+			return
+		}
+		spans, err := expressionSpans(node.Value)
+		for _, span := range spans {
+			if perr := parseExpression(span); perr != nil {
+				report(node, firstLine("${{"+span), perr)
+			}
+		}
+		if err != nil {
+			report(node, "${{", err)
+		}
+	})
+	return issues
+}
+
+// checkCondition validates an if: condition. A condition that is one ${{ }}
+// is checked inside it. Any other text around a ${{ }} makes the condition a
+// non-empty string, which is always true.
+func checkCondition(cond string) error {
+	trimmed := strings.TrimSpace(cond)
+	if !strings.Contains(trimmed, "${{") {
+		return parseExpression(trimmed)
+	}
+	spans, err := expressionSpans(trimmed)
+	if err != nil {
+		return err
+	}
+	if len(spans) != 1 || !strings.HasPrefix(trimmed, "${{") || !strings.HasSuffix(trimmed, "}}") {
+		return errors.New(i18n.T("text outside ${{ }} makes the condition a string, which is always true; put the whole condition inside ${{ }} or leave ${{ }} out"))
+	}
+	return parseExpression(spans[0])
+}
+
+// walkScalars calls visit with every scalar value below node; mapping keys
+// are skipped
+func walkScalars(node *yaml.Node, visit func(*yaml.Node)) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		visit(node)
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			walkScalars(node.Content[i], visit)
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			walkScalars(child, visit)
+		}
+	}
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,204 @@
+package linter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ExternalTools are the linters Linter.External runs when they are on PATH
+var ExternalTools = []string{"actionlint", "yamllint"}
+
+// overlapGroups put findings of different tools that report the same problem
+// in one group. An external finding is dropped when a finding of its group is
+// already on the same line, so built-in rules win, then actionlint.
+var overlapGroups = map[string]string{
+	"YAML002":                 "schema",
+	"actionlint/syntax-check": "schema",
+	"actionlint/events":       "schema",
+	"yamllint/syntax":         "schema",
+	"BP003":                   "action-version",
+	"actionlint/action":       "action-version",
+	"EXPR001":                 "expression",
+	"actionlint/expression":   "expression",
+}
+
+// yamllintConfig is used when the repository has no yamllint config of its
+// own. truthy and line-length are off: on: is a workflow key, and generated
+// scripts and expressions are long.
+const yamllintConfig = "{extends: relaxed, rules: {truthy: disable, line-length: disable}}"
+
+// actionlintFinding is an entry of actionlint's JSON output
+type actionlintFinding struct {
+	Message string `json:"message"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Kind    string `json:"kind"`
+}
+
+// yamllintLine parses yamllint's parsable format:
+// file:line:column: [level] message (rule)
+var yamllintLine = regexp.MustCompile(`^.*:(\d+):(\d+): \[(error|warning)\] (.*?)(?: \(([\w-]+)\))?$`)
+
+// External runs the external linters that are installed on every result's
+// file and merges their findings, skipping the ones another rule already
+// reports. It returns the tools that ran.
+func (l *Linter) External(results []*LintResult) ([]string, error) {
+	var ran []string
+	for _, tool := range ExternalTools {
+		if _, err := exec.LookPath(tool); err != nil {
+			continue
+		}
+		ran = append(ran, tool)
+		for _, result := range results {
+			var issues []Issue
+			var err error
+			switch {
+			case tool == "actionlint" && result.Platform == "github":
+				issues, err = runActionlint(result.File)
+			case tool == "yamllint" && result.Platform != "jenkins":
+				issues, err = runYamllint(result.File)
+			}
+			if err != nil {
+				return ran, err
+			}
+			result.Issues = mergeIssues(result.Issues, issues)
+			result.Score = l.calculateScore(result.Issues)
+		}
+	}
+	return ran, nil
+}
+
+// runActionlint lints a workflow with actionlint. Its shellcheck integration
+// is turned off, since SH001 already runs shellcheck on every run: block.
+func runActionlint(file string) ([]Issue, error) {
+	cmd := exec.Command("actionlint", "-format", "{{json .}}", "-no-color", "-shellcheck=", file)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	// actionlint exits 1 when it reports findings
+	if err := cmd.Run(); err != nil && !exitedWith(err, 1) {
+		return nil, fmt.Errorf("actionlint: %s", firstNonEmpty(strings.TrimSpace(stderr.String()), err.Error()))
+	}
+
+	var findings []actionlintFinding
+	if err := json.Unmarshal(out.Bytes(), &findings); err != nil {
+		return nil, fmt.Errorf("actionlint: unexpected output: %w", err)
+	}
+	var issues []Issue
+	for _, f := range findings {
+		severity := Error
+		if f.Kind == "pyflakes" || f.Kind == "deprecated-commands" {
+			severity = Warning
+		}
+		issues = append(issues, Issue{
+			Severity: severity,
+			Rule:     "actionlint/" + f.Kind,
+			Message:  f.Message,
+			File:     file,
+			Line:     f.Line,
+			Column:   f.Column,
+		})
+	}
+	return issues, nil
+}
+
+// runYamllint lints a YAML file with yamllint, using the repository's
+// config when it has one
+func runYamllint(file string) ([]Issue, error) {
+	args := []string{"-f", "parsable"}
+	if !hasYamllintConfig() {
+		args = append(args, "-d", yamllintConfig)
+	}
+	cmd := exec.Command("yamllint", append(args, file)...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	// yamllint exits 1 on errors and 2 on warnings with --strict
+	if err := cmd.Run(); err != nil && !exitedWith(err, 1) && !exitedWith(err, 2) {
+		return nil, fmt.Errorf("yamllint: %s", firstNonEmpty(strings.TrimSpace(stderr.String()), err.Error()))
+	}
+
+	var issues []Issue
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		m := yamllintLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		column, _ := strconv.Atoi(m[2])
+		severity := Warning
+		if m[3] == "error" {
+			severity = Error
+		}
+		rule := m[5]
+		if rule == "" {
+			rule = "syntax"
+		}
+		issues = append(issues, Issue{
+			Severity: severity,
+			Rule:     "yamllint/" + rule,
+			Message:  strings.TrimPrefix(m[4], "syntax error: "),
+			File:     file,
+			Line:     line,
+			Column:   column,
+		})
+	}
+	return issues, nil
+}
+
+// hasYamllintConfig reports whether yamllint will find a config file of the
+// repository in the working directory
+func hasYamllintConfig() bool {
+	for _, name := range []string{".yamllint", ".yamllint.yaml", ".yamllint.yml"} {
+		if _, err := os.Stat(name); err == nil {
+			return true
+		}
+	}
+	return os.Getenv("YAMLLINT_CONFIG_FILE") != ""
+}
+
+// mergeIssues appends the external findings that are not already reported:
+// the same message on the same line, or a finding of the same overlap group
+// on that line
+func mergeIssues(issues, external []Issue) []Issue {
+	for _, e := range external {
+		duplicate := false
+		for _, existing := range issues {
+			if existing.Line != e.Line {
+				continue
+			}
+			group := overlapGroups[e.Rule]
+			if existing.Message == e.Message || (group != "" && overlapGroups[existing.Rule] == group) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			issues = append(issues, e)
+		}
+	}
+	return issues
+}
+
+// exitedWith reports whether err is a process exit with the given code
+func exitedWith(err error, code int) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	return ok && exitErr.ExitCode() == code
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,310 @@
+package linter
+
+import (
+	"regexp"
+	"strings"
+
+	"cicli/internal/i18n"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PublicRepository turns on the fork-safety rules (FORK001-FORK004). They
+// only matter where anyone can open a pull request from a fork, so they run
+// when lint is given --public or cicli.yaml sets lint.public, and in the
+// security-strict profile.
+var PublicRepository = false
+
+var (
+	// headRefPattern matches checkout refs that point at the pull request's code
+	headRefPattern = regexp.MustCompile(`github\.event\.pull_request\.(head\.(sha|ref)|merge_commit_sha)|github\.head_ref|github\.event\.workflow_run\.head_(sha|branch)|refs/pull/`)
+	// headFetchPattern matches run: commands that fetch the pull request's code
+	headFetchPattern = regexp.MustCompile(`\bgh\s+pr\s+checkout\b|\bgit\s+(fetch|pull)\b[^\n]*\bpull/`)
+	// secretPattern matches a secret reference; GITHUB_TOKEN is always available
+	secretPattern = regexp.MustCompile(`secrets\.([A-Za-z_][A-Za-z0-9_]*)`)
+	// forkGuardPattern matches if: conditions that tell forks apart
+	forkGuardPattern = regexp.MustCompile(`head\.repo\.(full_name|fork)`)
+)
+
+// forkGuard is the condition suggested to skip work for pull requests from forks
+const forkGuard = "if: github.event.pull_request.head.repo.full_name == github.repository"
+
+// forkWorkflow is a parsed workflow with the events that trigger it
+type forkWorkflow struct {
+	Triggers map[string]bool
+	Jobs     []jobNode
+}
+
+// parseForkWorkflow returns the triggers and jobs of a workflow
+func parseForkWorkflow(content []byte) (forkWorkflow, bool) {
+	root := parseRoot(content)
+	_, on := mappingEntry(root, "on")
+	if on == nil {
+		return forkWorkflow{}, false
+	}
+	var events interface{}
+	if err := on.Decode(&events); err != nil {
+		return forkWorkflow{}, false
+	}
+	w := forkWorkflow{Triggers: make(map[string]bool), Jobs: workflowJobs(root)}
+	for _, t := range workflowTriggers(events) {
+		w.Triggers[t] = true
+	}
+	return w, true
+}
+
+// privilegedEvent returns the trigger that runs with the base repository's
+// secrets and a write token even when a fork set it off, or "" when there is
+// none
+func (w forkWorkflow) privilegedEvent() string {
+	for _, e := range []string{"pull_request_target", "workflow_run"} {
+		if w.Triggers[e] {
+			return e
+		}
+	}
+	return ""
+}
+
+// jobSteps returns the step mappings of a job
+func jobSteps(job *yaml.Node) []*yaml.Node {
+	var steps []*yaml.Node
+	_, list := mappingEntry(job, "steps")
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return steps
+	}
+	for _, step := range list.Content {
+		if step.Kind == yaml.AliasNode {
+			step = step.Alias
+		}
+		if step.Kind == yaml.MappingNode {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// scalarValue returns the value of a scalar entry of a mapping, or ""
+func scalarValue(node *yaml.Node, key string) string {
+	_, value := mappingEntry(node, key)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return value.Value
+}
+
+// forkGuarded reports whether a job or step only runs for the base repository
+func forkGuarded(node *yaml.Node) bool {
+	return forkGuardPattern.MatchString(scalarValue(node, "if"))
+}
+
+// actionName returns the action of a uses: reference without its version
+func actionName(uses string) string {
+	name, _, _ := strings.Cut(uses, "@")
+	return name
+}
+
+// checkUntrustedCheckout flags pull_request_target and workflow_run jobs that
+// check out or fetch the pull request's code, which then runs with secrets
+func checkUntrustedCheckout(content []byte, file string) []Issue {
+	var issues []Issue
+	w, ok := parseForkWorkflow(content)
+	event := w.privilegedEvent()
+	if !ok || event == "" {
+		return issues
+	}
+
+	for _, job := range w.Jobs {
+		for _, step := range jobSteps(job.Body) {
+			var at *yaml.Node
+			if actionName(scalarValue(step, "uses")) == "actions/checkout" {
+				_, with := mappingEntry(step, "with")
+				if _, ref := mappingEntry(with, "ref"); ref != nil && headRefPattern.MatchString(ref.Value) {
+					at = ref
+				}
+			} else if _, run := mappingEntry(step, "run"); run != nil && headFetchPattern.MatchString(run.Value) {
+				at = run
+			}
+			if at == nil {
+				continue
+			}
+			issues = append(issues, Issue{
+				Severity:   Error,
+				Message:    i18n.T("Job '%s' checks out the pull request's code in a %s workflow, which runs with secrets and a write token", job.Name, event),
+				File:       file,
+				Line:       at.Line,
+				Column:     at.Column,
+				Suggestion: i18n.T("Build and test fork code in a pull_request workflow, which gets no secrets, and only handle its artifacts here. If the checkout must stay, remove secrets from the job, set persist-credentials: false and permissions: read-all"),
+			})
+		}
+	}
+	return issues
+}
+
+// secretReference returns the first scalar below node that uses a secret
+// other than GITHUB_TOKEN, and the secret's name
+func secretReference(node *yaml.Node) (*yaml.Node, string) {
+	if node == nil {
+		return nil, ""
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		for _, m := range secretPattern.FindAllStringSubmatch(node.Value, -1) {
+			if m[1] != "GITHUB_TOKEN" {
+				return node, m[1]
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if found, name := secretReference(node.Content[i]); found != nil {
+				return found, name
+			}
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			if found, name := secretReference(child); found != nil {
+				return found, name
+			}
+		}
+	case yaml.AliasNode:
+		return secretReference(node.Alias)
+	}
+	return nil, ""
+}
+
+// checkForkSecrets flags pull_request jobs that use secrets without skipping
+// forks. Secrets are empty in those runs, so the step fails or quietly does
+// nothing, and the usual "fix" of moving to pull_request_target exposes them.
+func checkForkSecrets(content []byte, file string) []Issue {
+	var issues []Issue
+	w, ok := parseForkWorkflow(content)
+	if !ok || !w.Triggers["pull_request"] {
+		return issues
+	}
+
+	for _, job := range w.Jobs {
+		if job.Body == nil || forkGuarded(job.Body) {
+			continue
+		}
+		var at *yaml.Node
+		var name string
+		for _, key := range []string{"env", "with", "secrets"} {
+			_, value := mappingEntry(job.Body, key)
+			if at, name = secretReference(value); at != nil {
+				break
+			}
+		}
+		for _, step := range jobSteps(job.Body) {
+			if at != nil {
+				break
+			}
+			if !forkGuarded(step) {
+				at, name = secretReference(step)
+			}
+		}
+		if at == nil {
+			continue
+		}
+		issues = append(issues, Issue{
+			Severity:   Warning,
+			Message:    i18n.T("Job '%s' uses secret %s, which is empty in pull requests from forks", job.Name, name),
+			File:       file,
+			Line:       at.Line,
+			Column:     at.Column,
+			Suggestion: i18n.T("Skip the step for forks with '%s'. Do not switch to pull_request_target to get the secret", forkGuard),
+		})
+	}
+	return issues
+}
+
+// selfHosted reports whether a runs-on value selects a self-hosted runner
+func selfHosted(runsOn *yaml.Node) bool {
+	if runsOn == nil {
+		return false
+	}
+	switch runsOn.Kind {
+	case yaml.ScalarNode:
+		return runsOn.Value == "self-hosted"
+	case yaml.SequenceNode:
+		for _, label := range runsOn.Content {
+			if label.Value == "self-hosted" {
+				return true
+			}
+		}
+	case yaml.MappingNode:
+		_, labels := mappingEntry(runsOn, "labels")
+		return selfHosted(labels)
+	}
+	return false
+}
+
+// checkForkSelfHosted flags pull request jobs that run on self-hosted
+// runners, where anyone who opens a pull request runs code on the machine
+func checkForkSelfHosted(content []byte, file string) []Issue {
+	var issues []Issue
+	w, ok := parseForkWorkflow(content)
+	if !ok || (!w.Triggers["pull_request"] && !w.Triggers["pull_request_target"]) {
+		return issues
+	}
+
+	for _, job := range w.Jobs {
+		_, runsOn := mappingEntry(job.Body, "runs-on")
+		if !selfHosted(runsOn) || forkGuarded(job.Body) {
+			continue
+		}
+		issues = append(issues, Issue{
+			Severity:   Error,
+			Message:    i18n.T("Job '%s' runs pull requests from forks on a self-hosted runner", job.Name),
+			File:       file,
+			Line:       runsOn.Line,
+			Column:     runsOn.Column,
+			Suggestion: i18n.T("Run pull request jobs on GitHub-hosted runners, or skip forks with '%s'. A fork can run any code on the runner and leave it behind on a non-ephemeral one", forkGuard),
+		})
+	}
+	return issues
+}
+
+// savesCache reports whether a step writes to the Actions cache: actions/cache
+// itself, actions/cache/save, or a setup action with a cache: input
+func savesCache(step *yaml.Node) bool {
+	action := actionName(scalarValue(step, "uses"))
+	if action == "actions/cache" || action == "actions/cache/save" {
+		return true
+	}
+	if !strings.HasPrefix(action, "actions/setup-") {
+		return false
+	}
+	_, with := mappingEntry(step, "with")
+	cache := scalarValue(with, "cache")
+	return cache != "" && cache != "false"
+}
+
+// checkCachePoisoning flags caches saved by pull_request_target and
+// workflow_run jobs. Those runs use the default branch's cache scope, so an
+// entry written while handling a fork is restored by later pushes and
+// releases.
+func checkCachePoisoning(content []byte, file string) []Issue {
+	var issues []Issue
+	w, ok := parseForkWorkflow(content)
+	event := w.privilegedEvent()
+	if !ok || event == "" {
+		return issues
+	}
+
+	for _, job := range w.Jobs {
+		for _, step := range jobSteps(job.Body) {
+			if !savesCache(step) {
+				continue
+			}
+			uses, _ := mappingEntry(step, "uses")
+			issues = append(issues, Issue{
+				Severity:   Warning,
+				Message:    i18n.T("Job '%s' saves a cache in a %s workflow, which shares the default branch's cache", job.Name, event),
+				File:       file,
+				Line:       uses.Line,
+				Column:     uses.Column,
+				Suggestion: i18n.T("Use actions/cache/restore, which never saves, or remove the cache input of setup actions here. Save caches only from push workflows on the default branch"),
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,66 @@
+package linter
+
+import (
+	"regexp"
+	"strings"
+
+	"cicli/internal/i18n"
+)
+
+var (
+	// imageLine matches a GitLab "image: ref" or a CircleCI "- image: ref";
+	// an empty ref is GitLab's map form, whose ref is on the name: line
+	imageLine = regexp.MustCompile(`^\s*(?:-\s*)?image:\s*["']?([^\s"'#]*)`)
+	imageName = regexp.MustCompile(`^\s*name:\s*["']?([^\s"'#]+)`)
+)
+
+// checkLatestImages flags job images that use :latest or no tag at all,
+// which change underneath the pipeline and defeat the runner's image cache
+func checkLatestImages(content []byte, file string) []Issue {
+	var issues []Issue
+
+	lines := strings.Split(string(content), "\n")
+	for lineNum := 0; lineNum < len(lines); lineNum++ {
+		m := imageLine.FindStringSubmatch(lines[lineNum])
+		if m == nil {
+			continue
+		}
+		ref, line := m[1], lineNum
+		if ref == "" && lineNum+1 < len(lines) {
+			if n := imageName.FindStringSubmatch(lines[lineNum+1]); n != nil {
+				ref, line = n[1], lineNum+1
+			}
+		}
+		if ref == "" || strings.Contains(ref, "$") || strings.Contains(ref, "@sha256:") {
+			continue
+		}
+
+		var message string
+		switch imageTag(ref) {
+		case "latest":
+			message = i18n.T("Image '%s' uses the mutable :latest tag", ref)
+		case "":
+			message = i18n.T("Image '%s' has no tag and defaults to :latest", ref)
+		default:
+			continue
+		}
+		issues = append(issues, Issue{
+			Severity:   Warning,
+			Message:    message,
+			File:       file,
+			Line:       line + 1,
+			Suggestion: i18n.T("Pin a version tag, or a digest from 'docker buildx imagetools inspect %s'", ref),
+		})
+	}
+
+	return issues
+}
+
+// imageTag returns the tag of an image reference, ignoring a registry port
+func imageTag(ref string) string {
+	name := ref[strings.LastIndex(ref, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
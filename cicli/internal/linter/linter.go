@@ -1,13 +1,16 @@
 package linter
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 
-	"gopkg.in/yaml.v3"
+	"cicli/internal/anchors"
+	"cicli/internal/i18n"
+	"cicli/internal/term"
 )
 
 // Severity represents the severity of a lint issue
@@ -26,6 +29,7 @@ type Issue struct {
 	Message     string   `json:"message"`
 	File        string   `json:"file"`
 	Line        int      `json:"line,omitempty"`
+	Column      int      `json:"column,omitempty"`
 	Suggestion  string   `json:"suggestion,omitempty"`
 	AutoFixable bool     `json:"auto_fixable"`
 }
@@ -50,6 +54,8 @@ type Rule struct {
 	Description string
 	Severity    Severity
 	Platforms   []string // Which platforms this rule applies to
+	Public      bool     // Fork-safety rule, only run when PublicRepository is set
+	Profile     string   // Rule profile the rule belongs to; empty for every profile
 	Check       func(content []byte, file string) []Issue
 }
 
@@ -57,6 +63,7 @@ type Rule struct {
 func NewLinter() *Linter {
 	l := &Linter{}
 	l.registerRules()
+	l.rules = append(l.rules, registered...)
 	return l
 }
 
@@ -88,6 +95,14 @@ func (l *Linter) registerRules() {
 			Platforms:   []string{"github"},
 			Check:       checkUnpinnedActions,
 		},
+		{
+			ID:          "SEC004",
+			Name:        "token-permissions",
+			Description: "Workflows should restrict GITHUB_TOKEN with least-privilege permissions",
+			Severity:    Warning,
+			Platforms:   []string{"github"},
+			Check:       checkTokenPermissions,
+		},
 
 		// Best practices
 		{
@@ -114,6 +129,86 @@ func (l *Linter) registerRules() {
 			Platforms:   []string{"github"},
 			Check:       checkOutdatedActions,
 		},
+		{
+			ID:          "BP004",
+			Name:        "large-inline-script",
+			Description: "Long run: blocks should live in script files",
+			Severity:    Info,
+			Platforms:   []string{"github"},
+			Check:       checkLargeInlineScripts,
+		},
+		{
+			ID:          "BP005",
+			Name:        "raw-docker-build",
+			Description: "Images should be built with docker/build-push-action and layer caching",
+			Severity:    Info,
+			Platforms:   []string{"github"},
+			Check:       checkRawDockerBuilds,
+		},
+		{
+			ID:          "SH001",
+			Name:        "shellcheck",
+			Description: "Lint run: steps with shellcheck",
+			Severity:    Warning,
+			Platforms:   []string{"github"},
+			Check:       checkShellScripts,
+		},
+		{
+			ID:          "YAML002",
+			Name:        "schema",
+			Description: "Workflows must match the official workflow schema",
+			Severity:    Error,
+			Platforms:   []string{"github", "gitlab"},
+			Check:       checkSchema,
+		},
+		{
+			ID:          "EXPR001",
+			Name:        "expression-syntax",
+			Description: "if: conditions and ${{ }} expressions must parse, with known functions and contexts",
+			Severity:    Error,
+			Platforms:   []string{"github"},
+			Check:       checkExpressions,
+		},
+		{
+			ID:          "DAG001",
+			Name:        "unknown-needs",
+			Description: "needs: must name other jobs of the workflow",
+			Severity:    Error,
+			Platforms:   []string{"github"},
+			Check:       checkUnknownNeeds,
+		},
+		{
+			ID:          "DAG002",
+			Name:        "circular-needs",
+			Description: "Jobs must not need each other in a cycle",
+			Severity:    Error,
+			Platforms:   []string{"github"},
+			Check:       checkCircularNeeds,
+		},
+		{
+			ID:          "DAG003",
+			Name:        "dead-job",
+			Description: "Jobs whose condition or needs mean they never run",
+			Severity:    Warning,
+			Platforms:   []string{"github"},
+			Check:       checkDeadJobs,
+		},
+		{
+			ID:          "DAG004",
+			Name:        "unreachable-step",
+			Description: "Steps after a step that always fails, or with a condition that is always false",
+			Severity:    Warning,
+			Platforms:   []string{"github"},
+			Check:       checkUnreachableSteps,
+		},
+		{
+			ID:          "YAML001",
+			Name:        "anchor-semantics",
+			Description: "YAML anchors, aliases and merge keys whose expansion is surprising",
+			Severity:    Warning,
+			Platforms:   []string{"github", "gitlab", "circleci", "azure"},
+			Check:       checkAnchorSemantics,
+		},
 
 		// Performance
 		{
@@ -150,6 +245,80 @@ func (l *Linter) registerRules() {
 			Platforms:   []string{"github", "gitlab", "jenkins"},
 			Check:       checkErrorHandling,
 		},
+		{
+			ID:          "REL003",
+			Name:        "local-task-drift",
+			Description: "CI calls package.json scripts, Makefile targets or Taskfile tasks that do not exist",
+			Severity:    Warning,
+			Platforms:   []string{"github", "gitlab", "circleci", "azure"},
+			Check:       checkTaskDrift,
+		},
+		{
+			ID:          "REL004",
+			Name:        "unpinned-image",
+			Description: "Job images should be pinned to a version tag or digest, not :latest",
+			Severity:    Warning,
+			Platforms:   []string{"gitlab", "circleci"},
+			Check:       checkLatestImages,
+		},
+
+		// Fork safety, for public repositories
+		{
+			ID:          "FORK001",
+			Name:        "untrusted-checkout",
+			Description: "pull_request_target and workflow_run jobs must not run the pull request's code",
+			Severity:    Error,
+			Platforms:   []string{"github"},
+			Public:      true,
+			Check:       checkUntrustedCheckout,
+		},
+		{
+			ID:          "FORK002",
+			Name:        "fork-secrets",
+			Description: "pull_request jobs that use secrets should skip forks, which get none",
+			Severity:    Warning,
+			Platforms:   []string{"github"},
+			Public:      true,
+			Check:       checkForkSecrets,
+		},
+		{
+			ID:          "FORK003",
+			Name:        "fork-self-hosted",
+			Description: "Pull requests from forks must not run on self-hosted runners",
+			Severity:    Error,
+			Platforms:   []string{"github"},
+			Public:      true,
+			Check:       checkForkSelfHosted,
+		},
+		{
+			ID:          "FORK004",
+			Name:        "cache-poisoning",
+			Description: "pull_request_target and workflow_run jobs should not save caches",
+			Severity:    Warning,
+			Platforms:   []string{"github"},
+			Public:      true,
+			Check:       checkCachePoisoning,
+		},
+
+		// Runner safety, in the security-strict profile
+		{
+			ID:          "RUN001",
+			Name:        "outsider-self-hosted",
+			Description: "Events any user can trigger must not run on self-hosted runners",
+			Severity:    Error,
+			Platforms:   []string{"github"},
+			Profile:     SecurityStrict,
+			Check:       checkOutsiderSelfHosted,
+		},
+		{
+			ID:          "RUN002",
+			Name:        "repository-guard",
+			Description: "Jobs that need the repository's secrets, environments or runners should not run in forks",
+			Severity:    Warning,
+			Platforms:   []string{"github"},
+			Profile:     SecurityStrict,
+			Check:       checkRepositoryGuard,
+		},
 	}
 }
 
@@ -159,6 +328,8 @@ func (l *Linter) Lint(filePath string) (*LintResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	// Rules match line by line, so a CRLF file would end every line in \r
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
 
 	platform := detectPlatform(filePath)
 	result := &LintResult{
@@ -216,6 +387,12 @@ func (l *Linter) LintDirectory(dir string) ([]*LintResult, error) {
 }
 
 func (l *Linter) ruleApplies(rule Rule, platform string) bool {
+	if rule.Public && !forkRulesEnabled() {
+		return false
+	}
+	if rule.Profile != "" && rule.Profile != Profile {
+		return false
+	}
 	for _, p := range rule.Platforms {
 		if p == platform {
 			return true
@@ -263,13 +440,14 @@ func checkHardcodedSecrets(content []byte, file string) []Issue {
 	lines := strings.Split(string(content), "\n")
 	for lineNum, line := range lines {
 		for _, p := range patterns {
-			if p.pattern.MatchString(line) {
+			if loc := p.pattern.FindStringIndex(line); loc != nil {
 				issues = append(issues, Issue{
 					Severity:   Error,
-					Message:    fmt.Sprintf("Potential %s detected", p.name),
+					Message:    i18n.T("Potential %s detected", p.name),
 					File:       file,
 					Line:       lineNum + 1,
-					Suggestion: "Use secrets/environment variables instead of hardcoded values",
+					Column:     loc[0] + 1,
+					Suggestion: i18n.T("Use secrets/environment variables instead of hardcoded values"),
 				})
 			}
 		}
@@ -316,13 +494,14 @@ func checkInsecureCommands(content []byte, file string) []Issue {
 	lines := strings.Split(string(content), "\n")
 	for lineNum, line := range lines {
 		for _, p := range dangerousPatterns {
-			if p.pattern.MatchString(line) {
+			if loc := p.pattern.FindStringIndex(line); loc != nil {
 				issues = append(issues, Issue{
 					Severity:   Warning,
-					Message:    p.message,
+					Message:    i18n.T(p.message),
 					File:       file,
 					Line:       lineNum + 1,
-					Suggestion: p.fix,
+					Column:     loc[0] + 1,
+					Suggestion: i18n.T(p.fix),
 				})
 			}
 		}
@@ -339,16 +518,18 @@ func checkUnpinnedActions(content []byte, file string) []Issue {
 	lines := strings.Split(string(content), "\n")
 
 	for lineNum, line := range lines {
-		matches := pattern.FindStringSubmatch(line)
-		if len(matches) > 2 {
+		matches := pattern.FindStringSubmatchIndex(line)
+		if matches != nil {
+			action, tag := line[matches[2]:matches[3]], line[matches[4]:matches[5]]
 			// Skip first-party actions from actions/ org
-			if !strings.HasPrefix(matches[1], "actions/") {
+			if !strings.HasPrefix(action, "actions/") {
 				issues = append(issues, Issue{
 					Severity:    Warning,
-					Message:     fmt.Sprintf("Action '%s' uses tag '%s' instead of SHA pin", matches[1], matches[2]),
+					Message:     i18n.T("Action '%s' uses tag '%s' instead of SHA pin", action, tag),
 					File:        file,
 					Line:        lineNum + 1,
-					Suggestion:  "Pin to a specific commit SHA for security (e.g., @a1b2c3d4...)",
+					Column:      matches[0] + 1,
+					Suggestion:  i18n.T("Pin to a specific commit SHA for security (e.g., @a1b2c3d4...)"),
 					AutoFixable: false,
 				})
 			}
@@ -361,25 +542,24 @@ func checkUnpinnedActions(content []byte, file string) []Issue {
 func checkMissingTimeout(content []byte, file string) []Issue {
 	var issues []Issue
 
-	var config map[string]interface{}
-	if err := yaml.Unmarshal(content, &config); err != nil {
-		return issues
-	}
-
-	// Check GitHub Actions
-	if jobs, ok := config["jobs"].(map[string]interface{}); ok {
-		for jobName, jobData := range jobs {
-			if jd, ok := jobData.(map[string]interface{}); ok {
-				if _, hasTimeout := jd["timeout-minutes"]; !hasTimeout {
-					issues = append(issues, Issue{
-						Severity:    Warning,
-						Message:     fmt.Sprintf("Job '%s' has no timeout defined", jobName),
-						File:        file,
-						Suggestion:  "Add 'timeout-minutes' to prevent hung jobs",
-						AutoFixable: true,
-					})
-				}
-			}
+	for _, job := range workflowJobs(parseRoot(content)) {
+		if job.Body == nil {
+			continue
+		}
+		// Reusable workflow calls cannot set a timeout
+		if calls, _ := mappingEntry(job.Body, "uses"); calls != nil {
+			continue
+		}
+		if timeout, _ := mappingEntry(job.Body, "timeout-minutes"); timeout == nil {
+			issues = append(issues, Issue{
+				Severity:    Warning,
+				Message:     i18n.T("Job '%s' has no timeout defined", job.Name),
+				File:        file,
+				Line:        job.Key.Line,
+				Column:      job.Key.Column,
+				Suggestion:  i18n.T("Add 'timeout-minutes' to prevent hung jobs"),
+				AutoFixable: true,
+			})
 		}
 	}
 
@@ -390,12 +570,26 @@ func checkMissingConcurrency(content []byte, file string) []Issue {
 	var issues []Issue
 
 	if !strings.Contains(string(content), "concurrency:") {
-		issues = append(issues, Issue{
+		issue := Issue{
 			Severity:   Info,
-			Message:    "Workflow has no concurrency control",
+			Message:    i18n.T("Workflow has no concurrency control"),
 			File:       file,
-			Suggestion: "Add 'concurrency' to cancel outdated runs on the same branch",
-		})
+			Suggestion: i18n.T("Add 'concurrency' to cancel outdated runs on the same branch"),
+		}
+		// The block belongs next to the triggers it is keyed on
+		if on, _ := mappingEntry(parseRoot(content), "on"); on != nil {
+			issue.Line, issue.Column = on.Line, on.Column
+		}
+		if plan, ok := planConcurrency(content); ok {
+			switch {
+			case plan.Deploy:
+				issue.Suggestion = i18n.T("Add 'concurrency' with cancel-in-progress: false so deployments queue instead of being cancelled")
+			case plan.Fixable():
+				issue.Suggestion = i18n.T("Add 'concurrency' keyed on the pull request so new pushes cancel superseded runs")
+				issue.AutoFixable = true
+			}
+		}
+		issues = append(issues, issue)
 	}
 
 	return issues
@@ -404,39 +598,17 @@ func checkMissingConcurrency(content []byte, file string) []Issue {
 func checkOutdatedActions(content []byte, file string) []Issue {
 	var issues []Issue
 
-	// Map of actions to their latest major versions
-	latestVersions := map[string]int{
-		"actions/checkout":       4,
-		"actions/setup-node":     4,
-		"actions/setup-python":   5,
-		"actions/setup-go":       5,
-		"actions/cache":          4,
-		"actions/upload-artifact": 4,
-		"actions/download-artifact": 4,
-		"docker/build-push-action": 6,
-		"docker/login-action":    3,
-	}
-
-	pattern := regexp.MustCompile(`uses:\s*([^@]+)@v(\d+)`)
-	lines := strings.Split(string(content), "\n")
-
-	for lineNum, line := range lines {
-		matches := pattern.FindStringSubmatch(line)
-		if len(matches) > 2 {
-			action := matches[1]
-			var version int
-			fmt.Sscanf(matches[2], "%d", &version)
-
-			if latest, ok := latestVersions[action]; ok && version < latest {
-				issues = append(issues, Issue{
-					Severity:    Warning,
-					Message:     fmt.Sprintf("Action '%s@v%d' is outdated (latest: v%d)", action, version, latest),
-					File:        file,
-					Line:        lineNum + 1,
-					Suggestion:  fmt.Sprintf("Update to %s@v%d", action, latest),
-					AutoFixable: true,
-				})
-			}
+	for lineNum, line := range strings.Split(string(content), "\n") {
+		if action, version, latest, ok := outdatedAction(line); ok {
+			issues = append(issues, Issue{
+				Severity:    Warning,
+				Message:     i18n.T("Action '%s@v%d' is outdated (latest: v%d)", action, version, latest),
+				File:        file,
+				Line:        lineNum + 1,
+				Column:      strings.Index(line, action) + 1,
+				Suggestion:  i18n.T("Update to %s@v%d", action, latest),
+				AutoFixable: true,
+			})
 		}
 	}
 
@@ -466,11 +638,14 @@ func checkMissingCache(content []byte, file string) []Issue {
 	for _, pm := range packageManagers {
 		if strings.Contains(contentStr, pm.indicator) {
 			if !strings.Contains(contentStr, "cache") && !strings.Contains(contentStr, pm.cacheKey+"-cache") {
+				line, column := commandPosition(content, pm.indicator)
 				issues = append(issues, Issue{
 					Severity:   Info,
-					Message:    fmt.Sprintf("Using %s but no cache configured", pm.name),
+					Message:    i18n.T("Using %s but no cache configured", pm.name),
 					File:       file,
-					Suggestion: fmt.Sprintf("Add caching for %s dependencies to speed up builds", pm.name),
+					Line:       line,
+					Column:     column,
+					Suggestion: i18n.T("Add caching for %s dependencies to speed up builds", pm.name),
 				})
 				break // Only report once
 			}
@@ -483,33 +658,27 @@ func checkMissingCache(content []byte, file string) []Issue {
 func checkSequentialJobs(content []byte, file string) []Issue {
 	var issues []Issue
 
-	var config map[string]interface{}
-	if err := yaml.Unmarshal(content, &config); err != nil {
-		return issues
-	}
-
 	// Check for jobs that don't depend on each other but run sequentially
-	if jobs, ok := config["jobs"].(map[string]interface{}); ok {
-		jobsWithNeeds := 0
-		totalJobs := len(jobs)
-
-		for _, jobData := range jobs {
-			if jd, ok := jobData.(map[string]interface{}); ok {
-				if _, hasNeeds := jd["needs"]; hasNeeds {
-					jobsWithNeeds++
-				}
-			}
+	root := parseRoot(content)
+	jobs := workflowJobs(root)
+	jobsWithNeeds := 0
+	for _, job := range jobs {
+		if needs, _ := mappingEntry(job.Body, "needs"); needs != nil {
+			jobsWithNeeds++
 		}
+	}
 
-		// If many jobs have dependencies, they might be overly sequential
-		if totalJobs > 2 && jobsWithNeeds == totalJobs-1 {
-			issues = append(issues, Issue{
-				Severity:   Info,
-				Message:    "Jobs appear to be running sequentially",
-				File:       file,
-				Suggestion: "Consider if some jobs can run in parallel to reduce build time",
-			})
-		}
+	// If many jobs have dependencies, they might be overly sequential
+	if len(jobs) > 2 && jobsWithNeeds == len(jobs)-1 {
+		key, _ := mappingEntry(root, "jobs")
+		issues = append(issues, Issue{
+			Severity:   Info,
+			Message:    i18n.T("Jobs appear to be running sequentially"),
+			File:       file,
+			Line:       key.Line,
+			Column:     key.Column,
+			Suggestion: i18n.T("Consider if some jobs can run in parallel to reduce build time"),
+		})
 	}
 
 	return issues
@@ -537,11 +706,14 @@ func checkMissingRetry(content []byte, file string) []Issue {
 	if !hasRetry {
 		for _, pattern := range flakyPatterns {
 			if strings.Contains(contentStr, pattern) {
+				line, column := commandPosition(content, pattern)
 				issues = append(issues, Issue{
 					Severity:   Info,
-					Message:    fmt.Sprintf("'%s' may fail due to network issues", pattern),
+					Message:    i18n.T("'%s' may fail due to network issues", pattern),
 					File:       file,
-					Suggestion: "Consider adding retry logic for network-dependent operations",
+					Line:       line,
+					Column:     column,
+					Suggestion: i18n.T("Consider adding retry logic for network-dependent operations"),
 				})
 				break
 			}
@@ -559,7 +731,7 @@ func checkErrorHandling(content []byte, file string) []Issue {
 	lines := strings.Split(string(content), "\n")
 
 	for lineNum, line := range lines {
-		if pattern.MatchString(line) {
+		if loc := pattern.FindStringIndex(line); loc != nil {
 			// Check next few lines for 'set -e' or error handling
 			hasErrorHandling := false
 			for i := lineNum + 1; i < len(lines) && i < lineNum+5; i++ {
@@ -579,10 +751,11 @@ func checkErrorHandling(content []byte, file string) []Issue {
 			if !hasErrorHandling {
 				issues = append(issues, Issue{
 					Severity:   Warning,
-					Message:    "Multi-line script without explicit error handling",
+					Message:    i18n.T("Multi-line script without explicit error handling"),
 					File:       file,
 					Line:       lineNum + 1,
-					Suggestion: "Add 'set -e' at the start of multi-line scripts",
+					Column:     loc[0] + 1,
+					Suggestion: i18n.T("Add 'set -e' at the start of multi-line scripts"),
 				})
 			}
 		}
@@ -591,6 +764,26 @@ func checkErrorHandling(content []byte, file string) []Issue {
 	return issues
 }
 
+func checkAnchorSemantics(content []byte, file string) []Issue {
+	var issues []Issue
+
+	report, err := anchors.Scan(content)
+	if err != nil {
+		return issues
+	}
+	for _, w := range report.Warnings {
+		issues = append(issues, Issue{
+			Severity:   Warning,
+			Message:    w.Message,
+			File:       file,
+			Line:       w.Line,
+			Suggestion: i18n.T("Spell out the intended values or restructure the anchors so the expanded YAML matches"),
+		})
+	}
+
+	return issues
+}
+
 func detectPlatform(path string) string {
 	switch {
 	case strings.Contains(path, ".github"):
@@ -612,13 +805,13 @@ func detectPlatform(path string) string {
 
 // PrintReport outputs a formatted lint report
 func (r *LintResult) PrintReport() {
-	fmt.Printf("\n🔍 Lint Report: %s\n", r.File)
-	fmt.Printf("   Platform: %s\n", r.Platform)
-	fmt.Printf("   Score: %d/100\n", r.Score)
-	fmt.Println(strings.Repeat("─", 50))
+	term.Printf("\n🔍 %s\n", i18n.T("Lint Report: %s", r.File))
+	term.Printf("   %s\n", i18n.T("Platform: %s", r.Platform))
+	term.Printf("   %s\n", i18n.T("Score: %d/100", r.Score))
+	term.Println(strings.Repeat("─", 50))
 
 	if len(r.Issues) == 0 {
-		fmt.Println("   ✅ No issues found!")
+		term.Println("   ✅ " + i18n.T("No issues found!"))
 		return
 	}
 
@@ -639,36 +832,38 @@ func (r *LintResult) PrintReport() {
 	}
 
 	if len(errors) > 0 {
-		fmt.Println("\n   🚨 Errors:")
+		term.Println("\n   🚨 " + i18n.T("Errors:"))
 		for _, issue := range errors {
 			printIssue(issue)
 		}
 	}
 
 	if len(warnings) > 0 {
-		fmt.Println("\n   ⚠️  Warnings:")
+		term.Println("\n   ⚠️  " + i18n.T("Warnings:"))
 		for _, issue := range warnings {
 			printIssue(issue)
 		}
 	}
 
 	if len(infos) > 0 {
-		fmt.Println("\n   ℹ️  Info:")
+		term.Println("\n   ℹ️  " + i18n.T("Info:"))
 		for _, issue := range infos {
 			printIssue(issue)
 		}
 	}
 
-	fmt.Println()
+	term.Println()
 }
 
 func printIssue(issue Issue) {
 	loc := ""
-	if issue.Line > 0 {
-		loc = fmt.Sprintf(" (line %d)", issue.Line)
+	if issue.Line > 0 && issue.Column > 0 {
+		loc = i18n.T(" (line %d, column %d)", issue.Line, issue.Column)
+	} else if issue.Line > 0 {
+		loc = i18n.T(" (line %d)", issue.Line)
 	}
-	fmt.Printf("      [%s]%s %s\n", issue.Rule, loc, issue.Message)
+	term.Printf("      [%s]%s %s\n", issue.Rule, loc, issue.Message)
 	if issue.Suggestion != "" {
-		fmt.Printf("         → %s\n", issue.Suggestion)
+		term.Printf("         → %s\n", issue.Suggestion)
 	}
 }
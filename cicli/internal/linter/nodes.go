@@ -0,0 +1,117 @@
+package linter
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// jobNode is a job of a workflow with the nodes of its key and body, so
+// issues can point at the job's line and column
+type jobNode struct {
+	Name string
+	Key  *yaml.Node
+	Body *yaml.Node // nil when the job is not a mapping
+}
+
+// parseRoot returns the top-level mapping of a CI file, or nil when the file
+// is not valid YAML or not a mapping
+func parseRoot(content []byte) *yaml.Node {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+	return root
+}
+
+// mappingEntry returns the key and value nodes of key in a mapping, following
+// an alias value to the node it refers to
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			value := node.Content[i+1]
+			if value.Kind == yaml.AliasNode {
+				value = value.Alias
+			}
+			return node.Content[i], value
+		}
+	}
+	return nil, nil
+}
+
+// workflowJobs returns the jobs of a GitHub Actions workflow in document order
+func workflowJobs(root *yaml.Node) []jobNode {
+	var jobs []jobNode
+	_, body := mappingEntry(root, "jobs")
+	if body == nil || body.Kind != yaml.MappingNode {
+		return jobs
+	}
+	for i := 0; i+1 < len(body.Content); i += 2 {
+		job := jobNode{Name: body.Content[i].Value, Key: body.Content[i]}
+		if value := body.Content[i+1]; value.Kind == yaml.MappingNode {
+			job.Body = value
+		} else if value.Kind == yaml.AliasNode && value.Alias.Kind == yaml.MappingNode {
+			job.Body = value.Alias
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// findScalar returns the first scalar value below node, in document order,
+// that contains needle. Mapping keys are not searched.
+func findScalar(node *yaml.Node, needle string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if strings.Contains(node.Value, needle) {
+			return node
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if found := findScalar(node.Content[i], needle); found != nil {
+				return found
+			}
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			if found := findScalar(child, needle); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// scalarPosition returns the 1-based line and column of needle inside a
+// scalar. Block scalars start on the line after their | or > indicator, so
+// the source is searched from the node's line onwards; the node's own
+// position is the fallback when needle is split across folded lines.
+func scalarPosition(lines []string, node *yaml.Node, needle string) (int, int) {
+	last := node.Line + strings.Count(node.Value, "\n") + 1
+	for i := node.Line - 1; i >= 0 && i < last && i < len(lines); i++ {
+		if col := strings.Index(lines[i], needle); col >= 0 {
+			return i + 1, col + 1
+		}
+	}
+	return node.Line, node.Column
+}
+
+// commandPosition returns the line and column of the first step command, or
+// other scalar value, that contains command; 0, 0 when there is none
+func commandPosition(content []byte, command string) (int, int) {
+	node := findScalar(parseRoot(content), command)
+	if node == nil {
+		return 0, 0
+	}
+	return scalarPosition(strings.Split(string(content), "\n"), node, command)
+}
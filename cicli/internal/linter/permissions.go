@@ -0,0 +1,162 @@
+package linter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"cicli/internal/i18n"
+
+	"gopkg.in/yaml.v3"
+)
+
+// actionScopes are the GITHUB_TOKEN scopes well-known actions need beyond
+// contents: read. Cloud login actions only need id-token when they use OIDC,
+// which tokenScopes checks separately.
+var actionScopes = map[string][]string{
+	"actions/attest-build-provenance":        {"attestations", "id-token"},
+	"actions/deploy-pages":                   {"id-token", "pages"},
+	"changesets/action":                      {"contents", "pull-requests"},
+	"github/codeql-action/analyze":           {"security-events"},
+	"github/codeql-action/upload-sarif":      {"security-events"},
+	"marocchino/sticky-pull-request-comment": {"pull-requests"},
+	"ncipollo/release-action":                {"contents"},
+	"peaceiris/actions-gh-pages":             {"contents"},
+	"peter-evans/create-pull-request":        {"contents", "pull-requests"},
+	"softprops/action-gh-release":            {"contents"},
+	"stefanzweifel/git-auto-commit-action":   {"contents"},
+}
+
+// oidcInputs are the inputs that make a cloud login action use OIDC
+var oidcInputs = map[string]string{
+	"aws-actions/configure-aws-credentials": "role-to-assume",
+	"google-github-actions/auth":            "workload_identity_provider",
+	"azure/login":                           "client-id",
+}
+
+// commandScopes are the scopes run: commands need to write with GITHUB_TOKEN
+var commandScopes = []struct {
+	pattern *regexp.Regexp
+	scope   string
+}{
+	{regexp.MustCompile(`\bgh\s+release\s+(create|upload|edit|delete)\b|\bgit\s+push\b`), "contents"},
+	{regexp.MustCompile(`\bgh\s+pr\s+(create|comment|edit|merge|review|close)\b`), "pull-requests"},
+	{regexp.MustCompile(`\bgh\s+issue\s+(create|comment|edit|close)\b`), "issues"},
+	{regexp.MustCompile(`\bdocker\s+push\s+ghcr\.io/`), "packages"},
+}
+
+// tokenScopes returns the scopes a job writes to with GITHUB_TOKEN, sorted
+func tokenScopes(job *yaml.Node) []string {
+	set := make(map[string]bool)
+	for _, step := range jobSteps(job) {
+		action := actionName(scalarValue(step, "uses"))
+		for _, scope := range actionScopes[action] {
+			set[scope] = true
+		}
+		_, with := mappingEntry(step, "with")
+		if input, ok := oidcInputs[action]; ok && scalarValue(with, input) != "" {
+			set["id-token"] = true
+		}
+		if action == "docker/login-action" && strings.HasPrefix(scalarValue(with, "registry"), "ghcr.io") {
+			set["packages"] = true
+		}
+		run := scalarValue(step, "run")
+		for _, c := range commandScopes {
+			if c.pattern.MatchString(run) {
+				set[c.scope] = true
+			}
+		}
+	}
+	scopes := make([]string, 0, len(set))
+	for scope := range set {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// permissionsBlock formats the least-privilege permissions of a job: read
+// access to contents, which checkout needs, and write access to the scopes
+// it uses
+func permissionsBlock(scopes []string) string {
+	entries := make([]string, 0, len(scopes)+1)
+	if !contains(scopes, "contents") {
+		entries = append(entries, "contents: read")
+	}
+	for _, scope := range scopes {
+		entries = append(entries, scope+": write")
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ", ")
+}
+
+// checkTokenPermissions flags workflows that leave GITHUB_TOKEN at the
+// repository's default permissions, which may be read-write on everything,
+// and permissions: write-all at the top level or on a job
+func checkTokenPermissions(content []byte, file string) []Issue {
+	var issues []Issue
+	root := parseRoot(content)
+	jobs := workflowJobs(root)
+	if len(jobs) == 0 {
+		return issues
+	}
+
+	_, top := mappingEntry(root, "permissions")
+	if top != nil && top.Value == "write-all" {
+		issues = append(issues, Issue{
+			Severity:   Error,
+			Message:    i18n.T("Workflow grants GITHUB_TOKEN write-all permissions"),
+			File:       file,
+			Line:       top.Line,
+			Column:     top.Column,
+			Suggestion: permissionsSuggestion(i18n.T("Set 'permissions: contents: read' at the top level"), jobs),
+		})
+	}
+
+	var unset []string
+	for _, job := range jobs {
+		_, perms := mappingEntry(job.Body, "permissions")
+		if perms == nil {
+			unset = append(unset, job.Name)
+			continue
+		}
+		if perms.Value == "write-all" {
+			issues = append(issues, Issue{
+				Severity:   Error,
+				Message:    i18n.T("Job '%s' grants GITHUB_TOKEN write-all permissions", job.Name),
+				File:       file,
+				Line:       perms.Line,
+				Column:     perms.Column,
+				Suggestion: i18n.T("Replace write-all with the scopes the job uses: %s", permissionsBlock(tokenScopes(job.Body))),
+			})
+		}
+	}
+
+	if top == nil && len(unset) > 0 {
+		jobsKey, _ := mappingEntry(root, "jobs")
+		issues = append(issues, Issue{
+			Severity:   Warning,
+			Message:    i18n.T("Workflow has no permissions block, so GITHUB_TOKEN gets the repository's default permissions"),
+			File:       file,
+			Line:       jobsKey.Line,
+			Column:     jobsKey.Column,
+			Suggestion: permissionsSuggestion(i18n.T("Add 'permissions: contents: read' above jobs:"), jobs),
+		})
+	}
+	return issues
+}
+
+// permissionsSuggestion follows the top-level fix with the permissions block
+// of each job that needs more than contents: read
+func permissionsSuggestion(fix string, jobs []jobNode) string {
+	var needs []string
+	for _, job := range jobs {
+		if scopes := tokenScopes(job.Body); len(scopes) > 0 {
+			needs = append(needs, job.Name+" ("+permissionsBlock(scopes)+")")
+		}
+	}
+	if len(needs) == 0 {
+		return i18n.T("%s; no job writes with GITHUB_TOKEN", fix)
+	}
+	return i18n.T("%s, then grant each job only the scopes it writes to: %s", fix, strings.Join(needs, "; "))
+}
@@ -0,0 +1,171 @@
+package linter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sarifSchema is the SARIF 2.1.0 schema GitHub Code Scanning accepts
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string          `json:"id"`
+	Name                 string          `json:"name"`
+	ShortDescription     sarifMessage    `json:"shortDescription"`
+	DefaultConfiguration sarifRuleConfig `json:"defaultConfiguration"`
+	Properties           sarifRuleProps  `json:"properties"`
+}
+
+type sarifRuleConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifRuleProps struct {
+	Tags []string `json:"tags,omitempty"`
+	// security-severity makes Code Scanning rank security findings
+	SecuritySeverity string `json:"security-severity,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	RuleIndex  *int              `json:"ruleIndex,omitempty"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// sarifLevels maps issue severities to SARIF result levels
+var sarifLevels = map[Severity]string{
+	Error:   "error",
+	Warning: "warning",
+	Info:    "note",
+}
+
+// securitySeverities rank security rules for Code Scanning, which sorts
+// alerts by this CVSS-style score
+var securitySeverities = map[Severity]string{
+	Error:   "8.0",
+	Warning: "5.0",
+	Info:    "2.0",
+}
+
+// SARIF encodes lint results as a SARIF 2.1.0 log with a single run, for
+// upload to GitHub Code Scanning. Every registered rule is listed so alerts
+// link to their description; file paths are made relative to the working
+// directory, which is what Code Scanning matches against the repository.
+func (l *Linter) SARIF(results []*LintResult, version string) ([]byte, error) {
+	driver := sarifDriver{
+		Name:           "cicli",
+		Version:        version,
+		InformationURI: "https://github.com/Arnab-Afk/CiCLI",
+		Rules:          []sarifRule{},
+	}
+	index := make(map[string]int)
+	for _, rule := range l.rules {
+		index[rule.ID] = len(driver.Rules)
+		props := sarifRuleProps{Tags: []string{"ci"}}
+		if strings.HasPrefix(rule.ID, "SEC") || rule.Public || rule.Profile == SecurityStrict {
+			props.Tags = append(props.Tags, "security")
+			props.SecuritySeverity = securitySeverities[rule.Severity]
+		}
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			Name:                 rule.Name,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifRuleConfig{Level: sarifLevels[rule.Severity]},
+			Properties:           props,
+		})
+	}
+
+	run := sarifRun{Tool: sarifTool{Driver: driver}, Results: []sarifResult{}}
+	for _, result := range results {
+		for _, issue := range result.Issues {
+			file := issue.File
+			if file == "" {
+				file = result.File
+			}
+			text := issue.Message
+			if issue.Suggestion != "" {
+				text += "\n" + issue.Suggestion
+			}
+			location := sarifPhysicalLocation{ArtifactLocation: sarifArtifact{URI: sarifURI(file)}}
+			if issue.Line > 0 {
+				location.Region = &sarifRegion{StartLine: issue.Line, StartColumn: issue.Column}
+			}
+			res := sarifResult{
+				RuleID:    issue.Rule,
+				Level:     sarifLevels[issue.Severity],
+				Message:   sarifMessage{Text: text},
+				Locations: []sarifLocation{{PhysicalLocation: location}},
+			}
+			if i, ok := index[issue.Rule]; ok {
+				res.RuleIndex = &i
+			}
+			if issue.AutoFixable {
+				res.Properties = map[string]string{"fix": "cicli lint --fix"}
+			}
+			run.Results = append(run.Results, res)
+		}
+	}
+
+	return json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}}, "", "  ")
+}
+
+// sarifURI turns a file path into a relative, slash-separated URI
+func sarifURI(file string) string {
+	if filepath.IsAbs(file) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, file); err == nil && !strings.HasPrefix(rel, "..") {
+				file = rel
+			}
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(file))
+}
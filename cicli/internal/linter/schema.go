@@ -0,0 +1,668 @@
+package linter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"cicli/internal/i18n"
+
+	"gopkg.in/yaml.v3"
+)
+
+// shape is one node of a workflow schema. It follows the official
+// github-workflow and gitlab-ci JSON schemas closely enough to catch unknown
+// keys, wrong types and invalid values, without their conditional rules.
+type shape struct {
+	types    []string          // string, number, boolean, mapping, sequence, null; empty accepts any
+	keys     map[string]*shape // known keys of a mapping
+	values   *shape            // shape of keys not in keys; nil reports them as unknown
+	items    *shape            // shape of sequence items
+	enum     []string          // allowed scalar values
+	required []string          // keys a mapping must have
+	oneOf    []string          // a mapping must have at least one of these keys
+	alts     []*shape          // alternatives, picked by the type of the node
+}
+
+func scalarOf(types ...string) *shape { return &shape{types: types} }
+
+func mapping(keys map[string]*shape) *shape { return &shape{types: []string{"mapping"}, keys: keys} }
+
+func mapOf(values *shape) *shape { return &shape{types: []string{"mapping"}, values: values} }
+
+func seqOf(items *shape) *shape { return &shape{types: []string{"sequence"}, items: items} }
+
+func enumOf(values ...string) *shape { return &shape{types: []string{"string"}, enum: values} }
+
+func either(alts ...*shape) *shape { return &shape{alts: alts} }
+
+var (
+	anything   = &shape{}
+	str        = scalarOf("string")
+	number     = scalarOf("number")
+	boolean    = scalarOf("boolean")
+	anyMapping = mapOf(anything)
+	stringList = either(str, seqOf(str))
+	envMap     = mapOf(scalarOf("string", "number", "boolean"))
+)
+
+// githubEvents maps each workflow trigger to the activity types it accepts;
+// events without types map to nil
+var githubEvents = map[string][]string{
+	"branch_protection_rule":      {"created", "edited", "deleted"},
+	"check_run":                   {"created", "rerequested", "completed", "requested_action"},
+	"check_suite":                 {"completed", "requested", "rerequested"},
+	"create":                      nil,
+	"delete":                      nil,
+	"deployment":                  nil,
+	"deployment_status":           nil,
+	"discussion":                  {"created", "edited", "deleted", "transferred", "pinned", "unpinned", "labeled", "unlabeled", "locked", "unlocked", "category_changed", "answered", "unanswered"},
+	"discussion_comment":          {"created", "edited", "deleted"},
+	"fork":                        nil,
+	"gollum":                      nil,
+	"issue_comment":               {"created", "edited", "deleted"},
+	"issues":                      {"opened", "edited", "deleted", "transferred", "pinned", "unpinned", "closed", "reopened", "assigned", "unassigned", "labeled", "unlabeled", "locked", "unlocked", "milestoned", "demilestoned", "typed", "untyped"},
+	"label":                       {"created", "edited", "deleted"},
+	"merge_group":                 {"checks_requested"},
+	"milestone":                   {"created", "closed", "opened", "edited", "deleted"},
+	"page_build":                  nil,
+	"project":                     {"created", "closed", "reopened", "edited", "deleted"},
+	"project_card":                {"created", "moved", "converted", "edited", "deleted"},
+	"project_column":              {"created", "updated", "moved", "deleted"},
+	"public":                      nil,
+	"pull_request":                pullRequestTypes,
+	"pull_request_review":         {"submitted", "edited", "dismissed"},
+	"pull_request_review_comment": {"created", "edited", "deleted"},
+	"pull_request_target":         pullRequestTypes,
+	"push":                        nil,
+	"registry_package":            {"published", "updated"},
+	"release":                     {"published", "unpublished", "created", "edited", "deleted", "prereleased", "released"},
+	"repository_dispatch":         nil,
+	"schedule":                    nil,
+	"status":                      nil,
+	"watch":                       {"started"},
+	"workflow_call":               nil,
+	"workflow_dispatch":           nil,
+	"workflow_run":                {"requested", "completed", "in_progress"},
+}
+
+var pullRequestTypes = []string{
+	"assigned", "unassigned", "labeled", "unlabeled", "opened", "edited", "closed", "reopened",
+	"synchronize", "converted_to_draft", "ready_for_review", "locked", "unlocked",
+	"review_requested", "review_request_removed", "auto_merge_enabled", "auto_merge_disabled",
+	"milestoned", "demilestoned", "enqueued", "dequeued",
+}
+
+// githubPermissionScopes are the scopes of a permissions: mapping
+var githubPermissionScopes = []string{
+	"actions", "attestations", "checks", "contents", "deployments", "discussions", "id-token",
+	"issues", "models", "packages", "pages", "pull-requests", "repository-projects",
+	"security-events", "statuses",
+}
+
+// githubWorkflow is the schema of a GitHub Actions workflow file
+var githubWorkflow = githubWorkflowSchema()
+
+func githubWorkflowSchema() *shape {
+	scopes := make(map[string]*shape)
+	for _, scope := range githubPermissionScopes {
+		scopes[scope] = enumOf("read", "write", "none")
+	}
+	permissions := either(enumOf("read-all", "write-all"), mapping(scopes))
+	concurrency := either(str, mapping(map[string]*shape{"group": str, "cancel-in-progress": boolean}))
+	defaults := mapping(map[string]*shape{"run": mapping(map[string]*shape{"shell": str, "working-directory": str})})
+	container := mapping(map[string]*shape{
+		"image":       str,
+		"credentials": mapping(map[string]*shape{"username": str, "password": str}),
+		"env":         envMap,
+		"ports":       seqOf(scalarOf("string", "number")),
+		"volumes":     seqOf(str),
+		"options":     str,
+	})
+	container.required = []string{"image"}
+	strategy := mapping(map[string]*shape{
+		"matrix": either(str, &shape{
+			types:  []string{"mapping"},
+			keys:   map[string]*shape{"include": seqOf(anyMapping), "exclude": seqOf(anyMapping)},
+			values: seqOf(anything),
+		}),
+		"fail-fast":    boolean,
+		"max-parallel": number,
+	})
+
+	step := mapping(map[string]*shape{
+		"id":                str,
+		"if":                str,
+		"name":              str,
+		"uses":              str,
+		"run":               str,
+		"working-directory": str,
+		"shell":             str,
+		"with":              envMap,
+		"env":               envMap,
+		"continue-on-error": boolean,
+		"timeout-minutes":   number,
+	})
+	step.oneOf = []string{"uses", "run"}
+
+	job := mapping(map[string]*shape{
+		"name":              str,
+		"needs":             stringList,
+		"permissions":       permissions,
+		"runs-on":           either(str, seqOf(str), mapping(map[string]*shape{"group": str, "labels": stringList})),
+		"environment":       either(str, mapping(map[string]*shape{"name": str, "url": str})),
+		"concurrency":       concurrency,
+		"outputs":           mapOf(str),
+		"env":               envMap,
+		"defaults":          defaults,
+		"if":                str,
+		"steps":             seqOf(step),
+		"timeout-minutes":   number,
+		"strategy":          strategy,
+		"continue-on-error": boolean,
+		"container":         either(str, container),
+		"services":          mapOf(either(str, container)),
+	})
+	job.required = []string{"runs-on"}
+	callJob := mapping(map[string]*shape{
+		"name":        str,
+		"needs":       stringList,
+		"permissions": permissions,
+		"if":          str,
+		"uses":        str,
+		"with":        envMap,
+		"secrets":     either(enumOf("inherit"), envMap),
+		"strategy":    strategy,
+		"concurrency": concurrency,
+	})
+
+	return &shape{
+		types: []string{"mapping"},
+		keys: map[string]*shape{
+			"name":        str,
+			"run-name":    str,
+			"on":          anything, // checked by checkTriggers
+			"env":         envMap,
+			"defaults":    defaults,
+			"concurrency": concurrency,
+			"permissions": permissions,
+			"jobs":        &shape{types: []string{"mapping"}, values: either(job, callJob)},
+		},
+		required: []string{"on", "jobs"},
+	}
+}
+
+// githubTrigger is the schema of the configuration of one event under on:
+func githubTrigger(event string) *shape {
+	filters := map[string]*shape{}
+	if types := githubEvents[event]; types != nil {
+		filters["types"] = either(enumOf(types...), seqOf(enumOf(types...)))
+	}
+	switch event {
+	case "push":
+		for _, key := range []string{"branches", "branches-ignore", "tags", "tags-ignore", "paths", "paths-ignore"} {
+			filters[key] = stringList
+		}
+	case "pull_request", "pull_request_target":
+		for _, key := range []string{"branches", "branches-ignore", "paths", "paths-ignore"} {
+			filters[key] = stringList
+		}
+	case "workflow_run":
+		for _, key := range []string{"workflows", "branches", "branches-ignore"} {
+			filters[key] = stringList
+		}
+	case "repository_dispatch":
+		filters["types"] = stringList
+	case "schedule":
+		cron := mapping(map[string]*shape{"cron": str, "timezone": str})
+		cron.required = []string{"cron"}
+		return seqOf(cron)
+	case "workflow_dispatch":
+		input := mapping(map[string]*shape{
+			"description":        str,
+			"deprecationMessage": str,
+			"required":           boolean,
+			"default":            scalarOf("string", "number", "boolean"),
+			"type":               enumOf("boolean", "choice", "number", "environment", "string"),
+			"options":            seqOf(scalarOf("string", "number")),
+		})
+		filters["inputs"] = mapOf(input)
+	case "workflow_call":
+		input := mapping(map[string]*shape{
+			"description": str,
+			"required":    boolean,
+			"default":     scalarOf("string", "number", "boolean"),
+			"type":        enumOf("boolean", "number", "string"),
+		})
+		input.required = []string{"type"}
+		output := mapping(map[string]*shape{"description": str, "value": str})
+		output.required = []string{"value"}
+		secret := mapping(map[string]*shape{"description": str, "required": boolean})
+		filters["inputs"] = mapOf(input)
+		filters["outputs"] = mapOf(output)
+		filters["secrets"] = mapOf(either(scalarOf("null"), secret))
+	}
+	return either(scalarOf("null"), mapping(filters))
+}
+
+// gitlabCI is the schema of a .gitlab-ci.yml; keys it does not list are jobs
+var gitlabCI = gitlabSchema()
+
+func gitlabSchema() *shape {
+	script := either(str, seqOf(either(str, seqOf(str))))
+	variables := mapOf(either(
+		scalarOf("string", "number", "boolean"),
+		mapping(map[string]*shape{"value": scalarOf("string", "number", "boolean"), "description": str, "options": seqOf(str), "expand": boolean}),
+	))
+	image := either(str, mapping(map[string]*shape{
+		"name": str, "entrypoint": stringList, "pull_policy": stringList, "docker": anyMapping, "kubernetes": anyMapping,
+	}))
+	services := seqOf(either(str, mapping(map[string]*shape{
+		"name": str, "alias": str, "entrypoint": stringList, "command": stringList, "variables": variables,
+		"pull_policy": stringList, "docker": anyMapping, "kubernetes": anyMapping,
+	})))
+	when := enumOf("on_success", "on_failure", "always", "manual", "delayed", "never")
+	cacheEntry := mapping(map[string]*shape{
+		"key":           either(scalarOf("string", "number"), mapping(map[string]*shape{"files": seqOf(str), "prefix": str})),
+		"paths":         seqOf(str),
+		"policy":        str,
+		"unprotect":     boolean,
+		"untracked":     boolean,
+		"when":          enumOf("on_success", "on_failure", "always"),
+		"fallback_keys": seqOf(str),
+	})
+	cache := either(cacheEntry, seqOf(cacheEntry))
+	artifacts := mapping(map[string]*shape{
+		"paths": seqOf(str), "exclude": seqOf(str), "expire_in": str, "expose_as": str, "name": str,
+		"public": boolean, "access": enumOf("all", "developer", "none"), "reports": anyMapping,
+		"untracked": boolean, "when": enumOf("on_success", "on_failure", "always"),
+	})
+	rules := seqOf(mapping(map[string]*shape{
+		"if": str, "changes": either(seqOf(str), anyMapping), "exists": either(seqOf(str), anyMapping),
+		"when": when, "allow_failure": boolean, "variables": variables, "needs": seqOf(anything), "start_in": str,
+		"interruptible": boolean,
+	}))
+	retry := either(number, mapping(map[string]*shape{"max": number, "when": stringList, "exit_codes": either(number, seqOf(number))}))
+	allowFailure := either(boolean, mapping(map[string]*shape{"exit_codes": either(number, seqOf(number))}))
+	refs := either(str, seqOf(str), mapping(map[string]*shape{"refs": seqOf(str), "variables": seqOf(str), "changes": seqOf(str), "kubernetes": str}))
+
+	job := mapping(map[string]*shape{
+		"script":              script,
+		"before_script":       script,
+		"after_script":        script,
+		"image":               image,
+		"services":            services,
+		"stage":               str,
+		"variables":           variables,
+		"only":                refs,
+		"except":              refs,
+		"rules":               rules,
+		"needs":               seqOf(either(str, anyMapping)),
+		"dependencies":        seqOf(str),
+		"artifacts":           artifacts,
+		"cache":               cache,
+		"when":                when,
+		"start_in":            str,
+		"allow_failure":       allowFailure,
+		"retry":               retry,
+		"timeout":             str,
+		"parallel":            either(number, mapping(map[string]*shape{"matrix": seqOf(anyMapping)})),
+		"tags":                seqOf(str),
+		"environment":         either(str, anyMapping),
+		"coverage":            str,
+		"interruptible":       boolean,
+		"resource_group":      str,
+		"release":             anyMapping,
+		"trigger":             either(str, anyMapping),
+		"extends":             stringList,
+		"secrets":             anyMapping,
+		"id_tokens":           anyMapping,
+		"inherit":             mapping(map[string]*shape{"default": either(boolean, seqOf(str)), "variables": either(boolean, seqOf(str))}),
+		"pages":               either(boolean, anyMapping),
+		"publish":             str,
+		"manual_confirmation": str,
+		"identity":            str,
+		"hooks":               anyMapping,
+		"dast_configuration":  anyMapping,
+		"run":                 seqOf(anyMapping),
+	})
+	job.oneOf = []string{"script", "trigger", "run", "extends"}
+
+	return &shape{
+		types: []string{"mapping"},
+		keys: map[string]*shape{
+			"default": mapping(map[string]*shape{
+				"after_script": script, "artifacts": artifacts, "before_script": script, "cache": cache,
+				"hooks": anyMapping, "id_tokens": anyMapping, "image": image, "interruptible": boolean,
+				"retry": retry, "services": services, "tags": seqOf(str), "timeout": str,
+			}),
+			"include":   either(str, seqOf(either(str, anyMapping)), anyMapping),
+			"stages":    seqOf(str),
+			"variables": variables,
+			"workflow": mapping(map[string]*shape{
+				"name": str, "rules": rules, "auto_cancel": anyMapping,
+			}),
+			// Deprecated global defaults, still accepted
+			"image":         image,
+			"services":      services,
+			"cache":         cache,
+			"before_script": script,
+			"after_script":  script,
+		},
+		values: job,
+	}
+}
+
+// checkSchema validates a GitHub Actions workflow or GitLab CI file against
+// the platform's schema: unknown keys, wrong types, invalid values and
+// invalid on: triggers, each at its line
+func checkSchema(content []byte, file string) []Issue {
+	var issues []Issue
+
+	root, err := schemaDocument(content)
+	if err != nil || root == nil {
+		return issues
+	}
+	v := &schemaValidator{file: file}
+	switch detectPlatform(file) {
+	case "github":
+		v.platform = "github-workflow"
+		v.validate(root, githubWorkflow, "")
+		if _, on := mappingEntry(root, "on"); on != nil {
+			v.checkTriggers(on)
+		}
+	case "gitlab":
+		v.platform = "gitlab-ci"
+		v.validate(root, gitlabCI, "")
+	}
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		a, b := v.issues[i], v.issues[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return v.issues
+}
+
+// schemaDocument returns the root node of the pipeline document of a file.
+// GitLab files may start with a spec: header in its own document.
+func schemaDocument(content []byte) (*yaml.Node, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		if root.Kind == yaml.MappingNode && len(root.Content) == 2 && root.Content[0].Value == "spec" {
+			continue
+		}
+		return root, nil
+	}
+}
+
+type schemaValidator struct {
+	file     string
+	platform string
+	issues   []Issue
+}
+
+func (v *schemaValidator) report(at *yaml.Node, suggestion, format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{
+		Severity:   Error,
+		Message:    i18n.T(format, args...),
+		File:       v.file,
+		Line:       at.Line,
+		Column:     at.Column,
+		Suggestion: suggestion,
+	})
+}
+
+// validate checks node against s; path names the node in messages
+func (v *schemaValidator) validate(node *yaml.Node, s *shape, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	// An expression can stand for any value
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && strings.Contains(node.Value, "${{") {
+		return
+	}
+	if len(s.alts) > 0 {
+		s = pickAlternative(node, s.alts)
+	}
+
+	kind := nodeType(node)
+	if len(s.types) > 0 && !acceptsType(s.types, kind) {
+		v.report(node, i18n.T("Check the %s schema for the expected value", v.platform),
+			"%s has type %s, but the schema expects %s", describePath(path), kind, strings.Join(allTypes(s), " or "))
+		return
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if len(s.enum) > 0 && kind == "string" && !contains(s.enum, node.Value) {
+			suggestion := i18n.T("Use one of: %s", strings.Join(s.enum, ", "))
+			if closest := closestName(node.Value, toSet(s.enum)); closest != "" {
+				suggestion = i18n.T("Did you mean '%s'?", closest)
+			}
+			v.report(node, suggestion, "'%s' is not a valid value for %s", node.Value, describePath(path))
+		}
+	case yaml.SequenceNode:
+		if s.items != nil {
+			for i, item := range node.Content {
+				v.validate(item, s.items, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case yaml.MappingNode:
+		v.validateMapping(node, s, path)
+	}
+}
+
+func (v *schemaValidator) validateMapping(node *yaml.Node, s *shape, path string) {
+	present := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		present[key.Value] = true
+		if key.Value == "<<" {
+			continue
+		}
+		child := keyPath(path, key.Value)
+		if known, ok := s.keys[key.Value]; ok {
+			v.validate(value, known, child)
+			continue
+		}
+		if s.values != nil {
+			// GitLab hidden keys hold templates and anchors, not jobs
+			if s == gitlabCI && strings.HasPrefix(key.Value, ".") {
+				continue
+			}
+			v.validate(value, s.values, child)
+			continue
+		}
+		if s.keys == nil {
+			continue
+		}
+		suggestion := i18n.T("Remove it or check the spelling against the %s schema", v.platform)
+		if closest := closestName(key.Value, keySet(s.keys)); closest != "" {
+			suggestion = i18n.T("Did you mean '%s'?", closest)
+		}
+		v.report(key, suggestion, "Unknown key '%s' in %s", key.Value, describePath(path))
+	}
+
+	if hasMergeKey(node) {
+		return
+	}
+	for _, key := range s.required {
+		if !present[key] {
+			v.report(node, "", "%s is missing the required key '%s'", describePath(path), key)
+		}
+	}
+	if len(s.oneOf) > 0 {
+		for _, key := range s.oneOf {
+			if present[key] {
+				return
+			}
+		}
+		v.report(node, "", "%s needs one of: %s", describePath(path), strings.Join(s.oneOf, ", "))
+	}
+}
+
+// checkTriggers validates the events of on: and their filters
+func (v *schemaValidator) checkTriggers(on *yaml.Node) {
+	if on.Kind == yaml.AliasNode {
+		on = on.Alias
+	}
+	event := func(name *yaml.Node) bool {
+		if _, ok := githubEvents[name.Value]; ok {
+			return true
+		}
+		suggestion := i18n.T("See https://docs.github.com/actions/using-workflows/events-that-trigger-workflows")
+		events := make(map[string]bool, len(githubEvents))
+		for e := range githubEvents {
+			events[e] = true
+		}
+		if closest := closestName(name.Value, events); closest != "" {
+			suggestion = i18n.T("Did you mean '%s'?", closest)
+		}
+		v.report(name, suggestion, "Unknown trigger '%s'", name.Value)
+		return false
+	}
+
+	switch on.Kind {
+	case yaml.ScalarNode:
+		event(on)
+	case yaml.SequenceNode:
+		for _, item := range on.Content {
+			if item.Kind != yaml.ScalarNode {
+				v.report(item, "", "%s has type %s, but the schema expects %s", describePath("on"), nodeType(item), "string")
+				continue
+			}
+			event(item)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(on.Content); i += 2 {
+			key, value := on.Content[i], on.Content[i+1]
+			if event(key) {
+				v.validate(value, githubTrigger(key.Value), keyPath("on", key.Value))
+			}
+		}
+	default:
+		v.report(on, "", "%s has type %s, but the schema expects %s", describePath("on"), nodeType(on), "string or sequence or mapping")
+	}
+}
+
+// pickAlternative returns the alternative that accepts the node's type;
+// between mappings, the one that knows most of the node's keys
+func pickAlternative(node *yaml.Node, alts []*shape) *shape {
+	kind := nodeType(node)
+	var best *shape
+	bestKnown := -1
+	for _, alt := range alts {
+		if !acceptsType(alt.types, kind) {
+			continue
+		}
+		known := 0
+		for i := 0; kind == "mapping" && i < len(node.Content); i += 2 {
+			if _, ok := alt.keys[node.Content[i].Value]; ok || alt.values != nil {
+				known++
+			}
+		}
+		if known > bestKnown {
+			best, bestKnown = alt, known
+		}
+	}
+	if best == nil {
+		return &shape{types: allTypes(&shape{alts: alts})}
+	}
+	return best
+}
+
+func allTypes(s *shape) []string {
+	if len(s.alts) == 0 {
+		return s.types
+	}
+	var types []string
+	for _, alt := range s.alts {
+		for _, t := range allTypes(alt) {
+			if !contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// nodeType names the schema type of a node
+func nodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "mapping"
+	case yaml.SequenceNode:
+		return "sequence"
+	}
+	switch node.Tag {
+	case "!!int", "!!float":
+		return "number"
+	case "!!bool":
+		return "boolean"
+	case "!!null":
+		return "null"
+	}
+	return "string"
+}
+
+// acceptsType reports whether a value of kind fits types. Runners read
+// numbers and booleans where strings are expected, so those pass as strings.
+func acceptsType(types []string, kind string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == kind || t == "string" && (kind == "number" || kind == "boolean") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMergeKey(node *yaml.Node) bool {
+	_, merge := mappingEntry(node, "<<")
+	return merge != nil
+}
+
+func keyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return i18n.T("the document")
+	}
+	return "'" + path + "'"
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func keySet(keys map[string]*shape) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for k := range keys {
+		set[k] = true
+	}
+	return set
+}
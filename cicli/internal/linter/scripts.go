@@ -0,0 +1,222 @@
+package linter
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"cicli/internal/i18n"
+)
+
+// MaxInlineScriptLines is the size above which run: blocks should move to script files
+var MaxInlineScriptLines = 20
+
+// inlineScript is a run: step in a workflow
+type inlineScript struct {
+	Line     int      // 1-based line of the run: key
+	Indent   int      // indentation of the run: key
+	BodyFrom int      // 0-based index of the first body line
+	BodyTo   int      // 0-based index of the last body line
+	Body     []string // script lines with the block indentation removed
+	Inline   bool     // single-line run: <command>
+	Folded   bool     // run: > (lines are joined with spaces)
+	Job      string
+	Step     string
+	Shell    string
+	WorkDir  string // working-directory of the step
+}
+
+var (
+	runBlockPattern  = regexp.MustCompile(`^(\s*)(- )?run:\s*([|>])[-+]?\s*$`)
+	runInlinePattern = regexp.MustCompile(`^(\s*)(- )?run:\s*(\S.*)$`)
+)
+
+// findInlineScripts returns every run: step in a workflow, both block
+// scalars and single-line commands
+func findInlineScripts(content []byte) []inlineScript {
+	lines := strings.Split(string(content), "\n")
+	var scripts []inlineScript
+
+	for i, line := range lines {
+		m := runBlockPattern.FindStringSubmatch(line)
+		if m == nil {
+			if m = runInlinePattern.FindStringSubmatch(line); m != nil {
+				indent := len(m[1])
+				if m[2] != "" {
+					indent += 2
+				}
+				cmd := strings.TrimSpace(m[3])
+				if strings.HasPrefix(cmd, `"`) || strings.HasPrefix(cmd, "'") {
+					cmd = strings.Trim(cmd, `"'`)
+				}
+				s := inlineScript{Line: i + 1, Indent: indent, BodyFrom: i, BodyTo: i, Body: []string{cmd}, Inline: true}
+				s.Job, s.Step, s.Shell, s.WorkDir = stepContext(lines, i, indent)
+				scripts = append(scripts, s)
+			}
+			continue
+		}
+		indent := len(m[1])
+		if m[2] != "" {
+			indent += 2
+		}
+
+		s := inlineScript{Line: i + 1, Indent: indent, BodyFrom: i + 1, BodyTo: i, Folded: m[3] == ">"}
+		bodyIndent := -1
+		for j := i + 1; j < len(lines); j++ {
+			trimmed := strings.TrimSpace(lines[j])
+			lineIndent := len(lines[j]) - len(strings.TrimLeft(lines[j], " "))
+			if trimmed != "" && lineIndent <= indent {
+				break
+			}
+			if trimmed != "" {
+				if bodyIndent < 0 {
+					bodyIndent = lineIndent
+				}
+				s.BodyTo = j
+			}
+		}
+		for j := s.BodyFrom; j <= s.BodyTo; j++ {
+			if len(lines[j]) >= bodyIndent && bodyIndent >= 0 {
+				s.Body = append(s.Body, lines[j][bodyIndent:])
+			} else {
+				s.Body = append(s.Body, strings.TrimSpace(lines[j]))
+			}
+		}
+
+		s.Job, s.Step, s.Shell, s.WorkDir = stepContext(lines, i, indent)
+		scripts = append(scripts, s)
+	}
+
+	return scripts
+}
+
+// stepContext finds the job key, step name, shell and working directory
+// surrounding a run: line
+func stepContext(lines []string, runLine, runIndent int) (job, step, shell, workDir string) {
+	// Step item starts at the nearest "- " at the step's indentation
+	itemStart := runLine
+	if !strings.HasPrefix(strings.TrimSpace(lines[runLine]), "- ") {
+		for k := runLine - 1; k >= 0; k-- {
+			lineIndent := len(lines[k]) - len(strings.TrimLeft(lines[k], " "))
+			if lineIndent == runIndent-2 && strings.HasPrefix(strings.TrimSpace(lines[k]), "- ") {
+				itemStart = k
+				break
+			}
+			if strings.TrimSpace(lines[k]) != "" && lineIndent < runIndent-2 {
+				break
+			}
+		}
+	}
+	for k := itemStart; k < len(lines); k++ {
+		trimmed := strings.TrimPrefix(strings.TrimSpace(lines[k]), "- ")
+		lineIndent := len(lines[k]) - len(strings.TrimLeft(lines[k], " "))
+		if k > itemStart && strings.TrimSpace(lines[k]) != "" && lineIndent < runIndent {
+			break
+		}
+		if k != itemStart && lineIndent != runIndent {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "name:") {
+			step = strings.Trim(strings.TrimSpace(strings.TrimPrefix(trimmed, "name:")), `"'`)
+		} else if strings.HasPrefix(trimmed, "shell:") {
+			shell = strings.Trim(strings.TrimSpace(strings.TrimPrefix(trimmed, "shell:")), `"'`)
+		} else if strings.HasPrefix(trimmed, "working-directory:") {
+			workDir = strings.Trim(strings.TrimSpace(strings.TrimPrefix(trimmed, "working-directory:")), `"'`)
+		}
+	}
+
+	// Jobs are the two-space keys under jobs:
+	for k := runLine; k >= 0; k-- {
+		if regexp.MustCompile(`^  [A-Za-z0-9_-]+:\s*$`).MatchString(lines[k]) {
+			job = strings.TrimSuffix(strings.TrimSpace(lines[k]), ":")
+			break
+		}
+	}
+	return job, step, shell, workDir
+}
+
+func checkLargeInlineScripts(content []byte, file string) []Issue {
+	var issues []Issue
+
+	for _, s := range findInlineScripts(content) {
+		if s.Inline || len(s.Body) <= MaxInlineScriptLines {
+			continue
+		}
+		issues = append(issues, Issue{
+			Severity:    Info,
+			Message:     i18n.T("Inline script has %d lines (limit %d)", len(s.Body), MaxInlineScriptLines),
+			File:        file,
+			Line:        s.Line,
+			Suggestion:  i18n.T("Move it to a script file under scripts/ so it can be shellchecked and run locally"),
+			AutoFixable: !strings.Contains(strings.Join(s.Body, "\n"), "${{"),
+		})
+	}
+
+	return issues
+}
+
+// ExtractedScript is a script file created by FixInlineScripts
+type ExtractedScript struct {
+	Path    string
+	Content string
+}
+
+// FixInlineScripts moves run: blocks longer than MaxInlineScriptLines into
+// scripts/ci/*.sh and rewrites the steps to call them. Blocks that use ${{ }}
+// expressions are left alone because they would not expand inside a file.
+func FixInlineScripts(file string, content []byte) ([]byte, []ExtractedScript, error) {
+	lines := strings.Split(string(content), "\n")
+	workflow := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+
+	var extracted []ExtractedScript
+	used := make(map[string]bool)
+	scripts := findInlineScripts(content)
+
+	// Rewrite from the bottom so earlier line indices stay valid
+	for i := len(scripts) - 1; i >= 0; i-- {
+		s := scripts[i]
+		body := strings.Join(s.Body, "\n")
+		if s.Inline || len(s.Body) <= MaxInlineScriptLines || strings.Contains(body, "${{") {
+			continue
+		}
+
+		name := s.Step
+		if name == "" {
+			name = fmt.Sprintf("step-%d", s.Line)
+		}
+		base := slug(workflow + "-" + s.Job + "-" + name)
+		path := filepath.ToSlash(filepath.Join("scripts", "ci", base+".sh"))
+		for n := 2; used[path]; n++ {
+			path = filepath.ToSlash(filepath.Join("scripts", "ci", fmt.Sprintf("%s-%d.sh", base, n)))
+		}
+		used[path] = true
+
+		var sb strings.Builder
+		sb.WriteString("#!/usr/bin/env bash\n")
+		if !strings.Contains(body, "set -e") {
+			sb.WriteString("set -euo pipefail\n")
+		}
+		sb.WriteString("\n")
+		sb.WriteString(body)
+		sb.WriteString("\n")
+		extracted = append(extracted, ExtractedScript{Path: path, Content: sb.String()})
+
+		runLine := lines[s.Line-1]
+		prefix := runLine[:strings.Index(runLine, "run:")]
+		call := fmt.Sprintf(`%srun: bash "$GITHUB_WORKSPACE/%s"`, prefix, path)
+
+		rewritten := append([]string{}, lines[:s.Line-1]...)
+		rewritten = append(rewritten, call)
+		rewritten = append(rewritten, lines[s.BodyTo+1:]...)
+		lines = rewritten
+	}
+
+	return []byte(strings.Join(lines, "\n")), extracted, nil
+}
+
+func slug(s string) string {
+	s = strings.ToLower(s)
+	s = regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(s, "-")
+	return strings.Trim(s, "-")
+}
@@ -0,0 +1,123 @@
+package linter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"cicli/internal/i18n"
+)
+
+// shellFinding is a problem found in a shell snippet, with a 1-based line
+// relative to the snippet
+type shellFinding struct {
+	Line    int    `json:"line"`
+	Level   string `json:"level"` // error, warning, info, style
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// expressionPattern matches GitHub expressions, which shellcheck cannot parse
+var expressionPattern = regexp.MustCompile(`\$\{\{.*?\}\}`)
+
+func checkShellScripts(content []byte, file string) []Issue {
+	var issues []Issue
+
+	_, err := exec.LookPath("shellcheck")
+	external := err == nil
+
+	for _, s := range findInlineScripts(content) {
+		if s.Folded || (s.Shell != "" && s.Shell != "bash" && s.Shell != "sh") {
+			continue
+		}
+
+		// Replace ${{ }} with a plain word so the snippet stays valid shell
+		script := expressionPattern.ReplaceAllString(strings.Join(s.Body, "\n"), "GITHUB_EXPR")
+
+		var findings []shellFinding
+		if external {
+			findings = runShellcheck(script)
+		} else {
+			findings = builtinShellcheck(script)
+		}
+
+		for _, f := range findings {
+			line := s.BodyFrom + f.Line
+			if s.Inline {
+				line = s.Line
+			}
+			issues = append(issues, Issue{
+				Severity:   shellSeverity(f.Level),
+				Message:    fmt.Sprintf("SC%d: %s", f.Code, f.Message),
+				File:       file,
+				Line:       line,
+				Suggestion: i18n.T("See https://www.shellcheck.net/wiki/SC%d", f.Code),
+			})
+		}
+	}
+
+	return issues
+}
+
+func shellSeverity(level string) Severity {
+	switch level {
+	case "error":
+		return Error
+	case "warning":
+		return Warning
+	default:
+		return Info
+	}
+}
+
+// runShellcheck lints a snippet with the shellcheck binary
+func runShellcheck(script string) []shellFinding {
+	cmd := exec.Command("shellcheck", "--shell=bash", "--format=json", "-")
+	cmd.Stdin = strings.NewReader(script)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	// shellcheck exits 1 when it reports findings
+	_ = cmd.Run()
+
+	var findings []shellFinding
+	if err := json.Unmarshal(out.Bytes(), &findings); err != nil {
+		return nil
+	}
+	return findings
+}
+
+// builtinShellcheck covers a handful of common ShellCheck rules for machines
+// without the shellcheck binary
+func builtinShellcheck(script string) []shellFinding {
+	checks := []struct {
+		pattern *regexp.Regexp
+		level   string
+		code    int
+		message string
+	}{
+		{regexp.MustCompile("`[^`]+`"), "style", 2006, "Use $(...) notation instead of legacy backticks `...`."},
+		{regexp.MustCompile(`(^|[;&|]\s*)cd\s+[^;&|]+$`), "warning", 2164, "Use 'cd ... || exit' or 'cd ... || return' in case cd fails."},
+		{regexp.MustCompile(`(^|[;&|]\s*)cat\s+[^\s|;&<>$-][^\s|;&]*\s*\|`), "style", 2002, "Useless cat. Consider 'cmd < file | ..' or 'cmd file | ..' instead."},
+		{regexp.MustCompile(`^\s*(export|local|declare|readonly)\s+\w+=\$\(`), "warning", 2155, "Declare and assign separately to avoid masking return values."},
+		{regexp.MustCompile(`\[\[?\s+\$\?\s+(-eq|-ne|==|!=)`), "style", 2181, "Check exit code directly with e.g. 'if mycmd;', not indirectly with $?."},
+		{regexp.MustCompile(`(^|\s)(rm\s+-[a-zA-Z]*r[a-zA-Z]*\s+)"?\$\{?\w+\}?"?/`), "warning", 2115, "Use \"${var:?}\" to ensure this never expands to /* ."},
+		{regexp.MustCompile(`\bread\s+(-[a-qs-z]+\s+)*\w+\s*$`), "info", 2162, "read without -r will mangle backslashes."},
+	}
+
+	var findings []shellFinding
+	for i, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		for _, c := range checks {
+			if c.pattern.MatchString(line) {
+				findings = append(findings, shellFinding{Line: i + 1, Level: c.level, Code: c.code, Message: c.message})
+			}
+		}
+	}
+	return findings
+}
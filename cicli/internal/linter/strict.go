@@ -0,0 +1,129 @@
+package linter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cicli/internal/i18n"
+)
+
+// SecurityStrict is the rule profile for repositories that want every
+// runner and fork check: the fork-safety rules, whether or not the
+// repository is public, and the RUN rules
+const SecurityStrict = "security-strict"
+
+// Profiles are the rule profiles Profile can select
+var Profiles = []string{"default", SecurityStrict}
+
+// Profile is the rule profile, set with --rule-profile= or lint.profile.
+// Rules with a Profile only run when it is selected.
+var Profile = "default"
+
+// SetProfile selects a rule profile by name
+func SetProfile(name string) error {
+	if !contains(Profiles, name) {
+		return fmt.Errorf("unknown rule profile %q (available: %s)", name, strings.Join(Profiles, ", "))
+	}
+	Profile = name
+	return nil
+}
+
+var (
+	// outsiderEvents are triggers any GitHub user can set off in the base
+	// repository without a pull request: comments, reviews and reactions
+	outsiderEvents = []string{"issue_comment", "issues", "discussion", "discussion_comment", "pull_request_review", "pull_request_review_comment", "fork", "watch"}
+	// authorGuardPattern matches if: conditions that only let trusted users through
+	authorGuardPattern = regexp.MustCompile(`author_association|github\.actor\s*==|github\.triggering_actor\s*==`)
+	// repositoryGuardPattern matches if: conditions that skip runs in forks
+	repositoryGuardPattern = regexp.MustCompile(`github\.repository(_owner)?\s*==|==\s*github\.repository(_owner)?\b|head\.repo\.(full_name|fork)`)
+)
+
+// repositoryGuard is the condition suggested to keep a job out of forks
+const repositoryGuard = "if: github.repository == 'owner/repo'"
+
+// checkOutsiderSelfHosted flags self-hosted jobs that comments, reviews and
+// other events from any user can start. FORK003 covers pull requests.
+func checkOutsiderSelfHosted(content []byte, file string) []Issue {
+	var issues []Issue
+	w, ok := parseForkWorkflow(content)
+	if !ok {
+		return issues
+	}
+	event := ""
+	for _, e := range outsiderEvents {
+		if w.Triggers[e] {
+			event = e
+			break
+		}
+	}
+	if event == "" {
+		return issues
+	}
+
+	for _, job := range w.Jobs {
+		_, runsOn := mappingEntry(job.Body, "runs-on")
+		if !selfHosted(runsOn) || authorGuardPattern.MatchString(scalarValue(job.Body, "if")) {
+			continue
+		}
+		issues = append(issues, Issue{
+			Severity:   Error,
+			Message:    i18n.T("Job '%s' runs on a self-hosted runner for %s events, which any GitHub user can trigger", job.Name, event),
+			File:       file,
+			Line:       runsOn.Line,
+			Column:     runsOn.Column,
+			Suggestion: i18n.T("Use a GitHub-hosted runner, or only run for trusted users: if: contains(fromJSON('[\"OWNER\",\"MEMBER\",\"COLLABORATOR\"]'), github.event.comment.author_association)"),
+		})
+	}
+	return issues
+}
+
+// checkRepositoryGuard flags jobs that need the repository's secrets,
+// environments or self-hosted runners but have no github.repository guard.
+// Forks that enable Actions run them on every push and schedule, where they
+// fail without the secrets or wait for a runner that never comes.
+func checkRepositoryGuard(content []byte, file string) []Issue {
+	var issues []Issue
+	w, ok := parseForkWorkflow(content)
+	if !ok || !runsInForks(w) {
+		return issues
+	}
+
+	for _, job := range w.Jobs {
+		if job.Body == nil || repositoryGuardPattern.MatchString(scalarValue(job.Body, "if")) {
+			continue
+		}
+		_, runsOn := mappingEntry(job.Body, "runs-on")
+		_, environment := mappingEntry(job.Body, "environment")
+		secret, _ := secretReference(job.Body)
+		if !selfHosted(runsOn) && environment == nil && secret == nil {
+			continue
+		}
+		issues = append(issues, Issue{
+			Severity:   Warning,
+			Message:    i18n.T("Job '%s' needs this repository's secrets, environments or runners but has no github.repository guard, so forks run it too", job.Name),
+			File:       file,
+			Line:       job.Key.Line,
+			Column:     job.Key.Column,
+			Suggestion: i18n.T("Add a guard with your repository's name to the job: %s", repositoryGuard),
+		})
+	}
+	return issues
+}
+
+// runsInForks reports whether a workflow has a trigger that also fires in a
+// fork's own copy: anything but pull request events, which run in the base
+// repository, and workflow_call, whose caller decides
+func runsInForks(w forkWorkflow) bool {
+	for trigger := range w.Triggers {
+		if trigger != "pull_request" && trigger != "pull_request_target" && trigger != "workflow_call" {
+			return true
+		}
+	}
+	return false
+}
+
+// forkRulesEnabled reports whether the fork-safety rules run
+func forkRulesEnabled() bool {
+	return PublicRepository || Profile == SecurityStrict
+}
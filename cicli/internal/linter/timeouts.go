@@ -0,0 +1,231 @@
+package linter
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JobTimeouts are the timeout-minutes inserted by FixTimeouts for each kind of job
+var JobTimeouts = map[string]int{
+	"lint":   10,
+	"test":   30,
+	"build":  30,
+	"deploy": 15,
+	"e2e":    60,
+}
+
+// defaultJobKind is used for jobs that match none of the heuristics
+const defaultJobKind = "build"
+
+var (
+	e2ePattern   = regexp.MustCompile(`(?i)\b(e2e|end-to-end|integration|cypress|playwright|selenium|smoke)\b`)
+	lintPattern  = regexp.MustCompile(`(?i)\b(lint|eslint|golangci-lint|flake8|ruff|pylint|prettier|gofmt|go vet|black --check|checkstyle|rubocop|format)\b`)
+	testPattern  = regexp.MustCompile(`(?i)\b(test|tests|pytest|jest|vitest|mocha|rspec|go test|npm test|mvn test|gradle test|coverage)\b`)
+	buildPattern = regexp.MustCompile(`(?i)\b(build|compile|package|docker build|bundle|release)\b`)
+)
+
+// jobKind classifies a job as lint, test, build, deploy or e2e from its key,
+// name and step commands. Names are checked before commands so a "lint" job
+// that also builds is still treated as lint.
+func jobKind(key string, job map[string]interface{}) string {
+	if isDeployJob(key, job) {
+		return "deploy"
+	}
+
+	name, _ := job["name"].(string)
+	label := key + " " + name
+	for _, kind := range []struct {
+		name    string
+		pattern *regexp.Regexp
+	}{
+		{"e2e", e2ePattern},
+		{"lint", lintPattern},
+		{"test", testPattern},
+		{"build", buildPattern},
+	} {
+		if kind.pattern.MatchString(label) {
+			return kind.name
+		}
+	}
+
+	var commands []string
+	steps, _ := job["steps"].([]interface{})
+	for _, s := range steps {
+		step, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"name", "run", "uses"} {
+			if v, ok := step[field].(string); ok {
+				commands = append(commands, v)
+			}
+		}
+	}
+	all := strings.Join(commands, "\n")
+	switch {
+	case e2ePattern.MatchString(all):
+		return "e2e"
+	case testPattern.MatchString(all):
+		return "test"
+	case buildPattern.MatchString(all):
+		return "build"
+	case lintPattern.MatchString(all):
+		return "lint"
+	}
+	return defaultJobKind
+}
+
+// projectScale returns a multiplier for job timeouts based on how many files
+// the project has: 1 for small projects, 1.5 above 1,000 files and 2 above
+// 10,000. Deploy timeouts are not scaled since they depend on the target,
+// not the repository.
+func projectScale(root string) float64 {
+	files := 0
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			switch info.Name() {
+			case ".git", "node_modules", "vendor", "dist", "build", "target", ".venv":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files++
+		if files > 10000 {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+
+	switch {
+	case files > 10000:
+		return 2
+	case files > 1000:
+		return 1.5
+	}
+	return 1
+}
+
+// workflowRoot returns the repository root for a workflow under
+// .github/workflows, a CircleCI config, or a CI file at the root
+func workflowRoot(file string) string {
+	dir := filepath.Dir(file)
+	if filepath.Base(dir) == "workflows" && filepath.Base(filepath.Dir(dir)) == ".github" {
+		return filepath.Dir(filepath.Dir(dir))
+	}
+	if filepath.Base(dir) == ".circleci" {
+		return filepath.Dir(dir)
+	}
+	return dir
+}
+
+// SuggestedTimeout returns the timeout-minutes for a job of the given kind,
+// rounded up to a multiple of 5 after scaling
+func SuggestedTimeout(kind string, scale float64) int {
+	minutes, ok := JobTimeouts[kind]
+	if !ok {
+		minutes = JobTimeouts[defaultJobKind]
+	}
+	if kind == "deploy" {
+		return minutes
+	}
+	return int(math.Ceil(float64(minutes)*scale/5)) * 5
+}
+
+// FixTimeouts inserts timeout-minutes into every job that lacks one, using
+// the job kind and the size of the project the workflow belongs to. Jobs that
+// call reusable workflows are skipped since they cannot set a timeout. The
+// line goes before steps: (or right after the job key) so comments and
+// formatting elsewhere are preserved.
+func FixTimeouts(file string, content []byte) ([]byte, bool) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil || len(doc.Content) == 0 {
+		return content, false
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return content, false
+	}
+
+	var jobs *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "jobs" && root.Content[i+1].Kind == yaml.MappingNode {
+			jobs = root.Content[i+1]
+		}
+	}
+	if jobs == nil {
+		return content, false
+	}
+
+	lines := strings.Split(string(content), "\n")
+
+	type insertion struct {
+		line int // 0-based index the new line goes before
+		text string
+	}
+	var inserts []insertion
+	scale := 0.0
+
+	for i := 0; i+1 < len(jobs.Content); i += 2 {
+		key, body := jobs.Content[i], jobs.Content[i+1]
+		if body.Kind != yaml.MappingNode || len(body.Content) == 0 {
+			continue
+		}
+
+		var job map[string]interface{}
+		if err := body.Decode(&job); err != nil {
+			continue
+		}
+		if _, ok := job["timeout-minutes"]; ok {
+			continue
+		}
+		if _, ok := job["uses"]; ok {
+			continue
+		}
+		// Flow-style jobs ({runs-on: ...}) cannot take an extra line
+		if body.Style&yaml.FlowStyle != 0 {
+			continue
+		}
+
+		if scale == 0 {
+			scale = projectScale(workflowRoot(file))
+		}
+		minutes := SuggestedTimeout(jobKind(key.Value, job), scale)
+
+		at := key.Line
+		column := body.Content[0].Column
+		for k := 0; k+1 < len(body.Content); k += 2 {
+			if body.Content[k].Value == "steps" {
+				at = body.Content[k].Line - 1
+			}
+		}
+		// Keep comments that introduce steps: attached to it
+		for at > key.Line && strings.HasPrefix(strings.TrimSpace(lines[at-1]), "#") {
+			at--
+		}
+		inserts = append(inserts, insertion{
+			line: at,
+			text: fmt.Sprintf("%stimeout-minutes: %d", strings.Repeat(" ", column-1), minutes),
+		})
+	}
+	if len(inserts) == 0 {
+		return content, false
+	}
+
+	// Jobs are in document order, so insert from the bottom to keep indices valid
+	for i := len(inserts) - 1; i >= 0; i-- {
+		in := inserts[i]
+		updated := append([]string{}, lines[:in.line]...)
+		updated = append(updated, in.text)
+		lines = append(updated, lines[in.line:]...)
+	}
+	return []byte(strings.Join(lines, "\n")), true
+}
@@ -0,0 +1,145 @@
+package marker
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// The marker block sits at the top of a generated file, after any Dockerfile
+// parser directives, so later commands can tell cicli-managed files from
+// user-authored ones:
+//
+//	# cicli:begin
+//	# generator: cicli 2.0.0
+//	# template: github-actions/node
+//	# analysis: 3f2a9c1b7d4e
+//	# checksum: 8b1e0f6a2c9d
+//	# cicli:end
+//
+// Files whose language has no # comments, such as Jenkinsfiles, use //.
+const (
+	begin = "cicli:begin"
+	end   = "cicli:end"
+)
+
+// comments are the line comment prefixes a marker block may use
+var comments = []string{"#", "//"}
+
+// Marker is the metadata cicli records in a generated file
+type Marker struct {
+	Generator string `json:"generator"` // cicli and its version
+	Template  string `json:"template"`  // what produced the file, e.g. github-actions/node
+	Analysis  string `json:"analysis"`  // hash of the project analysis or source file it was generated from
+	Checksum  string `json:"checksum"`  // hash of the content below the block when it was written
+}
+
+// Hash returns a short stable hash of v's JSON encoding, or of v itself
+// when it is a string or bytes
+func Hash(v interface{}) string {
+	var data []byte
+	switch v := v.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		data, _ = json.Marshal(v)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Stamp returns content with the marker block at its top, written as
+// comment lines. The checksum is computed from content, and an existing
+// block is replaced.
+func Stamp(content string, m Marker, comment string) string {
+	_, content = split(content)
+	m.Checksum = Hash(content)
+	directives, body := splitDirectives(content)
+	var block strings.Builder
+	for _, line := range []string{
+		begin,
+		"generator: " + m.Generator,
+		"template: " + m.Template,
+		"analysis: " + m.Analysis,
+		"checksum: " + m.Checksum,
+		end,
+	} {
+		block.WriteString(comment + " " + line + "\n")
+	}
+	return directives + block.String() + body
+}
+
+// Find returns the marker block of content, or nil for files cicli did not
+// generate
+func Find(content string) *Marker {
+	m, _ := split(content)
+	return m
+}
+
+// Strip returns content without its marker block
+func Strip(content string) string {
+	_, content = split(content)
+	return content
+}
+
+// Modified reports whether the content below the marker block changed
+// since cicli wrote it
+func (m *Marker) Modified(content string) bool {
+	_, body := split(content)
+	return Hash(body) != m.Checksum
+}
+
+// split separates the marker block from the rest of content, which is
+// returned as it was before Stamp
+func split(content string) (*Marker, string) {
+	for _, comment := range comments {
+		opening, closing := comment+" "+begin+"\n", "\n"+comment+" "+end+"\n"
+		start := strings.Index(content, opening)
+		if start < 0 || (start > 0 && content[start-1] != '\n') {
+			continue
+		}
+		stop := strings.Index(content[start:], closing)
+		if stop < 0 {
+			continue
+		}
+		stop += start
+
+		m := &Marker{}
+		scanner := bufio.NewScanner(strings.NewReader(content[start+len(opening) : stop]))
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(strings.TrimPrefix(scanner.Text(), comment+" "), ": ")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "generator":
+				m.Generator = value
+			case "template":
+				m.Template = value
+			case "analysis":
+				m.Analysis = value
+			case "checksum":
+				m.Checksum = value
+			}
+		}
+		return m, content[:start] + content[stop+len(closing):]
+	}
+	return nil, content
+}
+
+// splitDirectives separates leading Dockerfile parser directives, which
+// must come before any comment, from the rest of content
+func splitDirectives(content string) (directives, body string) {
+	for strings.HasPrefix(content[len(directives):], "# syntax=") || strings.HasPrefix(content[len(directives):], "# escape=") {
+		line := strings.IndexByte(content[len(directives):], '\n')
+		if line < 0 {
+			break
+		}
+		directives = content[:len(directives)+line+1]
+	}
+	return directives, content[len(directives):]
+}
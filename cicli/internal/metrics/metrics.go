@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cicli/internal/store"
+	"cicli/internal/term"
+)
+
+// Entry is one recorded cicli invocation
+type Entry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Command    string    `json:"command"`
+	Repo       string    `json:"repo"`
+	DurationMs int64     `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+}
+
+// Recorder appends usage entries to a local file. Nothing is ever sent anywhere.
+type Recorder struct {
+	FilePath   string
+	markerPath string
+}
+
+// NewRecorder creates a recorder backed by metrics.jsonl in the cicli data
+// directory
+func NewRecorder() (*Recorder, error) {
+	dir, err := store.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		FilePath:   filepath.Join(dir, "metrics.jsonl"),
+		markerPath: filepath.Join(dir, "metrics.enabled"),
+	}, nil
+}
+
+// Enabled reports whether the user opted in, via `cicli stats enable` or CICLI_METRICS=1
+func (r *Recorder) Enabled() bool {
+	if v := os.Getenv("CICLI_METRICS"); v != "" {
+		return v == "1" || v == "true"
+	}
+	_, err := os.Stat(r.markerPath)
+	return err == nil
+}
+
+// Enable opts in to local metrics
+func (r *Recorder) Enable() error {
+	return os.WriteFile(r.markerPath, []byte(time.Now().Format(time.RFC3339)+"\n"), 0644)
+}
+
+// Disable opts out of local metrics, keeping already recorded data
+func (r *Recorder) Disable() error {
+	if err := os.Remove(r.markerPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Record appends an entry if metrics are enabled
+func (r *Recorder) Record(e Entry) error {
+	if !r.Enabled() {
+		return nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(r.FilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Load reads all recorded entries
+func (r *Recorder) Load() ([]Entry, error) {
+	f, err := os.Open(r.FilePath)
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// CommandStats aggregates entries for one command (optionally per repo)
+type CommandStats struct {
+	Command  string
+	Repo     string
+	Runs     int
+	Failures int
+	Total    time.Duration
+}
+
+// Average returns the mean duration per run
+func (c *CommandStats) Average() time.Duration {
+	if c.Runs == 0 {
+		return 0
+	}
+	return c.Total / time.Duration(c.Runs)
+}
+
+// FailureRate returns the share of runs that exited non-zero, in percent
+func (c *CommandStats) FailureRate() float64 {
+	if c.Runs == 0 {
+		return 0
+	}
+	return float64(c.Failures) * 100 / float64(c.Runs)
+}
+
+// Summarize groups entries by command, and by command+repo when perRepo is set
+func Summarize(entries []Entry, perRepo bool) []*CommandStats {
+	byKey := make(map[string]*CommandStats)
+	for _, e := range entries {
+		key := e.Command
+		repo := ""
+		if perRepo {
+			repo = e.Repo
+			key += "\x00" + repo
+		}
+
+		cs, ok := byKey[key]
+		if !ok {
+			cs = &CommandStats{Command: e.Command, Repo: repo}
+			byKey[key] = cs
+		}
+		cs.Runs++
+		cs.Total += time.Duration(e.DurationMs) * time.Millisecond
+		if e.ExitCode != 0 {
+			cs.Failures++
+		}
+	}
+
+	stats := make([]*CommandStats, 0, len(byKey))
+	for _, cs := range byKey {
+		stats = append(stats, cs)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Runs != stats[j].Runs {
+			return stats[i].Runs > stats[j].Runs
+		}
+		return stats[i].Command+stats[i].Repo < stats[j].Command+stats[j].Repo
+	})
+	return stats
+}
+
+// PrintReport outputs a usage summary
+func PrintReport(entries []Entry) {
+	term.Println("\n📈 cicli Usage (local only)")
+	term.Println(strings.Repeat("─", 50))
+
+	if len(entries) == 0 {
+		term.Println("   No usage recorded yet.")
+		term.Println()
+		return
+	}
+
+	term.Printf("   %d runs since %s\n\n", len(entries), entries[0].Timestamp.Format("2006-01-02"))
+	term.Printf("   %-20s %6s %10s %9s\n", "COMMAND", "RUNS", "AVG", "FAILURES")
+	for _, cs := range Summarize(entries, false) {
+		term.Printf("   %-20s %6d %10s %8.0f%%\n", cs.Command, cs.Runs, cs.Average().Round(time.Millisecond), cs.FailureRate())
+	}
+
+	var analysis []Entry
+	for _, e := range entries {
+		if e.Command == "lint" || e.Command == "optimize" {
+			analysis = append(analysis, e)
+		}
+	}
+	if len(analysis) > 0 {
+		term.Println("\n   Lint/optimize time per repository:")
+		term.Printf("   %-10s %-25s %6s %10s\n", "COMMAND", "REPO", "RUNS", "AVG")
+		for _, cs := range Summarize(analysis, true) {
+			term.Printf("   %-10s %-25s %6d %10s\n", cs.Command, cs.Repo, cs.Runs, cs.Average().Round(time.Millisecond))
+		}
+	}
+
+	term.Println()
+}
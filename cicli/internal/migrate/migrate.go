@@ -0,0 +1,233 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cicli/internal/converter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sources lists the platforms the converter can read, in detection order
+var Sources = []converter.Platform{converter.GitHub, converter.GitLab, converter.CircleCI, converter.Jenkins, converter.Azure, converter.Bitbucket, converter.Drone, converter.Woodpecker, converter.Buildkite, converter.TeamCity, converter.Bamboo, converter.Travis}
+
+// Targets lists the platforms the converter can write
+var Targets = []converter.Platform{converter.GitHub, converter.GitLab, converter.CircleCI, converter.Azure, converter.Jenkins, converter.Bitbucket, converter.Drone, converter.Woodpecker, converter.Buildkite, converter.Harness, converter.Codefresh, converter.Tekton}
+
+// Disable modes for the old CI config
+const (
+	DisableKeep    = "keep"     // leave the old config running alongside the new one
+	DisableRename  = "rename"   // rename files to <file>.disabled
+	DisableIfFalse = "if-false" // add if: false to every GitHub Actions job
+)
+
+// Detect returns every platform with CI files below root
+func Detect(root string) map[converter.Platform][]string {
+	found := make(map[converter.Platform][]string)
+	platforms := append([]converter.Platform{}, Sources...)
+	for _, d := range converter.Drivers() {
+		if d.Capabilities().Source {
+			platforms = append(platforms, d.Platform())
+		}
+	}
+	for _, p := range platforms {
+		files, err := converter.Discover(root, p)
+		if err == nil && len(files) > 0 {
+			found[p] = files
+		}
+	}
+	return found
+}
+
+// Disable turns off the old CI config and returns the paths it changed,
+// including the original paths of renamed files
+func Disable(platform converter.Platform, files []string, mode string) ([]string, error) {
+	var changed []string
+	switch mode {
+	case DisableKeep, "":
+		return nil, nil
+	case DisableRename:
+		for _, file := range files {
+			if err := os.Rename(file, file+".disabled"); err != nil {
+				return changed, err
+			}
+			changed = append(changed, file, file+".disabled")
+		}
+	case DisableIfFalse:
+		if platform != converter.GitHub {
+			return nil, fmt.Errorf("if: false is only supported for GitHub Actions; use --disable=rename")
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return changed, err
+			}
+			updated, err := disableJobs(string(content))
+			if err != nil {
+				return changed, fmt.Errorf("%s: %w", file, err)
+			}
+			if err := os.WriteFile(file, []byte(updated), 0644); err != nil {
+				return changed, err
+			}
+			changed = append(changed, file)
+		}
+	default:
+		return nil, fmt.Errorf("unknown disable mode %q (use keep, rename or if-false)", mode)
+	}
+	return changed, nil
+}
+
+// disableJobs adds if: false to every job of a workflow. Existing conditions
+// are kept as a comment. The text is edited in place so comments and anchors survive.
+func disableJobs(content string) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return "", err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return content, nil
+	}
+
+	var jobs *yaml.Node
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "jobs" {
+			jobs = root.Content[i+1]
+		}
+	}
+	if jobs == nil || jobs.Kind != yaml.MappingNode {
+		return content, nil
+	}
+
+	lines := strings.Split(content, "\n")
+	inserts := make(map[int]string) // insert after this 0-based line
+	for i := 0; i+1 < len(jobs.Content); i += 2 {
+		key, body := jobs.Content[i], jobs.Content[i+1]
+		if body.Kind != yaml.MappingNode || len(body.Content) == 0 {
+			continue
+		}
+		indent := strings.Repeat(" ", body.Content[0].Column-1)
+
+		replaced := false
+		for j := 0; j+1 < len(body.Content); j += 2 {
+			if body.Content[j].Value == "if" {
+				line := body.Content[j].Line - 1
+				lines[line] = fmt.Sprintf("%sif: false # disabled by cicli migrate, was: %s", indent, strings.TrimSpace(body.Content[j+1].Value))
+				replaced = true
+			}
+		}
+		if !replaced {
+			inserts[key.Line-1] = indent + "if: false # disabled by cicli migrate"
+		}
+	}
+
+	var out []string
+	for i, line := range lines {
+		out = append(out, line)
+		if extra, ok := inserts[i]; ok {
+			out = append(out, extra)
+		}
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// Report summarizes a migration for the pull request and for reviewers
+type Report struct {
+	From     converter.Platform
+	To       converter.Platform
+	Mappings []converter.Mapping
+	Secrets  []Secret
+	Disabled []string
+}
+
+// Markdown renders the fidelity report
+func (r *Report) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# CI migration: %s → %s\n\n", r.From, r.To))
+
+	sb.WriteString("## Converted files\n\n")
+	sb.WriteString("| Input | Output | Status |\n|-------|--------|--------|\n")
+	for _, m := range r.Mappings {
+		status := m.Status
+		if m.Error != "" {
+			status += ": " + m.Error
+		}
+		sb.WriteString(fmt.Sprintf("| `%s` | `%s` | %s |\n", m.Input, m.Output, status))
+	}
+
+	var review []string
+	for _, m := range r.Mappings {
+		for _, f := range m.Findings {
+			review = append(review, fmt.Sprintf("`%s`: %s", m.Input, f))
+		}
+	}
+	sb.WriteString("\n## Needs review\n\n")
+	if len(review) == 0 {
+		sb.WriteString("Nothing was flagged during conversion.\n")
+	}
+	for _, item := range review {
+		sb.WriteString("- " + item + "\n")
+	}
+
+	sb.WriteString("\n## Secrets\n\n")
+	if len(r.Secrets) == 0 {
+		sb.WriteString("No secret references were found.\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("Create these on %s before merging:\n\n", r.To))
+		sb.WriteString("| Source | Target | Setup |\n|--------|--------|-------|\n")
+		for _, s := range r.Secrets {
+			sb.WriteString(fmt.Sprintf("| `%s` | `%s` | `%s` |\n", s.Source, TargetReference(r.To, s.Target), SetupCommand(r.To, s.Target)))
+		}
+	}
+
+	if len(r.Disabled) > 0 {
+		sb.WriteString("\n## Old configuration\n\n")
+		for _, path := range r.Disabled {
+			sb.WriteString(fmt.Sprintf("- `%s`\n", path))
+		}
+	}
+	return sb.String()
+}
+
+// WriteReport stores the report as Markdown
+func WriteReport(path string, r *Report) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(r.Markdown()), 0644)
+}
+
+// OpenPR commits paths on a new branch, pushes it and opens a pull request
+// with the gh CLI. It returns the PR URL.
+func OpenPR(branch, title, body string, paths []string) (string, error) {
+	if err := exec.Command("git", "rev-parse", "--git-dir").Run(); err != nil {
+		return "", fmt.Errorf("not a git repository")
+	}
+
+	sort.Strings(paths)
+	steps := [][]string{
+		{"git", "checkout", "-b", branch},
+		append([]string{"git", "add", "-A", "--"}, paths...),
+		{"git", "commit", "-m", title},
+		{"git", "push", "-u", "origin", branch},
+	}
+	for _, args := range steps {
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("%s: %s", strings.Join(args[:2], " "), strings.TrimSpace(string(out)))
+		}
+	}
+
+	if _, err := exec.LookPath("gh"); err != nil {
+		return "", fmt.Errorf("branch %s pushed, but the gh CLI is not installed; open the pull request manually", branch)
+	}
+	out, err := exec.Command("gh", "pr", "create", "--title", title, "--body", body, "--head", branch).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("gh pr create: %s", strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
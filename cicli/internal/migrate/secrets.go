@@ -0,0 +1,307 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cicli/internal/converter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Secret maps a secret referenced by the old CI config to its name on the target
+type Secret struct {
+	Source string   // name as referenced in the source config
+	Target string   // name to create on the target platform
+	Files  []string // files referencing it
+}
+
+var (
+	githubSecretPattern  = regexp.MustCompile(`secrets\.([A-Za-z_][A-Za-z0-9_]*)`)
+	shellVarPattern      = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+	azureMacroPattern    = regexp.MustCompile(`\$\(([A-Za-z_][A-Za-z0-9_]*)\)`)
+	jenkinsCredsPattern  = regexp.MustCompile(`(?:credentials\(\s*|credentialsId\s*:\s*)['"]([^'"]+)['"]`)
+	fromSecretPattern    = regexp.MustCompile(`from_secret:\s*['"]?([\w.-]+)`)
+	teamCityPasswords    = regexp.MustCompile(`password\(\s*"([^"]+)"|<param\s+name="([^"]+)"[^>]*spec="password`)
+	bambooSecretPattern  = regexp.MustCompile(`(?i)password|secret|passphrase|sshkey|token`)
+	nonSecretNamePattern = regexp.MustCompile(`[^A-Z0-9_]+`)
+)
+
+// builtinPrefixes are variables the platform provides itself
+var builtinPrefixes = map[converter.Platform][]string{
+	converter.GitLab:     {"CI_", "GITLAB_"},
+	converter.CircleCI:   {"CIRCLE_"},
+	converter.Bitbucket:  {"BITBUCKET_"},
+	converter.Drone:      {"DRONE_", "CI_"},
+	converter.Woodpecker: {"CI_"},
+	converter.Buildkite:  {"BUILDKITE", "CI"},
+	converter.TeamCity:   {"TEAMCITY_", "BUILD_"},
+	converter.Bamboo:     {"bamboo_"},
+	converter.Travis:     {"TRAVIS_"},
+}
+
+// shellVars are ordinary environment variables, not secrets
+var shellVars = map[string]bool{
+	"HOME": true, "PATH": true, "PWD": true, "USER": true, "SHELL": true,
+	"TMPDIR": true, "RANDOM": true, "HOSTNAME": true, "OLDPWD": true, "CI": true,
+}
+
+// FindSecrets lists secret references in the given source files. For
+// platforms that inject secrets as plain variables, variables the config
+// defines itself are excluded.
+func FindSecrets(platform converter.Platform, files []string) []Secret {
+	bySource := make(map[string]*Secret)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		var names []string
+		switch platform {
+		case converter.GitHub:
+			for _, m := range githubSecretPattern.FindAllStringSubmatch(string(content), -1) {
+				if m[1] != "GITHUB_TOKEN" {
+					names = append(names, m[1])
+				}
+			}
+		case converter.Jenkins:
+			for _, m := range jenkinsCredsPattern.FindAllStringSubmatch(string(content), -1) {
+				names = append(names, m[1])
+			}
+		case converter.Drone, converter.Woodpecker:
+			// Secrets are only read through from_secret and Woodpecker's
+			// secrets: lists; other variables are the config's own
+			for _, m := range fromSecretPattern.FindAllStringSubmatch(string(content), -1) {
+				names = append(names, m[1])
+			}
+			names = append(names, secretLists(content)...)
+		case converter.TeamCity:
+			// Only password parameters hold secrets
+			for _, m := range teamCityPasswords.FindAllStringSubmatch(string(content), -1) {
+				names = append(names, strings.TrimPrefix(m[1]+m[2], "env."))
+			}
+		case converter.Bamboo:
+			names = append(names, bambooSecrets(content)...)
+		case converter.Azure:
+			// Predefined variables are dotted (Build.SourcesDirectory), so the
+			// pattern only matches user variables
+			defined := definedVariables(content)
+			for _, m := range azureMacroPattern.FindAllStringSubmatch(string(content), -1) {
+				if !defined[m[1]] {
+					names = append(names, m[1])
+				}
+			}
+		default:
+			defined := definedVariables(content)
+			for _, m := range shellVarPattern.FindAllStringSubmatch(string(content), -1) {
+				if !defined[m[1]] && !shellVars[m[1]] && !builtin(platform, m[1]) {
+					names = append(names, m[1])
+				}
+			}
+			if platform == converter.Buildkite {
+				// Steps name the Buildkite secrets they read in secrets: lists
+				names = append(names, secretLists(content)...)
+			}
+		}
+
+		for _, name := range names {
+			s, ok := bySource[name]
+			if !ok {
+				s = &Secret{Source: name, Target: secretName(name)}
+				bySource[name] = s
+			}
+			if len(s.Files) == 0 || s.Files[len(s.Files)-1] != file {
+				s.Files = append(s.Files, file)
+			}
+		}
+	}
+
+	secrets := make([]Secret, 0, len(bySource))
+	for _, s := range bySource {
+		secrets = append(secrets, *s)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Source < secrets[j].Source })
+	return secrets
+}
+
+func builtin(platform converter.Platform, name string) bool {
+	prefixes := builtinPrefixes[platform]
+	if d := converter.LookupDriver(platform); d != nil {
+		prefixes = append(prefixes, d.Capabilities().VariablePrefixes...)
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// definedVariables collects the keys of every variables:/environment: map in a YAML config
+func definedVariables(content []byte) map[string]bool {
+	defined := make(map[string]bool)
+	var root interface{}
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return defined
+	}
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch n := v.(type) {
+		case map[string]interface{}:
+			for k, child := range n {
+				if vars, ok := child.(map[string]interface{}); ok && (k == "variables" || k == "environment") {
+					for name := range vars {
+						defined[name] = true
+					}
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range n {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+	return defined
+}
+
+// secretLists collects the names in Woodpecker and Buildkite secrets:
+// lists, given as names or {source, target} entries
+func secretLists(content []byte) []string {
+	var names []string
+	var root interface{}
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil
+	}
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch n := v.(type) {
+		case map[string]interface{}:
+			for k, child := range n {
+				if list, ok := child.([]interface{}); ok && k == "secrets" {
+					for _, item := range list {
+						switch s := item.(type) {
+						case string:
+							names = append(names, s)
+						case map[string]interface{}:
+							if source, ok := s["source"].(string); ok {
+								names = append(names, source)
+							}
+						}
+					}
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range n {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+	return names
+}
+
+// bambooSecrets collects the Bamboo variables holding encrypted or
+// password-like values, in every document of the specs
+func bambooSecrets(content []byte) []string {
+	var names []string
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var root interface{}
+		if err := dec.Decode(&root); err != nil {
+			if err != io.EOF {
+				return names
+			}
+			break
+		}
+		var walk func(v interface{})
+		walk = func(v interface{}) {
+			switch n := v.(type) {
+			case map[string]interface{}:
+				for k, child := range n {
+					if vars, ok := child.(map[string]interface{}); ok && k == "variables" {
+						for name, value := range vars {
+							if strings.HasPrefix(fmt.Sprint(value), "BAMSCRT@") || bambooSecretPattern.MatchString(name) {
+								names = append(names, name)
+							}
+						}
+					}
+					walk(child)
+				}
+			case []interface{}:
+				for _, child := range n {
+					walk(child)
+				}
+			}
+		}
+		walk(root)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// secretName turns a source name such as a Jenkins credential ID into a
+// name every platform accepts
+func secretName(name string) string {
+	name = nonSecretNamePattern.ReplaceAllString(strings.ToUpper(name), "_")
+	name = strings.Trim(name, "_")
+	if strings.HasPrefix(name, "GITHUB_") {
+		// GitHub reserves the GITHUB_ prefix
+		name = "GH_" + strings.TrimPrefix(name, "GITHUB_")
+	}
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "SECRET_" + name
+	}
+	return name
+}
+
+// TargetReference is how a pipeline on the target platform reads the secret
+func TargetReference(platform converter.Platform, name string) string {
+	switch platform {
+	case converter.GitHub:
+		return fmt.Sprintf("${{ secrets.%s }}", name)
+	case converter.Azure:
+		return fmt.Sprintf("$(%s)", name)
+	case converter.Jenkins:
+		return fmt.Sprintf("credentials('%s')", strings.ToLower(strings.ReplaceAll(name, "_", "-")))
+	case converter.Drone, converter.Woodpecker:
+		return fmt.Sprintf("from_secret: %s", name)
+	default:
+		return "$" + name
+	}
+}
+
+// SetupCommand shows how to create the secret on the target platform
+func SetupCommand(platform converter.Platform, name string) string {
+	switch platform {
+	case converter.GitHub:
+		return fmt.Sprintf("gh secret set %s", name)
+	case converter.GitLab:
+		return fmt.Sprintf("glab variable set %s --masked", name)
+	case converter.CircleCI:
+		return fmt.Sprintf("Project Settings → Environment Variables → %s", name)
+	case converter.Azure:
+		return fmt.Sprintf("az pipelines variable create --name %s --secret true", name)
+	case converter.Jenkins:
+		return fmt.Sprintf("Manage Jenkins → Credentials → %s", strings.ToLower(strings.ReplaceAll(name, "_", "-")))
+	case converter.Bitbucket:
+		return fmt.Sprintf("Repository settings → Repository variables → %s (Secured)", name)
+	case converter.Drone:
+		return fmt.Sprintf("drone secret add --repository <owner/repo> --name %s --data <value>", name)
+	case converter.Woodpecker:
+		return fmt.Sprintf("woodpecker-cli secret add --repository <owner/repo> --name %s --value <value>", name)
+	case converter.Buildkite:
+		return fmt.Sprintf("Cluster settings → Secrets → New Secret → %s", name)
+	}
+	return name
+}
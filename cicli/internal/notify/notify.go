@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"time"
+
+	"cicli/internal/httpclient"
+	"cicli/internal/term"
 )
 
 type Notifier struct{}
@@ -20,25 +22,40 @@ type Payload struct {
 	Env       string `json:"env"`
 	Version   string `json:"version"`
 	Timestamp string `json:"timestamp"`
+	Message   string `json:"message,omitempty"`
+	Text      string `json:"text,omitempty"` // read by Slack-compatible incoming webhooks
 }
 
 func (n *Notifier) Send(webhookURL, project, status, env, version string) error {
-	fmt.Printf("Sending notification to %s...\n", webhookURL)
-
-	payload := Payload{
+	return n.post(webhookURL, Payload{
 		Project:   project,
 		Status:    status,
 		Env:       env,
 		Version:   version,
 		Timestamp: time.Now().Format(time.RFC3339),
-	}
+	})
+}
+
+// SendMessage sends a free-form status message, e.g. audit regressions
+func (n *Notifier) SendMessage(webhookURL, project, status, message string) error {
+	return n.post(webhookURL, Payload{
+		Project:   project,
+		Status:    status,
+		Message:   message,
+		Text:      message,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+func (n *Notifier) post(webhookURL string, payload Payload) error {
+	term.Printf("Sending notification to %s...\n", webhookURL)
 
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(data))
+	resp, err := httpclient.New(30*time.Second).Post(webhookURL, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -48,6 +65,6 @@ func (n *Notifier) Send(webhookURL, project, status, env, version string) error
 		return fmt.Errorf("webhook returned status: %s", resp.Status)
 	}
 
-	fmt.Println("Notification sent successfully!")
+	term.Println("Notification sent successfully!")
 	return nil
 }
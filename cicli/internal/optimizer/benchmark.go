@@ -0,0 +1,179 @@
+package optimizer
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cicli/internal/i18n"
+	"cicli/internal/term"
+)
+
+// Runner executes one version of a workflow and reports how long it took
+type Runner interface {
+	Name() string
+	Run(file string, content []byte) (time.Duration, error)
+}
+
+// LocalRunner runs workflows on this machine with act
+// (https://github.com/nektos/act), which needs Docker
+type LocalRunner struct {
+	Event string // event to simulate, e.g. push or pull_request
+	Dir   string // repository root the workflow runs in
+}
+
+// Name identifies the runner in reports
+func (r LocalRunner) Name() string {
+	return "act"
+}
+
+// Run writes the content to a temporary workflow file and times act on it,
+// so the workflow on disk is never modified
+func (r LocalRunner) Run(file string, content []byte) (time.Duration, error) {
+	if _, err := exec.LookPath("act"); err != nil {
+		return 0, fmt.Errorf("act is not installed (see https://github.com/nektos/act), or use --runner=github")
+	}
+
+	tmp, err := os.CreateTemp("", "cicli-benchmark-*"+filepath.Ext(file))
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	tmp.Close()
+
+	event := r.Event
+	if event == "" {
+		event = "push"
+	}
+	cmd := exec.Command("act", event, "-W", tmp.Name())
+	cmd.Dir = r.Dir
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("act failed: %w\n%s", err, tail(output.String(), 20))
+	}
+	return time.Since(start), nil
+}
+
+// tail returns the last n lines of s
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// BenchmarkResult holds measured durations of a workflow before and after
+// its auto-applicable optimizations
+type BenchmarkResult struct {
+	File      string          `json:"file"`
+	Runner    string          `json:"runner"`
+	Applied   []string        `json:"applied"`
+	Before    []time.Duration `json:"before"`
+	After     []time.Duration `json:"after"`
+	Estimated string          `json:"estimated"`
+}
+
+// Benchmark runs the original and optimized workflow runs times each,
+// alternating between them so caches and machine load affect both equally.
+// It returns an error when there is nothing to apply or a run fails, since a
+// failed run says nothing about speed.
+func (o *Optimizer) Benchmark(file string, result *OptimizationResult, runner Runner, runs int) (*BenchmarkResult, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	optimized, applied := ApplyContent(string(content), result)
+	if len(applied) == 0 {
+		return nil, fmt.Errorf("%s has no auto-applicable optimizations to benchmark", file)
+	}
+	if runs < 1 {
+		runs = 1
+	}
+
+	bench := &BenchmarkResult{
+		File:      file,
+		Runner:    runner.Name(),
+		Applied:   applied,
+		Estimated: result.PotentialSave,
+	}
+	for i := 0; i < runs; i++ {
+		fmt.Fprintf(os.Stderr, "⏱️  Run %d/%d: original\n", i+1, runs)
+		d, err := runner.Run(file, content)
+		if err != nil {
+			return nil, fmt.Errorf("original workflow: %w", err)
+		}
+		bench.Before = append(bench.Before, d)
+
+		fmt.Fprintf(os.Stderr, "⏱️  Run %d/%d: optimized\n", i+1, runs)
+		d, err = runner.Run(file, []byte(optimized))
+		if err != nil {
+			return nil, fmt.Errorf("optimized workflow: %w", err)
+		}
+		bench.After = append(bench.After, d)
+	}
+	return bench, nil
+}
+
+func mean(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	return total / time.Duration(len(durations))
+}
+
+// Delta is the mean optimized duration minus the mean original duration;
+// negative means the optimizations made the workflow faster
+func (b *BenchmarkResult) Delta() time.Duration {
+	return mean(b.After) - mean(b.Before)
+}
+
+// PrintReport outputs the measured durations next to the estimate
+func (b *BenchmarkResult) PrintReport() {
+	term.Printf("\n⏱️  %s\n", i18n.T("Benchmark: %s", b.File))
+	term.Printf("   %s\n", i18n.T("Runner: %s (%d runs each)", b.Runner, len(b.Before)))
+	term.Println(strings.Repeat("─", 50))
+
+	term.Println("   " + i18n.T("Applied:"))
+	for _, title := range b.Applied {
+		term.Printf("      • %s\n", title)
+	}
+
+	before, after := mean(b.Before), mean(b.After)
+	term.Printf("\n   %-10s %s\n", i18n.T("Before:"), before.Round(time.Second))
+	term.Printf("   %-10s %s\n", i18n.T("After:"), after.Round(time.Second))
+
+	delta := b.Delta()
+	percent := 0.0
+	if before > 0 {
+		percent = float64(delta) / float64(before) * 100
+	}
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+		delta = -delta
+	}
+	term.Printf("   %-10s %s%s (%s%.0f%%)\n", i18n.T("Delta:"), sign, delta.Round(time.Second), sign, math.Abs(percent))
+	term.Printf("   %-10s %s\n", i18n.T("Estimated:"), b.Estimated)
+
+	if b.Delta() >= 0 {
+		term.Println("\n   ⚠️  " + i18n.T("The optimized workflow was not faster; keep the original or benchmark with more runs"))
+	}
+	term.Println()
+}
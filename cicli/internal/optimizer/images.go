@@ -0,0 +1,187 @@
+package optimizer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cicli/internal/baseimages"
+
+	"gopkg.in/yaml.v3"
+)
+
+// imageFamily describes an official image whose default tags are built on
+// full Debian with compilers and build tools, next to a much smaller variant
+type imageFamily struct {
+	variant string // tag suffix of the small variant
+	fullMB  int    // approximate compressed size of the default tag
+	smallMB int    // approximate compressed size of the small variant
+	current string // a supported version, suggested in place of latest
+}
+
+var imageFamilies = map[string]imageFamily{
+	"node":   {variant: "slim", fullMB: 400, smallMB: 75, current: "22"},
+	"python": {variant: "slim", fullMB: 370, smallMB: 45, current: "3.13"},
+	"ruby":   {variant: "slim", fullMB: 360, smallMB: 70, current: "3.4"},
+	"golang": {variant: "alpine", fullMB: 300, smallMB: 75, current: "1.25"},
+	"rust":   {variant: "slim", fullMB: 530, smallMB: 250, current: "1"},
+}
+
+// pullMBps is the effective pull rate (download plus extraction) of a
+// typical hosted runner, as a range in MB/s
+var pullMBps = [2]int{25, 50}
+
+// debianSuffix is the release codename some tags end with, e.g. 20-bookworm
+var debianSuffix = regexp.MustCompile(`-(trixie|bookworm|bullseye|buster)$`)
+
+// jobImage is an image and the jobs that run in it
+type jobImage struct {
+	ref  string
+	jobs []string
+}
+
+// checkJobImages suggests smaller, supported and pinned images for the jobs
+// of a GitLab or CircleCI pipeline, with estimated pull-time savings
+func (o *Optimizer) checkJobImages(content []byte, platform string, result *OptimizationResult) {
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return
+	}
+
+	for _, image := range pipelineImages(config, platform) {
+		jobs := strings.Join(image.jobs, "', '")
+		name, tag := baseimages.Split(image.ref)
+		if name == "" {
+			continue
+		}
+
+		if legacy := strings.TrimPrefix(name, "circleci/"); platform == "circleci" && legacy != name {
+			result.Optimizations = append(result.Optimizations, Optimization{
+				Category:    "images",
+				Title:       fmt.Sprintf("Replace legacy image '%s'", image.ref),
+				Description: fmt.Sprintf("The circleci/ images used by '%s' are deprecated. The cimg/ convenience images are smaller and cached on CircleCI hosts, so they usually pull in seconds", jobs),
+				Impact:      "medium",
+				Before:      "image: " + image.ref,
+				After:       "image: cimg/" + strings.TrimPrefix(image.ref, "circleci/"),
+				AutoApply:   false,
+			})
+			continue
+		}
+
+		family, known := imageFamilies[name]
+		if version, minimum, eol := baseimages.EndOfLife(name, tag); eol {
+			result.Optimizations = append(result.Optimizations, Optimization{
+				Category:    "images",
+				Title:       fmt.Sprintf("Update end-of-life image '%s'", image.ref),
+				Description: fmt.Sprintf("%s %s, used by '%s', no longer receives security fixes; move to %s or newer", name, version, jobs, minimum),
+				Impact:      "low",
+				Before:      "image: " + image.ref,
+				After:       "image: " + name + ":" + strings.Replace(tag, version, minimum, 1),
+				AutoApply:   false,
+			})
+		}
+
+		if known && !strings.Contains(tag, "slim") && !strings.Contains(tag, "alpine") {
+			saved := family.fullMB - family.smallMB
+			small := debianSuffix.ReplaceAllString(tag, "")
+			if small == "" || small == "latest" {
+				small = family.current
+			}
+			result.Optimizations = append(result.Optimizations, Optimization{
+				Category:      "images",
+				Title:         fmt.Sprintf("Use a smaller image than '%s'", image.ref),
+				Description:   fmt.Sprintf("The full %s image used by '%s' is about %dMB compressed; the %s variant is about %dMB and is enough unless the job compiles native code or needs tools it lacks", name, jobs, family.fullMB, family.variant, family.smallMB),
+				Impact:        "medium",
+				EstimatedSave: fmt.Sprintf("%d-%ds per job on a cold runner", saved/pullMBps[1], saved/pullMBps[0]),
+				Before:        "image: " + image.ref,
+				After:         "image: " + name + ":" + small + "-" + family.variant,
+				AutoApply:     false,
+			})
+			continue
+		}
+
+		if tag == "" || tag == "latest" {
+			result.Optimizations = append(result.Optimizations, Optimization{
+				Category:    "images",
+				Title:       fmt.Sprintf("Pin image '%s'", image.ref),
+				Description: fmt.Sprintf("'%s', used by '%s', can change between runs and is pulled again whenever it does. A version tag or digest stays cached on the runner host until you bump it", image.ref, jobs),
+				Impact:      "low",
+				Before:      "image: " + image.ref,
+				After:       "image: " + image.ref + "@sha256:<digest>",
+				AutoApply:   false,
+			})
+		}
+	}
+}
+
+// pipelineImages returns the images of a pipeline's jobs, sorted by reference
+func pipelineImages(config map[string]interface{}, platform string) []jobImage {
+	users := make(map[string][]string)
+	add := func(ref, job string) {
+		if ref != "" && !strings.Contains(ref, "$") && !strings.Contains(ref, "@sha256:") {
+			users[ref] = append(users[ref], job)
+		}
+	}
+
+	switch platform {
+	case "gitlab":
+		fallback := gitlabImage(config["image"])
+		if def, ok := config["default"].(map[string]interface{}); ok && def["image"] != nil {
+			fallback = gitlabImage(def["image"])
+		}
+		names := make([]string, 0, len(config))
+		for name := range config {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			job, ok := config[name].(map[string]interface{})
+			if !ok || strings.HasPrefix(name, ".") || (job["script"] == nil && job["trigger"] == nil) {
+				continue
+			}
+			if job["image"] != nil {
+				add(gitlabImage(job["image"]), name)
+			} else if job["script"] != nil {
+				add(fallback, name)
+			}
+		}
+	case "circleci":
+		for _, section := range []string{"jobs", "executors"} {
+			entries, _ := config[section].(map[string]interface{})
+			names := make([]string, 0, len(entries))
+			for name := range entries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				entry, _ := entries[name].(map[string]interface{})
+				docker, _ := entry["docker"].([]interface{})
+				// The first image runs the steps; later ones are services
+				if len(docker) > 0 {
+					if d, ok := docker[0].(map[string]interface{}); ok {
+						add(getString(d, "image"), name)
+					}
+				}
+			}
+		}
+	}
+
+	images := make([]jobImage, 0, len(users))
+	for ref, jobs := range users {
+		images = append(images, jobImage{ref: ref, jobs: jobs})
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].ref < images[j].ref })
+	return images
+}
+
+// gitlabImage returns the reference of a GitLab image: string or map
+func gitlabImage(v interface{}) string {
+	switch image := v.(type) {
+	case string:
+		return image
+	case map[string]interface{}:
+		return getString(image, "name")
+	}
+	return ""
+}
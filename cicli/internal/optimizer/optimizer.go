@@ -1,32 +1,37 @@
 package optimizer
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"regexp"
 	"strings"
 
+	"cicli/internal/i18n"
+	"cicli/internal/term"
+
 	"gopkg.in/yaml.v3"
 )
 
 // Optimization represents a suggested optimization
 type Optimization struct {
-	Category      string  `json:"category"`
-	Title         string  `json:"title"`
-	Description   string  `json:"description"`
-	Impact        string  `json:"impact"` // high, medium, low
-	EstimatedSave string  `json:"estimated_save,omitempty"`
-	Before        string  `json:"before,omitempty"`
-	After         string  `json:"after,omitempty"`
-	AutoApply     bool    `json:"auto_apply"`
+	Category      string `json:"category"`
+	Title         string `json:"title"`
+	Description   string `json:"description"`
+	Impact        string `json:"impact"` // high, medium, low
+	EstimatedSave string `json:"estimated_save,omitempty"`
+	Before        string `json:"before,omitempty"`
+	After         string `json:"after,omitempty"`
+	AutoApply     bool   `json:"auto_apply"`
 }
 
 // OptimizationResult contains optimization analysis
 type OptimizationResult struct {
-	File          string         `json:"file"`
-	Platform      string         `json:"platform"`
-	Optimizations []Optimization `json:"optimizations"`
-	PotentialSave string         `json:"potential_save"`
+	File          string           `json:"file"`
+	Platform      string           `json:"platform"`
+	Optimizations []Optimization   `json:"optimizations"`
+	PotentialSave string           `json:"potential_save"`
+	Benchmark     *BenchmarkResult `json:"benchmark,omitempty"` // set by cicli optimize --benchmark
 }
 
 // Optimizer analyzes and optimizes CI/CD configurations
@@ -43,6 +48,7 @@ func (o *Optimizer) Analyze(filePath string) (*OptimizationResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
 
 	platform := detectPlatform(filePath)
 	result := &OptimizationResult{
@@ -56,6 +62,9 @@ func (o *Optimizer) Analyze(filePath string) (*OptimizationResult, error) {
 		o.analyzeGitHub(content, result)
 	case "gitlab":
 		o.analyzeGitLab(content, result)
+	case "circleci":
+		o.checkJobImages(content, platform, result)
+		o.analyzeGeneric(content, result)
 	default:
 		o.analyzeGeneric(content, result)
 	}
@@ -80,6 +89,9 @@ func (o *Optimizer) analyzeGitHub(content []byte, result *OptimizationResult) {
 	// Check for matrix builds
 	o.checkMatrixBuilds(config, result)
 
+	// Check for test suites that dominate the critical path
+	o.checkTestSharding(config, result)
+
 	// Check for job consolidation
 	o.checkJobConsolidation(config, result)
 
@@ -92,6 +104,9 @@ func (o *Optimizer) analyzeGitHub(content []byte, result *OptimizationResult) {
 	// Check for runner optimization
 	o.checkRunnerOptimization(config, result)
 
+	// Check for arm64 and GPU runner opportunities
+	o.checkRunnerArchitecture(config, result)
+
 	// Check for conditional execution
 	o.checkConditionalExecution(content, result)
 }
@@ -439,9 +454,9 @@ func (o *Optimizer) checkRunnerOptimization(config map[string]interface{}, resul
 					Title:       fmt.Sprintf("Pin runner version in '%s'", jobName),
 					Description: "Using 'ubuntu-latest' can cause unexpected breaks when GitHub updates the image",
 					Impact:      "low",
-					Before:     "runs-on: ubuntu-latest",
-					After:      "runs-on: ubuntu-24.04",
-					AutoApply:  true,
+					Before:      "runs-on: ubuntu-latest",
+					After:       "runs-on: ubuntu-24.04",
+					AutoApply:   true,
 				})
 				break
 			}
@@ -534,6 +549,9 @@ func (o *Optimizer) analyzeGitLab(content []byte, result *OptimizationResult) {
 			AutoApply:   false,
 		})
 	}
+
+	// Check for oversized, outdated and unpinned job images
+	o.checkJobImages(content, "gitlab", result)
 }
 
 // analyzeGeneric performs generic optimization analysis
@@ -547,9 +565,9 @@ func (o *Optimizer) analyzeGeneric(content []byte, result *OptimizationResult) {
 			Title:       "Use 'npm ci' instead of 'npm install'",
 			Description: "'npm ci' is faster and more reliable for CI environments",
 			Impact:      "medium",
-			Before:     "npm install",
-			After:      "npm ci",
-			AutoApply:  true,
+			Before:      "npm install",
+			After:       "npm ci",
+			AutoApply:   true,
 		})
 	}
 }
@@ -604,13 +622,13 @@ func getString(m map[string]interface{}, key string) string {
 
 // PrintReport outputs a formatted optimization report
 func (r *OptimizationResult) PrintReport() {
-	fmt.Printf("\n⚡ Optimization Report: %s\n", r.File)
-	fmt.Printf("   Platform: %s\n", r.Platform)
-	fmt.Printf("   Potential time savings: %s\n", r.PotentialSave)
-	fmt.Println(strings.Repeat("─", 50))
+	term.Printf("\n⚡ %s\n", i18n.T("Optimization Report: %s", r.File))
+	term.Printf("   %s\n", i18n.T("Platform: %s", r.Platform))
+	term.Printf("   %s\n", i18n.T("Potential time savings: %s", r.PotentialSave))
+	term.Println(strings.Repeat("─", 50))
 
 	if len(r.Optimizations) == 0 {
-		fmt.Println("   ✅ No optimizations needed - your pipeline looks great!")
+		term.Println("   ✅ " + i18n.T("No optimizations needed - your pipeline looks great!"))
 		return
 	}
 
@@ -631,66 +649,69 @@ func (r *OptimizationResult) PrintReport() {
 	}
 
 	if len(high) > 0 {
-		fmt.Println("\n   🔴 High Impact:")
+		term.Println("\n   🔴 " + i18n.T("High Impact:"))
 		for _, opt := range high {
 			printOptimization(opt)
 		}
 	}
 
 	if len(medium) > 0 {
-		fmt.Println("\n   🟡 Medium Impact:")
+		term.Println("\n   🟡 " + i18n.T("Medium Impact:"))
 		for _, opt := range medium {
 			printOptimization(opt)
 		}
 	}
 
 	if len(low) > 0 {
-		fmt.Println("\n   🟢 Low Impact:")
+		term.Println("\n   🟢 " + i18n.T("Low Impact:"))
 		for _, opt := range low {
 			printOptimization(opt)
 		}
 	}
 
-	fmt.Println()
+	term.Println()
 }
 
 func printOptimization(opt Optimization) {
 	autoFix := ""
 	if opt.AutoApply {
-		autoFix = " [auto-fixable]"
+		autoFix = i18n.T(" [auto-fixable]")
 	}
-	fmt.Printf("      • %s%s\n", opt.Title, autoFix)
-	fmt.Printf("        %s\n", opt.Description)
+	term.Printf("      • %s%s\n", opt.Title, autoFix)
+	term.Printf("        %s\n", opt.Description)
 	if opt.EstimatedSave != "" {
-		fmt.Printf("        💨 Estimated save: %s\n", opt.EstimatedSave)
+		term.Printf("        💨 %s\n", i18n.T("Estimated save: %s", opt.EstimatedSave))
 	}
 }
 
-// Apply applies auto-fixable optimizations
-func (o *Optimizer) Apply(filePath string, result *OptimizationResult) error {
+// Apply applies auto-fixable optimizations and returns the titles of those it applied
+func (o *Optimizer) Apply(filePath string, result *OptimizationResult) ([]string, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	contentStr := string(content)
-	modified := false
+	contentStr, applied := ApplyContent(string(content), result)
+	if len(applied) > 0 {
+		if err := os.WriteFile(filePath, []byte(contentStr), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return applied, nil
+}
 
+// ApplyContent applies auto-fixable optimizations to a workflow's content and
+// returns the updated content with the titles of the optimizations applied
+func ApplyContent(content string, result *OptimizationResult) (string, []string) {
+	var applied []string
 	for _, opt := range result.Optimizations {
 		if opt.AutoApply && opt.Before != "" && opt.After != "" {
-			if strings.Contains(contentStr, opt.Before) {
-				contentStr = strings.Replace(contentStr, opt.Before, opt.After, 1)
-				modified = true
-				fmt.Printf("   ✅ Applied: %s\n", opt.Title)
+			if strings.Contains(content, opt.Before) {
+				content = strings.Replace(content, opt.Before, opt.After, 1)
+				applied = append(applied, opt.Title)
 			}
 		}
 	}
-
-	if modified {
-		if err := os.WriteFile(filePath, []byte(contentStr), 0644); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return content, applied
 }
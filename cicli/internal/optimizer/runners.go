@@ -0,0 +1,155 @@
+package optimizer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// armRunner is GitHub's hosted arm64 Linux runner label. Standard 2-core arm64
+// runners bill about a third less per minute than their x64 counterparts.
+const armRunner = "ubuntu-24.04-arm"
+
+// gpuRunner is a suggested label for a GitHub GPU larger runner; the actual
+// label is whatever the organization names the runner when creating it
+const gpuRunner = "linux-gpu-t4"
+
+var (
+	// arm64Platform matches a Docker --platform / platforms: list that includes arm64
+	arm64Platform = regexp.MustCompile(`linux/arm64|linux/aarch64`)
+	// goArm64 matches a Go cross-compile targeting arm64
+	goArm64 = regexp.MustCompile(`GOARCH[=:]\s*["']?arm64`)
+	// rustArm64 matches a Rust cross-compile targeting aarch64
+	rustArm64 = regexp.MustCompile(`(--target[= ]|target:\s*)["']?aarch64-|cross build`)
+	// gpuWorkload matches ML frameworks and CUDA tooling in a job
+	gpuWorkload = regexp.MustCompile(`\b(torch|pytorch|tensorflow|cupy|nvidia-smi|CUDA_VISIBLE_DEVICES|nvcc)\b|jax\[cuda`)
+)
+
+// checkRunnerArchitecture suggests arm64 runners for jobs that build or
+// cross-compile for arm64 on x64 runners, and GPU runners for jobs that run
+// ML workloads on CPU, with the expected price/performance tradeoff
+func (o *Optimizer) checkRunnerArchitecture(config map[string]interface{}, result *OptimizationResult) {
+	jobs, ok := config["jobs"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		jd, ok := jobs[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		runsOn := runnerLabels(jd)
+		if strings.Contains(runsOn, "self-hosted") || strings.Contains(runsOn, "${{") {
+			continue
+		}
+		text := jobText(config, jd)
+
+		if !strings.Contains(runsOn, "arm") {
+			if opt, ok := armOptimization(name, runsOn, text); ok {
+				result.Optimizations = append(result.Optimizations, opt)
+			}
+		}
+		if !strings.Contains(runsOn, "gpu") && gpuWorkload.MatchString(text) && testCommandIn(jd) != "" {
+			result.Optimizations = append(result.Optimizations, Optimization{
+				Category:      "runners",
+				Title:         fmt.Sprintf("Run ML tests in '%s' on a GPU runner", name),
+				Description:   "The job tests an ML framework on CPU. A GPU larger runner (Tesla T4, 4 cores) costs about 9x more per minute than a standard runner, so it pays off when the CPU run takes over 9x as long or GPU-only tests are being skipped",
+				Impact:        "medium",
+				EstimatedSave: "5-20x faster model tests",
+				Before:        "runs-on: " + runsOn,
+				After:         "runs-on: " + gpuRunner,
+				AutoApply:     false,
+			})
+		}
+	}
+}
+
+// armOptimization returns the arm64 suggestion for a job, if it has an arm64 workload
+func armOptimization(name, runsOn, text string) (Optimization, bool) {
+	switch {
+	case arm64Platform.MatchString(text):
+		// multi-arch images built under QEMU emulate every arm64 instruction
+		return Optimization{
+			Category:      "runners",
+			Title:         fmt.Sprintf("Build arm64 images in '%s' on a native arm64 runner", name),
+			Description:   fmt.Sprintf("The job builds linux/arm64 images under QEMU emulation, which is typically 5-10x slower than native. Split the build into a per-platform matrix with arm64 on '%s' (about 37%% cheaper per minute than x64) and merge the manifests with 'docker buildx imagetools create'", armRunner),
+			Impact:        "high",
+			EstimatedSave: "50-90% of arm64 build time",
+			Before:        "runs-on: " + runsOn + "\nplatforms: linux/amd64,linux/arm64",
+			After:         "strategy:\n  matrix:\n    include:\n      - platform: linux/amd64\n        runner: ubuntu-24.04\n      - platform: linux/arm64\n        runner: " + armRunner + "\nruns-on: ${{ matrix.runner }}",
+			AutoApply:     false,
+		}, true
+	case goArm64.MatchString(text), rustArm64.MatchString(text):
+		// cross-compiling is fast, but the arm64 binary is never tested natively
+		return Optimization{
+			Category:      "runners",
+			Title:         fmt.Sprintf("Build and test arm64 natively in '%s'", name),
+			Description:   fmt.Sprintf("The job cross-compiles for arm64 on x64, so the arm64 binary is never run. Building it on '%s' lets its tests run too, drops the cross toolchain, and costs about 37%% less per minute than x64", armRunner),
+			Impact:        "medium",
+			EstimatedSave: "cross-toolchain setup, plus native arm64 test coverage",
+			Before:        "runs-on: " + runsOn,
+			After:         "strategy:\n  matrix:\n    runner: [ubuntu-24.04, " + armRunner + "]\nruns-on: ${{ matrix.runner }}",
+			AutoApply:     false,
+		}, true
+	}
+	return Optimization{}, false
+}
+
+// runnerLabels returns a job's runs-on labels joined by commas
+func runnerLabels(jd map[string]interface{}) string {
+	switch r := jd["runs-on"].(type) {
+	case string:
+		return r
+	case []interface{}:
+		var labels []string
+		for _, label := range r {
+			if s, ok := label.(string); ok {
+				labels = append(labels, s)
+			}
+		}
+		return strings.Join(labels, ",")
+	case map[string]interface{}:
+		return strings.Join([]string{getString(r, "group"), getString(r, "labels")}, ",")
+	}
+	return ""
+}
+
+// jobText flattens the env, run commands and action inputs a job sees into
+// one string for pattern matching
+func jobText(config, jd map[string]interface{}) string {
+	var b strings.Builder
+	writeEnv := func(env interface{}) {
+		if m, ok := env.(map[string]interface{}); ok {
+			for k, v := range m {
+				fmt.Fprintf(&b, "%s=%v\n", k, v)
+			}
+		}
+	}
+	writeEnv(config["env"])
+	writeEnv(jd["env"])
+
+	steps, _ := jd["steps"].([]interface{})
+	for _, step := range steps {
+		sd, ok := step.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		writeEnv(sd["env"])
+		b.WriteString(getString(sd, "uses") + "\n")
+		b.WriteString(getString(sd, "run") + "\n")
+		if with, ok := sd["with"].(map[string]interface{}); ok {
+			for k, v := range with {
+				fmt.Fprintf(&b, "%s: %v\n", k, v)
+			}
+		}
+	}
+	return b.String()
+}
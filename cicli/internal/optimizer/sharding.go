@@ -0,0 +1,196 @@
+package optimizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// testCommands are run-step fragments that indicate a test suite
+var testCommands = []string{"jest", "vitest", "playwright test", "pytest", "go test", "npm test", "yarn test", "pnpm test", "mvn test", "gradlew test"}
+
+// checkTestSharding suggests sharding when a single, unsharded test job
+// accounts for most of the critical path
+func (o *Optimizer) checkTestSharding(config map[string]interface{}, result *OptimizationResult) {
+	jobs, ok := config["jobs"].(map[string]interface{})
+	if !ok || len(jobs) == 0 {
+		return
+	}
+
+	weights := make(map[string]int)
+	needs := make(map[string][]string)
+	for name, jobData := range jobs {
+		jd, ok := jobData.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		weights[name] = jobWeight(jd)
+		needs[name] = jobNeeds(jd)
+	}
+
+	path, total := criticalPath(weights, needs)
+	if total == 0 {
+		return
+	}
+
+	for _, name := range path {
+		jd, _ := jobs[name].(map[string]interface{})
+		if _, hasMatrix := jd["strategy"]; hasMatrix {
+			continue
+		}
+		command := testCommandIn(jd)
+		if command == "" || strings.Contains(command, "--shard") || strings.Contains(command, "--splits") {
+			continue
+		}
+		if weights[name]*2 < total {
+			continue
+		}
+
+		result.Optimizations = append(result.Optimizations, Optimization{
+			Category:      "parallelization",
+			Title:         fmt.Sprintf("Shard tests in job '%s'", name),
+			Description:   fmt.Sprintf("Job '%s' makes up %d%% of the critical path; splitting '%s' across parallel shards shortens it", name, weights[name]*100/total, command),
+			Impact:        "high",
+			EstimatedSave: "50-75% of test time",
+			Before:        fmt.Sprintf("- run: %s", command),
+			After:         shardSnippet(command),
+			AutoApply:     false,
+		})
+		return
+	}
+}
+
+// jobWeight estimates a job's duration from timeout-minutes, falling back to its step count
+func jobWeight(jd map[string]interface{}) int {
+	if timeout, ok := jd["timeout-minutes"].(int); ok && timeout > 0 {
+		return timeout
+	}
+	if steps, ok := jd["steps"].([]interface{}); ok {
+		return len(steps)
+	}
+	return 1
+}
+
+func jobNeeds(jd map[string]interface{}) []string {
+	switch n := jd["needs"].(type) {
+	case string:
+		return []string{n}
+	case []interface{}:
+		var deps []string
+		for _, d := range n {
+			if s, ok := d.(string); ok {
+				deps = append(deps, s)
+			}
+		}
+		return deps
+	}
+	return nil
+}
+
+// criticalPath returns the heaviest chain of jobs through needs and its weight
+func criticalPath(weights map[string]int, needs map[string][]string) ([]string, int) {
+	memo := make(map[string][]string)
+	cost := make(map[string]int)
+	visiting := make(map[string]bool)
+
+	var walk func(name string) int
+	walk = func(name string) int {
+		if c, ok := cost[name]; ok {
+			return c
+		}
+		if visiting[name] {
+			return 0
+		}
+		visiting[name] = true
+
+		best, bestPath := 0, []string(nil)
+		for _, dep := range needs[name] {
+			if _, ok := weights[dep]; !ok {
+				continue
+			}
+			if c := walk(dep); c > best {
+				best, bestPath = c, memo[dep]
+			}
+		}
+		memo[name] = append(append([]string{}, bestPath...), name)
+		cost[name] = best + weights[name]
+		visiting[name] = false
+		return cost[name]
+	}
+
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var path []string
+	total := 0
+	for _, name := range names {
+		if c := walk(name); c > total {
+			total, path = c, memo[name]
+		}
+	}
+	return path, total
+}
+
+func testCommandIn(jd map[string]interface{}) string {
+	steps, _ := jd["steps"].([]interface{})
+	for _, step := range steps {
+		sd, ok := step.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		run := getString(sd, "run")
+		for _, cmd := range testCommands {
+			if strings.Contains(run, cmd) {
+				return strings.TrimSpace(run)
+			}
+		}
+	}
+	return ""
+}
+
+// ShardCommand returns a test command that only runs one shard of the suite,
+// using the matrix.shard variable, or "" if the runner cannot be sharded
+func ShardCommand(framework string, shards int) string {
+	shard := "${{ matrix.shard }}"
+	switch framework {
+	case "jest":
+		return fmt.Sprintf("npx jest --shard=%s/%d", shard, shards)
+	case "vitest":
+		return fmt.Sprintf("npx vitest run --shard=%s/%d", shard, shards)
+	case "playwright":
+		return fmt.Sprintf("npx playwright test --shard=%s/%d", shard, shards)
+	case "pytest":
+		return fmt.Sprintf("pip install pytest-split && pytest --splits %d --group %s", shards, shard)
+	case "go test":
+		// Distribute top-level tests round-robin and select them with -run
+		return fmt.Sprintf(`TESTS=$(go test -list . ./... | grep -E '^(Test|Example|Fuzz)' | sort -u | awk 'NR %% %d == %s - 1' | paste -sd '|' -)
+          go test -v ./... -run "^(${TESTS:-NONE})$"`, shards, shard)
+	}
+	return ""
+}
+
+func shardSnippet(command string) string {
+	framework := ""
+	switch {
+	case strings.Contains(command, "vitest"):
+		framework = "vitest"
+	case strings.Contains(command, "playwright"):
+		framework = "playwright"
+	case strings.Contains(command, "pytest"):
+		framework = "pytest"
+	case strings.Contains(command, "go test"):
+		framework = "go test"
+	default:
+		framework = "jest"
+	}
+
+	return fmt.Sprintf(`strategy:
+  fail-fast: false
+  matrix:
+    shard: [1, 2, 3, 4]
+steps:
+  - run: %s`, ShardCommand(framework, 4))
+}
@@ -0,0 +1,322 @@
+package pipetest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// evalCondition evaluates a GitHub Actions if: condition. It supports the
+// operators, literals and functions conditions are usually written with;
+// contexts that are not in ctx evaluate to an empty string.
+func evalCondition(condition string, ctx map[string]string) (bool, error) {
+	condition = strings.TrimSpace(condition)
+	if strings.HasPrefix(condition, "${{") && strings.HasSuffix(condition, "}}") {
+		condition = strings.TrimSpace(condition[3 : len(condition)-2])
+	}
+	if condition == "" {
+		return true, nil
+	}
+
+	p := &exprParser{ctx: ctx}
+	if err := p.tokenize(condition); err != nil {
+		return false, err
+	}
+	v, err := p.or()
+	if err != nil {
+		return false, err
+	}
+	if p.pos < len(p.tokens) {
+		return false, fmt.Errorf("unexpected %q in %q", p.tokens[p.pos], condition)
+	}
+	return truthy(v), nil
+}
+
+// statusFunctions make a job run even when a job it needs did not succeed
+var statusFunctions = []string{"always()", "failure()", "cancelled()"}
+
+// usesStatusFunction reports whether a condition overrides the implicit success()
+func usesStatusFunction(condition string) bool {
+	for _, f := range statusFunctions {
+		if strings.Contains(strings.ReplaceAll(condition, " ", ""), f) {
+			return true
+		}
+	}
+	return false
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+	ctx    map[string]string
+}
+
+func (p *exprParser) tokenize(s string) error {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '\'':
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\'' {
+					// '' is an escaped quote
+					if j+1 < len(s) && s[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(s) {
+				return fmt.Errorf("unterminated string in %q", s)
+			}
+			p.tokens = append(p.tokens, s[i:j+1])
+			i = j + 1
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"),
+			strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="),
+			strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="):
+			p.tokens = append(p.tokens, s[i:i+2])
+			i += 2
+		case strings.ContainsRune("!()<>,", rune(c)):
+			p.tokens = append(p.tokens, string(c))
+			i++
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n'!()<>,=&|", rune(s[j])) {
+				j++
+			}
+			if j == i {
+				return fmt.Errorf("unexpected %q in %q", string(c), s)
+			}
+			p.tokens = append(p.tokens, s[i:j])
+			i = j
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *exprParser) or() (interface{}, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		// Like GitHub, || returns the first truthy operand
+		if !truthy(left) {
+			left = right
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) and() (interface{}, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		if truthy(left) {
+			left = right
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) comparison() (interface{}, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", ">", "<=", ">=":
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return compare(op, left, right), nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) unary() (interface{}, error) {
+	if p.peek() == "!" {
+		p.next()
+		v, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(v), nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (interface{}, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case t == "(":
+		v, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return v, nil
+	case strings.HasPrefix(t, "'"):
+		return strings.ReplaceAll(t[1:len(t)-1], "''", "'"), nil
+	case t == "true":
+		return true, nil
+	case t == "false":
+		return false, nil
+	case t == "null":
+		return nil, nil
+	}
+	if n, err := strconv.ParseFloat(t, 64); err == nil {
+		return n, nil
+	}
+
+	if p.peek() == "(" {
+		p.next()
+		var args []interface{}
+		for p.peek() != ")" {
+			v, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+			if p.peek() == "," {
+				p.next()
+			} else if p.peek() != ")" {
+				return nil, fmt.Errorf("expected , or ) in call to %s", t)
+			}
+		}
+		p.next()
+		return p.call(t, args)
+	}
+
+	// needs.<job>.result and other dotted contexts
+	v, ok := p.ctx[t]
+	if !ok {
+		return "", nil
+	}
+	return v, nil
+}
+
+func (p *exprParser) call(name string, args []interface{}) (interface{}, error) {
+	str := func(i int) string {
+		if i < len(args) {
+			return strings.ToLower(toString(args[i]))
+		}
+		return ""
+	}
+	switch strings.ToLower(name) {
+	// Tests simulate runs where every job that runs succeeds
+	case "success", "always":
+		return true, nil
+	case "failure", "cancelled":
+		return false, nil
+	case "startswith":
+		return strings.HasPrefix(str(0), str(1)), nil
+	case "endswith":
+		return strings.HasSuffix(str(0), str(1)), nil
+	case "contains":
+		return strings.Contains(str(0), str(1)), nil
+	}
+	return nil, fmt.Errorf("unsupported function %s()", name)
+}
+
+func truthy(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	}
+	return true
+}
+
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return x
+	}
+	return fmt.Sprint(v)
+}
+
+// compare follows GitHub's rules loosely: strings compare case-insensitively,
+// and mixed types are compared as numbers when both sides parse as one
+func compare(op string, left, right interface{}) bool {
+	l, r := toString(left), toString(right)
+	if ln, err := strconv.ParseFloat(l, 64); err == nil {
+		if rn, err := strconv.ParseFloat(r, 64); err == nil {
+			switch op {
+			case "==":
+				return ln == rn
+			case "!=":
+				return ln != rn
+			case "<":
+				return ln < rn
+			case ">":
+				return ln > rn
+			case "<=":
+				return ln <= rn
+			case ">=":
+				return ln >= rn
+			}
+		}
+	}
+	l, r = strings.ToLower(l), strings.ToLower(r)
+	switch op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return l < r
+	case ">":
+		return l > r
+	case "<=":
+		return l <= r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
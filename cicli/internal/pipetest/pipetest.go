@@ -0,0 +1,411 @@
+// Package pipetest simulates events against GitHub Actions workflows to
+// work out which jobs would run, and evaluates assertions such as "a push to
+// main runs deploy" or "pull requests never run deploy", without running
+// anything.
+package pipetest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"cicli/internal/term"
+)
+
+// DefaultFile is where pipeline tests are kept
+var DefaultFile = filepath.Join(".cicli", "pipeline-tests.yml")
+
+// Suite is a file of pipeline tests
+type Suite struct {
+	Tests []Test `yaml:"tests"`
+}
+
+// Test simulates one event and checks which jobs it runs
+type Test struct {
+	Name     string            `yaml:"name"`
+	Workflow string            `yaml:"workflow,omitempty"` // default: every workflow in .github/workflows
+	On       string            `yaml:"on"`
+	Branch   string            `yaml:"branch,omitempty"`   // pushed branch, or the PR's base branch (default main)
+	Branches []string          `yaml:"branches,omitempty"` // the expectations must hold for each of these
+	Head     string            `yaml:"head,omitempty"`     // PR head branch
+	Tag      string            `yaml:"tag,omitempty"`
+	Action   string            `yaml:"action,omitempty"` // activity type, e.g. labeled
+	Paths    []string          `yaml:"paths,omitempty"`  // changed files, checked against paths filters
+	Context  map[string]string `yaml:"context,omitempty"`
+	Expect   Expect            `yaml:"expect"`
+}
+
+// Expect lists what must be true for a test to pass
+type Expect struct {
+	Triggered *bool                          `yaml:"triggered,omitempty"`
+	Runs      []string                       `yaml:"runs,omitempty"`
+	Skips     []string                       `yaml:"skips,omitempty"`
+	Matrix    map[string]map[string][]string `yaml:"matrix,omitempty"` // job → key → values that must appear
+}
+
+// Result is the outcome of one test
+type Result struct {
+	Name     string   `json:"name"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Passed reports whether every expectation held
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Load reads a test suite
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var suite Suite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("invalid pipeline tests in %s: %w", path, err)
+	}
+	for i, t := range suite.Tests {
+		if t.On == "" && len(t.Expect.Matrix) == 0 {
+			return nil, fmt.Errorf("test %d (%s) in %s has no 'on' event", i+1, t.Name, path)
+		}
+	}
+	return &suite, nil
+}
+
+// workflow is a parsed workflow file
+type workflow struct {
+	File  string
+	Doc   map[string]interface{}
+	Jobs  map[string]map[string]interface{}
+	Order []string // job names in the order they appear in the file
+}
+
+func loadWorkflow(file string) (*workflow, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	w := &workflow{File: file, Jobs: make(map[string]map[string]interface{})}
+	if err := yaml.Unmarshal(data, &w.Doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	jobs, _ := w.Doc["jobs"].(map[string]interface{})
+	for name, data := range jobs {
+		if job, ok := data.(map[string]interface{}); ok {
+			w.Jobs[name] = job
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err == nil && len(doc.Content) > 0 {
+		root := doc.Content[0]
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value != "jobs" {
+				continue
+			}
+			for j := 0; j+1 < len(root.Content[i+1].Content); j += 2 {
+				if name := root.Content[i+1].Content[j].Value; w.Jobs[name] != nil {
+					w.Order = append(w.Order, name)
+				}
+			}
+		}
+	}
+	return w, nil
+}
+
+// Run evaluates every test in the suite against the workflows below root
+func Run(suite *Suite, root string) ([]Result, error) {
+	cache := make(map[string]*workflow)
+	load := func(pattern string) ([]*workflow, error) {
+		var files []string
+		if pattern == "" {
+			for _, ext := range []string{"*.yml", "*.yaml"} {
+				matches, _ := filepath.Glob(filepath.Join(root, ".github", "workflows", ext))
+				files = append(files, matches...)
+			}
+		} else {
+			files = []string{filepath.Join(root, pattern)}
+		}
+		sort.Strings(files)
+
+		var out []*workflow
+		for _, f := range files {
+			if cache[f] == nil {
+				w, err := loadWorkflow(f)
+				if err != nil {
+					return nil, err
+				}
+				cache[f] = w
+			}
+			out = append(out, cache[f])
+		}
+		if len(out) == 0 {
+			return nil, fmt.Errorf("no workflows found in %s", filepath.Join(root, ".github", "workflows"))
+		}
+		return out, nil
+	}
+
+	var results []Result
+	for _, t := range suite.Tests {
+		workflows, err := load(t.Workflow)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, t.evaluate(workflows))
+	}
+	return results, nil
+}
+
+func (t Test) evaluate(workflows []*workflow) Result {
+	result := Result{Name: t.Name}
+	if result.Name == "" {
+		result.Name = fmt.Sprintf("on %s", t.On)
+	}
+	fail := func(format string, args ...interface{}) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+	}
+
+	for _, job := range append(append([]string{}, t.Expect.Runs...), t.Expect.Skips...) {
+		if findJob(workflows, job) == nil {
+			fail("no job named %s", job)
+		}
+	}
+
+	branches := t.Branches
+	if len(branches) == 0 {
+		branches = []string{t.Branch}
+	}
+	if t.On != "" {
+		for _, branch := range branches {
+			ev := Event{Name: t.On, Branch: branch, Head: t.Head, Tag: t.Tag, Action: t.Action, Paths: t.Paths}
+			if ev.Branch == "" && ev.Tag == "" {
+				ev.Branch = "main"
+			}
+			if ev.Head == "" {
+				ev.Head = "feature"
+			}
+			where := describe(ev)
+
+			ran := make(map[string]string) // job → workflow it ran in
+			anyTriggered := false
+			for _, w := range workflows {
+				if ok, _ := matchTrigger(w.Doc["on"], ev); !ok {
+					continue
+				}
+				anyTriggered = true
+				for _, job := range w.simulate(ev, t.Context) {
+					if job.Error != "" {
+						fail("%s: job %s: %s", w.File, job.Name, job.Error)
+					} else if job.Runs {
+						ran[job.Name] = w.File
+					}
+				}
+			}
+
+			if t.Expect.Triggered != nil && *t.Expect.Triggered != anyTriggered {
+				if anyTriggered {
+					fail("a workflow runs %s", where)
+				} else {
+					fail("no workflow runs %s", where)
+				}
+			}
+			for _, job := range t.Expect.Runs {
+				if _, ok := ran[job]; !ok && findJob(workflows, job) != nil {
+					fail("%s does not run %s", job, where)
+				}
+			}
+			for _, job := range t.Expect.Skips {
+				if file, ok := ran[job]; ok {
+					fail("%s runs %s (%s)", job, where, file)
+				}
+			}
+		}
+	}
+
+	for _, jobName := range sortedKeys(t.Expect.Matrix) {
+		want := t.Expect.Matrix[jobName]
+		w := findJob(workflows, jobName)
+		if w == nil {
+			fail("no job named %s", jobName)
+			continue
+		}
+		combos, err := expandMatrix(w.Jobs[jobName])
+		if err != nil {
+			fail("%s: %v", jobName, err)
+			continue
+		}
+		for _, key := range sortedKeys(want) {
+			for _, v := range want[key] {
+				if !matrixHas(combos, key, v) {
+					fail("matrix of %s has no %s=%s", jobName, key, v)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// describe phrases an event for failure messages
+func describe(ev Event) string {
+	switch {
+	case ev.Tag != "":
+		return fmt.Sprintf("on %s of tag %s", ev.Name, ev.Tag)
+	case strings.HasPrefix(ev.Name, "pull_request"):
+		return fmt.Sprintf("on %s to %s", ev.Name, ev.Branch)
+	case ev.Name == "push":
+		return fmt.Sprintf("on push to %s", ev.Branch)
+	}
+	return "on " + ev.Name
+}
+
+func findJob(workflows []*workflow, name string) *workflow {
+	for _, w := range workflows {
+		if _, ok := w.Jobs[name]; ok {
+			return w
+		}
+	}
+	return nil
+}
+
+// expandMatrix lists a job's matrix combinations after exclude and include
+// are applied, following GitHub's rules for include
+func expandMatrix(job map[string]interface{}) ([]map[string]string, error) {
+	strategy, _ := job["strategy"].(map[string]interface{})
+	if strategy == nil {
+		return nil, fmt.Errorf("job has no matrix")
+	}
+	matrix, ok := strategy["matrix"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("matrix is computed at runtime and cannot be checked")
+	}
+
+	var keys []string
+	for k := range matrix {
+		if k != "include" && k != "exclude" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	combos := []map[string]string{{}}
+	for _, k := range keys {
+		values, ok := matrix[k].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("matrix key %s is computed at runtime and cannot be checked", k)
+		}
+		var next []map[string]string
+		for _, c := range combos {
+			for _, v := range values {
+				combo := map[string]string{k: fmt.Sprint(v)}
+				for ck, cv := range c {
+					combo[ck] = cv
+				}
+				next = append(next, combo)
+			}
+		}
+		combos = next
+	}
+	if len(keys) == 0 {
+		combos = nil
+	}
+
+	for _, e := range objectList(matrix["exclude"]) {
+		var kept []map[string]string
+		for _, c := range combos {
+			if !subset(e, c) {
+				kept = append(kept, c)
+			}
+		}
+		combos = kept
+	}
+
+	original := len(combos)
+	for _, inc := range objectList(matrix["include"]) {
+		added := false
+		for _, c := range combos[:original] {
+			// An include extends a combination unless it would overwrite one of its original values
+			conflict := false
+			for _, k := range keys {
+				if v, ok := inc[k]; ok && v != c[k] {
+					conflict = true
+				}
+			}
+			if !conflict {
+				for k, v := range inc {
+					c[k] = v
+				}
+				added = true
+			}
+		}
+		if !added {
+			combos = append(combos, inc)
+		}
+	}
+	return combos, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func objectList(v interface{}) []map[string]string {
+	items, _ := v.([]interface{})
+	var out []map[string]string
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			obj := make(map[string]string, len(m))
+			for k, v := range m {
+				obj[k] = fmt.Sprint(v)
+			}
+			out = append(out, obj)
+		}
+	}
+	return out
+}
+
+func subset(part, whole map[string]string) bool {
+	for k, v := range part {
+		if whole[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func matrixHas(combos []map[string]string, key, value string) bool {
+	for _, c := range combos {
+		if c[key] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintReport outputs one line per test and the failures under it
+func PrintReport(file string, results []Result) {
+	failed := 0
+	term.Printf("🧪 Pipeline tests: %s\n", file)
+	term.Println(strings.Repeat("─", 50))
+	for _, r := range results {
+		if r.Passed() {
+			term.Printf("   ✅ %s\n", r.Name)
+			continue
+		}
+		failed++
+		term.Printf("   ❌ %s\n", r.Name)
+		for _, f := range r.Failures {
+			term.Printf("      %s\n", f)
+		}
+	}
+	term.Printf("\n%d test(s), %d failed\n", len(results), failed)
+}
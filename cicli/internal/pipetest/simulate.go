@@ -0,0 +1,240 @@
+package pipetest
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cicli/internal/term"
+)
+
+// JobResult says whether a job runs for a simulated event, and if not, why.
+// Error is set when the job could not be simulated; Runs is then unknown.
+type JobResult struct {
+	Name   string `json:"name"`
+	Runs   bool   `json:"runs"`
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// WorkflowResult is the outcome of a simulated event for one workflow.
+// Error is set when the workflow could not be loaded.
+type WorkflowResult struct {
+	File      string      `json:"file"`
+	Name      string      `json:"name,omitempty"`
+	Triggered bool        `json:"triggered"`
+	Reason    string      `json:"reason,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Jobs      []JobResult `json:"jobs,omitempty"`
+}
+
+// Failed reports whether the workflow or any of its jobs could not be simulated
+func (r WorkflowResult) Failed() bool {
+	if r.Error != "" {
+		return true
+	}
+	for _, job := range r.Jobs {
+		if job.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Simulate evaluates which workflows below root, and which of their jobs,
+// would run for the event. With file set only that workflow is considered.
+// Extra holds expression contexts the event does not define, such as
+// vars.DEPLOY or inputs.environment. A workflow or job that cannot be
+// simulated is reported on its result and the rest are still evaluated.
+func Simulate(root, file string, ev Event, extra map[string]string) ([]WorkflowResult, error) {
+	var files []string
+	if file != "" {
+		files = []string{filepath.Join(root, file)}
+	} else {
+		for _, ext := range []string{"*.yml", "*.yaml"} {
+			matches, _ := filepath.Glob(filepath.Join(root, ".github", "workflows", ext))
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no workflows found in %s", filepath.Join(root, ".github", "workflows"))
+	}
+
+	var results []WorkflowResult
+	for _, f := range files {
+		result := WorkflowResult{File: f}
+		w, err := loadWorkflow(f)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.Name, _ = w.Doc["name"].(string)
+
+		result.Triggered, result.Reason = matchTrigger(w.Doc["on"], ev)
+		if result.Triggered {
+			result.Jobs = w.simulate(ev, extra)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// eventContext is the github context GitHub would set for the event
+func eventContext(ev Event) map[string]string {
+	ctx := map[string]string{
+		"github.event_name":   ev.Name,
+		"github.event.action": ev.Action,
+	}
+	switch {
+	case ev.Tag != "":
+		ctx["github.ref"] = "refs/tags/" + ev.Tag
+		ctx["github.ref_name"] = ev.Tag
+		ctx["github.ref_type"] = "tag"
+	case strings.HasPrefix(ev.Name, "pull_request"):
+		ctx["github.ref"] = "refs/pull/1/merge"
+		ctx["github.ref_name"] = "1/merge"
+		ctx["github.ref_type"] = "branch"
+		ctx["github.base_ref"] = ev.Branch
+		ctx["github.head_ref"] = ev.Head
+	default:
+		ctx["github.ref"] = "refs/heads/" + ev.Branch
+		ctx["github.ref_name"] = ev.Branch
+		ctx["github.ref_type"] = "branch"
+	}
+	return ctx
+}
+
+// simulate decides which jobs of a triggered workflow run for the event.
+// Every job that runs is assumed to succeed, so a job is skipped when its
+// if: is false or a job it needs was skipped (unless its if: uses a status
+// function such as always()). A job whose needs or if: cannot be evaluated
+// gets an Error, as do the jobs needing it. Jobs are returned in file order.
+func (w *workflow) simulate(ev Event, extra map[string]string) []JobResult {
+	ctx := eventContext(ev)
+	for k, v := range extra {
+		ctx[k] = v
+	}
+
+	status := make(map[string]JobResult)
+	visiting := make(map[string]bool)
+	var visit func(name string) JobResult
+	visit = func(name string) JobResult {
+		if result, ok := status[name]; ok {
+			return result
+		}
+		if visiting[name] {
+			return JobResult{Name: name, Error: fmt.Sprintf("jobs needing each other form a cycle through %s", name)}
+		}
+		visiting[name] = true
+		job := w.Jobs[name]
+
+		failed := func(format string, a ...interface{}) JobResult {
+			status[name] = JobResult{Name: name, Error: fmt.Sprintf(format, a...)}
+			return status[name]
+		}
+
+		jobCtx := make(map[string]string, len(ctx))
+		for k, v := range ctx {
+			jobCtx[k] = v
+		}
+		var skippedNeeds []string
+		for _, need := range stringList(job["needs"]) {
+			if _, ok := w.Jobs[need]; !ok {
+				return failed("needs refers to unknown job %s", need)
+			}
+			dep := visit(need)
+			_, recorded := status[need]
+			switch {
+			case dep.Error != "" && !recorded:
+				return failed("%s", dep.Error)
+			case dep.Error != "":
+				return failed("needs %s, which could not be simulated", need)
+			case dep.Runs:
+				jobCtx["needs."+need+".result"] = "success"
+			default:
+				jobCtx["needs."+need+".result"] = "skipped"
+				skippedNeeds = append(skippedNeeds, need)
+			}
+		}
+
+		condition := ""
+		if job["if"] != nil {
+			condition = fmt.Sprint(job["if"])
+		}
+		result := JobResult{Name: name, Runs: true}
+		if len(skippedNeeds) > 0 && !usesStatusFunction(condition) {
+			result.Runs = false
+			result.Reason = fmt.Sprintf("needs %s, which is skipped", strings.Join(skippedNeeds, ", "))
+		} else if ok, err := evalCondition(condition, jobCtx); err != nil {
+			return failed("if: %v", err)
+		} else if !ok {
+			result.Runs = false
+			result.Reason = fmt.Sprintf("if: %s is false", strings.TrimSpace(condition))
+		}
+		status[name] = result
+		return result
+	}
+
+	jobs := make([]JobResult, 0, len(w.Order))
+	for _, name := range w.Order {
+		jobs = append(jobs, visit(name))
+	}
+	return jobs
+}
+
+// PrintSimulation outputs which workflows and jobs run for the event
+func PrintSimulation(ev Event, results []WorkflowResult) {
+	term.Printf("🎯 Simulated %s\n", describeEvent(ev))
+	term.Println(strings.Repeat("─", 50))
+	for _, w := range results {
+		title := w.File
+		if w.Name != "" {
+			title = fmt.Sprintf("%s (%s)", w.File, w.Name)
+		}
+		term.Printf("\n%s\n", title)
+		if w.Error != "" {
+			term.Printf("   ⚠️ could not simulate: %s\n", w.Error)
+			continue
+		}
+		if !w.Triggered {
+			term.Printf("   ⏭️ not triggered: %s\n", w.Reason)
+			continue
+		}
+		for _, job := range w.Jobs {
+			switch {
+			case job.Error != "":
+				term.Printf("   ⚠️ %s — could not simulate: %s\n", job.Name, job.Error)
+			case job.Runs:
+				term.Printf("   ✅ %s\n", job.Name)
+			default:
+				term.Printf("   ⏭️ %s — %s\n", job.Name, job.Reason)
+			}
+		}
+	}
+	term.Println()
+}
+
+// describeEvent phrases an event for the simulation header
+func describeEvent(ev Event) string {
+	var s string
+	switch {
+	case ev.Tag != "":
+		s = fmt.Sprintf("%s of tag %s", ev.Name, ev.Tag)
+	case strings.HasPrefix(ev.Name, "pull_request"):
+		s = fmt.Sprintf("%s from %s into %s", ev.Name, ev.Head, ev.Branch)
+	case ev.Name == "push":
+		s = fmt.Sprintf("push to %s", ev.Branch)
+	default:
+		s = ev.Name
+	}
+	if ev.Action != "" {
+		s += fmt.Sprintf(" (%s)", ev.Action)
+	}
+	if ev.Paths != nil {
+		s += fmt.Sprintf(", changing %s", strings.Join(ev.Paths, ", "))
+	}
+	return s
+}
@@ -0,0 +1,229 @@
+package pipetest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Event is a simulated event a workflow may run for
+type Event struct {
+	Name   string   // push, pull_request, schedule, workflow_dispatch, ...
+	Branch string   // pushed branch, or the base branch of a pull request
+	Head   string   // head branch of a pull request
+	Tag    string   // pushed tag, instead of a branch
+	Action string   // activity type, e.g. opened or labeled
+	Paths  []string // changed files; nil skips path filters
+}
+
+// defaultPRTypes are the pull request activity types that trigger a workflow
+// when on.pull_request.types is not set
+var defaultPRTypes = []string{"opened", "synchronize", "reopened"}
+
+// matchTrigger reports whether a workflow's on: section runs it for the
+// event, and if not, why
+func matchTrigger(on interface{}, ev Event) (bool, string) {
+	noTrigger := fmt.Sprintf("no %s trigger", ev.Name)
+	var filter interface{}
+	switch v := on.(type) {
+	case string:
+		if v != ev.Name {
+			return false, noTrigger
+		}
+		return true, ""
+	case []interface{}:
+		for _, e := range v {
+			if fmt.Sprint(e) == ev.Name {
+				return true, ""
+			}
+		}
+		return false, noTrigger
+	case map[string]interface{}:
+		f, ok := v[ev.Name]
+		if !ok {
+			return false, noTrigger
+		}
+		filter = f
+	default:
+		return false, noTrigger
+	}
+
+	f, _ := filter.(map[string]interface{})
+	switch ev.Name {
+	case "push":
+		return matchPush(f, ev)
+	case "pull_request", "pull_request_target":
+		types := stringList(f["types"])
+		if len(types) == 0 {
+			types = defaultPRTypes
+		}
+		action := ev.Action
+		if action == "" {
+			action = "opened"
+		}
+		if !contains(types, action) {
+			return false, fmt.Sprintf("activity type %s is not in types %v", action, types)
+		}
+		if !matchRefs(f, "branches", ev.Branch) {
+			return false, fmt.Sprintf("base branch %s does not match the branches filter", ev.Branch)
+		}
+		if !matchPaths(f, ev.Paths) {
+			return false, "no changed file matches the paths filter"
+		}
+		return true, ""
+	default:
+		if types := stringList(f["types"]); len(types) > 0 && ev.Action != "" && !contains(types, ev.Action) {
+			return false, fmt.Sprintf("activity type %s is not in types %v", ev.Action, types)
+		}
+		return true, ""
+	}
+}
+
+// matchPush applies branch, tag and path filters the way GitHub does: when
+// only branch filters are set tags never match, and the other way round
+func matchPush(f map[string]interface{}, ev Event) (bool, string) {
+	_, hasBranches := f["branches"]
+	_, hasBranchesIgnore := f["branches-ignore"]
+	_, hasTags := f["tags"]
+	_, hasTagsIgnore := f["tags-ignore"]
+	branchFilter := hasBranches || hasBranchesIgnore
+	tagFilter := hasTags || hasTagsIgnore
+
+	if ev.Tag != "" {
+		if branchFilter && !tagFilter {
+			return false, "only branch pushes are filtered in, not tags"
+		}
+		if !matchRefs(f, "tags", ev.Tag) {
+			return false, fmt.Sprintf("tag %s does not match the tags filter", ev.Tag)
+		}
+		return true, ""
+	}
+	if tagFilter && !branchFilter {
+		return false, "only tag pushes are filtered in, not branches"
+	}
+	if !matchRefs(f, "branches", ev.Branch) {
+		return false, fmt.Sprintf("branch %s does not match the branches filter", ev.Branch)
+	}
+	if !matchPaths(f, ev.Paths) {
+		return false, "no changed file matches the paths filter"
+	}
+	return true, ""
+}
+
+// matchRefs applies a <key> / <key>-ignore filter to a branch or tag name.
+// Patterns starting with ! exclude what earlier patterns matched.
+func matchRefs(f map[string]interface{}, key, name string) bool {
+	if ignore := stringList(f[key+"-ignore"]); len(ignore) > 0 {
+		for _, p := range ignore {
+			if globMatch(p, name) {
+				return false
+			}
+		}
+		return true
+	}
+	patterns, ok := f[key]
+	if !ok {
+		return true
+	}
+	matched := false
+	for _, p := range stringList(patterns) {
+		if strings.HasPrefix(p, "!") {
+			if globMatch(p[1:], name) {
+				matched = false
+			}
+		} else if globMatch(p, name) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchPaths reports whether any changed file passes the paths filters. A
+// nil list means the test did not say which files changed, so paths are
+// not checked.
+func matchPaths(f map[string]interface{}, paths []string) bool {
+	if paths == nil {
+		return true
+	}
+	if ignore := stringList(f["paths-ignore"]); len(ignore) > 0 {
+		for _, path := range paths {
+			ignored := false
+			for _, p := range ignore {
+				if globMatch(p, path) {
+					ignored = true
+				}
+			}
+			if !ignored {
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := f["paths"]; !ok {
+		return true
+	}
+	for _, path := range paths {
+		if matchRefs(f, "paths", path) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches GitHub filter patterns: * does not cross /, ** does,
+// ? and + repeat the previous character, and [] is a character class
+func globMatch(pattern, name string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?', '+':
+			re.WriteByte(c)
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				re.WriteString(regexp.QuoteMeta(pattern[i:]))
+				i = len(pattern)
+				continue
+			}
+			re.WriteString(pattern[i : i+end+1])
+			i += end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	ok, err := regexp.MatchString(re.String(), name)
+	return err == nil && ok
+}
+
+func stringList(v interface{}) []string {
+	switch x := v.(type) {
+	case string:
+		return []string{x}
+	case []interface{}:
+		var out []string
+		for _, e := range x {
+			out = append(out, fmt.Sprint(e))
+		}
+		return out
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"cicli/internal/term"
+)
+
+// Disabled suppresses all progress output (--quiet)
+var Disabled bool
+
+// Plain forces the line-based fallback without animation or symbols
+var Plain bool
+
+// Out is where progress is rendered; stderr keeps stdout clean for reports and JSON
+var Out io.Writer = os.Stderr
+
+// Interactive reports whether animated progress can be drawn
+func Interactive() bool {
+	return !Disabled && !Plain && os.Getenv("CI") == "" && term.IsTerminal(os.Stderr)
+}
+
+var frames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Spinner shows an animated indicator with elapsed time while work runs
+type Spinner struct {
+	label   string
+	start   time.Time
+	stop    chan struct{}
+	done    sync.WaitGroup
+	animate bool
+}
+
+// NewSpinner creates a spinner with the given label
+func NewSpinner(label string) *Spinner {
+	return &Spinner{label: label, animate: Interactive()}
+}
+
+// Start begins rendering the spinner; in plain mode it prints the label once
+func (s *Spinner) Start() {
+	s.start = time.Now()
+	if !s.animate {
+		if !Disabled {
+			fmt.Fprintf(Out, "%s...\n", s.label)
+		}
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done.Add(1)
+	go func() {
+		defer s.done.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			fmt.Fprintf(Out, "\r\x1b[K%s %s (%s)", frames[i%len(frames)], s.label, time.Since(s.start).Round(time.Second))
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the spinner and prints the outcome with the elapsed time
+func (s *Spinner) Stop(err error) {
+	if s.animate {
+		close(s.stop)
+		s.done.Wait()
+		fmt.Fprint(Out, "\r\x1b[K")
+	}
+	if Disabled && err == nil {
+		return
+	}
+
+	elapsed := time.Since(s.start).Round(100 * time.Millisecond)
+	ok, fail := "✓", "✗"
+	if !s.animate {
+		ok, fail = "done:", "failed:"
+	}
+	if err != nil {
+		fmt.Fprintf(Out, "%s %s after %s\n", fail, s.label, elapsed)
+		return
+	}
+	fmt.Fprintf(Out, "%s %s (%s)\n", ok, s.label, elapsed)
+}
+
+// Run wraps fn in a spinner
+func Run(label string, fn func() error) error {
+	s := NewSpinner(label)
+	s.Start()
+	err := fn()
+	s.Stop(err)
+	return err
+}
+
+// RunCommand runs cmd behind a spinner. Interactively the command output is
+// captured and only replayed if it fails; otherwise it streams as usual.
+func RunCommand(cmd *exec.Cmd, label string) error {
+	s := NewSpinner(label)
+	if !s.animate {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		s.Start()
+		err := cmd.Run()
+		s.Stop(err)
+		return err
+	}
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	s.Start()
+	err := cmd.Run()
+	s.Stop(err)
+	if err != nil {
+		os.Stderr.Write(buf.Bytes())
+	}
+	return err
+}
+
+// Bar is a progress bar for a known number of items
+type Bar struct {
+	mu      sync.Mutex
+	label   string
+	total   int
+	current int
+	animate bool
+}
+
+// NewBar creates a progress bar for total items
+func NewBar(label string, total int) *Bar {
+	b := &Bar{label: label, total: total, animate: Interactive()}
+	b.render("")
+	return b
+}
+
+// Increment marks one item as finished, naming it in plain mode
+func (b *Bar) Increment(item string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current++
+	b.render(item)
+}
+
+// Finish completes the bar
+func (b *Bar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.animate {
+		fmt.Fprintln(Out)
+	}
+}
+
+func (b *Bar) render(item string) {
+	if !b.animate {
+		if item != "" && !Disabled {
+			fmt.Fprintf(Out, "[%d/%d] %s %s\n", b.current, b.total, b.label, item)
+		}
+		return
+	}
+
+	const width = 30
+	filled := 0
+	if b.total > 0 {
+		filled = b.current * width / b.total
+	}
+	fmt.Fprintf(Out, "\r\x1b[K%s [%s%s] %d/%d", b.label, strings.Repeat("█", filled), strings.Repeat("░", width-filled), b.current, b.total)
+}
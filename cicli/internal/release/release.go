@@ -0,0 +1,165 @@
+package release
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"cicli/internal/github"
+)
+
+// Commit is one entry of the changelog
+type Commit struct {
+	SHA     string
+	Type    string // conventional commit type, e.g. feat or fix; empty otherwise
+	Subject string
+	Author  string
+}
+
+// Notes are the release notes of one promotion
+type Notes struct {
+	Project string
+	Env     string
+	Image   string
+	From    string // commit previously deployed to Env; empty for the first release
+	To      string // commit being released
+	Commits []Commit
+}
+
+// maxCommits bounds the changelog of a first release, which has no previous commit
+const maxCommits = 100
+
+var conventionalPattern = regexp.MustCompile(`^(\w+)(\([^)]*\))?!?:\s*(.+)$`)
+
+// Compile collects the commits in from..to from the local git history
+func Compile(project, env, image, from, to string) (*Notes, error) {
+	if to == "" {
+		return nil, fmt.Errorf("the released commit is unknown; deploy with cicli from a git checkout so history records it")
+	}
+
+	notes := &Notes{Project: project, Env: env, Image: image, From: from, To: to}
+	if from == to {
+		return notes, nil
+	}
+
+	args := []string{"log", "--no-merges", "--format=%H%x1f%s%x1f%an"}
+	if from != "" {
+		args = append(args, from+".."+to)
+	} else {
+		args = append(args, fmt.Sprintf("--max-count=%d", maxCommits), to)
+	}
+
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log %s: %w (is the commit fetched?)", args[len(args)-1], err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(strings.TrimSuffix(line, "\r"), "\x1f")
+		if len(fields) != 3 {
+			continue
+		}
+		c := Commit{SHA: fields[0], Subject: fields[1], Author: fields[2]}
+		if m := conventionalPattern.FindStringSubmatch(c.Subject); m != nil {
+			c.Type, c.Subject = strings.ToLower(m[1]), m[3]
+		}
+		notes.Commits = append(notes.Commits, c)
+	}
+	return notes, nil
+}
+
+// sections orders changelog groups; other types fall under "Other changes"
+var sections = []struct{ Type, Title string }{
+	{"feat", "Features"},
+	{"fix", "Fixes"},
+	{"perf", "Performance"},
+}
+
+// Markdown renders the notes for a GitHub Release
+func (n *Notes) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Released to **%s** as `%s`.\n", n.Env, n.Image))
+	if len(n.Commits) == 0 {
+		sb.WriteString("\nNo new commits since the previous release.\n")
+		return sb.String()
+	}
+
+	listed := make(map[string]bool)
+	write := func(title string, match func(Commit) bool) {
+		var lines []string
+		for _, c := range n.Commits {
+			if !listed[c.SHA] && match(c) {
+				listed[c.SHA] = true
+				lines = append(lines, fmt.Sprintf("- %s (%s, %s)", c.Subject, short(c.SHA), c.Author))
+			}
+		}
+		if len(lines) > 0 {
+			sb.WriteString(fmt.Sprintf("\n### %s\n\n%s\n", title, strings.Join(lines, "\n")))
+		}
+	}
+	for _, s := range sections {
+		typ := s.Type
+		write(s.Title, func(c Commit) bool { return c.Type == typ })
+	}
+	write("Other changes", func(Commit) bool { return true })
+
+	if n.From != "" {
+		sb.WriteString(fmt.Sprintf("\n**Commits:** %s...%s\n", short(n.From), short(n.To)))
+	}
+	return sb.String()
+}
+
+// Summary is a short plain-text version for chat notifications
+func (n *Notes) Summary() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s released to %s (%s): %d commit(s)", n.Project, n.Env, short(n.To), len(n.Commits)))
+	for i, c := range n.Commits {
+		if i == 10 {
+			sb.WriteString(fmt.Sprintf("\n… and %d more", len(n.Commits)-i))
+			break
+		}
+		sb.WriteString("\n• " + c.Subject)
+	}
+	return sb.String()
+}
+
+// TagName is the git tag of the GitHub Release, e.g. prod-2026-10-16-1432
+func (n *Notes) TagName(now time.Time) string {
+	return fmt.Sprintf("%s-%s", n.Env, now.Format("2006-01-02-1504"))
+}
+
+// PublishGitHub creates a GitHub Release at the released commit, authenticated
+// with GITHUB_TOKEN or GH_TOKEN. It returns the release URL.
+func PublishGitHub(repo string, n *Notes) (string, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		token = os.Getenv("GH_TOKEN")
+	}
+	if token == "" {
+		return "", fmt.Errorf("set GITHUB_TOKEN with contents:write access to publish releases")
+	}
+
+	now := time.Now()
+	body := map[string]interface{}{
+		"tag_name":         n.TagName(now),
+		"target_commitish": n.To,
+		"name":             fmt.Sprintf("%s %s", n.Env, now.Format("2006-01-02 15:04")),
+		"body":             n.Markdown(),
+	}
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := github.NewClient(repo).Post(fmt.Sprintf("/repos/%s/releases", repo), body, &created); err != nil {
+		return "", fmt.Errorf("failed to create release: %w", err)
+	}
+	return created.HTMLURL, nil
+}
+
+func short(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
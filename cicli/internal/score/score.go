@@ -0,0 +1,245 @@
+package score
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cicli/internal/analyzer"
+	"cicli/internal/i18n"
+	"cicli/internal/linter"
+	"cicli/internal/optimizer"
+	"cicli/internal/term"
+)
+
+// Categories are the scorecard dimensions, in report order
+var Categories = []string{"containerization", "testing", "security", "speed", "deployability"}
+
+// Finding explains a deduction
+type Finding struct {
+	Category string `json:"category"`
+	Points   int    `json:"points"`
+	Message  string `json:"message"`
+}
+
+// Scorecard is the combined CI/CD maturity score of a project
+type Scorecard struct {
+	Timestamp  time.Time      `json:"timestamp"`
+	Overall    int            `json:"overall"`
+	Grade      string         `json:"grade"`
+	Categories map[string]int `json:"categories"`
+	Findings   []Finding      `json:"findings,omitempty"`
+	Previous   *Scorecard     `json:"previous,omitempty"`
+}
+
+// Inputs are the reports the scorecard is built from
+type Inputs struct {
+	Root          string
+	Project       *analyzer.ProjectInfo
+	Lint          []*linter.LintResult
+	Optimizations []*optimizer.OptimizationResult
+}
+
+// Compute builds the scorecard. Every category starts at 100 and loses
+// points for each finding.
+func Compute(in Inputs) *Scorecard {
+	card := &Scorecard{Timestamp: time.Now(), Categories: make(map[string]int)}
+	deduct := func(category string, points int, format string, args ...interface{}) {
+		card.Findings = append(card.Findings, Finding{Category: category, Points: points, Message: fmt.Sprintf(format, args...)})
+	}
+
+	info := in.Project
+	exists := func(pattern string) bool {
+		matches, _ := filepath.Glob(filepath.Join(in.Root, pattern))
+		return len(matches) > 0
+	}
+
+	// Containerization
+	if !info.HasDocker {
+		deduct("containerization", 70, "No Dockerfile")
+	} else if !exists(".dockerignore") {
+		deduct("containerization", 15, "Dockerfile without .dockerignore")
+	}
+
+	// Testing
+	ciContent := ciText(in.Lint)
+	if info.TestCommand == "" {
+		deduct("testing", 60, "No test command detected")
+	} else if info.HasCI && !strings.Contains(ciContent, "test") {
+		deduct("testing", 30, "CI does not run the tests")
+	}
+	if !strings.Contains(ciContent, "cover") {
+		deduct("testing", 15, "Coverage is not collected in CI")
+	}
+
+	// Security: lint SEC rules plus analyzer security suggestions
+	for _, r := range in.Lint {
+		for _, issue := range r.Issues {
+			if !strings.HasPrefix(issue.Rule, "SEC") {
+				continue
+			}
+			points := 5
+			if issue.Severity == linter.Error {
+				points = 25
+			}
+			deduct("security", points, "[%s] %s (%s)", issue.Rule, issue.Message, r.File)
+		}
+	}
+	for _, s := range info.Suggestions {
+		if s.Category == "security" {
+			deduct("security", 30, "%s", s.Title)
+		}
+	}
+
+	// Speed: optimizer findings, weighted by impact
+	impact := map[string]int{"high": 15, "medium": 8, "low": 3}
+	for _, r := range in.Optimizations {
+		for _, opt := range r.Optimizations {
+			deduct("speed", impact[opt.Impact], "%s (%s)", opt.Title, r.File)
+		}
+	}
+
+	// Deployability
+	if !info.HasCI {
+		deduct("deployability", 40, "No CI/CD pipeline")
+	}
+	if !exists("k8s/*") && !exists("kubernetes/*") && !exists("helm/*") && !exists("cicli.yaml") {
+		deduct("deployability", 25, "No deployment manifests or cicli.yaml")
+	}
+	if info.HasCI && !strings.Contains(ciContent, "deploy") {
+		deduct("deployability", 20, "CI has no deploy job")
+	}
+
+	total := 0
+	for _, c := range Categories {
+		points := 100
+		for _, f := range card.Findings {
+			if f.Category == c {
+				points -= f.Points
+			}
+		}
+		if points < 0 {
+			points = 0
+		}
+		card.Categories[c] = points
+		total += points
+	}
+	card.Overall = total / len(Categories)
+	card.Grade = grade(card.Overall)
+	return card
+}
+
+// ciText concatenates the linted CI files so simple checks can search them
+func ciText(results []*linter.LintResult) string {
+	var sb strings.Builder
+	for _, r := range results {
+		if content, err := os.ReadFile(r.File); err == nil {
+			sb.Write(content)
+		}
+	}
+	return strings.ToLower(sb.String())
+}
+
+func grade(score int) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 80:
+		return "B"
+	case score >= 70:
+		return "C"
+	case score >= 60:
+		return "D"
+	}
+	return "F"
+}
+
+// History stores past scorecards in the project so the trend can be
+// committed or kept as a CI artifact
+type History struct {
+	path string
+}
+
+// NewHistory opens the score history of the project at root
+func NewHistory(root string) *History {
+	return &History{path: filepath.Join(root, ".cicli", "score-history.json")}
+}
+
+// Load returns all recorded scorecards, oldest first
+func (h *History) Load() ([]Scorecard, error) {
+	data, err := os.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cards []Scorecard
+	if err := json.Unmarshal(data, &cards); err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// Add appends a scorecard without its findings or previous pointer
+func (h *History) Add(card *Scorecard) error {
+	cards, err := h.Load()
+	if err != nil {
+		return err
+	}
+	entry := *card
+	entry.Findings = nil
+	entry.Previous = nil
+	cards = append(cards, entry)
+
+	data, err := json.MarshalIndent(cards, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0644)
+}
+
+// PrintReport prints the scorecard with the change since the previous run
+func (c *Scorecard) PrintReport() {
+	term.Printf("\n🏅 %s\n", i18n.T("CI/CD Maturity Scorecard"))
+	term.Printf("   %s%s\n", i18n.T("Overall: %d/100 (%s)", c.Overall, c.Grade), c.trend(c.Overall, func(p *Scorecard) int { return p.Overall }))
+	term.Println(strings.Repeat("─", 50))
+
+	for _, name := range Categories {
+		points := c.Categories[name]
+		bar := strings.Repeat("█", points/10) + strings.Repeat("░", 10-points/10)
+		term.Printf("   %-17s %s %3d%s\n", i18n.T(name), bar, points, c.trend(points, func(p *Scorecard) int { return p.Categories[name] }))
+	}
+
+	if len(c.Findings) > 0 {
+		term.Println("\n   " + i18n.T("Deductions:"))
+		for _, name := range Categories {
+			for _, f := range c.Findings {
+				if f.Category == name {
+					term.Printf("      -%-3d %s: %s\n", f.Points, i18n.T(name), f.Message)
+				}
+			}
+		}
+	}
+	term.Println()
+}
+
+// trend formats the change of one value against the previous scorecard
+func (c *Scorecard) trend(now int, value func(*Scorecard) int) string {
+	if c.Previous == nil {
+		return ""
+	}
+	switch delta := now - value(c.Previous); {
+	case delta > 0:
+		return fmt.Sprintf("  ▲ +%d", delta)
+	case delta < 0:
+		return fmt.Sprintf("  ▼ %d", delta)
+	}
+	return "  ="
+}
@@ -0,0 +1,402 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"cicli/internal/term"
+)
+
+// Scopes a secret can be exposed at, from widest to narrowest
+const (
+	ScopeWorkflow = "workflow env"
+	ScopeJob      = "job env"
+	ScopeCall     = "reusable workflow"
+	ScopeStep     = "step"
+)
+
+// Use is one reference to a secret in a workflow
+type Use struct {
+	Secret string `json:"secret"`
+	Job    string `json:"job,omitempty"`
+	Step   string `json:"step,omitempty"`
+	Scope  string `json:"scope"`            // workflow env, job env, reusable workflow or step
+	Via    string `json:"via"`              // env, with, run, if or secrets
+	Action string `json:"action,omitempty"` // the action or reusable workflow receiving it
+}
+
+// Finding is a secret exposed more widely than it needs to be
+type Finding struct {
+	Severity string `json:"severity"` // high, medium or low
+	Secret   string `json:"secret,omitempty"`
+	Job      string `json:"job,omitempty"`
+	Step     string `json:"step,omitempty"`
+	Message  string `json:"message"`
+	Fix      string `json:"fix"`
+}
+
+// Workflow lists the secrets one workflow references and how they are exposed
+type Workflow struct {
+	File     string    `json:"file"`
+	Name     string    `json:"name,omitempty"`
+	Triggers []string  `json:"triggers"`
+	Uses     []Use     `json:"uses"`
+	Findings []Finding `json:"findings"`
+}
+
+// Report is the secrets audit of every workflow in a repository
+type Report struct {
+	Workflows []Workflow `json:"workflows"`
+}
+
+var (
+	secretRef    = regexp.MustCompile(`secrets\.([A-Za-z_][A-Za-z0-9_]*)|secrets\[\s*['"]([^'"]+)['"]\s*\]`)
+	allSecrets   = regexp.MustCompile(`(?i)toJSON\(\s*secrets\s*\)`)
+	shaPinned    = regexp.MustCompile(`@[0-9a-f]{40}$`)
+	prHeadRef    = regexp.MustCompile(`github\.event\.pull_request\.head\.(sha|ref)|github\.head_ref|refs/pull/`)
+	firstParties = []string{"actions/", "github/"}
+)
+
+// forkTriggers run with the base repository's secrets for events forks can cause
+var forkTriggers = map[string]string{
+	"pull_request_target": "pull requests from forks",
+	"workflow_run":        "runs that forks can trigger",
+	"issue_comment":       "comments from anyone who can comment",
+}
+
+// Audit inspects the GitHub Actions workflows below root
+func Audit(root string) (*Report, error) {
+	var files []string
+	for _, ext := range []string{"*.yml", "*.yaml"} {
+		matches, _ := filepath.Glob(filepath.Join(root, ".github", "workflows", ext))
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no workflows found in %s", filepath.Join(root, ".github", "workflows"))
+	}
+
+	report := &Report{Workflows: []Workflow{}}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		w, err := auditWorkflow(file, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		report.Workflows = append(report.Workflows, *w)
+	}
+	return report, nil
+}
+
+// auditWorkflow collects the secret references of one workflow and judges them
+func auditWorkflow(file string, data []byte) (*Workflow, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	w := &Workflow{File: file, Triggers: triggers(doc["on"]), Uses: []Use{}, Findings: []Finding{}}
+	w.Name, _ = doc["name"].(string)
+
+	if allSecrets.Match(data) {
+		w.Findings = append(w.Findings, Finding{
+			Severity: "high",
+			Message:  "toJSON(secrets) exposes every repository and organization secret",
+			Fix:      "Reference the secrets the step needs by name",
+		})
+	}
+
+	workflowEnv := refs(doc["env"])
+	for _, name := range workflowEnv {
+		w.Uses = append(w.Uses, Use{Secret: name, Scope: ScopeWorkflow, Via: "env"})
+		w.Findings = append(w.Findings, Finding{
+			Severity: "medium",
+			Secret:   name,
+			Message:  fmt.Sprintf("%s is in the workflow env, so every step of every job can read it", name),
+			Fix:      "Move it to the env of the steps that use it",
+		})
+	}
+
+	var forks []string
+	for _, t := range w.Triggers {
+		if forkTriggers[t] != "" {
+			forks = append(forks, t)
+		}
+	}
+
+	jobs, _ := doc["jobs"].(map[string]interface{})
+	for _, jobName := range jobOrder(data, jobs) {
+		job, _ := jobs[jobName].(map[string]interface{})
+		before := len(w.Uses)
+		w.auditJob(jobName, job)
+
+		// Secrets in the workflow env reach every job
+		if len(forks) > 0 && (len(w.Uses) > before || len(workflowEnv) > 0) {
+			severity, message := "medium", fmt.Sprintf("Job '%s' has secrets on %s (%s)", jobName, strings.Join(forks, ", "), forkTriggers[forks[0]])
+			fix := "Keep untrusted code out of this job, or move the secrets to a separate workflow triggered by workflow_run"
+			if checksOutHead(job) {
+				severity = "high"
+				message = fmt.Sprintf("Job '%s' checks out pull request code while holding secrets on %s", jobName, strings.Join(forks, ", "))
+				fix = "Build the pull request in a pull_request workflow without secrets, and only use its artifacts here"
+			}
+			w.Findings = append(w.Findings, Finding{Severity: severity, Job: jobName, Message: message, Fix: fix})
+		}
+	}
+
+	sort.SliceStable(w.Findings, func(i, j int) bool {
+		return severityRank[w.Findings[i].Severity] < severityRank[w.Findings[j].Severity]
+	})
+	return w, nil
+}
+
+var severityRank = map[string]int{"high": 0, "medium": 1, "low": 2}
+
+// auditJob records the secrets of a job and its steps
+func (w *Workflow) auditJob(jobName string, job map[string]interface{}) {
+	// A job that calls a reusable workflow passes secrets to it directly
+	if called, ok := job["uses"].(string); ok {
+		if job["secrets"] == "inherit" {
+			w.Findings = append(w.Findings, Finding{
+				Severity: "medium",
+				Job:      jobName,
+				Message:  fmt.Sprintf("Job '%s' passes every secret to %s with secrets: inherit", jobName, called),
+				Fix:      "List the secrets the called workflow declares under secrets:",
+			})
+		}
+		for _, name := range refs(job["secrets"]) {
+			w.Uses = append(w.Uses, Use{Secret: name, Job: jobName, Scope: ScopeCall, Via: "secrets", Action: called})
+		}
+		return
+	}
+
+	steps, _ := job["steps"].([]interface{})
+	for _, name := range refs(job["env"]) {
+		w.Uses = append(w.Uses, Use{Secret: name, Job: jobName, Scope: ScopeJob, Via: "env"})
+		if len(steps) > 1 {
+			w.Findings = append(w.Findings, Finding{
+				Severity: "low",
+				Secret:   name,
+				Job:      jobName,
+				Message:  fmt.Sprintf("%s is in the env of job '%s', so all %d of its steps can read it", name, jobName, len(steps)),
+				Fix:      "Move it to the env of the steps that use it",
+			})
+		}
+	}
+	for _, name := range refs(job["if"]) {
+		w.Uses = append(w.Uses, Use{Secret: name, Job: jobName, Scope: ScopeJob, Via: "if"})
+	}
+
+	for i, s := range steps {
+		step, _ := s.(map[string]interface{})
+		stepName, _ := step["name"].(string)
+		action, _ := step["uses"].(string)
+		if stepName == "" {
+			stepName = action
+		}
+		if stepName == "" {
+			stepName = fmt.Sprintf("step %d", i+1)
+		}
+
+		for _, via := range []string{"env", "with", "run", "if"} {
+			names := refs(step[via])
+			for _, name := range names {
+				use := Use{Secret: name, Job: jobName, Step: stepName, Scope: ScopeStep, Via: via}
+				if via == "env" || via == "with" {
+					use.Action = action
+				}
+				w.Uses = append(w.Uses, use)
+
+				if via == "run" {
+					w.Findings = append(w.Findings, Finding{
+						Severity: "low",
+						Secret:   name,
+						Job:      jobName,
+						Step:     stepName,
+						Message:  fmt.Sprintf("%s is written into the script of '%s', where it shows in the process list", name, stepName),
+						Fix:      "Pass it through the step's env and read the variable instead",
+					})
+				}
+			}
+			if (via == "env" || via == "with") && len(names) > 0 && thirdParty(action) {
+				severity, pin := "medium", ""
+				if !shaPinned.MatchString(action) && !strings.HasPrefix(action, "docker://") {
+					severity, pin = "high", ", pinned to a tag its owner can move"
+				}
+				w.Findings = append(w.Findings, Finding{
+					Severity: severity,
+					Secret:   strings.Join(names, ", "),
+					Job:      jobName,
+					Step:     stepName,
+					Message:  fmt.Sprintf("Third-party action %s receives %s through %s%s", action, strings.Join(names, ", "), via, pin),
+					Fix:      "Pin the action to a commit SHA you have reviewed, and give it a token scoped to what it needs",
+				})
+			}
+		}
+	}
+}
+
+// refs returns the secret names referenced anywhere in v, in order
+func refs(v interface{}) []string {
+	if v == nil {
+		return nil
+	}
+	var text string
+	switch t := v.(type) {
+	case string:
+		text = t
+	default:
+		data, _ := yaml.Marshal(v)
+		text = string(data)
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range secretRef.FindAllStringSubmatch(text, -1) {
+		name := m[1] + m[2]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// thirdParty reports whether a step's action comes from outside GitHub and the repository
+func thirdParty(action string) bool {
+	if action == "" || strings.HasPrefix(action, "./") {
+		return false
+	}
+	for _, prefix := range firstParties {
+		if strings.HasPrefix(action, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// checksOutHead reports whether a job checks out the pull request's code
+func checksOutHead(job map[string]interface{}) bool {
+	steps, _ := job["steps"].([]interface{})
+	for _, s := range steps {
+		step, _ := s.(map[string]interface{})
+		action, _ := step["uses"].(string)
+		run, _ := step["run"].(string)
+		with, _ := yaml.Marshal(step["with"])
+		if strings.HasPrefix(action, "actions/checkout") && prHeadRef.Match(with) ||
+			strings.Contains(run, "git") && prHeadRef.MatchString(run) || strings.Contains(run, "gh pr checkout") {
+			return true
+		}
+	}
+	return false
+}
+
+// triggers returns the event names of a workflow's on: key
+func triggers(on interface{}) []string {
+	var names []string
+	switch t := on.(type) {
+	case string:
+		names = []string{t}
+	case []interface{}:
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				names = append(names, s)
+			}
+		}
+	case map[string]interface{}:
+		for name := range t {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	return names
+}
+
+// jobOrder returns job names in the order the workflow defines them
+func jobOrder(data []byte, jobs map[string]interface{}) []string {
+	var order []string
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err == nil && len(doc.Content) > 0 {
+		root := doc.Content[0]
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value != "jobs" {
+				continue
+			}
+			for j := 0; j+1 < len(root.Content[i+1].Content); j += 2 {
+				if name := root.Content[i+1].Content[j].Value; jobs[name] != nil {
+					order = append(order, name)
+				}
+			}
+		}
+	}
+	if len(order) != len(jobs) {
+		order = order[:0]
+		for name := range jobs {
+			order = append(order, name)
+		}
+		sort.Strings(order)
+	}
+	return order
+}
+
+// HasFindings reports whether any workflow has a finding at severity or above
+func (r *Report) HasFindings(severity string) bool {
+	for _, w := range r.Workflows {
+		for _, f := range w.Findings {
+			if severityRank[f.Severity] <= severityRank[severity] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PrintReport prints each workflow's secrets, where they are exposed, and the findings
+func (r *Report) PrintReport() {
+	term.Println("\n🔐 Secrets Audit")
+	term.Println(strings.Repeat("─", 50))
+
+	for _, w := range r.Workflows {
+		term.Printf("\n   %s (on: %s)\n", w.File, strings.Join(w.Triggers, ", "))
+		if len(w.Uses) == 0 {
+			term.Println("      No secrets referenced")
+			continue
+		}
+
+		// Least exposure: each secret with every place it is visible from
+		var names []string
+		places := make(map[string][]string)
+		for _, u := range w.Uses {
+			if places[u.Secret] == nil {
+				names = append(names, u.Secret)
+			}
+			place := u.Scope
+			switch {
+			case u.Step != "":
+				place = fmt.Sprintf("%s › %s (%s)", u.Job, u.Step, u.Via)
+			case u.Job != "" && u.Action != "":
+				place = fmt.Sprintf("%s → %s", u.Job, u.Action)
+			case u.Job != "":
+				place = fmt.Sprintf("%s (%s)", u.Job, u.Scope)
+			}
+			places[u.Secret] = append(places[u.Secret], place)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			term.Printf("      %-24s %s\n", name, strings.Join(places[name], "; "))
+		}
+
+		for _, f := range w.Findings {
+			icon := map[string]string{"high": "🔴", "medium": "🟡", "low": "🟢"}[f.Severity]
+			term.Printf("      %s %s\n", icon, f.Message)
+			term.Printf("         → %s\n", f.Fix)
+		}
+	}
+	term.Println()
+}
@@ -0,0 +1,261 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"cicli/internal/github"
+	"cicli/internal/httpclient"
+	"cicli/internal/term"
+)
+
+// Repo is the GitHub repository cicli releases are published to
+const Repo = "Arnab-Afk/CiCLI"
+
+// CIInstallScript installs the latest cicli release on a Linux CI runner
+const CIInstallScript = `mkdir -p "$HOME/.local/bin"
+curl -sSfL https://github.com/` + Repo + `/releases/latest/download/cicli_linux_amd64.tar.gz | tar -xz -C "$HOME/.local/bin" cicli
+echo "$HOME/.local/bin" >> "$GITHUB_PATH"`
+
+// Release is a published cicli release
+type Release struct {
+	TagName string  `json:"tag_name"`
+	HTMLURL string  `json:"html_url"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a downloadable file attached to a release
+type Asset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+}
+
+// Updater checks for and installs new cicli releases
+type Updater struct {
+	currentVersion string
+	client         *http.Client
+}
+
+// NewUpdater creates an updater for the running version
+func NewUpdater(currentVersion string) *Updater {
+	return &Updater{
+		currentVersion: currentVersion,
+		client:         httpclient.New(60 * time.Second),
+	}
+}
+
+// Latest fetches the latest release metadata from GitHub
+func (u *Updater) Latest() (*Release, error) {
+	var release Release
+	if err := github.NewClient(Repo).Get(fmt.Sprintf("/repos/%s/releases/latest", Repo), &release); err != nil {
+		return nil, fmt.Errorf("failed to query releases: %w", err)
+	}
+	return &release, nil
+}
+
+// IsNewer reports whether the release is newer than the running version
+func (u *Updater) IsNewer(r *Release) bool {
+	return compareVersions(r.TagName, u.currentVersion) > 0
+}
+
+// AssetName returns the archive name for the current OS and architecture
+func AssetName() string {
+	ext := "tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = "zip"
+	}
+	return fmt.Sprintf("cicli_%s_%s.%s", runtime.GOOS, runtime.GOARCH, ext)
+}
+
+// Update downloads the release binary for this platform, verifies its
+// checksum and replaces the running executable
+func (u *Updater) Update(r *Release) error {
+	name := AssetName()
+
+	var archive, checksums *Asset
+	for i := range r.Assets {
+		switch r.Assets[i].Name {
+		case name:
+			archive = &r.Assets[i]
+		case "checksums.txt":
+			checksums = &r.Assets[i]
+		}
+	}
+	if archive == nil {
+		return fmt.Errorf("release %s has no asset %s", r.TagName, name)
+	}
+	if checksums == nil {
+		return fmt.Errorf("release %s has no checksums.txt; refusing to install unverified binary", r.TagName)
+	}
+
+	term.Printf("Downloading %s...\n", archive.Name)
+	data, err := u.download(archive.DownloadURL)
+	if err != nil {
+		return err
+	}
+
+	sums, err := u.download(checksums.DownloadURL)
+	if err != nil {
+		return err
+	}
+	if err := verifyChecksum(data, name, sums); err != nil {
+		return err
+	}
+	term.Println("Checksum verified.")
+
+	binary, err := extractBinary(data, name)
+	if err != nil {
+		return err
+	}
+
+	return replaceExecutable(binary)
+}
+
+func (u *Updater) download(url string) ([]byte, error) {
+	resp, err := u.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("download of %s returned status: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifyChecksum checks data against a "<sha256>  <file>" checksums list
+func verifyChecksum(data []byte, name string, sums []byte) error {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			if !strings.EqualFold(fields[0], actual) {
+				return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, fields[0], actual)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no checksum listed for %s", name)
+}
+
+func extractBinary(data []byte, name string) ([]byte, error) {
+	binName := "cicli"
+	if runtime.GOOS == "windows" {
+		binName = "cicli.exe"
+	}
+
+	if strings.HasSuffix(name, ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open archive: %w", err)
+		}
+		for _, f := range zr.File {
+			if filepath.Base(f.Name) == binName {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(rc)
+			}
+		}
+		return nil, fmt.Errorf("%s not found in %s", binName, name)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if filepath.Base(hdr.Name) == binName {
+			return io.ReadAll(tr)
+		}
+	}
+	return nil, fmt.Errorf("%s not found in %s", binName, name)
+}
+
+// replaceExecutable swaps the running binary for the new one. The new file is
+// written next to the old one so the final rename stays on one filesystem.
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable: %w", err)
+	}
+
+	tmp := exe + ".new"
+	if err := os.WriteFile(tmp, binary, 0755); err != nil {
+		return fmt.Errorf("failed to write new binary (try running with elevated permissions): %w", err)
+	}
+
+	// Windows cannot overwrite a running executable, but it can rename it
+	old := exe + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move current binary aside: %w", err)
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		_ = os.Rename(old, exe)
+		return fmt.Errorf("failed to install new binary: %w", err)
+	}
+	if runtime.GOOS != "windows" {
+		_ = os.Remove(old)
+	}
+
+	term.Printf("Installed %s\n", exe)
+	return nil
+}
+
+// compareVersions compares dotted versions, ignoring a leading "v"
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(strings.SplitN(pa[i], "-", 2)[0])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(strings.SplitN(pb[i], "-", 2)[0])
+		}
+		if na != nb {
+			if na > nb {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
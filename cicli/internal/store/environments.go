@@ -0,0 +1,104 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Environment is an ephemeral environment created with `cicli env create`
+type Environment struct {
+	Name      string    `json:"name"`
+	Project   string    `json:"project"`
+	Namespace string    `json:"namespace"`
+	Host      string    `json:"host,omitempty"`
+	Image     string    `json:"image"`
+	Context   string    `json:"context,omitempty"` // kubectl context it was created in
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the environment outlived its TTL
+func (e *Environment) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// EnvironmentStore tracks ephemeral environments
+type EnvironmentStore struct {
+	FilePath string
+}
+
+func NewEnvironmentStore() (*EnvironmentStore, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	return &EnvironmentStore{
+		FilePath: filepath.Join(dir, "environments.json"),
+	}, nil
+}
+
+// Load returns all tracked environments, oldest first
+func (s *EnvironmentStore) Load() ([]Environment, error) {
+	data, err := os.ReadFile(s.FilePath)
+	if os.IsNotExist(err) {
+		return []Environment{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []Environment
+	if err := json.Unmarshal(data, &envs); err != nil {
+		return nil, err
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].CreatedAt.Before(envs[j].CreatedAt) })
+	return envs, nil
+}
+
+// Put adds an environment or replaces the one with the same project and name
+func (s *EnvironmentStore) Put(env Environment) error {
+	envs, err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range envs {
+		if envs[i].Project == env.Project && envs[i].Name == env.Name {
+			envs[i] = env
+			replaced = true
+		}
+	}
+	if !replaced {
+		envs = append(envs, env)
+	}
+	return s.save(envs)
+}
+
+// Remove forgets an environment
+func (s *EnvironmentStore) Remove(project, name string) error {
+	envs, err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	kept := envs[:0]
+	for _, e := range envs {
+		if e.Project != project || e.Name != name {
+			kept = append(kept, e)
+		}
+	}
+	return s.save(kept)
+}
+
+func (s *EnvironmentStore) save(envs []Environment) error {
+	data, err := json.MarshalIndent(envs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.FilePath, data, 0644)
+}
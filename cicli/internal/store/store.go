@@ -8,26 +8,57 @@ import (
 )
 
 type Deployment struct {
-	ID        string    `json:"id"`
-	Timestamp time.Time `json:"timestamp"`
-	Project   string    `json:"project"`
-	Env       string    `json:"env"`
-	Image     string    `json:"image"`
-	Status    string    `json:"status"`
+	ID           string    `json:"id"`
+	Timestamp    time.Time `json:"timestamp"`
+	Project      string    `json:"project"`
+	Service      string    `json:"service,omitempty"`
+	Env          string    `json:"env"`
+	Image        string    `json:"image"`
+	Status       string    `json:"status"`
+	Cluster      string    `json:"cluster,omitempty"`
+	Override     string    `json:"override,omitempty"`
+	PromotedFrom string    `json:"promoted_from,omitempty"`
+	Commit       string    `json:"commit,omitempty"`
+	Tag          string    `json:"tag,omitempty"`    // tag the image was built as, for runs that push it
+	Stages       []Stage   `json:"stages,omitempty"` // stages of a cicli ship run, in order
+}
+
+// Stage is the outcome of one stage of a cicli ship run
+type Stage struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // success, failed or skipped
+	Error  string `json:"error,omitempty"`
 }
 
 type Store struct {
 	FilePath string
 }
 
-func NewStore() (*Store, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
+// Dir returns the cicli data directory, creating it if needed. It is cicli
+// in the user config directory (%AppData% on Windows, ~/.config on Linux),
+// or ~/.cicli when an older version already keeps its data there.
+func Dir() (string, error) {
+	if home, err := os.UserHomeDir(); err == nil {
+		legacy := filepath.Join(home, ".cicli")
+		if info, err := os.Stat(legacy); err == nil && info.IsDir() {
+			return legacy, nil
+		}
 	}
 
-	dir := filepath.Join(home, ".cicli")
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(config, "cicli")
 	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func NewStore() (*Store, error) {
+	dir, err := Dir()
+	if err != nil {
 		return nil, err
 	}
 
@@ -69,3 +100,46 @@ func (s *Store) Add(d Deployment) error {
 
 	return os.WriteFile(s.FilePath, data, 0644)
 }
+
+// Put adds d, or replaces the entry with the same ID, so a run that records
+// its progress as it goes stays a single entry
+func (s *Store) Put(d Deployment) error {
+	deployments, err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range deployments {
+		if deployments[i].ID == d.ID {
+			deployments[i] = d
+			replaced = true
+		}
+	}
+	if !replaced {
+		deployments = append(deployments, d)
+	}
+
+	data, err := json.MarshalIndent(deployments, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.FilePath, data, 0644)
+}
+
+// Last returns the most recent deployment for a project, service and
+// environment; service is empty for the project itself
+func (s *Store) Last(project, service, env string) (*Deployment, error) {
+	deployments, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(deployments) - 1; i >= 0; i-- {
+		if deployments[i].Project == project && deployments[i].Service == service && deployments[i].Env == env {
+			return &deployments[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,167 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"cicli/internal/converter"
+)
+
+// noopActions do nothing worth repeating locally: the working copy is the
+// checkout, and caches and artifacts are files that stay where they are
+var noopActions = map[string]bool{
+	"actions/checkout":          true,
+	"actions/cache":             true,
+	"actions/cache/restore":     true,
+	"actions/cache/save":        true,
+	"actions/upload-artifact":   true,
+	"actions/download-artifact": true,
+}
+
+// setupTool is what a setup action installs, so a local run can check the
+// machine has it instead
+type setupTool struct {
+	Name    string // what to tell the user to install
+	Command string // binary the action puts on the PATH
+	Version string // prints the installed version
+	Prefix  string // start of Version's output for a version, given as %s
+	Input   string // action input holding the version
+}
+
+var setupTools = map[string]setupTool{
+	"actions/setup-node":         {"Node.js", "node", "node --version", "v%s", "node-version"},
+	"actions/setup-python":       {"Python", "python3", "python3 --version", "Python %s", "python-version"},
+	"actions/setup-go":           {"Go", "go", "go version", "go version go%s", "go-version"},
+	"actions/setup-java":         {"Java", "java", "java -version 2>&1", `openjdk version "%s`, "java-version"},
+	"actions/setup-dotnet":       {".NET", "dotnet", "dotnet --version", "%s", "dotnet-version"},
+	"ruby/setup-ruby":            {"Ruby", "ruby", "ruby --version", "ruby %s", "ruby-version"},
+	"pnpm/action-setup":          {"pnpm", "pnpm", "pnpm --version", "%s", "version"},
+	"oven-sh/setup-bun":          {"Bun", "bun", "bun --version", "%s", "bun-version"},
+	"denoland/setup-deno":        {"Deno", "deno", "deno --version", "deno %s", "deno-version"},
+	"dtolnay/rust-toolchain":     {"Rust", "cargo", "", "", ""},
+	"actions-rs/toolchain":       {"Rust", "cargo", "", "", ""},
+	"hashicorp/setup-terraform":  {"Terraform", "terraform", "terraform version", "Terraform v%s", "terraform_version"},
+	"azure/setup-helm":           {"Helm", "helm", "helm version --short", "v%s", "version"},
+	"azure/setup-kubectl":        {"kubectl", "kubectl", "", "", ""},
+	"docker/setup-buildx-action": {"Docker Buildx", "docker", "", "", ""},
+	"arduino/setup-task":         {"go-task", "task", "", "", ""},
+}
+
+// plainVersionPattern matches versions a prefix check can compare, such as
+// 20, 3.12 or 1.22.x
+var plainVersionPattern = regexp.MustCompile(`^v?([0-9]+(?:\.[0-9]+)*)(?:\.x)?$`)
+
+// Action translates a uses: step into commands that do the same on a
+// developer machine. handled is false when the action has no local
+// equivalent, and reason then says why. A handled action with no commands
+// needs nothing done locally.
+func Action(step converter.Step) (script *Script, handled bool, reason string) {
+	name, _, _ := strings.Cut(step.Uses, "@")
+	switch {
+	case noopActions[name]:
+		return nil, true, ""
+	case strings.HasPrefix(step.Uses, "./"):
+		return localAction(step)
+	}
+	tool, ok := setupTools[name]
+	if !ok {
+		return nil, false, "has no local equivalent"
+	}
+
+	lines := []string{fmt.Sprintf(`command -v %s >/dev/null || { echo "%s is needed, install it (CI uses %s)" >&2; exit 1; }`, tool.Command, tool.Name, name)}
+	if m := plainVersionPattern.FindStringSubmatch(step.With[tool.Input]); m != nil && tool.Version != "" {
+		want := fmt.Sprintf(tool.Prefix, m[1])
+		if strings.Count(m[1], ".") < 2 {
+			// 3.1 should not match 3.12
+			want += "."
+		}
+		lines = append(lines, fmt.Sprintf(`%s | grep -qF %s || echo "warning: CI uses %s %s, found $(%s | head -n 1)" >&2`, tool.Version, shellQuote(want), tool.Name, m[1], tool.Version))
+	}
+	return &Script{Run: strings.Join(lines, "\n")}, true, ""
+}
+
+// localAction runs an action kept in the repository: JavaScript actions
+// with node, with their inputs as INPUT_ variables the way the runner
+// passes them, and composite actions by running their steps
+func localAction(step converter.Step) (*Script, bool, string) {
+	dir := filepath.Clean(step.Uses)
+	var content []byte
+	var err error
+	for _, name := range []string{"action.yml", "action.yaml"} {
+		if content, err = os.ReadFile(filepath.Join(dir, name)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, false, "has no action.yml"
+	}
+	var action struct {
+		Inputs map[string]struct {
+			Default string `yaml:"default"`
+		} `yaml:"inputs"`
+		Runs struct {
+			Using string `yaml:"using"`
+			Main  string `yaml:"main"`
+			Steps []struct {
+				Run     string            `yaml:"run"`
+				Uses    string            `yaml:"uses"`
+				Env     map[string]string `yaml:"env"`
+				WorkDir string            `yaml:"working-directory"`
+			} `yaml:"steps"`
+		} `yaml:"runs"`
+	}
+	if err := yaml.Unmarshal(content, &action); err != nil {
+		return nil, false, "has an action.yml that cannot be parsed"
+	}
+
+	switch using := action.Runs.Using; {
+	case strings.HasPrefix(using, "node") && action.Runs.Main != "":
+		env := make(map[string]string)
+		for name, input := range action.Inputs {
+			env[inputVariable(name)] = input.Default
+		}
+		for name, value := range step.With {
+			env[inputVariable(name)] = value
+		}
+		for name, value := range env {
+			if strings.Contains(value, "${{") {
+				return nil, false, fmt.Sprintf("sets input %s from ${{ }} expressions", name)
+			}
+		}
+		return &Script{Run: "node " + shellQuote(filepath.ToSlash(filepath.Join(dir, action.Runs.Main))), Env: env}, true, ""
+
+	case using == "composite":
+		var lines []string
+		for _, s := range action.Runs.Steps {
+			ok, reason := Extractable(converter.Step{Run: s.Run, Uses: s.Uses, Env: s.Env})
+			if !ok {
+				return nil, false, "has a step that " + reason
+			}
+			sub := Script{Run: strings.TrimRight(s.Run, "\n"), WorkDir: s.WorkDir, Env: s.Env}
+			run := append(sub.prelude(), sub.Run)
+			if sub.isolated() {
+				run = append(append([]string{"("}, run...), ")")
+			}
+			lines = append(lines, run...)
+		}
+		return &Script{Run: strings.Join(lines, "\n")}, true, ""
+	}
+	return nil, false, fmt.Sprintf("runs with %s, which needs a CI runner", action.Runs.Using)
+}
+
+// inputVariable is the variable the runner passes an action input in
+func inputVariable(name string) string {
+	return "INPUT_" + strings.ToUpper(strings.ReplaceAll(name, " ", "_"))
+}
+
+// ciOnly wraps a translated action so it only runs outside CI, where the
+// action step itself runs. Lines are not indented, so heredocs still end.
+func ciOnly(s *Script) Script {
+	run := `if [ -z "${CI:-}" ]; then` + "\n" + s.Run + "\nfi"
+	return Script{Run: run, WorkDir: s.WorkDir, Env: s.Env}
+}
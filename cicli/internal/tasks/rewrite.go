@@ -0,0 +1,164 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"cicli/internal/converter"
+)
+
+// SetupTaskAction installs go-task on GitHub runners, which do not ship it
+const SetupTaskAction = "arduino/setup-task@v2"
+
+// RewriteGitHub replaces the extracted steps of each job in a GitHub Actions
+// workflow with one step that calls the job's target, so CI and local runs
+// share the same commands. Jobs whose extracted steps are split up by steps
+// that stay in CI are left alone, since one call could not keep their order.
+func RewriteGitHub(file string, content []byte, targets []Target, format string) ([]byte, []string) {
+	var notes []string
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil || len(doc.Content) == 0 {
+		return content, []string{fmt.Sprintf("%s: not rewritten, cannot parse YAML", file)}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return content, nil
+	}
+
+	byJob := make(map[string]Target)
+	for _, t := range targets {
+		if t.Source == file {
+			byJob[t.Job] = t
+		}
+	}
+
+	var jobs *yaml.Node
+	jobsEnd := 0 // first line after the jobs mapping, 0 for end of file
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "jobs" && root.Content[i+1].Kind == yaml.MappingNode {
+			jobs = root.Content[i+1]
+			if i+2 < len(root.Content) {
+				jobsEnd = root.Content[i+2].Line
+			}
+		}
+	}
+	if jobs == nil {
+		return content, nil
+	}
+
+	lines := strings.Split(string(content), "\n")
+	if jobsEnd == 0 {
+		jobsEnd = len(lines) + 1
+	}
+
+	type replacement struct {
+		from, to int // 0-based, inclusive line range
+		text     []string
+	}
+	var replacements []replacement
+
+	for i := 0; i+1 < len(jobs.Content); i += 2 {
+		key, body := jobs.Content[i], jobs.Content[i+1]
+		t, ok := byJob[key.Value]
+		if !ok || body.Kind != yaml.MappingNode {
+			continue
+		}
+		jobEnd := jobsEnd
+		if i+2 < len(jobs.Content) {
+			jobEnd = jobs.Content[i+2].Line
+		}
+
+		var steps *yaml.Node
+		stepsEnd := jobEnd
+		for k := 0; k+1 < len(body.Content); k += 2 {
+			if body.Content[k].Value == "steps" {
+				steps = body.Content[k+1]
+				if k+2 < len(body.Content) {
+					stepsEnd = body.Content[k+2].Line
+				}
+			}
+		}
+		if steps == nil || steps.Kind != yaml.SequenceNode || steps.Style&yaml.FlowStyle != 0 {
+			continue
+		}
+
+		first, last := -1, -1
+		contiguous := true
+		for s, node := range steps.Content {
+			var step struct {
+				Name    string            `yaml:"name"`
+				Uses    string            `yaml:"uses"`
+				Run     string            `yaml:"run"`
+				If      string            `yaml:"if"`
+				Env     map[string]string `yaml:"env"`
+				WorkDir string            `yaml:"working-directory"`
+			}
+			if node.Decode(&step) != nil {
+				contiguous = false
+				break
+			}
+			cs := converter.Step{Name: step.Name, Uses: step.Uses, Run: step.Run, If: step.If, Env: step.Env, WorkDir: step.WorkDir}
+			if strings.HasPrefix(cs.Uses, "docker://") {
+				cs.Image = cs.Uses
+			}
+			if ok, _ := Extractable(cs); !ok {
+				continue
+			}
+			if last >= 0 && last != s-1 {
+				contiguous = false
+			}
+			if first < 0 {
+				first = s
+			}
+			last = s
+		}
+		if first < 0 {
+			continue
+		}
+		if !contiguous {
+			notes = append(notes, fmt.Sprintf("%s: job %s not rewritten, its commands are split up by steps that stay in CI", file, key.Value))
+			continue
+		}
+
+		from := steps.Content[first].Line - 1
+		end := stepsEnd
+		if last+1 < len(steps.Content) {
+			end = steps.Content[last+1].Line
+		}
+		// Leave blank lines and comments that introduce the next step in place
+		to := end - 2
+		for to > from && (strings.TrimSpace(lines[to]) == "" || strings.HasPrefix(strings.TrimSpace(lines[to]), "#")) {
+			to--
+		}
+
+		dash := strings.Index(lines[from], "-")
+		if dash < 0 {
+			continue
+		}
+		indent := lines[from][:dash]
+		var text []string
+		command := "make " + t.Name
+		if format == "task" {
+			command = "task " + t.Name
+			text = append(text, indent+"- uses: "+SetupTaskAction)
+		}
+		text = append(text,
+			fmt.Sprintf("%s- name: %s", indent, t.Name),
+			fmt.Sprintf("%s  run: %s", indent, command))
+		replacements = append(replacements, replacement{from: from, to: to, text: text})
+	}
+
+	if len(replacements) == 0 {
+		return content, notes
+	}
+	// Jobs are in document order, so replace from the bottom to keep indices valid
+	for i := len(replacements) - 1; i >= 0; i-- {
+		r := replacements[i]
+		updated := append([]string{}, lines[:r.from]...)
+		updated = append(updated, r.text...)
+		lines = append(updated, lines[r.to+1:]...)
+	}
+	return []byte(strings.Join(lines, "\n")), notes
+}
@@ -0,0 +1,319 @@
+// Package tasks extracts the shell commands of CI jobs into a Makefile or
+// Taskfile.yml, so the same targets run locally and in CI.
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cicli/internal/converter"
+)
+
+// Formats lists the task runners targets can be written for
+var Formats = []string{"make", "task"}
+
+// Target is the extracted commands of one CI job
+type Target struct {
+	Name    string
+	Job     string
+	Source  string   // CI file the job is defined in
+	Steps   []Script // commands in the order the job runs them
+	Needs   []string // targets of the jobs this job needs
+	Skipped []string // steps that stay in CI, with the reason
+}
+
+// Script is one extracted step
+type Script struct {
+	Run     string
+	WorkDir string
+	Env     map[string]string
+}
+
+// ciOnlyPattern matches commands that only make sense on a CI runner
+var ciOnlyPattern = regexp.MustCompile(`\$\{?(GITHUB_OUTPUT|GITHUB_ENV|GITHUB_PATH|GITHUB_STEP_SUMMARY|BASH_ENV)\b`)
+
+// deployPattern matches job names that should not run from a developer machine
+var deployPattern = regexp.MustCompile(`(?i)deploy|release|publish|promote`)
+
+// Extractable reports whether a step can run outside CI, and if not, why
+func Extractable(step converter.Step) (bool, string) {
+	switch {
+	case step.Run == "":
+		return false, "uses an action"
+	case step.Image != "":
+		return false, "runs in its own container"
+	case step.If != "":
+		return false, "has an if: condition"
+	case strings.Contains(step.Run, "${{"):
+		return false, "uses ${{ }} expressions"
+	case ciOnlyPattern.MatchString(step.Run):
+		return false, "writes to runner files such as $GITHUB_OUTPUT"
+	}
+	for _, v := range step.Env {
+		if strings.Contains(v, "${{") {
+			return false, "sets env from ${{ }} expressions"
+		}
+	}
+	return true, ""
+}
+
+// Extract builds one target per job that has extractable run steps. Deploy
+// jobs are left out since they should only run from CI. Targets are ordered
+// so every job comes after the jobs it needs.
+func Extract(source string, config *converter.PipelineConfig) ([]Target, []string) {
+	var targets []Target
+	var notes []string
+
+	for _, job := range config.Jobs {
+		if job.Gate != nil || deployPattern.MatchString(job.Name) {
+			notes = append(notes, fmt.Sprintf("%s: skipped deploy job %s", source, job.Name))
+			continue
+		}
+
+		t := Target{Name: slug(job.Name), Job: job.Name, Source: source}
+		if callsTarget(job, t.Name) {
+			notes = append(notes, fmt.Sprintf("%s: job %s already calls its %s target", source, job.Name, t.Name))
+			continue
+		}
+		commands := 0
+		for _, step := range job.Steps {
+			if step.Uses != "" && step.Run == "" && step.Image == "" {
+				script, handled, reason := Action(step)
+				switch {
+				case !handled:
+					t.Skipped = append(t.Skipped, fmt.Sprintf("%s (%s)", step.Uses, reason))
+					notes = append(notes, fmt.Sprintf("%s: job %s: skipped %s, which %s", source, job.Name, step.Uses, reason))
+				case step.If != "":
+					t.Skipped = append(t.Skipped, fmt.Sprintf("%s (has an if: condition)", step.Uses))
+				case script != nil:
+					t.Steps = append(t.Steps, ciOnly(script))
+				}
+				continue
+			}
+			ok, reason := Extractable(step)
+			if ok {
+				t.Steps = append(t.Steps, Script{Run: strings.TrimRight(step.Run, "\n"), WorkDir: step.WorkDir, Env: step.Env})
+				commands++
+				continue
+			}
+			t.Skipped = append(t.Skipped, fmt.Sprintf("%s (%s)", stepLabel(step), reason))
+		}
+		if commands == 0 {
+			notes = append(notes, fmt.Sprintf("%s: job %s has no commands that run outside CI", source, job.Name))
+			continue
+		}
+		for _, need := range job.DependsOn {
+			t.Needs = append(t.Needs, slug(need))
+		}
+		targets = append(targets, t)
+	}
+
+	return order(targets), notes
+}
+
+// callsTarget reports whether a job was rewritten to run its own target, in
+// which case extracting it again would make the target call itself
+func callsTarget(job converter.Job, name string) bool {
+	for _, step := range job.Steps {
+		run := strings.TrimSpace(step.Run)
+		if run == "make "+name || run == "task "+name {
+			return true
+		}
+	}
+	return false
+}
+
+func stepLabel(step converter.Step) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	line := strings.SplitN(strings.TrimSpace(step.Run), "\n", 2)[0]
+	if len(line) > 40 {
+		line = line[:37] + "..."
+	}
+	return line
+}
+
+// order sorts targets by name, then moves each after the targets it needs
+func order(targets []Target) []Target {
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	byName := make(map[string]Target, len(targets))
+	for _, t := range targets {
+		byName[t.Name] = t
+	}
+
+	var ordered []Target
+	done := make(map[string]bool)
+	var visit func(t Target)
+	visit = func(t Target) {
+		if done[t.Name] {
+			return
+		}
+		done[t.Name] = true
+		for _, need := range t.Needs {
+			if n, ok := byName[need]; ok {
+				visit(n)
+			}
+		}
+		ordered = append(ordered, t)
+	}
+	for _, t := range targets {
+		visit(t)
+	}
+	return ordered
+}
+
+// Merge combines targets from several CI files, prefixing names that clash
+// with the file they came from
+func Merge(sets ...[]Target) []Target {
+	count := make(map[string]int)
+	for _, set := range sets {
+		for _, t := range set {
+			count[t.Name]++
+		}
+	}
+	var merged []Target
+	for _, set := range sets {
+		for _, t := range set {
+			if count[t.Name] > 1 {
+				t.Name = slug(baseName(t.Source) + "-" + t.Name)
+			}
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
+
+func baseName(path string) string {
+	path = path[strings.LastIndex(path, "/")+1:]
+	if i := strings.Index(path, "."); i > 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+func slug(s string) string {
+	s = strings.ToLower(s)
+	s = regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(s, "-")
+	return strings.Trim(s, "-")
+}
+
+// prelude returns the lines that set up a step's environment and directory
+func (s Script) prelude() []string {
+	var lines []string
+	keys := make([]string, 0, len(s.Env))
+	for k := range s.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("export %s=%s", k, shellQuote(s.Env[k])))
+	}
+	if s.WorkDir != "" {
+		lines = append(lines, "cd "+shellQuote(s.WorkDir))
+	}
+	return lines
+}
+
+func shellQuote(s string) string {
+	if regexp.MustCompile(`^[A-Za-z0-9_./:=@%+-]+$`).MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// isolated reports whether a step changes directory or environment, and so
+// has to run in a subshell to leave the following steps unaffected the way
+// separate CI steps are
+func (s Script) isolated() bool {
+	return len(s.Env) > 0 || s.WorkDir != "" || regexp.MustCompile(`(^|[;&|(\s])(cd|export|source|\.)\s`).MatchString(s.Run)
+}
+
+// Makefile renders targets as a GNU Makefile. Recipes use .ONESHELL so
+// multi-line scripts keep their loops and conditionals; steps that change
+// directory or environment run in a subshell so nothing leaks into the next.
+func Makefile(targets []Target) string {
+	var sb strings.Builder
+	sb.WriteString("# Generated by cicli extract from your CI configuration.\n")
+	sb.WriteString("# Needs GNU make 3.82 or newer for .ONESHELL.\n\n")
+	sb.WriteString("SHELL := bash\n")
+	sb.WriteString(".SHELLFLAGS := -e -o pipefail -c\n")
+	sb.WriteString(".ONESHELL:\n\n")
+
+	names := make([]string, 0, len(targets))
+	for _, t := range targets {
+		names = append(names, t.Name)
+	}
+	sb.WriteString(".PHONY: ci " + strings.Join(names, " ") + "\n\n")
+	sb.WriteString("# Run every extracted job in dependency order\n")
+	sb.WriteString("ci: " + strings.Join(names, " ") + "\n")
+
+	for _, t := range targets {
+		sb.WriteString(fmt.Sprintf("\n# %s job in %s\n", t.Job, t.Source))
+		for _, skipped := range t.Skipped {
+			sb.WriteString("# Not extracted: " + skipped + "\n")
+		}
+		sb.WriteString(t.Name + ":\n")
+		for _, step := range t.Steps {
+			lines := append(step.prelude(), strings.Split(step.Run, "\n")...)
+			if step.isolated() {
+				lines = append(append([]string{"("}, lines...), ")")
+			}
+			for _, line := range lines {
+				sb.WriteString("\t" + strings.ReplaceAll(line, "$", "$$") + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Taskfile renders targets as a Taskfile.yml for go-task. Each step is its
+// own command, and {{ is escaped since Taskfiles treat it as a template.
+func Taskfile(targets []Target) string {
+	var sb strings.Builder
+	sb.WriteString("# Generated by cicli extract from your CI configuration.\n")
+	sb.WriteString("version: '3'\n\n")
+	sb.WriteString("tasks:\n")
+	sb.WriteString("  ci:\n")
+	sb.WriteString("    desc: Run every extracted job in dependency order\n")
+	sb.WriteString("    cmds:\n")
+	for _, t := range targets {
+		sb.WriteString("      - task: " + t.Name + "\n")
+	}
+
+	for _, t := range targets {
+		sb.WriteString("\n")
+		for _, skipped := range t.Skipped {
+			sb.WriteString("  # Not extracted: " + skipped + "\n")
+		}
+		sb.WriteString("  " + t.Name + ":\n")
+		sb.WriteString(fmt.Sprintf("    desc: %s job in %s\n", t.Job, t.Source))
+		sb.WriteString("    cmds:\n")
+		for _, step := range t.Steps {
+			lines := append(step.prelude(), strings.Split(step.Run, "\n")...)
+			for i := range lines {
+				lines[i] = strings.ReplaceAll(lines[i], "{{", `{{"{{"}}`)
+			}
+			if len(lines) == 1 && !needsBlock(lines[0]) {
+				sb.WriteString("      - " + lines[0] + "\n")
+				continue
+			}
+			sb.WriteString("      - |\n")
+			for _, line := range lines {
+				if line == "" {
+					sb.WriteString("\n")
+				} else {
+					sb.WriteString("        " + line + "\n")
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+// needsBlock reports whether a command would be misread as a plain YAML scalar
+func needsBlock(s string) bool {
+	return strings.ContainsAny(s, ":#{}[]&*!|>'\"%@`") || strings.HasPrefix(s, "-") || strings.HasPrefix(s, "?")
+}
@@ -0,0 +1,128 @@
+package term
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Mode controls which decorations are stripped from output
+type Mode struct {
+	NoEmoji bool
+	NoBox   bool
+	NoColor bool
+}
+
+// Plain reports whether any decoration is stripped
+func (m Mode) Plain() bool {
+	return m.NoEmoji || m.NoBox || m.NoColor
+}
+
+// DetectMode returns a fully plain mode when stdout is not a terminal,
+// when running in CI, or when NO_COLOR is set
+func DetectMode() Mode {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("CI") != "" || !IsTerminal(os.Stdout) {
+		return Mode{NoEmoji: true, NoBox: true, NoColor: true}
+	}
+	return Mode{}
+}
+
+// IsTerminal reports whether f is attached to a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// emojiReplacements keeps the meaning of status icons in plain output
+var emojiReplacements = strings.NewReplacer(
+	"✅", "[ok]",
+	"❌", "[x]",
+	"⏭️", "[skip]",
+	"⏭", "[skip]",
+	"⚠️", "[!]",
+	"⚠", "[!]",
+	"🚨", "[!!]",
+	"ℹ️", "[i]",
+	"ℹ", "[i]",
+	"🔴", "[high]",
+	"🟡", "[medium]",
+	"🟢", "[low]",
+	"→", "->",
+	"•", "*",
+)
+
+var boxReplacements = strings.NewReplacer(
+	"─", "-", "━", "-", "═", "=",
+	"│", "|", "┃", "|", "║", "|",
+	"┌", "+", "┐", "+", "└", "+", "┘", "+",
+	"├", "+", "┤", "+", "┬", "+", "┴", "+", "┼", "+",
+)
+
+// Sanitize strips the decorations disabled in mode from s
+func Sanitize(s string, mode Mode) string {
+	if mode.NoColor {
+		s = ansiPattern.ReplaceAllString(s, "")
+	}
+	if mode.NoBox {
+		s = boxReplacements.Replace(s)
+	}
+	if mode.NoEmoji {
+		s = emojiReplacements.Replace(s)
+		s = strings.Map(func(r rune) rune {
+			if isEmoji(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	return s
+}
+
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // pictographs, emoticons, transport, symbols
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // misc symbols and dingbats
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF: // arrows and stars used as emoji
+		return true
+	case r == 0xFE0F || r == 0x200D: // variation selector, zero-width joiner
+		return true
+	}
+	return false
+}
+
+var active Mode
+
+// Output is where Printf, Println and Print write. Commands whose stdout
+// carries JSON or SARIF point it at stderr.
+var Output io.Writer = os.Stdout
+
+// SetMode sets the mode used by Printf, Println and Print
+func SetMode(m Mode) {
+	active = m
+}
+
+// Printf formats like fmt.Printf and writes the sanitized text to Output.
+// It is meant for status and report text; machine-readable output such as
+// JSON, YAML, converted pipelines and diffs is printed with fmt unchanged.
+func Printf(format string, a ...interface{}) {
+	io.WriteString(Output, Sanitize(fmt.Sprintf(format, a...), active))
+}
+
+// Println is the fmt.Println counterpart of Printf
+func Println(a ...interface{}) {
+	io.WriteString(Output, Sanitize(fmt.Sprintln(a...), active))
+}
+
+// Print is the fmt.Print counterpart of Printf
+func Print(a ...interface{}) {
+	io.WriteString(Output, Sanitize(fmt.Sprint(a...), active))
+}
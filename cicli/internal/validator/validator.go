@@ -5,15 +5,25 @@ import (
 	"os/exec"
 )
 
+// CheckDocker reports whether docker is installed and its daemon answers.
+// The binary is looked up on PATH first (docker.exe on Windows), so a missing
+// install is told apart from a stopped daemon.
 func CheckDocker() error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("docker is not installed or not on PATH: %w", err)
+	}
 	cmd := exec.Command("docker", "info")
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("docker is not running or not installed: %w", err)
+		return fmt.Errorf("docker is not running: %w", err)
 	}
 	return nil
 }
 
+// CheckKubectl reports whether kubectl is installed and reaches a cluster
 func CheckKubectl() error {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return fmt.Errorf("kubectl is not installed or not on PATH: %w", err)
+	}
 	cmd := exec.Command("kubectl", "cluster-info")
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("kubectl is not configured or cluster is unreachable: %w", err)
@@ -0,0 +1,372 @@
+package yamlfmt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyOrder lists, per platform and level, the keys that come first and in
+// which order. Keys not listed keep their relative order after them, so job
+// names and custom keys are never reshuffled.
+var keyOrder = map[string]map[string][]string{
+	"github": {
+		"workflow": {"name", "run-name", "on", "permissions", "env", "defaults", "concurrency", "jobs"},
+		"job":      {"name", "needs", "if", "runs-on", "environment", "concurrency", "permissions", "outputs", "env", "defaults", "timeout-minutes", "continue-on-error", "strategy", "container", "services", "uses", "with", "secrets", "steps"},
+		"step":     {"name", "id", "if", "uses", "with", "run", "shell", "working-directory", "env", "continue-on-error", "timeout-minutes"},
+		"action":   {"name", "description", "author", "inputs", "outputs", "runs", "branding"},
+	},
+	"gitlab": {
+		"workflow": {"spec", "include", "stages", "variables", "default", "workflow"},
+		"job":      {"stage", "extends", "image", "services", "needs", "dependencies", "rules", "only", "except", "variables", "cache", "before_script", "script", "after_script", "artifacts", "environment", "coverage", "when", "allow_failure", "timeout", "retry", "parallel", "tags"},
+	},
+	"circleci": {
+		"workflow": {"version", "setup", "orbs", "parameters", "executors", "commands", "jobs", "workflows"},
+		"job":      {"docker", "machine", "macos", "executor", "resource_class", "parallelism", "working_directory", "environment", "parameters", "steps"},
+	},
+	"azure": {
+		"workflow": {"name", "trigger", "pr", "schedules", "resources", "variables", "pool", "stages", "jobs", "steps"},
+	},
+	"bitbucket": {
+		"workflow": {"image", "clone", "options", "definitions", "pipelines"},
+	},
+}
+
+// gitlabGlobals are top-level .gitlab-ci.yml keys that are not jobs
+var gitlabGlobals = map[string]bool{
+	"spec": true, "include": true, "stages": true, "variables": true, "default": true, "workflow": true,
+	"image": true, "services": true, "cache": true, "before_script": true, "after_script": true,
+}
+
+// DetectPlatform names the CI platform of path, or "" when it is not a
+// CI file fmt knows
+func DetectPlatform(path string) string {
+	slashed := filepath.ToSlash(path)
+	switch {
+	case strings.Contains(slashed, ".github/workflows/"):
+		return "github"
+	case strings.Contains(slashed, ".github/actions/") && (filepath.Base(path) == "action.yml" || filepath.Base(path) == "action.yaml"):
+		return "github-action"
+	case strings.HasPrefix(filepath.Base(path), ".gitlab-ci"):
+		return "gitlab"
+	case strings.Contains(slashed, ".circleci/"):
+		return "circleci"
+	case strings.HasPrefix(filepath.Base(path), "azure-pipelines"):
+		return "azure"
+	case strings.HasPrefix(filepath.Base(path), "bitbucket-pipelines"):
+		return "bitbucket"
+	case strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml"):
+		return "yaml"
+	}
+	return ""
+}
+
+// Discover returns the CI YAML files under dir: workflows and local
+// actions, and the GitLab, CircleCI, Azure and Bitbucket configs
+func Discover(dir string) []string {
+	var files []string
+	for _, pattern := range []string{
+		".github/workflows/*.yml", ".github/workflows/*.yaml",
+		".github/actions/*/action.yml", ".github/actions/*/action.yaml",
+		".gitlab-ci.yml", ".circleci/config.yml", "azure-pipelines.yml", "bitbucket-pipelines.yml",
+	} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// FormatFile formats the CI YAML at path and returns the original and
+// formatted content
+func FormatFile(path string) (before, after []byte, err error) {
+	before, err = os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err = Format(before, DetectPlatform(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return before, after, nil
+}
+
+// Format rewrites CI YAML canonically: two-space indentation with indented
+// sequences, keys in the platform's conventional order, plain scalars where
+// YAML allows them and single quotes otherwise. Comments are kept, and so is
+// one blank line wherever the original had blank lines between entries.
+func Format(content []byte, platform string) ([]byte, error) {
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return content, nil
+	}
+
+	lines := strings.Split(string(content), "\n")
+	var out bytes.Buffer
+	for i, doc := range docs {
+		// Spacing is read from the original before keys move
+		spaced := make(map[*yaml.Node]bool)
+		markSpacing(doc, lines, spaced)
+		normalize(doc, platform, platform == "gitlab" && i == 0 && len(docs) > 1)
+
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+		encoder.Close()
+
+		formatted, err := restoreSpacing(buf.String(), doc, spaced)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			out.WriteString("---\n")
+		}
+		out.WriteString(formatted)
+	}
+	return out.Bytes(), nil
+}
+
+// normalize orders keys and picks scalar styles, in place
+func normalize(doc *yaml.Node, platform string, header bool) {
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	restyle(root)
+	if root.Kind != yaml.MappingNode || header {
+		// A GitLab spec header document is left in its order
+		return
+	}
+
+	switch platform {
+	case "github":
+		order(root, keyOrder["github"]["workflow"])
+		for _, job := range values(root, "jobs") {
+			order(job, keyOrder["github"]["job"])
+			for _, step := range items(job, "steps") {
+				order(step, keyOrder["github"]["step"])
+			}
+		}
+	case "github-action":
+		order(root, keyOrder["github"]["action"])
+		if runs := value(root, "runs"); runs != nil {
+			for _, step := range items(runs, "steps") {
+				order(step, keyOrder["github"]["step"])
+			}
+		}
+	case "gitlab":
+		order(root, keyOrder["gitlab"]["workflow"])
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if job := root.Content[i+1]; !gitlabGlobals[root.Content[i].Value] && job.Kind == yaml.MappingNode {
+				order(job, keyOrder["gitlab"]["job"])
+			}
+		}
+	case "circleci":
+		order(root, keyOrder["circleci"]["workflow"])
+		for _, job := range values(root, "jobs") {
+			order(job, keyOrder["circleci"]["job"])
+		}
+	case "azure", "bitbucket":
+		order(root, keyOrder[platform]["workflow"])
+	}
+}
+
+// value returns the value of key in mapping, or nil
+func value(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// values returns the mapping values under key, such as the jobs of a workflow
+func values(mapping *yaml.Node, key string) []*yaml.Node {
+	var result []*yaml.Node
+	if m := value(mapping, key); m != nil && m.Kind == yaml.MappingNode {
+		for i := 1; i < len(m.Content); i += 2 {
+			if m.Content[i].Kind == yaml.MappingNode {
+				result = append(result, m.Content[i])
+			}
+		}
+	}
+	return result
+}
+
+// items returns the mapping items of the sequence under key, such as steps
+func items(mapping *yaml.Node, key string) []*yaml.Node {
+	var result []*yaml.Node
+	if s := value(mapping, key); s != nil && s.Kind == yaml.SequenceNode {
+		for _, item := range s.Content {
+			if item.Kind == yaml.MappingNode {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
+
+// order sorts the keys of mapping so those in known come first, in that
+// order; the rest keep their relative order. Merge keys stay in front.
+func order(mapping *yaml.Node, known []string) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return
+	}
+	rank := func(key string) int {
+		if key == "<<" {
+			return -1
+		}
+		for i, k := range known {
+			if k == key {
+				return i
+			}
+		}
+		return len(known)
+	}
+	pairs := make([][2]*yaml.Node, 0, len(mapping.Content)/2)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{mapping.Content[i], mapping.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return rank(pairs[i][0].Value) < rank(pairs[j][0].Value)
+	})
+	for i, pair := range pairs {
+		mapping.Content[2*i], mapping.Content[2*i+1] = pair[0], pair[1]
+	}
+}
+
+// restyle makes quoted strings plain when YAML reads them the same way
+// unquoted, and single-quoted otherwise. Block scalars keep their style.
+func restyle(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) == 0 || node.Tag != "!!str" {
+			return
+		}
+		plain, err := yaml.Marshal(node.Value)
+		switch {
+		case err == nil && strings.TrimSuffix(string(plain), "\n") == node.Value:
+			node.Style = 0
+		case strings.IndexFunc(node.Value, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0:
+			node.Style = yaml.DoubleQuotedStyle
+		default:
+			node.Style = yaml.SingleQuotedStyle
+		}
+		return
+	}
+	for _, child := range node.Content {
+		restyle(child)
+	}
+}
+
+// entries returns the nodes that start a line of their own: mapping keys
+// and sequence items, in document order
+func entries(node *yaml.Node, visit func(*yaml.Node)) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			visit(node.Content[i])
+			entries(node.Content[i+1], visit)
+		}
+	case yaml.SequenceNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			return
+		}
+		for _, item := range node.Content {
+			visit(item)
+			entries(item, visit)
+		}
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			entries(child, visit)
+		}
+	}
+}
+
+// firstLine returns the line an entry starts on, counting its head comment,
+// which for a sequence item may be attached to its first key
+func firstLine(node *yaml.Node) int {
+	line := node.Line
+	if node.HeadComment != "" {
+		line -= strings.Count(node.HeadComment, "\n") + 1
+	}
+	if node.Kind == yaml.MappingNode && len(node.Content) > 0 && node.Content[0].Line == node.Line {
+		if first := firstLine(node.Content[0]); first < line {
+			line = first
+		}
+	}
+	return line
+}
+
+// markSpacing records the entries that follow a blank line in the original
+func markSpacing(doc *yaml.Node, lines []string, spaced map[*yaml.Node]bool) {
+	entries(doc, func(n *yaml.Node) {
+		if line := firstLine(n); line >= 2 && line-2 < len(lines) && strings.TrimSpace(lines[line-2]) == "" {
+			spaced[n] = true
+		}
+	})
+}
+
+// restoreSpacing puts a blank line back before the spaced entries. The
+// encoded text is parsed again and walked alongside doc, which has the same
+// shape, to find where each entry ended up.
+func restoreSpacing(encoded string, doc *yaml.Node, spaced map[*yaml.Node]bool) (string, error) {
+	if len(spaced) == 0 {
+		return encoded, nil
+	}
+	var reparsed yaml.Node
+	if err := yaml.Unmarshal([]byte(encoded), &reparsed); err != nil {
+		return "", err
+	}
+	var original, formatted []*yaml.Node
+	entries(doc, func(n *yaml.Node) { original = append(original, n) })
+	entries(&reparsed, func(n *yaml.Node) { formatted = append(formatted, n) })
+	if len(original) != len(formatted) {
+		return encoded, nil
+	}
+
+	blank := make(map[int]bool)
+	for i, n := range original {
+		if spaced[n] {
+			blank[firstLine(formatted[i])] = true
+		}
+	}
+	lines := strings.SplitAfter(encoded, "\n")
+	var sb strings.Builder
+	for i, line := range lines {
+		if blank[i+1] && i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(line)
+	}
+	return sb.String(), nil
+}